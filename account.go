@@ -0,0 +1,119 @@
+package authkit
+
+import (
+	"context"
+	"time"
+)
+
+// DeleteAccount is the self-service deletion path. With a DeletionGracePeriod
+// configured the account is only marked for deletion and can be recovered with
+// RecoverAccount until its PurgeAt time; otherwise it is removed immediately.
+func (a *AuthKit) DeleteAccount(userID string) error {
+	if a.config.DeletionGracePeriod <= 0 {
+		return a.DeleteUser(userID)
+	}
+
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+	if stored.PurgeAt != nil {
+		a.mutex.Unlock()
+		return ErrAccountPendingDeletion
+	}
+
+	user := cloneUser(stored)
+	now := a.now()
+	purgeAt := now.Add(a.config.DeletionGracePeriod)
+	user.PurgeAt = &purgeAt
+	user.UpdatedAt = now
+	a.users.put(user)
+	a.mutex.Unlock()
+
+	a.audit(AuditEvent{Type: AuditUserDeleted, ActorID: userID, UserID: userID,
+		Metadata: map[string]string{"purge_at": purgeAt.Format(time.RFC3339)}})
+	return nil
+}
+
+// RecoverAccount restores an account that is pending deletion, given the
+// user's credentials. Unknown emails and wrong passwords both fail with
+// ErrInvalidCredentials; ErrAccountNotPendingDeletion is only returned once
+// the credentials are verified. Attempts count towards the account lockout
+// like logins, so a locked account fails with ErrAccountLocked.
+func (a *AuthKit) RecoverAccount(email, password string) (*UserInfo, error) {
+	return a.RecoverAccountCtx(context.Background(), email, password)
+}
+
+// RecoverAccountCtx is RecoverAccount with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) RecoverAccountCtx(ctx context.Context, email, password string) (*UserInfo, error) {
+	return a.RecoverAccountInTenantCtx(ctx, "", email, password)
+}
+
+// RecoverAccountInTenant is RecoverAccount for the user with the email in the
+// tenant, see LoginUserInTenant
+func (a *AuthKit) RecoverAccountInTenant(tenantID, email, password string) (*UserInfo, error) {
+	return a.RecoverAccountInTenantCtx(context.Background(), tenantID, email, password)
+}
+
+// RecoverAccountInTenantCtx is RecoverAccountInTenant with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) RecoverAccountInTenantCtx(ctx context.Context, tenantID, email, password string) (*UserInfo, error) {
+	a.debugCheck()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, err := a.GetUserByEmailInTenant(tenantID, email)
+	if err != nil {
+		if err := a.compareDummyPassword(ctx, password); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := a.checkLoginPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// The account may have been purged while the password was being checked
+	stored, exists := a.users.get(user.ID)
+	if !exists {
+		return nil, ErrInvalidCredentials
+	}
+	if stored.PurgeAt == nil {
+		return nil, ErrAccountNotPendingDeletion
+	}
+
+	user = cloneUser(stored)
+	user.PurgeAt = nil
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+
+	return a.userToUserInfo(user), nil
+}
+
+// PurgeExpiredAccounts permanently removes accounts whose deletion grace period
+// has elapsed and returns how many were removed. It runs periodically in the
+// background when DeletionGracePeriod is set, but can also be called directly.
+func (a *AuthKit) PurgeExpiredAccounts() int {
+	a.mutex.Lock()
+	now := a.now()
+	var purged []string
+	for _, user := range a.users.all() {
+		if user.PurgeAt != nil && user.DeletedAt == nil && !now.Before(*user.PurgeAt) {
+			a.removeUser(user)
+			purged = append(purged, user.ID)
+		}
+	}
+	a.mutex.Unlock()
+
+	for _, userID := range purged {
+		a.userDeleted("", userID)
+	}
+	return len(purged)
+}
@@ -0,0 +1,311 @@
+package authkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAccountRecoveryWithinGracePeriod(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{DeletionGracePeriod: 30 * 24 * time.Hour, JanitorInterval: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "regret@example.com", Password: "password123", Name: "Regret"})
+
+	if err := auth.DeleteAccount(user.ID); err != nil {
+		t.Fatalf("Expected account to be scheduled for deletion, got %v", err)
+	}
+
+	_, err := auth.LoginUser("regret@example.com", "password123")
+	if !errors.Is(err, ErrAccountPendingDeletion) {
+		t.Errorf("Expected ErrAccountPendingDeletion, got %v", err)
+	}
+
+	listed := auth.ListUsers()
+	if len(listed) != 1 || !listed[0].PendingDeletion || listed[0].PurgeAt == nil {
+		t.Errorf("Expected pending deletion status in user list, got %+v", listed)
+	}
+
+	now = now.Add(29 * 24 * time.Hour)
+	if purged := auth.PurgeExpiredAccounts(); purged != 0 {
+		t.Errorf("Expected no accounts purged inside the window, got %d", purged)
+	}
+
+	if _, err := auth.RecoverAccount("regret@example.com", "wrongpassword"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	recovered, err := auth.RecoverAccount("regret@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected successful recovery, got %v", err)
+	}
+	if recovered.PendingDeletion {
+		t.Error("Expected recovered account not to be pending deletion")
+	}
+
+	if _, err := auth.LoginUser("regret@example.com", "password123"); err != nil {
+		t.Errorf("Expected login after recovery, got %v", err)
+	}
+
+	if _, err := auth.RecoverAccount("regret@example.com", "password123"); !errors.Is(err, ErrAccountNotPendingDeletion) {
+		t.Errorf("Expected ErrAccountNotPendingDeletion, got %v", err)
+	}
+}
+
+func TestAccountRecoveryCountsTowardsLockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{DeletionGracePeriod: 30 * 24 * time.Hour, JanitorInterval: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "guessed@example.com", Password: "password123", Name: "Guessed"})
+	_ = auth.DeleteAccount(user.ID)
+
+	for i := 0; i < defaultMaxLoginAttempts; i++ {
+		if _, err := auth.RecoverAccount("guessed@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+
+	r := gin.New()
+	r.POST("/account/recover", auth.RecoverAccountHandler)
+	req := httptest.NewRequest(http.MethodPost, "/account/recover", strings.NewReader(`{"email":"guessed@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), CodeAccountLocked) {
+		t.Errorf("Expected 423 with the correct password, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := auth.LoginUser("guessed@example.com", "password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected the account to be locked for logins, got %v", err)
+	}
+
+	now = now.Add(defaultLockoutDuration)
+	if _, err := auth.RecoverAccount("guessed@example.com", "password123"); err != nil {
+		t.Errorf("Expected recovery once the lock expired, got %v", err)
+	}
+}
+
+func TestAccountRecoveryInTenant(t *testing.T) {
+	auth := newTestKit(t, Config{
+		DeletionGracePeriod: 30 * 24 * time.Hour,
+		TenantResolver:      &TenantResolver{Header: "X-Tenant-ID"},
+	})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "default-password", Name: "Bob"})
+	acme, _ := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "acme-password", Name: "Bob", TenantID: "acme"})
+	_ = auth.DeleteAccount(acme.ID)
+
+	if _, err := auth.RecoverAccount("bob@example.com", "acme-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected RecoverAccount to only look in the default tenant, got %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/account/recover", auth.RecoverAccountHandler)
+	app := fiber.New()
+	app.Post("/account/recover", auth.RecoverAccountHandlerFiber)
+	for name, serve := range map[string]func(w http.ResponseWriter, req *http.Request){
+		"gin":   r.ServeHTTP,
+		"fiber": func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			_ = auth.DeleteAccount(acme.ID)
+			req := httptest.NewRequest(http.MethodPost, "/account/recover", strings.NewReader(`{"email":"bob@example.com","password":"acme-password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Tenant-ID", "acme")
+			w := httptest.NewRecorder()
+			serve(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected the acme account to be recovered, got %d: %s", w.Code, w.Body.String())
+			}
+			if user, _ := auth.GetUserByID(acme.ID); user.PurgeAt != nil {
+				t.Error("Expected the acme account not to be pending deletion")
+			}
+		})
+	}
+}
+
+func TestAccountPurgedAfterGracePeriod(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{DeletionGracePeriod: 30 * 24 * time.Hour, JanitorInterval: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "gone@example.com", Password: "password123", Name: "Gone"})
+	tokens, _ := auth.LoginUser("gone@example.com", "password123")
+	_ = auth.DeleteAccount(user.ID)
+
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrAccountPendingDeletion) {
+		t.Errorf("Expected refresh to fail while pending deletion, got %v", err)
+	}
+
+	now = now.Add(30 * 24 * time.Hour)
+	if purged := auth.PurgeExpiredAccounts(); purged != 1 {
+		t.Errorf("Expected one account purged, got %d", purged)
+	}
+
+	if _, err := auth.GetUserByID(user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound after purge, got %v", err)
+	}
+	if _, err := auth.RecoverAccount("gone@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials recovering a purged account, got %v", err)
+	}
+}
+
+func TestDeleteAccountWithoutGracePeriod(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "now@example.com", Password: "password123", Name: "Now"})
+
+	if err := auth.DeleteAccount(user.ID); err != nil {
+		t.Fatalf("Expected deletion, got %v", err)
+	}
+	if _, err := auth.GetUserByID(user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected immediate removal, got %v", err)
+	}
+}
+
+func TestAccountRecoveryHandlers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{DeletionGracePeriod: 30 * 24 * time.Hour, JanitorInterval: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/account/recover", auth.RecoverAccountHandler)
+	r.DELETE("/account", auth.GinMiddleware(), auth.DeleteAccountHandler)
+
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "handler@example.com", Password: "password123", Name: "Handler"})
+	tokens, _ := auth.LoginUser("handler@example.com", "password123")
+	credentials := `{"email":"handler@example.com","password":"password123"}`
+
+	req := httptest.NewRequest(http.MethodDelete, "/account", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 deleting account, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "hint") {
+		t.Errorf("Expected 403 with recovery hint, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/account/recover", strings.NewReader(credentials))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 recovering account, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAccountRecoveryDoesNotRevealAccounts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{DeletionGracePeriod: 30 * 24 * time.Hour, JanitorInterval: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "active@example.com", Password: "password123", Name: "Active"})
+
+	r := gin.New()
+	r.POST("/account/recover", auth.RecoverAccountHandler)
+	app := fiber.New()
+	app.Post("/account/recover", auth.RecoverAccountHandlerFiber)
+
+	recoverAccount := func(email, password string) (ginStatus int, ginBody string, fiberStatus int, fiberBody string) {
+		credentials := `{"email":"` + email + `","password":"` + password + `"}`
+
+		req := httptest.NewRequest(http.MethodPost, "/account/recover", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		req = httptest.NewRequest(http.MethodPost, "/account/recover", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return w.Code, w.Body.String(), resp.StatusCode, string(body)
+	}
+
+	// Unknown emails and wrong passwords can't be told apart
+	ginKnown, ginKnownBody, fiberKnown, fiberKnownBody := recoverAccount("active@example.com", "wrong-password")
+	ginUnknown, ginUnknownBody, fiberUnknown, fiberUnknownBody := recoverAccount("unknown@example.com", "wrong-password")
+	if ginKnown != http.StatusUnauthorized || ginUnknown != http.StatusUnauthorized || ginKnownBody != ginUnknownBody {
+		t.Errorf("Expected identical 401s from Gin, got %d %s and %d %s", ginKnown, ginKnownBody, ginUnknown, ginUnknownBody)
+	}
+	if fiberKnown != fiber.StatusUnauthorized || fiberUnknown != fiber.StatusUnauthorized || fiberKnownBody != fiberUnknownBody {
+		t.Errorf("Expected identical 401s from Fiber, got %d %s and %d %s", fiberKnown, fiberKnownBody, fiberUnknown, fiberUnknownBody)
+	}
+	if !strings.Contains(ginKnownBody, CodeInvalidCredentials) {
+		t.Errorf("Expected %s code, got %s", CodeInvalidCredentials, ginKnownBody)
+	}
+
+	// Only the correct password learns that the account isn't pending deletion
+	if ginStatus, _, fiberStatus, _ := recoverAccount("active@example.com", "password123"); ginStatus != http.StatusConflict || fiberStatus != fiber.StatusConflict {
+		t.Errorf("Expected 409 with the correct password, got %d and %d", ginStatus, fiberStatus)
+	}
+}
+
+func TestLoginDoesNotRevealUnknownEmails(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "known@example.com", Password: "password123", Name: "Known"})
+
+	_, wrongPassword := auth.LoginUser("known@example.com", "wrong-password")
+	_, unknownEmail := auth.LoginUser("unknown@example.com", "wrong-password")
+	if !errors.Is(wrongPassword, ErrInvalidCredentials) || !errors.Is(unknownEmail, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for both, got %v and %v", wrongPassword, unknownEmail)
+	}
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	app := fiber.New()
+	app.Post("/login", auth.LoginHandlerFiber)
+
+	login := func(email string) (ginStatus int, ginBody string, fiberStatus int, fiberBody string) {
+		credentials := `{"email":"` + email + `","password":"wrong-password"}`
+
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return w.Code, w.Body.String(), resp.StatusCode, string(body)
+	}
+
+	ginKnown, ginKnownBody, fiberKnown, fiberKnownBody := login("known@example.com")
+	ginUnknown, ginUnknownBody, fiberUnknown, fiberUnknownBody := login("unknown@example.com")
+
+	if ginKnown != http.StatusUnauthorized || ginUnknown != http.StatusUnauthorized {
+		t.Errorf("Expected 401 from Gin for both, got %d and %d", ginKnown, ginUnknown)
+	}
+	if ginKnownBody != ginUnknownBody {
+		t.Errorf("Expected identical Gin bodies, got %s and %s", ginKnownBody, ginUnknownBody)
+	}
+	if fiberKnown != fiber.StatusUnauthorized || fiberUnknown != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 from Fiber for both, got %d and %d", fiberKnown, fiberUnknown)
+	}
+	if fiberKnownBody != fiberUnknownBody {
+		t.Errorf("Expected identical Fiber bodies, got %s and %s", fiberKnownBody, fiberUnknownBody)
+	}
+	if !strings.Contains(ginKnownBody, CodeInvalidCredentials) {
+		t.Errorf("Expected %s code, got %s", CodeInvalidCredentials, ginKnownBody)
+	}
+}
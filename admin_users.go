@@ -0,0 +1,63 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// updates converts the request to UpdateUser's updates
+func (r AdminUpdateUserRequest) updates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	if r.Name != nil {
+		updates["name"] = *r.Name
+	}
+	if r.Role != nil {
+		updates["role"] = *r.Role
+	}
+	if r.Permissions != nil {
+		updates["permissions"] = r.Permissions
+	}
+	if r.Metadata != nil {
+		updates["metadata"] = r.Metadata
+	}
+	if r.MustChangePassword != nil {
+		updates["must_change_password"] = *r.MustChangePassword
+	}
+	return updates
+}
+
+// userInfo returns the user with the given ID, leaving out soft-deleted users
+func (a *AuthKit) userInfo(ctx context.Context, userID string) (*UserInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, exists := a.users.get(userID)
+	if !exists || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return a.userToUserInfo(user), nil
+}
+
+// adminUpdateUser applies an admin update user request as actorID
+func (a *AuthKit) adminUpdateUser(ctx context.Context, actorID, userID string, req AdminUpdateUserRequest) (*UserInfo, error) {
+	if req.Role != nil && *req.Role == "" {
+		return nil, ErrInvalidRole
+	}
+	if _, err := a.userInfo(ctx, userID); err != nil {
+		return nil, err
+	}
+	return a.UpdateUserCtx(WithAuditActor(ctx, actorID), userID, req.updates())
+}
+
+// adminUserErrorStatus maps the errors of the admin user handlers to HTTP status codes
+func adminUserErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUserAlreadyExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,101 @@
+package authkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminUserHandlers(t *testing.T) {
+	sink := NewMemoryAuditLog(0)
+	auth := newTestKit(t, Config{RateLimitRPM: -1, AuditLogger: sink})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "plain@example.com")
+	admin, _ := auth.AdminCreateUser(RegisterRequest{Email: "admin@example.com", Password: "password123", Name: "Admin", Role: "admin"})
+	adminTokens, err := auth.LoginUser(admin.Email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, handler := range mountRoutes(t, auth, RouteOptions{}) {
+		t.Run(name, func(t *testing.T) {
+			send := func(method, path, token, body string) (int, map[string]interface{}) {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				var decoded map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+					t.Fatalf("%s %s: expected JSON, got %q", method, path, w.Body.String())
+				}
+				return w.Code, decoded
+			}
+			admin := func(method, path, body string) (int, map[string]interface{}) {
+				return send(method, path, adminTokens.AccessToken, body)
+			}
+
+			if code, _ := send(http.MethodGet, "/admin/users", user.AccessToken, ""); code != http.StatusForbidden {
+				t.Errorf("Expected 403 for a non-admin, got %d", code)
+			}
+
+			email := name + "-created@example.com"
+			code, decoded := admin(http.MethodPost, "/admin/users", `{"email":"`+email+`","password":"password123","name":"Created","role":"editor"}`)
+			created, _ := decoded["user"].(map[string]interface{})
+			if code != http.StatusCreated || created["role"] != "editor" {
+				t.Fatalf("Expected the user created with its role, got %d %v", code, decoded)
+			}
+			id := created["id"].(string)
+			if code, decoded := admin(http.MethodPost, "/admin/users", `{"email":"`+email+`","password":"password123","name":"Again"}`); code != http.StatusConflict || errorField(decoded, "code") != CodeUserAlreadyExists {
+				t.Errorf("Expected 409 user_already_exists, got %d %v", code, decoded)
+			}
+
+			code, decoded = admin(http.MethodGet, "/admin/users?limit=1&offset=1", "")
+			users, _ := decoded["users"].([]interface{})
+			if code != http.StatusOK || len(users) != 1 || decoded["total"].(float64) < 3 || decoded["limit"] != float64(1) {
+				t.Errorf("Expected a one-user page, got %d %v", code, decoded)
+			}
+			if code, decoded := admin(http.MethodGet, "/admin/users?limit=ten", ""); code != http.StatusBadRequest || errorField(decoded, "code") != CodeInvalidRequest {
+				t.Errorf("Expected 400 for a malformed limit, got %d %v", code, decoded)
+			}
+
+			if code, decoded := admin(http.MethodGet, "/admin/users/"+id, ""); code != http.StatusOK || decoded["email"] != email || decoded["password"] != nil {
+				t.Errorf("Expected the user without a password, got %d %v", code, decoded)
+			}
+			if code, decoded := admin(http.MethodGet, "/admin/users/missing", ""); code != http.StatusNotFound || errorField(decoded, "code") != CodeUserNotFound {
+				t.Errorf("Expected 404 user_not_found, got %d %v", code, decoded)
+			}
+
+			code, decoded = admin(http.MethodPatch, "/admin/users/"+id, `{"name":"Renamed","permissions":["posts:write"]}`)
+			updated, _ := decoded["user"].(map[string]interface{})
+			if code != http.StatusOK || updated["name"] != "Renamed" || updated["role"] != "editor" || len(updated["permissions"].([]interface{})) != 1 {
+				t.Errorf("Expected the name and permissions updated, got %d %v", code, decoded)
+			}
+
+			code, decoded = admin(http.MethodPut, "/admin/users/"+id+"/role", `{"role":"moderator"}`)
+			updated, _ = decoded["user"].(map[string]interface{})
+			if code != http.StatusOK || updated["role"] != "moderator" {
+				t.Errorf("Expected the role set, got %d %v", code, decoded)
+			}
+			if code, decoded := admin(http.MethodPut, "/admin/users/"+id+"/role", `{"role":""}`); code != http.StatusBadRequest || errorField(decoded, "code") != CodeInvalidRole {
+				t.Errorf("Expected 400 invalid_role, got %d %v", code, decoded)
+			}
+
+			if code, _ := admin(http.MethodDelete, "/admin/users/"+id, ""); code != http.StatusOK {
+				t.Errorf("Expected the user deleted, got %d", code)
+			}
+			if code, _ := admin(http.MethodDelete, "/admin/users/"+id, ""); code != http.StatusNotFound {
+				t.Errorf("Expected 404 deleting again, got %d", code)
+			}
+
+			for _, eventType := range []AuditEventType{AuditUserRegistered, AuditUserUpdated, AuditRoleChanged, AuditUserDeleted} {
+				events := sink.Query(AuditQuery{Type: eventType, UserID: id})
+				if len(events) == 0 || events[len(events)-1].ActorID != adminTokens.User.ID {
+					t.Errorf("Expected %s audited with the admin as actor, got %+v", eventType, events)
+				}
+			}
+		})
+	}
+}
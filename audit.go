@@ -0,0 +1,200 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultAuditLogSize is how many events a MemoryAuditLog keeps by default
+const defaultAuditLogSize = 1000
+
+// AuditEventType identifies what an AuditEvent records
+type AuditEventType string
+
+// Audit event types emitted by AuthKit
+const (
+	AuditUserRegistered    AuditEventType = "user.registered"
+	AuditLoginSucceeded    AuditEventType = "login.succeeded"
+	AuditLoginFailed       AuditEventType = "login.failed"
+	AuditTokenRefreshed    AuditEventType = "token.refreshed"
+	AuditUserUpdated       AuditEventType = "user.updated"
+	AuditRoleChanged       AuditEventType = "user.role_changed"
+	AuditUserDeleted       AuditEventType = "user.deleted"
+	AuditUserPurged        AuditEventType = "user.purged"
+	AuditTokenRevoked      AuditEventType = "token.revoked"
+	AuditUserTokensRevoked AuditEventType = "user.tokens_revoked"
+	AuditSessionRevoked    AuditEventType = "session.revoked"
+	AuditIdentityLinked    AuditEventType = "user.identity_linked"
+	AuditIdentityUnlinked  AuditEventType = "user.identity_unlinked"
+	AuditIPBanned          AuditEventType = "ip.banned"
+	AuditIPUnbanned        AuditEventType = "ip.unbanned"
+)
+
+// AuditEvent is an entry in the audit trail. ActorID is the user who acted,
+// empty when AuthKit can't tell (e.g. admin APIs called directly without
+// WithAuditActor), and UserID
+// is the user acted on.
+type AuditEvent struct {
+	Type     AuditEventType    `json:"type"`
+	ActorID  string            `json:"actor_id,omitempty"`
+	UserID   string            `json:"user_id,omitempty"`
+	Time     time.Time         `json:"time"`
+	IP       string            `json:"ip,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// AuditLogger receives audit events, see Config.AuditLogger. Log is called
+// synchronously but never while AuthKit holds its locks.
+type AuditLogger interface {
+	Log(event AuditEvent)
+}
+
+// AuditQuery selects events from a MemoryAuditLog. Zero fields match everything.
+type AuditQuery struct {
+	Type   AuditEventType
+	UserID string // Matches events where the user is the actor or the target
+	Since  time.Time
+	Limit  int
+}
+
+// matches reports whether the event passes the query's filters
+func (q AuditQuery) matches(event AuditEvent) bool {
+	if q.Type != "" && event.Type != q.Type {
+		return false
+	}
+	if q.UserID != "" && event.UserID != q.UserID && event.ActorID != q.UserID {
+		return false
+	}
+	return q.Since.IsZero() || !event.Time.Before(q.Since)
+}
+
+// MemoryAuditLog is an AuditLogger keeping the most recent events in memory
+type MemoryAuditLog struct {
+	events []AuditEvent // Ring buffer
+	next   int          // Where the next event goes
+	full   bool
+	mutex  sync.Mutex
+}
+
+// NewMemoryAuditLog creates an audit log keeping the last size events (default 1000)
+func NewMemoryAuditLog(size int) *MemoryAuditLog {
+	if size <= 0 {
+		size = defaultAuditLogSize
+	}
+	return &MemoryAuditLog{events: make([]AuditEvent, size)}
+}
+
+// Log stores the event, overwriting the oldest one when full
+func (l *MemoryAuditLog) Log(event AuditEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Query returns the stored events matching q, newest first
+func (l *MemoryAuditLog) Query(q AuditQuery) []AuditEvent {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.events)
+	}
+
+	result := make([]AuditEvent, 0)
+	for i := 1; i <= count; i++ {
+		event := l.events[(l.next-i+len(l.events))%len(l.events)]
+		if !q.matches(event) {
+			continue
+		}
+		result = append(result, event)
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// JSONAuditLogger is an AuditLogger writing each event as a line of JSON
+type JSONAuditLogger struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewJSONAuditLogger creates an audit logger writing JSON lines to w.
+// Write errors are ignored, so w should handle its own failures.
+func NewJSONAuditLogger(w io.Writer) *JSONAuditLogger {
+	return &JSONAuditLogger{encoder: json.NewEncoder(w)}
+}
+
+// Log writes the event as a line of JSON
+func (l *JSONAuditLogger) Log(event AuditEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_ = l.encoder.Encode(event)
+}
+
+// auditRoleChange records a change of the user's role from one role to another, if it changed
+func (a *AuthKit) auditRoleChange(actorID, userID, from, to string) {
+	if from == to {
+		return
+	}
+	a.audit(AuditEvent{Type: AuditRoleChanged, ActorID: actorID, UserID: userID,
+		Metadata: map[string]string{"from": from, "to": to}})
+}
+
+// userDeleted audits, as done by actorID, and runs the hook for a user
+// DeleteUser removed, or with Config.SoftDelete marked deleted
+func (a *AuthKit) userDeleted(actorID, userID string) {
+	event := AuditEvent{Type: AuditUserDeleted, ActorID: actorID, UserID: userID}
+	if a.config.SoftDelete {
+		event.Metadata = map[string]string{"soft": "true"}
+	}
+	a.audit(event)
+
+	if hook := a.config.Hooks.OnUserDeleted; hook != nil {
+		a.runHook("OnUserDeleted", func() error { return hook(userID) })
+	}
+}
+
+// auditActorContextKey is the context key WithAuditActor stores the actor under
+type auditActorContextKey struct{}
+
+// WithAuditActor returns a context that makes AdminCreateUserCtx,
+// UpdateUserCtx and DeleteUserCtx record actorID as the ActorID of their
+// audit events. The bundled admin user handlers set it to the admin's user ID.
+func WithAuditActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, auditActorContextKey{}, actorID)
+}
+
+// auditActor returns the actor set with WithAuditActor, or ""
+func auditActor(ctx context.Context) string {
+	actorID, _ := ctx.Value(auditActorContextKey{}).(string)
+	return actorID
+}
+
+// audit sends an event to Config.AuditLogger and the webhooks, if set.
+// Callers must not hold a.mutex.
+func (a *AuthKit) audit(event AuditEvent) {
+	if a.config.AuditLogger == nil && a.webhooks == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = a.now()
+	}
+	if a.config.AuditLogger != nil {
+		a.config.AuditLogger.Log(event)
+	}
+	if a.webhooks != nil {
+		a.enqueueWebhook(event)
+	}
+}
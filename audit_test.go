@@ -0,0 +1,130 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reentrantAuditLogger calls back into AuthKit from Log, which deadlocks if
+// events are emitted while the store mutex is held
+type reentrantAuditLogger struct {
+	*MemoryAuditLog
+	auth *AuthKit
+}
+
+func (l *reentrantAuditLogger) Log(event AuditEvent) {
+	l.auth.ListUsers()
+	l.MemoryAuditLog.Log(event)
+}
+
+func TestAuditEvents(t *testing.T) {
+	sink := &reentrantAuditLogger{MemoryAuditLog: NewMemoryAuditLog(0)}
+	auth := newTestKit(t, Config{AuditLogger: sink})
+	defer auth.Close()
+	sink.auth = auth
+	_ = auth.DefineRole("editor", nil)
+
+	done := make(chan struct{})
+	var userID string
+	go func() {
+		defer close(done)
+		user, _ := auth.RegisterUser(RegisterRequest{Email: "audit@example.com", Password: "password123", Name: "Audit"})
+		userID = user.ID
+		_, _ = auth.LoginUser("nobody@example.com", "password123", LoginContext{IP: "203.0.113.1"})
+		_, _ = auth.LoginUser("audit@example.com", "wrong-password")
+		tokens, _ := auth.LoginUser("audit@example.com", "password123", LoginContext{IP: "203.0.113.2"})
+		_, _ = auth.RefreshToken(tokens.RefreshToken)
+		_, _ = auth.UpdateUser(userID, map[string]interface{}{"name": "Renamed", "role": "admin"})
+		_ = auth.AssignRole(userID, "editor")
+		_ = auth.RemoveRole(userID, "editor")
+		_ = auth.RevokeSession(tokens.SessionID)
+		_ = auth.RevokeAllUserTokens(userID)
+		_ = auth.DeleteUser(userID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Audit events were emitted while holding the store mutex")
+	}
+
+	events := sink.Query(AuditQuery{})
+	var types []AuditEventType
+	for i := len(events) - 1; i >= 0; i-- {
+		types = append(types, events[i].Type)
+	}
+	want := []AuditEventType{
+		AuditUserRegistered, AuditLoginFailed, AuditLoginFailed, AuditLoginSucceeded, AuditTokenRefreshed,
+		AuditUserUpdated, AuditRoleChanged, AuditRoleChanged, AuditRoleChanged,
+		AuditSessionRevoked, AuditUserTokensRevoked, AuditUserDeleted,
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("Expected events %v, got %v", want, types)
+	}
+
+	unknown := events[len(events)-2]
+	if unknown.UserID != "" || unknown.IP != "203.0.113.1" || unknown.Metadata["email"] != "nobody@example.com" {
+		t.Errorf("Expected the failed login for an unknown email, got %+v", unknown)
+	}
+	if wrong := events[len(events)-3]; wrong.UserID != userID || wrong.Metadata["reason"] != CodeInvalidCredentials {
+		t.Errorf("Expected the failed login with its reason, got %+v", wrong)
+	}
+	if login := events[len(events)-4]; login.ActorID != userID || login.IP != "203.0.113.2" || login.Time.IsZero() {
+		t.Errorf("Expected the login with its actor and IP, got %+v", login)
+	}
+	if updated := events[len(events)-6]; updated.Metadata["fields"] != "name,role" {
+		t.Errorf("Expected the updated fields, got %+v", updated)
+	}
+	if role := events[len(events)-7]; role.Metadata["from"] != "user" || role.Metadata["to"] != "admin" {
+		t.Errorf("Expected the role change, got %+v", role)
+	}
+
+	if refreshes := sink.Query(AuditQuery{Type: AuditTokenRefreshed, UserID: userID}); len(refreshes) != 1 {
+		t.Errorf("Expected one refresh for the user, got %+v", refreshes)
+	}
+	if limited := sink.Query(AuditQuery{UserID: userID, Limit: 2}); len(limited) != 2 || limited[0].Type != AuditUserDeleted {
+		t.Errorf("Expected the two newest events, got %+v", limited)
+	}
+	if future := sink.Query(AuditQuery{Since: time.Now().Add(time.Hour)}); len(future) != 0 {
+		t.Errorf("Expected no events in the future, got %+v", future)
+	}
+}
+
+func TestMemoryAuditLogRingBuffer(t *testing.T) {
+	log := NewMemoryAuditLog(3)
+	for _, userID := range []string{"1", "2", "3", "4", "5"} {
+		log.Log(AuditEvent{Type: AuditUserRegistered, UserID: userID})
+	}
+
+	var userIDs []string
+	for _, event := range log.Query(AuditQuery{}) {
+		userIDs = append(userIDs, event.UserID)
+	}
+	if want := []string{"5", "4", "3"}; !reflect.DeepEqual(userIDs, want) {
+		t.Errorf("Expected %v, got %v", want, userIDs)
+	}
+}
+
+func TestJSONAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONAuditLogger(&buf)
+	auth := newTestKit(t, Config{AuditLogger: logger})
+	defer auth.Close()
+
+	loginTestUser(t, auth, "json@example.com")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two lines, got %q", buf.String())
+	}
+	var event AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != AuditLoginSucceeded || event.UserID == "" || event.Time.IsZero() {
+		t.Errorf("Expected a login event, got %+v", event)
+	}
+}
@@ -1,218 +1,1026 @@
 package authkit
 
 import (
-	//"errors"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// New creates a new AuthKit instance with the given configuration
+// New creates a new AuthKit instance with the given configuration.
+// It panics if the configuration is invalid; use NewValidated to get an error instead.
 func New(config Config) *AuthKit {
+	auth, err := NewValidated(config)
+	if err != nil {
+		panic("authkit: " + err.Error())
+	}
+	return auth
+}
+
+// NewValidated creates a new AuthKit instance, returning an error if the configuration is invalid
+func NewValidated(config Config) (*AuthKit, error) {
+	return NewWithOptions(WithConfig(config))
+}
+
+// newAuthKit fills in the defaults of config, validates it and creates the
+// AuthKit. Lifetimes set by WithTokenExpiry and WithRefreshExpiry take
+// precedence over Config.TokenExpiry and Config.RefreshExpiry.
+func newAuthKit(config Config, lifetimes tokenLifetimes) (*AuthKit, error) {
 	// Set default values
 	if config.BCryptCost == 0 {
 		config.BCryptCost = 12
 	}
+	if config.PasswordHasher == "" {
+		config.PasswordHasher = PasswordHasherBcrypt
+	}
+	config.Argon2 = config.Argon2.withDefaults()
 	if config.TokenExpiry == "" {
 		config.TokenExpiry = "24h"
 	}
+	if config.AllowedSelfRegisterRoles == nil {
+		config.AllowedSelfRegisterRoles = []string{defaultRole}
+	}
 	if config.RefreshExpiry == "" {
 		config.RefreshExpiry = "7d"
 	}
+	if config.RememberMeExpiry == "" {
+		config.RememberMeExpiry = "30d"
+	}
 	if config.RateLimitRPM == 0 {
 		config.RateLimitRPM = 60
 	}
+	if config.JanitorInterval <= 0 {
+		config.JanitorInterval = time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = SystemClock
+	}
+	if config.TokenCacheTTL <= 0 {
+		config.TokenCacheTTL = defaultTokenCacheTTL
+	}
+	if config.UserStatusCacheSize == 0 {
+		config.UserStatusCacheSize = defaultUserStatusCacheSize
+	}
+	if config.UserStatusCacheTTL <= 0 {
+		config.UserStatusCacheTTL = defaultUserStatusCacheTTL
+	}
+	if config.NonceStore == nil {
+		config.NonceStore = NewMemoryNonceStore()
+	}
+	if config.RevocationStore == nil {
+		config.RevocationStore = NewMemoryRevocationStore()
+	}
+	if config.EmailVerificationExpiry <= 0 {
+		config.EmailVerificationExpiry = defaultEmailVerificationExpiry
+	}
+	if config.PasswordResetExpiry <= 0 {
+		config.PasswordResetExpiry = defaultPasswordResetExpiry
+	}
+	if config.ServiceAccountRole == "" {
+		config.ServiceAccountRole = defaultServiceAccountRole
+	}
+	if config.LoginLinkExpiry <= 0 {
+		config.LoginLinkExpiry = defaultLoginLinkExpiry
+	}
+	if config.MFATokenExpiry <= 0 {
+		config.MFATokenExpiry = defaultMFATokenExpiry
+	}
+	if config.MaxLoginAttempts == 0 {
+		config.MaxLoginAttempts = defaultMaxLoginAttempts
+	}
+	if config.LockoutWindow <= 0 {
+		config.LockoutWindow = defaultLockoutWindow
+	}
+	if config.LockoutDuration <= 0 {
+		config.LockoutDuration = defaultLockoutDuration
+	}
+	if config.LockoutStore == nil {
+		config.LockoutStore = NewMemoryLockoutStore()
+	}
+	if config.LoginHistorySize == 0 {
+		config.LoginHistorySize = defaultLoginHistorySize
+	}
+	if config.LoginHistoryStore == nil {
+		config.LoginHistoryStore = NewMemoryLoginHistoryStore()
+	}
+	if config.Messages == nil {
+		config.Messages = NewMessageCatalog()
+	}
+	if config.ErrorResponder == nil {
+		config.ErrorResponder = DefaultErrorResponder
+	}
+	if config.Logger == nil {
+		config.Logger = slog.New(discardHandler{})
+	}
+	if config.Metrics == nil {
+		config.Metrics = nopMetrics{}
+	}
+	if config.Tracer == nil {
+		config.Tracer = nopTracer{}
+	}
+	usesSecret := config.SigningMethod == "" || config.SigningMethod == SigningMethodHS256
+	if config.SecretProvider == nil && usesSecret && config.JWKSURL == "" {
+		config.SecretProvider = StaticSecrets(config.JWTSecret, config.PreviousJWTSecrets...)
+	}
+	if config.DefaultLocale == "" {
+		config.DefaultLocale = DefaultLocale
+	}
+	config.DefaultLocale = normalizeLocale(config.DefaultLocale)
+	if config.JWKSURL != "" {
+		// The defaults below describe AuthKit's own tokens, never a provider's
+		if config.Issuer == "" || len(config.Audience) == 0 {
+			return nil, fmt.Errorf("%w: JWKSURL requires Issuer and Audience", ErrInvalidConfig)
+		}
+		if config.JWKSCacheTTL <= 0 {
+			config.JWKSCacheTTL = defaultJWKSCacheTTL
+		}
+		if config.HTTPClient == nil {
+			config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+		}
+	}
+	if config.RoleClaim == "" {
+		config.RoleClaim = "role"
+	}
+	if config.PermissionsClaim == "" {
+		config.PermissionsClaim = "permissions"
+	}
+	if config.Issuer == "" {
+		config.Issuer = defaultIssuer
+	}
+	if config.BearerRealm == "" {
+		config.BearerRealm = config.Issuer
+	}
+	if len(config.Audience) == 0 {
+		config.Audience = []string{defaultAudience}
+	}
+	config.Audience = append([]string{}, config.Audience...)
+	if config.MaxTokenSize <= 0 {
+		config.MaxTokenSize = defaultMaxTokenSize
+	}
+	config.TokenMetadataFields = append([]string{}, config.TokenMetadataFields...)
+	config.GRPCPublicMethods = append([]string{}, config.GRPCPublicMethods...)
+	config.RoleHierarchy = copyRoleHierarchy(config.RoleHierarchy)
+	if config.Webhooks != nil {
+		config.Webhooks = config.Webhooks.withDefaults()
+	}
+	if config.CookieConfig != nil {
+		config.CookieConfig = config.CookieConfig.withDefaults()
+	}
+	if config.SlidingSession != nil {
+		config.SlidingSession = config.SlidingSession.withDefaults(lifetimes.withDefaults(config).refresh)
+	}
+	if config.OIDC != nil {
+		config.OIDC = config.OIDC.withDefaults(config.Issuer)
+	}
+	if config.TokenExchange != nil {
+		config.TokenExchange = config.TokenExchange.withDefaults(config.HTTPClient)
+	}
+	if config.BruteForce != nil {
+		config.BruteForce = config.BruteForce.withDefaults()
+	}
+	if config.SeedStrategy == "" {
+		config.SeedStrategy = SeedSkipExisting
+	}
+
+	if err := config.validate(lifetimes); err != nil {
+		return nil, err
+	}
+	lifetimes = lifetimes.withDefaults(config)
+	customSubject := config.SubjectMapper != nil
+	if config.SubjectMapper == nil {
+		config.SubjectMapper = SubjectByID
+	}
+	if config.SubjectResolver == nil {
+		config.SubjectResolver = ResolveSubjectByID
+	}
+
+	emailTemplates, err := parseEmailTemplates(config.EmailTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := newKeyring(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.JWKSURL != "" {
+		// Tokens come from the provider; nothing is signed locally
+		keys = &keyring{method: keys.method}
+	}
+
+	auth := &AuthKit{
+		config:          config,
+		serviceAccounts: make(map[string]*ServiceAccount),
+		sessions:        make(map[string]*sessionRecord),
+		roles:           make(map[string][]string),
+		policies:        make(map[string]Policy),
+		mutex:           sync.RWMutex{},
+		customSubject:   customSubject,
+		accessExpiry:    lifetimes.access,
+		refreshExpiry:   lifetimes.refresh,
+		rememberMe:      parseExpiry(config.RememberMeExpiry, 30*24*time.Hour),
+		done:            make(chan struct{}),
+		keys:            keys,
+
+		emailTemplates: emailTemplates,
+	}
+	auth.maxAccess = parseExpiry(config.MaxTokenExpiry, auth.accessExpiry)
+	auth.maxRefresh = parseExpiry(config.MaxRefreshExpiry, max(auth.refreshExpiry, auth.rememberMe))
+	auth.users = newUserStore(auth.emailKey)
+	auth.hashLimiter = newHashLimiter(config.MaxConcurrentHashes, config.MaxHashQueue)
+	auth.tokenCache = newTokenCache(config.TokenCacheSize, config.TokenCacheTTL)
+	if config.ValidateUserOnRequest || config.CheckUserOnRequest {
+		auth.userStatuses = newUserStatusCache(config.UserStatusCacheSize, config.UserStatusCacheTTL)
+		auth.users.changed = auth.userStatuses.evict
+	}
+	auth.limiter = newRateLimiter(config.RateLimitRPM, config.JanitorInterval, auth.now)
+
+	if config.JWKSURL != "" {
+		auth.remoteKeys = &remoteKeySet{
+			url:    config.JWKSURL,
+			ttl:    config.JWKSCacheTTL,
+			client: config.HTTPClient,
+			now:    auth.now,
+		}
+	}
+	if config.TokenExchange != nil {
+		auth.exchange = newTokenExchange(config.TokenExchange, config.JWKSCacheTTL, auth.now)
+	}
+	if config.BruteForce != nil {
+		auth.bruteForce = newBruteForce(auth, config.BruteForce)
+	}
 
-	return &AuthKit{
-		config: config,
-		users:  make(map[string]*User),
-		mutex:  sync.RWMutex{},
+	if config.DebugChecks {
+		auth.fingerprint = configFingerprint(config)
 	}
+
+	if config.SeedFile != "" {
+		if err := auth.LoadSeedFile(config.SeedFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DeletionGracePeriod > 0 {
+		auth.startJanitor(func() { auth.PurgeExpiredAccounts() })
+	}
+	if config.Webhooks != nil && len(config.Webhooks.Endpoints) > 0 {
+		auth.startWebhooks()
+	}
+
+	return auth, nil
+}
+
+// parseExpiry parses a validated token lifetime, falling back to fallback
+func parseExpiry(value string, fallback time.Duration) time.Duration {
+	duration, err := ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
 }
 
-// RegisterUser registers a new user
+// withDefaults fills in the lifetimes left zero from Config.TokenExpiry and
+// Config.RefreshExpiry
+func (l tokenLifetimes) withDefaults(c Config) tokenLifetimes {
+	if l.access <= 0 {
+		l.access = parseExpiry(c.TokenExpiry, 24*time.Hour)
+	}
+	if l.refresh <= 0 {
+		l.refresh = parseExpiry(c.RefreshExpiry, 7*24*time.Hour)
+	}
+	return l
+}
+
+// Validate checks the configuration for values that cannot be used
+func (c Config) Validate() error {
+	return c.validate(tokenLifetimes{})
+}
+
+// validate is Validate with the lifetimes set by WithTokenExpiry and
+// WithRefreshExpiry, if any
+func (c Config) validate(lifetimes tokenLifetimes) error {
+	if c.TokenExpiry != "" {
+		if d, err := ParseDuration(c.TokenExpiry); err != nil || d <= 0 {
+			return fmt.Errorf("%w: invalid TokenExpiry %q", ErrInvalidConfig, c.TokenExpiry)
+		}
+	}
+	if c.RefreshExpiry != "" {
+		if d, err := ParseDuration(c.RefreshExpiry); err != nil || d <= 0 {
+			return fmt.Errorf("%w: invalid RefreshExpiry %q", ErrInvalidConfig, c.RefreshExpiry)
+		}
+	}
+	for name, value := range map[string]string{"RememberMeExpiry": c.RememberMeExpiry, "MaxTokenExpiry": c.MaxTokenExpiry, "MaxRefreshExpiry": c.MaxRefreshExpiry} {
+		if value == "" {
+			continue
+		}
+		if d, err := ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("%w: invalid %s %q", ErrInvalidConfig, name, value)
+		}
+	}
+	lifetimes = lifetimes.withDefaults(c)
+	if c.MaxTokenExpiry != "" && parseExpiry(c.MaxTokenExpiry, 0) < lifetimes.access {
+		return fmt.Errorf("%w: MaxTokenExpiry is shorter than TokenExpiry", ErrInvalidConfig)
+	}
+	if c.MaxRefreshExpiry != "" && parseExpiry(c.MaxRefreshExpiry, 0) < lifetimes.refresh {
+		return fmt.Errorf("%w: MaxRefreshExpiry is shorter than RefreshExpiry", ErrInvalidConfig)
+	}
+	if c.MaxConcurrentHashes < 0 || c.MaxHashQueue < 0 {
+		return fmt.Errorf("%w: negative MaxConcurrentHashes or MaxHashQueue", ErrInvalidConfig)
+	}
+	if c.TokenCacheSize < 0 {
+		return fmt.Errorf("%w: negative TokenCacheSize", ErrInvalidConfig)
+	}
+	if c.UserStatusCacheSize < 0 {
+		return fmt.Errorf("%w: negative UserStatusCacheSize", ErrInvalidConfig)
+	}
+	if c.JWKSURL != "" {
+		if err := validateJWKSURL(c.JWKSURL); err != nil {
+			return err
+		}
+	}
+	for i, audience := range c.Audience {
+		if audience == "" {
+			return fmt.Errorf("%w: Audience[%d] is empty", ErrInvalidConfig, i)
+		}
+	}
+	if strings.ContainsAny(c.BearerRealm, `"\`) {
+		return fmt.Errorf("%w: BearerRealm %q contains a quote or backslash", ErrInvalidConfig, c.BearerRealm)
+	}
+	if len(c.PreviousJWTSecrets) > maxPreviousJWTSecrets {
+		return fmt.Errorf("%w: at most %d PreviousJWTSecrets are allowed", ErrInvalidConfig, maxPreviousJWTSecrets)
+	}
+	for i, secret := range c.PreviousJWTSecrets {
+		if secret == "" {
+			return fmt.Errorf("%w: PreviousJWTSecrets[%d] is empty", ErrInvalidConfig, i)
+		}
+	}
+	if c.JWTSecret != "" && (c.SigningMethod != "" && c.SigningMethod != SigningMethodHS256 || c.PrivateKeyPEM != "" || c.PublicKeyPEM != "") {
+		return fmt.Errorf("%w: JWTSecret can't be combined with an asymmetric SigningMethod or key", ErrInvalidConfig)
+	}
+	if len(c.PreviousJWTSecrets) > 0 && c.SigningMethod != "" && c.SigningMethod != SigningMethodHS256 {
+		return fmt.Errorf("%w: PreviousJWTSecrets require HS256; use VerificationKeysPEM instead", ErrInvalidConfig)
+	}
+	if len(c.PreviousPasswordPeppers) > maxPreviousPasswordPeppers {
+		return fmt.Errorf("%w: at most %d PreviousPasswordPeppers are allowed", ErrInvalidConfig, maxPreviousPasswordPeppers)
+	}
+	if c.SecretProvider != nil && c.SigningMethod != "" && c.SigningMethod != SigningMethodHS256 {
+		return fmt.Errorf("%w: SecretProvider requires HS256", ErrInvalidConfig)
+	}
+	switch c.PasswordHasher {
+	case "", PasswordHasherBcrypt:
+		if c.PasswordPepper == "" && c.PasswordPolicy.MaxLength > bcryptMaxPasswordLength {
+			return fmt.Errorf("%w: PasswordPolicy.MaxLength cannot exceed bcrypt's %d bytes without a PasswordPepper", ErrInvalidConfig, bcryptMaxPasswordLength)
+		}
+		fallthrough
+	case PasswordHasherArgon2id:
+		if c.PasswordPolicy.MaxLength > prehashedMaxPasswordLength {
+			return fmt.Errorf("%w: PasswordPolicy.MaxLength cannot exceed %d bytes", ErrInvalidConfig, prehashedMaxPasswordLength)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported PasswordHasher %q", ErrInvalidConfig, c.PasswordHasher)
+	}
+	if c.PasswordPolicy.MaxLength > 0 && c.PasswordPolicy.MinLength > c.PasswordPolicy.MaxLength {
+		return fmt.Errorf("%w: PasswordPolicy.MinLength exceeds MaxLength", ErrInvalidConfig)
+	}
+	if c.SeedStrategy != "" && c.SeedStrategy != SeedSkipExisting && c.SeedStrategy != SeedUpdateExisting {
+		return fmt.Errorf("%w: invalid SeedStrategy %q", ErrInvalidConfig, c.SeedStrategy)
+	}
+	if c.CookieConfig != nil && c.CookieConfig.SameSite == http.SameSiteNoneMode && c.CookieConfig.Insecure {
+		return fmt.Errorf("%w: SameSite=None cookies must be Secure", ErrInvalidConfig)
+	}
+	if err := validateRoleHierarchy(c.RoleHierarchy); err != nil {
+		return err
+	}
+	if c.PolicySubject != "" && c.PolicySubject != PolicySubjectUserID && c.PolicySubject != PolicySubjectRole {
+		return fmt.Errorf("%w: invalid PolicySubject %q", ErrInvalidConfig, c.PolicySubject)
+	}
+	if c.Webhooks != nil {
+		if err := c.Webhooks.validate(); err != nil {
+			return err
+		}
+	}
+	if c.RefreshAbsoluteLifetime < 0 || c.RefreshIdleTimeout < 0 {
+		return fmt.Errorf("%w: negative RefreshAbsoluteLifetime or RefreshIdleTimeout", ErrInvalidConfig)
+	}
+	if c.SlidingSession != nil {
+		if err := c.SlidingSession.validate(); err != nil {
+			return err
+		}
+	}
+	if c.OIDC != nil {
+		if err := c.OIDC.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.TokenExchange != nil {
+		if err := c.TokenExchange.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.BruteForce != nil {
+		if err := c.BruteForce.validate(); err != nil {
+			return err
+		}
+	}
+	if r := c.TenantResolver; r != nil && r.Header == "" && r.PathParam == "" && r.FromHost == nil {
+		return fmt.Errorf("%w: TenantResolver needs a Header, PathParam or FromHost", ErrInvalidConfig)
+	}
+	if c.SubjectMapper != nil && c.SubjectResolver == nil {
+		return fmt.Errorf("%w: SubjectMapper requires a matching SubjectResolver", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// RegisterUser registers a new user through self-service sign-up. The role
+// must be one of Config.AllowedSelfRegisterRoles, and metadata keys embedded
+// in tokens (Config.TokenMetadataFields) are dropped, so a client can't grant
+// itself privileges; use AdminCreateUser for trusted callers.
 func (a *AuthKit) RegisterUser(req RegisterRequest) (*UserInfo, error) {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+	return a.RegisterUserCtx(context.Background(), req)
+}
 
-	// Check if user already exists
-	for _, user := range a.users {
-		if user.Email == req.Email {
-			return nil, ErrUserAlreadyExists
+// RegisterUserCtx is RegisterUser with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) RegisterUserCtx(ctx context.Context, req RegisterRequest) (_ *UserInfo, err error) {
+	a.debugCheck()
+	defer func() { err = opError("register", err) }()
+
+	req, err = a.selfRegisterRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return a.createUser(ctx, "RegisterUser", req)
+}
+
+// AdminCreateUser registers a user with the requested role and metadata,
+// without the restrictions of RegisterUser. It is meant for trusted callers
+// such as admin endpoints and the CLI, never for requests a user controls.
+func (a *AuthKit) AdminCreateUser(req RegisterRequest) (*UserInfo, error) {
+	return a.AdminCreateUserCtx(context.Background(), req)
+}
+
+// AdminCreateUserCtx is AdminCreateUser with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) AdminCreateUserCtx(ctx context.Context, req RegisterRequest) (*UserInfo, error) {
+	a.debugCheck()
+
+	info, err := a.createUser(ctx, "AdminCreateUser", req)
+	return info, opError("create user", err)
+}
+
+// createUser registers the user described by req in a span named name
+func (a *AuthKit) createUser(ctx context.Context, name string, req RegisterRequest) (info *UserInfo, err error) {
+	_, span := a.startSpan(ctx, name)
+	defer func() { endSpan(span, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, err := a.newUser(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute(TraceAttrUserID, a.traceUserID(user.ID))
+	actorID := auditActor(ctx)
+	if actorID == "" {
+		actorID = user.ID
+	}
+	return a.registerUser(user, actorID)
+}
+
+// selfRegisterRequest restricts a self-service registration: a role outside
+// Config.AllowedSelfRegisterRoles fails with ErrRoleNotAllowed, or becomes the
+// default role with Config.DowngradeSelfRegisterRoles, and metadata keys
+// embedded in tokens are dropped
+func (a *AuthKit) selfRegisterRequest(req RegisterRequest) (RegisterRequest, error) {
+	if req.Role != "" && !slices.Contains(a.config.AllowedSelfRegisterRoles, req.Role) {
+		if !a.config.DowngradeSelfRegisterRoles {
+			return req, ErrRoleNotAllowed
 		}
+		a.config.Logger.Info("self-registered role downgraded", "role", req.Role)
+		req.Role = ""
 	}
 
-	// Hash password
-	hashedPassword, err := a.HashPassword(req.Password)
+	if len(req.Metadata) > 0 {
+		metadata := copyMetadata(req.Metadata)
+		for key := range a.tokenMetadata(metadata) {
+			delete(metadata, key)
+		}
+		req.Metadata = metadata
+	}
+	req.MustChangePassword = false
+	return req, nil
+}
+
+// newUser validates a registration and builds the user, hashing the password
+// before any lock is taken so concurrent operations aren't blocked on bcrypt
+func (a *AuthKit) newUser(ctx context.Context, req RegisterRequest) (*User, error) {
+	email, err := a.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkNewPassword(ctx, req.Password, email); err != nil {
+		return nil, err
+	}
+
+	// Don't spend a bcrypt hash on a request that was given up on
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := a.hashPasswordCtx(ctx, req.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create user
-	userID := uuid.New().String()
+	now := a.now()
 	user := &User{
-		ID:            userID,
-		Email:         req.Email,
-		Password:      hashedPassword,
-		Name:          req.Name,
-		Role:          req.Role,
-		Permissions:   []string{},
-		EmailVerified: !a.config.EmailRequired,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
-		Metadata:      req.Metadata,
+		ID:                 uuid.New().String(),
+		TenantID:           req.TenantID,
+		Email:              email,
+		Password:           hashedPassword,
+		Name:               req.Name,
+		Role:               req.Role,
+		Permissions:        []string{},
+		EmailVerified:      !a.config.EmailRequired,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		Metadata:           copyMetadata(req.Metadata),
+		MustChangePassword: req.MustChangePassword,
 	}
 
 	// Set default role if not provided
 	if user.Role == "" {
-		user.Role = "user"
+		user.Role = defaultRole
 	}
+	return user, nil
+}
+
+// registerUser stores a user built by newUser, then audits the registration
+// by actorID and runs the OnRegister hook
+func (a *AuthKit) registerUser(user *User, actorID string) (*UserInfo, error) {
+	// Snapshot before storing, afterwards the user may be updated concurrently
+	info := a.userToUserInfo(user)
 
-	// Store user
-	a.users[userID] = user
+	if err := a.insertUser(user); err != nil {
+		a.config.Logger.Info("registration rejected", "reason", ErrorCode(err), "email", user.Email)
+		return nil, err
+	}
+	a.config.Logger.Info("user registered", "user_id", user.ID)
+	a.config.Metrics.Registration()
 
-	return a.userToUserInfo(user), nil
+	a.audit(AuditEvent{Type: AuditUserRegistered, ActorID: actorID, UserID: user.ID,
+		Metadata: map[string]string{"email": user.Email}})
+	if hook := a.config.Hooks.OnRegister; hook != nil {
+		hookInfo := cloneUserInfo(info)
+		a.runHook("OnRegister", func() error { return hook(hookInfo) })
+	}
+	return info, nil
 }
 
-// LoginUser authenticates a user and returns tokens
-func (a *AuthKit) LoginUser(email, password string) (*TokenResponse, error) {
-	a.mutex.RLock()
-	defer a.mutex.RUnlock()
+// insertUser stores a new user, failing if the email is already registered
+func (a *AuthKit) insertUser(user *User) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 
-	// Find user by email
-	var user *User
-	for _, u := range a.users {
-		if u.Email == email {
-			user = u
-			break
-		}
+	// Check if user already exists
+	if a.emailTaken(user.TenantID, user.Email, "") {
+		return ErrUserAlreadyExists
 	}
 
-	if user == nil {
-		return nil, ErrUserNotFound
+	a.users.put(user)
+	return nil
+}
+
+// LoginUser authenticates a user and returns tokens. For users with TOTP
+// enabled it returns an MFA token instead, see CompleteMFALogin. The optional
+// LoginContext describes the client in the user's login history.
+func (a *AuthKit) LoginUser(email, password string, lc ...LoginContext) (*TokenResponse, error) {
+	return a.LoginUserCtx(context.Background(), email, password, lc...)
+}
+
+// LoginUserCtx is LoginUser with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) LoginUserCtx(ctx context.Context, email, password string, lc ...LoginContext) (*TokenResponse, error) {
+	return a.LoginUserInTenantCtx(ctx, "", email, password, lc...)
+}
+
+// LoginUserInTenant is LoginUser for the user with the email in the tenant.
+// The same email may be registered in several tenants with different
+// passwords; the issued tokens carry the tenant in Claims.TenantID.
+func (a *AuthKit) LoginUserInTenant(tenantID, email, password string, lc ...LoginContext) (*TokenResponse, error) {
+	return a.LoginUserInTenantCtx(context.Background(), tenantID, email, password, lc...)
+}
+
+// LoginUserInTenantCtx is LoginUserInTenant with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) LoginUserInTenantCtx(ctx context.Context, tenantID, email, password string, lc ...LoginContext) (*TokenResponse, error) {
+	opts := LoginOptions{TenantID: tenantID}
+	if len(lc) > 0 {
+		opts.Context = lc[0]
 	}
+	return a.LoginUserWithOptionsCtx(ctx, email, password, opts)
+}
+
+// LoginUserWithOptions is LoginUser with the token lifetimes and tenant
+// chosen by opts. ExpiresIn and RefreshExpiresIn of the response are the
+// lifetimes used, which refreshes of the session keep.
+func (a *AuthKit) LoginUserWithOptions(email, password string, opts LoginOptions) (*TokenResponse, error) {
+	return a.LoginUserWithOptionsCtx(context.Background(), email, password, opts)
+}
+
+// LoginUserWithOptionsCtx is LoginUserWithOptions with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) LoginUserWithOptionsCtx(ctx context.Context, email, password string, opts LoginOptions) (tokens *TokenResponse, err error) {
+	a.debugCheck()
 
-	// Check password
-	if !a.ComparePassword(user.Password, password) {
-		return nil, ErrInvalidPassword
+	ctx, span := a.startSpan(ctx, "LoginUser")
+	defer func() {
+		err = opError("login", err)
+		endSpan(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// Generate tokens
-	accessToken, err := a.GenerateAccessToken(user)
+	// Find user by email
+	lc := []LoginContext{opts.Context}
+	user, err := a.GetUserByEmailInTenant(opts.TenantID, email)
 	if err != nil {
+		if err := a.compareDummyPassword(ctx, password); err != nil {
+			return nil, a.loginShed(err)
+		}
+		a.logLogin("", email, loginIP(lc), ErrInvalidCredentials)
+		a.config.Metrics.LoginAttempt(CodeInvalidCredentials)
+		a.audit(AuditEvent{Type: AuditLoginFailed, IP: loginIP(lc),
+			Metadata: map[string]string{"email": email, "reason": CodeInvalidCredentials}})
+		a.loginFailed(email, ErrInvalidCredentials)
+		return nil, ErrInvalidCredentials
+	}
+
+	span.SetAttribute(TraceAttrUserID, a.traceUserID(user.ID))
+
+	// The attempt isn't counted if the request was given up on before the password check
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	tokens, err = a.loginUser(ctx, user, password, a.loginLifetimes(opts), opts.Scope, opts.Nonce)
+	// Nor if it was shed or given up on while waiting for a hashing slot
+	var slotErr *slotError
+	if errors.As(err, &slotErr) {
+		return nil, a.loginShed(err)
+	}
+	a.recordLogin(ctx, user, lc, tokens, err)
+	return tokens, err
+}
+
+// loginShed counts a login rejected with ErrServerBusy and returns err
+func (a *AuthKit) loginShed(err error) error {
+	if errors.Is(err, ErrServerBusy) {
+		a.config.Metrics.LoginAttempt(CodeServerBusy)
+	}
+	return err
+}
+
+// checkLoginPassword checks the password of a user found by email, counting
+// the attempt towards the account lockout. It returns ErrInvalidCredentials
+// for a wrong password and ErrAccountLocked while the user is locked, even
+// for the correct one.
+func (a *AuthKit) checkLoginPassword(ctx context.Context, user *User, password string) error {
+	// Take a hashing slot before counting the attempt, so requests turned
+	// away while hashing is saturated don't count towards a lockout
+	var ok, currentPepper bool
+	err := a.withHashSlot(ctx, func() error {
+		// Count the attempt before checking the password, so a locked
+		// account rejects even the correct one
+		if a.lockoutEnabled() {
+			err := a.traceStore(ctx, "LockoutStore.RecordAttempt", func() error {
+				_, err := a.recordAttempt(user.ID, a.now(), a.lockoutPolicy())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
 
-	refreshToken, err := a.GenerateRefreshToken(user)
+		// Check password
+		ok, currentPepper = a.matchPassword(user.Password, password)
+		return nil
+	})
 	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	a.rehashPassword(ctx, user, password, currentPepper)
+
+	// For MFA users the counter keeps running until the second factor
+	// succeeds, so logging in again can't reset it between guesses at the code
+	if a.lockoutEnabled() && !user.TOTPEnabled {
+		return a.traceStore(ctx, "LockoutStore.Reset", func() error {
+			return a.config.LockoutStore.Reset(user.ID)
+		})
+	}
+	return nil
+}
+
+// loginUser checks the password of a user found by LoginUser, issuing tokens
+// with the given lifetimes, scope and ID token nonce
+func (a *AuthKit) loginUser(ctx context.Context, user *User, password string, lifetimes tokenLifetimes, scope []string, nonce string) (*TokenResponse, error) {
+	if err := a.checkLoginPassword(ctx, user, password); err != nil {
 		return nil, err
 	}
 
-	// Parse expiry duration
-	duration, _ := time.ParseDuration(a.config.TokenExpiry)
-	expiresIn := int64(duration.Seconds())
+	if user.PurgeAt != nil {
+		return nil, ErrAccountPendingDeletion
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if a.config.EmailRequired && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	if user.TOTPEnabled {
+		return a.mfaToken(user, passwordAMR, lifetimes, scope, nonce)
+	}
 
-	return &TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		User:         a.userToUserInfo(user),
-	}, nil
+	tokens, err := a.tokenPair(user, nil, lifetimes, scope, nonce)
+	if err != nil {
+		return nil, err
+	}
+	a.sendNewLoginAlert(tokens.User)
+	return tokens, nil
 }
 
-// GetUserByID retrieves a user by their ID
+// GetUserByID retrieves a copy of the user with the given ID
 func (a *AuthKit) GetUserByID(userID string) (*User, error) {
-	a.mutex.RLock()
-	defer a.mutex.RUnlock()
+	return a.GetUserByIDCtx(context.Background(), userID)
+}
 
-	user, exists := a.users[userID]
+// GetUserByIDCtx is GetUserByID with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) GetUserByIDCtx(ctx context.Context, userID string) (*User, error) {
+	a.debugCheck()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, exists := a.users.get(userID)
 	if !exists {
 		return nil, ErrUserNotFound
 	}
 
-	return user, nil
+	return cloneUser(user), nil
 }
 
-// GetUserByEmail retrieves a user by their email
+// GetUserByEmail retrieves a copy of the user with the given email in the
+// default tenant, see GetUserByEmailInTenant
 func (a *AuthKit) GetUserByEmail(email string) (*User, error) {
-	a.mutex.RLock()
-	defer a.mutex.RUnlock()
+	return a.GetUserByEmailInTenantCtx(context.Background(), "", email)
+}
 
-	for _, user := range a.users {
-		if user.Email == email {
-			return user, nil
-		}
+// GetUserByEmailCtx is GetUserByEmail with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) GetUserByEmailCtx(ctx context.Context, email string) (*User, error) {
+	return a.GetUserByEmailInTenantCtx(ctx, "", email)
+}
+
+// GetUserByEmailInTenant retrieves a copy of the user with the given email in
+// the tenant. The empty tenant ID is the default tenant of single-tenant
+// deployments.
+func (a *AuthKit) GetUserByEmailInTenant(tenantID, email string) (*User, error) {
+	return a.GetUserByEmailInTenantCtx(context.Background(), tenantID, email)
+}
+
+// GetUserByEmailInTenantCtx is GetUserByEmailInTenant with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) GetUserByEmailInTenantCtx(ctx context.Context, tenantID, email string) (*User, error) {
+	a.debugCheck()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if user := a.findUserByEmail(tenantID, email); user != nil {
+		return cloneUser(user), nil
 	}
 
 	return nil, ErrUserNotFound
 }
 
-// UpdateUser updates user information
+// UpdateUser updates user information. Setting "must_change_password" to true
+// revokes the user's tokens, see SetTemporaryPassword.
 func (a *AuthKit) UpdateUser(userID string, updates map[string]interface{}) (*UserInfo, error) {
+	return a.UpdateUserCtx(context.Background(), userID, updates)
+}
+
+// UpdateUserCtx is UpdateUser with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) UpdateUserCtx(ctx context.Context, userID string, updates map[string]interface{}) (_ *UserInfo, err error) {
+	a.debugCheck()
+	defer func() { err = opError("update user", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	info, previousRole, fields, err := a.updateUser(userID, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	actorID := auditActor(ctx)
+	a.userUpdated(actorID, info, fields)
+	a.auditRoleChange(actorID, userID, previousRole, info.Role)
+	return info, nil
+}
+
+// updateUser applies UpdateUser's updates, returning the user's previous role
+// and the fields that were set
+func (a *AuthKit) updateUser(userID string, updates map[string]interface{}) (*UserInfo, string, []string, error) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	user, exists := a.users[userID]
+	stored, exists := a.users.get(userID)
 	if !exists {
-		return nil, ErrUserNotFound
+		return nil, "", nil, ErrUserNotFound
 	}
+	user := cloneUser(stored)
+	previousRole := user.Role
 
 	// Update fields
+	var fields []string
 	if name, ok := updates["name"].(string); ok {
 		user.Name = name
+		fields = append(fields, "name")
 	}
 	if role, ok := updates["role"].(string); ok {
 		user.Role = role
+		fields = append(fields, "role")
 	}
 	if permissions, ok := updates["permissions"].([]string); ok {
-		user.Permissions = permissions
+		user.Permissions = append([]string{}, permissions...)
+		fields = append(fields, "permissions")
 	}
 	if metadata, ok := updates["metadata"].(map[string]interface{}); ok {
-		user.Metadata = metadata
+		user.Metadata = copyMetadata(metadata)
+		fields = append(fields, "metadata")
+	}
+	if mustChange, ok := updates["must_change_password"].(bool); ok {
+		if mustChange {
+			a.requirePasswordChange(user)
+		} else {
+			user.MustChangePassword = false
+		}
+		fields = append(fields, "must_change_password")
 	}
 
-	user.UpdatedAt = time.Now()
+	user.UpdatedAt = a.now()
+	a.users.put(user)
 
-	return a.userToUserInfo(user), nil
+	return a.userToUserInfo(user), previousRole, fields, nil
 }
 
-// DeleteUser removes a user from the system
+// DeleteUser removes a user from the system. With Config.SoftDelete it only
+// marks the user deleted, see RestoreUser and PurgeUser.
 func (a *AuthKit) DeleteUser(userID string) error {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+	return a.DeleteUserCtx(context.Background(), userID)
+}
+
+// DeleteUserCtx is DeleteUser with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) DeleteUserCtx(ctx context.Context, userID string) (err error) {
+	a.debugCheck()
+	defer func() { err = opError("delete user", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	if _, exists := a.users[userID]; !exists {
+	a.mutex.Lock()
+	user, exists := a.users.get(userID)
+	if !exists || user.DeletedAt != nil {
+		a.mutex.Unlock()
 		return ErrUserNotFound
 	}
+	a.removeUser(user)
+	a.mutex.Unlock()
 
-	delete(a.users, userID)
+	a.userDeleted(auditActor(ctx), userID)
 	return nil
 }
 
-// ListUsers returns all users (for admin purposes)
+// ListUsers returns a point-in-time snapshot of all users (for admin
+// purposes). Soft-deleted users are left out, see ListUsersByStatus.
 func (a *AuthKit) ListUsers() []*UserInfo {
+	a.debugCheck()
+
+	// Writers hold the lock, so no update is seen half-applied across users
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
 
-	users := make([]*UserInfo, 0, len(a.users))
-	for _, user := range a.users {
-		users = append(users, a.userToUserInfo(user))
+	stored := a.users.all()
+	users := make([]*UserInfo, 0, len(stored))
+	for _, user := range stored {
+		if user.DeletedAt == nil {
+			users = append(users, a.userToUserInfo(user))
+		}
 	}
 
 	return users
 }
 
-// userToUserInfo converts User to UserInfo (without password)
+// userToUserInfo converts User to UserInfo (without password).
+// Slices, maps and pointers are copied so the result doesn't alias stored state.
 func (a *AuthKit) userToUserInfo(user *User) *UserInfo {
-	return &UserInfo{
-		ID:            user.ID,
-		Email:         user.Email,
-		Name:          user.Name,
-		Role:          user.Role,
-		Permissions:   user.Permissions,
-		EmailVerified: user.EmailVerified,
-		Metadata:      user.Metadata,
+	info := &UserInfo{
+		ID:                 user.ID,
+		TenantID:           user.TenantID,
+		Email:              user.Email,
+		Name:               user.Name,
+		Role:               user.Role,
+		Permissions:        append([]string{}, user.Permissions...),
+		EmailVerified:      user.EmailVerified,
+		Metadata:           copyMetadata(user.Metadata),
+		PendingDeletion:    user.PurgeAt != nil,
+		MFAEnabled:         user.TOTPEnabled,
+		Disabled:           user.Disabled,
+		DisabledReason:     user.DisabledReason,
+		MustChangePassword: user.MustChangePassword,
+		Identities:         append([]LinkedIdentity(nil), user.Identities...),
+	}
+	if user.PurgeAt != nil {
+		purgeAt := *user.PurgeAt
+		info.PurgeAt = &purgeAt
+	}
+	if user.DisabledAt != nil {
+		disabledAt := *user.DisabledAt
+		info.DisabledAt = &disabledAt
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		info.DeletedAt = &deletedAt
+	}
+	if user.LastLoginAt != nil {
+		lastLoginAt := *user.LastLoginAt
+		info.LastLoginAt = &lastLoginAt
+	}
+	if lockedUntil := a.lockedUntil(user.ID); lockedUntil != nil {
+		info.Locked = true
+		info.LockedUntil = lockedUntil
+	}
+	return info
+}
+
+// cloneUser returns a copy of a stored user that callers can read without holding the lock
+func cloneUser(user *User) *User {
+	clone := *user
+	clone.Permissions = append([]string{}, user.Permissions...)
+	clone.RecoveryCodes = append([]string(nil), user.RecoveryCodes...)
+	clone.Identities = append([]LinkedIdentity(nil), user.Identities...)
+	clone.Metadata = copyMetadata(user.Metadata)
+	if user.PurgeAt != nil {
+		purgeAt := *user.PurgeAt
+		clone.PurgeAt = &purgeAt
+	}
+	if user.DisabledAt != nil {
+		disabledAt := *user.DisabledAt
+		clone.DisabledAt = &disabledAt
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	if user.LastLoginAt != nil {
+		lastLoginAt := *user.LastLoginAt
+		clone.LastLoginAt = &lastLoginAt
+	}
+	return &clone
+}
+
+// cloneUserInfo returns a copy of info that doesn't alias its slices, maps or pointers
+func cloneUserInfo(info *UserInfo) *UserInfo {
+	clone := *info
+	clone.Permissions = append([]string{}, info.Permissions...)
+	clone.Metadata = copyMetadata(info.Metadata)
+	clone.Identities = append([]LinkedIdentity(nil), info.Identities...)
+	for _, t := range []**time.Time{&clone.PurgeAt, &clone.LockedUntil, &clone.DisabledAt, &clone.DeletedAt, &clone.LastLoginAt} {
+		if *t != nil {
+			copied := **t
+			*t = &copied
+		}
+	}
+	return &clone
+}
+
+// copyMetadata makes a shallow copy of a metadata map
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		copied[k] = v
 	}
+	return copied
 }
@@ -1,8 +1,13 @@
 package authkit
 
 import (
+	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestAuthKit(t *testing.T) {
@@ -38,7 +43,7 @@ func TestAuthKit(t *testing.T) {
 
 		// Try to register the same user again (should fail)
 		_, err = auth.RegisterUser(req)
-		if err != ErrUserAlreadyExists {
+		if !errors.Is(err, ErrUserAlreadyExists) {
 			t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
 		}
 	})
@@ -75,14 +80,14 @@ func TestAuthKit(t *testing.T) {
 
 		// Test login with wrong password
 		_, err = auth.LoginUser(req.Email, "wrongpassword")
-		if err != ErrInvalidPassword {
-			t.Errorf("Expected ErrInvalidPassword, got %v", err)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Expected ErrInvalidCredentials, got %v", err)
 		}
 
 		// Test login with non-existent user
 		_, err = auth.LoginUser("nonexistent@example.com", "password")
-		if err != ErrUserNotFound {
-			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Expected ErrInvalidCredentials, got %v", err)
 		}
 	})
 
@@ -112,7 +117,7 @@ func TestAuthKit(t *testing.T) {
 
 		// Test invalid token
 		_, err = auth.ValidateToken("invalid-token")
-		if err != ErrInvalidToken {
+		if !errors.Is(err, ErrInvalidToken) {
 			t.Errorf("Expected ErrInvalidToken, got %v", err)
 		}
 	})
@@ -124,11 +129,13 @@ func TestAuthKit(t *testing.T) {
 			Password: "refreshpassword123",
 			Name:     "Refresh Test User",
 		}
+		now := time.Now()
+		auth.config.Clock = ClockFunc(func() time.Time { return now })
+		defer func() { auth.config.Clock = SystemClock }()
 		_, _ = auth.RegisterUser(req)
 		tokenResponse, _ := auth.LoginUser(req.Email, req.Password)
 
-		// Add a small delay to ensure different timestamps
-		time.Sleep(time.Millisecond * 10)
+		now = now.Add(time.Minute)
 
 		// Test valid refresh token
 		newTokens, err := auth.RefreshToken(tokenResponse.RefreshToken)
@@ -144,9 +151,21 @@ func TestAuthKit(t *testing.T) {
 			t.Error("Expected new access token to be different from original")
 		}
 
+		// The refreshed token is issued at the later time
+		claims, err := auth.ValidateToken(newTokens.AccessToken)
+		if err != nil || !claims.IssuedAt.Time.Equal(now.Truncate(time.Second)) {
+			t.Errorf("Expected the token issued at %v, got %+v %v", now, claims, err)
+		}
+
+		// Refresh tokens expire after RefreshExpiry
+		now = now.Add(25 * time.Hour)
+		if _, err := auth.RefreshToken(newTokens.RefreshToken); !errors.Is(err, ErrTokenExpired) {
+			t.Errorf("Expected ErrTokenExpired, got %v", err)
+		}
+
 		// Test invalid refresh token
 		_, err = auth.RefreshToken("invalid-refresh-token")
-		if err != ErrInvalidToken {
+		if !errors.Is(err, ErrInvalidToken) {
 			t.Errorf("Expected ErrInvalidToken, got %v", err)
 		}
 	})
@@ -235,7 +254,7 @@ func TestAuthKit(t *testing.T) {
 
 		// Verify user is deleted
 		_, err = auth.GetUserByID(user.ID)
-		if err != ErrUserNotFound {
+		if !errors.Is(err, ErrUserNotFound) {
 			t.Errorf("Expected ErrUserNotFound after deletion, got %v", err)
 		}
 	})
@@ -280,3 +299,303 @@ func TestStaticPasswordUtilities(t *testing.T) {
 		t.Error("Expected password comparison to be false for wrong password")
 	}
 }
+
+func TestValidateTokenExpired(t *testing.T) {
+	auth := New(Config{
+		JWTSecret:  "test-secret-key-for-testing-only",
+		BCryptCost: 4,
+	})
+
+	expired, err := auth.GenerateCustomToken("expired-user", nil, -time.Hour)
+	if err != nil {
+		t.Fatalf("Expected successful token generation, got error: %v", err)
+	}
+
+	_, err = auth.ValidateToken(expired)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+
+	// An expired token with a bad signature is still just invalid
+	other := New(Config{JWTSecret: "another-secret", BCryptCost: 4})
+	forged, _ := other.GenerateCustomToken("expired-user", nil, -time.Hour)
+	_, err = auth.ValidateToken(forged)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for forged expired token, got %v", err)
+	}
+
+	expiredRefresh, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Subject:   "expired-user",
+		Issuer:    auth.refreshIssuer(),
+		Audience:  []string{auth.refreshIssuer()},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+	}).SignedString([]byte("test-secret-key-for-testing-only"))
+	_, err = auth.RefreshToken(expiredRefresh)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired from RefreshToken, got %v", err)
+	}
+}
+
+func TestTokenCrossUse(t *testing.T) {
+	auth := New(Config{
+		JWTSecret:  "test-secret-key-for-testing-only",
+		BCryptCost: 4,
+	})
+
+	req := RegisterRequest{Email: "crossuse@example.com", Password: "crossusepassword123", Name: "Cross Use"}
+	_, _ = auth.RegisterUser(req)
+	tokenResponse, err := auth.LoginUser(req.Email, req.Password)
+	if err != nil {
+		t.Fatalf("Expected successful login, got error: %v", err)
+	}
+
+	// Access token presented as a refresh token
+	_, err = auth.RefreshToken(tokenResponse.AccessToken)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken refreshing with an access token, got %v", err)
+	}
+
+	// Refresh token presented as an access token
+	_, err = auth.ValidateToken(tokenResponse.RefreshToken)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken validating a refresh token, got %v", err)
+	}
+
+	// Custom tokens carry access token issuer/audience and still validate
+	custom, _ := auth.GenerateCustomToken("custom-user", nil, time.Hour)
+	if _, err := auth.ValidateToken(custom); err != nil {
+		t.Errorf("Expected custom token to validate, got %v", err)
+	}
+}
+
+func TestIssuerAndAudience(t *testing.T) {
+	secret := "shared-secret-between-services"
+	billing := New(Config{JWTSecret: secret, Issuer: "billing", Audience: []string{"billing-api", "gateway"}, BCryptCost: 4})
+	orders := New(Config{JWTSecret: secret, Issuer: "orders", BCryptCost: 4})
+
+	tokens := loginTestUser(t, billing, "issuer@example.com")
+	claims, err := billing.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected token to validate, got %v", err)
+	}
+	if claims.Issuer != "billing" || len(claims.Audience) != 2 || claims.Audience[0] != "billing-api" || claims.Audience[1] != "gateway" {
+		t.Errorf("Expected configured iss/aud, got %q %v", claims.Issuer, claims.Audience)
+	}
+
+	custom, _ := billing.GenerateCustomToken("custom-user", nil, time.Hour)
+	if _, err := billing.ValidateToken(custom); err != nil {
+		t.Errorf("Expected custom token to carry configured iss/aud, got %v", err)
+	}
+
+	// Same secret, different issuer: rejected both ways
+	if _, err := orders.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a cross-issuer access token, got %v", err)
+	}
+	if _, err := orders.ValidateToken(custom); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a cross-issuer custom token, got %v", err)
+	}
+	orders.users = billing.users
+	if _, err := orders.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a cross-issuer refresh token, got %v", err)
+	}
+
+	// Same issuer, but this service's audience is missing
+	gateway := New(Config{JWTSecret: secret, Issuer: "billing", Audience: []string{"reports"}})
+	if _, err := gateway.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a token without our audience, got %v", err)
+	}
+
+	if _, err := NewValidated(Config{JWTSecret: secret, Audience: []string{""}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an empty audience, got %v", err)
+	}
+}
+
+func TestParseCustomToken(t *testing.T) {
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+
+	type address struct {
+		City string `json:"city"`
+		Zip  int    `json:"zip"`
+	}
+	type inviteClaims struct {
+		UserID    string    `json:"user_id"`
+		TeamID    int64     `json:"team_id"`
+		Seats     []int     `json:"seats"`
+		Scopes    []string  `json:"scopes"`
+		Addresses []address `json:"addresses"`
+		jwt.RegisteredClaims
+	}
+
+	token, err := auth.GenerateCustomToken("invitee", map[string]interface{}{
+		"team_id":   int64(9007199254740993), // not representable as float64
+		"seats":     []int{1, 2, 3},
+		"scopes":    []string{"read", "write"},
+		"addresses": []address{{City: "Berlin", Zip: 10115}},
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected token generation, got %v", err)
+	}
+
+	claims, err := ParseCustomToken[inviteClaims](auth, token)
+	if err != nil {
+		t.Fatalf("Expected token to parse, got %v", err)
+	}
+	if claims.UserID != "invitee" || claims.TeamID != 9007199254740993 {
+		t.Errorf("Expected exact scalar claims, got %q %d", claims.UserID, claims.TeamID)
+	}
+	if len(claims.Seats) != 3 || claims.Seats[2] != 3 || len(claims.Scopes) != 2 {
+		t.Errorf("Expected typed slices, got %v %v", claims.Seats, claims.Scopes)
+	}
+	if len(claims.Addresses) != 1 || claims.Addresses[0] != (address{City: "Berlin", Zip: 10115}) {
+		t.Errorf("Expected nested structs, got %+v", claims.Addresses)
+	}
+	if claims.Issuer != defaultIssuer || claims.ExpiresAt == nil {
+		t.Errorf("Expected registered claims, got %+v", claims.RegisteredClaims)
+	}
+
+	expired, _ := auth.GenerateCustomToken("invitee", nil, -time.Hour)
+	if _, err := ParseCustomToken[inviteClaims](auth, expired); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+
+	other := New(Config{JWTSecret: "test-secret-key-for-testing-only", Issuer: "other"})
+	if _, err := ParseCustomToken[inviteClaims](other, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a foreign issuer, got %v", err)
+	}
+
+	_ = auth.RevokeToken(token)
+	if _, err := ParseCustomToken[inviteClaims](auth, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+func TestIssueTokensForUser(t *testing.T) {
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "sso@example.com", Password: "ssopassword123", Name: "SSO"})
+
+	tokens, err := auth.IssueTokensForUser(user.ID)
+	if err != nil {
+		t.Fatalf("Expected tokens, got %v", err)
+	}
+	if tokens.TokenType != "Bearer" || tokens.ExpiresIn != 24*60*60 || tokens.User.ID != user.ID {
+		t.Errorf("Expected a LoginUser-style response, got %+v", tokens)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected access token to validate, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Errorf("Expected refresh token to work, got %v", err)
+	}
+
+	// Revoking all of the user's tokens covers issued ones too
+	_ = auth.RevokeAllUserTokens(user.ID)
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken after RevokeAllUserTokens, got %v", err)
+	}
+
+	if _, err := auth.IssueTokensForUser("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestTokenMetadataFields(t *testing.T) {
+	metadata := map[string]interface{}{
+		"tenant":         "acme",
+		"internal_notes": "do-not-leak",
+		"billing_card":   "4242",
+	}
+	payload := func(t *testing.T, token string) string {
+		t.Helper()
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+		if err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		return string(decoded)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		fields   []string
+		included []string
+		excluded []string
+	}{
+		{"Default", nil, nil, []string{"tenant", "do-not-leak", "4242"}},
+		{"Whitelist", []string{"tenant", "missing"}, []string{"acme"}, []string{"do-not-leak", "4242", "missing"}},
+		{"All", []string{AllTokenMetadata}, []string{"acme", "do-not-leak", "4242"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4, TokenMetadataFields: tc.fields})
+			user := &User{ID: "meta-user", Email: "meta@example.com", Metadata: metadata}
+
+			token, err := auth.GenerateAccessToken(user)
+			if err != nil {
+				t.Fatalf("Expected token, got %v", err)
+			}
+			decoded := payload(t, token)
+			for _, s := range tc.included {
+				if !strings.Contains(decoded, s) {
+					t.Errorf("Expected payload to contain %q: %s", s, decoded)
+				}
+			}
+			for _, s := range tc.excluded {
+				if strings.Contains(decoded, s) {
+					t.Errorf("Expected payload not to contain %q: %s", s, decoded)
+				}
+			}
+
+			claims, _ := auth.ValidateToken(token)
+			if len(claims.Metadata) != len(tc.included) {
+				t.Errorf("Expected %d metadata claims, got %v", len(tc.included), claims.Metadata)
+			}
+		})
+	}
+}
+
+func TestMaxTokenSize(t *testing.T) {
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4, TokenMetadataFields: []string{AllTokenMetadata}, MaxTokenSize: 1024})
+	user := &User{ID: "big-user", Metadata: map[string]interface{}{"blob": strings.Repeat("x", 2048)}}
+
+	if _, err := auth.GenerateAccessToken(user); !errors.Is(err, ErrTokenTooLarge) {
+		t.Errorf("Expected ErrTokenTooLarge, got %v", err)
+	}
+	if _, err := auth.GenerateCustomToken("big-user", map[string]interface{}{"blob": strings.Repeat("x", 2048)}, time.Hour); !errors.Is(err, ErrTokenTooLarge) {
+		t.Errorf("Expected ErrTokenTooLarge for custom token, got %v", err)
+	}
+
+	user.Metadata = nil
+	if _, err := auth.GenerateAccessToken(user); err != nil {
+		t.Errorf("Expected small token to be issued, got %v", err)
+	}
+}
+
+// BenchmarkGenerateTokenPair measures the token issuing LoginUser and
+// RefreshToken do after the password or refresh token is checked
+func BenchmarkGenerateTokenPair(b *testing.B) {
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+	defer auth.Close()
+	info, _ := auth.AdminCreateUser(RegisterRequest{Email: "bench@example.com", Password: "password123", Name: "Bench"})
+	user, _ := auth.GetUserByID(info.ID)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.GenerateTokenPair(user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoginUser measures a full login at the lowest bcrypt cost
+func BenchmarkLoginUser(b *testing.B) {
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4, MaxLoginAttempts: -1, LoginHistorySize: -1})
+	defer auth.Close()
+	_, _ = auth.AdminCreateUser(RegisterRequest{Email: "bench@example.com", Password: "password123", Name: "Bench"})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := auth.LoginUser("bench@example.com", "password123"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
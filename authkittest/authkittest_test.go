@@ -0,0 +1,161 @@
+package authkittest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTokenForHTTP(t *testing.T) {
+	kit := NewTestKit(t)
+	handler := kit.HTTPMiddleware(kit.RequirePermissionHTTP("posts:write")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := authkit.GetUserFromContext(r.Context())
+			w.Write([]byte(claims.UserID))
+		})))
+
+	for name, test := range map[string]struct {
+		token  string
+		status int
+	}{
+		"permitted": {TokenFor(t, kit, "user-1", "editor", "posts:write"), http.StatusOK},
+		"forbidden": {TokenFor(t, kit, "user-1", "editor"), http.StatusForbidden},
+		"expired":   {ExpiredTokenFor(t, kit, "user-1", "editor", "posts:write"), http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, AuthorizedRequest(httptest.NewRequest(http.MethodGet, "/posts", nil), test.token))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d %s", name, test.status, w.Code, w.Body.String())
+		}
+	}
+
+	if _, err := kit.ValidateToken(ExpiredTokenFor(t, kit, "user-1", "editor")); !errors.Is(err, authkit.ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestTokenForGin(t *testing.T) {
+	kit := NewTestKit(t)
+	admin := MustRegister(t, kit, "admin@example.com", "admin")
+	r := gin.New()
+	r.GET("/admin", kit.GinMiddleware(), kit.RequireRole("admin"), func(c *gin.Context) {
+		claims, _ := authkit.GetUserFromGinContext(c)
+		c.String(http.StatusOK, claims.Email)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, AuthorizedRequest(httptest.NewRequest(http.MethodGet, "/admin", nil), TokenFor(t, kit, admin.ID, admin.Role)))
+	if w.Code != http.StatusOK || w.Body.String() != admin.Email {
+		t.Errorf("Expected the admin let in with their email, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, AuthorizedRequest(httptest.NewRequest(http.MethodGet, "/admin", nil), TokenFor(t, kit, admin.ID, "user")))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another role, got %d", w.Code)
+	}
+
+	// Registered users can also log in with Password
+	if _, err := kit.LoginUser(admin.Email, Password); err != nil {
+		t.Errorf("Expected a login with Password, got %v", err)
+	}
+}
+
+func TestTokenForFiber(t *testing.T) {
+	kit := NewTestKit(t)
+	user := MustRegister(t, kit, "user@example.com", "")
+	app := fiber.New()
+	app.Get("/profile", kit.FiberMiddleware(), func(c *fiber.Ctx) error {
+		claims, _ := authkit.GetUserFromFiberContext(c)
+		return c.SendString(claims.UserID)
+	})
+
+	for token, status := range map[string]int{
+		TokenFor(t, kit, user.ID, user.Role):        http.StatusOK,
+		ExpiredTokenFor(t, kit, user.ID, user.Role): http.StatusUnauthorized,
+		"not-a-token": http.StatusUnauthorized,
+	} {
+		resp, err := app.Test(AuthorizedRequest(httptest.NewRequest(http.MethodGet, "/profile", nil), token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected %d, got %d", status, resp.StatusCode)
+		}
+	}
+}
+
+func TestTokenForRevokedVersion(t *testing.T) {
+	kit := NewTestKit(t)
+	user := MustRegister(t, kit, "versioned@example.com", "user")
+	if err := kit.RevokeAllUserTokens(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens minted afterwards carry the new token version
+	if _, err := kit.ValidateToken(TokenFor(t, kit, user.ID, user.Role)); err != nil {
+		t.Errorf("Expected a token valid after revoking older ones, got %v", err)
+	}
+}
+
+func TestStoreFailures(t *testing.T) {
+	store := NewStore()
+	kit := NewTestKit(t, authkit.WithStore(store))
+	token := TokenFor(t, kit, "user-1", "user")
+
+	down := errors.New("store unavailable")
+	store.Fail("Revoke", down)
+	if err := kit.RevokeToken(token); !errors.Is(err, down) {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+	if _, err := kit.ValidateToken(token); err != nil {
+		t.Errorf("Expected the token still valid after the failed revocation, got %v", err)
+	}
+
+	store.Fail("Revoke", nil)
+	if err := kit.RevokeToken(token); err != nil {
+		t.Fatalf("Expected the store to recover, got %v", err)
+	}
+	if _, err := kit.ValidateToken(token); !errors.Is(err, authkit.ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+}
+
+func TestNewTestKitOptions(t *testing.T) {
+	kit := NewTestKit(t, authkit.WithPasswordPolicy(authkit.PasswordPolicy{MinLength: 20}))
+	_, err := kit.AdminCreateUser(authkit.RegisterRequest{Email: "short@example.com", Password: Password, Name: "Short"})
+	if !errors.Is(err, authkit.ErrWeakPassword) {
+		t.Errorf("Expected the option's password policy to apply, got %v", err)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	kit := NewTestKit(t, authkit.WithClock(clock))
+	MustRegister(t, kit, "clock@example.com", "user")
+	tokens, err := kit.LoginUser("clock@example.com", Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(24*time.Hour - time.Second)
+	if _, err := kit.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the token valid until it expires, got %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := kit.ValidateToken(tokens.AccessToken); !errors.Is(err, authkit.ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired once the clock passed the expiry, got %v", err)
+	}
+
+	// Tokens minted by TokenFor follow the kit's clock
+	if _, err := kit.ValidateToken(TokenFor(t, kit, "user-1", "user")); err != nil {
+		t.Errorf("Expected a token minted at the fake time, got %v", err)
+	}
+}
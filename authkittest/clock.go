@@ -0,0 +1,47 @@
+package authkittest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is an authkit.Clock that only moves when told to, for testing
+// expiry without sleeping. Pass it to NewTestKit with authkit.WithClock.
+//
+//	clock := authkittest.NewFakeClock(time.Time{})
+//	kit := authkittest.NewTestKit(t, authkit.WithClock(clock))
+//	clock.Advance(25 * time.Hour) // Tokens issued so far have expired
+type FakeClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+// NewFakeClock creates a FakeClock set to start, or to the current time if
+// start is zero
+func NewFakeClock(start time.Time) *FakeClock {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return &FakeClock{now: start}
+}
+
+// Now implements authkit.Clock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = t
+}
@@ -0,0 +1,139 @@
+package authkittest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+)
+
+// Store is an in-memory NonceStore, RevocationStore, LockoutStore and
+// LoginHistoryStore whose methods can be made to fail, for testing failure
+// paths. Pass it to NewTestKit with authkit.WithStore.
+//
+//	store := authkittest.NewStore()
+//	kit := authkittest.NewTestKit(t, authkit.WithStore(store))
+//	store.Fail("Revoke", errors.New("redis: connection refused"))
+type Store struct {
+	nonces      *authkit.MemoryNonceStore
+	revocations *authkit.MemoryRevocationStore
+	lockouts    *authkit.MemoryLockoutStore
+	history     *authkit.MemoryLoginHistoryStore
+
+	failures map[string]error
+	mutex    sync.Mutex
+}
+
+// NewStore creates a Store that doesn't fail until told to
+func NewStore() *Store {
+	return &Store{
+		nonces:      authkit.NewMemoryNonceStore(),
+		revocations: authkit.NewMemoryRevocationStore(),
+		lockouts:    authkit.NewMemoryLockoutStore(),
+		history:     authkit.NewMemoryLoginHistoryStore(),
+		failures:    make(map[string]error),
+	}
+}
+
+// Fail makes the named method ("Put", "Take", "Revoke", "RecordAttempt",
+// "Get", "Reset", "Record", "List" or "Delete") return err from now on, or
+// work again if err is nil. IsRevoked and Prune can't fail.
+func (s *Store) Fail(method string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err == nil {
+		delete(s.failures, method)
+	} else {
+		s.failures[method] = err
+	}
+}
+
+// failure returns the error set for method with Fail
+func (s *Store) failure(method string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.failures[method]
+}
+
+// Put implements authkit.NonceStore
+func (s *Store) Put(key string, entry authkit.NonceEntry) error {
+	if err := s.failure("Put"); err != nil {
+		return err
+	}
+	return s.nonces.Put(key, entry)
+}
+
+// Take implements authkit.NonceStore
+func (s *Store) Take(key, purpose string) (authkit.NonceEntry, error) {
+	if err := s.failure("Take"); err != nil {
+		return authkit.NonceEntry{}, err
+	}
+	return s.nonces.Take(key, purpose)
+}
+
+// Prune implements authkit.NonceStore, authkit.RevocationStore and
+// authkit.LockoutPruner, pruning all three
+func (s *Store) Prune(now time.Time) int {
+	return s.nonces.Prune(now) + s.revocations.Prune(now) + s.lockouts.Prune(now)
+}
+
+// Revoke implements authkit.RevocationStore
+func (s *Store) Revoke(jti string, expiresAt time.Time) error {
+	if err := s.failure("Revoke"); err != nil {
+		return err
+	}
+	return s.revocations.Revoke(jti, expiresAt)
+}
+
+// IsRevoked implements authkit.RevocationStore
+func (s *Store) IsRevoked(jti string, now time.Time) bool {
+	return s.revocations.IsRevoked(jti, now)
+}
+
+// RecordAttempt implements authkit.LockoutStore
+func (s *Store) RecordAttempt(userID string, now time.Time, policy authkit.LockoutPolicy) (authkit.LockoutState, error) {
+	if err := s.failure("RecordAttempt"); err != nil {
+		return authkit.LockoutState{}, err
+	}
+	return s.lockouts.RecordAttempt(userID, now, policy)
+}
+
+// Get implements authkit.LockoutStore
+func (s *Store) Get(userID string) (authkit.LockoutState, error) {
+	if err := s.failure("Get"); err != nil {
+		return authkit.LockoutState{}, err
+	}
+	return s.lockouts.Get(userID)
+}
+
+// Reset implements authkit.LockoutStore
+func (s *Store) Reset(userID string) error {
+	if err := s.failure("Reset"); err != nil {
+		return err
+	}
+	return s.lockouts.Reset(userID)
+}
+
+// Record implements authkit.LoginHistoryStore
+func (s *Store) Record(event authkit.LoginEvent, max int) error {
+	if err := s.failure("Record"); err != nil {
+		return err
+	}
+	return s.history.Record(event, max)
+}
+
+// List implements authkit.LoginHistoryStore
+func (s *Store) List(userID string, limit int) ([]authkit.LoginEvent, error) {
+	if err := s.failure("List"); err != nil {
+		return nil, err
+	}
+	return s.history.List(userID, limit)
+}
+
+// Delete implements authkit.LoginHistoryStore
+func (s *Store) Delete(userID string) error {
+	if err := s.failure("Delete"); err != nil {
+		return err
+	}
+	return s.history.Delete(userID)
+}
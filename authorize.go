@@ -0,0 +1,167 @@
+package authkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultPolicyName names the policy of resource types without a registered
+// one in access denied errors
+const defaultPolicyName = "owner_or_admin"
+
+// adminRole is the role the default policy lets act on any resource
+const adminRole = "admin"
+
+// Resource is what an action is authorized on, see Authorize
+type Resource struct {
+	Type    string // Selects the policy, e.g. "post"
+	ID      string // Resource ID, for the policy's use
+	OwnerID string // ID of the user owning the resource, or empty
+}
+
+// Policy reports whether claims allow action on resource, see RegisterPolicy
+type Policy func(claims *Claims, action string, resource Resource) bool
+
+// AccessDeniedError is returned by Authorize when a policy denies an action.
+// It matches ErrAccessDenied with errors.Is.
+type AccessDeniedError struct {
+	Policy   string // Resource type of the policy, or "owner_or_admin" for the default
+	Action   string
+	Resource Resource
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("%s: policy %s denies %s", ErrAccessDenied.Error(), e.Policy, e.Action)
+}
+
+// Unwrap returns ErrAccessDenied
+func (e *AccessDeniedError) Unwrap() error {
+	return ErrAccessDenied
+}
+
+// RegisterPolicy sets the policy deciding actions on resources of a type,
+// replacing any previous one. A nil policy restores the default, which allows
+// the owner of the resource and users whose role satisfies "admin" (see
+// RoleSatisfies) to perform any action. It panics for an empty resource type.
+//
+//	auth.RegisterPolicy("post", func(claims *authkit.Claims, action string, post authkit.Resource) bool {
+//	    return action == "read" || claims.UserID == post.OwnerID
+//	})
+func (a *AuthKit) RegisterPolicy(resourceType string, policy Policy) {
+	a.debugCheck()
+
+	if resourceType == "" {
+		panic("authkit: RegisterPolicy needs a resource type")
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if policy == nil {
+		delete(a.policies, resourceType)
+		return
+	}
+	a.policies[resourceType] = policy
+}
+
+// Authorize checks that claims allow action on resource with the policy
+// registered for its type, or the default owner-or-admin policy. Denied
+// actions fail with an *AccessDeniedError, and nil claims with ErrUnauthorized.
+func (a *AuthKit) Authorize(claims *Claims, action string, resource Resource) error {
+	a.debugCheck()
+
+	if claims == nil {
+		return opError("authorize", ErrUnauthorized)
+	}
+
+	a.mutex.RLock()
+	policy, registered := a.policies[resource.Type]
+	a.mutex.RUnlock()
+
+	name := resource.Type
+	if !registered {
+		policy, name = a.ownerOrAdmin, defaultPolicyName
+	}
+	if !policy(claims, action, resource) {
+		return opError("authorize", &AccessDeniedError{Policy: name, Action: action, Resource: resource})
+	}
+	return nil
+}
+
+// AuthorizeContext is Authorize for the claims the net/http middleware or the
+// gRPC interceptors stored in ctx
+func (a *AuthKit) AuthorizeContext(ctx context.Context, action string, resource Resource) error {
+	claims, _ := GetUserFromContext(ctx)
+	return a.Authorize(claims, action, resource)
+}
+
+// ownerOrAdmin is the policy of resource types without a registered one
+func (a *AuthKit) ownerOrAdmin(claims *Claims, action string, resource Resource) bool {
+	if resource.OwnerID != "" && claims.UserID == resource.OwnerID {
+		return true
+	}
+	return a.RoleSatisfies(claims.Role, adminRole)
+}
+
+// AuthorizeGin authorizes action on resource for the claims GinMiddleware
+// set. It aborts the request with a 403 naming the policy when the action is
+// denied, or a 401 without claims, and returns false; handlers should then
+// return without responding.
+//
+//	if !auth.AuthorizeGin(c, "edit", authkit.Resource{Type: "post", ID: post.ID, OwnerID: post.AuthorID}) {
+//	    return
+//	}
+func (a *AuthKit) AuthorizeGin(c *gin.Context, action string, resource Resource) bool {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		c.Abort()
+		return false
+	}
+
+	if err := a.Authorize(claims, action, resource); err != nil {
+		a.logRejection(c.Request.Context(), c.Request.URL.Path, ErrorCode(err))
+		a.ginError(c, ErrorStatus(err), err)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// AuthorizeFiber is AuthorizeGin for Fiber. When it returns false the error
+// response has been sent and handlers should return nil.
+func (a *AuthKit) AuthorizeFiber(c *fiber.Ctx, action string, resource Resource) bool {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		_ = a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+		return false
+	}
+
+	if err := a.Authorize(claims, action, resource); err != nil {
+		a.logRejection(c.UserContext(), c.Path(), ErrorCode(err))
+		_ = a.fiberError(c, ErrorStatus(err), err)
+		return false
+	}
+	return true
+}
+
+// AuthorizeHTTP is AuthorizeGin for net/http, reading the claims with
+// GetUserFromContext
+func (a *AuthKit) AuthorizeHTTP(w http.ResponseWriter, r *http.Request, action string, resource Resource) bool {
+	claims, exists := GetUserFromContext(r.Context())
+	if !exists {
+		a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+		return false
+	}
+
+	if err := a.Authorize(claims, action, resource); err != nil {
+		a.logRejection(r.Context(), r.URL.Path, ErrorCode(err))
+		a.httpError(w, r, ErrorStatus(err), err)
+		return false
+	}
+	return true
+}
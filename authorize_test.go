@@ -0,0 +1,194 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAuthorizeDefaultPolicy(t *testing.T) {
+	auth := newTestKit(t, Config{RoleHierarchy: map[string][]string{"superadmin": {"admin"}}})
+	defer auth.Close()
+	post := Resource{Type: "post", ID: "post-1", OwnerID: "alice"}
+
+	tests := []struct {
+		name    string
+		claims  *Claims
+		allowed bool
+	}{
+		{"owner", &Claims{UserID: "alice", Role: "user"}, true},
+		{"other user", &Claims{UserID: "bob", Role: "user"}, false},
+		{"admin", &Claims{UserID: "bob", Role: "admin"}, true},
+		{"inherited admin", &Claims{UserID: "bob", Role: "superadmin"}, true},
+	}
+	for _, tt := range tests {
+		err := auth.Authorize(tt.claims, "edit", post)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: expected the action to be allowed, got %v", tt.name, err)
+		}
+		if !tt.allowed {
+			var deniedErr *AccessDeniedError
+			if !errors.As(err, &deniedErr) || !errors.Is(err, ErrAccessDenied) {
+				t.Fatalf("%s: expected an *AccessDeniedError, got %v", tt.name, err)
+			}
+			if deniedErr.Policy != "owner_or_admin" || deniedErr.Action != "edit" || deniedErr.Resource != post {
+				t.Errorf("%s: unexpected error %+v", tt.name, deniedErr)
+			}
+			if ErrorStatus(err) != http.StatusForbidden || ErrorCode(err) != CodeAccessDenied {
+				t.Errorf("%s: expected 403 %s, got %d %s", tt.name, CodeAccessDenied, ErrorStatus(err), ErrorCode(err))
+			}
+		}
+	}
+
+	// Resources without an owner are admin-only
+	if err := auth.Authorize(&Claims{Role: "user"}, "edit", Resource{Type: "post"}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected users without an ID to own nothing, got %v", err)
+	}
+	if err := auth.Authorize(nil, "edit", post); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized without claims, got %v", err)
+	}
+}
+
+func TestAuthorizeRegisteredPolicy(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	auth.RegisterPolicy("post", func(claims *Claims, action string, post Resource) bool {
+		return action == "read" || (action == "edit" && claims.UserID == post.OwnerID)
+	})
+	post := Resource{Type: "post", ID: "post-1", OwnerID: "alice"}
+	admin := &Claims{UserID: "bob", Role: "admin"}
+
+	if err := auth.Authorize(&Claims{UserID: "carol"}, "read", post); err != nil {
+		t.Errorf("Expected anyone to read posts, got %v", err)
+	}
+	if err := auth.Authorize(&Claims{UserID: "alice"}, "edit", post); err != nil {
+		t.Errorf("Expected the owner to edit the post, got %v", err)
+	}
+	// The registered policy replaces the default, admin override included
+	err := auth.Authorize(admin, "delete", post)
+	var deniedErr *AccessDeniedError
+	if !errors.As(err, &deniedErr) || deniedErr.Policy != "post" {
+		t.Fatalf("Expected the post policy to deny admins, got %v", err)
+	}
+	if details := AsAuthError(err).Details; details["policy"] != "post" {
+		t.Errorf("Expected the policy in the details, got %v", details)
+	}
+
+	// Unknown resource types fall back to the default policy
+	if err := auth.Authorize(admin, "delete", Resource{Type: "comment", OwnerID: "alice"}); err != nil {
+		t.Errorf("Expected admins to pass the default policy, got %v", err)
+	}
+	if err := auth.Authorize(&Claims{UserID: "carol"}, "read", Resource{Type: "comment", OwnerID: "alice"}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected the default policy to deny other users, got %v", err)
+	}
+
+	// A nil policy restores the default
+	auth.RegisterPolicy("post", nil)
+	if err := auth.Authorize(admin, "delete", post); err != nil {
+		t.Errorf("Expected the default policy after unregistering, got %v", err)
+	}
+}
+
+func TestAuthorizeContext(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	ctx := context.WithValue(context.Background(), claimsContextKey{}, &Claims{UserID: "alice"})
+
+	if err := auth.AuthorizeContext(ctx, "edit", Resource{Type: "post", OwnerID: "alice"}); err != nil {
+		t.Errorf("Expected the owner to be allowed, got %v", err)
+	}
+	if err := auth.AuthorizeContext(context.Background(), "edit", Resource{Type: "post", OwnerID: "alice"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized without claims, got %v", err)
+	}
+}
+
+func TestAuthorizeHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "author@example.com")
+	auth.RegisterPolicy("post", func(claims *Claims, action string, post Resource) bool {
+		return claims.UserID == post.OwnerID
+	})
+	// The owner of each post is its ID in the path
+	post := func(ownerID string) Resource {
+		return Resource{Type: "post", ID: ownerID, OwnerID: ownerID}
+	}
+
+	r := gin.New()
+	r.GET("/posts/:id", auth.GinMiddleware(), func(c *gin.Context) {
+		if !auth.AuthorizeGin(c, "edit", post(c.Param("id"))) {
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/public/:id", func(c *gin.Context) {
+		if !auth.AuthorizeGin(c, "edit", post(c.Param("id"))) {
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	app := fiber.New()
+	app.Get("/posts/:id", auth.FiberMiddleware(), func(c *fiber.Ctx) error {
+		if !auth.AuthorizeFiber(c, "edit", post(c.Params("id"))) {
+			return nil
+		}
+		return c.SendString("ok")
+	})
+	app.Get("/public/:id", func(c *fiber.Ctx) error {
+		if !auth.AuthorizeFiber(c, "edit", post(c.Params("id"))) {
+			return nil
+		}
+		return c.SendString("ok")
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/posts/", auth.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AuthorizeHTTP(w, r, "edit", post(strings.TrimPrefix(r.URL.Path, "/posts/"))) {
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})))
+	mux.HandleFunc("/public/", func(w http.ResponseWriter, r *http.Request) {
+		if !auth.AuthorizeHTTP(w, r, "edit", post(strings.TrimPrefix(r.URL.Path, "/public/"))) {
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	servers := map[string]func(w *httptest.ResponseRecorder, req *http.Request){
+		"gin":   func(w *httptest.ResponseRecorder, req *http.Request) { r.ServeHTTP(w, req) },
+		"fiber": func(w *httptest.ResponseRecorder, req *http.Request) { serveFiber(app, w, req) },
+		"http":  func(w *httptest.ResponseRecorder, req *http.Request) { mux.ServeHTTP(w, req) },
+	}
+	for name, serve := range servers {
+		t.Run(name, func(t *testing.T) {
+			request := func(path string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+				w := httptest.NewRecorder()
+				serve(w, req)
+				return w
+			}
+
+			if w := request("/posts/" + tokens.User.ID); w.Code != http.StatusOK || w.Body.String() != "ok" {
+				t.Errorf("Expected the owner to pass, got %d %s", w.Code, w.Body.String())
+			}
+			w := request("/posts/someone-else")
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodeAccessDenied) || !strings.Contains(w.Body.String(), `"policy":"post"`) {
+				t.Errorf("Expected 403 naming the policy, got %d %s", w.Code, w.Body.String())
+			}
+			if w.Header().Get("WWW-Authenticate") != "" {
+				t.Error("Expected no challenge for a denied action")
+			}
+			if w := request("/public/" + tokens.User.ID); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeNotAuthenticated) {
+				t.Errorf("Expected 401 without claims, got %d %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package authkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// BasicAuthOptions configures the Basic authentication middlewares
+type BasicAuthOptions struct {
+	// Role is the role users need, checked like RequireRole (default: any)
+	Role string
+	// TenantID is the tenant users are looked up in (default: the default tenant)
+	TenantID string
+	// Realm is the realm of the WWW-Authenticate challenge (default:
+	// Config.BearerRealm)
+	Realm string
+	// CacheTTL is how long verified credentials skip the password hash,
+	// so clients sending the same credentials with every request, such as
+	// metrics scrapers, don't cost a hash each (default: 0, every request is
+	// hashed). The user is still checked on every request, and changing the
+	// password drops its cached credentials.
+	CacheTTL time.Duration
+}
+
+// basicAuth checks the credentials of one Basic authentication middleware
+type basicAuth struct {
+	auth      *AuthKit
+	opts      BasicAuthOptions
+	challenge string
+
+	cacheKey []byte // Keys the credential digests, so the cache holds nothing reusable
+	mutex    sync.Mutex
+	cache    map[string]basicAuthEntry
+}
+
+// basicAuthEntry records credentials that matched the user's password hash
+type basicAuthEntry struct {
+	userID       string
+	passwordHash string
+	expires      time.Time
+}
+
+// newBasicAuth sets up a Basic authentication middleware. It panics for a
+// realm that can't be quoted in the challenge.
+func (a *AuthKit) newBasicAuth(opts []BasicAuthOptions) *basicAuth {
+	b := &basicAuth{auth: a}
+	if len(opts) > 0 {
+		b.opts = opts[0]
+	}
+	if b.opts.Realm == "" {
+		b.opts.Realm = a.config.BearerRealm
+	}
+	if strings.ContainsAny(b.opts.Realm, `"\`) {
+		panic("authkit: BasicAuthOptions.Realm contains a quote or backslash")
+	}
+	b.challenge = `Basic realm="` + b.opts.Realm + `", charset="UTF-8"`
+	if b.opts.CacheTTL > 0 {
+		b.cacheKey = make([]byte, 32)
+		if _, err := rand.Read(b.cacheKey); err != nil {
+			panic("authkit: generating the Basic authentication cache key: " + err.Error())
+		}
+		b.cache = make(map[string]basicAuthEntry)
+	}
+	return b
+}
+
+// BasicAuthMiddleware returns a Gin middleware authenticating requests with
+// the email and password of a user in an Authorization: Basic header (RFC
+// 7617), for clients such as metrics scrapers that can't handle tokens. It
+// sets the same context values as GinMiddleware. Failed passwords count
+// towards the account lockout, and users with TOTP enabled are rejected with
+// CodeMFARequired, since Basic credentials can't carry a second factor.
+//
+//	r.GET("/metrics", auth.BasicAuthMiddleware(authkit.BasicAuthOptions{Role: "metrics"}), handler)
+func (a *AuthKit) BasicAuthMiddleware(opts ...BasicAuthOptions) gin.HandlerFunc {
+	b := a.newBasicAuth(opts)
+	return func(c *gin.Context) {
+		claims, status, code := b.authenticate(c.Request.Context(), c.GetHeader("Authorization"))
+		if claims == nil {
+			a.logRejection(c.Request.Context(), c.Request.URL.Path, code)
+			if status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", b.challenge)
+			}
+			a.ginErrorCode(c, status, code)
+			c.Abort()
+			return
+		}
+
+		a.traceAuthenticated(c.Request.Context(), claims)
+		ginSetClaims(c, claims)
+		c.Next()
+	}
+}
+
+// BasicAuthMiddlewareFiber is BasicAuthMiddleware for Fiber
+func (a *AuthKit) BasicAuthMiddlewareFiber(opts ...BasicAuthOptions) fiber.Handler {
+	b := a.newBasicAuth(opts)
+	return func(c *fiber.Ctx) error {
+		claims, status, code := b.authenticate(c.UserContext(), c.Get(fiber.HeaderAuthorization))
+		if claims == nil {
+			a.logRejection(c.UserContext(), c.Path(), code)
+			if status == fiber.StatusUnauthorized {
+				c.Set(fiber.HeaderWWWAuthenticate, b.challenge)
+			}
+			return a.fiberErrorCode(c, status, code)
+		}
+
+		a.traceAuthenticated(c.UserContext(), claims)
+		fiberSetClaims(c, claims)
+		return c.Next()
+	}
+}
+
+// BasicAuthMiddlewareHTTP is BasicAuthMiddleware for net/http. Handlers
+// read the claims with GetUserFromContext.
+func (a *AuthKit) BasicAuthMiddlewareHTTP(opts ...BasicAuthOptions) func(http.Handler) http.Handler {
+	b := a.newBasicAuth(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, status, code := b.authenticate(r.Context(), r.Header.Get("Authorization"))
+			if claims == nil {
+				a.logRejection(r.Context(), r.URL.Path, code)
+				if status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", b.challenge)
+				}
+				a.httpErrorCode(w, r, status, code)
+				return
+			}
+
+			a.traceAuthenticated(r.Context(), claims)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+		})
+	}
+}
+
+// basicCredentials extracts the username and password of an Authorization:
+// Basic header
+func basicCredentials(header string, maxSize int) (username, password string, ok bool) {
+	scheme, encoded, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Basic") || len(encoded) > maxSize {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	username, password, found = strings.Cut(string(decoded), ":")
+	if !found || username == "" {
+		return "", "", false
+	}
+	return username, password, true
+}
+
+// authenticate checks the credentials of an Authorization header, returning
+// the claims of the user, or the status and code to reject the request with
+func (b *basicAuth) authenticate(ctx context.Context, header string) (*Claims, int, string) {
+	a := b.auth
+	if header == "" {
+		return nil, http.StatusUnauthorized, CodeMissingAuthorization
+	}
+	username, password, ok := basicCredentials(header, a.config.MaxTokenSize)
+	if !ok {
+		return nil, http.StatusUnauthorized, CodeInvalidAuthorizationFormat
+	}
+
+	digest := b.digest(username, password)
+	user, ok := b.cached(digest)
+	if !ok {
+		var err error
+		if user, err = b.checkPassword(ctx, username, password); err != nil {
+			if errors.Is(err, ErrInvalidCredentials) {
+				return nil, http.StatusUnauthorized, CodeInvalidCredentials
+			}
+			return nil, ErrorStatus(err), ErrorCode(err)
+		}
+		b.store(digest, user)
+	}
+
+	var err error
+	switch {
+	case user.PurgeAt != nil:
+		err = ErrAccountPendingDeletion
+	case user.Disabled:
+		err = ErrUserDisabled
+	case a.config.EmailRequired && !user.EmailVerified:
+		err = ErrEmailNotVerified
+	case user.TOTPEnabled:
+		err = ErrMFARequired
+	}
+	if err != nil {
+		return nil, ErrorStatus(err), ErrorCode(err)
+	}
+	if user.MustChangePassword {
+		return nil, http.StatusForbidden, CodePasswordChangeRequired
+	}
+	if b.opts.Role != "" && !a.RoleSatisfies(user.Role, b.opts.Role) {
+		return nil, http.StatusForbidden, CodeInsufficientPermissions
+	}
+
+	claims, err := a.basicClaims(user)
+	if err != nil {
+		return nil, http.StatusInternalServerError, CodeInternalError
+	}
+	return claims, 0, ""
+}
+
+// checkPassword verifies the password of the user with the email like
+// LoginUser does, counting the attempt towards the lockout
+func (b *basicAuth) checkPassword(ctx context.Context, email, password string) (*User, error) {
+	a := b.auth
+	user, err := a.GetUserByEmailInTenant(b.opts.TenantID, email)
+	if err != nil {
+		if err := a.compareDummyPassword(ctx, password); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := a.checkLoginPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// digest identifies credentials in the cache
+func (b *basicAuth) digest(username, password string) string {
+	if b.cache == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, b.cacheKey)
+	mac.Write([]byte(username + "\x00" + password))
+	return string(mac.Sum(nil))
+}
+
+// cached returns a copy of the user verified with the credentials of digest,
+// unless the entry expired or the user's password has changed since
+func (b *basicAuth) cached(digest string) (*User, bool) {
+	if b.cache == nil {
+		return nil, false
+	}
+	b.mutex.Lock()
+	entry, found := b.cache[digest]
+	b.mutex.Unlock()
+	if !found || !b.auth.now().Before(entry.expires) {
+		return nil, false
+	}
+
+	user, exists := b.auth.users.get(entry.userID)
+	if !exists || user.DeletedAt != nil || user.Password == "" ||
+		subtle.ConstantTimeCompare([]byte(user.Password), []byte(entry.passwordHash)) != 1 {
+		return nil, false
+	}
+	return cloneUser(user), true
+}
+
+// store caches credentials verified for user, dropping expired entries
+func (b *basicAuth) store(digest string, user *User) {
+	if b.cache == nil {
+		return
+	}
+	now := b.auth.now()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for key, entry := range b.cache {
+		if !now.Before(entry.expires) {
+			delete(b.cache, key)
+		}
+	}
+	b.cache[digest] = basicAuthEntry{userID: user.ID, passwordHash: user.Password, expires: now.Add(b.opts.CacheTTL)}
+}
+
+// basicClaims returns the claims of a user authenticated with Basic
+// credentials, those of an access token issued to them outside a session
+func (a *AuthKit) basicClaims(user *User) (*Claims, error) {
+	subject, err := a.subjectFor(user)
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Permissions:  a.effectivePermissions(user.Role, user.Permissions),
+		Metadata:     a.tokenMetadata(user.Metadata),
+		TokenVersion: user.TokenVersion,
+		AMR:          passwordAMR,
+		TenantID:     user.TenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  subject,
+			IssuedAt: jwt.NewNumericDate(a.now()),
+			Issuer:   a.config.Issuer,
+			Audience: append([]string{}, a.config.Audience...),
+		},
+	}, nil
+}
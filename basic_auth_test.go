@@ -0,0 +1,198 @@
+package authkit
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// basicAuthServers serves GET /metrics behind each framework's Basic
+// authentication middleware, responding with the email of the claims
+func basicAuthServers(auth *AuthKit, opts BasicAuthOptions) map[string]func(req *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", auth.BasicAuthMiddleware(opts), func(c *gin.Context) {
+		claims, _ := GetUserFromGinContext(c)
+		c.String(http.StatusOK, claims.Email)
+	})
+	app := fiber.New()
+	app.Get("/metrics", auth.BasicAuthMiddlewareFiber(opts), func(c *fiber.Ctx) error {
+		claims, _ := GetUserFromFiberContext(c)
+		return c.SendString(claims.Email)
+	})
+	handler := auth.BasicAuthMiddlewareHTTP(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetUserFromContext(r.Context())
+		_, _ = w.Write([]byte(claims.Email))
+	}))
+
+	return map[string]func(req *http.Request) *httptest.ResponseRecorder{
+		"gin": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		},
+		"fiber": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			serveFiber(app, w, req)
+			return w
+		},
+		"http": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w
+		},
+	}
+}
+
+func basicAuthRequest(authorization string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return req
+}
+
+func basicHeader(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	auth := newTestKit(t, Config{BearerRealm: "metrics"})
+	defer auth.Close()
+	loginTestUser(t, auth, "scraper@example.com")
+
+	for name, serve := range basicAuthServers(auth, BasicAuthOptions{}) {
+		t.Run(name, func(t *testing.T) {
+			w := serve(basicAuthRequest(basicHeader("scraper@example.com", "password123")))
+			if w.Code != http.StatusOK || w.Body.String() != "scraper@example.com" {
+				t.Fatalf("Expected the user's claims, got %d %s", w.Code, w.Body.String())
+			}
+
+			tests := []struct {
+				name          string
+				authorization string
+				code          string
+			}{
+				{"missing", "", CodeMissingAuthorization},
+				{"wrong password", basicHeader("scraper@example.com", "wrong-password"), CodeInvalidCredentials},
+				{"unknown user", basicHeader("nobody@example.com", "password123"), CodeInvalidCredentials},
+				{"bearer", "Bearer some-token", CodeInvalidAuthorizationFormat},
+				{"not base64", "Basic !!!", CodeInvalidAuthorizationFormat},
+				{"no colon", "Basic " + base64.StdEncoding.EncodeToString([]byte("scraper@example.com")), CodeInvalidAuthorizationFormat},
+				{"no username", basicHeader("", "password123"), CodeInvalidAuthorizationFormat},
+				{"no credentials", "Basic", CodeInvalidAuthorizationFormat},
+			}
+			for _, tt := range tests {
+				w := serve(basicAuthRequest(tt.authorization))
+				if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tt.code) {
+					t.Errorf("%s: expected 401 %s, got %d %s", tt.name, tt.code, w.Code, w.Body.String())
+				}
+				if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="metrics", charset="UTF-8"` {
+					t.Errorf("%s: expected a Basic challenge, got %q", tt.name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthMiddlewareChecksUser(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "user@example.com").User
+	mfa := loginTestUser(t, auth, "mfa@example.com").User
+	enrollTestTOTP(t, auth, mfa.ID)
+	disabled := loginTestUser(t, auth, "disabled@example.com").User
+	if err := auth.DisableUser(disabled.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, serve := range basicAuthServers(auth, BasicAuthOptions{Role: "admin"}) {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range []struct {
+				email  string
+				status int
+				code   string
+			}{
+				{user.Email, http.StatusForbidden, CodeInsufficientPermissions},
+				{mfa.Email, http.StatusForbidden, CodeMFARequired},
+				{disabled.Email, http.StatusForbidden, CodeUserDisabled},
+			} {
+				w := serve(basicAuthRequest(basicHeader(tt.email, "password123")))
+				if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+					t.Errorf("%s: expected %d %s, got %d %s", tt.email, tt.status, tt.code, w.Code, w.Body.String())
+				}
+				if w.Header().Get("WWW-Authenticate") != "" {
+					t.Errorf("%s: expected no challenge for a 403", tt.email)
+				}
+			}
+		})
+	}
+
+	if err := auth.DefineRole("admin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AssignRole(user.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if w := basicAuthServers(auth, BasicAuthOptions{Role: "admin"})["http"](basicAuthRequest(basicHeader(user.Email, "password123"))); w.Code != http.StatusOK {
+		t.Errorf("Expected admins to pass, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBasicAuthMiddlewareLockout(t *testing.T) {
+	auth := newTestKit(t, Config{MaxLoginAttempts: 2})
+	defer auth.Close()
+	loginTestUser(t, auth, "user@example.com")
+	serve := basicAuthServers(auth, BasicAuthOptions{})["gin"]
+
+	for i := 0; i < 2; i++ {
+		serve(basicAuthRequest(basicHeader("user@example.com", "wrong-password")))
+	}
+	w := serve(basicAuthRequest(basicHeader("user@example.com", "password123")))
+	if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), CodeAccountLocked) {
+		t.Errorf("Expected the locked account to reject the correct password, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBasicAuthMiddlewareCache(t *testing.T) {
+	auth := newTestKit(t, Config{MaxLoginAttempts: 1})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "user@example.com").User
+	if err := auth.UnlockUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	cached := basicAuthServers(auth, BasicAuthOptions{CacheTTL: time.Minute})["fiber"]
+	uncached := basicAuthServers(auth, BasicAuthOptions{})["fiber"]
+
+	if w := cached(basicAuthRequest(basicHeader("user@example.com", "password123"))); w.Code != http.StatusOK {
+		t.Fatalf("Expected the credentials to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+	// A wrong password locks the account, but cached credentials skip the password check
+	uncached(basicAuthRequest(basicHeader("user@example.com", "wrong-password")))
+	if w := uncached(basicAuthRequest(basicHeader("user@example.com", "password123"))); w.Code != http.StatusLocked {
+		t.Fatalf("Expected uncached credentials to hit the lock, got %d", w.Code)
+	}
+	if w := cached(basicAuthRequest(basicHeader("user@example.com", "password123"))); w.Code != http.StatusOK {
+		t.Errorf("Expected cached credentials to skip the password check, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Changing the password drops the cached credentials
+	if err := auth.UnlockUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ChangePassword(user.ID, "password123", "new-password-456"); err != nil {
+		t.Fatal(err)
+	}
+	if w := cached(basicAuthRequest(basicHeader("user@example.com", "password123"))); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to be rejected, got %d", w.Code)
+	}
+	if w := cached(basicAuthRequest(basicHeader("user@example.com", "new-password-456"))); w.Code != http.StatusLocked {
+		t.Errorf("Expected the failed attempt to count, got %d", w.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package authkit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultHIBPURL is the Have I Been Pwned range API
+	defaultHIBPURL = "https://api.pwnedpasswords.com/range/"
+	// defaultBreachCheckTimeout bounds a HIBPChecker query by default
+	defaultBreachCheckTimeout = 5 * time.Second
+	// maxHIBPResponseSize bounds how much of a range response is read
+	maxHIBPResponseSize = 1 << 20
+)
+
+// BreachChecker reports how often a password appears in known data breaches.
+// It is asked for every new password when set as Config.BreachChecker, and
+// must give up once ctx is done.
+type BreachChecker interface {
+	BreachCount(ctx context.Context, password string) (int, error)
+}
+
+// PasswordBreachedError is returned for passwords found by the BreachChecker.
+// It matches ErrPasswordBreached with errors.Is.
+type PasswordBreachedError struct {
+	Count int // Number of times the password appears in breaches
+}
+
+func (e *PasswordBreachedError) Error() string {
+	return fmt.Sprintf("%s (%d times)", ErrPasswordBreached.Error(), e.Count)
+}
+
+// Unwrap returns ErrPasswordBreached
+func (e *PasswordBreachedError) Unwrap() error {
+	return ErrPasswordBreached
+}
+
+// HIBPChecker is a BreachChecker querying the Have I Been Pwned Pwned
+// Passwords API. Only the first 5 hex characters of the password's SHA-1 are
+// sent (k-anonymity); the matching is done locally, and responses are padded
+// so their size reveals nothing either.
+type HIBPChecker struct {
+	// URL is the range API the hash prefix is appended to (default: https://api.pwnedpasswords.com/range/)
+	URL string
+	// Timeout bounds each query (default: 5s)
+	Timeout time.Duration
+	// Client sends the queries (default: http.DefaultClient)
+	Client *http.Client
+}
+
+// BreachCount implements BreachChecker
+func (h *HIBPChecker) BreachCount(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	base, timeout, client := h.URL, h.Timeout, h.Client
+	if base == "" {
+		base = defaultHIBPURL
+	}
+	if timeout <= 0 {
+		timeout = defaultBreachCheckTimeout
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("querying breached passwords: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("querying breached passwords: unexpected status %d", resp.StatusCode)
+	}
+
+	// Lines are "SUFFIX:COUNT"; padding entries have a count of 0
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxHIBPResponseSize))
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if found && strings.EqualFold(candidate, suffix) {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return 0, fmt.Errorf("decoding breached passwords: invalid count %q", count)
+			}
+			return n, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("decoding breached passwords: %w", err)
+	}
+	return 0, nil
+}
+
+// checkBreached rejects password with a *PasswordBreachedError if the
+// configured BreachChecker finds it. When the check fails the password is
+// accepted and the failure logged, unless Config.BreachCheckFailClosed is set.
+func (a *AuthKit) checkBreached(ctx context.Context, password string) error {
+	if a.config.BreachChecker == nil {
+		return nil
+	}
+
+	count, err := a.config.BreachChecker.BreachCount(ctx, password)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if a.config.BreachCheckFailClosed {
+			return fmt.Errorf("%w: %v", ErrBreachCheckUnavailable, err)
+		}
+		a.config.Logger.Warn("password breach check failed", "error", err)
+		return nil
+	}
+	if count > 0 {
+		return &PasswordBreachedError{Count: count}
+	}
+	return nil
+}
+
+// checkNewPassword checks a new password against the password policy, then
+// against the BreachChecker
+func (a *AuthKit) checkNewPassword(ctx context.Context, password, email string) error {
+	if err := a.CheckPassword(password, email); err != nil {
+		return err
+	}
+	return a.checkBreached(ctx, password)
+}
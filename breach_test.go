@@ -0,0 +1,180 @@
+package authkit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hibpServer is a stub of the Pwned Passwords range API knowing breached
+func hibpServer(t *testing.T, breached map[string]int, requests *[]*http.Request) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			*requests = append(*requests, r)
+		}
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		fmt.Fprintln(w, "0018A45C4D1DEF81644B54AB7F969B88D65:0") // padding
+		for password, count := range breached {
+			sum := sha1.Sum([]byte(password))
+			hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+			if hash[:5] == prefix {
+				fmt.Fprintf(w, "%s:%d\r\n", hash[5:], count)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// stubBreachChecker is a BreachChecker returning err, or the count of breached passwords
+type stubBreachChecker struct {
+	breached map[string]int
+	err      error
+}
+
+func (s *stubBreachChecker) BreachCount(_ context.Context, password string) (int, error) {
+	return s.breached[password], s.err
+}
+
+func TestHIBPChecker(t *testing.T) {
+	var requests []*http.Request
+	server := hibpServer(t, map[string]int{"password123": 251682}, &requests)
+	checker := &HIBPChecker{URL: server.URL + "/range/"}
+
+	count, err := checker.BreachCount(context.Background(), "password123")
+	if err != nil || count != 251682 {
+		t.Errorf("Expected 251682 breaches, got %d, %v", count, err)
+	}
+	count, err = checker.BreachCount(context.Background(), "a-password-nobody-has-used-9f3c")
+	if err != nil || count != 0 {
+		t.Errorf("Expected no breaches, got %d, %v", count, err)
+	}
+
+	sum := sha1.Sum([]byte("password123"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if path := requests[0].URL.Path; path != "/range/"+hash[:5] {
+		t.Errorf("Expected only the 5 character hash prefix to be sent, got %s", path)
+	}
+	if requests[0].Header.Get("Add-Padding") != "true" {
+		t.Error("Expected padded responses to be requested")
+	}
+}
+
+func TestHIBPCheckerErrors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if _, err := (&HIBPChecker{URL: failing.URL + "/"}).BreachCount(context.Background(), "password123"); err == nil {
+		t.Error("Expected an error for a failing API")
+	}
+
+	blocked := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-blocked:
+		}
+	}))
+	defer slow.Close()
+	defer close(blocked)
+
+	start := time.Now()
+	if _, err := (&HIBPChecker{URL: slow.URL + "/", Timeout: 50 * time.Millisecond}).BreachCount(context.Background(), "password123"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the query to time out, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := (&HIBPChecker{URL: slow.URL + "/"}).BreachCount(ctx, "password123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the query to stop with its context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the queries to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestBreachedPasswordsRejected(t *testing.T) {
+	server := hibpServer(t, map[string]int{"password123": 251682, "breached-password": 3}, nil)
+	auth := newTestKit(t, Config{BreachChecker: &HIBPChecker{URL: server.URL + "/range/"}})
+	defer auth.Close()
+
+	_, err := auth.RegisterUser(RegisterRequest{Email: "breached@example.com", Password: "password123", Name: "Breached"})
+	var breachedErr *PasswordBreachedError
+	if !errors.As(err, &breachedErr) || breachedErr.Count != 251682 || !errors.Is(err, ErrPasswordBreached) {
+		t.Fatalf("Expected a PasswordBreachedError with the count, got %v", err)
+	}
+	if ErrorCode(err) != CodePasswordBreached {
+		t.Errorf("Expected %s, got %s", CodePasswordBreached, ErrorCode(err))
+	}
+
+	user, err := auth.RegisterUser(RegisterRequest{Email: "breached@example.com", Password: "unbreached-password1", Name: "Breached"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ChangePassword(user.ID, "unbreached-password1", "breached-password"); !errors.Is(err, ErrPasswordBreached) {
+		t.Errorf("Expected ChangePassword to reject a breached password, got %v", err)
+	}
+
+	token, err := auth.CreatePasswordResetToken("breached@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ResetPassword(token, "breached-password"); !errors.Is(err, ErrPasswordBreached) {
+		t.Errorf("Expected ResetPassword to reject a breached password, got %v", err)
+	}
+	if err := auth.ResetPassword(token, "another-unbreached-password"); err != nil {
+		t.Errorf("Expected the reset token to survive the rejection, got %v", err)
+	}
+}
+
+func TestBreachCheckFailure(t *testing.T) {
+	handler := &captureHandler{}
+	checker := &stubBreachChecker{err: errors.New("connection refused")}
+	auth := newTestKit(t, Config{BreachChecker: checker, Logger: slog.New(handler)})
+	defer auth.Close()
+
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "open@example.com", Password: "secret-password1", Name: "Open"}); err != nil {
+		t.Fatalf("Expected the check to fail open, got %v", err)
+	}
+	if len(handler.find("password breach check failed")) != 1 {
+		t.Error("Expected the failure to be logged")
+	}
+	if strings.Contains(handler.String(), "secret-password1") {
+		t.Error("Expected the password never to be logged")
+	}
+
+	auth.config.BreachCheckFailClosed = true
+	_, err := auth.RegisterUser(RegisterRequest{Email: "closed@example.com", Password: "secret-password1", Name: "Closed"})
+	if !errors.Is(err, ErrBreachCheckUnavailable) {
+		t.Errorf("Expected ErrBreachCheckUnavailable, got %v", err)
+	}
+}
+
+func TestRegisterHandlerBreachCount(t *testing.T) {
+	auth := newTestKit(t, Config{
+		BreachChecker: &stubBreachChecker{breached: map[string]int{"password123": 42}}})
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"handler@example.com","password":"password123","name":"Handler"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"breach_count":42`) || !strings.Contains(w.Body.String(), CodePasswordBreached) {
+		t.Errorf("Expected 400 with the breach count, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,491 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Brute-force protection defaults, see BruteForceConfig
+const (
+	defaultBruteForceMaxFailures = 20
+	defaultBruteForceWindow      = 15 * time.Minute
+	defaultBruteForceBanDuration = time.Hour
+	defaultBruteForceBaseDelay   = time.Second
+	defaultBruteForceMaxDelay    = time.Minute
+)
+
+// bruteForceKeyPrefix keeps the counters of client IPs apart from those of
+// users in Config.LockoutStore
+const bruteForceKeyPrefix = "ip:"
+
+// bruteForceFailuresSuffix keys the settled failures of a client IP, which its
+// delays are based on. The counter under the plain key also includes requests
+// still in flight, so it is only used for bans.
+const bruteForceFailuresSuffix = "/failures"
+
+// BruteForceConfig configures BruteForceProtection, which throttles the
+// client IPs failing requests such as logins and registrations. Its counters
+// live in Config.LockoutStore next to the account lockout's, so a shared
+// store protects every instance of a cluster.
+type BruteForceConfig struct {
+	// MaxFailures is how many requests within Window ban a client IP
+	// (default: 20). Successes are forgiven, see LockoutForgiver.
+	MaxFailures int
+	// Window is how long requests count towards MaxFailures (default: 15m)
+	Window time.Duration
+	// BanDuration is how long a banned client IP is rejected (default: 1h)
+	BanDuration time.Duration
+	// BaseDelay is how long a client IP must wait after a failure before
+	// trying again, doubling with every further failure (default: 1s,
+	// negative disables delays)
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts (default: 1m)
+	MaxDelay time.Duration
+	// TrustedProxies lists the IPs and CIDR ranges of the proxies whose
+	// X-Forwarded-For header names the client (default: none, the client is
+	// the peer address and the header is ignored)
+	TrustedProxies []string
+}
+
+// withDefaults returns a copy of the brute-force config with defaults filled in
+func (c BruteForceConfig) withDefaults() *BruteForceConfig {
+	if c.MaxFailures == 0 {
+		c.MaxFailures = defaultBruteForceMaxFailures
+	}
+	if c.Window == 0 {
+		c.Window = defaultBruteForceWindow
+	}
+	if c.BanDuration == 0 {
+		c.BanDuration = defaultBruteForceBanDuration
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = defaultBruteForceBaseDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = defaultBruteForceMaxDelay
+	}
+	c.TrustedProxies = append([]string{}, c.TrustedProxies...)
+	return &c
+}
+
+// validate checks the brute-force config for values that cannot be used
+func (c *BruteForceConfig) validate() error {
+	if c.MaxFailures < 0 || c.Window < 0 || c.BanDuration < 0 || c.MaxDelay < 0 {
+		return fmt.Errorf("%w: negative BruteForce.MaxFailures, Window, BanDuration or MaxDelay", ErrInvalidConfig)
+	}
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseTrustedProxies parses IPs and CIDR ranges, single IPs matching only themselves
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: invalid BruteForce.TrustedProxies entry %q", ErrInvalidConfig, proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid BruteForce.TrustedProxies entry %q", ErrInvalidConfig, proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// bruteForce tracks the failures of client IPs, see BruteForceProtection
+type bruteForce struct {
+	auth    *AuthKit
+	config  *BruteForceConfig
+	proxies []*net.IPNet
+}
+
+// newBruteForce sets up brute-force protection for a validated config
+func newBruteForce(a *AuthKit, config *BruteForceConfig) *bruteForce {
+	proxies, _ := parseTrustedProxies(config.TrustedProxies)
+	return &bruteForce{auth: a, config: config, proxies: proxies}
+}
+
+// policy returns the lockout policy banning client IPs
+func (b *bruteForce) policy() LockoutPolicy {
+	return LockoutPolicy{MaxAttempts: b.config.MaxFailures, Window: b.config.Window, Duration: b.config.BanDuration}
+}
+
+// failuresPolicy returns the lockout policy counting settled failures, which
+// never locks; bans are left to policy
+func (b *bruteForce) failuresPolicy() LockoutPolicy {
+	return LockoutPolicy{MaxAttempts: math.MaxInt, Window: b.config.Window}
+}
+
+// trusted reports whether ip is a trusted proxy
+func (b *bruteForce) trusted(ip net.IP) bool {
+	for _, proxy := range b.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the client of a request from the peer at remoteAddr. The
+// X-Forwarded-For values are only read when the peer is a trusted proxy, from
+// the right, up to the first address that isn't a trusted proxy; anything to
+// its left may have been sent by the client itself.
+func (b *bruteForce) clientIP(remoteAddr string, forwardedFor []string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	client := net.ParseIP(remoteAddr)
+	if client == nil {
+		return remoteAddr
+	}
+
+	hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+	for i := len(hops) - 1; i >= 0 && b.trusted(client); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		client = hop
+	}
+	return client.String()
+}
+
+// delay returns how long a client IP with the settled failures in state must
+// still wait before its next attempt
+func (b *bruteForce) delay(state LockoutState, now time.Time) time.Duration {
+	if b.config.BaseDelay < 0 || state.Attempts == 0 || state.LastAttempt.IsZero() {
+		return 0
+	}
+	delay := b.config.BaseDelay
+	for i := 1; i < state.Attempts && delay < b.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.config.MaxDelay {
+		delay = b.config.MaxDelay
+	}
+	if wait := state.LastAttempt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// begin counts an attempt from the client IP, returning the wait and error to
+// reject the request with while the IP is banned or must wait. Attempts are
+// counted before the handler runs, so concurrent requests can't all slip in
+// ahead of the ban; finish forgives those that didn't fail. Delays only follow
+// the failures finish records, so requests in flight don't hold up each other.
+func (b *bruteForce) begin(ctx context.Context, ip string) (time.Duration, error) {
+	a := b.auth
+	key := bruteForceKeyPrefix + ip
+	now := a.now()
+
+	state, err := a.config.LockoutStore.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if state.Locked(now) {
+		return state.LockedUntil.Sub(now), ErrIPBanned
+	}
+	failures, err := a.config.LockoutStore.Get(key + bruteForceFailuresSuffix)
+	if err != nil {
+		return 0, err
+	}
+	if wait := b.delay(failures, now); wait > 0 {
+		return wait, ErrRateLimited
+	}
+
+	state, err = a.recordAttempt(key, now, b.policy())
+	if errors.Is(err, ErrAccountLocked) {
+		return state.LockedUntil.Sub(now), ErrIPBanned
+	}
+	if err != nil {
+		return 0, err
+	}
+	if state.Locked(now) {
+		a.config.Logger.WarnContext(ctx, "client IP banned", "ip", ip, "until", state.LockedUntil)
+		a.audit(AuditEvent{Type: AuditIPBanned, IP: ip, Metadata: map[string]string{
+			"attempts": strconv.Itoa(state.Attempts),
+			"until":    state.LockedUntil.UTC().Format(time.RFC3339),
+		}})
+	}
+	return 0, nil
+}
+
+// finish settles the attempt counted by begin once the response status is
+// known. Failures, the 4xx responses other than 429, stay counted and are
+// recorded for the delays. Successes forgive their attempt and half the
+// failures before them, and other responses, such as server errors, forgive
+// their attempt.
+func (b *bruteForce) finish(ctx context.Context, ip string, status int) {
+	a := b.auth
+	key := bruteForceKeyPrefix + ip
+	failuresKey := key + bruteForceFailuresSuffix
+
+	var err error
+	forgiver, ok := a.config.LockoutStore.(LockoutForgiver)
+	switch {
+	case status >= 400 && status < 500 && status != http.StatusTooManyRequests:
+		_, err = a.recordAttempt(failuresKey, a.now(), b.failuresPolicy())
+	case status < 400 && !ok:
+		if err = a.config.LockoutStore.Reset(key); err == nil {
+			err = a.config.LockoutStore.Reset(failuresKey)
+		}
+	case status < 400:
+		var failures LockoutState
+		if failures, err = a.config.LockoutStore.Get(failuresKey); err == nil {
+			forgiven := (failures.Attempts + 1) / 2
+			if err = forgiver.Forgive(key, 1+forgiven); err == nil {
+				err = forgiver.Forgive(failuresKey, forgiven)
+			}
+		}
+	case ok:
+		err = forgiver.Forgive(key, 1)
+	}
+	if err != nil {
+		a.config.Logger.ErrorContext(ctx, "settling brute-force attempt failed", "ip", ip, "error", err)
+	}
+}
+
+// bruteForceProtection returns the brute-force protection, panicking without
+// Config.BruteForce
+func (a *AuthKit) bruteForceProtection() *bruteForce {
+	if a.bruteForce == nil {
+		panic("authkit: BruteForceProtection needs Config.BruteForce")
+	}
+	return a.bruteForce
+}
+
+// BruteForceProtection returns a Gin middleware throttling client IPs that
+// keep failing the requests it guards, such as logins and registrations.
+// After a failure, a client IP must wait BruteForceConfig.BaseDelay, doubling
+// with each further failure, and BruteForceConfig.MaxFailures failures ban it
+// for BruteForceConfig.BanDuration; both are answered with 429 and
+// Retry-After. Failures are the 4xx responses other than 429. It complements
+// the per-account lockout, which still applies to logins. It panics without
+// Config.BruteForce.
+//
+//	r.POST("/login", auth.BruteForceProtection(), auth.LoginHandler)
+func (a *AuthKit) BruteForceProtection() gin.HandlerFunc {
+	b := a.bruteForceProtection()
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ip := b.clientIP(c.Request.RemoteAddr, c.Request.Header.Values("X-Forwarded-For"))
+		if wait, err := b.begin(ctx, ip); err != nil {
+			a.logRejection(ctx, c.Request.URL.Path, ErrorCode(err))
+			if wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			}
+			a.ginError(c, ErrorStatus(err), err)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+		b.finish(ctx, ip, c.Writer.Status())
+	}
+}
+
+// BruteForceProtectionFiber is BruteForceProtection for Fiber
+func (a *AuthKit) BruteForceProtectionFiber() fiber.Handler {
+	b := a.bruteForceProtection()
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		var forwardedFor []string
+		for _, value := range c.Request().Header.PeekAll(fiber.HeaderXForwardedFor) {
+			forwardedFor = append(forwardedFor, string(value))
+		}
+		ip := b.clientIP(c.Context().RemoteIP().String(), forwardedFor)
+		if wait, err := b.begin(ctx, ip); err != nil {
+			a.logRejection(ctx, c.Path(), ErrorCode(err))
+			if wait > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(wait)))
+			}
+			return a.fiberError(c, ErrorStatus(err), err)
+		}
+
+		err := c.Next()
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+		b.finish(ctx, ip, status)
+		return err
+	}
+}
+
+// BruteForceProtectionHTTP is BruteForceProtection for net/http
+func (a *AuthKit) BruteForceProtectionHTTP(next http.Handler) http.Handler {
+	b := a.bruteForceProtection()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := b.clientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+		if wait, err := b.begin(r.Context(), ip); err != nil {
+			a.logRejection(r.Context(), r.URL.Path, ErrorCode(err))
+			if wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			}
+			a.httpError(w, r, ErrorStatus(err), err)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		b.finish(r.Context(), ip, recorder.status)
+	})
+}
+
+// statusRecorder records the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// IPBanStatus is the brute-force state of a client IP, see BruteForceStatus
+type IPBanStatus struct {
+	IP          string     `json:"ip"`
+	Attempts    int        `json:"attempts"` // Attempts counted in the current window
+	Banned      bool       `json:"banned"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// bruteForceIP returns the canonical form of an IP for the brute-force admin API
+func (a *AuthKit) bruteForceIP(ip string) (string, error) {
+	if a.bruteForce == nil {
+		return "", ErrBruteForceDisabled
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", ErrInvalidIPAddress
+	}
+	return parsed.String(), nil
+}
+
+// BruteForceStatus returns the brute-force state of a client IP
+func (a *AuthKit) BruteForceStatus(ip string) (*IPBanStatus, error) {
+	a.debugCheck()
+
+	ip, err := a.bruteForceIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	state, err := a.config.LockoutStore.Get(bruteForceKeyPrefix + ip)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &IPBanStatus{IP: ip, Banned: state.Locked(a.now())}
+	if status.Banned {
+		bannedUntil := state.LockedUntil
+		status.BannedUntil = &bannedUntil
+	}
+	if state.WindowStart.Add(a.bruteForce.config.Window).After(a.now()) || status.Banned {
+		status.Attempts = state.Attempts
+	}
+	return status, nil
+}
+
+// UnbanIP lifts the ban of a client IP and clears its failures
+func (a *AuthKit) UnbanIP(ip string) error {
+	return a.UnbanIPCtx(context.Background(), ip)
+}
+
+// UnbanIPCtx is UnbanIP with a context, recording the actor set with
+// WithAuditActor on the audit event of a lifted ban
+func (a *AuthKit) UnbanIPCtx(ctx context.Context, ip string) error {
+	a.debugCheck()
+
+	status, err := a.BruteForceStatus(ip)
+	if err != nil {
+		return err
+	}
+	key := bruteForceKeyPrefix + status.IP
+	if err := a.config.LockoutStore.Reset(key); err != nil {
+		return err
+	}
+	if err := a.config.LockoutStore.Reset(key + bruteForceFailuresSuffix); err != nil {
+		return err
+	}
+	if status.Banned {
+		a.audit(AuditEvent{Type: AuditIPUnbanned, ActorID: auditActor(ctx), IP: status.IP})
+	}
+	return nil
+}
+
+// AdminBruteForceStatusHandler returns the brute-force state of the client IP
+// given as the :ip path parameter for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminBruteForceStatusHandler(c *gin.Context) {
+	status, err := a.BruteForceStatus(c.Param("ip"))
+	if err != nil {
+		a.ginError(c, ErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// AdminBruteForceStatusHandlerFiber returns the brute-force state of the
+// client IP given as the :ip path parameter for Fiber. Protect it with
+// RequireRoleFiber.
+func (a *AuthKit) AdminBruteForceStatusHandlerFiber(c *fiber.Ctx) error {
+	status, err := a.BruteForceStatus(c.Params("ip"))
+	if err != nil {
+		return a.fiberError(c, ErrorStatus(err), err)
+	}
+
+	return c.JSON(status)
+}
+
+// AdminUnbanIPHandler lifts the ban of the client IP given as the :ip path
+// parameter for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminUnbanIPHandler(c *gin.Context) {
+	if err := a.UnbanIPCtx(WithAuditActor(c.Request.Context(), ginActor(c)), c.Param("ip")); err != nil {
+		a.ginError(c, ErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP unbanned"})
+}
+
+// AdminUnbanIPHandlerFiber lifts the ban of the client IP given as the :ip
+// path parameter for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminUnbanIPHandlerFiber(c *fiber.Ctx) error {
+	if err := a.UnbanIPCtx(WithAuditActor(c.UserContext(), fiberActor(c)), c.Params("ip")); err != nil {
+		return a.fiberError(c, ErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "IP unbanned"})
+}
@@ -0,0 +1,368 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bruteForceServers serve /attempt?status=N behind each framework's
+// BruteForceProtection middleware, answering with status N (default: 401).
+// Each framework is paired with the peer address its requests come from:
+// httptest's RemoteAddr, and the address Fiber's app.Test always reports.
+func bruteForceServers(auth *AuthKit) map[string]struct {
+	peer  string
+	serve func(req *http.Request) *httptest.ResponseRecorder
+} {
+	status := func(query string) int {
+		if status, err := strconv.Atoi(query); err == nil {
+			return status
+		}
+		return http.StatusUnauthorized
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/attempt", auth.BruteForceProtection(), func(c *gin.Context) {
+		c.Status(status(c.Query("status")))
+	})
+	app := fiber.New()
+	app.Get("/attempt", auth.BruteForceProtectionFiber(), func(c *fiber.Ctx) error {
+		return c.SendStatus(status(c.Query("status")))
+	})
+	handler := auth.BruteForceProtectionHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status(r.URL.Query().Get("status")))
+	}))
+
+	return map[string]struct {
+		peer  string
+		serve func(req *http.Request) *httptest.ResponseRecorder
+	}{
+		"gin": {"192.0.2.1", func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}},
+		"fiber": {"0.0.0.0", func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			serveFiber(app, w, req)
+			return w
+		}},
+		"http": {"192.0.2.1", func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w
+		}},
+	}
+}
+
+// attemptRequest returns a request to /attempt?status=N, with an
+// X-Forwarded-For header unless forwardedFor is empty
+func attemptRequest(status int, forwardedFor string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/attempt?status="+strconv.Itoa(status), nil)
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	return req
+}
+
+func TestBruteForceProtection(t *testing.T) {
+	for _, name := range []string{"gin", "fiber", "http"} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			audit := NewMemoryAuditLog(0)
+			auth := newTestKit(t, Config{AuditLogger: audit, BruteForce: &BruteForceConfig{MaxFailures: 3, BaseDelay: time.Second}, Clock: testClock(&now)})
+			defer auth.Close()
+			server := bruteForceServers(auth)[name]
+
+			expect := func(w *httptest.ResponseRecorder, status int, code, retryAfter string) {
+				t.Helper()
+				if w.Code != status || !strings.Contains(w.Body.String(), code) || w.Header().Get("Retry-After") != retryAfter {
+					t.Fatalf("Expected %d %s with Retry-After %q, got %d (%q): %s",
+						status, code, retryAfter, w.Code, w.Header().Get("Retry-After"), w.Body.String())
+				}
+			}
+
+			expect(server.serve(attemptRequest(http.StatusUnauthorized, "")), http.StatusUnauthorized, "", "")
+			expect(server.serve(attemptRequest(http.StatusUnauthorized, "")), http.StatusTooManyRequests, CodeRateLimited, "1")
+
+			// The delay doubles with every failure
+			now = now.Add(time.Second)
+			expect(server.serve(attemptRequest(http.StatusUnauthorized, "")), http.StatusUnauthorized, "", "")
+			now = now.Add(time.Second)
+			expect(server.serve(attemptRequest(http.StatusUnauthorized, "")), http.StatusTooManyRequests, CodeRateLimited, "1")
+			now = now.Add(time.Second)
+			expect(server.serve(attemptRequest(http.StatusUnauthorized, "")), http.StatusUnauthorized, "", "")
+
+			// The third failure bans the IP, whatever X-Forwarded-For claims
+			expect(server.serve(attemptRequest(http.StatusOK, "")), http.StatusTooManyRequests, CodeIPBanned, "3600")
+			expect(server.serve(attemptRequest(http.StatusOK, "198.51.100.7")), http.StatusTooManyRequests, CodeIPBanned, "3600")
+			banned := audit.Query(AuditQuery{Type: AuditIPBanned})
+			if len(banned) != 1 || banned[0].IP != server.peer || banned[0].Metadata["attempts"] != "3" {
+				t.Fatalf("Expected an %s event for %s, got %+v", AuditIPBanned, server.peer, banned)
+			}
+
+			status, err := auth.BruteForceStatus(server.peer)
+			if err != nil || !status.Banned || !status.BannedUntil.Equal(now.Add(time.Hour)) {
+				t.Fatalf("Expected the IP to be banned for an hour, got %+v, %v", status, err)
+			}
+			if err := auth.UnbanIP(server.peer); err != nil {
+				t.Fatal(err)
+			}
+			if unbanned := audit.Query(AuditQuery{Type: AuditIPUnbanned}); len(unbanned) != 1 || unbanned[0].IP != server.peer {
+				t.Errorf("Expected an %s event for %s, got %+v", AuditIPUnbanned, server.peer, unbanned)
+			}
+			expect(server.serve(attemptRequest(http.StatusOK, "")), http.StatusOK, "", "")
+		})
+	}
+}
+
+func TestBruteForceIgnoresUntrustedForwardedFor(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{BruteForce: &BruteForceConfig{MaxFailures: 10}, Clock: testClock(&now)})
+	defer auth.Close()
+
+	for name, server := range bruteForceServers(auth) {
+		t.Run(name, func(t *testing.T) {
+			// Rotating spoofed addresses doesn't dodge the delay
+			if w := server.serve(attemptRequest(http.StatusUnauthorized, "203.0.113.1")); w.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected the first attempt to reach the handler, got %d", w.Code)
+			}
+			w := server.serve(attemptRequest(http.StatusUnauthorized, "203.0.113.2"))
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected the spoofed header to be ignored, got %d: %s", w.Code, w.Body.String())
+			}
+			if status, _ := auth.BruteForceStatus("203.0.113.1"); status.Attempts != 0 {
+				t.Errorf("Expected no attempts counted for the spoofed IP, got %+v", status)
+			}
+			if status, _ := auth.BruteForceStatus(server.peer); status.Attempts != 1 {
+				t.Errorf("Expected the attempt counted for the peer, got %+v", status)
+			}
+		})
+		_ = auth.UnbanIP(server.peer)
+	}
+}
+
+func TestBruteForceTrustedProxies(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 0.0.0.0 is the peer of Fiber's test requests
+	auth := newTestKit(t, Config{BruteForce: &BruteForceConfig{MaxFailures: 10, TrustedProxies: []string{"192.0.2.0/24", "0.0.0.0", "10.0.0.0/8"}}, Clock: testClock(&now)})
+	defer auth.Close()
+
+	for name, server := range bruteForceServers(auth) {
+		t.Run(name, func(t *testing.T) {
+			// Only the hops added by trusted proxies are skipped
+			server.serve(attemptRequest(http.StatusUnauthorized, "198.51.100.9, 203.0.113.1, 10.1.2.3"))
+			if w := server.serve(attemptRequest(http.StatusUnauthorized, "203.0.113.2")); w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected another client behind the proxy to be let through, got %d: %s", w.Code, w.Body.String())
+			}
+			if status, _ := auth.BruteForceStatus("203.0.113.1"); status.Attempts != 1 {
+				t.Errorf("Expected the attempt counted for the forwarded client, got %+v", status)
+			}
+			if status, _ := auth.BruteForceStatus(server.peer); status.Attempts != 0 {
+				t.Errorf("Expected no attempts counted for the proxy, got %+v", status)
+			}
+			_ = auth.UnbanIP("203.0.113.1")
+			_ = auth.UnbanIP("203.0.113.2")
+		})
+	}
+}
+
+func TestBruteForceClientIP(t *testing.T) {
+	b := newBruteForce(nil, (&BruteForceConfig{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}}).withDefaults())
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"untrusted peer", "192.0.2.1:1234", []string{"203.0.113.1"}, "192.0.2.1"},
+		{"trusted peer", "10.0.0.1:1234", []string{"203.0.113.1"}, "203.0.113.1"},
+		{"trusted chain", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.1", "10.0.0.2"}, "203.0.113.1"},
+		{"all hops trusted", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop", "10.0.0.1:1234", []string{"203.0.113.1, unknown"}, "10.0.0.1"},
+		{"no header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"trusted IPv6 peer", "[2001:db8::1]:1234", []string{"2001:DB8::2"}, "2001:db8::2"},
+		{"IPv6 outside the trusted address", "[2001:db8::3]:1234", []string{"203.0.113.1"}, "2001:db8::3"},
+	}
+	for _, tt := range tests {
+		if got := b.clientIP(tt.remoteAddr, tt.forwardedFor); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+// resettingLockoutStore hides MemoryLockoutStore's Forgive
+type resettingLockoutStore struct {
+	LockoutStore
+}
+
+func TestBruteForceSuccessDecaysFailures(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{BruteForce: &BruteForceConfig{MaxFailures: 10}, Clock: testClock(&now)})
+	defer auth.Close()
+	server := bruteForceServers(auth)["gin"]
+
+	attempt := func(status int) {
+		t.Helper()
+		now = now.Add(time.Minute)
+		if w := server.serve(attemptRequest(status, "")); w.Code != status {
+			t.Fatalf("Expected %d, got %d: %s", status, w.Code, w.Body.String())
+		}
+	}
+	attempts := func() int {
+		status, err := auth.BruteForceStatus(server.peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status.Attempts
+	}
+
+	for i := 0; i < 4; i++ {
+		attempt(http.StatusUnauthorized)
+	}
+	attempt(http.StatusOK)
+	if got := attempts(); got != 2 {
+		t.Errorf("Expected a success to forgive itself and half the failures, got %d attempts", got)
+	}
+	attempt(http.StatusInternalServerError)
+	if got := attempts(); got != 2 {
+		t.Errorf("Expected server errors not to count, got %d attempts", got)
+	}
+	attempt(http.StatusOK)
+	attempt(http.StatusOK)
+	if got := attempts(); got != 0 {
+		t.Errorf("Expected successes to clear the failures, got %d attempts", got)
+	}
+
+	// Stores that can't forgive are reset
+	auth.config.LockoutStore = resettingLockoutStore{auth.config.LockoutStore}
+	attempt(http.StatusUnauthorized)
+	attempt(http.StatusUnauthorized)
+	attempt(http.StatusOK)
+	if got := attempts(); got != 0 {
+		t.Errorf("Expected a success to reset the failures, got %d attempts", got)
+	}
+}
+
+func TestBruteForceDelaysFollowSettledFailures(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{BruteForce: &BruteForceConfig{MaxFailures: 10, BaseDelay: time.Second}, Clock: testClock(&now)})
+	defer auth.Close()
+
+	// The first request serves a second one from the same IP while in flight
+	status := http.StatusOK
+	var inner *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = auth.BruteForceProtectionHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner == nil {
+			inner = httptest.NewRecorder()
+			handler.ServeHTTP(inner, attemptRequest(status, ""))
+		}
+		w.WriteHeader(status)
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		inner = nil
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, attemptRequest(status, ""))
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusOK || inner.Code != http.StatusOK {
+		t.Errorf("Expected concurrent successes to pass, got %d and %d: %s", w.Code, inner.Code, inner.Body.String())
+	}
+	status = http.StatusUnauthorized
+	if w := serve(); w.Code != http.StatusUnauthorized || inner.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a request in flight not to delay another, got %d and %d: %s", w.Code, inner.Code, inner.Body.String())
+	}
+	if w := serve(); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected settled failures to delay the next attempt, got %d", w.Code)
+	}
+}
+
+func TestBruteForceAdminHandlers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	audit := NewMemoryAuditLog(0)
+	auth := newTestKit(t, Config{AuditLogger: audit, BruteForce: &BruteForceConfig{MaxFailures: 1}, Clock: testClock(&now)})
+	defer auth.Close()
+	server := bruteForceServers(auth)["gin"]
+	server.serve(attemptRequest(http.StatusUnauthorized, ""))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/bans/:ip", auth.AdminBruteForceStatusHandler)
+	r.DELETE("/admin/bans/:ip", auth.AdminUnbanIPHandler)
+	app := fiber.New()
+	app.Get("/admin/bans/:ip", auth.AdminBruteForceStatusHandlerFiber)
+	app.Delete("/admin/bans/:ip", auth.AdminUnbanIPHandlerFiber)
+	serve := map[string]func(w http.ResponseWriter, req *http.Request){
+		"gin":   r.ServeHTTP,
+		"fiber": func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) },
+	}
+
+	for name, serve := range serve {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serve(w, httptest.NewRequest(http.MethodGet, "/admin/bans/not-an-ip", nil))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), CodeInvalidIPAddress) {
+				t.Errorf("Expected 400 %s, got %d: %s", CodeInvalidIPAddress, w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			serve(w, httptest.NewRequest(http.MethodGet, "/admin/bans/192.0.2.1", nil))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"banned":true`) {
+				t.Fatalf("Expected the ban, got %d: %s", w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			serve(w, httptest.NewRequest(http.MethodDelete, "/admin/bans/192.0.2.1", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected the ban to be lifted, got %d: %s", w.Code, w.Body.String())
+			}
+			if status, _ := auth.BruteForceStatus("192.0.2.1"); status.Banned || status.Attempts != 0 {
+				t.Errorf("Expected the IP to be cleared, got %+v", status)
+			}
+		})
+		server.serve(attemptRequest(http.StatusUnauthorized, ""))
+	}
+
+	if unbanned := audit.Query(AuditQuery{Type: AuditIPUnbanned}); len(unbanned) != 2 {
+		t.Errorf("Expected an %s event per lifted ban, got %+v", AuditIPUnbanned, unbanned)
+	}
+
+	disabled := newTestKit(t, Config{})
+	defer disabled.Close()
+	if _, err := disabled.BruteForceStatus("192.0.2.1"); !errors.Is(err, ErrBruteForceDisabled) {
+		t.Errorf("Expected ErrBruteForceDisabled, got %v", err)
+	}
+}
+
+func TestBruteForceConfig(t *testing.T) {
+	for _, config := range []BruteForceConfig{
+		{MaxFailures: -1},
+		{BanDuration: -time.Hour},
+		{TrustedProxies: []string{"proxy.local"}},
+		{TrustedProxies: []string{"10.0.0.0/33"}},
+	} {
+		config := config
+		if _, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", BruteForce: &config}); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", config, err)
+		}
+	}
+
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected BruteForceProtection to panic without Config.BruteForce")
+		}
+	}()
+	auth.BruteForceProtection()
+}
@@ -0,0 +1,106 @@
+package authkit
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// maxBatchSize is the most items GetUsersByIDs and RegisterUsersBulk take in one call
+const maxBatchSize = 10000
+
+// BulkItemResult is the outcome of one item of a batch. Exactly one of User
+// and Err is set.
+type BulkItemResult struct {
+	Index int       `json:"index"` // Position of the item in the batch
+	Email string    `json:"email"`
+	User  *UserInfo `json:"user,omitempty"`
+	Err   error     `json:"-"`
+	Code  string    `json:"error,omitempty"` // ErrorCode of Err
+}
+
+// BulkResult reports the outcome of every item of a batch, in batch order
+type BulkResult struct {
+	Items     []BulkItemResult `json:"items"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// GetUsersByIDs returns the users with the given IDs, keyed by ID. Unknown
+// IDs are left out of the map rather than failing the call. It returns
+// ErrBatchTooLarge for more than 10000 IDs.
+func (a *AuthKit) GetUsersByIDs(ids []string) (map[string]*UserInfo, error) {
+	a.debugCheck()
+
+	if len(ids) > maxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	users := make(map[string]*UserInfo, len(ids))
+	for _, id := range ids {
+		if user, exists := a.users.get(id); exists {
+			users[id] = a.userToUserInfo(user)
+		}
+	}
+	return users, nil
+}
+
+// RegisterUsersBulk registers each request like AdminCreateUser, reporting
+// failures such as duplicate emails or weak passwords per item instead of
+// aborting the batch. Passwords are hashed concurrently by a bounded pool of
+// workers, and each user is stored under its own short lock, so other
+// requests keep being served during a large import. Users are stored in batch
+// order, so of two requests with the same email the first one wins. It
+// returns ErrBatchTooLarge for more than 10000 requests.
+func (a *AuthKit) RegisterUsersBulk(reqs []RegisterRequest) (*BulkResult, error) {
+	a.debugCheck()
+
+	if len(reqs) > maxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	users := make([]*User, len(reqs))
+	errs := make([]error, len(reqs))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				users[i], errs[i] = a.newUser(context.Background(), reqs[i])
+			}
+		}()
+	}
+	for i := range reqs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := &BulkResult{Items: make([]BulkItemResult, len(reqs))}
+	for i, req := range reqs {
+		item := BulkItemResult{Index: i, Email: req.Email, Err: errs[i]}
+		if item.Err == nil {
+			item.Email = users[i].Email
+			item.User, item.Err = a.registerUser(users[i], users[i].ID)
+		}
+
+		if item.Err != nil {
+			item.Code = ErrorCode(item.Err)
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Items[i] = item
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRegisterUsersBulk(t *testing.T) {
+	var registered []string
+	auth := newTestKit(t, Config{
+		Hooks: Hooks{OnRegister: func(user *UserInfo) error {
+			registered = append(registered, user.Email)
+			return nil
+		}},
+	})
+	defer auth.Close()
+	loginTestUser(t, auth, "existing@example.com")
+	registered = nil
+
+	result, err := auth.RegisterUsersBulk([]RegisterRequest{
+		{Email: "One@Example.com", Password: "password123", Name: "One"},
+		{Email: "existing@example.com", Password: "password123", Name: "Existing"},
+		{Email: "two@example.com", Password: "short", Name: "Weak"},
+		{Email: "not-an-email", Password: "password123", Name: "Invalid"},
+		{Email: "one@example.com", Password: "password123", Name: "Duplicate"},
+		{Email: "three@example.com", Password: "password123", Name: "Three", Role: "editor"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Succeeded != 2 || result.Failed != 4 || len(result.Items) != 6 {
+		t.Fatalf("Expected 2 successes and 4 failures, got %+v", result)
+	}
+	wantCodes := []string{"", CodeUserAlreadyExists, CodeWeakPassword, CodeInvalidEmail, CodeUserAlreadyExists, ""}
+	for i, item := range result.Items {
+		if item.Index != i || item.Code != wantCodes[i] || (item.Code == "") != (item.User != nil) || (item.Err == nil) != (item.User != nil) {
+			t.Errorf("Item %d: expected code %q, got %+v", i, wantCodes[i], item)
+		}
+	}
+	if first := result.Items[0]; first.Email != "one@example.com" || first.User.Name != "One" {
+		t.Errorf("Expected the first of the duplicates to win with the normalized email, got %+v", first)
+	}
+	if third := result.Items[5].User; third.Role != "editor" {
+		t.Errorf("Expected the requested role, got %+v", third)
+	}
+
+	if _, err := auth.LoginUser("three@example.com", "password123"); err != nil {
+		t.Errorf("Expected bulk registered users to log in, got %v", err)
+	}
+	if len(registered) != 2 || registered[0] != "one@example.com" || registered[1] != "three@example.com" {
+		t.Errorf("Expected OnRegister for each registered user in order, got %v", registered)
+	}
+}
+
+func TestRegisterUsersBulkConcurrentHashing(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	reqs := make([]RegisterRequest, 50)
+	for i := range reqs {
+		reqs[i] = RegisterRequest{Email: fmt.Sprintf("user%d@example.com", i), Password: "password123", Name: "Bulk"}
+	}
+	result, err := auth.RegisterUsersBulk(reqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Succeeded != len(reqs) || len(auth.ListUsers()) != len(reqs) {
+		t.Fatalf("Expected every user to be registered, got %d", result.Succeeded)
+	}
+	for i, item := range result.Items {
+		if item.Email != reqs[i].Email {
+			t.Errorf("Expected item %d to be %s, got %s", i, reqs[i].Email, item.Email)
+		}
+	}
+
+	if empty, err := auth.RegisterUsersBulk(nil); err != nil || len(empty.Items) != 0 {
+		t.Errorf("Expected an empty result for an empty batch, got %+v, %v", empty, err)
+	}
+	if _, err := auth.RegisterUsersBulk(make([]RegisterRequest, maxBatchSize+1)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("Expected ErrBatchTooLarge, got %v", err)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	alice := loginTestUser(t, auth, "alice@example.com").User
+	bob := loginTestUser(t, auth, "bob@example.com").User
+
+	users, err := auth.GetUsersByIDs([]string{alice.ID, "missing", bob.ID, alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[alice.ID].Email != "alice@example.com" || users[bob.ID].Email != "bob@example.com" {
+		t.Errorf("Expected alice and bob, got %+v", users)
+	}
+	if _, exists := users["missing"]; exists {
+		t.Error("Expected unknown IDs to be left out")
+	}
+
+	users[alice.ID].Name = "Changed"
+	if stored, _ := auth.GetUserByID(alice.ID); stored.Name == "Changed" {
+		t.Error("Expected the returned users to be copies")
+	}
+	if _, err := auth.GetUsersByIDs(make([]string, maxBatchSize+1)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("Expected ErrBatchTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package authkit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// bearerChallenge returns the RFC 6750 WWW-Authenticate value for a request
+// the middlewares reject with status and code, or "" for rejections that
+// aren't about the bearer token, such as a missing CSRF token
+func (a *AuthKit) bearerChallenge(status int, code string) string {
+	challenge := `Bearer realm="` + a.config.BearerRealm + `"`
+
+	var bearerError string
+	switch {
+	case code == CodeMissingAuthorization || code == CodeNotAuthenticated:
+		// Requests without credentials get no error (RFC 6750 section 3.1)
+		return challenge
+	case code == CodeInvalidAuthorizationFormat:
+		bearerError = "invalid_request"
+	case status == http.StatusUnauthorized:
+		bearerError = "invalid_token"
+	case code == CodeInsufficientPermissions || code == CodeTenantMismatch:
+		bearerError = "insufficient_scope"
+	default:
+		return ""
+	}
+	return challenge + `, error="` + bearerError + `", error_description="` + errorDescription(code) + `"`
+}
+
+// errorDescription returns the English message for code, keeping only the
+// characters RFC 6749 and RFC 6750 allow in error_description
+func errorDescription(code string) string {
+	message := builtinMessages[DefaultLocale][code]
+	if message == "" {
+		message = code
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, message)
+}
@@ -0,0 +1,96 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// permissionHandlers returns an endpoint requiring the "reports:read"
+// permission behind each middleware
+func permissionHandlers(auth *AuthKit) map[string]http.Handler {
+	r := gin.New()
+	r.GET("/me", auth.GinMiddleware(), auth.RequirePermission("reports:read"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	app := fiber.New()
+	app.Get("/me", auth.FiberMiddleware(), auth.RequirePermissionFiber("reports:read"), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  auth.HTTPMiddleware(auth.RequirePermissionHTTP("reports:read")(ok)),
+	}
+}
+
+func TestBearerChallenge(t *testing.T) {
+	auth := newTestKit(t, Config{BearerRealm: "api"})
+	defer auth.Close()
+	valid := loginTestUser(t, auth, "challenge@example.com")
+	revoked := loginTestUser(t, auth, "challenge-revoked@example.com")
+	if err := auth.RevokeToken(revoked.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := auth.GenerateCustomToken("expired-user", nil, -time.Minute)
+
+	tests := []struct {
+		name      string
+		header    string
+		code      int
+		challenge string
+	}{
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"malformed", "Token " + valid.AccessToken, http.StatusUnauthorized, `Bearer realm="api", error="invalid_request", error_description="Invalid authorization header format"`},
+		{"invalid", "Bearer not.a.token", http.StatusUnauthorized, `Bearer realm="api", error="invalid_token", error_description="Invalid token"`},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized, `Bearer realm="api", error="invalid_token", error_description="Token expired"`},
+		{"revoked", "Bearer " + revoked.AccessToken, http.StatusUnauthorized, `Bearer realm="api", error="invalid_token", error_description="Token revoked"`},
+		{"insufficient scope", "Bearer " + valid.AccessToken, http.StatusForbidden, `Bearer realm="api", error="insufficient_scope", error_description="Insufficient permissions"`},
+	}
+	for name, handler := range permissionHandlers(auth) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != tt.code {
+					t.Errorf("Expected %d, got %d", tt.code, w.Code)
+				}
+				if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+					t.Errorf("Expected WWW-Authenticate %q, got %q", tt.challenge, got)
+				}
+			})
+		}
+	}
+}
+
+func TestBearerChallengeOnlyForTokenFailures(t *testing.T) {
+	auth := newTestKit(t, Config{CookieConfig: &CookieConfig{Insecure: true, CSRF: true}})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "challenge-csrf@example.com")
+
+	// A cookie-authenticated request missing its CSRF token isn't a bearer failure
+	for name, handler := range protectedHandlers(auth) {
+		req := httptest.NewRequest(http.MethodPost, "/me", nil)
+		req.AddCookie(&http.Cookie{Name: defaultAccessTokenCookie, Value: tokens.AccessToken})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || w.Header().Get("WWW-Authenticate") != "" {
+			t.Errorf("%s: expected 403 without a challenge, got %d %q", name, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// The realm defaults to the issuer
+	if got := auth.bearerChallenge(http.StatusUnauthorized, CodeMissingAuthorization); got != `Bearer realm="authkit"` {
+		t.Errorf("Expected the issuer as realm, got %q", got)
+	}
+	config := Config{JWTSecret: "test-secret-key-for-testing-only", BearerRealm: `my "api"`}
+	if err := config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a quoted realm, got %v", err)
+	}
+}
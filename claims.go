@@ -0,0 +1,143 @@
+package authkit
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+)
+
+// HasRole reports whether the token was issued for role. It compares the role
+// exactly; use AuthKit.RoleSatisfies to honour Config.RoleHierarchy.
+func (c *Claims) HasRole(role string) bool {
+	return c.Role == role
+}
+
+// HasPermission reports whether the token grants permission, as checked by
+// the RequirePermission middlewares
+func (c *Claims) HasPermission(permission string) bool {
+	return hasPermission(c.Permissions, permission)
+}
+
+// GetMetadataString returns the metadata value under key if it is a string
+func (c *Claims) GetMetadataString(key string) (string, bool) {
+	return metadataString(c.Metadata, key)
+}
+
+// GetMetadataInt returns the metadata value under key if it is a whole
+// number, which tokens decode as float64
+func (c *Claims) GetMetadataInt(key string) (int, bool) {
+	return metadataInt(c.Metadata, key)
+}
+
+// GetMetadataBool returns the metadata value under key if it is a bool
+func (c *Claims) GetMetadataBool(key string) (bool, bool) {
+	return metadataBool(c.Metadata, key)
+}
+
+// GetMetadataStringSlice returns the metadata value under key if it is a list
+// of strings, which tokens decode as []interface{}
+func (c *Claims) GetMetadataStringSlice(key string) ([]string, bool) {
+	return metadataStringSlice(c.Metadata, key)
+}
+
+// HasRole reports whether the user has role, compared exactly like
+// Claims.HasRole
+func (u *UserInfo) HasRole(role string) bool {
+	return u.Role == role
+}
+
+// HasPermission reports whether the user was granted permission
+func (u *UserInfo) HasPermission(permission string) bool {
+	return hasPermission(u.Permissions, permission)
+}
+
+// GetMetadataString is Claims.GetMetadataString for the user's metadata
+func (u *UserInfo) GetMetadataString(key string) (string, bool) {
+	return metadataString(u.Metadata, key)
+}
+
+// GetMetadataInt is Claims.GetMetadataInt for the user's metadata
+func (u *UserInfo) GetMetadataInt(key string) (int, bool) {
+	return metadataInt(u.Metadata, key)
+}
+
+// GetMetadataBool is Claims.GetMetadataBool for the user's metadata
+func (u *UserInfo) GetMetadataBool(key string) (bool, bool) {
+	return metadataBool(u.Metadata, key)
+}
+
+// GetMetadataStringSlice is Claims.GetMetadataStringSlice for the user's metadata
+func (u *UserInfo) GetMetadataStringSlice(key string) ([]string, bool) {
+	return metadataStringSlice(u.Metadata, key)
+}
+
+// hasPermission reports whether permission is among permissions
+func hasPermission(permissions []string, permission string) bool {
+	for _, perm := range permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func metadataString(metadata map[string]interface{}, key string) (string, bool) {
+	value, ok := metadata[key].(string)
+	return value, ok
+}
+
+func metadataBool(metadata map[string]interface{}, key string) (bool, bool) {
+	value, ok := metadata[key].(bool)
+	return value, ok
+}
+
+// metadataInt accepts the Go integer types metadata holds before encoding and
+// the float64 and json.Number it decodes as, rejecting fractions and values
+// out of range
+func metadataInt(metadata map[string]interface{}, key string) (int, bool) {
+	value := metadata[key]
+	if number, ok := value.(json.Number); ok {
+		i, err := number.Int64()
+		if err != nil || int64(int(i)) != i {
+			return 0, false
+		}
+		return int(i), true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := v.Int(); int64(int(i)) == i {
+			return int(i), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := v.Uint(); u <= math.MaxInt {
+			return int(u), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) && f >= math.MinInt && f < -math.MinInt {
+			return int(f), true
+		}
+	}
+	return 0, false
+}
+
+// metadataStringSlice accepts a []string, or a []interface{} of strings as
+// decoded from JSON
+func metadataStringSlice(metadata map[string]interface{}, key string) ([]string, bool) {
+	switch value := metadata[key].(type) {
+	case []string:
+		return append([]string{}, value...), true
+	case []interface{}:
+		strs := make([]string, len(value))
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			strs[i] = s
+		}
+		return strs, true
+	}
+	return nil, false
+}
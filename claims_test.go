@@ -0,0 +1,109 @@
+package authkit
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestClaimsMetadataAccessors(t *testing.T) {
+	auth := newTestKit(t, Config{TokenMetadataFields: []string{AllTokenMetadata}})
+	defer auth.Close()
+
+	_, err := auth.AdminCreateUser(RegisterRequest{Email: "metadata@example.com", Password: "password123", Name: "Test", Metadata: map[string]interface{}{
+		"plan":     "pro",
+		"seats":    25,
+		"balance":  -3,
+		"big":      uint64(1) << 40,
+		"ratio":    1.5,
+		"beta":     true,
+		"teams":    []string{"red", "blue"},
+		"mixed":    []interface{}{"red", 1},
+		"empty":    []string{},
+		"overflow": math.MaxFloat64,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoginUser("metadata@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isFloat := claims.Metadata["seats"].(float64); !isFloat {
+		t.Fatalf("Expected numbers to come back from the token as float64, got %T", claims.Metadata["seats"])
+	}
+
+	// UserInfo is checked both as returned and after a JSON round trip
+	var decoded UserInfo
+	body, _ := json.Marshal(tokens.User)
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	type accessors interface {
+		GetMetadataString(string) (string, bool)
+		GetMetadataInt(string) (int, bool)
+		GetMetadataBool(string) (bool, bool)
+		GetMetadataStringSlice(string) ([]string, bool)
+	}
+	sources := map[string]accessors{"claims": claims, "user": tokens.User, "decoded user": &decoded}
+
+	tests := []struct {
+		name  string
+		get   func(accessors) (interface{}, bool)
+		want  interface{}
+		found bool
+	}{
+		{"string", func(m accessors) (interface{}, bool) { return m.GetMetadataString("plan") }, "pro", true},
+		{"string of a number", func(m accessors) (interface{}, bool) { return m.GetMetadataString("seats") }, "", false},
+		{"int", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("seats") }, 25, true},
+		{"negative int", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("balance") }, -3, true},
+		{"large int", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("big") }, 1 << 40, true},
+		{"int of a fraction", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("ratio") }, 0, false},
+		{"int out of range", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("overflow") }, 0, false},
+		{"int of a string", func(m accessors) (interface{}, bool) { return m.GetMetadataInt("plan") }, 0, false},
+		{"bool", func(m accessors) (interface{}, bool) { return m.GetMetadataBool("beta") }, true, true},
+		{"missing bool", func(m accessors) (interface{}, bool) { return m.GetMetadataBool("missing") }, false, false},
+		{"string slice", func(m accessors) (interface{}, bool) { return m.GetMetadataStringSlice("teams") }, []string{"red", "blue"}, true},
+		{"empty string slice", func(m accessors) (interface{}, bool) { return m.GetMetadataStringSlice("empty") }, []string{}, true},
+		{"mixed slice", func(m accessors) (interface{}, bool) { return m.GetMetadataStringSlice("mixed") }, []string(nil), false},
+	}
+	for source, m := range sources {
+		for _, tt := range tests {
+			t.Run(source+"/"+tt.name, func(t *testing.T) {
+				got, found := tt.get(m)
+				if found != tt.found || !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Expected %#v, %v; got %#v, %v", tt.want, tt.found, got, found)
+				}
+			})
+		}
+	}
+}
+
+func TestClaimsRolesAndPermissions(t *testing.T) {
+	claims := &Claims{Role: "editor", Permissions: []string{"posts:write", "posts:read"}}
+	user := &UserInfo{Role: "editor", Permissions: []string{"posts:write", "posts:read"}}
+
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"claims role", claims.HasRole("editor"), true},
+		{"claims other role", claims.HasRole("admin"), false},
+		{"claims permission", claims.HasPermission("posts:read"), true},
+		{"claims missing permission", claims.HasPermission("posts:delete"), false},
+		{"user role", user.HasRole("editor"), true},
+		{"user permission", user.HasPermission("posts:write"), true},
+		{"user missing permission", user.HasPermission("users:write"), false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
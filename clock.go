@@ -0,0 +1,26 @@
+package authkit
+
+import "time"
+
+// Clock is the time source of an AuthKit, used for token timestamps, stored
+// timestamps and every expiry check. Tests can pass a fake clock to expire
+// tokens and codes without sleeping, see authkittest.FakeClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock
+type ClockFunc func() time.Time
+
+// Now implements Clock
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the default Clock, reading the system time
+var SystemClock Clock = ClockFunc(time.Now)
+
+// now returns the current time of the configured Clock
+func (a *AuthKit) now() time.Time {
+	return a.config.Clock.Now()
+}
@@ -0,0 +1,195 @@
+package authkit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyOp is one public operation exercised by the concurrency matrix
+type concurrencyOp struct {
+	name string
+	run  func(auth *AuthKit, fixture *concurrencyFixture, i int)
+}
+
+// concurrencyFixture holds state shared by the operations in a matrix cell
+type concurrencyFixture struct {
+	userID       string
+	email        string
+	accessToken  string
+	refreshToken string
+}
+
+func concurrencyOps() []concurrencyOp {
+	return []concurrencyOp{
+		{"RegisterUser", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.RegisterUser(RegisterRequest{Email: fmt.Sprintf("reg-%p-%d@example.com", f, i), Password: "password123", Name: "Reg"})
+		}},
+		{"LoginUser", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.LoginUser(f.email, "password123")
+		}},
+		{"GetUserByID", func(a *AuthKit, f *concurrencyFixture, i int) {
+			if user, err := a.GetUserByID(f.userID); err == nil {
+				user.Name = "mutated copy"
+				_ = len(user.Permissions) + len(user.Metadata)
+			}
+		}},
+		{"GetUserByEmail", func(a *AuthKit, f *concurrencyFixture, i int) {
+			if user, err := a.GetUserByEmail(f.email); err == nil {
+				_ = user.Name
+			}
+		}},
+		{"UpdateUser", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.UpdateUser(f.userID, map[string]interface{}{
+				"name":        fmt.Sprintf("name-%d", i),
+				"permissions": []string{"read"},
+				"metadata":    map[string]interface{}{"i": i},
+			})
+		}},
+		{"ListUsers", func(a *AuthKit, f *concurrencyFixture, i int) {
+			for _, user := range a.ListUsers() {
+				_ = user.Name
+			}
+		}},
+		{"DeleteUser", func(a *AuthKit, f *concurrencyFixture, i int) {
+			info, err := a.RegisterUser(RegisterRequest{Email: fmt.Sprintf("del-%p-%d@example.com", f, i), Password: "password123", Name: "Del"})
+			if err == nil {
+				_ = a.DeleteUser(info.ID)
+			}
+		}},
+		{"ValidateToken", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.ValidateToken(f.accessToken)
+		}},
+		{"RefreshToken", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.RefreshToken(f.refreshToken)
+		}},
+		{"GenerateCustomToken", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_, _ = a.GenerateCustomToken(f.userID, map[string]interface{}{"i": i}, time.Minute)
+		}},
+		{"DeleteAccount", func(a *AuthKit, f *concurrencyFixture, i int) {
+			info, err := a.RegisterUser(RegisterRequest{Email: fmt.Sprintf("acct-%p-%d@example.com", f, i), Password: "password123", Name: "Acct"})
+			if err == nil {
+				_ = a.DeleteAccount(info.ID)
+				_, _ = a.RecoverAccount(info.Email, "password123")
+			}
+		}},
+		{"PurgeExpiredAccounts", func(a *AuthKit, f *concurrencyFixture, i int) {
+			a.PurgeExpiredAccounts()
+		}},
+		{"RevokeToken", func(a *AuthKit, f *concurrencyFixture, i int) {
+			token, err := a.GenerateCustomToken(f.userID, nil, time.Minute)
+			if err == nil {
+				_ = a.RevokeToken(token)
+			}
+			_ = a.IsTokenRevoked("unknown")
+		}},
+		{"RevokeAllUserTokens", func(a *AuthKit, f *concurrencyFixture, i int) {
+			_ = a.RevokeAllUserTokens(f.userID)
+		}},
+		{"Nonces", func(a *AuthKit, f *concurrencyFixture, i int) {
+			nonce, err := a.IssueNonce("matrix", time.Minute, map[string]string{"i": "x"})
+			if err == nil {
+				_, _ = a.ConsumeNonce(nonce, "matrix")
+			}
+			_ = a.NonceStats()
+		}},
+	}
+}
+
+// TestConcurrencyMatrix runs every pair of public operations concurrently.
+// It is most useful under the race detector: go test -race -run ConcurrencyMatrix
+func TestConcurrencyMatrix(t *testing.T) {
+	ops := concurrencyOps()
+	const iterations = 5
+
+	for i, first := range ops {
+		for _, second := range ops[i:] {
+			first, second := first, second
+			t.Run(first.name+"/"+second.name, func(t *testing.T) {
+				t.Parallel()
+
+				auth := newTestKit(t, Config{
+					DeletionGracePeriod: time.Hour,
+					DebugChecks:         true,
+				})
+				defer auth.Close()
+
+				fixture := &concurrencyFixture{}
+				fixture.email = fmt.Sprintf("fixture-%p@example.com", fixture)
+				info, err := auth.RegisterUser(RegisterRequest{Email: fixture.email, Password: "password123", Name: "Fixture"})
+				if err != nil {
+					t.Fatalf("Failed to register fixture user: %v", err)
+				}
+				fixture.userID = info.ID
+				tokens, err := auth.LoginUser(fixture.email, "password123")
+				if err != nil {
+					t.Fatalf("Failed to login fixture user: %v", err)
+				}
+				fixture.accessToken = tokens.AccessToken
+				fixture.refreshToken = tokens.RefreshToken
+
+				var wg sync.WaitGroup
+				for n := 0; n < iterations; n++ {
+					wg.Add(2)
+					go func(n int) {
+						defer wg.Done()
+						first.run(auth, fixture, n)
+					}(n)
+					go func(n int) {
+						defer wg.Done()
+						second.run(auth, fixture, n+iterations)
+					}(n)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+func TestReturnedUsersDoNotAliasStore(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	info, _ := auth.RegisterUser(RegisterRequest{Email: "alias@example.com", Password: "password123", Name: "Alias"})
+	_, _ = auth.UpdateUser(info.ID, map[string]interface{}{"permissions": []string{"read"}})
+
+	user, _ := auth.GetUserByID(info.ID)
+	user.Name = "changed"
+	user.Permissions[0] = "admin"
+
+	stored, _ := auth.GetUserByID(info.ID)
+	if stored.Name != "Alias" || stored.Permissions[0] != "read" {
+		t.Errorf("Expected stored user to be unaffected by changes to a returned copy, got %+v", stored)
+	}
+}
+
+func TestDebugChecks(t *testing.T) {
+	t.Run("CloseTwice", func(t *testing.T) {
+		auth := New(Config{JWTSecret: "secret", DebugChecks: true})
+		_ = auth.Close()
+
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic on second Close with DebugChecks")
+			}
+		}()
+		_ = auth.Close()
+	})
+
+	t.Run("CloseTwiceWithoutDebugChecks", func(t *testing.T) {
+		auth := New(Config{JWTSecret: "secret"})
+		_ = auth.Close()
+		_ = auth.Close()
+	})
+
+	t.Run("ConfigMutatedAfterNew", func(t *testing.T) {
+		auth := New(Config{JWTSecret: "secret", DebugChecks: true})
+		auth.config.JanitorInterval = time.Hour // simulates mutation through shared state
+
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic when configuration changes after New")
+			}
+		}()
+		auth.ListUsers()
+	})
+}
@@ -0,0 +1,496 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads a Config from a YAML (.yaml, .yml) or JSON (.json) file.
+// Keys are the snake_case field names, such as jwt_secret or password_policy;
+// unknown keys are rejected so typos surface immediately. ${NAME} is replaced
+// with the environment variable NAME, which must be set, so secrets can stay
+// out of the file. Durations accept everything ParseDuration does.
+//
+// Fields holding code, such as stores, hooks and loggers, can't be read from
+// a file; set them on the returned Config.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	data, err = expandEnv(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+
+	var file configFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+		}
+	default:
+		return Config{}, fmt.Errorf("%w: %s: unsupported config file extension, use .yaml, .yml or .json", ErrInvalidConfig, path)
+	}
+
+	config, err := file.config()
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// envReference matches ${NAME} in config files
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references with environment variables
+func expandEnv(data []byte) ([]byte, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(envReference.FindSubmatch(ref)[1])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return []byte(value)
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// fileDuration is a duration in a config file, parsed with ParseDuration
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalText(text []byte) error {
+	parsed, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = fileDuration(parsed)
+	return nil
+}
+
+// configFile is the schema of LoadConfig files
+type configFile struct {
+	JWTSecret                   string      `yaml:"jwt_secret" json:"jwt_secret"`
+	TokenExpiry                 string      `yaml:"token_expiry" json:"token_expiry"`
+	RefreshExpiry               string      `yaml:"refresh_expiry" json:"refresh_expiry"`
+	RememberMeExpiry            string      `yaml:"remember_me_expiry" json:"remember_me_expiry"`
+	MaxTokenExpiry              string      `yaml:"max_token_expiry" json:"max_token_expiry"`
+	MaxRefreshExpiry            string      `yaml:"max_refresh_expiry" json:"max_refresh_expiry"`
+	BCryptCost                  int         `yaml:"bcrypt_cost" json:"bcrypt_cost"`
+	PasswordHasher              string      `yaml:"password_hasher" json:"password_hasher"`
+	Argon2                      *fileArgon2 `yaml:"argon2" json:"argon2"`
+	RehashOnLogin               bool        `yaml:"rehash_on_login" json:"rehash_on_login"`
+	MaxConcurrentHashes         int         `yaml:"max_concurrent_hashes" json:"max_concurrent_hashes"`
+	MaxHashQueue                int         `yaml:"max_hash_queue" json:"max_hash_queue"`
+	PasswordPepper              string      `yaml:"password_pepper" json:"password_pepper"`
+	PreviousPasswordPeppers     []string    `yaml:"previous_password_peppers" json:"previous_password_peppers"`
+	HIBP                        *fileHIBP   `yaml:"hibp" json:"hibp"`
+	BreachCheckFailClosed       bool        `yaml:"breach_check_fail_closed" json:"breach_check_fail_closed"`
+	AllowedSelfRegisterRoles    []string    `yaml:"allowed_self_register_roles" json:"allowed_self_register_roles"`
+	DowngradeSelfRegisterRoles  bool        `yaml:"downgrade_self_register_roles" json:"downgrade_self_register_roles"`
+	SelfServiceMetadataKeys     []string    `yaml:"self_service_metadata_keys" json:"self_service_metadata_keys"`
+	RateLimitRPM                int         `yaml:"rate_limit_rpm" json:"rate_limit_rpm"`
+	RateLimitByEmail            bool        `yaml:"rate_limit_by_email" json:"rate_limit_by_email"`
+	EmailRequired               bool        `yaml:"email_required" json:"email_required"`
+	CaseSensitiveEmailLocalPart bool        `yaml:"case_sensitive_email_local_part" json:"case_sensitive_email_local_part"`
+	Issuer                      string      `yaml:"issuer" json:"issuer"`
+	Audience                    []string    `yaml:"audience" json:"audience"`
+
+	JWKSURL          string       `yaml:"jwks_url" json:"jwks_url"`
+	JWKSCacheTTL     fileDuration `yaml:"jwks_cache_ttl" json:"jwks_cache_ttl"`
+	RoleClaim        string       `yaml:"role_claim" json:"role_claim"`
+	PermissionsClaim string       `yaml:"permissions_claim" json:"permissions_claim"`
+	BearerRealm      string       `yaml:"bearer_realm" json:"bearer_realm"`
+
+	TokenMetadataFields []string     `yaml:"token_metadata_fields" json:"token_metadata_fields"`
+	MaxTokenSize        int          `yaml:"max_token_size" json:"max_token_size"`
+	TokenCacheSize      int          `yaml:"token_cache_size" json:"token_cache_size"`
+	TokenCacheTTL       fileDuration `yaml:"token_cache_ttl" json:"token_cache_ttl"`
+	UserStatusCacheSize int          `yaml:"user_status_cache_size" json:"user_status_cache_size"`
+	UserStatusCacheTTL  fileDuration `yaml:"user_status_cache_ttl" json:"user_status_cache_ttl"`
+
+	PreviousJWTSecrets  []string `yaml:"previous_jwt_secrets" json:"previous_jwt_secrets"`
+	SigningMethod       string   `yaml:"signing_method" json:"signing_method"`
+	PrivateKeyPEM       string   `yaml:"private_key_pem" json:"private_key_pem"`
+	PublicKeyPEM        string   `yaml:"public_key_pem" json:"public_key_pem"`
+	VerificationKeysPEM []string `yaml:"verification_keys_pem" json:"verification_keys_pem"`
+
+	DeletionGracePeriod fileDuration `yaml:"deletion_grace_period" json:"deletion_grace_period"`
+	SoftDelete          bool         `yaml:"soft_delete" json:"soft_delete"`
+	ReuseDeletedEmails  bool         `yaml:"reuse_deleted_emails" json:"reuse_deleted_emails"`
+	JanitorInterval     fileDuration `yaml:"janitor_interval" json:"janitor_interval"`
+
+	DefaultLocale string       `yaml:"default_locale" json:"default_locale"`
+	SeedFile      string       `yaml:"seed_file" json:"seed_file"`
+	SeedStrategy  SeedStrategy `yaml:"seed_strategy" json:"seed_strategy"`
+
+	PasswordPolicy *filePasswordPolicy `yaml:"password_policy" json:"password_policy"`
+
+	PasswordResetExpiry     fileDuration                    `yaml:"password_reset_expiry" json:"password_reset_expiry"`
+	PasswordResetURL        string                          `yaml:"password_reset_url" json:"password_reset_url"`
+	EmailVerificationExpiry fileDuration                    `yaml:"email_verification_expiry" json:"email_verification_expiry"`
+	EmailVerificationURL    string                          `yaml:"email_verification_url" json:"email_verification_url"`
+	EmailChangeURL          string                          `yaml:"email_change_url" json:"email_change_url"`
+	LoginLinkExpiry         fileDuration                    `yaml:"login_link_expiry" json:"login_link_expiry"`
+	LoginLinkURL            string                          `yaml:"login_link_url" json:"login_link_url"`
+	AutoCreateOnMagicLink   bool                            `yaml:"auto_create_on_magic_link" json:"auto_create_on_magic_link"`
+	LinkIdentitiesByEmail   bool                            `yaml:"link_identities_by_email" json:"link_identities_by_email"`
+	SMTP                    *fileSMTP                       `yaml:"smtp" json:"smtp"`
+	EmailTemplates          map[EmailKind]fileEmailTemplate `yaml:"email_templates" json:"email_templates"`
+	NewLoginAlerts          bool                            `yaml:"new_login_alerts" json:"new_login_alerts"`
+
+	MaxLoginAttempts int          `yaml:"max_login_attempts" json:"max_login_attempts"`
+	LockoutWindow    fileDuration `yaml:"lockout_window" json:"lockout_window"`
+	LockoutDuration  fileDuration `yaml:"lockout_duration" json:"lockout_duration"`
+	LoginHistorySize int          `yaml:"login_history_size" json:"login_history_size"`
+
+	RefreshAbsoluteLifetime fileDuration `yaml:"refresh_absolute_lifetime" json:"refresh_absolute_lifetime"`
+	RefreshIdleTimeout      fileDuration `yaml:"refresh_idle_timeout" json:"refresh_idle_timeout"`
+
+	Webhooks         *fileWebhooks `yaml:"webhooks" json:"webhooks"`
+	TraceHashUserIDs bool          `yaml:"trace_hash_user_ids" json:"trace_hash_user_ids"`
+
+	EncryptionKey      string              `yaml:"encryption_key" json:"encryption_key"`
+	MFATokenExpiry     fileDuration        `yaml:"mfa_token_expiry" json:"mfa_token_expiry"`
+	ServiceAccountRole string              `yaml:"service_account_role" json:"service_account_role"`
+	RoleHierarchy      map[string][]string `yaml:"role_hierarchy" json:"role_hierarchy"`
+	PolicySubject      PolicySubject       `yaml:"policy_subject" json:"policy_subject"`
+	GRPCPublicMethods  []string            `yaml:"grpc_public_methods" json:"grpc_public_methods"`
+	Cookie             *fileCookie         `yaml:"cookie" json:"cookie"`
+	Tenant             *fileTenant         `yaml:"tenant" json:"tenant"`
+	SlidingSession     *fileSlidingSession `yaml:"sliding_session" json:"sliding_session"`
+	OIDC               *fileOIDC           `yaml:"oidc" json:"oidc"`
+	TokenExchange      *fileTokenExchange  `yaml:"token_exchange" json:"token_exchange"`
+	BruteForce         *fileBruteForce     `yaml:"brute_force" json:"brute_force"`
+
+	OptionalAuthIgnoreInvalid  bool `yaml:"optional_auth_ignore_invalid" json:"optional_auth_ignore_invalid"`
+	KeepTokensOnPasswordChange bool `yaml:"keep_tokens_on_password_change" json:"keep_tokens_on_password_change"`
+	ValidateUserOnRequest      bool `yaml:"validate_user_on_request" json:"validate_user_on_request"`
+	CheckUserOnRequest         bool `yaml:"check_user_on_request" json:"check_user_on_request"` // Deprecated alias of validate_user_on_request
+	DebugChecks                bool `yaml:"debug_checks" json:"debug_checks"`
+}
+
+type filePasswordPolicy struct {
+	Disabled         bool `yaml:"disabled" json:"disabled"`
+	MinLength        int  `yaml:"min_length" json:"min_length"`
+	MaxLength        int  `yaml:"max_length" json:"max_length"`
+	RequireUppercase bool `yaml:"require_uppercase" json:"require_uppercase"`
+	RequireLowercase bool `yaml:"require_lowercase" json:"require_lowercase"`
+	RequireDigit     bool `yaml:"require_digit" json:"require_digit"`
+	RequireSymbol    bool `yaml:"require_symbol" json:"require_symbol"`
+}
+
+type fileArgon2 struct {
+	Memory      uint32 `yaml:"memory" json:"memory"`
+	Time        uint32 `yaml:"time" json:"time"`
+	Parallelism uint8  `yaml:"parallelism" json:"parallelism"`
+}
+
+// fileHIBP enables a HIBPChecker; an empty hibp section uses the defaults
+type fileHIBP struct {
+	URL     string       `yaml:"url" json:"url"`
+	Timeout fileDuration `yaml:"timeout" json:"timeout"`
+}
+
+type fileSMTP struct {
+	Host     string       `yaml:"host" json:"host"`
+	Port     int          `yaml:"port" json:"port"`
+	Username string       `yaml:"username" json:"username"`
+	Password string       `yaml:"password" json:"password"`
+	From     string       `yaml:"from" json:"from"`
+	TLS      SMTPTLSMode  `yaml:"tls" json:"tls"`
+	Timeout  fileDuration `yaml:"timeout" json:"timeout"`
+}
+
+type fileEmailTemplate struct {
+	Subject string `yaml:"subject" json:"subject"`
+	HTML    string `yaml:"html" json:"html"`
+	Text    string `yaml:"text" json:"text"`
+}
+
+type fileWebhooks struct {
+	Endpoints []struct {
+		URL    string           `yaml:"url" json:"url"`
+		Secret string           `yaml:"secret" json:"secret"`
+		Events []AuditEventType `yaml:"events" json:"events"`
+	} `yaml:"endpoints" json:"endpoints"`
+	MaxAttempts    int          `yaml:"max_attempts" json:"max_attempts"`
+	InitialBackoff fileDuration `yaml:"initial_backoff" json:"initial_backoff"`
+	MaxBackoff     fileDuration `yaml:"max_backoff" json:"max_backoff"`
+	QueueSize      int          `yaml:"queue_size" json:"queue_size"`
+}
+
+type fileCookie struct {
+	AccessTokenName  string `yaml:"access_token_name" json:"access_token_name"`
+	RefreshTokenName string `yaml:"refresh_token_name" json:"refresh_token_name"`
+	Domain           string `yaml:"domain" json:"domain"`
+	Path             string `yaml:"path" json:"path"`
+	SameSite         string `yaml:"same_site" json:"same_site"` // "lax", "strict" or "none"
+	Insecure         bool   `yaml:"insecure" json:"insecure"`
+	CSRF             bool   `yaml:"csrf" json:"csrf"`
+	CSRFCookieName   string `yaml:"csrf_cookie_name" json:"csrf_cookie_name"`
+	CSRFHeaderName   string `yaml:"csrf_header_name" json:"csrf_header_name"`
+}
+
+// fileTenant sets a TenantResolver; FromHost can only be set in Go
+type fileTenant struct {
+	PathParam string `yaml:"path_param" json:"path_param"`
+	Header    string `yaml:"header" json:"header"`
+	Required  bool   `yaml:"required" json:"required"`
+}
+
+type fileSlidingSession struct {
+	Window      float64      `yaml:"window" json:"window"`
+	MaxLifetime fileDuration `yaml:"max_lifetime" json:"max_lifetime"`
+	Header      string       `yaml:"header" json:"header"`
+}
+
+type fileOIDC struct {
+	ClientID         string `yaml:"client_id" json:"client_id"`
+	TokenEndpoint    string `yaml:"token_endpoint" json:"token_endpoint"`
+	UserInfoEndpoint string `yaml:"userinfo_endpoint" json:"userinfo_endpoint"`
+	JWKSURI          string `yaml:"jwks_uri" json:"jwks_uri"`
+}
+
+// fileTokenExchange sets a TokenExchangeConfig. Providers with a
+// firebase_project_id start from FirebaseProvider.
+type fileTokenExchange struct {
+	Providers []struct {
+		Name              string   `yaml:"name" json:"name"`
+		Issuer            string   `yaml:"issuer" json:"issuer"`
+		Audience          []string `yaml:"audience" json:"audience"`
+		JWKSURL           string   `yaml:"jwks_url" json:"jwks_url"`
+		LinkedOnly        bool     `yaml:"linked_only" json:"linked_only"`
+		FirebaseProjectID string   `yaml:"firebase_project_id" json:"firebase_project_id"`
+	} `yaml:"providers" json:"providers"`
+	ReplayWindow fileDuration `yaml:"replay_window" json:"replay_window"`
+}
+
+type fileBruteForce struct {
+	MaxFailures    int          `yaml:"max_failures" json:"max_failures"`
+	Window         fileDuration `yaml:"window" json:"window"`
+	BanDuration    fileDuration `yaml:"ban_duration" json:"ban_duration"`
+	BaseDelay      fileDuration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay       fileDuration `yaml:"max_delay" json:"max_delay"`
+	TrustedProxies []string     `yaml:"trusted_proxies" json:"trusted_proxies"`
+}
+
+// sameSiteModes maps the same_site values of config files
+var sameSiteModes = map[string]http.SameSite{
+	"":       0,
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// config converts the file to a Config
+func (f *configFile) config() (Config, error) {
+	config := Config{
+		JWTSecret:                   f.JWTSecret,
+		TokenExpiry:                 f.TokenExpiry,
+		RefreshExpiry:               f.RefreshExpiry,
+		RememberMeExpiry:            f.RememberMeExpiry,
+		MaxTokenExpiry:              f.MaxTokenExpiry,
+		MaxRefreshExpiry:            f.MaxRefreshExpiry,
+		RefreshAbsoluteLifetime:     time.Duration(f.RefreshAbsoluteLifetime),
+		RefreshIdleTimeout:          time.Duration(f.RefreshIdleTimeout),
+		BCryptCost:                  f.BCryptCost,
+		PasswordHasher:              f.PasswordHasher,
+		RehashOnLogin:               f.RehashOnLogin,
+		MaxConcurrentHashes:         f.MaxConcurrentHashes,
+		MaxHashQueue:                f.MaxHashQueue,
+		PasswordPepper:              f.PasswordPepper,
+		PreviousPasswordPeppers:     f.PreviousPasswordPeppers,
+		BreachCheckFailClosed:       f.BreachCheckFailClosed,
+		AllowedSelfRegisterRoles:    f.AllowedSelfRegisterRoles,
+		DowngradeSelfRegisterRoles:  f.DowngradeSelfRegisterRoles,
+		SelfServiceMetadataKeys:     f.SelfServiceMetadataKeys,
+		RateLimitRPM:                f.RateLimitRPM,
+		RateLimitByEmail:            f.RateLimitByEmail,
+		EmailRequired:               f.EmailRequired,
+		CaseSensitiveEmailLocalPart: f.CaseSensitiveEmailLocalPart,
+		Issuer:                      f.Issuer,
+		Audience:                    f.Audience,
+		JWKSURL:                     f.JWKSURL,
+		JWKSCacheTTL:                time.Duration(f.JWKSCacheTTL),
+		RoleClaim:                   f.RoleClaim,
+		PermissionsClaim:            f.PermissionsClaim,
+		BearerRealm:                 f.BearerRealm,
+		TokenMetadataFields:         f.TokenMetadataFields,
+		MaxTokenSize:                f.MaxTokenSize,
+		TokenCacheSize:              f.TokenCacheSize,
+		TokenCacheTTL:               time.Duration(f.TokenCacheTTL),
+		UserStatusCacheSize:         f.UserStatusCacheSize,
+		UserStatusCacheTTL:          time.Duration(f.UserStatusCacheTTL),
+		PreviousJWTSecrets:          f.PreviousJWTSecrets,
+		SigningMethod:               f.SigningMethod,
+		PrivateKeyPEM:               f.PrivateKeyPEM,
+		PublicKeyPEM:                f.PublicKeyPEM,
+		VerificationKeysPEM:         f.VerificationKeysPEM,
+		DeletionGracePeriod:         time.Duration(f.DeletionGracePeriod),
+		SoftDelete:                  f.SoftDelete,
+		ReuseDeletedEmails:          f.ReuseDeletedEmails,
+		JanitorInterval:             time.Duration(f.JanitorInterval),
+		DefaultLocale:               f.DefaultLocale,
+		SeedFile:                    f.SeedFile,
+		SeedStrategy:                f.SeedStrategy,
+		PasswordResetExpiry:         time.Duration(f.PasswordResetExpiry),
+		PasswordResetURL:            f.PasswordResetURL,
+		EmailVerificationExpiry:     time.Duration(f.EmailVerificationExpiry),
+		EmailVerificationURL:        f.EmailVerificationURL,
+		EmailChangeURL:              f.EmailChangeURL,
+		LoginLinkExpiry:             time.Duration(f.LoginLinkExpiry),
+		LoginLinkURL:                f.LoginLinkURL,
+		AutoCreateOnMagicLink:       f.AutoCreateOnMagicLink,
+		LinkIdentitiesByEmail:       f.LinkIdentitiesByEmail,
+		NewLoginAlerts:              f.NewLoginAlerts,
+		MaxLoginAttempts:            f.MaxLoginAttempts,
+		LockoutWindow:               time.Duration(f.LockoutWindow),
+		LockoutDuration:             time.Duration(f.LockoutDuration),
+		LoginHistorySize:            f.LoginHistorySize,
+		TraceHashUserIDs:            f.TraceHashUserIDs,
+		EncryptionKey:               f.EncryptionKey,
+		MFATokenExpiry:              time.Duration(f.MFATokenExpiry),
+		ServiceAccountRole:          f.ServiceAccountRole,
+		RoleHierarchy:               f.RoleHierarchy,
+		PolicySubject:               f.PolicySubject,
+		GRPCPublicMethods:           f.GRPCPublicMethods,
+		OptionalAuthIgnoreInvalid:   f.OptionalAuthIgnoreInvalid,
+		KeepTokensOnPasswordChange:  f.KeepTokensOnPasswordChange,
+		ValidateUserOnRequest:       f.ValidateUserOnRequest,
+		CheckUserOnRequest:          f.CheckUserOnRequest,
+		DebugChecks:                 f.DebugChecks,
+	}
+
+	if p := f.PasswordPolicy; p != nil {
+		config.PasswordPolicy = PasswordPolicy{
+			Disabled:         p.Disabled,
+			MinLength:        p.MinLength,
+			MaxLength:        p.MaxLength,
+			RequireUppercase: p.RequireUppercase,
+			RequireLowercase: p.RequireLowercase,
+			RequireDigit:     p.RequireDigit,
+			RequireSymbol:    p.RequireSymbol,
+		}
+	}
+	if a := f.Argon2; a != nil {
+		config.Argon2 = Argon2Params{Memory: a.Memory, Time: a.Time, Parallelism: a.Parallelism}
+	}
+	if h := f.HIBP; h != nil {
+		config.BreachChecker = &HIBPChecker{URL: h.URL, Timeout: time.Duration(h.Timeout)}
+	}
+	if s := f.SMTP; s != nil {
+		config.EmailSender = &SMTPSender{
+			Host:     s.Host,
+			Port:     s.Port,
+			Username: s.Username,
+			Password: s.Password,
+			From:     s.From,
+			TLS:      s.TLS,
+			Timeout:  time.Duration(s.Timeout),
+		}
+	}
+	if len(f.EmailTemplates) > 0 {
+		config.EmailTemplates = make(map[EmailKind]EmailTemplate, len(f.EmailTemplates))
+		for kind, t := range f.EmailTemplates {
+			config.EmailTemplates[kind] = EmailTemplate{Subject: t.Subject, HTML: t.HTML, Text: t.Text}
+		}
+	}
+	if w := f.Webhooks; w != nil {
+		config.Webhooks = &WebhookConfig{
+			MaxAttempts:    w.MaxAttempts,
+			InitialBackoff: time.Duration(w.InitialBackoff),
+			MaxBackoff:     time.Duration(w.MaxBackoff),
+			QueueSize:      w.QueueSize,
+		}
+		for _, e := range w.Endpoints {
+			config.Webhooks.Endpoints = append(config.Webhooks.Endpoints, WebhookEndpoint{URL: e.URL, Secret: e.Secret, Events: e.Events})
+		}
+	}
+	if c := f.Cookie; c != nil {
+		sameSite, ok := sameSiteModes[strings.ToLower(c.SameSite)]
+		if !ok {
+			return Config{}, fmt.Errorf("invalid cookie.same_site %q, use lax, strict or none", c.SameSite)
+		}
+		config.CookieConfig = &CookieConfig{
+			AccessTokenName:  c.AccessTokenName,
+			RefreshTokenName: c.RefreshTokenName,
+			Domain:           c.Domain,
+			Path:             c.Path,
+			SameSite:         sameSite,
+			Insecure:         c.Insecure,
+			CSRF:             c.CSRF,
+			CSRFCookieName:   c.CSRFCookieName,
+			CSRFHeaderName:   c.CSRFHeaderName,
+		}
+	}
+	if t := f.Tenant; t != nil {
+		config.TenantResolver = &TenantResolver{PathParam: t.PathParam, Header: t.Header, Required: t.Required}
+	}
+	if s := f.SlidingSession; s != nil {
+		config.SlidingSession = &SlidingSession{Window: s.Window, MaxLifetime: time.Duration(s.MaxLifetime), Header: s.Header}
+	}
+	if o := f.OIDC; o != nil {
+		config.OIDC = &OIDCConfig{ClientID: o.ClientID, TokenEndpoint: o.TokenEndpoint, UserInfoEndpoint: o.UserInfoEndpoint, JWKSURI: o.JWKSURI}
+	}
+	if t := f.TokenExchange; t != nil {
+		config.TokenExchange = &TokenExchangeConfig{ReplayWindow: time.Duration(t.ReplayWindow)}
+		for _, p := range t.Providers {
+			var provider ExternalTokenProvider
+			if p.FirebaseProjectID != "" {
+				provider = FirebaseProvider(p.FirebaseProjectID)
+			}
+			if p.Name != "" {
+				provider.Name = p.Name
+			}
+			if p.Issuer != "" {
+				provider.Issuer = p.Issuer
+			}
+			if len(p.Audience) > 0 {
+				provider.Audience = p.Audience
+			}
+			if p.JWKSURL != "" {
+				provider.JWKSURL = p.JWKSURL
+			}
+			provider.LinkedOnly = p.LinkedOnly
+			config.TokenExchange.Providers = append(config.TokenExchange.Providers, provider)
+		}
+	}
+	if b := f.BruteForce; b != nil {
+		config.BruteForce = &BruteForceConfig{
+			MaxFailures:    b.MaxFailures,
+			Window:         time.Duration(b.Window),
+			BanDuration:    time.Duration(b.BanDuration),
+			BaseDelay:      time.Duration(b.BaseDelay),
+			MaxDelay:       time.Duration(b.MaxDelay),
+			TrustedProxies: b.TrustedProxies,
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,165 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file named name to a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	t.Setenv("AUTHKIT_TEST_SECRET", "secret-from-the-environment")
+	path := writeConfigFile(t, "authkit.yaml", `
+jwt_secret: ${AUTHKIT_TEST_SECRET}
+token_expiry: 15m
+refresh_expiry: 30d
+max_refresh_expiry: 90d
+refresh_absolute_lifetime: 30d
+refresh_idle_timeout: 7d
+bcrypt_cost: 4
+audience: [api, admin]
+lockout_window: 1h
+password_policy:
+  min_length: 12
+  require_digit: true
+cookie:
+  same_site: strict
+  csrf: true
+tenant:
+  header: X-Tenant-ID
+  required: true
+sliding_session:
+  window: 0.25
+  max_lifetime: 12h
+webhooks:
+  endpoints:
+    - url: https://hooks.example.com/auth
+      secret: ${AUTHKIT_TEST_SECRET}
+      events: [login.failed]
+  initial_backoff: 2s
+role_hierarchy:
+  admin: [user]
+policy_subject: role
+token_exchange:
+  providers:
+    - firebase_project_id: my-project
+      linked_only: true
+  replay_window: 30s
+brute_force:
+  max_failures: 10
+  ban_duration: 2h
+  trusted_proxies: [10.0.0.0/8]
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.JWTSecret != "secret-from-the-environment" || config.TokenExpiry != "15m" || config.RefreshExpiry != "30d" {
+		t.Errorf("Expected the interpolated secret and expiries, got %q, %q, %q", config.JWTSecret, config.TokenExpiry, config.RefreshExpiry)
+	}
+	if config.MaxRefreshExpiry != "90d" || config.RefreshAbsoluteLifetime != 30*24*time.Hour || config.RefreshIdleTimeout != 7*24*time.Hour {
+		t.Errorf("Expected the refresh limits, got %q, %v, %v", config.MaxRefreshExpiry, config.RefreshAbsoluteLifetime, config.RefreshIdleTimeout)
+	}
+	if len(config.Audience) != 2 || config.LockoutWindow != time.Hour {
+		t.Errorf("Expected the audience and lockout window, got %v and %v", config.Audience, config.LockoutWindow)
+	}
+	if config.PasswordPolicy.MinLength != 12 || !config.PasswordPolicy.RequireDigit {
+		t.Errorf("Expected the password policy, got %+v", config.PasswordPolicy)
+	}
+	if config.CookieConfig == nil || config.CookieConfig.SameSite != http.SameSiteStrictMode || !config.CookieConfig.CSRF {
+		t.Errorf("Expected the cookie config, got %+v", config.CookieConfig)
+	}
+	if config.TenantResolver == nil || config.TenantResolver.Header != "X-Tenant-ID" || !config.TenantResolver.Required {
+		t.Errorf("Expected the tenant resolver, got %+v", config.TenantResolver)
+	}
+	if config.SlidingSession == nil || config.SlidingSession.Window != 0.25 || config.SlidingSession.MaxLifetime != 12*time.Hour {
+		t.Errorf("Expected the sliding session config, got %+v", config.SlidingSession)
+	}
+	if w := config.Webhooks; w == nil || len(w.Endpoints) != 1 || w.Endpoints[0].Secret != "secret-from-the-environment" ||
+		w.Endpoints[0].Events[0] != AuditLoginFailed || w.InitialBackoff != 2*time.Second {
+		t.Errorf("Expected the webhook config, got %+v", config.Webhooks)
+	}
+	if config.RoleHierarchy["admin"][0] != "user" {
+		t.Errorf("Expected the role hierarchy, got %v", config.RoleHierarchy)
+	}
+	if config.PolicySubject != PolicySubjectRole {
+		t.Errorf("Expected the policy subject, got %q", config.PolicySubject)
+	}
+	if x := config.TokenExchange; x == nil || len(x.Providers) != 1 || x.Providers[0].Issuer != "https://securetoken.google.com/my-project" ||
+		!x.Providers[0].LinkedOnly || x.ReplayWindow != 30*time.Second {
+		t.Errorf("Expected the token exchange config, got %+v", config.TokenExchange)
+	}
+	if b := config.BruteForce; b == nil || b.MaxFailures != 10 || b.BanDuration != 2*time.Hour || b.TrustedProxies[0] != "10.0.0.0/8" {
+		t.Errorf("Expected the brute-force config, got %+v", config.BruteForce)
+	}
+
+	auth, err := NewValidated(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.Close()
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeConfigFile(t, "authkit.json", `{
+		"jwt_secret": "json-secret",
+		"mfa_token_expiry": "2m",
+		"smtp": {"host": "smtp.example.com", "from": "no-reply@example.com", "timeout": "10s"}
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.JWTSecret != "json-secret" || config.MFATokenExpiry != 2*time.Minute {
+		t.Errorf("Expected the secret and MFA token expiry, got %q and %v", config.JWTSecret, config.MFATokenExpiry)
+	}
+	if sender, ok := config.EmailSender.(*SMTPSender); !ok || sender.Host != "smtp.example.com" || sender.Timeout != 10*time.Second {
+		t.Errorf("Expected an SMTP sender, got %+v", config.EmailSender)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"unknown YAML key", "c.yaml", "jwt_secret: s\ntoken_expiry: 1h\nbcrypt_cots: 4\n", "bcrypt_cots"},
+		{"unknown nested key", "c.yml", "password_policy:\n  min_lenght: 10\n", "min_lenght"},
+		{"unknown JSON key", "c.json", `{"jwt_secret": "s", "tokenExpiry": "1h"}`, "tokenExpiry"},
+		{"undefined variable", "c.yaml", "jwt_secret: ${AUTHKIT_TEST_UNDEFINED}\n", "AUTHKIT_TEST_UNDEFINED"},
+		{"invalid duration", "c.yaml", "lockout_window: soon\n", "soon"},
+		{"invalid same site", "c.yaml", "cookie:\n  same_site: sometimes\n", "same_site"},
+		{"invalid value", "c.yaml", "token_expiry: -1h\n", "TokenExpiry"},
+		{"invalid trusted proxy", "c.yaml", "brute_force:\n  trusted_proxies: [proxy.local]\n", "proxy.local"},
+		{"unsupported extension", "c.toml", "jwt_secret = 's'\n", "extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfigFile(t, tt.file, tt.content))
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected ErrInvalidConfig mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing file error, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContextVariantsCancelled(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "ctx@example.com")
+	userID := tokens.User.ID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := auth.RegisterUserCtx(ctx, RegisterRequest{Email: "new@example.com", Password: "password123", Name: "New"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from RegisterUserCtx, got %v", err)
+	}
+	if _, err := auth.GetUserByEmail("new@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected no user to be registered, got %v", err)
+	}
+
+	if _, err := auth.LoginUserCtx(ctx, "ctx@example.com", "wrong-password"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from LoginUserCtx, got %v", err)
+	}
+	if history, _ := auth.GetLoginHistory(userID, 0); len(history) != 1 {
+		t.Errorf("Expected the cancelled login not to be recorded, got %+v", history)
+	}
+
+	if err := auth.ChangePasswordCtx(ctx, userID, "password123", "new-password123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from ChangePasswordCtx, got %v", err)
+	}
+	if _, err := auth.RefreshTokenCtx(ctx, tokens.RefreshToken); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from RefreshTokenCtx, got %v", err)
+	}
+	if _, err := auth.GetUserByIDCtx(ctx, userID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from GetUserByIDCtx, got %v", err)
+	}
+	if _, err := auth.UpdateUserCtx(ctx, userID, map[string]interface{}{"name": "Changed"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from UpdateUserCtx, got %v", err)
+	}
+	if err := auth.DeleteUserCtx(ctx, userID); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from DeleteUserCtx, got %v", err)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, err := auth.SearchUsersCtx(expired, "ctx", ListOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded from SearchUsersCtx, got %v", err)
+	}
+
+	// Nothing changed, and the context-free methods keep working
+	if user, err := auth.GetUserByID(userID); err != nil || user.Name != "Test" {
+		t.Errorf("Expected the user to be untouched, got %+v, %v", user, err)
+	}
+	if _, err := auth.LoginUser("ctx@example.com", "password123"); err != nil {
+		t.Errorf("Expected LoginUser to work, got %v", err)
+	}
+}
+
+// contextKey is a context key for TestSearcherReceivesContext
+type contextKey struct{}
+
+// contextSearcher is a UserSearcher recording the context it was called with
+type contextSearcher struct {
+	value interface{}
+}
+
+func (s *contextSearcher) SearchUsers(ctx context.Context, query string, opts ListOptions) (*UserPage, error) {
+	s.value = ctx.Value(contextKey{})
+	return &UserPage{Users: []*UserInfo{}}, nil
+}
+
+func TestSearcherReceivesContext(t *testing.T) {
+	searcher := &contextSearcher{}
+	auth := newTestKit(t, Config{UserSearcher: searcher})
+	defer auth.Close()
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "trace-123")
+	if _, err := auth.SearchUsersCtx(ctx, "query", ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if searcher.value != "trace-123" {
+		t.Errorf("Expected the searcher to get the caller's context, got %v", searcher.value)
+	}
+}
+
+func TestHandlersPassRequestContext(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"gone@example.com","password":"password123","name":"Gone"}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code == http.StatusCreated {
+		t.Errorf("Expected a cancelled request to fail, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := auth.GetUserByEmail("gone@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected no user to be registered for a cancelled request, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// Default cookie names (see CookieConfig)
+const (
+	defaultAccessTokenCookie  = "access_token"
+	defaultRefreshTokenCookie = "refresh_token"
+	defaultCSRFCookie         = "csrf_token"
+	defaultCSRFHeader         = "X-CSRF-Token"
+)
+
+// CookieConfig makes the bundled handlers deliver tokens as HttpOnly cookies
+// instead of in the response body, for browser apps that shouldn't expose
+// tokens to JavaScript. The middleware reads the access token cookie when a
+// request has no Authorization header.
+type CookieConfig struct {
+	// AccessTokenName and RefreshTokenName name the token cookies
+	// (default: "access_token" and "refresh_token")
+	AccessTokenName  string
+	RefreshTokenName string
+	// Domain and Path scope the cookies (default: host-only, "/")
+	Domain string
+	Path   string
+	// SameSite is the cookies' SameSite mode (default: http.SameSiteLaxMode)
+	SameSite http.SameSite
+	// Insecure drops the Secure attribute, for local development over plain HTTP
+	Insecure bool
+
+	// CSRF enables double-submit CSRF protection: the handlers also set a
+	// cookie readable by JavaScript, and requests authenticated by cookie with
+	// an unsafe method must echo its value in the CSRFHeaderName header
+	CSRF bool
+	// CSRFCookieName names the CSRF cookie (default: "csrf_token")
+	CSRFCookieName string
+	// CSRFHeaderName is the header carrying the CSRF token (default: "X-CSRF-Token")
+	CSRFHeaderName string
+}
+
+// withDefaults returns a copy of the cookie config with defaults filled in
+func (c CookieConfig) withDefaults() *CookieConfig {
+	if c.AccessTokenName == "" {
+		c.AccessTokenName = defaultAccessTokenCookie
+	}
+	if c.RefreshTokenName == "" {
+		c.RefreshTokenName = defaultRefreshTokenCookie
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	if c.CSRFCookieName == "" {
+		c.CSRFCookieName = defaultCSRFCookie
+	}
+	if c.CSRFHeaderName == "" {
+		c.CSRFHeaderName = defaultCSRFHeader
+	}
+	return &c
+}
+
+// GenerateCSRFToken returns a random token for double-submit CSRF protection
+func GenerateCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// tokenCookies returns the cookies that deliver tokens, plus a fresh CSRF
+// cookie when CSRF protection is enabled
+func (a *AuthKit) tokenCookies(tokens *TokenResponse) ([]*http.Cookie, error) {
+	cfg := a.config.CookieConfig
+	// The cookies last as long as the tokens, which may have been issued
+	// with other than the configured lifetimes, see LoginOptions
+	accessAge, refreshAge := int(tokens.ExpiresIn), int(tokens.RefreshExpiresIn)
+	if accessAge == 0 {
+		accessAge = int(a.accessExpiry.Seconds())
+	}
+	if refreshAge == 0 {
+		refreshAge = int(a.refreshExpiry.Seconds())
+	}
+	cookies := []*http.Cookie{
+		a.cookie(cfg.AccessTokenName, tokens.AccessToken, accessAge, true),
+	}
+	if tokens.RefreshToken != "" {
+		cookies = append(cookies, a.cookie(cfg.RefreshTokenName, tokens.RefreshToken, refreshAge, true))
+	}
+	if cfg.CSRF {
+		csrfToken, err := GenerateCSRFToken()
+		if err != nil {
+			return nil, err
+		}
+		// Not HttpOnly: the client reads it and echoes it in the CSRF header
+		cookies = append(cookies, a.cookie(cfg.CSRFCookieName, csrfToken, refreshAge, false))
+	}
+	return cookies, nil
+}
+
+// clearedCookies returns cookies that delete the token and CSRF cookies
+func (a *AuthKit) clearedCookies() []*http.Cookie {
+	cfg := a.config.CookieConfig
+	cookies := []*http.Cookie{
+		a.cookie(cfg.AccessTokenName, "", -1, true),
+		a.cookie(cfg.RefreshTokenName, "", -1, true),
+	}
+	if cfg.CSRF {
+		cookies = append(cookies, a.cookie(cfg.CSRFCookieName, "", -1, false))
+	}
+	return cookies
+}
+
+// cookie builds a cookie with the configured scope and attributes
+func (a *AuthKit) cookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	cfg := a.config.CookieConfig
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cfg.Path,
+		Domain:   cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   !cfg.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: cfg.SameSite,
+	}
+}
+
+// withoutTokens returns a copy of tokens for the response body when the
+// tokens themselves travel in cookies
+func withoutTokens(tokens *TokenResponse) *TokenResponse {
+	body := *tokens
+	body.AccessToken = ""
+	body.RefreshToken = ""
+	return &body
+}
+
+// validCSRF checks a request authenticated by cookie against the double-submit
+// CSRF token. Safe methods and configs without CSRF protection always pass.
+func (a *AuthKit) validCSRF(method, cookieValue, headerValue string) bool {
+	if !a.config.CookieConfig.CSRF {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return cookieValue != "" && subtle.ConstantTimeCompare([]byte(cookieValue), []byte(headerValue)) == 1
+}
@@ -0,0 +1,215 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// responseCookies indexes the cookies set by a response by name
+func responseCookies(header http.Header) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestCookieTransportGin(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1, CookieConfig: &CookieConfig{CSRF: true}})
+	defer auth.Close()
+	loginTestUser(t, auth, "cookie@example.com")
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/refresh", auth.RefreshHandler)
+	r.POST("/logout", auth.LogoutHandler)
+	r.GET("/profile", auth.GinMiddleware(), auth.ProfileHandler)
+	r.POST("/profile", auth.GinMiddleware(), auth.ProfileHandler)
+
+	send := func(method, path, body string, cookies map[string]*http.Cookie, csrf string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/login", `{"email":"cookie@example.com","password":"password123"}`, nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	var body TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if body.AccessToken != "" || body.RefreshToken != "" || body.User == nil {
+		t.Errorf("Expected the body to carry the user but no tokens, got %s", w.Body.String())
+	}
+	cookies := responseCookies(w.Header())
+	access, refresh, csrf := cookies["access_token"], cookies["refresh_token"], cookies["csrf_token"]
+	if access == nil || refresh == nil || csrf == nil {
+		t.Fatalf("Expected token and CSRF cookies, got %v", w.Header()["Set-Cookie"])
+	}
+	if !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteLaxMode || access.Path != "/" {
+		t.Errorf("Expected a secure HttpOnly Lax access cookie, got %+v", access)
+	}
+	if csrf.HttpOnly {
+		t.Error("Expected the CSRF cookie to be readable by JavaScript")
+	}
+
+	if w := send(http.MethodGet, "/profile", "", cookies, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a GET with the cookie to pass, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodPost, "/profile", "", cookies, ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodeInvalidCSRFToken) {
+		t.Errorf("Expected a POST without the CSRF header to fail, got %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodPost, "/profile", "", cookies, "wrong"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a POST with the wrong CSRF token to fail, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/profile", "", cookies, csrf.Value); w.Code != http.StatusOK {
+		t.Errorf("Expected a POST with the CSRF header to pass, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := send(http.MethodPost, "/refresh", "", cookies, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cookie refresh without the CSRF header to fail, got %d", w.Code)
+	}
+	w = send(http.MethodPost, "/refresh", "", cookies, csrf.Value)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected a cookie refresh to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	refreshed := responseCookies(w.Header())
+	if refreshed["access_token"] == nil || refreshed["access_token"].Value == access.Value {
+		t.Errorf("Expected the refresh to set a new access cookie, got %v", w.Header()["Set-Cookie"])
+	}
+
+	w = send(http.MethodPost, "/logout", "", refreshed, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d %s", w.Code, w.Body.String())
+	}
+	for _, name := range []string{"access_token", "refresh_token", "csrf_token"} {
+		if cleared := responseCookies(w.Header())[name]; cleared == nil || cleared.MaxAge >= 0 {
+			t.Errorf("Expected logout to clear the %s cookie, got %+v", name, cleared)
+		}
+	}
+	if _, err := auth.ValidateToken(refreshed["access_token"].Value); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected logout to revoke the access cookie, got %v", err)
+	}
+	if _, err := auth.RefreshToken(refreshed["refresh_token"].Value); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected logout to revoke the refresh cookie, got %v", err)
+	}
+}
+
+func TestCookieTransportFiber(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1, CookieConfig: &CookieConfig{CSRF: true}})
+	defer auth.Close()
+	loginTestUser(t, auth, "fibercookie@example.com")
+
+	app := fiber.New()
+	app.Post("/login", auth.LoginHandlerFiber)
+	app.Post("/logout", auth.LogoutHandlerFiber)
+	app.Get("/profile", auth.FiberMiddleware(), auth.ProfileHandlerFiber)
+	app.Post("/profile", auth.FiberMiddleware(), auth.ProfileHandlerFiber)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"fibercookie@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %v %v", resp, err)
+	}
+	cookies := responseCookies(resp.Header)
+	access, csrf := cookies["access_token"], cookies["csrf_token"]
+	if access == nil || cookies["refresh_token"] == nil || csrf == nil {
+		t.Fatalf("Expected token and CSRF cookies, got %v", resp.Header["Set-Cookie"])
+	}
+	if !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected a secure HttpOnly Lax access cookie, got %+v", access)
+	}
+
+	send := func(method, path, csrfHeader string) *http.Response {
+		req := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if csrfHeader != "" {
+			req.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		resp, _ := app.Test(req)
+		return resp
+	}
+	if resp := send(http.MethodGet, "/profile", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a GET with the cookie to pass, got %d", resp.StatusCode)
+	}
+	if resp := send(http.MethodPost, "/profile", ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a POST without the CSRF header to fail, got %d", resp.StatusCode)
+	}
+	if resp := send(http.MethodPost, "/profile", csrf.Value); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a POST with the CSRF header to pass, got %d", resp.StatusCode)
+	}
+
+	resp = send(http.MethodPost, "/logout", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d", resp.StatusCode)
+	}
+	if cleared := responseCookies(resp.Header)["access_token"]; cleared == nil || cleared.Value != "" {
+		t.Errorf("Expected logout to clear the access cookie, got %v", resp.Header["Set-Cookie"])
+	}
+	if _, err := auth.ValidateToken(access.Value); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected logout to revoke the access cookie, got %v", err)
+	}
+}
+
+func TestCookieTransportHTTP(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1, CookieConfig: &CookieConfig{CSRF: true}})
+	defer auth.Close()
+	loginTestUser(t, auth, "httpcookie@example.com")
+	mux := newHTTPTestMux(auth)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"httpcookie@example.com","password":"password123"}`))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	cookies := responseCookies(w.Header())
+	var body TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || cookies["access_token"] == nil || body.AccessToken != "" {
+		t.Fatalf("Expected login to set cookies instead of body tokens, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.AddCookie(cookies["access_token"])
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a GET with the cookie to pass, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCookieConfigValidation(t *testing.T) {
+	_, err := NewValidated(Config{
+		JWTSecret:    "test-secret-key-for-testing-only",
+		CookieConfig: &CookieConfig{SameSite: http.SameSiteNoneMode, Insecure: true},
+	})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected insecure SameSite=None cookies to be rejected, got %v", err)
+	}
+
+	cfg := &CookieConfig{AccessTokenName: "at"}
+	auth := newTestKit(t, Config{CookieConfig: cfg})
+	defer auth.Close()
+	if auth.config.CookieConfig == cfg || cfg.RefreshTokenName != "" {
+		t.Error("Expected the cookie config to be copied, not modified")
+	}
+	if got := auth.config.CookieConfig; got.AccessTokenName != "at" || got.RefreshTokenName != "refresh_token" || got.CSRFHeaderName != "X-CSRF-Token" {
+		t.Errorf("Expected defaults to fill unset names, got %+v", got)
+	}
+}
@@ -0,0 +1,22 @@
+package authkit
+
+import "fmt"
+
+// debugCheck panics if DebugChecks is enabled and the configuration captured by
+// New has changed, which can only happen through slices, maps or pointers shared
+// with the caller's Config value.
+func (a *AuthKit) debugCheck() {
+	if !a.config.DebugChecks {
+		return
+	}
+
+	if configFingerprint(a.config) != a.fingerprint {
+		panic("authkit: Config was mutated after New")
+	}
+}
+
+// configFingerprint renders the configuration, following nested values, so that
+// in-place mutations of shared data show up as a difference
+func configFingerprint(config Config) string {
+	return fmt.Sprintf("%#v", configFields(config))
+}
@@ -0,0 +1,27 @@
+// Package authkit provides user registration, password hashing, JWT issuance
+// and validation, plus ready-made middleware and handlers for Gin and Fiber.
+//
+// # Concurrency
+//
+// An *AuthKit is safe for concurrent use by multiple goroutines once New has
+// returned. The contract is:
+//
+//   - All exported methods may be called concurrently with each other.
+//   - Token operations (GenerateAccessToken, ValidateToken, GenerateCustomToken)
+//     take at most a brief read lock on user storage, to compare token versions.
+//   - RotateSigningKey and RemoveVerificationKey may run while tokens are being
+//     signed and validated; each token sees either the old or the new key set.
+//   - Lookups (GetUserByID, GetUserByEmail) return copies. Mutating a returned
+//     *User has no effect on stored state; use UpdateUser instead.
+//   - ListUsers returns a point-in-time snapshot. Users registered or deleted
+//     while it runs are either fully included or fully excluded.
+//   - Writes to a single user are linearizable: an UpdateUser that returns
+//     before a GetUserByID starts is always visible to it.
+//   - Password hashing in RegisterUser and LoginUser happens outside the store
+//     lock, so a slow bcrypt cost does not stall other operations.
+//   - The Config passed to New is copied. Callers must not mutate slices or maps
+//     it shares with the copy afterwards; set Config.DebugChecks to turn such
+//     misuse (and calling Close more than once) into a panic during development.
+//   - Close stops background janitors and should be called once, after all
+//     other use of the instance has finished.
+package authkit
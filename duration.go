@@ -0,0 +1,81 @@
+package authkit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses a duration string like time.ParseDuration, but also
+// understands the "d" (day) and "w" (week) units, e.g. "7d", "2w" or "1d12h".
+// Durations beyond the range of time.Duration are an error, as they are for
+// time.ParseDuration.
+func ParseDuration(s string) (time.Duration, error) {
+	input := strings.TrimSpace(s)
+	if input == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var total time.Duration
+	rest := input
+	for rest != "" {
+		// Find the next day/week unit, everything before it goes to time.ParseDuration
+		idx := strings.IndexAny(rest, "dw")
+		if idx < 0 {
+			d, err := time.ParseDuration(rest)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return addDuration(s, total, d)
+		}
+
+		// Split the numeric part of the day/week component from any leading standard units
+		start := idx
+		for start > 0 && (rest[start-1] >= '0' && rest[start-1] <= '9' || rest[start-1] == '.') {
+			start--
+		}
+		if start == idx {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		if start > 0 {
+			d, err := time.ParseDuration(rest[:start])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			if total, err = addDuration(s, total, d); err != nil {
+				return 0, err
+			}
+		}
+
+		value, err := strconv.ParseFloat(rest[start:idx], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit := 24 * time.Hour
+		if rest[idx] == 'w' {
+			unit = 7 * 24 * time.Hour
+		}
+		product := value * float64(unit)
+		if product >= math.MaxInt64 {
+			return 0, fmt.Errorf("invalid duration %q: out of range", s)
+		}
+		if total, err = addDuration(s, total, time.Duration(product)); err != nil {
+			return 0, err
+		}
+		rest = rest[idx+1:]
+	}
+
+	return total, nil
+}
+
+// addDuration returns total+d, or an error naming the input s if the sum
+// overflows time.Duration
+func addDuration(s string, total, d time.Duration) (time.Duration, error) {
+	sum := total + d
+	if d > 0 && sum < total || d < 0 && sum > total {
+		return 0, fmt.Errorf("invalid duration %q: out of range", s)
+	}
+	return sum, nil
+}
@@ -0,0 +1,99 @@
+package authkit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"90m", 90 * time.Minute, false},
+		{"24h", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1w2d", 9 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"garbage", 0, true},
+		{"d", 0, true},
+		{"7dd", 0, true},
+		{"12x", 0, true},
+		{"15250w", 15250 * 7 * 24 * time.Hour, false},
+		{"200000000w", 0, true},
+		{"15251w", 0, true},
+		{"106751d23h47m17s", 0, true},
+		{"2562047h1d", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q): expected error, got %v", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDuration(%q): unexpected error %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseDuration(%q): expected %v, got %v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestNewRejectsInvalidDurations(t *testing.T) {
+	_, err := NewValidated(Config{JWTSecret: "secret", TokenExpiry: "garbage"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for invalid TokenExpiry, got %v", err)
+	}
+
+	_, err = NewValidated(Config{JWTSecret: "secret", RefreshExpiry: "7 days"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for invalid RefreshExpiry, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected New to panic on invalid configuration")
+		}
+	}()
+	New(Config{JWTSecret: "secret", TokenExpiry: "soon"})
+}
+
+func TestExpiresInUsesDayUnits(t *testing.T) {
+	auth := New(Config{
+		JWTSecret:     "test-secret",
+		TokenExpiry:   "1d",
+		RefreshExpiry: "2w",
+		BCryptCost:    4,
+	})
+
+	_, err := auth.RegisterUser(RegisterRequest{Email: "days@example.com", Password: "password123", Name: "Days"})
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	tokens, err := auth.LoginUser("days@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected successful login, got %v", err)
+	}
+	if tokens.ExpiresIn != int64((24 * time.Hour).Seconds()) {
+		t.Errorf("Expected ExpiresIn of one day, got %d", tokens.ExpiresIn)
+	}
+
+	refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected successful refresh, got %v", err)
+	}
+	if refreshed.ExpiresIn != int64((24 * time.Hour).Seconds()) {
+		t.Errorf("Expected refreshed ExpiresIn of one day, got %d", refreshed.ExpiresIn)
+	}
+}
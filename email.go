@@ -0,0 +1,263 @@
+package authkit
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// EmailSender delivers email on behalf of AuthKit's flows
+type EmailSender interface {
+	Send(to, subject, htmlBody, textBody string) error
+}
+
+// EmailKind identifies a built-in email
+type EmailKind string
+
+// Built-in emails, see Config.EmailTemplates
+const (
+	EmailVerification  EmailKind = "verification"
+	EmailPasswordReset EmailKind = "password_reset"
+	EmailNewLogin      EmailKind = "new_login"
+	EmailLoginLink     EmailKind = "login_link"
+	EmailChange        EmailKind = "email_change"
+)
+
+// EmailTemplate overrides a built-in email. Subject and Text are text/template
+// sources and HTML an html/template source, all executed with EmailData. Empty
+// fields keep the built-in version.
+type EmailTemplate struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// EmailData is the data email templates are executed with
+type EmailData struct {
+	User      *UserInfo
+	Token     string    // Verification, reset or login token, empty for alerts
+	Link      string    // Token link built from the configured URL, empty if none is set
+	ExpiresAt time.Time // When Token expires
+	Time      time.Time // When the email was triggered
+}
+
+// defaultEmailTemplates are the built-in emails
+var defaultEmailTemplates = map[EmailKind]EmailTemplate{
+	EmailVerification: {
+		Subject: "Verify your email address",
+		HTML: `<p>Hi {{.User.Name}},</p>
+{{if .Link}}<p>Please verify your email address by opening <a href="{{.Link}}">this link</a>.</p>{{else}}<p>Your verification code is <strong>{{.Token}}</strong>.</p>{{end}}
+<p>It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.</p>`,
+		Text: `Hi {{.User.Name}},
+
+{{if .Link}}Please verify your email address by opening this link: {{.Link}}{{else}}Your verification code is {{.Token}}{{end}}
+
+It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.
+`,
+	},
+	EmailPasswordReset: {
+		Subject: "Reset your password",
+		HTML: `<p>Hi {{.User.Name}},</p>
+{{if .Link}}<p>You can choose a new password by opening <a href="{{.Link}}">this link</a>.</p>{{else}}<p>Your password reset code is <strong>{{.Token}}</strong>.</p>{{end}}
+<p>It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you didn't ask to reset your password, you can ignore this email.</p>`,
+		Text: `Hi {{.User.Name}},
+
+{{if .Link}}You can choose a new password by opening this link: {{.Link}}{{else}}Your password reset code is {{.Token}}{{end}}
+
+It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you didn't ask to reset your password, you can ignore this email.
+`,
+	},
+	EmailLoginLink: {
+		Subject: "Your sign-in link",
+		HTML: `<p>Hi{{if .User.Name}} {{.User.Name}}{{end}},</p>
+{{if .Link}}<p>You can sign in by opening <a href="{{.Link}}">this link</a>.</p>{{else}}<p>Your sign-in code is <strong>{{.Token}}</strong>.</p>{{end}}
+<p>It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}} and can only be used once. If you didn't ask to sign in, you can ignore this email.</p>`,
+		Text: `Hi{{if .User.Name}} {{.User.Name}}{{end}},
+
+{{if .Link}}You can sign in by opening this link: {{.Link}}{{else}}Your sign-in code is {{.Token}}{{end}}
+
+It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}} and can only be used once. If you didn't ask to sign in, you can ignore this email.
+`,
+	},
+	EmailChange: {
+		Subject: "Confirm your new email address",
+		HTML: `<p>Hi {{.User.Name}},</p>
+{{if .Link}}<p>Please confirm this is your new email address by opening <a href="{{.Link}}">this link</a>.</p>{{else}}<p>Your email change code is <strong>{{.Token}}</strong>.</p>{{end}}
+<p>It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you didn't ask to change your email, you can ignore this email.</p>`,
+		Text: `Hi {{.User.Name}},
+
+{{if .Link}}Please confirm this is your new email address by opening this link: {{.Link}}{{else}}Your email change code is {{.Token}}{{end}}
+
+It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. If you didn't ask to change your email, you can ignore this email.
+`,
+	},
+	EmailNewLogin: {
+		Subject: "New sign-in to your account",
+		HTML: `<p>Hi {{.User.Name}},</p>
+<p>Your account was signed in to at {{.Time.Format "2006-01-02 15:04 MST"}}. If this wasn't you, please change your password.</p>`,
+		Text: `Hi {{.User.Name}},
+
+Your account was signed in to at {{.Time.Format "2006-01-02 15:04 MST"}}. If this wasn't you, please change your password.
+`,
+	},
+}
+
+// emailTemplate is a parsed EmailTemplate
+type emailTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+// parseEmailTemplates parses the built-in emails with the configured overrides applied
+func parseEmailTemplates(overrides map[EmailKind]EmailTemplate) (map[EmailKind]*emailTemplate, error) {
+	for kind := range overrides {
+		if _, ok := defaultEmailTemplates[kind]; !ok {
+			return nil, fmt.Errorf("%w: unknown email template %q", ErrInvalidConfig, kind)
+		}
+	}
+
+	templates := make(map[EmailKind]*emailTemplate, len(defaultEmailTemplates))
+	for kind, source := range defaultEmailTemplates {
+		override := overrides[kind]
+		if override.Subject != "" {
+			source.Subject = override.Subject
+		}
+		if override.HTML != "" {
+			source.HTML = override.HTML
+		}
+		if override.Text != "" {
+			source.Text = override.Text
+		}
+
+		var parsed emailTemplate
+		var err error
+		if parsed.subject, err = texttemplate.New("subject").Parse(source.Subject); err != nil {
+			return nil, fmt.Errorf("%w: email template %q subject: %v", ErrInvalidConfig, kind, err)
+		}
+		if parsed.html, err = htmltemplate.New("html").Parse(source.HTML); err != nil {
+			return nil, fmt.Errorf("%w: email template %q HTML: %v", ErrInvalidConfig, kind, err)
+		}
+		if parsed.text, err = texttemplate.New("text").Parse(source.Text); err != nil {
+			return nil, fmt.Errorf("%w: email template %q text: %v", ErrInvalidConfig, kind, err)
+		}
+		templates[kind] = &parsed
+	}
+	return templates, nil
+}
+
+// sendEmail renders a built-in email and sends it with Config.EmailSender
+func (a *AuthKit) sendEmail(kind EmailKind, data EmailData) error {
+	if a.config.EmailSender == nil {
+		return ErrNoEmailSender
+	}
+
+	tmpl := a.emailTemplates[kind]
+	var subject, html, text bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return fmt.Errorf("rendering %s email: %w", kind, err)
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return fmt.Errorf("rendering %s email: %w", kind, err)
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return fmt.Errorf("rendering %s email: %w", kind, err)
+	}
+
+	// A subject is a single header line
+	line := strings.Join(strings.Fields(subject.String()), " ")
+	return a.config.EmailSender.Send(data.User.Email, line, html.String(), text.String())
+}
+
+// tokenLink appends token to base as the "token" query parameter
+func tokenLink(base, token string) string {
+	if base == "" {
+		return ""
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
+
+// deliverToken hands a token to the flow's callback if one is configured, and
+// otherwise emails it using the built-in template of the given kind
+func (a *AuthKit) deliverToken(kind EmailKind, callback func(*UserInfo, string) error, linkBase string, expiry time.Duration, user *UserInfo, token string) error {
+	if callback != nil {
+		return callback(user, token)
+	}
+
+	now := a.now()
+	return a.sendEmail(kind, EmailData{
+		User:      user,
+		Token:     token,
+		Link:      tokenLink(linkBase, token),
+		ExpiresAt: now.Add(expiry),
+		Time:      now,
+	})
+}
+
+// sendNewLoginAlert emails the user about a successful login in the
+// background, so a slow mail server doesn't hold up the login
+func (a *AuthKit) sendNewLoginAlert(user *UserInfo) {
+	if !a.config.NewLoginAlerts || a.config.EmailSender == nil || a.closed.Load() {
+		return
+	}
+
+	data := EmailData{User: user, Time: a.now()}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		_ = a.sendEmail(EmailNewLogin, data)
+	}()
+}
+
+// EmailMessage is an email recorded by MemoryEmailSender
+type EmailMessage struct {
+	To       string
+	Subject  string
+	HTMLBody string
+	TextBody string
+}
+
+// MemoryEmailSender records messages instead of sending them, for tests and development
+type MemoryEmailSender struct {
+	mutex    sync.Mutex
+	messages []EmailMessage
+}
+
+// NewMemoryEmailSender creates an empty recording sender
+func NewMemoryEmailSender() *MemoryEmailSender {
+	return &MemoryEmailSender{}
+}
+
+// Send records the message
+func (s *MemoryEmailSender) Send(to, subject, htmlBody, textBody string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages = append(s.messages, EmailMessage{To: to, Subject: subject, HTMLBody: htmlBody, TextBody: textBody})
+	return nil
+}
+
+// Messages returns a copy of the recorded messages, oldest first
+func (s *MemoryEmailSender) Messages() []EmailMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]EmailMessage(nil), s.messages...)
+}
+
+// Reset forgets the recorded messages
+func (s *MemoryEmailSender) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages = nil
+}
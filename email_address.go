@@ -0,0 +1,58 @@
+package authkit
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail returns the form AuthKit stores and compares emails in:
+// surrounding whitespace trimmed and the domain lowercased, along with the
+// local part unless Config.CaseSensitiveEmailLocalPart is set. Anything but a
+// bare address such as "bob@example.com" returns ErrInvalidEmail.
+func (a *AuthKit) NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if !a.config.CaseSensitiveEmailLocalPart {
+		local = strings.ToLower(local)
+	}
+	return local + "@" + domain, nil
+}
+
+// emailKey returns the form emails are compared in. Emails stored before
+// normalization was introduced may be mixed-case, so both sides of a
+// comparison go through it. Invalid emails are only trimmed.
+func (a *AuthKit) emailKey(email string) string {
+	if normalized, err := a.NormalizeEmail(email); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(email)
+}
+
+// findUserByEmail returns the stored user of the tenant with the given email,
+// or nil. Soft-deleted users are skipped. The result must not be modified.
+func (a *AuthKit) findUserByEmail(tenantID, email string) *User {
+	for _, user := range a.users.withEmail(a.emailKey(email)) {
+		if user.TenantID == tenantID && user.DeletedAt == nil {
+			return user
+		}
+	}
+	return nil
+}
+
+// emailTaken reports whether a user of the tenant other than userID has the
+// email. Soft-deleted users keep their email unless Config.ReuseDeletedEmails
+// is set. Callers must hold a.mutex.
+func (a *AuthKit) emailTaken(tenantID, email, userID string) bool {
+	for _, user := range a.users.withEmail(a.emailKey(email)) {
+		if user.TenantID == tenantID && user.ID != userID && (user.DeletedAt == nil || !a.config.ReuseDeletedEmails) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package authkit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	caseSensitive := newTestKit(t, Config{CaseSensitiveEmailLocalPart: true})
+	defer caseSensitive.Close()
+
+	cases := []struct {
+		email, want, wantCaseSensitive string
+	}{
+		{"bob@example.com", "bob@example.com", "bob@example.com"},
+		{"Bob@Example.COM", "bob@example.com", "Bob@example.com"},
+		{"  bob@example.com\t\n", "bob@example.com", "bob@example.com"},
+		{"bob+tag@sub.example.com", "bob+tag@sub.example.com", "bob+tag@sub.example.com"},
+	}
+	for _, tc := range cases {
+		if got, err := auth.NormalizeEmail(tc.email); err != nil || got != tc.want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want %q", tc.email, got, err, tc.want)
+		}
+		if got, err := caseSensitive.NormalizeEmail(tc.email); err != nil || got != tc.wantCaseSensitive {
+			t.Errorf("NormalizeEmail(%q) with a case-sensitive local part = %q, %v; want %q", tc.email, got, err, tc.wantCaseSensitive)
+		}
+	}
+
+	for _, email := range []string{"", "bob", "bob@", "@example.com", "Bob <bob@example.com>", "bob@example.com, eve@example.com", "bob @example.com"} {
+		if _, err := auth.NormalizeEmail(email); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("NormalizeEmail(%q): expected ErrInvalidEmail, got %v", email, err)
+		}
+	}
+}
+
+func TestEmailCaseInsensitiveAccounts(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	user, err := auth.RegisterUser(RegisterRequest{Email: " Bob@Example.com ", Password: "password123", Name: "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "bob@example.com" {
+		t.Errorf("Expected the stored email to be normalized, got %q", user.Email)
+	}
+
+	for _, email := range []string{"bob@example.com", "BOB@EXAMPLE.COM", "  bob@example.com  "} {
+		if _, err := auth.LoginUser(email, "password123"); err != nil {
+			t.Errorf("LoginUser(%q): %v", email, err)
+		}
+		if found, err := auth.GetUserByEmail(email); err != nil || found.ID != user.ID {
+			t.Errorf("GetUserByEmail(%q): %+v %v", email, found, err)
+		}
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "BOB@example.com", Password: "password123", Name: "Bob 2"}); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected a case variant to be a duplicate, got %v", err)
+	}
+
+	for _, email := range []string{"not-an-email", "Bob <bob2@example.com>", "bob2@"} {
+		if _, err := auth.RegisterUser(RegisterRequest{Email: email, Password: "password123", Name: "Invalid"}); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("RegisterUser(%q): expected ErrInvalidEmail, got %v", email, err)
+		}
+	}
+}
+
+func TestLegacyMixedCaseEmails(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	// A user stored before emails were normalized
+	hash, _ := auth.HashPassword("password123")
+	now := time.Now()
+	legacy := &User{ID: "legacy", Email: "Legacy@Example.com", Password: hash, Role: "user", EmailVerified: true, CreatedAt: now, UpdatedAt: now}
+	if err := auth.insertUser(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.LoginUser("legacy@example.com", "password123"); err != nil {
+		t.Errorf("Expected the legacy user to log in with a case variant, got %v", err)
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "legacy@example.com", Password: "password123", Name: "Dup"}); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected the legacy email to count as registered, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emailChangeConfig requires email addresses and records the email change
+// tokens it sends in sent, by address
+func emailChangeConfig(sent map[string]string) Config {
+	return Config{
+		RateLimitRPM:  -1,
+		EmailRequired: true,
+		SendEmailChange: func(user *UserInfo, token string) error {
+			sent[user.Email] = token
+			return nil
+		},
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	sent := make(map[string]string)
+	auth := newTestKit(t, emailChangeConfig(sent))
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "old@example.com", Password: "password123", Name: "Old"})
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "taken@example.com", Password: "password123", Name: "Taken"})
+
+	cases := map[string]error{
+		"not-an-email":            ErrInvalidEmail,
+		"Bob <bob@example.com>":   ErrInvalidEmail,
+		"taken@example.com":       ErrUserAlreadyExists,
+		"new@example.com\r\nBcc:": ErrInvalidEmail,
+	}
+	for email, want := range cases {
+		if err := auth.RequestEmailChange(user.ID, email); err != want {
+			t.Errorf("RequestEmailChange(%q): expected %v, got %v", email, want, err)
+		}
+	}
+	if err := auth.RequestEmailChange("missing", "new@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := auth.RequestEmailChange(user.ID, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := sent["new@example.com"]
+	if token == "" {
+		t.Fatalf("Expected the token to be sent to the new address, got %v", sent)
+	}
+	if stored, _ := auth.GetUserByID(user.ID); stored.Email != "old@example.com" {
+		t.Errorf("Expected the email to change only on confirmation, got %q", stored.Email)
+	}
+
+	if err := auth.ConfirmEmailChange(token); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := auth.GetUserByID(user.ID)
+	if stored.Email != "new@example.com" || !stored.EmailVerified {
+		t.Errorf("Expected a verified new email, got %q verified=%v", stored.Email, stored.EmailVerified)
+	}
+	if _, err := auth.LoginUser("new@example.com", "password123"); err != nil {
+		t.Errorf("Expected login with the new email, got %v", err)
+	}
+	if _, err := auth.LoginUser("old@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old email to stop working, got %v", err)
+	}
+	if err := auth.ConfirmEmailChange(token); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected the token to be single-use, got %v", err)
+	}
+}
+
+func TestEmailChangeConflicts(t *testing.T) {
+	sent := make(map[string]string)
+	auth := newTestKit(t, emailChangeConfig(sent))
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "first@example.com", Password: "password123", Name: "First"})
+
+	// Two pending changes: the second is stale once the first is confirmed
+	_ = auth.RequestEmailChange(user.ID, "second@example.com")
+	_ = auth.RequestEmailChange(user.ID, "third@example.com")
+	if err := auth.ConfirmEmailChange(sent["second@example.com"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.ConfirmEmailChange(sent["third@example.com"]); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected a token for a previous email to be rejected, got %v", err)
+	}
+
+	// The new email was registered between request and confirmation
+	_ = auth.RequestEmailChange(user.ID, "race@example.com")
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "race@example.com", Password: "password123", Name: "Race"})
+	if err := auth.ConfirmEmailChange(sent["race@example.com"]); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
+	}
+}
+
+func TestForceSetEmail(t *testing.T) {
+	auth := newTestKit(t, emailChangeConfig(map[string]string{}))
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "force@example.com", Password: "password123", Name: "Force"})
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other"})
+
+	if err := auth.ForceSetEmail(user.ID, "other@example.com"); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
+	}
+	if err := auth.ForceSetEmail(user.ID, "nope"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Expected ErrInvalidEmail, got %v", err)
+	}
+	if err := auth.ForceSetEmail("missing", "forced@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := auth.ForceSetEmail(user.ID, "force@example.com"); err != nil {
+		t.Errorf("Expected setting the current email to succeed, got %v", err)
+	}
+	if err := auth.ForceSetEmail(user.ID, "forced@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := auth.GetUserByEmail("forced@example.com"); stored == nil || stored.ID != user.ID || !stored.EmailVerified {
+		t.Errorf("Expected the forced email to be set and verified, got %+v", stored)
+	}
+}
+
+func TestEmailChangeHandlers(t *testing.T) {
+	sent := make(map[string]string)
+	auth := newTestKit(t, emailChangeConfig(sent))
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "handler@example.com", Password: "password123", Name: "Handler"})
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "taken@example.com", Password: "password123", Name: "Taken"})
+	_ = auth.ForceSetEmail(user.ID, "handler@example.com") // Verified, so the user can log in
+	tokens, _ := auth.LoginUser("handler@example.com", "password123")
+
+	r := gin.New()
+	r.POST("/email", auth.GinMiddleware(), auth.RequestEmailChangeHandler)
+	r.GET("/email/confirm", auth.ConfirmEmailChangeHandler)
+
+	request := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/email", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := request(`{"new_email":"taken@example.com"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a registered email, got %d %s", w.Code, w.Body.String())
+	}
+	if w := request(`{"new_email":"changed@example.com"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d %s", w.Code, w.Body.String())
+	}
+
+	confirm := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/email/confirm?token="+token, nil))
+		return w
+	}
+	if w := confirm("garbage"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad token, got %d", w.Code)
+	}
+	if w := confirm(sent["changed@example.com"]); w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if stored, _ := auth.GetUserByID(user.ID); stored.Email != "changed@example.com" {
+		t.Errorf("Expected the email to change, got %q", stored.Email)
+	}
+}
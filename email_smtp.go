@@ -0,0 +1,204 @@
+package authkit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPTLSMode selects how SMTPSender secures the connection
+type SMTPTLSMode string
+
+// Supported values for SMTPSender.TLS
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS, failing if the server doesn't offer it (port 587)
+	SMTPStartTLS SMTPTLSMode = "starttls"
+	// SMTPImplicitTLS connects over TLS from the start (port 465)
+	SMTPImplicitTLS SMTPTLSMode = "tls"
+	// SMTPNoTLS sends in plain text; only for local relays and testing
+	SMTPNoTLS SMTPTLSMode = "none"
+)
+
+// SMTPSender is an EmailSender that delivers through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     int    // default: 587, or 465 with SMTPImplicitTLS
+	Username string // Authenticates with PLAIN when set
+	Password string
+	From     string      // Envelope and header sender, e.g. "App <no-reply@example.com>"
+	TLS      SMTPTLSMode // default: SMTPStartTLS
+	// TLSConfig customizes the TLS connection (default: verify Host)
+	TLSConfig *tls.Config
+	// Timeout bounds connecting and the whole exchange (default: 30s)
+	Timeout time.Duration
+}
+
+// Send delivers a multipart/alternative message with the HTML and text bodies
+func (s *SMTPSender) Send(to, subject, htmlBody, textBody string) error {
+	if strings.ContainsAny(to+subject+s.From, "\r\n") {
+		return fmt.Errorf("smtp: header values must not contain line breaks")
+	}
+	from, err := parseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid From: %w", err)
+	}
+	recipient, err := parseAddress(to)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid recipient: %w", err)
+	}
+
+	message, err := buildMessage(s.From, to, subject, htmlBody, textBody)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("smtp: MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("smtp: RCPT TO: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: DATA: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("smtp: writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: DATA: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects and secures the connection according to s.TLS
+func (s *SMTPSender) dial() (*smtp.Client, error) {
+	mode := s.TLS
+	if mode == "" {
+		mode = SMTPStartTLS
+	}
+	port := s.Port
+	if port == 0 {
+		port = 587
+		if mode == SMTPImplicitTLS {
+			port = 465
+		}
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	tlsConfig := s.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	switch mode {
+	case SMTPImplicitTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case SMTPStartTLS, SMTPNoTLS:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return nil, fmt.Errorf("smtp: unsupported TLS mode %q", mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp: connecting to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp: %w", err)
+	}
+
+	if mode == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp: server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp: STARTTLS: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// parseAddress returns the bare address of "Name <addr>" or "addr"
+func parseAddress(address string) (string, error) {
+	if start := strings.LastIndex(address, "<"); start >= 0 {
+		end := strings.LastIndex(address, ">")
+		if end < start {
+			return "", fmt.Errorf("malformed address %q", address)
+		}
+		address = address[start+1 : end]
+	}
+	address = strings.TrimSpace(address)
+	if !strings.Contains(address, "@") {
+		return "", fmt.Errorf("malformed address %q", address)
+	}
+	return address, nil
+}
+
+// buildMessage renders the headers and a multipart/alternative body
+func buildMessage(from, to, subject, htmlBody, textBody string) ([]byte, error) {
+	boundaryBytes := make([]byte, 12)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, err
+	}
+	boundary := "authkit-" + hex.EncodeToString(boundaryBytes)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", textBody},
+		{"text/html", htmlBody},
+	} {
+		fmt.Fprintf(&msg, "--%s\r\n", boundary)
+		fmt.Fprintf(&msg, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&msg)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+		msg.WriteString("\r\n")
+	}
+	fmt.Fprintf(&msg, "--%s--\r\n", boundary)
+
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,221 @@
+package authkit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinEmails(t *testing.T) {
+	sender := NewMemoryEmailSender()
+	auth := newTestKit(t, Config{
+		EmailRequired:        true,
+		EmailSender:          sender,
+		PasswordResetURL:     "https://example.com/reset",
+		EmailVerificationURL: "https://example.com/verify?source=email",
+	})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "mail@example.com", Password: "password123", Name: "Mail"})
+
+	if err := auth.RequestEmailVerification("mail@example.com"); err != nil {
+		t.Fatalf("Expected the verification email to be sent, got %v", err)
+	}
+	if err := auth.RequestPasswordReset("mail@example.com"); err != nil {
+		t.Fatalf("Expected the reset email to be sent, got %v", err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	verification, reset := messages[0], messages[1]
+	if verification.To != user.Email || verification.Subject != "Verify your email address" {
+		t.Errorf("Unexpected verification email %+v", verification)
+	}
+	if !strings.Contains(verification.TextBody, "https://example.com/verify?source=email&token=") {
+		t.Errorf("Expected a verification link, got %s", verification.TextBody)
+	}
+	if reset.Subject != "Reset your password" || !strings.Contains(reset.HTMLBody, `href="https://example.com/reset?token=`) {
+		t.Errorf("Unexpected reset email %+v", reset)
+	}
+
+	// The link in the email works
+	link := verification.TextBody[strings.Index(verification.TextBody, "token=")+len("token="):]
+	token := strings.Fields(link)[0]
+	if err := auth.VerifyEmail(token); err != nil {
+		t.Errorf("Expected the emailed token to verify, got %v", err)
+	}
+}
+
+func TestEmailTemplateOverrides(t *testing.T) {
+	sender := NewMemoryEmailSender()
+	auth := newTestKit(t, Config{
+		EmailSender: sender,
+		EmailTemplates: map[EmailKind]EmailTemplate{
+			EmailPasswordReset: {Subject: "Password help for {{.User.Name}}", HTML: "<b>{{.Token}}</b> for {{.User.Name}}"},
+		},
+	})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "override@example.com", Password: "password123", Name: "<Eve>"})
+
+	if err := auth.RequestPasswordReset("override@example.com"); err != nil {
+		t.Fatalf("Expected the reset email to be sent, got %v", err)
+	}
+	message := sender.Messages()[0]
+	if message.Subject != "Password help for <Eve>" {
+		t.Errorf("Expected the overridden subject, got %q", message.Subject)
+	}
+	if !strings.Contains(message.HTMLBody, "for &lt;Eve&gt;") {
+		t.Errorf("Expected HTML escaping, got %s", message.HTMLBody)
+	}
+	if !strings.Contains(message.TextBody, "Your password reset code is") {
+		t.Errorf("Expected the built-in text body to be kept, got %s", message.TextBody)
+	}
+
+	for _, templates := range []map[EmailKind]EmailTemplate{
+		{"welcome": {Subject: "Hi"}},
+		{EmailNewLogin: {HTML: "{{.Broken"}},
+	} {
+		if _, err := NewValidated(Config{JWTSecret: "s", EmailTemplates: templates}); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %v, got %v", templates, err)
+		}
+	}
+}
+
+func TestNewLoginAlerts(t *testing.T) {
+	sender := NewMemoryEmailSender()
+	auth := newTestKit(t, Config{EmailSender: sender, NewLoginAlerts: true})
+	loginTestUser(t, auth, "alert@example.com")
+	auth.Close() // Waits for the background send
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "alert@example.com" || messages[0].Subject != "New sign-in to your account" {
+		t.Errorf("Expected one login alert, got %+v", messages)
+	}
+}
+
+func TestEmailFlowsWithoutSender(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if err := auth.RequestEmailVerification("anyone@example.com"); !errors.Is(err, ErrNoEmailSender) {
+		t.Errorf("Expected ErrNoEmailSender, got %v", err)
+	}
+}
+
+// fakeSMTPServer accepts one plain-text SMTP session and returns the DATA it received
+func fakeSMTPServer(t *testing.T, extensions ...string) (int, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	received := make(chan string, 1)
+
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250-localhost")
+				for _, ext := range extensions {
+					reply("250-" + ext)
+				}
+				reply("250 8BITMIME")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPSender(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+	sender := &SMTPSender{Host: "127.0.0.1", Port: port, From: "App <no-reply@example.com>", TLS: SMTPNoTLS}
+
+	if err := sender.Send("user@example.com", "Héllo", "<p>Hi</p>", "Hi"); err != nil {
+		t.Fatalf("Expected Send to succeed, got %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatalf("Failed to parse the message: %v", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Héllo" {
+		t.Errorf("Expected the encoded subject to decode, got %q", subject)
+	}
+	if msg.Header.Get("To") != "user@example.com" {
+		t.Errorf("Unexpected To header %q", msg.Header.Get("To"))
+	}
+
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Errorf("Expected text and HTML parts, got %v", types)
+	}
+}
+
+func TestSMTPSenderRequiresStartTLS(t *testing.T) {
+	port, _ := fakeSMTPServer(t)
+	sender := &SMTPSender{Host: "127.0.0.1", Port: port, From: "no-reply@example.com"}
+
+	if err := sender.Send("user@example.com", "Hi", "", "Hi"); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected a STARTTLS error, got %v", err)
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	sender := &SMTPSender{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com", TLS: SMTPNoTLS}
+
+	if err := sender.Send("user@example.com\r\nBcc: victim@example.com", "Hi", "", "Hi"); err == nil {
+		t.Error("Expected line breaks in headers to be rejected")
+	}
+	if err := sender.Send("user@example.com", "Hi\nBcc: victim@example.com", "", "Hi"); err == nil {
+		t.Error("Expected line breaks in the subject to be rejected")
+	}
+}
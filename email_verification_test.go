@@ -0,0 +1,115 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestEmailVerification(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{EmailRequired: true, Clock: testClock(&now)})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "verify@example.com", Password: "password123", Name: "Verify"})
+	if user.EmailVerified {
+		t.Fatal("Expected a new user to be unverified")
+	}
+	if _, err := auth.LoginUser("verify@example.com", "password123"); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Expected ErrEmailNotVerified, got %v", err)
+	}
+	if _, err := auth.LoginUser("verify@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected wrong passwords to be rejected first, got %v", err)
+	}
+
+	if _, err := auth.CreateEmailVerificationToken("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	expired, _ := auth.CreateEmailVerificationToken(user.ID)
+	now = now.Add(25 * time.Hour)
+	if err := auth.VerifyEmail(expired); !errors.Is(err, ErrNonceExpired) {
+		t.Errorf("Expected ErrNonceExpired, got %v", err)
+	}
+
+	token, _ := auth.CreateEmailVerificationToken(user.ID)
+	if err := auth.VerifyEmail(token); err != nil {
+		t.Fatalf("Expected VerifyEmail to succeed, got %v", err)
+	}
+	if err := auth.VerifyEmail(token); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected the token to be single-use, got %v", err)
+	}
+	if _, err := auth.LoginUser("verify@example.com", "password123"); err != nil {
+		t.Errorf("Expected login after verification, got %v", err)
+	}
+}
+
+func TestEmailVerificationHandlers(t *testing.T) {
+	sent := map[string]string{}
+	auth := newTestKit(t, Config{
+		EmailRequired: true,
+		SendEmailVerification: func(user *UserInfo, token string) error {
+			sent[user.Email] = token
+			return nil
+		},
+	})
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/verify-email/resend", auth.ResendVerificationHandler)
+	r.GET("/verify-email", auth.VerifyEmailHandler)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/register", `{"email":"new@example.com","password":"password123","name":"New"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	first := sent["new@example.com"]
+	if first == "" {
+		t.Fatal("Expected registration to send a verification token")
+	}
+
+	if w := do(http.MethodPost, "/login", `{"email":"new@example.com","password":"password123"}`); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodeEmailNotVerified) {
+		t.Errorf("Expected 403 %s, got %d: %s", CodeEmailNotVerified, w.Code, w.Body.String())
+	}
+
+	known := do(http.MethodPost, "/verify-email/resend", `{"email":"new@example.com"}`)
+	unknown := do(http.MethodPost, "/verify-email/resend", `{"email":"nobody@example.com"}`)
+	if known.Code != http.StatusAccepted || known.Body.String() != unknown.Body.String() {
+		t.Errorf("Expected identical 202 responses, got %d %s and %d %s", known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+	if sent["new@example.com"] == first {
+		t.Error("Expected a new token to be sent")
+	}
+
+	if w := do(http.MethodGet, "/verify-email?token="+sent["new@example.com"], ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/verify-email?token=bogus", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid token, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/login", `{"email":"new@example.com","password":"password123"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected login after verification, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The earlier token is still valid; verifying twice is harmless
+	app := fiber.New()
+	app.Get("/verify-email", auth.VerifyEmailHandlerFiber)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/verify-email?token="+first, nil))
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+}
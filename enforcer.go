@@ -0,0 +1,212 @@
+package authkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Enforcer decides the policy checks of RequirePolicy, called with the
+// subject, object and action of a request. A *casbin.Enforcer satisfies it,
+// so Casbin policies can be enforced without AuthKit depending on Casbin.
+type Enforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}
+
+// PolicySubject selects the subject RequirePolicy passes to Config.Enforcer
+type PolicySubject string
+
+// Supported values for Config.PolicySubject
+const (
+	// PolicySubjectUserID passes the user ID of the claims
+	PolicySubjectUserID PolicySubject = "user_id"
+	// PolicySubjectRole passes the role of the claims
+	PolicySubjectRole PolicySubject = "role"
+)
+
+// policyCheck is the check of one RequirePolicy middleware
+type policyCheck struct {
+	auth     *AuthKit
+	template []objectPart // nil: the object is the request path
+	act      string
+}
+
+// objectPart is a literal or, with param set, a path parameter of an object
+// template
+type objectPart struct {
+	text  string
+	param bool
+}
+
+// newPolicyCheck sets up a RequirePolicy middleware. It panics without
+// Config.Enforcer or for a malformed object template.
+func (a *AuthKit) newPolicyCheck(objTemplate, act string) *policyCheck {
+	if a.config.Enforcer == nil {
+		panic("authkit: RequirePolicy needs Config.Enforcer")
+	}
+	template, err := parseObjectTemplate(objTemplate)
+	if err != nil {
+		panic("authkit: RequirePolicy: " + err.Error())
+	}
+	return &policyCheck{auth: a, template: template, act: act}
+}
+
+// parseObjectTemplate splits a template such as "post:{id}" into literals and
+// path parameters
+func parseObjectTemplate(template string) ([]objectPart, error) {
+	if template == "" {
+		return nil, nil
+	}
+	var parts []objectPart
+	for rest := template; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			parts = append(parts, objectPart{text: rest})
+			break
+		}
+		if open > 0 {
+			parts = append(parts, objectPart{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in object template %q", template)
+		}
+		name := rest[open+1 : open+end]
+		if name == "" || strings.ContainsAny(name, "{/") {
+			return nil, fmt.Errorf("invalid parameter %q in object template %q", name, template)
+		}
+		parts = append(parts, objectPart{text: name, param: true})
+		rest = rest[open+end+1:]
+	}
+	return parts, nil
+}
+
+// object builds the object of a request from the template, or returns path
+// without one
+func (p *policyCheck) object(path string, param func(name string) string) string {
+	if p.template == nil {
+		return path
+	}
+	var b strings.Builder
+	for _, part := range p.template {
+		if part.param {
+			b.WriteString(param(part.text))
+		} else {
+			b.WriteString(part.text)
+		}
+	}
+	return b.String()
+}
+
+// policySubject returns the subject of claims selected by Config.PolicySubject
+func (a *AuthKit) policySubject(claims *Claims) string {
+	if a.config.PolicySubject == PolicySubjectRole {
+		return claims.Role
+	}
+	return claims.UserID
+}
+
+// check asks the enforcer whether claims may perform the action on obj,
+// returning the status and code to reject the request with. Enforcer errors
+// are logged and returned, never taken as an allow.
+func (p *policyCheck) check(ctx context.Context, claims *Claims, obj string) (int, string, error) {
+	a := p.auth
+	allowed, err := a.config.Enforcer.Enforce(a.policySubject(claims), obj, p.act)
+	if err != nil {
+		a.config.Logger.ErrorContext(ctx, "policy check failed", "object", obj, "action", p.act, "error", err)
+		return http.StatusInternalServerError, CodeInternalError, err
+	}
+	if !allowed {
+		return http.StatusForbidden, CodeInsufficientPermissions, nil
+	}
+	return 0, "", nil
+}
+
+// RequirePolicy returns a Gin middleware that requires Config.Enforcer to
+// allow the action on an object for the subject of the claims GinMiddleware
+// set, selected by Config.PolicySubject. The object is the request path, or
+// objTemplate with {name} replaced by the path parameters of the route.
+// Denied requests get a 403, and enforcer errors a 500. It panics without
+// Config.Enforcer.
+//
+//	r.PUT("/posts/:id", auth.GinMiddleware(), auth.RequirePolicy("post:{id}", "write"), handler)
+func (a *AuthKit) RequirePolicy(objTemplate, act string) gin.HandlerFunc {
+	p := a.newPolicyCheck(objTemplate, act)
+	return func(c *gin.Context) {
+		claims, exists := GetUserFromGinContext(c)
+		if !exists {
+			a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
+			c.Abort()
+			return
+		}
+
+		status, code, err := p.check(c.Request.Context(), claims, p.object(c.Request.URL.Path, c.Param))
+		if status != 0 {
+			a.logRejection(c.Request.Context(), c.Request.URL.Path, code)
+			a.ginRespondError(c, a.ginErrorResponse(c, status, code, err))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePolicyFiber is RequirePolicy for Fiber
+func (a *AuthKit) RequirePolicyFiber(objTemplate, act string) fiber.Handler {
+	p := a.newPolicyCheck(objTemplate, act)
+	return func(c *fiber.Ctx) error {
+		claims, exists := GetUserFromFiberContext(c)
+		if !exists {
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+		}
+
+		param := func(name string) string { return c.Params(name) }
+		status, code, err := p.check(c.UserContext(), claims, p.object(c.Path(), param))
+		if status != 0 {
+			a.logRejection(c.UserContext(), c.Path(), code)
+			return a.fiberRespondError(c, a.fiberErrorResponse(c, status, code, err))
+		}
+
+		return c.Next()
+	}
+}
+
+// RequirePolicyHTTP is RequirePolicy for net/http. Path parameters come from
+// Request.PathValue, so templates with parameters need the Go 1.22 ServeMux
+// patterns or a router setting path values.
+func (a *AuthKit) RequirePolicyHTTP(objTemplate, act string) func(http.Handler) http.Handler {
+	p := a.newPolicyCheck(objTemplate, act)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, exists := GetUserFromContext(r.Context())
+			if !exists {
+				a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+				return
+			}
+
+			param := func(name string) string { return httpPathValue(r, name) }
+			status, code, err := p.check(r.Context(), claims, p.object(r.URL.Path, param))
+			if status != 0 {
+				a.logRejection(r.Context(), r.URL.Path, code)
+				a.httpRespondError(w, a.httpErrorResponse(r, status, code, err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// httpPathValue returns a path parameter of r on Go 1.22 and later, or an
+// empty string
+func httpPathValue(r *http.Request, name string) string {
+	if pv, ok := interface{}(r).(interface{ PathValue(string) string }); ok {
+		return pv.PathValue(name)
+	}
+	return ""
+}
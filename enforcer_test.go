@@ -0,0 +1,169 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// stubEnforcer allows the requests listed as "subject object action", and
+// fails with err when set
+type stubEnforcer struct {
+	allowed map[string]bool
+	err     error
+	calls   []string
+}
+
+func (e *stubEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	request := strings.TrimSuffix(fmt.Sprintln(rvals...), "\n")
+	e.calls = append(e.calls, request)
+	if e.err != nil {
+		return false, e.err
+	}
+	return e.allowed[request], nil
+}
+
+// policyServers serve PUT /posts/{id} behind each framework's RequirePolicy
+// middleware; without a token, the request reaches RequirePolicy without claims
+func policyServers(auth *AuthKit, objTemplate, act string) map[string]func(req *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(auth.OptionalGinMiddleware())
+	r.PUT("/posts/:id", auth.RequirePolicy(objTemplate, act), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	app := fiber.New()
+	app.Use(auth.OptionalFiberMiddleware())
+	app.Put("/posts/:id", auth.RequirePolicyFiber(objTemplate, act), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	handler := auth.OptionalHTTPMiddleware(auth.RequirePolicyHTTP(objTemplate, act)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})))
+
+	return map[string]func(req *http.Request) *httptest.ResponseRecorder{
+		"gin": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		},
+		"fiber": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			serveFiber(app, w, req)
+			return w
+		},
+		"http": func(req *http.Request) *httptest.ResponseRecorder {
+			// Set the path value a Go 1.22 ServeMux pattern would
+			if pv, ok := interface{}(req).(interface{ SetPathValue(name, value string) }); ok {
+				pv.SetPathValue("id", strings.TrimPrefix(req.URL.Path, "/posts/"))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w
+		},
+	}
+}
+
+func policyRequest(path, accessToken string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, path, nil)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return req
+}
+
+func TestRequirePolicy(t *testing.T) {
+	enforcer := &stubEnforcer{allowed: make(map[string]bool)}
+	auth := newTestKit(t, Config{Enforcer: enforcer})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "author@example.com")
+	enforcer.allowed[tokens.User.ID+" post:42 write"] = true
+
+	for name, serve := range policyServers(auth, "post:{id}", "write") {
+		t.Run(name, func(t *testing.T) {
+			enforcer.calls = nil
+			if w := serve(policyRequest("/posts/42", tokens.AccessToken)); w.Code != http.StatusOK {
+				t.Errorf("Expected the policy to allow the request, got %d %s", w.Code, w.Body.String())
+			}
+			if len(enforcer.calls) != 1 || enforcer.calls[0] != tokens.User.ID+" post:42 write" {
+				t.Errorf("Expected the user ID, templated object and action, got %v", enforcer.calls)
+			}
+
+			w := serve(policyRequest("/posts/43", tokens.AccessToken))
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodeInsufficientPermissions) {
+				t.Errorf("Expected 403 for a denied request, got %d %s", w.Code, w.Body.String())
+			}
+
+			enforcer.calls = nil
+			w = serve(policyRequest("/posts/42", ""))
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeNotAuthenticated) {
+				t.Errorf("Expected 401 without claims, got %d %s", w.Code, w.Body.String())
+			}
+			if len(enforcer.calls) != 0 {
+				t.Errorf("Expected no policy check without claims, got %v", enforcer.calls)
+			}
+		})
+	}
+}
+
+func TestRequirePolicyEnforcerError(t *testing.T) {
+	enforcer := &stubEnforcer{err: errors.New("policy store unavailable")}
+	auth := newTestKit(t, Config{Enforcer: enforcer})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "author@example.com")
+
+	for name, serve := range policyServers(auth, "", "write") {
+		t.Run(name, func(t *testing.T) {
+			w := serve(policyRequest("/posts/42", tokens.AccessToken))
+			if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), CodeInternalError) {
+				t.Errorf("Expected 500 for an enforcer error, got %d %s", w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "policy store unavailable") {
+				t.Errorf("Expected the enforcer error not to leak, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequirePolicyRoleSubject(t *testing.T) {
+	enforcer := &stubEnforcer{allowed: map[string]bool{"user /posts/42 write": true}}
+	auth := newTestKit(t, Config{Enforcer: enforcer, PolicySubject: PolicySubjectRole})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "author@example.com")
+
+	// Without a template, the object is the request path
+	for name, serve := range policyServers(auth, "", "write") {
+		if w := serve(policyRequest("/posts/42", tokens.AccessToken)); w.Code != http.StatusOK {
+			t.Errorf("%s: expected the role and path to be allowed, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRequirePolicyConfig(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected RequirePolicy to panic without an Enforcer")
+			}
+		}()
+		auth.RequirePolicy("", "read")
+	}()
+
+	for _, template := range []string{"post:{id", "post:{}", "post:{a/b}"} {
+		if _, err := parseObjectTemplate(template); err == nil {
+			t.Errorf("Expected %q to be rejected", template)
+		}
+	}
+
+	if err := (Config{JWTSecret: "secret", PolicySubject: "email"}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an invalid PolicySubject to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AuthError is an error with a stable code, a suggested HTTP status and
+// optional field-level details, e.g. the password rules that failed. The main
+// operations such as LoginUser return their errors as an *AuthError naming
+// the operation; AsAuthError builds one for any other error. The underlying
+// sentinel still matches with errors.Is:
+//
+//	var authErr *authkit.AuthError
+//	if errors.As(err, &authErr) {
+//	    log.Println(authErr.Code, authErr.Status)
+//	}
+//	if errors.Is(err, authkit.ErrUserNotFound) { ... }
+type AuthError struct {
+	Op      string                 // Operation that failed, e.g. "login", or empty
+	Code    string                 // Stable error code, e.g. CodeUserNotFound
+	Status  int                    // Suggested HTTP status
+	Details map[string]interface{} // Field-level details, or nil
+	Err     error                  // Underlying error, usually a sentinel
+}
+
+func (e *AuthError) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// AsAuthError returns the *AuthError in err's chain, or describes err as one
+// with its ErrorCode, ErrorStatus and details. It returns nil for a nil error.
+func AsAuthError(err error) *AuthError {
+	if err == nil {
+		return nil
+	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr
+	}
+	return &AuthError{Code: ErrorCode(err), Status: ErrorStatus(err), Details: errorDetails(err), Err: err}
+}
+
+// ErrorStatus returns the suggested HTTP status for an AuthKit error, or 500
+// for unknown errors
+func ErrorStatus(err error) int {
+	var authErr *AuthError
+	if errors.As(err, &authErr) && authErr.Status != 0 {
+		return authErr.Status
+	}
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// opError wraps a non-nil error returned by the public operation op in an
+// *AuthError, so it says which operation failed
+func opError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &AuthError{Op: op, Code: ErrorCode(err), Status: ErrorStatus(err), Details: errorDetails(err), Err: err}
+}
+
+// errorDetails returns the field-level details of the typed AuthKit errors in
+// err's chain, or nil
+func errorDetails(err error) map[string]interface{} {
+	details := make(map[string]interface{})
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		details["rules"] = policyErr.Failures
+	}
+	var breachedErr *PasswordBreachedError
+	if errors.As(err, &breachedErr) {
+		details["breach_count"] = breachedErr.Count
+	}
+	var fieldErr *RestrictedFieldError
+	if errors.As(err, &fieldErr) {
+		details["field"] = fieldErr.Field
+	}
+	var deniedErr *AccessDeniedError
+	if errors.As(err, &deniedErr) {
+		details["policy"] = deniedErr.Policy
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return details
+}
+
+// ErrorResponse is an error response about to be sent by a bundled handler
+// or middleware, see Config.ErrorResponder
+type ErrorResponse struct {
+	Status  int                    // HTTP status chosen by the handler
+	Code    string                 // Stable error code, e.g. CodeTokenExpired
+	Message string                 // Message for Code in Locale
+	Details map[string]interface{} // Field-level details, or nil
+	Err     error                  // Underlying error, nil for rejected requests such as a missing header
+	Method  string
+	Path    string // Request path
+	Locale  string // Response locale resolved from the request
+}
+
+// ErrorResponder builds the error responses of the bundled handlers and
+// middleware from resp, returning the status, the content type (default:
+// application/json) and a body marshaled as JSON
+type ErrorResponder func(resp ErrorResponse) (status int, contentType string, body interface{})
+
+// DefaultErrorResponder keeps the handler's status and responds with
+// {"error": {"code": ..., "message": ..., "details": ...}}, leaving out empty details
+func DefaultErrorResponder(resp ErrorResponse) (int, string, interface{}) {
+	envelope := map[string]interface{}{
+		"code":    resp.Code,
+		"message": resp.Message,
+	}
+	if len(resp.Details) > 0 {
+		envelope["details"] = resp.Details
+	}
+	return resp.Status, "", map[string]interface{}{"error": envelope}
+}
+
+// errorResponse describes an error response, with the details of err's typed errors
+func (a *AuthKit) errorResponse(status int, code string, err error, method, path, locale string) ErrorResponse {
+	return ErrorResponse{
+		Status:  status,
+		Code:    code,
+		Message: a.config.Messages.Message(locale, code),
+		Details: errorDetails(err),
+		Err:     err,
+		Method:  method,
+		Path:    path,
+		Locale:  locale,
+	}
+}
+
+// addDetail adds a field to the details of the response
+func (r *ErrorResponse) addDetail(key string, value interface{}) {
+	if r.Details == nil {
+		r.Details = make(map[string]interface{})
+	}
+	r.Details[key] = value
+}
+
+// renderError runs resp through the ErrorResponder, returning the status,
+// content type and body to send
+func (a *AuthKit) renderError(resp ErrorResponse) (int, string, interface{}) {
+	status, contentType, body := a.config.ErrorResponder(resp)
+	if contentType == "" {
+		contentType = jsonContentType
+	}
+	return status, contentType, body
+}
@@ -0,0 +1,195 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errorField returns a field of the {"error": {...}} envelope of a decoded error response
+func errorField(body map[string]interface{}, key string) interface{} {
+	envelope, _ := body["error"].(map[string]interface{})
+	return envelope[key]
+}
+
+// errorDetail returns a field of the details of a decoded error response
+func errorDetail(body map[string]interface{}, key string) interface{} {
+	details, _ := errorField(body, "details").(map[string]interface{})
+	return details[key]
+}
+
+func TestWrappedErrorsMatchSentinels(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "wrapped@example.com", Password: "password123", Name: "Wrapped"})
+
+	_, err := auth.LoginUser("wrapped@example.com", "wrong-password")
+	wrapped := fmt.Errorf("handling request: %w", err)
+	for _, err := range []error{err, wrapped} {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Expected %v to match ErrInvalidCredentials", err)
+		}
+		var authErr *AuthError
+		if !errors.As(err, &authErr) || authErr.Op != "login" || authErr.Code != CodeInvalidCredentials || authErr.Status != http.StatusUnauthorized {
+			t.Errorf("Expected a login AuthError, got %#v", authErr)
+		}
+		if ErrorCode(err) != CodeInvalidCredentials || ErrorStatus(err) != http.StatusUnauthorized {
+			t.Errorf("Expected the code and status to survive wrapping, got %s, %d", ErrorCode(err), ErrorStatus(err))
+		}
+	}
+	if err.Error() != "login: "+ErrInvalidCredentials.Error() {
+		t.Errorf("Expected the operation in the message, got %q", err.Error())
+	}
+
+	_, err = auth.RegisterUser(RegisterRequest{Email: "wrapped@example.com", Password: "password123", Name: "Again"})
+	if !errors.Is(err, ErrUserAlreadyExists) || ErrorStatus(err) != http.StatusConflict {
+		t.Errorf("Expected ErrUserAlreadyExists with 409, got %v", err)
+	}
+	if err := auth.ChangePassword(user.ID, "wrong-password", "new-password123"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if _, err := auth.RefreshToken("not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+	if _, err := auth.UpdateUser("missing", nil); !errors.Is(err, ErrUserNotFound) || ErrorStatus(err) != http.StatusNotFound {
+		t.Errorf("Expected ErrUserNotFound with 404, got %v", err)
+	}
+	if err := auth.DeleteUser("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestAuthErrorDetails(t *testing.T) {
+	auth := newTestKit(t, Config{PasswordPolicy: PasswordPolicy{MinLength: 12, RequireDigit: true}})
+	defer auth.Close()
+
+	_, err := auth.RegisterUser(RegisterRequest{Email: "weak@example.com", Password: "shortpass", Name: "Weak"})
+	authErr := AsAuthError(err)
+	if authErr.Code != CodeWeakPassword || authErr.Status != http.StatusBadRequest || authErr.Op != "register" {
+		t.Fatalf("Expected a weak_password AuthError, got %#v", authErr)
+	}
+	rules, _ := authErr.Details["rules"].([]string)
+	if len(rules) != 2 {
+		t.Errorf("Expected both failed rules in the details, got %v", authErr.Details)
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected the PasswordPolicyError to stay reachable, got %v", err)
+	}
+}
+
+func TestAsAuthError(t *testing.T) {
+	if AsAuthError(nil) != nil {
+		t.Error("Expected nil for a nil error")
+	}
+
+	authErr := AsAuthError(fmt.Errorf("lookup: %w", ErrSessionNotFound))
+	if authErr.Code != CodeSessionNotFound || authErr.Status != http.StatusNotFound || !errors.Is(authErr, ErrSessionNotFound) {
+		t.Errorf("Expected a session_not_found AuthError, got %#v", authErr)
+	}
+
+	authErr = AsAuthError(errors.New("disk on fire"))
+	if authErr.Code != CodeInternalError || authErr.Status != http.StatusInternalServerError || authErr.Details != nil {
+		t.Errorf("Expected an internal_error AuthError, got %#v", authErr)
+	}
+
+	custom := &AuthError{Code: "quota_exceeded", Status: http.StatusPaymentRequired, Err: errors.New("quota exceeded")}
+	if ErrorCode(fmt.Errorf("wrapped: %w", custom)) != "quota_exceeded" || ErrorStatus(custom) != http.StatusPaymentRequired {
+		t.Error("Expected a custom AuthError's code and status to be used")
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	for name, handler := range registerRoutes(newTestKit(t, Config{})) {
+		t.Run(name, func(t *testing.T) {
+			post := func(body string) (int, map[string]interface{}) {
+				req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				var decoded map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+					t.Fatal(err)
+				}
+				return w.Code, decoded
+			}
+
+			body := `{"email":"envelope@example.com","password":"password123","name":"Envelope"}`
+			post(body)
+			code, decoded := post(body)
+			if code != http.StatusConflict || errorField(decoded, "code") != CodeUserAlreadyExists || errorField(decoded, "message") != "User already exists" {
+				t.Errorf("Expected a user_already_exists envelope, got %d %v", code, decoded)
+			}
+			if _, flat := decoded["code"]; flat || errorField(decoded, "details") != nil {
+				t.Errorf("Expected only the envelope, got %v", decoded)
+			}
+
+			code, decoded = post(`{"email":`)
+			if code != http.StatusBadRequest || errorField(decoded, "code") != CodeInvalidRequest || errorDetail(decoded, "reason") == nil {
+				t.Errorf("Expected an invalid_request envelope with the reason, got %d %v", code, decoded)
+			}
+		})
+	}
+}
+
+func TestErrorResponder(t *testing.T) {
+	var seen []ErrorResponse
+	auth := newTestKit(t, Config{
+		ErrorResponder: func(resp ErrorResponse) (int, string, interface{}) {
+			seen = append(seen, resp)
+			status := resp.Status
+			if resp.Code == CodeUserAlreadyExists {
+				status = http.StatusUnprocessableEntity
+			}
+			return status, "application/problem+json", map[string]interface{}{
+				"type":     "urn:authkit:" + resp.Code,
+				"title":    http.StatusText(resp.Status),
+				"status":   status,
+				"detail":   resp.Message,
+				"instance": resp.Path,
+			}
+		}})
+	defer auth.Close()
+
+	for name, handler := range registerRoutes(auth) {
+		t.Run(name, func(t *testing.T) {
+			seen = nil
+			send := func(method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				var decoded map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+					t.Fatalf("Expected a JSON body, got %q", w.Body.String())
+				}
+				return w, decoded
+			}
+
+			w, decoded := send(http.MethodGet, "/admin", "")
+			if w.Code != http.StatusUnauthorized || w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("Expected a 401 problem+json response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+			}
+			if decoded["type"] != "urn:authkit:"+CodeMissingAuthorization || decoded["instance"] != "/admin" || decoded["detail"] == "" {
+				t.Errorf("Expected a missing_authorization problem, got %v", decoded)
+			}
+			if len(seen) != 1 || seen[0].Err != nil || seen[0].Method != http.MethodGet || seen[0].Locale != "en" {
+				t.Errorf("Expected one rejection without an error, got %+v", seen)
+			}
+
+			body := `{"email":"problem-` + name + `@example.com","password":"password123","name":"Problem"}`
+			send(http.MethodPost, "/register", body)
+			w, decoded = send(http.MethodPost, "/register", body)
+			if w.Code != http.StatusUnprocessableEntity || decoded["status"] != float64(http.StatusUnprocessableEntity) {
+				t.Errorf("Expected the responder to override the status, got %d %v", w.Code, decoded)
+			}
+			if last := seen[len(seen)-1]; !errors.Is(last.Err, ErrUserAlreadyExists) || last.Status != http.StatusConflict {
+				t.Errorf("Expected the underlying error and handler status, got %+v", last)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ func main() {
 	// Initialize AuthKit
 	auth := authkit.New(authkit.Config{
 		JWTSecret:     "your-super-secret-jwt-key-here",
+		EncryptionKey: "your-encryption-key-here",
 		TokenExpiry:   "24h",
 		RefreshExpiry: "7d",
 		BCryptCost:    12,
@@ -36,32 +37,27 @@ func main() {
 		c.Next()
 	})
 
-	// Public routes (no authentication required)
+	// Register, login, refresh, logout, profile, password, MFA, session and
+	// admin user management routes, e.g. POST /api/v1/login and
+	// GET /api/v1/admin/users
 	api := r.Group("/api/v1")
-	{
-		api.POST("/register", auth.RegisterHandler)
-		api.POST("/login", auth.LoginHandler)
-		api.POST("/refresh", auth.RefreshHandler)
+	if err := auth.RegisterRoutes(api, authkit.RouteOptions{}); err != nil {
+		log.Fatal(err)
+	}
 
-		// Health check
-		api.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "ok",
-				"message": "AuthKit API is running",
-				"version": "1.0.0",
-			})
+	// Health check
+	api.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "ok",
+			"message": "AuthKit API is running",
+			"version": "1.0.0",
 		})
-	}
+	})
 
 	// Protected routes (authentication required)
 	protected := api.Group("")
 	protected.Use(auth.GinMiddleware())
 	{
-		// User profile routes
-		protected.GET("/profile", auth.ProfileHandler)
-		protected.PUT("/profile", auth.UpdateProfileHandler)
-		protected.POST("/logout", auth.LogoutHandler)
-
 		// Protected resource examples
 		protected.GET("/posts", getPostsHandler)
 		protected.POST("/posts", createPostHandler)
@@ -79,15 +75,6 @@ func main() {
 		})
 	}
 
-	// Admin routes (admin role required)
-	admin := protected.Group("/admin")
-	admin.Use(auth.RequireRole("admin"))
-	{
-		admin.GET("/users", listUsersHandler(auth))
-		admin.DELETE("/users/:id", deleteUserHandler(auth))
-		admin.PUT("/users/:id/role", updateUserRoleHandler(auth))
-	}
-
 	// Moderator and Admin routes (multiple roles allowed)
 	modAdmin := protected.Group("/moderate")
 	modAdmin.Use(auth.RequireRoles([]string{"admin", "moderator"}))
@@ -104,7 +91,8 @@ func main() {
 	log.Println("   GET  /api/v1/health      - Health check")
 	log.Println("   GET  /api/v1/profile     - User profile (protected)")
 	log.Println("   GET  /api/v1/dashboard   - Dashboard (protected)")
-	log.Println("   GET  /api/v1/admin/users - Admin only")
+	log.Println("   GET  /api/v1/admin/users - List users (admin only)")
+	log.Println("   PUT  /api/v1/admin/users/:id/role - Set a user's role (admin only)")
 	log.Println("")
 	log.Println("Example login request:")
 	log.Println(`   curl -X POST http://localhost:8080/api/v1/login \
@@ -163,57 +151,6 @@ func getPostHandler(c *gin.Context) {
 	})
 }
 
-func listUsersHandler(auth *authkit.AuthKit) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		users := auth.ListUsers()
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Users retrieved successfully",
-			"count":   len(users),
-			"users":   users,
-		})
-	}
-}
-
-func deleteUserHandler(auth *authkit.AuthKit) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.Param("id")
-		err := auth.DeleteUser(userID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User deleted successfully",
-		})
-	}
-}
-
-func updateUserRoleHandler(auth *authkit.AuthKit) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.Param("id")
-		var req struct {
-			Role string `json:"role" binding:"required"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		updates := map[string]interface{}{"role": req.Role}
-		updatedUser, err := auth.UpdateUser(userID, updates)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": "User role updated successfully",
-			"user":    updatedUser,
-		})
-	}
-}
-
 func approvePostHandler(c *gin.Context) {
 	postID := c.Param("id")
 	claims, _ := authkit.GetUserFromGinContext(c)
@@ -13,6 +13,7 @@ func main() {
 	// Initialize AuthKit
 	auth := authkit.New(authkit.Config{
 		JWTSecret:     "your-super-secret-jwt-key-here",
+		EncryptionKey: "your-encryption-key-here",
 		TokenExpiry:   "24h",
 		RefreshExpiry: "7d",
 		BCryptCost:    12,
@@ -38,10 +39,12 @@ func main() {
 	// API routes
 	api := app.Group("/api/v1")
 
-	// Public routes
-	api.Post("/register", auth.RegisterHandlerFiber)
-	api.Post("/login", auth.LoginHandlerFiber)
-	api.Post("/refresh", auth.RefreshHandlerFiber)
+	// Register, login, refresh, logout, profile, password, MFA, session and
+	// admin user management routes, e.g. POST /api/v1/login and
+	// GET /api/v1/admin/users
+	if err := auth.RegisterRoutesFiber(api, authkit.RouteOptions{}); err != nil {
+		log.Fatal(err)
+	}
 
 	// Health check
 	api.Get("/health", func(c *fiber.Ctx) error {
@@ -56,11 +59,6 @@ func main() {
 	protected := api.Group("")
 	protected.Use(auth.FiberMiddleware())
 
-	// User profile routes
-	protected.Get("/profile", auth.ProfileHandlerFiber)
-	protected.Put("/profile", auth.UpdateProfileHandlerFiber)
-	protected.Post("/logout", auth.LogoutHandlerFiber)
-
 	// Protected resource examples
 	protected.Get("/posts", getPostsHandlerFiber)
 	protected.Post("/posts", createPostHandlerFiber)
@@ -77,14 +75,6 @@ func main() {
 		})
 	})
 
-	// Admin routes
-	admin := protected.Group("/admin")
-	admin.Use(auth.RequireRoleFiber("admin"))
-
-	admin.Get("/users", listUsersHandlerFiber(auth))
-	admin.Delete("/users/:id", deleteUserHandlerFiber(auth))
-	admin.Put("/users/:id/role", updateUserRoleHandlerFiber(auth))
-
 	// Moderator and Admin routes
 	modAdmin := protected.Group("/moderate")
 	modAdmin.Use(auth.RequireRolesFiber([]string{"admin", "moderator"}))
@@ -100,7 +90,8 @@ func main() {
 	log.Println("   GET  /api/v1/health      - Health check")
 	log.Println("   GET  /api/v1/profile     - User profile (protected)")
 	log.Println("   GET  /api/v1/dashboard   - Dashboard (protected)")
-	log.Println("   GET  /api/v1/admin/users - Admin only")
+	log.Println("   GET  /api/v1/admin/users - List users (admin only)")
+	log.Println("   PUT  /api/v1/admin/users/:id/role - Set a user's role (admin only)")
 
 	// Start server
 	log.Fatal(app.Listen(":8080"))
@@ -155,60 +146,6 @@ func getPostHandlerFiber(c *fiber.Ctx) error {
 	})
 }
 
-func listUsersHandlerFiber(auth *authkit.AuthKit) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		users := auth.ListUsers()
-		return c.JSON(fiber.Map{
-			"message": "Users retrieved successfully",
-			"count":   len(users),
-			"users":   users,
-		})
-	}
-}
-
-func deleteUserHandlerFiber(auth *authkit.AuthKit) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userID := c.Params("id")
-		err := auth.DeleteUser(userID)
-		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
-		return c.JSON(fiber.Map{
-			"message": "User deleted successfully",
-		})
-	}
-}
-
-func updateUserRoleHandlerFiber(auth *authkit.AuthKit) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userID := c.Params("id")
-		var req struct {
-			Role string `json:"role"`
-		}
-
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
-
-		updates := map[string]interface{}{"role": req.Role}
-		updatedUser, err := auth.UpdateUser(userID, updates)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"message": "User role updated successfully",
-			"user":    updatedUser,
-		})
-	}
-}
-
 func approvePostHandlerFiber(c *fiber.Ctx) error {
 	postID := c.Params("id")
 	claims, _ := authkit.GetUserFromFiberContext(c)
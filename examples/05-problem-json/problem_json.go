@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/gin-gonic/gin"
+)
+
+// problem is an RFC 7807 problem details object
+type problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Code     string                 `json:"code"`
+	Errors   map[string]interface{} `json:"errors,omitempty"`
+}
+
+// problemJSON answers every AuthKit error with application/problem+json
+func problemJSON(resp authkit.ErrorResponse) (int, string, interface{}) {
+	return resp.Status, "application/problem+json", problem{
+		Type:     "https://errors.example.com/auth/" + resp.Code,
+		Title:    http.StatusText(resp.Status),
+		Status:   resp.Status,
+		Detail:   resp.Message,
+		Instance: resp.Path,
+		Code:     resp.Code,
+		Errors:   resp.Details,
+	}
+}
+
+// Gin server answering AuthKit errors as RFC 7807 problem details
+func main() {
+	auth := authkit.New(authkit.Config{
+		JWTSecret:      "your-super-secret-jwt-key-here",
+		ErrorResponder: problemJSON,
+	})
+	defer auth.Close()
+
+	r := gin.Default()
+	r.POST("/register", auth.RegisterHandler)
+	r.POST("/login", auth.LoginHandler)
+	r.GET("/profile", auth.GinMiddleware(), auth.ProfileHandler)
+
+	log.Println("Try: curl -i http://localhost:8080/profile")
+	log.Println(`  HTTP/1.1 401 Unauthorized`)
+	log.Println(`  Content-Type: application/problem+json`)
+	log.Println(`  {"type":"https://errors.example.com/auth/missing_authorization","title":"Unauthorized","status":401,...}`)
+	log.Fatal(r.Run(":8080"))
+}
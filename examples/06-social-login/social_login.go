@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/codedbygo/go-authkit/oauth"
+	"github.com/gin-gonic/gin"
+)
+
+// Gin server with "Sign in with Google/GitHub". Register
+// http://localhost:8080/auth/google/callback and
+// http://localhost:8080/auth/github/callback with the providers, then export
+// GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET, GITHUB_CLIENT_ID and
+// GITHUB_CLIENT_SECRET.
+func main() {
+	auth := authkit.New(authkit.Config{
+		JWTSecret: "your-super-secret-jwt-key-here",
+		// Tokens in cookies, so browsers following /auth/:provider/link are
+		// logged in
+		CookieConfig: &authkit.CookieConfig{Insecure: true},
+		// Log existing users in with providers vouching for their email
+		LinkIdentitiesByEmail: true,
+	})
+	defer auth.Close()
+
+	social, err := oauth.New(auth, oauth.Config{
+		Providers: []oauth.Provider{
+			oauth.Google(os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"), "http://localhost:8080/auth/google/callback"),
+			oauth.GitHub(os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"), "http://localhost:8080/auth/github/callback"),
+		},
+		InsecureCookies: true, // Plain HTTP on localhost only
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := gin.Default()
+	r.POST("/register", auth.RegisterHandler)
+	r.POST("/login", auth.LoginHandler)
+	r.GET("/profile", auth.GinMiddleware(), auth.ProfileHandler)
+	social.RegisterRoutes(r.Group("/auth"))
+
+	log.Println("Sign in at http://localhost:8080/auth/google or http://localhost:8080/auth/github,")
+	log.Println("then see the user at http://localhost:8080/profile")
+	log.Fatal(r.Run(":8080"))
+}
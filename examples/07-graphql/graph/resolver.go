@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/codedbygo/go-authkit/gqlauthkit"
+)
+
+// Resolver resolves the schema from the AuthKit user store. The directives
+// have checked the claims before the resolvers run.
+type Resolver struct {
+	Auth *authkit.AuthKit
+}
+
+// Query returns the resolver of the Query type
+func (r *Resolver) Query() QueryResolver {
+	return &queryResolver{r}
+}
+
+type queryResolver struct{ *Resolver }
+
+func (r *queryResolver) Me(ctx context.Context) (*User, error) {
+	claims, err := gqlauthkit.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.Auth.GetUserByIDCtx(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &User{ID: user.ID, Email: user.Email, Name: user.Name, Role: user.Role}, nil
+}
+
+func (r *queryResolver) Users(ctx context.Context) ([]*User, error) {
+	var users []*User
+	for _, user := range r.Auth.ListUsers() {
+		users = append(users, &User{ID: user.ID, Email: user.Email, Name: user.Name, Role: user.Role})
+	}
+	return users, nil
+}
+
+func (r *queryResolver) UserCount(ctx context.Context) (int, error) {
+	return len(r.Auth.ListUsers()), nil
+}
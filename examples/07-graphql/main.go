@@ -0,0 +1,44 @@
+package main
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/codedbygo/go-authkit"
+	"github.com/codedbygo/go-authkit/examples/07-graphql/graph"
+	"github.com/codedbygo/go-authkit/gqlauthkit"
+)
+
+// GraphQL server example with gqlgen, protecting fields with the
+// @auth, @hasRole and @hasPermission directives of schema.graphqls.
+// Regenerate graph/generated.go after editing the schema with go generate.
+func main() {
+	auth := authkit.New(authkit.Config{
+		JWTSecret: "your-super-secret-jwt-key-here",
+	})
+	defer auth.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", auth.RegisterHandlerHTTP)
+	mux.HandleFunc("/login", auth.LoginHandlerHTTP)
+	mux.Handle("/query", newGraphQLHandler(auth))
+
+	log.Println("GraphQL server starting on :8080")
+	log.Println(`   POST /query {"query": "{ me { email } }"} with a Bearer token`)
+	log.Fatal(http.ListenAndServe(":8080", mux))
+}
+
+// newGraphQLHandler serves the schema. OptionalHTTPMiddleware lets requests
+// without a token reach the directives, which answer the fields they protect
+// with an UNAUTHENTICATED error rather than failing the whole request.
+func newGraphQLHandler(auth *authkit.AuthKit) http.Handler {
+	config := graph.Config{Resolvers: &graph.Resolver{Auth: auth}}
+	config.Directives.Auth = gqlauthkit.DirectiveAuth(auth)
+	config.Directives.HasRole = gqlauthkit.DirectiveHasRole(auth)
+	config.Directives.HasPermission = gqlauthkit.DirectiveHasPermission
+
+	return auth.OptionalHTTPMiddleware(handler.NewDefaultServer(graph.NewExecutableSchema(config)))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/codedbygo/go-authkit"
+)
+
+// gqlError is an entry of the errors of a GraphQL response
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// query runs a query with the access token, if any, returning the data and errors
+func query(t *testing.T, c *client.Client, q, accessToken string) (map[string]interface{}, []gqlError) {
+	t.Helper()
+	var opts []client.Option
+	if accessToken != "" {
+		opts = append(opts, client.AddHeader("Authorization", "Bearer "+accessToken))
+	}
+	resp, err := c.RawPost(q, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []gqlError
+	if resp.Errors != nil {
+		if err := json.Unmarshal(resp.Errors, &errs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	return data, errs
+}
+
+// login registers a user and returns an access token
+func login(t *testing.T, auth *authkit.AuthKit, req authkit.RegisterRequest) string {
+	t.Helper()
+	if _, err := auth.AdminCreateUser(req); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoginUser(req.Email, req.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
+func TestGraphQLDirectives(t *testing.T) {
+	auth := authkit.New(authkit.Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+	defer auth.Close()
+	if err := auth.DefineRole("admin", []string{"stats:read"}); err != nil {
+		t.Fatal(err)
+	}
+	userToken := login(t, auth, authkit.RegisterRequest{Email: "user@example.com", Password: "password123", Name: "User"})
+	adminToken := login(t, auth, authkit.RegisterRequest{Email: "admin@example.com", Password: "password123", Name: "Admin", Role: "admin"})
+	c := client.New(newGraphQLHandler(auth))
+
+	tests := []struct {
+		name  string
+		query string
+		token string
+		code  string // Extension code of the expected error, or empty
+	}{
+		{"me without a token", `{ me { email } }`, "", "UNAUTHENTICATED"},
+		{"me", `{ me { email } }`, userToken, ""},
+		{"users without a token", `{ users { email } }`, "", "UNAUTHENTICATED"},
+		{"users as a user", `{ users { email } }`, userToken, "FORBIDDEN"},
+		{"users as an admin", `{ users { email } }`, adminToken, ""},
+		{"userCount without the permission", `{ userCount }`, userToken, "FORBIDDEN"},
+		{"userCount with the permission", `{ userCount }`, adminToken, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, errs := query(t, c, tt.query, tt.token)
+			if tt.code == "" {
+				if len(errs) != 0 {
+					t.Fatalf("Expected no errors, got %+v", errs)
+				}
+				if len(data) == 0 {
+					t.Fatal("Expected data")
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Extensions["code"] != tt.code {
+				t.Fatalf("Expected a %s error, got %+v", tt.code, errs)
+			}
+			if len(errs[0].Path) != 1 {
+				t.Errorf("Expected the error on the field, got path %v", errs[0].Path)
+			}
+		})
+	}
+
+	data, _ := query(t, c, `{ me { email role } }`, adminToken)
+	if me, _ := data["me"].(map[string]interface{}); me["email"] != "admin@example.com" || me["role"] != "admin" {
+		t.Errorf("Expected the admin's profile, got %v", data)
+	}
+}
@@ -0,0 +1,411 @@
+package authkit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportFormat is the file format of ExportUsers and ImportUsers
+type ExportFormat string
+
+const (
+	// ExportJSON is a JSON array of ExportedUser
+	ExportJSON ExportFormat = "json"
+	// ExportCSV has a header row and one ExportedUser per row. Permissions are
+	// separated by semicolons and metadata is a JSON object.
+	ExportCSV ExportFormat = "csv"
+)
+
+// exportCSVHeader is the column order of CSV exports. Imports only need the
+// email and password columns, in any order.
+var exportCSVHeader = []string{"id", "email", "password", "name", "role", "permissions", "email_verified", "disabled", "metadata", "created_at", "tenant_id"}
+
+// ExportedUser is a user as written by ExportUsers and ExportUser and read by
+// ImportUsers. Unlike User, it marshals the password hash. TOTP secrets and
+// recovery codes are not exported, so users have to set up two-factor
+// authentication again after a migration.
+type ExportedUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// Password is the bcrypt or Argon2id hash on export. On import it may also be a
+	// plaintext password, which is checked against the policy and hashed.
+	Password      string                 `json:"password"`
+	Name          string                 `json:"name"`
+	Role          string                 `json:"role"`
+	Permissions   []string               `json:"permissions"`
+	EmailVerified bool                   `json:"email_verified"`
+	Disabled      bool                   `json:"disabled,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	TenantID      string                 `json:"tenant_id,omitempty"`
+}
+
+// ImportOptions controls ImportUsers
+type ImportOptions struct {
+	// Strategy decides what happens to rows whose email is already registered
+	// (default: SeedSkipExisting)
+	Strategy SeedStrategy
+	// NewIDs gives imported users fresh IDs instead of the ones in the file
+	NewIDs bool
+}
+
+// ImportRowError is a row ImportUsers could not import
+type ImportRowError struct {
+	Row   int    `json:"row"` // 1-based, not counting the CSV header
+	Email string `json:"email"`
+	Err   error  `json:"-"`
+	Code  string `json:"error"` // ErrorCode of Err
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("import: row %d (%s): %v", e.Row, e.Email, e.Err)
+}
+
+// ImportReport counts what ImportUsers did with each row
+type ImportReport struct {
+	Imported int              `json:"imported"`
+	Updated  int              `json:"updated"`
+	Skipped  int              `json:"skipped"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// UserDataExport is the bundle ExportUserData returns for a user's data
+// access request
+type UserDataExport struct {
+	ExportedAt   time.Time    `json:"exported_at"`
+	User         *UserInfo    `json:"user"`
+	Sessions     []Session    `json:"sessions"`
+	LoginHistory []LoginEvent `json:"login_history"`
+}
+
+// ExportUser returns a user for migrating to another store, including the
+// password hash, which User never marshals. Treat it like the user store itself.
+func (a *AuthKit) ExportUser(userID string) (*ExportedUser, error) {
+	a.debugCheck()
+
+	user, exists := a.users.get(userID)
+	if !exists || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	exported := exportedUser(user)
+	return &exported, nil
+}
+
+// exportedUser copies a stored user for export
+func exportedUser(user *User) ExportedUser {
+	return ExportedUser{
+		ID:            user.ID,
+		Email:         user.Email,
+		Password:      user.Password,
+		Name:          user.Name,
+		Role:          user.Role,
+		Permissions:   append([]string{}, user.Permissions...),
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+		Metadata:      copyMetadata(user.Metadata),
+		CreatedAt:     user.CreatedAt,
+		TenantID:      user.TenantID,
+	}
+}
+
+// ExportUsers writes every user, ordered by email and tenant, including password hashes
+// so users can log in after ImportUsers. Soft-deleted users are left out.
+// Treat the output like the user store itself.
+func (a *AuthKit) ExportUsers(w io.Writer, format ExportFormat) error {
+	a.debugCheck()
+
+	if format != ExportJSON && format != ExportCSV {
+		return fmt.Errorf("export: unsupported format %q", format)
+	}
+
+	a.mutex.RLock()
+	stored := a.users.all()
+	users := make([]ExportedUser, 0, len(stored))
+	for _, user := range stored {
+		if user.DeletedAt == nil {
+			users = append(users, exportedUser(user))
+		}
+	}
+	a.mutex.RUnlock()
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Email != users[j].Email {
+			return users[i].Email < users[j].Email
+		}
+		return users[i].TenantID < users[j].TenantID
+	})
+
+	if format == ExportJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(users)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+	for _, user := range users {
+		metadata := ""
+		if len(user.Metadata) > 0 {
+			raw, err := json.Marshal(user.Metadata)
+			if err != nil {
+				return fmt.Errorf("export: metadata of %s: %w", user.Email, err)
+			}
+			metadata = string(raw)
+		}
+		if err := writer.Write([]string{
+			user.ID, user.Email, user.Password, user.Name, user.Role,
+			strings.Join(user.Permissions, ";"),
+			strconv.FormatBool(user.EmailVerified),
+			strconv.FormatBool(user.Disabled),
+			metadata,
+			user.CreatedAt.UTC().Format(time.RFC3339),
+			user.TenantID,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ImportUsers reads users written by ExportUsers, or by another system in the
+// same format. Passwords that are bcrypt or Argon2id hashes are stored as they are;
+// anything else is treated as plaintext, checked against the password policy
+// and hashed. Invalid rows are reported in ImportReport.Errors without
+// stopping the import. The returned error is for input that can't be read
+// at all, such as malformed JSON or a CSV header without an email column.
+func (a *AuthKit) ImportUsers(r io.Reader, format ExportFormat, opts ImportOptions) (*ImportReport, error) {
+	a.debugCheck()
+
+	var rows []ExportedUser
+	var rowErrs []error
+	switch format {
+	case ExportJSON:
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+		rowErrs = make([]error, len(rows))
+	case ExportCSV:
+		var err error
+		if rows, rowErrs, err = readExportCSV(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("import: unsupported format %q", format)
+	}
+
+	report := &ImportReport{Errors: make([]ImportRowError, 0)}
+	for i, row := range rows {
+		err := rowErrs[i]
+		if err == nil {
+			err = a.importUser(row, opts, report)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, ImportRowError{Row: i + 1, Email: row.Email, Err: err, Code: ErrorCode(err)})
+		}
+	}
+	return report, nil
+}
+
+// readExportCSV parses CSV rows, reporting unparseable fields per row
+func readExportCSV(r io.Reader) ([]ExportedUser, []error, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("import: reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"email", "password"} {
+		if _, exists := columns[name]; !exists {
+			return nil, nil, fmt.Errorf("import: CSV header is missing the %s column", name)
+		}
+	}
+
+	var rows []ExportedUser
+	var rowErrs []error
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("import: %w", err)
+		}
+		field := func(name string) string {
+			if i, exists := columns[name]; exists && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ExportedUser{
+			ID:       field("id"),
+			Email:    field("email"),
+			Password: field("password"),
+			Name:     field("name"),
+			Role:     field("role"),
+			TenantID: field("tenant_id"),
+		}
+		if permissions := field("permissions"); permissions != "" {
+			row.Permissions = strings.Split(permissions, ";")
+		}
+		rows = append(rows, row)
+		rowErrs = append(rowErrs, parseCSVRow(&rows[len(rows)-1], field))
+	}
+	return rows, rowErrs, nil
+}
+
+// parseCSVRow fills in the row's typed columns
+func parseCSVRow(row *ExportedUser, field func(string) string) error {
+	var err error
+	if value := field("email_verified"); value != "" {
+		if row.EmailVerified, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid email_verified %q", value)
+		}
+	}
+	if value := field("disabled"); value != "" {
+		if row.Disabled, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid disabled %q", value)
+		}
+	}
+	if value := field("metadata"); value != "" {
+		if err := json.Unmarshal([]byte(value), &row.Metadata); err != nil {
+			return fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	if value := field("created_at"); value != "" {
+		if row.CreatedAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("invalid created_at %q", value)
+		}
+	}
+	return nil
+}
+
+// importUser stores one imported row, counting it in the report
+func (a *AuthKit) importUser(row ExportedUser, opts ImportOptions, report *ImportReport) error {
+	email, err := a.NormalizeEmail(row.Email)
+	if err != nil {
+		return err
+	}
+
+	password := row.Password
+	if !isPasswordHash(password) {
+		if err := a.CheckPassword(password, email); err != nil {
+			return err
+		}
+		if password, err = a.HashPassword(password); err != nil {
+			return err
+		}
+	}
+
+	role := row.Role
+	if role == "" {
+		role = defaultRole
+	}
+	now := a.now()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if stored := a.findUserByEmail(row.TenantID, email); stored != nil {
+		if opts.Strategy != SeedUpdateExisting {
+			report.Skipped++
+			return nil
+		}
+		existing := cloneUser(stored)
+		a.setPassword(existing, password)
+		existing.Name = row.Name
+		existing.Role = role
+		existing.Permissions = append([]string{}, row.Permissions...)
+		existing.EmailVerified = row.EmailVerified
+		if existing.Disabled != row.Disabled {
+			existing.Disabled = row.Disabled
+			existing.DisabledReason = ""
+			existing.DisabledAt = nil
+			if row.Disabled {
+				existing.DisabledAt = &now
+			}
+		}
+		existing.Metadata = copyMetadata(row.Metadata)
+		existing.UpdatedAt = now
+		a.users.put(existing)
+		report.Updated++
+		return nil
+	}
+	if a.emailTaken(row.TenantID, email, "") {
+		return ErrUserAlreadyExists
+	}
+
+	id := row.ID
+	if id == "" || opts.NewIDs {
+		id = uuid.New().String()
+	} else if _, exists := a.users.get(id); exists {
+		return fmt.Errorf("%w: ID %s is taken", ErrUserAlreadyExists, id)
+	}
+
+	createdAt := row.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	user := &User{
+		ID:            id,
+		TenantID:      row.TenantID,
+		Email:         email,
+		Password:      password,
+		Name:          row.Name,
+		Role:          role,
+		Permissions:   append([]string{}, row.Permissions...),
+		EmailVerified: row.EmailVerified,
+		Disabled:      row.Disabled,
+		CreatedAt:     createdAt,
+		UpdatedAt:     now,
+		Metadata:      copyMetadata(row.Metadata),
+	}
+	if row.Disabled {
+		user.DisabledAt = &now
+	}
+	a.users.put(user)
+	report.Imported++
+	return nil
+}
+
+// ExportUserData returns everything AuthKit holds about a user as indented
+// JSON, for data access requests: the profile and metadata, sessions and
+// login history. Password hashes and TOTP secrets are left out.
+func (a *AuthKit) ExportUserData(userID string) ([]byte, error) {
+	a.debugCheck()
+
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := a.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := a.GetLoginHistory(userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(UserDataExport{
+		ExportedAt:   a.now(),
+		User:         a.userToUserInfo(user),
+		Sessions:     sessions,
+		LoginHistory: history,
+	}, "", "  ")
+}
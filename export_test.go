@@ -0,0 +1,225 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []ExportFormat{ExportJSON, ExportCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			source := newTestKit(t, Config{SoftDelete: true})
+			defer source.Close()
+			alice, _ := source.AdminCreateUser(RegisterRequest{
+				Email: "alice@example.com", Password: "alice-password", Name: "Alice", Role: "admin",
+				Metadata: map[string]interface{}{"plan": "pro"},
+			})
+			_, _ = source.UpdateUser(alice.ID, map[string]interface{}{"permissions": []string{"read", "write"}})
+			bob, _ := source.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "bob-password", Name: "Bob"})
+			_ = source.DisableUser(bob.ID, "")
+			gone, _ := source.RegisterUser(RegisterRequest{Email: "gone@example.com", Password: "gone-password", Name: "Gone"})
+			_ = source.DeleteUser(gone.ID)
+
+			var buf bytes.Buffer
+			if err := source.ExportUsers(&buf, format); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(buf.String(), "gone@example.com") {
+				t.Error("Expected soft-deleted users to be left out")
+			}
+
+			target := newTestKit(t, Config{})
+			defer target.Close()
+			report, err := target.ImportUsers(&buf, format, ImportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Imported != 2 || len(report.Errors) != 0 {
+				t.Fatalf("Expected two imported users, got %+v", report)
+			}
+
+			tokens, err := target.LoginUser("alice@example.com", "alice-password")
+			if err != nil {
+				t.Fatalf("Expected the password to survive the migration, got %v", err)
+			}
+			got := tokens.User
+			if got.ID != alice.ID || got.Name != "Alice" || got.Role != "admin" || got.Metadata["plan"] != "pro" ||
+				strings.Join(got.Permissions, ",") != "read,write" {
+				t.Errorf("Expected alice to round-trip, got %+v", got)
+			}
+			original, _ := source.GetUserByID(alice.ID)
+			if stored, _ := target.GetUserByID(alice.ID); stored.CreatedAt.Sub(original.CreatedAt).Abs() >= time.Second {
+				t.Errorf("Expected the creation time to be kept, got %v and %v", stored.CreatedAt, original.CreatedAt)
+			}
+			if _, err := target.LoginUser("bob@example.com", "bob-password"); !errors.Is(err, ErrUserDisabled) {
+				t.Errorf("Expected bob to stay disabled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	existing := loginTestUser(t, auth, "existing@example.com").User
+
+	csv := "email,password,name,email_verified\n" +
+		"plain@example.com,plain-password,Plain,true\n" +
+		"existing@example.com,other-password,Updated,\n" +
+		"weak@example.com,short,Weak,\n" +
+		"not-an-email,password123,Invalid,\n" +
+		"flag@example.com,password123,Flag,maybe\n"
+
+	report, err := auth.ImportUsers(strings.NewReader(csv), ExportCSV, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || report.Skipped != 1 || report.Updated != 0 || len(report.Errors) != 3 {
+		t.Fatalf("Expected 1 imported, 1 skipped and 3 errors, got %+v", report)
+	}
+	wantRows := []int{3, 4, 5}
+	wantCodes := []string{CodeWeakPassword, CodeInvalidEmail, CodeInternalError}
+	for i, rowErr := range report.Errors {
+		if rowErr.Row != wantRows[i] || rowErr.Code != wantCodes[i] || rowErr.Err == nil {
+			t.Errorf("Expected row %d to fail with %s, got %+v", wantRows[i], wantCodes[i], rowErr)
+		}
+	}
+
+	plain, err := auth.LoginUser("plain@example.com", "plain-password")
+	if err != nil {
+		t.Fatalf("Expected the plaintext password to be hashed, got %v", err)
+	}
+	if !plain.User.EmailVerified {
+		t.Error("Expected email_verified to be imported")
+	}
+	if stored, _ := auth.GetUserByEmail("plain@example.com"); !strings.HasPrefix(stored.Password, "$2") {
+		t.Errorf("Expected a bcrypt hash to be stored, got %q", stored.Password)
+	}
+
+	report, _ = auth.ImportUsers(strings.NewReader(csv), ExportCSV, ImportOptions{Strategy: SeedUpdateExisting})
+	if report.Updated != 2 || report.Imported != 0 {
+		t.Errorf("Expected both existing users to be updated, got %+v", report)
+	}
+	if updated, _ := auth.GetUserByID(existing.ID); updated.Name != "Updated" {
+		t.Errorf("Expected the existing user to be updated, got %+v", updated)
+	}
+	if _, err := auth.LoginUser("existing@example.com", "other-password"); err != nil {
+		t.Errorf("Expected the updated password, got %v", err)
+	}
+
+	if _, err := auth.ImportUsers(strings.NewReader("name\nNo Email\n"), ExportCSV, ImportOptions{}); err == nil {
+		t.Error("Expected an error for a CSV header without an email column")
+	}
+	if _, err := auth.ImportUsers(strings.NewReader("{"), ExportJSON, ImportOptions{}); err == nil {
+		t.Error("Expected an error for malformed JSON")
+	}
+	if _, err := auth.ImportUsers(strings.NewReader(""), "xml", ImportOptions{}); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestImportUsersIDs(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	taken := loginTestUser(t, auth, "taken@example.com").User
+
+	rows := `[
+		{"id": "legacy-1", "email": "kept@example.com", "password": "password123"},
+		{"id": "legacy-2", "email": "fresh@example.com", "password": "password123"},
+		{"id": "` + taken.ID + `", "email": "clash@example.com", "password": "password123"}
+	]`
+	report, err := auth.ImportUsers(strings.NewReader(rows), ExportJSON, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0].Code != CodeUserAlreadyExists {
+		t.Fatalf("Expected the clashing ID to be reported, got %+v", report)
+	}
+	if user, err := auth.GetUserByID("legacy-1"); err != nil || user.Email != "kept@example.com" {
+		t.Errorf("Expected the ID from the file to be kept, got %+v, %v", user, err)
+	}
+
+	report, _ = auth.ImportUsers(strings.NewReader(`[{"id": "legacy-3", "email": "new@example.com", "password": "password123"}]`), ExportJSON, ImportOptions{NewIDs: true})
+	if report.Imported != 1 {
+		t.Fatalf("Expected one import, got %+v", report)
+	}
+	if _, err := auth.GetUserByID("legacy-3"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected a fresh ID with NewIDs, got %v", err)
+	}
+}
+
+func TestExportUserData(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{
+		Email: "gdpr@example.com", Password: "password123", Name: "GDPR",
+		Metadata: map[string]interface{}{"newsletter": true},
+	})
+	_, _ = auth.LoginUser("gdpr@example.com", "wrong-password")
+	tokens, _ := auth.LoginUser("gdpr@example.com", "password123", LoginContext{IP: "203.0.113.9"})
+
+	raw, err := auth.ExportUserData(tokens.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "$2") {
+		t.Errorf("Expected no password hash in the export, got %s", raw)
+	}
+
+	var bundle UserDataExport
+	if err := json.Unmarshal(raw, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.User.Email != "gdpr@example.com" || bundle.User.Metadata["newsletter"] != true || bundle.ExportedAt.IsZero() {
+		t.Errorf("Expected the profile and metadata, got %+v", bundle.User)
+	}
+	if len(bundle.LoginHistory) != 2 || bundle.LoginHistory[0].IP != "203.0.113.9" || bundle.LoginHistory[1].Success {
+		t.Errorf("Expected both login attempts, got %+v", bundle.LoginHistory)
+	}
+	if len(bundle.Sessions) != 1 || bundle.Sessions[0].ID != tokens.SessionID {
+		t.Errorf("Expected the session, got %+v", bundle.Sessions)
+	}
+
+	if _, err := auth.ExportUserData("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUserJSONOmitsPasswordHash(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	info, _ := auth.RegisterUser(RegisterRequest{Email: "hash@example.com", Password: "password123", Name: "Hash"})
+	user, err := auth.GetUserByID(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []interface{}{user, *user, []*User{user}, map[string]interface{}{"user": user}} {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(raw), user.Password) || strings.Contains(string(raw), `"password"`) {
+			t.Errorf("Expected no password hash, got %s", raw)
+		}
+		if !strings.Contains(string(raw), `"email":"hash@example.com"`) {
+			t.Errorf("Expected the other fields, got %s", raw)
+		}
+	}
+
+	exported, err := auth.ExportUser(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(exported)
+	if !strings.Contains(string(raw), user.Password) {
+		t.Errorf("Expected ExportUser to include the hash, got %s", raw)
+	}
+	if _, err := auth.ExportUser("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package gqlauthkit adapts AuthKit to gqlgen, so applications not using
+// GraphQL don't depend on gqlgen through authkit. Its directives and resolver
+// helpers read the claims authkit's net/http middleware stored in the request
+// context, and fail with GraphQL errors carrying an UNAUTHENTICATED or
+// FORBIDDEN extension code.
+//
+//	c := graph.Config{Resolvers: &graph.Resolver{}}
+//	c.Directives.Auth = gqlauthkit.DirectiveAuth(auth)
+//	c.Directives.HasRole = gqlauthkit.DirectiveHasRole(auth)
+//	c.Directives.HasPermission = gqlauthkit.DirectiveHasPermission
+//	srv := handler.NewDefaultServer(graph.NewExecutableSchema(c))
+//	http.Handle("/query", auth.OptionalHTTPMiddleware(srv))
+package gqlauthkit
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/codedbygo/go-authkit"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Extension codes of the errors, in the "code" extension
+const (
+	// CodeUnauthenticated rejects requests without claims
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	// CodeForbidden rejects claims without the required role or permission
+	CodeForbidden = "FORBIDDEN"
+)
+
+// ClaimsFromContext returns the claims authkit's HTTPMiddleware or
+// OptionalHTTPMiddleware stored in the context of the request
+func ClaimsFromContext(ctx context.Context) (*authkit.Claims, bool) {
+	return authkit.GetUserFromContext(ctx)
+}
+
+// RequireUser returns the claims of the request for resolvers, or an
+// UNAUTHENTICATED error without them
+//
+//	func (r *queryResolver) Me(ctx context.Context) (*User, error) {
+//	    claims, err := gqlauthkit.RequireUser(ctx)
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    ...
+//	}
+func RequireUser(ctx context.Context) (*authkit.Claims, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, Unauthenticated(ctx)
+	}
+	return claims, nil
+}
+
+// DirectiveAuth implements an @auth(role: String) directive, requiring
+// claims and, when role is given, a role satisfying it (see
+// authkit.AuthKit.RoleSatisfies)
+//
+//	directive @auth(role: String) on FIELD_DEFINITION
+func DirectiveAuth(auth *authkit.AuthKit) func(ctx context.Context, obj interface{}, next graphql.Resolver, role *string) (interface{}, error) {
+	return func(ctx context.Context, obj interface{}, next graphql.Resolver, role *string) (interface{}, error) {
+		claims, err := RequireUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && !auth.RoleSatisfies(claims.Role, *role) {
+			return nil, Forbidden(ctx)
+		}
+		return next(ctx)
+	}
+}
+
+// DirectiveHasRole implements a @hasRole(role: String!) directive, requiring
+// a role satisfying role
+//
+//	directive @hasRole(role: String!) on FIELD_DEFINITION
+func DirectiveHasRole(auth *authkit.AuthKit) func(ctx context.Context, obj interface{}, next graphql.Resolver, role string) (interface{}, error) {
+	return func(ctx context.Context, obj interface{}, next graphql.Resolver, role string) (interface{}, error) {
+		return DirectiveAuth(auth)(ctx, obj, next, &role)
+	}
+}
+
+// DirectiveHasPermission implements a @hasPermission(permission: String!)
+// directive, requiring claims with the permission
+//
+//	directive @hasPermission(permission: String!) on FIELD_DEFINITION
+func DirectiveHasPermission(ctx context.Context, obj interface{}, next graphql.Resolver, permission string) (interface{}, error) {
+	claims, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.HasPermission(permission) {
+		return nil, Forbidden(ctx)
+	}
+	return next(ctx)
+}
+
+// Unauthenticated returns the error for a field requested without claims
+func Unauthenticated(ctx context.Context) *gqlerror.Error {
+	return fieldError(ctx, "authentication required", CodeUnauthenticated)
+}
+
+// Forbidden returns the error for a field the claims don't allow
+func Forbidden(ctx context.Context) *gqlerror.Error {
+	return fieldError(ctx, "insufficient permissions", CodeForbidden)
+}
+
+// fieldError returns an error on the field resolved with ctx
+func fieldError(ctx context.Context, message, code string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Path:       graphql.GetPath(ctx),
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
@@ -0,0 +1,147 @@
+package gqlauthkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// requestContext returns the context HTTPMiddleware passes on for a request
+// with the access token
+func requestContext(t *testing.T, auth *authkit.AuthKit, accessToken string) context.Context {
+	t.Helper()
+	var ctx context.Context
+	handler := auth.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if ctx == nil {
+		t.Fatal("Expected the middleware to accept the token")
+	}
+	return ctx
+}
+
+// loginContext registers a user with the role and returns the context of a
+// request with their access token
+func loginContext(t *testing.T, auth *authkit.AuthKit, email, role string) context.Context {
+	t.Helper()
+	req := authkit.RegisterRequest{Email: email, Password: "password123", Name: "Test", Role: role}
+	if _, err := auth.AdminCreateUser(req); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoginUser(email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requestContext(t, auth, tokens.AccessToken)
+}
+
+// resolved is a resolver recording that the directive called it
+func resolved(called *bool) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		*called = true
+		return "ok", nil
+	}
+}
+
+// errorCode returns the extension code of a GraphQL error
+func errorCode(err error) string {
+	gqlErr, ok := err.(*gqlerror.Error)
+	if !ok {
+		return ""
+	}
+	code, _ := gqlErr.Extensions["code"].(string)
+	return code
+}
+
+func TestRequireUser(t *testing.T) {
+	auth := authkit.New(authkit.Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+	defer auth.Close()
+	ctx := loginContext(t, auth, "user@example.com", "")
+
+	claims, err := RequireUser(ctx)
+	if err != nil || claims.Email != "user@example.com" {
+		t.Fatalf("Expected the claims of the request, got %v, %v", claims, err)
+	}
+	if _, ok := ClaimsFromContext(context.Background()); ok {
+		t.Error("Expected no claims without the middleware")
+	}
+	if _, err := RequireUser(context.Background()); errorCode(err) != CodeUnauthenticated {
+		t.Errorf("Expected an UNAUTHENTICATED error, got %v", err)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	auth := authkit.New(authkit.Config{
+		JWTSecret:     "test-secret-key-for-testing-only",
+		BCryptCost:    4,
+		RoleHierarchy: map[string][]string{"admin": {"moderator"}},
+	})
+	defer auth.Close()
+	for role, permissions := range map[string][]string{"user": {"posts:write"}, "moderator": nil, "admin": nil} {
+		if err := auth.DefineRole(role, permissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := loginContext(t, auth, "user@example.com", "")
+	moderator := loginContext(t, auth, "moderator@example.com", "moderator")
+	admin := loginContext(t, auth, "admin@example.com", "admin")
+	role := func(name string) *string { return &name }
+
+	tests := []struct {
+		name      string
+		directive func(ctx context.Context, next func(ctx context.Context) (interface{}, error)) (interface{}, error)
+		ctx       context.Context
+		code      string // Expected extension code, or empty to resolve
+	}{
+		{"auth without claims", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveAuth(auth)(ctx, nil, next, nil)
+		}, context.Background(), CodeUnauthenticated},
+		{"auth", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveAuth(auth)(ctx, nil, next, nil)
+		}, user, ""},
+		{"auth with a role", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveAuth(auth)(ctx, nil, next, role("admin"))
+		}, moderator, CodeForbidden},
+		{"hasRole", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasRole(auth)(ctx, nil, next, "moderator")
+		}, moderator, ""},
+		{"hasRole inherited", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasRole(auth)(ctx, nil, next, "moderator")
+		}, admin, ""},
+		{"hasRole denied", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasRole(auth)(ctx, nil, next, "moderator")
+		}, user, CodeForbidden},
+		{"hasPermission", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasPermission(ctx, nil, next, "posts:write")
+		}, user, ""},
+		{"hasPermission denied", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasPermission(ctx, nil, next, "posts:write")
+		}, admin, CodeForbidden},
+		{"hasPermission without claims", func(ctx context.Context, next func(context.Context) (interface{}, error)) (interface{}, error) {
+			return DirectiveHasPermission(ctx, nil, next, "posts:write")
+		}, context.Background(), CodeUnauthenticated},
+	}
+	for _, tt := range tests {
+		var called bool
+		res, err := tt.directive(tt.ctx, resolved(&called))
+		if tt.code == "" {
+			if err != nil || res != "ok" || !called {
+				t.Errorf("%s: expected the field to resolve, got %v, %v", tt.name, res, err)
+			}
+			continue
+		}
+		if errorCode(err) != tt.code {
+			t.Errorf("%s: expected a %s error, got %v", tt.name, tt.code, err)
+		}
+		if called {
+			t.Errorf("%s: expected the field not to resolve", tt.name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor that validates the
+// "authorization: Bearer <token>" metadata of unary calls and stores the
+// claims in the context (see GetUserFromGRPCContext). Methods listed in
+// Config.GRPCPublicMethods are let through without a token.
+func (a *AuthKit) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if a.grpcPublicMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, err := a.grpcAuthenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls
+func (a *AuthKit) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if a.grpcPublicMethod(info.FullMethod) {
+			return handler(srv, stream)
+		}
+
+		ctx, err := a.grpcAuthenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &grpcAuthStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// RequireRoleGRPC returns a unary interceptor, chained after
+// UnaryServerInterceptor, that requires a specific role
+func (a *AuthKit) RequireRoleGRPC(role string) grpc.UnaryServerInterceptor {
+	return a.grpcUnaryCheck(a.grpcRoleCheck(role))
+}
+
+// RequireRoleGRPCStream is RequireRoleGRPC for streaming calls
+func (a *AuthKit) RequireRoleGRPCStream(role string) grpc.StreamServerInterceptor {
+	return a.grpcStreamCheck(a.grpcRoleCheck(role))
+}
+
+// RequirePermissionGRPC returns a unary interceptor, chained after
+// UnaryServerInterceptor, that requires a specific permission
+func (a *AuthKit) RequirePermissionGRPC(permission string) grpc.UnaryServerInterceptor {
+	return a.grpcUnaryCheck(grpcPermissionCheck(permission))
+}
+
+// RequirePermissionGRPCStream is RequirePermissionGRPC for streaming calls
+func (a *AuthKit) RequirePermissionGRPCStream(permission string) grpc.StreamServerInterceptor {
+	return a.grpcStreamCheck(grpcPermissionCheck(permission))
+}
+
+// GetUserFromGRPCContext extracts user information stored by the gRPC interceptors
+func GetUserFromGRPCContext(ctx context.Context) (*Claims, bool) {
+	return GetUserFromContext(ctx)
+}
+
+// grpcAuthenticate validates the bearer token in the incoming metadata and
+// returns a context carrying its claims
+func (a *AuthKit) grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		return nil, a.grpcError(ctx, codes.Unauthenticated, CodeMissingAuthorization)
+	}
+
+	tokenString, ok := bearerToken(values[0])
+	if !ok {
+		return nil, a.grpcError(ctx, codes.Unauthenticated, CodeInvalidAuthorizationFormat)
+	}
+
+	claims, err := a.ValidateTokenCtx(ctx, tokenString)
+	if err != nil {
+		code := ErrorCode(err)
+		if errors.Is(err, ErrTokenExpired) {
+			code = CodeTokenExpired
+		}
+		return nil, a.grpcError(ctx, codes.Unauthenticated, code)
+	}
+	if claims.PasswordChangeRequired {
+		return nil, a.grpcError(ctx, codes.PermissionDenied, CodePasswordChangeRequired)
+	}
+
+	a.traceAuthenticated(ctx, claims)
+	return context.WithValue(ctx, claimsContextKey{}, claims), nil
+}
+
+// grpcUnaryCheck turns an authorization check into a unary interceptor
+func (a *AuthKit) grpcUnaryCheck(allowed func(*Claims) bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.grpcAuthorize(ctx, info.FullMethod, allowed); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcStreamCheck turns an authorization check into a stream interceptor
+func (a *AuthKit) grpcStreamCheck(allowed func(*Claims) bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.grpcAuthorize(stream.Context(), info.FullMethod, allowed); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// grpcAuthorize applies an authorization check to the claims in ctx. Public
+// methods carry no claims and are let through.
+func (a *AuthKit) grpcAuthorize(ctx context.Context, method string, allowed func(*Claims) bool) error {
+	if a.grpcPublicMethod(method) {
+		return nil
+	}
+
+	claims, exists := GetUserFromGRPCContext(ctx)
+	if !exists {
+		return a.grpcError(ctx, codes.Unauthenticated, CodeNotAuthenticated)
+	}
+	if !allowed(claims) {
+		return a.grpcError(ctx, codes.PermissionDenied, CodeInsufficientPermissions)
+	}
+	return nil
+}
+
+// grpcRoleCheck requires a specific role, or one inheriting it
+func (a *AuthKit) grpcRoleCheck(role string) func(*Claims) bool {
+	return func(claims *Claims) bool {
+		return a.RoleSatisfies(claims.Role, role)
+	}
+}
+
+// grpcPermissionCheck requires a specific permission
+func grpcPermissionCheck(permission string) func(*Claims) bool {
+	return func(claims *Claims) bool {
+		return claims.HasPermission(permission)
+	}
+}
+
+// grpcPublicMethod reports whether method is listed in Config.GRPCPublicMethods
+func (a *AuthKit) grpcPublicMethod(method string) bool {
+	for _, public := range a.config.GRPCPublicMethods {
+		if public == method {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcError builds a status error with a localized message, prefixed with
+// the stable error code. The locale comes from "accept-language" metadata.
+func (a *AuthKit) grpcError(ctx context.Context, grpcCode codes.Code, code string) error {
+	method, _ := grpc.Method(ctx)
+	a.logRejection(ctx, method, code)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	locale := a.resolveLocale("", strings.Join(md.Get("accept-language"), ","))
+	return status.Error(grpcCode, code+": "+a.config.Messages.Message(locale, code))
+}
+
+// grpcAuthStream overrides the context of a server stream with one carrying claims
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the authenticated context
+func (s *grpcAuthStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,137 @@
+package authkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream is a grpc.ServerStream that only carries a context
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcContext(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth := newTestKit(t, Config{
+		GRPCPublicMethods: []string{"/grpc.health.v1.Health/Check"},
+	})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "grpc@example.com")
+
+	interceptor := auth.UnaryServerInterceptor()
+	var seen *Claims
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		seen, _ = GetUserFromGRPCContext(ctx)
+		return "ok", nil
+	}
+	call := func(ctx context.Context, method string) error {
+		seen = nil
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	if err := call(grpcContext("authorization", "Bearer "+tokens.AccessToken), "/api.Users/Get"); err != nil {
+		t.Fatalf("Expected a valid token to pass, got %v", err)
+	}
+	if seen == nil || seen.UserID != tokens.User.ID {
+		t.Errorf("Expected the claims in the handler context, got %+v", seen)
+	}
+
+	cases := map[string]struct {
+		ctx  context.Context
+		code string
+	}{
+		"missing": {context.Background(), CodeMissingAuthorization},
+		"format":  {grpcContext("authorization", "Token abc"), CodeInvalidAuthorizationFormat},
+		"invalid": {grpcContext("authorization", "Bearer garbage"), CodeInvalidToken},
+	}
+	for name, tc := range cases {
+		err := call(tc.ctx, "/api.Users/Get")
+		if status.Code(err) != codes.Unauthenticated || !strings.HasPrefix(status.Convert(err).Message(), tc.code+": ") {
+			t.Errorf("%s: expected Unauthenticated %s, got %v", name, tc.code, err)
+		}
+	}
+	if err := call(grpcContext("authorization", "Bearer garbage", "accept-language", "fr"), "/api.Users/Get"); !strings.Contains(err.Error(), "Jeton invalide") {
+		t.Errorf("Expected a French message, got %v", err)
+	}
+
+	if err := call(context.Background(), "/grpc.health.v1.Health/Check"); err != nil {
+		t.Errorf("Expected the public method to pass without a token, got %v", err)
+	}
+}
+
+func TestRequireRoleGRPC(t *testing.T) {
+	auth := newTestKit(t, Config{
+		GRPCPublicMethods: []string{"/grpc.health.v1.Health/Check"},
+	})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "grpcrole@example.com")
+	_, _ = auth.UpdateUser(tokens.User.ID, map[string]interface{}{"permissions": []string{"users:read"}})
+	tokens, _ = auth.LoginUser("grpcrole@example.com", "password123")
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	chain := func(ctx context.Context, method string, check grpc.UnaryServerInterceptor) error {
+		_, err := auth.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return check(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+			})
+		return err
+	}
+	ctx := grpcContext("authorization", "Bearer "+tokens.AccessToken)
+
+	if err := chain(ctx, "/api.Users/List", auth.RequirePermissionGRPC("users:read")); err != nil {
+		t.Errorf("Expected the permission check to pass, got %v", err)
+	}
+	if err := chain(ctx, "/api.Users/Delete", auth.RequireRoleGRPC("admin")); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, got %v", err)
+	}
+	if err := chain(context.Background(), "/grpc.health.v1.Health/Check", auth.RequireRoleGRPC("admin")); err != nil {
+		t.Errorf("Expected role checks to skip public methods, got %v", err)
+	}
+
+	_, err := auth.RequireRoleGRPC("user")(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/api.Users/List"}, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without the auth interceptor, got %v", err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "grpcstream@example.com")
+
+	info := &grpc.StreamServerInfo{FullMethod: "/api.Events/Watch"}
+	var seen *Claims
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		seen, _ = GetUserFromGRPCContext(stream.Context())
+		return auth.RequireRoleGRPCStream("admin")(srv, stream, info, func(interface{}, grpc.ServerStream) error { return nil })
+	}
+
+	stream := &testServerStream{ctx: grpcContext("authorization", "Bearer "+tokens.AccessToken)}
+	err := auth.StreamServerInterceptor()(nil, stream, info, handler)
+	if seen == nil || seen.UserID != tokens.User.ID {
+		t.Errorf("Expected the claims in the stream context, got %+v", seen)
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied from the role check, got %v", err)
+	}
+
+	err = auth.StreamServerInterceptor()(nil, &testServerStream{ctx: context.Background()}, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a token, got %v", err)
+	}
+}
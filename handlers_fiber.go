@@ -1,6 +1,11 @@
 package authkit
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -8,21 +13,31 @@ import (
 func (a *AuthKit) RegisterHandlerFiber(c *fiber.Ctx) error {
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
 	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+	req.TenantID = tenantID
 
-	user, err := a.RegisterUser(req)
+	user, err := a.RegisterUserCtx(c.UserContext(), req)
 	if err != nil {
 		status := fiber.StatusBadRequest
-		if err == ErrUserAlreadyExists {
+		switch {
+		case errors.Is(err, ErrUserAlreadyExists):
 			status = fiber.StatusConflict
+		case errors.Is(err, ErrRoleNotAllowed):
+			status = fiber.StatusForbidden
+		case errors.Is(err, ErrServerBusy):
+			status = fiber.StatusServiceUnavailable
 		}
-		return c.Status(status).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return a.fiberError(c, status, err)
 	}
+	a.sendRegistrationVerification(user.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "User registered successfully",
@@ -34,43 +49,85 @@ func (a *AuthKit) RegisterHandlerFiber(c *fiber.Ctx) error {
 func (a *AuthKit) LoginHandlerFiber(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
 	}
 
-	tokenResponse, err := a.LoginUser(req.Email, req.Password)
+	tokenResponse, err := a.LoginUserWithOptionsCtx(c.UserContext(), req.Email, req.Password, LoginOptions{
+		TenantID:   tenantID,
+		Context:    LoginContext{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)},
+		RememberMe: req.RememberMe,
+		Nonce:      req.Nonce,
+	})
 	if err != nil {
-		status := fiber.StatusUnauthorized
-		if err == ErrUserNotFound {
-			status = fiber.StatusNotFound
+		if errors.Is(err, ErrAccountPendingDeletion) {
+			resp := a.fiberErrorResponse(c, fiber.StatusForbidden, ErrorCode(err), err)
+			resp.addDetail("hint", a.config.Messages.Message(resp.Locale, messageAccountRecoveryHint))
+			return a.fiberRespondError(c, resp)
 		}
-		return c.Status(status).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		if errors.Is(err, ErrServerBusy) {
+			return a.fiberError(c, fiber.StatusServiceUnavailable, err)
+		}
+		if errors.Is(err, ErrAccountLocked) {
+			return a.fiberError(c, fiber.StatusLocked, err)
+		}
+		if errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrUserDisabled) {
+			return a.fiberError(c, fiber.StatusForbidden, err)
+		}
+		// Unknown emails and wrong passwords get the same generic response
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusUnauthorized, CodeInvalidCredentials, err))
 	}
 
-	return c.JSON(tokenResponse)
+	return a.fiberRespondTokens(c, tokenResponse)
 }
 
-// RefreshHandlerFiber handles token refresh for Fiber
+// RefreshHandlerFiber handles token refresh for Fiber. With
+// Config.CookieConfig set, a request without a body uses the refresh token cookie.
 func (a *AuthKit) RefreshHandlerFiber(c *fiber.Ctx) error {
 	var req RefreshRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if token, ok := a.fiberRefreshCookie(c); ok {
+		if !a.fiberValidCSRF(c) {
+			return a.fiberErrorCode(c, fiber.StatusForbidden, CodeInvalidCSRFToken)
+		}
+		req.RefreshToken = token
+	} else if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
 	}
 
-	tokenResponse, err := a.RefreshToken(req.RefreshToken)
+	tokenResponse, err := a.RefreshTokenCtx(c.UserContext(), req.RefreshToken)
 	if err != nil {
 		status := fiber.StatusUnauthorized
-		if err == ErrTokenExpired {
+		if errors.Is(err, ErrTokenExpired) {
 			status = fiber.StatusUnauthorized
 		}
-		return c.Status(status).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return a.fiberError(c, status, err)
+	}
+
+	return a.fiberRespondTokens(c, tokenResponse)
+}
+
+// ClientCredentialsHandlerFiber issues an access token to a service account for Fiber
+func (a *AuthKit) ClientCredentialsHandlerFiber(c *fiber.Ctx) error {
+	var req ClientCredentialsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	tokenResponse, err := a.ClientCredentialsLogin(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return a.fiberError(c, fiber.StatusUnauthorized, err)
 	}
 
 	return c.JSON(tokenResponse)
@@ -80,16 +137,12 @@ func (a *AuthKit) RefreshHandlerFiber(c *fiber.Ctx) error {
 func (a *AuthKit) ProfileHandlerFiber(c *fiber.Ctx) error {
 	claims, exists := GetUserFromFiberContext(c)
 	if !exists {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found in context",
-		})
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
 	}
 
-	user, err := a.GetUserByID(claims.UserID)
+	user, err := a.GetUserByIDCtx(c.UserContext(), claims.UserID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusNotFound, CodeUserNotFound, err))
 	}
 
 	return c.JSON(fiber.Map{
@@ -101,30 +154,23 @@ func (a *AuthKit) ProfileHandlerFiber(c *fiber.Ctx) error {
 func (a *AuthKit) UpdateProfileHandlerFiber(c *fiber.Ctx) error {
 	claims, exists := GetUserFromFiberContext(c)
 	if !exists {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found in context",
-		})
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
 	}
 
-	var updates map[string]interface{}
-	if err := c.BodyParser(&updates); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	update, err := profileUpdateFromBody(body)
+	if err != nil && !errors.Is(err, ErrRestrictedField) {
+		return a.fiberBindError(c, err)
+	}
+	var updatedUser *UserInfo
+	if err == nil {
+		updatedUser, err = a.UpdateOwnProfileCtx(c.UserContext(), claims.UserID, update)
 	}
-
-	// Remove sensitive fields that shouldn't be updated via this endpoint
-	delete(updates, "id")
-	delete(updates, "password")
-	delete(updates, "email")
-	delete(updates, "created_at")
-	delete(updates, "updated_at")
-
-	updatedUser, err := a.UpdateUser(claims.UserID, updates)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return a.fiberError(c, profileErrorStatus(err), err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -133,9 +179,695 @@ func (a *AuthKit) UpdateProfileHandlerFiber(c *fiber.Ctx) error {
 	})
 }
 
-// LogoutHandlerFiber handles user logout for Fiber (for completeness - JWT is stateless)
+// ChangePasswordHandlerFiber changes the current user's password for Fiber
+func (a *AuthKit) ChangePasswordHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	if err := a.ChangePasswordCtx(c.UserContext(), claims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrInvalidPassword):
+			status = fiber.StatusForbidden
+		case errors.Is(err, ErrUserNotFound):
+			status = fiber.StatusNotFound
+		case errors.Is(err, ErrServerBusy):
+			status = fiber.StatusServiceUnavailable
+		}
+		return a.fiberError(c, status, err)
+	}
+
+	response := fiber.Map{"message": "Password changed successfully"}
+	if !a.config.KeepTokensOnPasswordChange || claims.PasswordChangeRequired {
+		tokens, err := a.IssueTokensForUser(claims.UserID)
+		if err != nil {
+			return a.fiberError(c, fiber.StatusInternalServerError, err)
+		}
+		body, err := a.fiberTokenBody(c, tokens)
+		if err != nil {
+			return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+		}
+		response["tokens"] = body
+	}
+
+	return c.JSON(response)
+}
+
+// ForgotPasswordHandlerFiber sends a password reset token for Fiber. It
+// responds the same way whether or not the email is registered.
+func (a *AuthKit) ForgotPasswordHandlerFiber(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+
+	if err := a.RequestPasswordResetInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+	}
+
+	// Delivery failures aren't reported, they would reveal that the email exists
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": passwordResetSentMessage,
+	})
+}
+
+// ResetPasswordHandlerFiber sets a new password using a reset token for Fiber
+func (a *AuthKit) ResetPasswordHandlerFiber(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	if err := a.ResetPassword(req.Token, req.NewPassword); err != nil {
+		return a.fiberError(c, fiber.StatusBadRequest, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset successfully",
+	})
+}
+
+// ResendVerificationHandlerFiber sends a new email verification token for
+// Fiber. It responds the same way whether or not the email is registered.
+func (a *AuthKit) ResendVerificationHandlerFiber(c *fiber.Ctx) error {
+	var req ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+
+	if err := a.RequestEmailVerificationInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": verificationSentMessage,
+	})
+}
+
+// VerifyEmailHandlerFiber verifies an email using the token query parameter for Fiber
+func (a *AuthKit) VerifyEmailHandlerFiber(c *fiber.Ctx) error {
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	if err := a.VerifyEmail(c.Query("token")); err != nil {
+		return a.fiberError(c, fiber.StatusBadRequest, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// RequestEmailChangeHandlerFiber sends a confirmation link to the current
+// user's requested new email for Fiber
+func (a *AuthKit) RequestEmailChangeHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	var req EmailChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.NewEmail); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	if err := a.RequestEmailChange(claims.UserID, req.NewEmail); err != nil {
+		return a.fiberError(c, emailChangeErrorStatus(err), err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": emailChangeSentMessage,
+	})
+}
+
+// ConfirmEmailChangeHandlerFiber changes the email using the token query
+// parameter for Fiber
+func (a *AuthKit) ConfirmEmailChangeHandlerFiber(c *fiber.Ctx) error {
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	if err := a.ConfirmEmailChange(c.Query("token")); err != nil {
+		return a.fiberError(c, emailChangeErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email changed successfully",
+	})
+}
+
+// RequestLoginLinkHandlerFiber sends a magic login link for Fiber. It
+// responds the same way whether or not the email is registered.
+func (a *AuthKit) RequestLoginLinkHandlerFiber(c *fiber.Ctx) error {
+	var req LoginLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+
+	if err := a.RequestLoginLinkInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": loginLinkSentMessage,
+	})
+}
+
+// LoginWithLinkHandlerFiber logs in with a magic link token for Fiber
+func (a *AuthKit) LoginWithLinkHandlerFiber(c *fiber.Ctx) error {
+	var req LinkLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	tokenResponse, err := a.LoginWithLinkToken(req.Token)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, ErrAccountPendingDeletion) || errors.Is(err, ErrUserDisabled) {
+			status = fiber.StatusForbidden
+		}
+		return a.fiberError(c, status, err)
+	}
+
+	return a.fiberRespondTokens(c, tokenResponse)
+}
+
+// EnrollTOTPHandlerFiber starts TOTP enrollment for the current user for Fiber
+func (a *AuthKit) EnrollTOTPHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	secret, otpauthURL, err := a.EnrollTOTP(claims.UserID)
+	if err != nil {
+		return a.fiberError(c, mfaErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_url": otpauthURL,
+	})
+}
+
+// ConfirmTOTPHandlerFiber activates TOTP for the current user and responds
+// with their recovery codes for Fiber
+func (a *AuthKit) ConfirmTOTPHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	var req TOTPCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	if err := a.ConfirmTOTP(claims.UserID, req.Code); err != nil {
+		return a.fiberError(c, mfaErrorStatus(err), err)
+	}
+	codes, err := a.GenerateRecoveryCodes(claims.UserID)
+	if err != nil {
+		return a.fiberError(c, mfaErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RecoveryCodesHandlerFiber replaces the current user's recovery codes for Fiber
+func (a *AuthKit) RecoveryCodesHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	codes, err := a.GenerateRecoveryCodes(claims.UserID)
+	if err != nil {
+		return a.fiberError(c, mfaErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyMFAHandlerFiber completes a login with a TOTP code for Fiber
+func (a *AuthKit) VerifyMFAHandlerFiber(c *fiber.Ctx) error {
+	var req MFALoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+
+	tokenResponse, err := a.CompleteMFALoginCtx(c.UserContext(), req.MFAToken, req.Code, LoginContext{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)})
+	if err != nil {
+		return a.fiberError(c, mfaErrorStatus(err), err)
+	}
+
+	return a.fiberRespondTokens(c, tokenResponse)
+}
+
+// LogoutHandlerFiber handles user logout for Fiber by revoking the presented
+// access token and, if supplied in the body, the refresh token. With
+// Config.CookieConfig set, it also revokes and clears the token cookies.
 func (a *AuthKit) LogoutHandlerFiber(c *fiber.Ctx) error {
+	var req LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return a.fiberBindError(c, err)
+		}
+	}
+
+	accessToken, ok := bearerToken(c.Get("Authorization"))
+	if cfg := a.config.CookieConfig; cfg != nil {
+		if !ok {
+			accessToken, ok = fiberCookie(c, cfg.AccessTokenName)
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken, _ = fiberCookie(c, cfg.RefreshTokenName)
+		}
+		// Clear the cookies even if revocation fails, so a bad cookie can't stick
+		for _, cookie := range a.clearedCookies() {
+			c.Cookie(toFiberCookie(cookie))
+		}
+	}
+
+	if ok {
+		if err := a.RevokeToken(accessToken); err != nil {
+			return a.fiberError(c, fiber.StatusUnauthorized, err)
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if err := a.RevokeToken(req.RefreshToken); err != nil {
+			return a.fiberError(c, fiber.StatusBadRequest, err)
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
 	})
 }
+
+// DeleteAccountHandlerFiber deletes (or schedules deletion of) the current user's account for Fiber
+func (a *AuthKit) DeleteAccountHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	if err := a.DeleteAccount(claims.UserID); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, ErrUserNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return a.fiberError(c, status, err)
+	}
+
+	if a.config.DeletionGracePeriod > 0 {
+		return c.JSON(fiber.Map{
+			"message":  "Account scheduled for deletion",
+			"purge_at": a.now().Add(a.config.DeletionGracePeriod),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Account deleted successfully",
+	})
+}
+
+// RecoverAccountHandlerFiber restores an account pending deletion for Fiber
+func (a *AuthKit) RecoverAccountHandlerFiber(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	if allowed, wait := a.allowClient(c.IP(), req.Email); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+
+	user, err := a.RecoverAccountInTenantCtx(c.UserContext(), tenantID, req.Email, req.Password)
+	if err != nil {
+		return a.fiberError(c, ErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Account recovered successfully",
+		"user":    user,
+	})
+}
+
+// ListSessionsHandlerFiber lists the current user's sessions for Fiber
+func (a *AuthKit) ListSessionsHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	return a.fiberSessions(c, claims.UserID)
+}
+
+// RevokeSessionHandlerFiber ends one of the current user's sessions, given as
+// the :id path parameter, for Fiber
+func (a *AuthKit) RevokeSessionHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberErrorCode(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+
+	if err := a.revokeSession(c.Params("id"), claims.UserID); err != nil {
+		return a.fiberError(c, sessionErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// AdminListSessionsHandlerFiber lists the sessions of the user given as the
+// :id path parameter for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminListSessionsHandlerFiber(c *fiber.Ctx) error {
+	return a.fiberSessions(c, c.Params("id"))
+}
+
+// AdminRevokeSessionHandlerFiber ends any session, given as the :id path
+// parameter, for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminRevokeSessionHandlerFiber(c *fiber.Ctx) error {
+	if err := a.RevokeSession(c.Params("id")); err != nil {
+		return a.fiberError(c, sessionErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// AdminListRolesHandlerFiber lists the role definitions for Fiber. Protect it
+// with RequireRoleFiber.
+func (a *AuthKit) AdminListRolesHandlerFiber(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"roles": a.ListRoles()})
+}
+
+// AdminDefineRoleHandlerFiber creates or replaces a role definition for
+// Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminDefineRoleHandlerFiber(c *fiber.Ctx) error {
+	var req DefineRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	if err := a.DefineRole(req.Name, req.Permissions); err != nil {
+		return a.fiberError(c, fiber.StatusBadRequest, err)
+	}
+
+	role, err := a.GetRole(req.Name)
+	if err != nil {
+		return a.fiberError(c, fiber.StatusInternalServerError, err)
+	}
+	return c.JSON(role)
+}
+
+// AdminDisableUserHandlerFiber disables the user given as the :id path
+// parameter for Fiber, with an optional reason in the body. Protect it with
+// RequireRoleFiber.
+func (a *AuthKit) AdminDisableUserHandlerFiber(c *fiber.Ctx) error {
+	var req DisableUserRequest
+	if len(c.Body()) != 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return a.fiberBindError(c, err)
+		}
+	}
+
+	if err := a.DisableUser(c.Params("id"), req.Reason); err != nil {
+		return a.fiberError(c, userStatusErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "User disabled"})
+}
+
+// AdminEnableUserHandlerFiber enables the user given as the :id path
+// parameter for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminEnableUserHandlerFiber(c *fiber.Ctx) error {
+	if err := a.EnableUser(c.Params("id")); err != nil {
+		return a.fiberError(c, userStatusErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "User enabled"})
+}
+
+// AdminSearchUsersHandlerFiber searches users by email or name for Fiber,
+// taking the q, offset, limit and metadata_key query parameters. Protect it
+// with RequireRoleFiber.
+func (a *AuthKit) AdminSearchUsersHandlerFiber(c *fiber.Ctx) error {
+	opts, err := parseListOptions(func(key string) string { return c.Query(key) })
+	if err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	page, err := a.SearchUsersCtx(c.UserContext(), c.Query("q"), opts)
+	if err != nil {
+		return a.fiberError(c, searchErrorStatus(err), err)
+	}
+
+	return c.JSON(page)
+}
+
+// AdminListUsersHandlerFiber lists users ordered by email for Fiber, taking
+// the offset and limit query parameters. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminListUsersHandlerFiber(c *fiber.Ctx) error {
+	opts, err := parseListOptions(func(key string) string { return c.Query(key) })
+	if err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	return c.JSON(a.ListUsersPage(opts))
+}
+
+// AdminGetUserHandlerFiber returns the user given as the :id path parameter
+// for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminGetUserHandlerFiber(c *fiber.Ctx) error {
+	user, err := a.userInfo(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return a.fiberError(c, adminUserErrorStatus(err), err)
+	}
+
+	return c.JSON(user)
+}
+
+// AdminCreateUserHandlerFiber creates a user with any role for Fiber, see
+// AdminCreateUser. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminCreateUserHandlerFiber(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	user, err := a.AdminCreateUserCtx(WithAuditActor(c.UserContext(), fiberActor(c)), req)
+	if err != nil {
+		return a.fiberError(c, adminUserErrorStatus(err), err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "User created successfully",
+		"user":    user,
+	})
+}
+
+// AdminUpdateUserHandlerFiber updates the user given as the :id path
+// parameter for Fiber, see AdminUpdateUserRequest. Protect it with
+// RequireRoleFiber.
+func (a *AuthKit) AdminUpdateUserHandlerFiber(c *fiber.Ctx) error {
+	var req AdminUpdateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	user, err := a.adminUpdateUser(c.UserContext(), fiberActor(c), c.Params("id"), req)
+	if err != nil {
+		return a.fiberError(c, adminUserErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User updated successfully",
+		"user":    user,
+	})
+}
+
+// AdminSetRoleHandlerFiber sets the role of the user given as the :id path
+// parameter for Fiber. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminSetRoleHandlerFiber(c *fiber.Ctx) error {
+	var req SetRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+
+	user, err := a.adminUpdateUser(c.UserContext(), fiberActor(c), c.Params("id"), AdminUpdateUserRequest{Role: &req.Role})
+	if err != nil {
+		return a.fiberError(c, adminUserErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User role updated successfully",
+		"user":    user,
+	})
+}
+
+// AdminDeleteUserHandlerFiber deletes the user given as the :id path
+// parameter for Fiber, see DeleteUser. Protect it with RequireRoleFiber.
+func (a *AuthKit) AdminDeleteUserHandlerFiber(c *fiber.Ctx) error {
+	if err := a.DeleteUserCtx(WithAuditActor(c.UserContext(), fiberActor(c)), c.Params("id")); err != nil {
+		return a.fiberError(c, adminUserErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"message": "User deleted successfully"})
+}
+
+// fiberActor returns the ID of the authenticated user, or ""
+func fiberActor(c *fiber.Ctx) string {
+	if claims, exists := GetUserFromFiberContext(c); exists {
+		return claims.UserID
+	}
+	return ""
+}
+
+// fiberSessions responds with the user's sessions
+func (a *AuthKit) fiberSessions(c *fiber.Ctx, userID string) error {
+	sessions, err := a.ListSessions(userID)
+	if err != nil {
+		return a.fiberError(c, sessionErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"sessions": sessions})
+}
+
+// RespondTokensFiber is RespondTokens for Fiber
+func (a *AuthKit) RespondTokensFiber(c *fiber.Ctx, tokens *TokenResponse) error {
+	return a.fiberRespondTokens(c, tokens)
+}
+
+// RespondErrorFiber is RespondError for Fiber
+func (a *AuthKit) RespondErrorFiber(c *fiber.Ctx, err error) error {
+	return a.fiberError(c, ErrorStatus(err), err)
+}
+
+// fiberRespondTokens responds with the tokens from a login or refresh and
+// records the client on their session
+func (a *AuthKit) fiberRespondTokens(c *fiber.Ctx, tokens *TokenResponse) error {
+	a.setSessionClient(tokens.SessionID, c.Get(fiber.HeaderUserAgent), c.IP())
+	body, err := a.fiberTokenBody(c, tokens)
+	if err != nil {
+		return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+	}
+	return c.JSON(body)
+}
+
+// fiberTokenBody sets the token cookies when Config.CookieConfig is set and
+// returns the tokens to put in the response body
+func (a *AuthKit) fiberTokenBody(c *fiber.Ctx, tokens *TokenResponse) (*TokenResponse, error) {
+	// MFA challenges carry no tokens yet
+	if a.config.CookieConfig == nil || tokens.AccessToken == "" {
+		return tokens, nil
+	}
+
+	cookies, err := a.tokenCookies(tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range cookies {
+		c.Cookie(toFiberCookie(cookie))
+	}
+	return withoutTokens(tokens), nil
+}
+
+// fiberRefreshCookie returns the refresh token cookie of a request without a body
+func (a *AuthKit) fiberRefreshCookie(c *fiber.Ctx) (string, bool) {
+	if a.config.CookieConfig == nil || len(c.Body()) > 0 {
+		return "", false
+	}
+	return fiberCookie(c, a.config.CookieConfig.RefreshTokenName)
+}
+
+// toFiberCookie converts a cookie built by tokenCookies or clearedCookies
+func toFiberCookie(cookie *http.Cookie) *fiber.Cookie {
+	fc := &fiber.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		MaxAge:   cookie.MaxAge,
+		Secure:   cookie.Secure,
+		HTTPOnly: cookie.HttpOnly,
+	}
+	if cookie.MaxAge < 0 {
+		// fasthttp only deletes cookies through an expiry in the past
+		fc.MaxAge = 0
+		fc.Expires = time.Unix(0, 0)
+	}
+	switch cookie.SameSite {
+	case http.SameSiteStrictMode:
+		fc.SameSite = fiber.CookieSameSiteStrictMode
+	case http.SameSiteNoneMode:
+		fc.SameSite = fiber.CookieSameSiteNoneMode
+	default:
+		fc.SameSite = fiber.CookieSameSiteLaxMode
+	}
+	return fc
+}
+
+// fiberRateLimited responds 429 with Retry-After
+func (a *AuthKit) fiberRateLimited(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(wait)))
+	return a.fiberErrorCode(c, fiber.StatusTooManyRequests, CodeRateLimited)
+}
+
+// fiberTenant returns the tenant of the request, see Config.TenantResolver,
+// and whether it may go ahead
+func (a *AuthKit) fiberTenant(c *fiber.Ctx) (string, bool) {
+	param := func(key string) string { return c.Params(key) }
+	header := func(key string) string { return c.Get(key) }
+	return a.config.TenantResolver.resolve(param, header, c.Hostname())
+}
@@ -1,7 +1,9 @@
 package authkit
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,19 +12,33 @@ import (
 func (a *AuthKit) RegisterHandler(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		a.ginBindError(c, err)
 		return
 	}
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
 
-	user, err := a.RegisterUser(req)
+	user, err := a.RegisterUserCtx(c.Request.Context(), req)
 	if err != nil {
 		status := http.StatusBadRequest
-		if err == ErrUserAlreadyExists {
+		switch {
+		case errors.Is(err, ErrUserAlreadyExists):
 			status = http.StatusConflict
+		case errors.Is(err, ErrRoleNotAllowed):
+			status = http.StatusForbidden
+		case errors.Is(err, ErrServerBusy):
+			status = http.StatusServiceUnavailable
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		a.ginError(c, status, err)
 		return
 	}
+	a.sendRegistrationVerification(user.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully",
@@ -34,38 +50,95 @@ func (a *AuthKit) RegisterHandler(c *gin.Context) {
 func (a *AuthKit) LoginHandler(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
 		return
 	}
 
-	tokenResponse, err := a.LoginUser(req.Email, req.Password)
+	tokenResponse, err := a.LoginUserWithOptionsCtx(c.Request.Context(), req.Email, req.Password, LoginOptions{
+		TenantID:   tenantID,
+		Context:    LoginContext{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()},
+		RememberMe: req.RememberMe,
+		Nonce:      req.Nonce,
+	})
 	if err != nil {
-		status := http.StatusUnauthorized
-		if err == ErrUserNotFound {
-			status = http.StatusNotFound
+		if errors.Is(err, ErrAccountPendingDeletion) {
+			resp := a.ginErrorResponse(c, http.StatusForbidden, ErrorCode(err), err)
+			resp.addDetail("hint", a.config.Messages.Message(resp.Locale, messageAccountRecoveryHint))
+			a.ginRespondError(c, resp)
+			return
+		}
+		if errors.Is(err, ErrServerBusy) {
+			a.ginError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		if errors.Is(err, ErrAccountLocked) {
+			a.ginError(c, http.StatusLocked, err)
+			return
+		}
+		if errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrUserDisabled) {
+			a.ginError(c, http.StatusForbidden, err)
+			return
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		// Unknown emails and wrong passwords get the same generic response
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusUnauthorized, CodeInvalidCredentials, err))
 		return
 	}
 
-	c.JSON(http.StatusOK, tokenResponse)
+	a.ginRespondTokens(c, tokenResponse)
 }
 
-// RefreshHandler handles token refresh for Gin
+// RefreshHandler handles token refresh for Gin. With Config.CookieConfig set,
+// a request without a body uses the refresh token cookie.
 func (a *AuthKit) RefreshHandler(c *gin.Context) {
 	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if token, ok := a.ginRefreshCookie(c); ok {
+		if !a.ginValidCSRF(c) {
+			a.ginErrorCode(c, http.StatusForbidden, CodeInvalidCSRFToken)
+			return
+		}
+		req.RefreshToken = token
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
 		return
 	}
 
-	tokenResponse, err := a.RefreshToken(req.RefreshToken)
+	tokenResponse, err := a.RefreshTokenCtx(c.Request.Context(), req.RefreshToken)
 	if err != nil {
 		status := http.StatusUnauthorized
-		if err == ErrTokenExpired {
+		if errors.Is(err, ErrTokenExpired) {
 			status = http.StatusUnauthorized
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		a.ginError(c, status, err)
+		return
+	}
+
+	a.ginRespondTokens(c, tokenResponse)
+}
+
+// ClientCredentialsHandler issues an access token to a service account for Gin
+func (a *AuthKit) ClientCredentialsHandler(c *gin.Context) {
+	var req ClientCredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	tokenResponse, err := a.ClientCredentialsLogin(req.ClientID, req.ClientSecret)
+	if err != nil {
+		a.ginError(c, http.StatusUnauthorized, err)
 		return
 	}
 
@@ -76,13 +149,13 @@ func (a *AuthKit) RefreshHandler(c *gin.Context) {
 func (a *AuthKit) ProfileHandler(c *gin.Context) {
 	claims, exists := GetUserFromGinContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
 		return
 	}
 
-	user, err := a.GetUserByID(claims.UserID)
+	user, err := a.GetUserByIDCtx(c.Request.Context(), claims.UserID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusNotFound, CodeUserNotFound, err))
 		return
 	}
 
@@ -95,26 +168,26 @@ func (a *AuthKit) ProfileHandler(c *gin.Context) {
 func (a *AuthKit) UpdateProfileHandler(c *gin.Context) {
 	claims, exists := GetUserFromGinContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
 		return
 	}
 
-	var updates map[string]interface{}
-	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var body map[string]interface{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		a.ginBindError(c, err)
 		return
 	}
-
-	// Remove sensitive fields that shouldn't be updated via this endpoint
-	delete(updates, "id")
-	delete(updates, "password")
-	delete(updates, "email")
-	delete(updates, "created_at")
-	delete(updates, "updated_at")
-
-	updatedUser, err := a.UpdateUser(claims.UserID, updates)
+	update, err := profileUpdateFromBody(body)
+	if err != nil && !errors.Is(err, ErrRestrictedField) {
+		a.ginBindError(c, err)
+		return
+	}
+	var updatedUser *UserInfo
+	if err == nil {
+		updatedUser, err = a.UpdateOwnProfileCtx(c.Request.Context(), claims.UserID, update)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		a.ginError(c, profileErrorStatus(err), err)
 		return
 	}
 
@@ -124,9 +197,735 @@ func (a *AuthKit) UpdateProfileHandler(c *gin.Context) {
 	})
 }
 
-// LogoutHandler handles user logout for Gin (for completeness - JWT is stateless)
+// ChangePasswordHandler changes the current user's password for Gin. When the
+// change revokes existing tokens, or the caller's token was restricted to
+// changing the password, a fresh pair is returned so the caller stays signed in.
+func (a *AuthKit) ChangePasswordHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	if err := a.ChangePasswordCtx(c.Request.Context(), claims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrInvalidPassword):
+			status = http.StatusForbidden
+		case errors.Is(err, ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrServerBusy):
+			status = http.StatusServiceUnavailable
+		}
+		a.ginError(c, status, err)
+		return
+	}
+
+	response := gin.H{"message": "Password changed successfully"}
+	if !a.config.KeepTokensOnPasswordChange || claims.PasswordChangeRequired {
+		tokens, err := a.IssueTokensForUser(claims.UserID)
+		if err != nil {
+			a.ginError(c, http.StatusInternalServerError, err)
+			return
+		}
+		body, ok := a.ginTokenBody(c, tokens)
+		if !ok {
+			return
+		}
+		response["tokens"] = body
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ForgotPasswordHandler sends a password reset token for Gin. It responds the
+// same way whether or not the email is registered.
+func (a *AuthKit) ForgotPasswordHandler(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := a.RequestPasswordResetInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+		return
+	}
+
+	// Delivery failures aren't reported, they would reveal that the email exists
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": passwordResetSentMessage,
+	})
+}
+
+// ResetPasswordHandler sets a new password using a reset token for Gin
+func (a *AuthKit) ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	if err := a.ResetPassword(req.Token, req.NewPassword); err != nil {
+		a.ginError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully",
+	})
+}
+
+// ResendVerificationHandler sends a new email verification token for Gin. It
+// responds the same way whether or not the email is registered.
+func (a *AuthKit) ResendVerificationHandler(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := a.RequestEmailVerificationInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": verificationSentMessage,
+	})
+}
+
+// VerifyEmailHandler verifies an email using the token query parameter for Gin
+func (a *AuthKit) VerifyEmailHandler(c *gin.Context) {
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	if err := a.VerifyEmail(c.Query("token")); err != nil {
+		a.ginError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+	})
+}
+
+// RequestEmailChangeHandler sends a confirmation link to the current user's
+// requested new email for Gin
+func (a *AuthKit) RequestEmailChangeHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	var req EmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, req.NewEmail) {
+		return
+	}
+
+	if err := a.RequestEmailChange(claims.UserID, req.NewEmail); err != nil {
+		a.ginError(c, emailChangeErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": emailChangeSentMessage,
+	})
+}
+
+// ConfirmEmailChangeHandler changes the email using the token query parameter for Gin
+func (a *AuthKit) ConfirmEmailChangeHandler(c *gin.Context) {
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	if err := a.ConfirmEmailChange(c.Query("token")); err != nil {
+		a.ginError(c, emailChangeErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed successfully",
+	})
+}
+
+// RequestLoginLinkHandler sends a magic login link for Gin. It responds the
+// same way whether or not the email is registered.
+func (a *AuthKit) RequestLoginLinkHandler(c *gin.Context) {
+	var req LoginLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := a.RequestLoginLinkInTenant(tenantID, req.Email); errors.Is(err, ErrNoEmailSender) {
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": loginLinkSentMessage,
+	})
+}
+
+// LoginWithLinkHandler logs in with a magic link token for Gin
+func (a *AuthKit) LoginWithLinkHandler(c *gin.Context) {
+	var req LinkLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	tokenResponse, err := a.LoginWithLinkToken(req.Token)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrAccountPendingDeletion) || errors.Is(err, ErrUserDisabled) {
+			status = http.StatusForbidden
+		}
+		a.ginError(c, status, err)
+		return
+	}
+
+	a.ginRespondTokens(c, tokenResponse)
+}
+
+// EnrollTOTPHandler starts TOTP enrollment for the current user for Gin
+func (a *AuthKit) EnrollTOTPHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	secret, otpauthURL, err := a.EnrollTOTP(claims.UserID)
+	if err != nil {
+		a.ginError(c, mfaErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": otpauthURL,
+	})
+}
+
+// ConfirmTOTPHandler activates TOTP for the current user and responds with
+// their recovery codes for Gin
+func (a *AuthKit) ConfirmTOTPHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	if err := a.ConfirmTOTP(claims.UserID, req.Code); err != nil {
+		a.ginError(c, mfaErrorStatus(err), err)
+		return
+	}
+	codes, err := a.GenerateRecoveryCodes(claims.UserID)
+	if err != nil {
+		a.ginError(c, mfaErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RecoveryCodesHandler replaces the current user's recovery codes for Gin
+func (a *AuthKit) RecoveryCodesHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	codes, err := a.GenerateRecoveryCodes(claims.UserID)
+	if err != nil {
+		a.ginError(c, mfaErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyMFAHandler completes a login with a TOTP code for Gin
+func (a *AuthKit) VerifyMFAHandler(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+
+	tokenResponse, err := a.CompleteMFALoginCtx(c.Request.Context(), req.MFAToken, req.Code, LoginContext{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+	if err != nil {
+		a.ginError(c, mfaErrorStatus(err), err)
+		return
+	}
+
+	a.ginRespondTokens(c, tokenResponse)
+}
+
+// LogoutHandler handles user logout for Gin by revoking the presented access
+// token and, if supplied in the body, the refresh token. With
+// Config.CookieConfig set, it also revokes and clears the token cookies.
 func (a *AuthKit) LogoutHandler(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			a.ginBindError(c, err)
+			return
+		}
+	}
+
+	accessToken, ok := bearerToken(c.GetHeader("Authorization"))
+	if cfg := a.config.CookieConfig; cfg != nil {
+		if !ok {
+			accessToken, ok = ginCookie(c, cfg.AccessTokenName)
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken, _ = ginCookie(c, cfg.RefreshTokenName)
+		}
+		// Clear the cookies even if revocation fails, so a bad cookie can't stick
+		for _, cookie := range a.clearedCookies() {
+			http.SetCookie(c.Writer, cookie)
+		}
+	}
+
+	if ok {
+		if err := a.RevokeToken(accessToken); err != nil {
+			a.ginError(c, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if err := a.RevokeToken(req.RefreshToken); err != nil {
+			a.ginError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logged out successfully",
 	})
 }
+
+// DeleteAccountHandler deletes (or schedules deletion of) the current user's account for Gin
+func (a *AuthKit) DeleteAccountHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	if err := a.DeleteAccount(claims.UserID); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrUserNotFound) {
+			status = http.StatusNotFound
+		}
+		a.ginError(c, status, err)
+		return
+	}
+
+	if a.config.DeletionGracePeriod > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Account scheduled for deletion",
+			"purge_at": a.now().Add(a.config.DeletionGracePeriod),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// RecoverAccountHandler restores an account pending deletion for Gin
+func (a *AuthKit) RecoverAccountHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	if !a.ginAllowClient(c, req.Email) {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+
+	user, err := a.RecoverAccountInTenantCtx(c.Request.Context(), tenantID, req.Email, req.Password)
+	if err != nil {
+		a.ginError(c, ErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account recovered successfully",
+		"user":    user,
+	})
+}
+
+// ListSessionsHandler lists the current user's sessions for Gin
+func (a *AuthKit) ListSessionsHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	a.ginSessions(c, claims.UserID)
+}
+
+// RevokeSessionHandler ends one of the current user's sessions, given as the
+// :id path parameter, for Gin
+func (a *AuthKit) RevokeSessionHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginErrorCode(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	if err := a.revokeSession(c.Param("id"), claims.UserID); err != nil {
+		a.ginError(c, sessionErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// AdminListSessionsHandler lists the sessions of the user given as the :id
+// path parameter for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminListSessionsHandler(c *gin.Context) {
+	a.ginSessions(c, c.Param("id"))
+}
+
+// AdminRevokeSessionHandler ends any session, given as the :id path
+// parameter, for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminRevokeSessionHandler(c *gin.Context) {
+	if err := a.RevokeSession(c.Param("id")); err != nil {
+		a.ginError(c, sessionErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// AdminListRolesHandler lists the role definitions for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminListRolesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"roles": a.ListRoles()})
+}
+
+// AdminDefineRoleHandler creates or replaces a role definition for Gin.
+// Protect it with RequireRole.
+func (a *AuthKit) AdminDefineRoleHandler(c *gin.Context) {
+	var req DefineRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	if err := a.DefineRole(req.Name, req.Permissions); err != nil {
+		a.ginError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	role, err := a.GetRole(req.Name)
+	if err != nil {
+		a.ginError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// AdminDisableUserHandler disables the user given as the :id path parameter
+// for Gin, with an optional reason in the body. Protect it with RequireRole.
+func (a *AuthKit) AdminDisableUserHandler(c *gin.Context) {
+	var req DisableUserRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			a.ginBindError(c, err)
+			return
+		}
+	}
+
+	if err := a.DisableUser(c.Param("id"), req.Reason); err != nil {
+		a.ginError(c, userStatusErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+}
+
+// AdminEnableUserHandler enables the user given as the :id path parameter for
+// Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminEnableUserHandler(c *gin.Context) {
+	if err := a.EnableUser(c.Param("id")); err != nil {
+		a.ginError(c, userStatusErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+}
+
+// AdminSearchUsersHandler searches users by email or name for Gin, taking
+// the q, offset, limit and metadata_key query parameters. Protect it with
+// RequireRole.
+func (a *AuthKit) AdminSearchUsersHandler(c *gin.Context) {
+	opts, err := parseListOptions(c.Query)
+	if err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	page, err := a.SearchUsersCtx(c.Request.Context(), c.Query("q"), opts)
+	if err != nil {
+		a.ginError(c, searchErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminListUsersHandler lists users ordered by email for Gin, taking the
+// offset and limit query parameters. Protect it with RequireRole.
+func (a *AuthKit) AdminListUsersHandler(c *gin.Context) {
+	opts, err := parseListOptions(c.Query)
+	if err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, a.ListUsersPage(opts))
+}
+
+// AdminGetUserHandler returns the user given as the :id path parameter for
+// Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminGetUserHandler(c *gin.Context) {
+	user, err := a.userInfo(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		a.ginError(c, adminUserErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// AdminCreateUserHandler creates a user with any role for Gin, see
+// AdminCreateUser. Protect it with RequireRole.
+func (a *AuthKit) AdminCreateUserHandler(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	user, err := a.AdminCreateUserCtx(WithAuditActor(c.Request.Context(), ginActor(c)), req)
+	if err != nil {
+		a.ginError(c, adminUserErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User created successfully",
+		"user":    user,
+	})
+}
+
+// AdminUpdateUserHandler updates the user given as the :id path parameter
+// for Gin, see AdminUpdateUserRequest. Protect it with RequireRole.
+func (a *AuthKit) AdminUpdateUserHandler(c *gin.Context) {
+	var req AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	user, err := a.adminUpdateUser(c.Request.Context(), ginActor(c), c.Param("id"), req)
+	if err != nil {
+		a.ginError(c, adminUserErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user":    user,
+	})
+}
+
+// AdminSetRoleHandler sets the role of the user given as the :id path
+// parameter for Gin. Protect it with RequireRole.
+func (a *AuthKit) AdminSetRoleHandler(c *gin.Context) {
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+
+	user, err := a.adminUpdateUser(c.Request.Context(), ginActor(c), c.Param("id"), AdminUpdateUserRequest{Role: &req.Role})
+	if err != nil {
+		a.ginError(c, adminUserErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User role updated successfully",
+		"user":    user,
+	})
+}
+
+// AdminDeleteUserHandler deletes the user given as the :id path parameter
+// for Gin, see DeleteUser. Protect it with RequireRole.
+func (a *AuthKit) AdminDeleteUserHandler(c *gin.Context) {
+	if err := a.DeleteUserCtx(WithAuditActor(c.Request.Context(), ginActor(c)), c.Param("id")); err != nil {
+		a.ginError(c, adminUserErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// ginActor returns the ID of the authenticated user, or ""
+func ginActor(c *gin.Context) string {
+	if claims, exists := GetUserFromGinContext(c); exists {
+		return claims.UserID
+	}
+	return ""
+}
+
+// ginSessions responds with the user's sessions
+func (a *AuthKit) ginSessions(c *gin.Context, userID string) {
+	sessions, err := a.ListSessions(userID)
+	if err != nil {
+		a.ginError(c, sessionErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RespondTokens responds with tokens like the bundled login handlers,
+// setting the token cookies when Config.CookieConfig is set. It is meant for
+// login handlers built on AuthKit, such as those of the oauth package.
+func (a *AuthKit) RespondTokens(c *gin.Context, tokens *TokenResponse) {
+	a.ginRespondTokens(c, tokens)
+}
+
+// RespondError responds with err like the bundled handlers, with its
+// ErrorStatus and through Config.ErrorResponder
+func (a *AuthKit) RespondError(c *gin.Context, err error) {
+	a.ginError(c, ErrorStatus(err), err)
+}
+
+// ginRespondTokens responds with the tokens from a login or refresh and
+// records the client on their session
+func (a *AuthKit) ginRespondTokens(c *gin.Context, tokens *TokenResponse) {
+	a.setSessionClient(tokens.SessionID, c.Request.UserAgent(), c.ClientIP())
+	body, ok := a.ginTokenBody(c, tokens)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// ginTokenBody sets the token cookies when Config.CookieConfig is set and
+// returns the tokens to put in the response body. It responds with an error
+// and returns false if the cookies can't be built.
+func (a *AuthKit) ginTokenBody(c *gin.Context, tokens *TokenResponse) (*TokenResponse, bool) {
+	// MFA challenges carry no tokens yet
+	if a.config.CookieConfig == nil || tokens.AccessToken == "" {
+		return tokens, true
+	}
+
+	cookies, err := a.tokenCookies(tokens)
+	if err != nil {
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+		return nil, false
+	}
+	for _, cookie := range cookies {
+		http.SetCookie(c.Writer, cookie)
+	}
+	return withoutTokens(tokens), true
+}
+
+// ginRefreshCookie returns the refresh token cookie of a request without a body
+func (a *AuthKit) ginRefreshCookie(c *gin.Context) (string, bool) {
+	if a.config.CookieConfig == nil || c.Request.ContentLength > 0 {
+		return "", false
+	}
+	return ginCookie(c, a.config.CookieConfig.RefreshTokenName)
+}
+
+// ginAllowClient applies the rate limit to the client, responding 429 with
+// Retry-After when it is exceeded
+func (a *AuthKit) ginAllowClient(c *gin.Context, email string) bool {
+	allowed, wait := a.allowClient(a.limitedIP(c.Request), email)
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		a.ginErrorCode(c, http.StatusTooManyRequests, CodeRateLimited)
+	}
+	return allowed
+}
+
+// ginTenant returns the tenant of the request, see Config.TenantResolver,
+// responding 400 when a required tenant is missing
+func (a *AuthKit) ginTenant(c *gin.Context) (string, bool) {
+	tenantID, ok := a.config.TenantResolver.resolve(c.Param, c.GetHeader, c.Request.Host)
+	if !ok {
+		a.ginErrorCode(c, http.StatusBadRequest, CodeTenantRequired)
+	}
+	return tenantID, ok
+}
@@ -0,0 +1,236 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// RegisterHandlerHTTP handles user registration for net/http
+func (a *AuthKit) RegisterHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := binding.JSON.Bind(r, &req); err != nil {
+		a.httpBindError(w, r, err)
+		return
+	}
+	if !a.httpAllowClient(w, r, req.Email) {
+		return
+	}
+	tenantID, ok := a.httpTenant(w, r)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+
+	user, err := a.RegisterUserCtx(r.Context(), req)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrUserAlreadyExists):
+			status = http.StatusConflict
+		case errors.Is(err, ErrRoleNotAllowed):
+			status = http.StatusForbidden
+		case errors.Is(err, ErrServerBusy):
+			status = http.StatusServiceUnavailable
+		}
+		a.httpError(w, r, status, err)
+		return
+	}
+	a.sendRegistrationVerification(user.ID)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "User registered successfully",
+		"user":    user,
+	})
+}
+
+// LoginHandlerHTTP handles user login for net/http
+func (a *AuthKit) LoginHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := binding.JSON.Bind(r, &req); err != nil {
+		a.httpBindError(w, r, err)
+		return
+	}
+	if !a.httpAllowClient(w, r, req.Email) {
+		return
+	}
+	tenantID, ok := a.httpTenant(w, r)
+	if !ok {
+		return
+	}
+
+	tokenResponse, err := a.LoginUserWithOptionsCtx(r.Context(), req.Email, req.Password, LoginOptions{
+		TenantID:   tenantID,
+		Context:    LoginContext{IP: httpClientIP(r), UserAgent: r.UserAgent()},
+		RememberMe: req.RememberMe,
+		Nonce:      req.Nonce,
+	})
+	if err != nil {
+		if errors.Is(err, ErrAccountPendingDeletion) {
+			resp := a.httpErrorResponse(r, http.StatusForbidden, ErrorCode(err), err)
+			resp.addDetail("hint", a.config.Messages.Message(resp.Locale, messageAccountRecoveryHint))
+			a.httpRespondError(w, resp)
+			return
+		}
+		if errors.Is(err, ErrServerBusy) {
+			a.httpError(w, r, http.StatusServiceUnavailable, err)
+			return
+		}
+		if errors.Is(err, ErrAccountLocked) {
+			a.httpError(w, r, http.StatusLocked, err)
+			return
+		}
+		if errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrUserDisabled) {
+			a.httpError(w, r, http.StatusForbidden, err)
+			return
+		}
+		// Unknown emails and wrong passwords get the same generic response
+		a.httpRespondError(w, a.httpErrorResponse(r, http.StatusUnauthorized, CodeInvalidCredentials, err))
+		return
+	}
+
+	a.httpRespondTokens(w, r, tokenResponse)
+}
+
+// RefreshHandlerHTTP handles token refresh for net/http. With
+// Config.CookieConfig set, a request without a body uses the refresh token cookie.
+func (a *AuthKit) RefreshHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if token, ok := a.httpRefreshCookie(r); ok {
+		if !a.httpValidCSRF(r) {
+			a.httpErrorCode(w, r, http.StatusForbidden, CodeInvalidCSRFToken)
+			return
+		}
+		req.RefreshToken = token
+	} else if err := binding.JSON.Bind(r, &req); err != nil {
+		a.httpBindError(w, r, err)
+		return
+	}
+	if !a.httpAllowClient(w, r, "") {
+		return
+	}
+
+	tokenResponse, err := a.RefreshTokenCtx(r.Context(), req.RefreshToken)
+	if err != nil {
+		a.httpError(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	a.httpRespondTokens(w, r, tokenResponse)
+}
+
+// ProfileHandlerHTTP returns current user profile for net/http. It must be
+// wrapped by HTTPMiddleware.
+func (a *AuthKit) ProfileHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, exists := GetUserFromContext(r.Context())
+	if !exists {
+		a.httpErrorCode(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+
+	user, err := a.GetUserByIDCtx(r.Context(), claims.UserID)
+	if err != nil {
+		a.httpRespondError(w, a.httpErrorResponse(r, http.StatusNotFound, CodeUserNotFound, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user": a.userToUserInfo(user),
+	})
+}
+
+// LogoutHandlerHTTP handles user logout for net/http by revoking the presented
+// access token and, if supplied in the body, the refresh token. With
+// Config.CookieConfig set, it also revokes and clears the token cookies.
+func (a *AuthKit) LogoutHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	var req LogoutRequest
+	if r.ContentLength > 0 {
+		if err := binding.JSON.Bind(r, &req); err != nil {
+			a.httpBindError(w, r, err)
+			return
+		}
+	}
+
+	accessToken, ok := bearerToken(r.Header.Get("Authorization"))
+	if cfg := a.config.CookieConfig; cfg != nil {
+		if !ok {
+			accessToken, ok = httpCookie(r, cfg.AccessTokenName)
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken, _ = httpCookie(r, cfg.RefreshTokenName)
+		}
+		// Clear the cookies even if revocation fails, so a bad cookie can't stick
+		for _, cookie := range a.clearedCookies() {
+			http.SetCookie(w, cookie)
+		}
+	}
+
+	if ok {
+		if err := a.RevokeToken(accessToken); err != nil {
+			a.httpError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if err := a.RevokeToken(req.RefreshToken); err != nil {
+			a.httpError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Logged out successfully",
+	})
+}
+
+// httpRespondTokens responds with the tokens from a login or refresh, in
+// cookies when Config.CookieConfig is set, and records the client on their session
+func (a *AuthKit) httpRespondTokens(w http.ResponseWriter, r *http.Request, tokens *TokenResponse) {
+	a.setSessionClient(tokens.SessionID, r.UserAgent(), httpClientIP(r))
+
+	// MFA challenges carry no tokens yet
+	if a.config.CookieConfig != nil && tokens.AccessToken != "" {
+		cookies, err := a.tokenCookies(tokens)
+		if err != nil {
+			a.httpRespondError(w, a.httpErrorResponse(r, http.StatusInternalServerError, CodeInternalError, err))
+			return
+		}
+		for _, cookie := range cookies {
+			http.SetCookie(w, cookie)
+		}
+		tokens = withoutTokens(tokens)
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// httpRefreshCookie returns the refresh token cookie of a request without a body
+func (a *AuthKit) httpRefreshCookie(r *http.Request) (string, bool) {
+	if a.config.CookieConfig == nil || r.ContentLength > 0 {
+		return "", false
+	}
+	return httpCookie(r, a.config.CookieConfig.RefreshTokenName)
+}
+
+// httpAllowClient applies the rate limit to the client, responding 429 with
+// Retry-After when it is exceeded
+func (a *AuthKit) httpAllowClient(w http.ResponseWriter, r *http.Request, email string) bool {
+	allowed, wait := a.allowClient(a.limitedIP(r), email)
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		a.httpErrorCode(w, r, http.StatusTooManyRequests, CodeRateLimited)
+	}
+	return allowed
+}
+
+// httpTenant returns the tenant of the request, see Config.TenantResolver,
+// responding 400 when a required tenant is missing
+func (a *AuthKit) httpTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenantID, ok := a.config.TenantResolver.resolve(nil, r.Header.Get, r.Host)
+	if !ok {
+		a.httpErrorCode(w, r, http.StatusBadRequest, CodeTenantRequired)
+	}
+	return tenantID, ok
+}
@@ -0,0 +1,94 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// hashLimiter bounds how many password hashes run at once, see
+// Config.MaxConcurrentHashes. A nil hashLimiter doesn't limit anything.
+type hashLimiter struct {
+	slots    chan struct{}
+	maxQueue int64 // Most hashes waiting for a slot, 0 for no limit
+	waiting  int64 // Hashes waiting for a slot, updated atomically
+}
+
+// newHashLimiter creates a limiter running at most max hashes at once, or
+// returns nil if max isn't positive
+func newHashLimiter(max, maxQueue int) *hashLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &hashLimiter{slots: make(chan struct{}, max), maxQueue: int64(maxQueue)}
+}
+
+// acquire takes a slot, waiting for one until ctx is done, and returns how
+// long it waited. It fails with ErrServerBusy instead of waiting when the
+// queue is full.
+func (l *hashLimiter) acquire(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return 0, nil
+	default:
+	}
+
+	if waiting := atomic.AddInt64(&l.waiting, 1); l.maxQueue > 0 && waiting > l.maxQueue {
+		atomic.AddInt64(&l.waiting, -1)
+		return 0, ErrServerBusy
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// release frees a slot taken with acquire
+func (l *hashLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// slotError wraps the error of a hashing slot that couldn't be taken, so
+// callers can tell it from the errors of the work done in the slot
+type slotError struct {
+	err error
+}
+
+func (e *slotError) Error() string { return e.err.Error() }
+func (e *slotError) Unwrap() error { return e.err }
+
+// withHashSlot runs fn once a password hashing slot is free. It fails with a
+// *slotError wrapping ErrServerBusy when too many hashes are queued already,
+// or ctx.Err() if ctx is done while waiting.
+func (a *AuthKit) withHashSlot(ctx context.Context, fn func() error) error {
+	wait, err := a.hashLimiter.acquire(ctx)
+	if a.hashLimiter != nil {
+		if metrics, ok := a.config.Metrics.(HashMetrics); ok {
+			metrics.HashWait(hashWaitResult(err), wait)
+		}
+	}
+	if err != nil {
+		return &slotError{err: err}
+	}
+	defer a.hashLimiter.release()
+	return fn()
+}
+
+// hashWaitResult is the HashMetrics result for the error of a slot acquisition
+func hashWaitResult(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return MetricResultCanceled
+	}
+	return outcome(err)
+}
@@ -0,0 +1,236 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// waitForQueued waits until n hashes are waiting for a slot of auth
+func waitForQueued(t *testing.T, auth *AuthKit, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&auth.hashLimiter.waiting) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued hashes, got %d", n, atomic.LoadInt64(&auth.hashLimiter.waiting))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// saturateHashes takes auth's only hashing slot and fills its queue of one,
+// until the returned function is called
+func saturateHashes(t *testing.T, auth *AuthKit) func() {
+	t.Helper()
+	if _, err := auth.hashLimiter.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := auth.hashLimiter.acquire(ctx); err == nil {
+			auth.hashLimiter.release()
+		}
+	}()
+	waitForQueued(t, auth, 1)
+	return func() {
+		cancel()
+		<-done
+		auth.hashLimiter.release()
+	}
+}
+
+func TestHashLimiter(t *testing.T) {
+	metrics, err := NewPrometheusMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newTestKit(t, Config{
+		MaxConcurrentHashes: 1,
+		MaxHashQueue:        1,
+		Metrics:             metrics,
+		MaxLoginAttempts:    5,
+	})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "limited@example.com").User
+
+	if _, err := auth.hashLimiter.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Given up on while queued: not counted as an attempt
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := auth.LoginUserCtx(ctx, "limited@example.com", "wrong-password"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := auth.LoginUser("limited@example.com", "wrong-password")
+		queued <- err
+	}()
+	waitForQueued(t, auth, 1)
+
+	// The queue is full: fail fast, for known and unknown emails alike
+	for _, email := range []string{"limited@example.com", "nobody@example.com"} {
+		_, err := auth.LoginUser(email, "wrong-password")
+		if !errors.Is(err, ErrServerBusy) || ErrorStatus(err) != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected ErrServerBusy with a 503, got %v", email, err)
+		}
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "busy@example.com", Password: "password123", Name: "Busy"}); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("Expected registration to be turned away, got %v", err)
+	}
+	if auth.ComparePassword("hash", "password") {
+		t.Error("Expected ComparePassword to fail when the queue is full")
+	}
+
+	auth.hashLimiter.release()
+	if err := <-queued; !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the queued login to be checked once a slot freed up, got %v", err)
+	}
+
+	// Only the queued attempt counts towards the lockout
+	if state, _ := auth.config.LockoutStore.Get(user.ID); state.Attempts != 1 {
+		t.Errorf("Expected 1 counted attempt, got %d", state.Attempts)
+	}
+
+	if got := testutil.ToFloat64(metrics.logins.WithLabelValues(CodeServerBusy)); got != 2 {
+		t.Errorf("Expected 2 logins turned away, got %v", got)
+	}
+	for result, want := range map[string]int{MetricResultSuccess: 1, CodeServerBusy: 1, MetricResultCanceled: 1} {
+		if n := testutil.CollectAndCount(metrics.hashWait.WithLabelValues(result).(prometheus.Histogram)); n != want {
+			t.Errorf("Expected the %s hash wait histogram, got %d", result, n)
+		}
+	}
+
+	if err := (Config{JWTSecret: "secret", MaxConcurrentHashes: -1}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a negative MaxConcurrentHashes, got %v", err)
+	}
+}
+
+func TestHashLimiterUnlimited(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	if auth.hashLimiter != nil {
+		t.Fatal("Expected no limiter by default")
+	}
+	loginTestUser(t, auth, "unlimited@example.com")
+}
+
+func TestHashLimiterHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{
+		RateLimitRPM:        -1,
+		MaxConcurrentHashes: 1,
+		MaxHashQueue:        1,
+	})
+	defer auth.Close()
+	loginTestUser(t, auth, "handlers@example.com")
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/register", auth.RegisterHandler)
+	app := fiber.New()
+	app.Post("/login", auth.LoginHandlerFiber)
+	app.Post("/register", auth.RegisterHandlerFiber)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", auth.LoginHandlerHTTP)
+	mux.HandleFunc("/register", auth.RegisterHandlerHTTP)
+	handlers := map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  mux,
+	}
+
+	release := saturateHashes(t, auth)
+	defer release()
+	for name, handler := range handlers {
+		for path, body := range map[string]string{
+			"/login":    `{"email":"handlers@example.com","password":"password123"}`,
+			"/register": fmt.Sprintf(`{"email":"%s@example.com","password":"password123","name":"Busy"}`, name),
+		} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), CodeServerBusy) {
+				t.Errorf("%s %s: expected 503 %s, got %d %s", name, path, CodeServerBusy, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+// BenchmarkValidateTokenUnderHashLoad validates tokens while logins keep
+// every core busy with bcrypt, reporting the p99 validation latency. With
+// MaxConcurrentHashes below the core count, validation keeps a core to itself:
+//
+//	go test -run XXX -bench ValidateTokenUnderHashLoad -cpu 4
+func BenchmarkValidateTokenUnderHashLoad(b *testing.B) {
+	procs := runtime.GOMAXPROCS(0)
+	for _, bench := range []struct {
+		name   string
+		logins int
+		limit  int
+	}{
+		{"idle", 0, 0},
+		{"unlimited", 4 * procs, 0},
+		{"limited", 4 * procs, (procs + 1) / 2},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			auth := newTestKit(b, Config{BCryptCost: 10, MaxConcurrentHashes: bench.limit})
+			defer auth.Close()
+			if _, err := auth.RegisterUser(RegisterRequest{Email: "load@example.com", Password: "password123", Name: "Load"}); err != nil {
+				b.Fatal(err)
+			}
+			tokens, err := auth.LoginUser("load@example.com", "password123")
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+			for i := 0; i < bench.logins; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						_, _ = auth.LoginUserCtx(ctx, "load@example.com", "password123")
+					}
+				}()
+			}
+			defer wg.Wait()
+			defer cancel()
+			time.Sleep(50 * time.Millisecond) // let the logins saturate the cores
+
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := range latencies {
+				start := time.Now()
+				if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+					b.Fatal(err)
+				}
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package authkit
+
+import "fmt"
+
+// Hooks are callbacks run after user events, see Config.Hooks. They run
+// synchronously once the operation is done and AuthKit's locks are released,
+// in the order the events happen. Each hook gets its own copy of the user,
+// so changing it has no effect. Errors and panics don't affect the operation;
+// they are passed to OnError.
+type Hooks struct {
+	OnRegister       func(user *UserInfo) error
+	OnLogin          func(user *UserInfo) error
+	OnLoginFailed    func(email string, err error) error // err is the error LoginUser or CompleteMFALogin returned
+	OnTokenRefreshed func(user *UserInfo) error
+	OnUserUpdated    func(user *UserInfo) error
+	OnUserDeleted    func(userID string) error
+
+	// OnError receives the errors returned by hooks and their recovered panics
+	OnError func(hook string, err error)
+}
+
+// runHook runs a hook, reporting its error or panic to Hooks.OnError
+func (a *AuthKit) runHook(name string, hook func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.hookError(name, fmt.Errorf("hook panicked: %v", r))
+		}
+	}()
+
+	if err := hook(); err != nil {
+		a.hookError(name, err)
+	}
+}
+
+// hookError passes a hook's error to Hooks.OnError, ignoring panics in OnError itself
+func (a *AuthKit) hookError(name string, err error) {
+	a.config.Logger.Warn("hook failed", "hook", name, "error", err)
+	if a.config.Hooks.OnError == nil {
+		return
+	}
+	defer func() { _ = recover() }()
+	a.config.Hooks.OnError(name, err)
+}
+
+// loginFailed runs the OnLoginFailed hook
+func (a *AuthKit) loginFailed(email string, err error) {
+	if hook := a.config.Hooks.OnLoginFailed; hook != nil {
+		a.runHook("OnLoginFailed", func() error { return hook(email, err) })
+	}
+}
@@ -0,0 +1,117 @@
+package authkit
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHooksOrder(t *testing.T) {
+	var calls []string
+	var auth *AuthKit
+	record := func(name string) func(user *UserInfo) error {
+		return func(user *UserInfo) error {
+			// Hooks run after the locks are released, so calling back in is fine
+			if _, err := auth.GetUserByID(user.ID); err != nil {
+				t.Errorf("%s: GetUserByID from a hook: %v", name, err)
+			}
+			calls = append(calls, name+":"+user.Email)
+			return nil
+		}
+	}
+	auth = newTestKit(t, Config{
+		Hooks: Hooks{
+			OnRegister:       record("register"),
+			OnLogin:          record("login"),
+			OnTokenRefreshed: record("refresh"),
+			OnUserUpdated:    record("update"),
+			OnLoginFailed: func(email string, err error) error {
+				calls = append(calls, "failed:"+email+":"+ErrorCode(err))
+				return nil
+			},
+			OnUserDeleted: func(userID string) error {
+				calls = append(calls, "delete")
+				return nil
+			},
+		},
+	})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "hooks@example.com", Password: "password123", Name: "Hooks"})
+	_, _ = auth.LoginUser("nobody@example.com", "password123")
+	_, _ = auth.LoginUser("hooks@example.com", "wrong-password")
+	tokens, _ := auth.LoginUser("hooks@example.com", "password123")
+	_, _ = auth.RefreshToken(tokens.RefreshToken)
+	_, _ = auth.UpdateUser(user.ID, map[string]interface{}{"name": "Renamed"})
+	_ = auth.DeleteUser(user.ID)
+
+	want := []string{
+		"register:hooks@example.com",
+		"failed:nobody@example.com:invalid_credentials",
+		"failed:hooks@example.com:invalid_credentials",
+		"login:hooks@example.com",
+		"refresh:hooks@example.com",
+		"update:hooks@example.com",
+		"delete",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("Expected hook calls %v, got %v", want, calls)
+	}
+}
+
+func TestHooksCannotMutateState(t *testing.T) {
+	mutate := func(user *UserInfo) error {
+		user.Name = "Hacked"
+		user.Role = "admin"
+		user.Permissions = append(user.Permissions[:0], "everything")
+		user.Metadata["plan"] = "enterprise"
+		return nil
+	}
+	auth := newTestKit(t, Config{
+		Hooks: Hooks{OnRegister: mutate, OnLogin: mutate},
+	})
+	defer auth.Close()
+
+	info, _ := auth.RegisterUser(RegisterRequest{
+		Email: "immutable@example.com", Password: "password123", Name: "Immutable",
+		Metadata: map[string]interface{}{"plan": "free"},
+	})
+	tokens, _ := auth.LoginUser("immutable@example.com", "password123")
+
+	for _, got := range []*UserInfo{info, tokens.User} {
+		if got.Name != "Immutable" || got.Role != "user" || got.Metadata["plan"] != "free" {
+			t.Errorf("Expected the returned user to be untouched, got %+v", got)
+		}
+	}
+	stored, _ := auth.GetUserByID(info.ID)
+	if stored.Name != "Immutable" || stored.Role != "user" || len(stored.Permissions) != 0 || stored.Metadata["plan"] != "free" {
+		t.Errorf("Expected the stored user to be untouched, got %+v", stored)
+	}
+}
+
+func TestHookErrorsAndPanics(t *testing.T) {
+	var reported []string
+	auth := newTestKit(t, Config{
+		Hooks: Hooks{
+			OnRegister: func(user *UserInfo) error { return errors.New("welcome email failed") },
+			OnLogin:    func(user *UserInfo) error { panic("buggy hook") },
+			OnError: func(hook string, err error) {
+				reported = append(reported, hook+": "+err.Error())
+				panic("buggy error handler")
+			},
+		},
+	})
+	defer auth.Close()
+
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "panic@example.com", Password: "password123", Name: "Panic"}); err != nil {
+		t.Fatalf("Expected a failing hook not to fail registration, got %v", err)
+	}
+	if _, err := auth.LoginUser("panic@example.com", "password123"); err != nil {
+		t.Fatalf("Expected a panicking hook not to fail login, got %v", err)
+	}
+
+	if len(reported) != 2 || reported[0] != "OnRegister: welcome email failed" || !strings.HasPrefix(reported[1], "OnLogin: hook panicked: buggy hook") {
+		t.Errorf("Expected both failures to be reported, got %v", reported)
+	}
+}
@@ -0,0 +1,287 @@
+package authkit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity is a user's account at an external identity provider such
+// as Google or GitHub, as reported by the provider after sign-in
+type ExternalIdentity struct {
+	Provider string // Provider name, e.g. "google"
+	Subject  string // The provider's stable user ID
+	Email    string
+	// EmailVerified is whether the provider vouches for the email, see
+	// Config.LinkIdentitiesByEmail
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// LinkedIdentity is an external identity users can log in with, see
+// LoginWithIdentity
+type LinkedIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"` // As reported when linked
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	LinkedAt  time.Time `json:"linked_at"`
+}
+
+// LoginWithIdentity logs in the user an external identity is linked to,
+// after the caller authenticated them with the provider, e.g. through the
+// oauth package. Identities not linked yet get a new passwordless user with
+// the identity's email, name and verification status, unless the email is
+// taken: then it fails with ErrIdentityNotLinked, or links the identity to
+// that user with Config.LinkIdentitiesByEmail and a verified email. Like
+// LoginUser it returns an MFA token for users with TOTP enabled.
+func (a *AuthKit) LoginWithIdentity(identity ExternalIdentity, opts LoginOptions) (*TokenResponse, error) {
+	return a.LoginWithIdentityCtx(context.Background(), identity, opts)
+}
+
+// LoginWithIdentityCtx is LoginWithIdentity with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) LoginWithIdentityCtx(ctx context.Context, identity ExternalIdentity, opts LoginOptions) (tokens *TokenResponse, err error) {
+	a.debugCheck()
+
+	ctx, span := a.startSpan(ctx, "LoginWithIdentity")
+	defer func() {
+		err = opError("login with identity", err)
+		endSpan(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if identity.Provider == "" || identity.Subject == "" {
+		return nil, fmt.Errorf("%w: identity without provider or subject", ErrIdentityProviderFailed)
+	}
+	return a.loginWithIdentity(ctx, span, identity, opts, true)
+}
+
+// loginWithIdentity logs in with identity as described on LoginWithIdentity,
+// failing with ErrUserNotFound instead of creating a user unless create is set
+func (a *AuthKit) loginWithIdentity(ctx context.Context, span Span, identity ExternalIdentity, opts LoginOptions, create bool) (tokens *TokenResponse, err error) {
+	user, err := a.identityUser(identity, opts.TenantID, create)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute(TraceAttrUserID, a.traceUserID(user.ID))
+
+	lifetimes := a.loginLifetimes(opts)
+	switch {
+	case user.PurgeAt != nil:
+		err = ErrAccountPendingDeletion
+	case user.Disabled:
+		err = ErrUserDisabled
+	case a.config.EmailRequired && !user.EmailVerified:
+		err = ErrEmailNotVerified
+	case user.TOTPEnabled:
+		tokens, err = a.mfaToken(user, nil, lifetimes, opts.Scope, opts.Nonce)
+	default:
+		if tokens, err = a.tokenPair(user, nil, lifetimes, opts.Scope, opts.Nonce); err == nil {
+			a.sendNewLoginAlert(tokens.User)
+		}
+	}
+	a.recordLogin(ctx, user, []LoginContext{opts.Context}, tokens, err)
+	return tokens, err
+}
+
+// identityUser returns the user of the tenant to log in with identity,
+// linking or creating one as described on LoginWithIdentity
+func (a *AuthKit) identityUser(identity ExternalIdentity, tenantID string, create bool) (*User, error) {
+	if user := a.findUserByIdentity(tenantID, identity.Provider, identity.Subject); user != nil {
+		return linkedUser(user)
+	}
+	if !create && identity.Email == "" {
+		return nil, ErrUserNotFound
+	}
+
+	email, err := a.NormalizeEmail(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing := a.findUserByEmail(tenantID, email); existing != nil {
+		return a.linkByEmail(existing.ID, identity)
+	}
+	if !create {
+		return nil, ErrUserNotFound
+	}
+
+	now := a.now()
+	user := &User{
+		ID:            uuid.New().String(),
+		TenantID:      tenantID,
+		Email:         email,
+		Name:          identity.Name,
+		Role:          defaultRole,
+		Permissions:   []string{},
+		EmailVerified: identity.EmailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Identities:    []LinkedIdentity{newLinkedIdentity(identity, now)},
+	}
+	// Snapshot before storing, afterwards the user may be updated concurrently
+	snapshot := cloneUser(user)
+
+	if _, err := a.registerUser(user, user.ID); err != nil {
+		// The identity or the email may have been registered in the meantime
+		if linked := a.findUserByIdentity(tenantID, identity.Provider, identity.Subject); linked != nil {
+			return linkedUser(linked)
+		}
+		if existing := a.findUserByEmail(tenantID, email); existing != nil {
+			return a.linkByEmail(existing.ID, identity)
+		}
+		return nil, err
+	}
+	a.audit(AuditEvent{Type: AuditIdentityLinked, ActorID: user.ID, UserID: user.ID,
+		Metadata: map[string]string{"provider": identity.Provider}})
+	return snapshot, nil
+}
+
+// linkedUser returns a copy of the user found by findUserByIdentity, unless
+// it was soft-deleted
+func linkedUser(user *User) (*User, error) {
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+// linkByEmail links identity to the user with its email when
+// Config.LinkIdentitiesByEmail allows it
+func (a *AuthKit) linkByEmail(userID string, identity ExternalIdentity) (*User, error) {
+	if !a.config.LinkIdentitiesByEmail || !identity.EmailVerified {
+		return nil, ErrIdentityNotLinked
+	}
+	return a.linkIdentity(userID, identity)
+}
+
+// LinkIdentity links an external identity to a user, who can then log in
+// with it through LoginWithIdentity. Users can link one identity per
+// provider, each to one user of the tenant, or it fails with
+// ErrIdentityAlreadyLinked. Linking an identity again is a no-op.
+func (a *AuthKit) LinkIdentity(userID string, identity ExternalIdentity) error {
+	a.debugCheck()
+
+	if identity.Provider == "" || identity.Subject == "" {
+		return fmt.Errorf("%w: identity without provider or subject", ErrIdentityProviderFailed)
+	}
+	_, err := a.linkIdentity(userID, identity)
+	return err
+}
+
+// linkIdentity links identity to the user and returns a copy of the user
+func (a *AuthKit) linkIdentity(userID string, identity ExternalIdentity) (*User, error) {
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists || stored.DeletedAt != nil {
+		a.mutex.Unlock()
+		return nil, ErrUserNotFound
+	}
+	if linked := a.findUserByIdentity(stored.TenantID, identity.Provider, identity.Subject); linked != nil && linked.ID != userID {
+		a.mutex.Unlock()
+		return nil, ErrIdentityAlreadyLinked
+	}
+	for _, existing := range stored.Identities {
+		if existing.Provider != identity.Provider {
+			continue
+		}
+		a.mutex.Unlock()
+		if existing.Subject != identity.Subject {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return cloneUser(stored), nil
+	}
+
+	now := a.now()
+	user := cloneUser(stored)
+	user.Identities = append(user.Identities, newLinkedIdentity(identity, now))
+	user.UpdatedAt = now
+	a.users.put(cloneUser(user))
+	a.mutex.Unlock()
+
+	a.audit(AuditEvent{Type: AuditIdentityLinked, ActorID: userID, UserID: userID,
+		Metadata: map[string]string{"provider": identity.Provider}})
+	return user, nil
+}
+
+// UnlinkIdentity removes the user's identity at provider, failing with
+// ErrIdentityNotFound if there is none. Users without a password may be left
+// with no way to log in but password reset and login links.
+func (a *AuthKit) UnlinkIdentity(userID, provider string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists || stored.DeletedAt != nil {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+	user := cloneUser(stored)
+	kept := user.Identities[:0]
+	for _, identity := range user.Identities {
+		if identity.Provider != provider {
+			kept = append(kept, identity)
+		}
+	}
+	if len(kept) == len(user.Identities) {
+		a.mutex.Unlock()
+		return ErrIdentityNotFound
+	}
+	user.Identities = kept
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	a.mutex.Unlock()
+
+	a.audit(AuditEvent{Type: AuditIdentityUnlinked, ActorID: userID, UserID: userID,
+		Metadata: map[string]string{"provider": provider}})
+	return nil
+}
+
+// GetUserByIdentity retrieves a copy of the user an external identity is
+// linked to
+func (a *AuthKit) GetUserByIdentity(provider, subject string) (*User, error) {
+	return a.GetUserByIdentityInTenant("", provider, subject)
+}
+
+// GetUserByIdentityInTenant is GetUserByIdentity for the users of the tenant
+func (a *AuthKit) GetUserByIdentityInTenant(tenantID, provider, subject string) (*User, error) {
+	a.debugCheck()
+
+	user := a.findUserByIdentity(tenantID, provider, subject)
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+// findUserByIdentity returns the stored user of the tenant an identity is
+// linked to, or nil. Soft-deleted users keep their identities so they can't
+// be taken over. The result must not be modified.
+func (a *AuthKit) findUserByIdentity(tenantID, provider, subject string) *User {
+	for _, user := range a.users.all() {
+		if user.TenantID != tenantID {
+			continue
+		}
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return user
+			}
+		}
+	}
+	return nil
+}
+
+// newLinkedIdentity records identity as linked at now
+func newLinkedIdentity(identity ExternalIdentity, now time.Time) LinkedIdentity {
+	return LinkedIdentity{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		AvatarURL: identity.AvatarURL,
+		LinkedAt:  now,
+	}
+}
@@ -0,0 +1,163 @@
+package authkit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testIdentity = ExternalIdentity{
+	Provider:      "github",
+	Subject:       "1001",
+	Email:         "Octo@Example.com",
+	EmailVerified: true,
+	Name:          "Octo Cat",
+	AvatarURL:     "https://avatars.example.com/octocat",
+}
+
+func TestLoginWithIdentityCreatesUser(t *testing.T) {
+	auth := newTestKit(t, Config{SoftDelete: true})
+	defer auth.Close()
+
+	tokens, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := auth.GetUserByIdentity("github", "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != tokens.User.ID || user.Email != "octo@example.com" || user.Name != "Octo Cat" || !user.EmailVerified || user.Password != "" {
+		t.Errorf("Expected a passwordless user from the identity, got %+v", user)
+	}
+	if len(tokens.User.Identities) != 1 || tokens.User.Identities[0].AvatarURL != testIdentity.AvatarURL {
+		t.Errorf("Expected the linked identity on the user, got %+v", tokens.User.Identities)
+	}
+	if _, err := auth.LoginUser("octo@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected no password login, got %v", err)
+	}
+
+	again, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+	if err != nil || again.User.ID != user.ID {
+		t.Fatalf("Expected the same user on the next login, got %+v %v", again, err)
+	}
+	if _, err := auth.LoginWithIdentity(testIdentity, LoginOptions{TenantID: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, _ := auth.GetUserByIdentityInTenant("acme", "github", "1001"); tenant == nil || tenant.ID == user.ID {
+		t.Error("Expected a separate user in the tenant")
+	}
+
+	// The identity of a deleted user can't create a new one
+	if err := auth.DeleteUser(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.LoginWithIdentity(testIdentity, LoginOptions{}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for a deleted user, got %v", err)
+	}
+	if _, err := auth.LoginWithIdentity(ExternalIdentity{Provider: "github"}, LoginOptions{}); !errors.Is(err, ErrIdentityProviderFailed) {
+		t.Errorf("Expected ErrIdentityProviderFailed without a subject, got %v", err)
+	}
+}
+
+func TestLoginWithIdentityChecksUser(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+
+	tokens, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollTestTOTP(t, auth, tokens.User.ID)
+	pending, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+	if err != nil || !pending.MFARequired || pending.AccessToken != "" {
+		t.Fatalf("Expected an MFA challenge, got %+v %v", pending, err)
+	}
+
+	if err := auth.DisableUser(tokens.User.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.LoginWithIdentity(testIdentity, LoginOptions{}); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled, got %v", err)
+	}
+}
+
+func TestLoginWithIdentityEmailCollision(t *testing.T) {
+	for _, linkByEmail := range []bool{false, true} {
+		auth := newTestKit(t, Config{LinkIdentitiesByEmail: linkByEmail})
+		registered := loginTestUser(t, auth, "octo@example.com").User
+
+		unverified := testIdentity
+		unverified.EmailVerified = false
+		if _, err := auth.LoginWithIdentity(unverified, LoginOptions{}); !errors.Is(err, ErrIdentityNotLinked) {
+			t.Errorf("Expected ErrIdentityNotLinked for an unverified email, got %v", err)
+		}
+
+		tokens, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+		switch {
+		case !linkByEmail && !errors.Is(err, ErrIdentityNotLinked):
+			t.Errorf("Expected ErrIdentityNotLinked, got %v", err)
+		case linkByEmail && (err != nil || tokens.User.ID != registered.ID || len(tokens.User.Identities) != 1):
+			t.Errorf("Expected the identity linked to the registered user, got %+v %v", tokens, err)
+		}
+		auth.Close()
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "user@example.com").User
+	other := loginTestUser(t, auth, "other@example.com").User
+
+	if err := auth.LinkIdentity(user.ID, testIdentity); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LinkIdentity(user.ID, testIdentity); err != nil {
+		t.Errorf("Expected linking again to be a no-op, got %v", err)
+	}
+	second := testIdentity
+	second.Subject = "1002"
+	if err := auth.LinkIdentity(user.ID, second); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Errorf("Expected one identity per provider, got %v", err)
+	}
+	if err := auth.LinkIdentity(other.ID, testIdentity); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Errorf("Expected the identity to be linked to one user, got %v", err)
+	}
+	if err := auth.LinkIdentity("missing", second); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	tokens, err := auth.LoginWithIdentity(testIdentity, LoginOptions{})
+	if err != nil || tokens.User.ID != user.ID || tokens.User.Email != "user@example.com" {
+		t.Fatalf("Expected the linked user to log in, got %+v %v", tokens, err)
+	}
+
+	var buf bytes.Buffer
+	if err := auth.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestKit(t, Config{})
+	defer restored.Close()
+	if err := restored.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if linked, err := restored.GetUserByIdentity("github", "1001"); err != nil || linked.ID != user.ID {
+		t.Errorf("Expected identities to survive SaveState, got %+v %v", linked, err)
+	}
+
+	if err := auth.UnlinkIdentity(user.ID, "github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.UnlinkIdentity(user.ID, "github"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Expected ErrIdentityNotFound, got %v", err)
+	}
+	if _, err := auth.GetUserByIdentity("github", "1001"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the identity to be unlinked, got %v", err)
+	}
+	if err := auth.LinkIdentity(other.ID, testIdentity); err != nil {
+		t.Errorf("Expected the unlinked identity to be linkable again, got %v", err)
+	}
+}
@@ -0,0 +1,575 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// runCLI executes the authkit command with args against the test store,
+// returning its output
+func runCLI(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	return runCLIWithInput(t, dir, "", args...)
+}
+
+// runCLIWithInput is runCLI with stdin reading input. Flags left set by
+// previous runs are reset first.
+func runCLIWithInput(t *testing.T, dir, input string, args ...string) string {
+	t.Helper()
+	resetFlags(rootCmd)
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetIn(strings.NewReader(input))
+	rootCmd.SetArgs(append(args, "--config", filepath.Join(dir, "config.yaml"), "--store", filepath.Join(dir, "users.json")))
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("authkit %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String()
+}
+
+// resetFlags restores the flags of cmd and its subcommands to their defaults
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// outputField returns the value printed for key
+func outputField(t *testing.T, output, key string) string {
+	t.Helper()
+	match := regexp.MustCompile(`"` + key + `": "([^"]+)"`).FindStringSubmatch(output)
+	if match == nil {
+		t.Fatalf("Expected %s in the output, got %q", key, output)
+	}
+	return match[1]
+}
+
+func TestUserCommandsShareStore(t *testing.T) {
+	dir := t.TempDir()
+	config := "jwt_secret: cli-test-secret-key\nbcrypt_cost: 4\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runCLI(t, dir, "user", "register", "--email", "cli@example.com", "--password", "password123", "--name", "CLI")
+	userID := outputField(t, out, "user_id")
+
+	out = runCLI(t, dir, "user", "login", "--email", "cli@example.com", "--password", "password123")
+	accessToken := outputField(t, out, "access_token")
+	refresh := outputField(t, out, "refresh_token")
+
+	if out := runCLI(t, dir, "token", "validate", "--token", accessToken); !strings.Contains(out, "Token is valid!") {
+		t.Errorf("Expected the token to validate, got %q", out)
+	}
+	if out := runCLI(t, dir, "user", "list"); !strings.Contains(out, "Found 1 users") {
+		t.Errorf("Expected the registered user listed, got %q", out)
+	}
+
+	out = runCLI(t, dir, "token", "refresh", "--refresh-token", refresh)
+	if out := runCLI(t, dir, "token", "validate", "--token", outputField(t, out, "access_token")); !strings.Contains(out, "Token is valid!") {
+		t.Errorf("Expected the refreshed token to validate, got %q", out)
+	}
+
+	runCLI(t, dir, "user", "delete", "--id", userID)
+	if out := runCLI(t, dir, "user", "list"); !strings.Contains(out, "Found 0 users") {
+		t.Errorf("Expected the deleted user gone, got %q", out)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the store readable by its owner only, got %v", info.Mode().Perm())
+	}
+}
+
+func TestStoreLock(t *testing.T) {
+	storePath = filepath.Join(t.TempDir(), "users.json")
+	defer func() { storePath = "" }()
+
+	first, err := openStore(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		second, err := openStore(false)
+		if err != nil {
+			t.Error(err)
+		} else {
+			second.close()
+		}
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected the store to stay locked while a command writes it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.close()
+	<-locked
+}
+
+func TestServer(t *testing.T) {
+	storePath = filepath.Join(t.TempDir(), "users.json")
+	defer func() { storePath = "" }()
+	auth := authkit.New(authkit.Config{JWTSecret: "cli-test-secret-key", BCryptCost: 4})
+	defer auth.Close()
+
+	server := httptest.NewServer(newServerHandler(auth, true, false))
+	defer server.Close()
+	var out bytes.Buffer
+	if failed := testServer(&out, server.Client(), server.URL); failed != 0 {
+		t.Fatalf("Expected the checks to pass, %d failed:\n%s", failed, out.String())
+	}
+
+	// The registered user was saved to the store
+	store, err := openStore(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	stored := authkit.New(authkit.Config{JWTSecret: "cli-test-secret-key", BCryptCost: 4})
+	defer stored.Close()
+	if err := store.load(stored); err != nil {
+		t.Fatal(err)
+	}
+	if users := stored.ListUsers(); len(users) != 1 {
+		t.Errorf("Expected the registered user in the store, got %d users", len(users))
+	}
+
+	req, _ := http.NewRequest(http.MethodOptions, server.URL+"/api/v1/login", nil)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected a CORS preflight response, got %d", resp.StatusCode)
+	}
+}
+
+func TestServerTestFailures(t *testing.T) {
+	// Answers 200 to everything, so registration and the invalid token fail
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var out bytes.Buffer
+	if failed := testServer(&out, server.Client(), server.URL); failed != 2 {
+		t.Errorf("Expected 2 failed checks, got %d:\n%s", failed, out.String())
+	}
+	if !strings.Contains(out.String(), "SKIP") {
+		t.Errorf("Expected the profile check skipped, got %q", out.String())
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	claims, err := parseClaims(`{"scopes":["read","write"],"id":9007199254740993}`, []string{
+		"admin=true", "level=3", "ratio=0.5", `zip="01234"`, "team=core", "expr=a=b", "id=7",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(claims)
+	want := `{"admin":true,"expr":"a=b","id":7,"level":3,"ratio":0.5,"scopes":["read","write"],"team":"core","zip":"01234"}`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	if claims, _ := parseClaims(`{"big":9007199254740993}`, nil, false); fmt.Sprint(claims["big"]) != "9007199254740993" {
+		t.Errorf("Expected large integers kept exact, got %v", claims["big"])
+	}
+	for _, pairs := range [][]string{{"novalue"}, {"=value"}, {"exp=0"}, {"aud=other"}} {
+		if _, err := parseClaims("", pairs, false); err == nil {
+			t.Errorf("%v: expected an error", pairs)
+		}
+	}
+	if _, err := parseClaims(`[1]`, nil, false); err == nil {
+		t.Error("Expected an error for a JSON array")
+	}
+	if claims, err := parseClaims("", []string{"jti=fixed"}, true); err != nil || claims["jti"] != "fixed" {
+		t.Errorf("Expected --allow-registered to allow jti, got %v, %v", claims, err)
+	}
+}
+
+func TestTokenClaimsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("jwt_secret: cli-test-secret-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runCLI(t, dir, "token", "generate", "--user-id", "claims-user", "--claims", "admin=true", "--claims", "level=3",
+		"--claims-json", `{"scopes":["read"]}`)
+	out = runCLI(t, dir, "token", "validate", "--token", outputField(t, out, "token"))
+	if want := `Custom claims: {"admin":true,"level":3,"scopes":["read"]}`; !strings.Contains(out, want) {
+		t.Errorf("Expected %q in the output, got %q", want, out)
+	}
+}
+
+func TestTokenDecode(t *testing.T) {
+	auth := authkit.New(authkit.Config{JWTSecret: "cli-test-secret-key"})
+	defer auth.Close()
+	token, err := auth.GenerateCustomToken("decode-user", map[string]interface{}{"level": 3}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No --secret or config file needed
+	dir := t.TempDir()
+	out := runCLI(t, dir, "token", "decode", "--token", token, "--output", "table")
+	for _, want := range []string{`"user_id": "decode-user"`, `"level": 3`, "Algorithm: HS256", "Expiry:    valid until", "Signature: not verified"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the output, got %q", want, out)
+		}
+	}
+	if out := runCLI(t, dir, "token", "decode", "--token", token, "--output", "yaml"); !strings.Contains(out, "level: 3\n") {
+		t.Errorf("Expected YAML numbers unquoted, got %q", out)
+	}
+	out = runCLI(t, dir, "token", "decode", "--token", token, "--output", "json")
+	var decoded decodedToken
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil || decoded.Payload["level"] != float64(3) {
+		t.Errorf("Expected the JSON output to decode, got %v, %q", err, out)
+	}
+
+	now := time.Now()
+	expired, _ := auth.GenerateCustomToken("decode-user", nil, -time.Hour)
+	if decoded, err := decodeToken(expired, now); err != nil || !strings.HasPrefix(decoded.Expiry, "EXPIRED") {
+		t.Errorf("Expected an expired token, got %+v, %v", decoded, err)
+	}
+	future, _ := auth.GenerateCustomToken("decode-user", map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}, 2*time.Hour)
+	if decoded, err := decodeToken(future, now); err != nil || !strings.HasPrefix(decoded.Expiry, "NOT YET VALID") {
+		t.Errorf("Expected a token not valid yet, got %+v, %v", decoded, err)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	for name, malformed := range map[string]string{
+		"parts":       "abc.def",
+		"base64":      header + ".!!!.sig",
+		"not JSON":    header + "." + base64.RawURLEncoding.EncodeToString([]byte("plain")) + ".sig",
+		"not object":  header + "." + base64.RawURLEncoding.EncodeToString([]byte("null")) + ".sig",
+		"empty token": "",
+	} {
+		if _, err := decodeToken(malformed, now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSecretGenerate(t *testing.T) {
+	for format, decode := range map[string]func(string) ([]byte, error){
+		"base64": base64.RawURLEncoding.DecodeString,
+		"hex":    hex.DecodeString,
+	} {
+		secret, err := generateSecret(48, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw, err := decode(secret); err != nil || len(raw) != 48 {
+			t.Errorf("%s: expected 48 random bytes, got %d, %v", format, len(raw), err)
+		}
+		if other, _ := generateSecret(48, format); other == secret {
+			t.Errorf("%s: expected a different secret each time", format)
+		}
+	}
+	if _, err := generateSecret(8, "base64"); err == nil {
+		t.Error("Expected an error for a short secret")
+	}
+	if _, err := generateSecret(32, "base32"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestKeysGenerate(t *testing.T) {
+	for _, alg := range []string{"rs256", "es256", "eddsa"} {
+		t.Run(alg, func(t *testing.T) {
+			dir := t.TempDir()
+			keys := filepath.Join(dir, "keys")
+			runCLI(t, dir, "keys", "generate", "--alg", alg, "--out-dir", keys, "--jwks")
+
+			for name, perm := range map[string]os.FileMode{"private.pem": 0o600, "public.pem": 0o644, "jwks.json": 0o644} {
+				info, err := os.Stat(filepath.Join(keys, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != perm {
+					t.Errorf("%s: expected mode %v, got %v", name, perm, info.Mode().Perm())
+				}
+			}
+			private, _ := os.ReadFile(filepath.Join(keys, "private.pem"))
+			public, _ := os.ReadFile(filepath.Join(keys, "public.pem"))
+			method, _ := signingMethod(alg)
+
+			signer, err := authkit.NewValidated(authkit.Config{SigningMethod: method, PrivateKeyPEM: string(private)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer signer.Close()
+			token, err := signer.GenerateCustomToken("key-user", nil, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier, err := authkit.NewValidated(authkit.Config{SigningMethod: method, PublicKeyPEM: string(public)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer verifier.Close()
+			if _, err := verifier.ValidateToken(token); err != nil {
+				t.Errorf("Expected the public key to verify the token, got %v", err)
+			}
+
+			info, err := inspectKey(private)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, _ := decodeToken(token, time.Now())
+			if info.Method != method || !info.Private || info.KeyID != decoded.KeyID {
+				t.Errorf("Expected %s private key with kid %s, got %+v", method, decoded.KeyID, info)
+			}
+			var set authkit.JWKSet
+			jwks, _ := os.ReadFile(filepath.Join(keys, "jwks.json"))
+			if err := json.Unmarshal(jwks, &set); err != nil || len(set.Keys) != 1 || set.Keys[0].Kid != info.KeyID {
+				t.Errorf("Expected the JWKS to hold the key, got %s", jwks)
+			}
+		})
+	}
+
+	if info, err := inspectKey([]byte("not a key")); err == nil {
+		t.Errorf("Expected an error for a file without a key, got %+v", info)
+	}
+}
+
+func TestBenchmarkHashes(t *testing.T) {
+	calls := make(map[string]int)
+	setting := func(algorithm, name string, took time.Duration) benchSetting {
+		return benchSetting{Algorithm: algorithm, Setting: name, hash: func() error {
+			calls[name]++
+			time.Sleep(took)
+			return nil
+		}}
+	}
+	results, err := benchmarkHashes([]benchSetting{
+		setting("slow", "s1", time.Millisecond),
+		setting("slow", "s2", 5*time.Millisecond),
+		setting("slow", "s3", 60*time.Millisecond),
+		setting("slow", "s4", time.Millisecond),
+		setting("fast", "f1", time.Millisecond),
+	}, 3, 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 4 || calls["s4"] != 0 {
+		t.Fatalf("Expected the settings after s3 skipped, got %+v", results)
+	}
+	if calls["s1"] != 4 || calls["s3"] != 1 {
+		t.Errorf("Expected a warm-up plus 3 runs, and a single run past the abort, got %v", calls)
+	}
+	recommended := recommendSettings(results, 20*time.Millisecond)
+	if recommended["slow"] != "s2" || recommended["fast"] != "f1" {
+		t.Errorf("Expected s2 and f1 recommended, got %v", recommended)
+	}
+
+	var out bytes.Buffer
+	if err := writeBenchmarkTable(&out, benchmarkReport{TargetMS: 20, Results: results, Recommended: recommended}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "s2") || !strings.Contains(out.String(), "<- recommended") {
+		t.Errorf("Expected the table to mark the recommendation, got %q", out.String())
+	}
+}
+
+func TestPasswordBenchmarkJSON(t *testing.T) {
+	out := runCLI(t, t.TempDir(), "password", "benchmark", "--algorithm", "bcrypt", "--max-cost", "5", "--iterations", "1", "--target-ms", "10000", "--output", "json")
+	var report benchmarkReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Expected JSON, got %v: %q", err, out)
+	}
+	if len(report.Results) != 2 || report.Recommended["bcrypt"] != "cost=5" {
+		t.Errorf("Expected costs 4 and 5 with 5 recommended, got %+v", report)
+	}
+}
+
+// fakePrompter answers prompts with the passwords in turn
+type fakePrompter struct {
+	passwords []string
+	prompts   []string
+}
+
+func (p *fakePrompter) PromptPassword(prompt string) (string, error) {
+	p.prompts = append(p.prompts, prompt)
+	if len(p.passwords) == 0 {
+		return "", errNoPassword
+	}
+	password := p.passwords[0]
+	p.passwords = p.passwords[1:]
+	return password, nil
+}
+
+func TestPasswordPrompts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("jwt_secret: cli-test-secret-key\nbcrypt_cost: 4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous passwordPrompter) { prompter = previous }(prompter)
+
+	fake := &fakePrompter{passwords: []string{"password123", "password123"}}
+	prompter = fake
+	runCLI(t, dir, "user", "register", "--email", "prompt@example.com", "--name", "Prompt")
+	if len(fake.prompts) != 2 || fake.prompts[1] != "Confirm password: " {
+		t.Errorf("Expected a password and a confirmation prompt, got %q", fake.prompts)
+	}
+
+	out := runCLIWithInput(t, dir, "password123\n", "user", "login", "--email", "prompt@example.com", "--password-stdin")
+	if !strings.Contains(out, "Login successful!") {
+		t.Errorf("Expected the password read from stdin to log in, got %q", out)
+	}
+
+	prompter = &fakePrompter{passwords: []string{"password123"}}
+	out = runCLI(t, dir, "password", "hash", "--cost", "4")
+	if strings.Contains(out, "password123") {
+		t.Errorf("Expected the password kept out of the output, got %q", out)
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	defer func(previous passwordPrompter) { prompter = previous }(prompter)
+	cmd := &cobra.Command{}
+	var password string
+	addPasswordFlags(cmd, &password, "Password")
+	run := func(args []string, input string, confirm bool) (string, error) {
+		resetFlags(cmd)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		cmd.SetIn(strings.NewReader(input))
+		return readPassword(cmd, password, confirm)
+	}
+
+	if got, err := run([]string{"--password", "flag-secret"}, "", true); err != nil || got != "flag-secret" {
+		t.Errorf("Expected the flag value, got %q, %v", got, err)
+	}
+	if got, err := run([]string{"--password-stdin"}, "stdin-secret\r\nignored\n", true); err != nil || got != "stdin-secret" {
+		t.Errorf("Expected the first line of stdin, got %q, %v", got, err)
+	}
+	if got, err := run([]string{"--password-stdin"}, "no-newline", false); err != nil || got != "no-newline" {
+		t.Errorf("Expected stdin without a newline, got %q, %v", got, err)
+	}
+
+	prompter = &fakePrompter{passwords: []string{"one", "two"}}
+	if _, err := run(nil, "", true); err == nil || !strings.Contains(err.Error(), "match") {
+		t.Errorf("Expected mismatched passwords to fail, got %v", err)
+	}
+	for name, args := range map[string][]string{
+		"both":  {"--password", "x", "--password-stdin"},
+		"empty": {"--password-stdin"},
+	} {
+		if _, err := run(args, "", false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Without a terminal, prompting fails instead of hanging
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+	prompter = terminalPrompter{}
+	if _, err := run(nil, "", false); !errors.Is(err, errNoPassword) {
+		t.Errorf("Expected errNoPassword without a terminal, got %v", err)
+	}
+}
+
+func TestUserEditCommands(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("jwt_secret: cli-test-secret-key\nbcrypt_cost: 4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out := runCLI(t, dir, "user", "register", "--email", "edit@example.com", "--password", "password123", "--name", "Edit")
+	id := outputField(t, out, "user_id")
+	show := func() userRecord {
+		t.Helper()
+		var record userRecord
+		if err := json.Unmarshal([]byte(runCLI(t, dir, "user", "show", "--email", "edit@example.com")), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	runCLI(t, dir, "user", "update", "--id", id, "--metadata", "team=core", "--metadata", "level=3")
+	runCLI(t, dir, "user", "update", "--id", id, "--name", "Edited", "--role", "admin", "--permissions", "read,write", "--metadata", "plan=pro")
+	record := show()
+	if record.Name != "Edited" || record.Role != "admin" || strings.Join(record.Permissions, ",") != "read,write" {
+		t.Errorf("Expected the updated fields, got %+v", record)
+	}
+	if record.Metadata["team"] != "core" || record.Metadata["level"] != float64(3) || record.Metadata["plan"] != "pro" {
+		t.Errorf("Expected the metadata merged, got %v", record.Metadata)
+	}
+	if out := runCLI(t, dir, "user", "show", "--id", id, "--output", "table"); !regexp.MustCompile(`(?m)^name\s+Edited$`).MatchString(out) {
+		t.Errorf("Expected a table row for the name, got %q", out)
+	}
+
+	runCLIWithInput(t, dir, "new-password-456\n", "user", "set-password", "--id", id, "--password-stdin")
+	if out := runCLI(t, dir, "user", "login", "--email", "edit@example.com", "--password", "new-password-456"); !strings.Contains(out, "Login successful!") {
+		t.Errorf("Expected the new password to log in, got %q", out)
+	}
+
+	runCLI(t, dir, "user", "disable", "--id", id, "--reason", "testing")
+	if record := show(); !record.Disabled || record.DisabledReason != "testing" {
+		t.Errorf("Expected the user disabled, got %+v", record)
+	}
+	runCLI(t, dir, "user", "enable", "--id", id)
+	if record := show(); record.Disabled {
+		t.Errorf("Expected the user enabled, got %+v", record)
+	}
+}
+
+func TestUserUpdateMissing(t *testing.T) {
+	// checkError exits, so the command runs in a child process
+	if dir := os.Getenv("AUTHKIT_CLI_TEST_DIR"); dir != "" {
+		runCLI(t, dir, "user", "update", "--id", "missing", "--name", "Nobody")
+		return
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("jwt_secret: cli-test-secret-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUserUpdateMissing$")
+	cmd.Env = append(os.Environ(), "AUTHKIT_CLI_TEST_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit status 1, got %v: %s", err, out)
+	}
+	if !strings.Contains(string(out), authkit.ErrUserNotFound.Error()) {
+		t.Errorf("Expected the library's error, got %q", out)
+	}
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Signing key commands",
+	Long:  "Commands for creating and inspecting keys for asymmetric signing",
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a signing key pair",
+	Long: `Generate a private and public key pair in PEM files for private_key_pem and
+public_key_pem, and optionally the JWKS of the public key.`,
+	Run: runKeysGenerate,
+}
+
+var keysInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Describe a PEM key",
+	Long:  "Print the type, size and kid of a PEM private or public key",
+	Run:   runKeysInspect,
+}
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 2048
+
+// Flags for keys commands
+var (
+	keyAlgorithm string
+	keyOutDir    string
+	keyJWKS      bool
+	keyFile      string
+)
+
+func init() {
+	// Add keys command to root
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysGenerateCmd)
+	keysCmd.AddCommand(keysInspectCmd)
+
+	// Generate flags
+	keysGenerateCmd.Flags().StringVar(&keyAlgorithm, "alg", "rs256", "Signing method (rs256, rs512, es256, eddsa)")
+	keysGenerateCmd.Flags().StringVar(&keyOutDir, "out-dir", "./keys", "Directory to write private.pem and public.pem to")
+	keysGenerateCmd.Flags().BoolVar(&keyJWKS, "jwks", false, "Also write jwks.json with the public key")
+
+	// Inspect flags
+	keysInspectCmd.Flags().StringVarP(&keyFile, "file", "f", "", "PEM key file (required)")
+	keysInspectCmd.MarkFlagRequired("file")
+}
+
+func runKeysGenerate(cmd *cobra.Command, args []string) {
+	method, err := signingMethod(keyAlgorithm)
+	checkError(err)
+	private, public, err := generateKeyPair(method)
+	checkError(err)
+
+	files := []keyOutput{
+		{"private.pem", private, 0o600},
+		{"public.pem", public, 0o644},
+	}
+	if keyJWKS {
+		jwks, err := publicKeyJWKS(method, public)
+		checkError(err)
+		files = append(files, keyOutput{"jwks.json", jwks, 0o644})
+	}
+
+	// Refuse before writing anything, so a key pair is never half replaced
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(keyOutDir, file.name)); err == nil {
+			checkError(fmt.Errorf("%s already exists", filepath.Join(keyOutDir, file.name)))
+		}
+	}
+	checkError(os.MkdirAll(keyOutDir, 0o700))
+	for _, file := range files {
+		path := filepath.Join(keyOutDir, file.name)
+		checkError(writeNewFile(path, file.data, file.perm))
+		fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", path)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Set signing_method: %s with private_key_pem, or public_key_pem on verifying services\n", method)
+}
+
+// keyOutput is a file written by keys generate
+type keyOutput struct {
+	name string
+	data []byte
+	perm os.FileMode
+}
+
+func runKeysInspect(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(keyFile)
+	checkError(err)
+	info, err := inspectKey(data)
+	checkError(err)
+	printOutput(info)
+}
+
+// signingMethod returns the AuthKit signing method named by alg, ignoring case
+func signingMethod(alg string) (string, error) {
+	for _, method := range []string{authkit.SigningMethodRS256, authkit.SigningMethodRS512, authkit.SigningMethodES256, authkit.SigningMethodEdDSA} {
+		if strings.EqualFold(alg, method) {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported --alg %q, use rs256, rs512, es256 or eddsa", alg)
+}
+
+// generateKeyPair creates a key for method, returning the private key as
+// PKCS #8 PEM and the public key as PKIX PEM
+func generateKeyPair(method string) (privatePEM, publicPEM []byte, err error) {
+	var private crypto.Signer
+	switch method {
+	case authkit.SigningMethodRS256, authkit.SigningMethodRS512:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case authkit.SigningMethodES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+}
+
+// publicKeyJWKS renders publicPEM as the key set an AuthKit verifying with
+// it would publish, so the kid matches the tokens' headers
+func publicKeyJWKS(method string, publicPEM []byte) ([]byte, error) {
+	verifier, err := authkit.NewValidated(authkit.Config{SigningMethod: method, PublicKeyPEM: string(publicPEM)})
+	if err != nil {
+		return nil, err
+	}
+	defer verifier.Close()
+	return verifier.JWKS()
+}
+
+// keyInfo describes a key for keys inspect
+type keyInfo struct {
+	Type    string `json:"type"`
+	Bits    int    `json:"bits"`
+	Private bool   `json:"private"`
+	Method  string `json:"signing_method"`
+	KeyID   string `json:"kid"`
+}
+
+// inspectKey describes a PEM private or public key
+func inspectKey(data []byte) (*keyInfo, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	info := &keyInfo{Private: strings.Contains(block.Type, "PRIVATE")}
+	key, err := parseKeyBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		info.Type, info.Bits, info.Method = "RSA", public.N.BitLen(), authkit.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		info.Type, info.Bits = "EC "+public.Curve.Params().Name, public.Curve.Params().BitSize
+		if public.Curve == elliptic.P256() {
+			info.Method = authkit.SigningMethodES256
+		}
+	case ed25519.PublicKey:
+		info.Type, info.Bits, info.Method = "Ed25519", 256, authkit.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if info.Method == "" {
+		return nil, fmt.Errorf("%s keys can't sign AuthKit tokens", info.Type)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	jwks, err := publicKeyJWKS(info.Method, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	var set authkit.JWKSet
+	if err := json.Unmarshal(jwks, &set); err != nil || len(set.Keys) != 1 {
+		return nil, fmt.Errorf("computing the kid: %v", err)
+	}
+	info.KeyID = set.Keys[0].Kid
+	return info, nil
+}
+
+// parseKeyBlock parses the private or public key in a PEM block, in any of
+// the encodings OpenSSL writes
+func parseKeyBlock(block *pem.Block) (interface{}, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// writeNewFile writes data to a file that must not exist yet, so an existing
+// key is never overwritten
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	// The umask may have narrowed perm
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// lockFile doesn't lock on this platform; saves still replace the store
+// atomically, but concurrent commands may overwrite each other's changes
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -1,7 +1,13 @@
 package cli
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
 
 	"github.com/codedbygo/go-authkit"
 	"github.com/spf13/cobra"
@@ -16,24 +22,54 @@ var passwordCmd = &cobra.Command{
 var passwordHashCmd = &cobra.Command{
 	Use:   "hash",
 	Short: "Hash a password",
-	Long:  "Hash a password using bcrypt",
+	Long:  "Hash a password using bcrypt (default) or Argon2id",
 	Run:   runPasswordHash,
 }
 
 var passwordCompareCmd = &cobra.Command{
 	Use:   "compare",
 	Short: "Compare a password with its hash",
-	Long:  "Compare a plain password with its bcrypt hash",
+	Long:  "Compare a plain password with its bcrypt or Argon2id hash",
 	Run:   runPasswordCompare,
 }
 
+var passwordBenchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Time password hashing on this machine",
+	Long: `Time bcrypt at increasing costs and a few Argon2id presets on this machine,
+recommending the strongest setting that hashes within --target-ms.`,
+	Run: runPasswordBenchmark,
+}
+
 // Flags for password commands
 var (
 	plainPassword  string
 	hashedPassword string
 	bcryptCost     int
+	hashAlgorithm  string
+	targetMS       int
+	benchIters     int
+	benchMaxCost   int
+	benchAlgorithm string
 )
 
+// benchmarkAbort stops a benchmark once a single hash takes longer, as
+// higher settings only take longer still. Four times the target stops it
+// sooner.
+const benchmarkAbort = 3 * time.Second
+
+// argon2Presets are the Argon2id settings password benchmark times, from
+// weakest to strongest
+var argon2Presets = []struct {
+	name   string
+	params authkit.Argon2Params
+}{
+	{"owasp", authkit.Argon2Params{Memory: 19 * 1024, Time: 2, Parallelism: 1}},
+	{"default", authkit.Argon2Params{Memory: 64 * 1024, Time: 3, Parallelism: 2}},
+	{"rfc9106", authkit.Argon2Params{Memory: 64 * 1024, Time: 3, Parallelism: 4}},
+	{"high", authkit.Argon2Params{Memory: 256 * 1024, Time: 3, Parallelism: 4}},
+}
+
 func init() {
 	// Add password command to root
 	rootCmd.AddCommand(passwordCmd)
@@ -41,43 +77,232 @@ func init() {
 	// Add subcommands to password
 	passwordCmd.AddCommand(passwordHashCmd)
 	passwordCmd.AddCommand(passwordCompareCmd)
+	passwordCmd.AddCommand(passwordBenchmarkCmd)
 
 	// Hash flags
-	passwordHashCmd.Flags().StringVarP(&plainPassword, "password", "p", "", "Password to hash (required)")
+	addPasswordFlags(passwordHashCmd, &plainPassword, "Password to hash")
 	passwordHashCmd.Flags().IntVarP(&bcryptCost, "cost", "c", 12, "BCrypt cost (4-31)")
-	passwordHashCmd.MarkFlagRequired("password")
+	passwordHashCmd.Flags().StringVarP(&hashAlgorithm, "algorithm", "a", authkit.PasswordHasherBcrypt, "Hashing algorithm (bcrypt, argon2id)")
 
 	// Compare flags
-	passwordCompareCmd.Flags().StringVarP(&plainPassword, "password", "p", "", "Plain password (required)")
+	addPasswordFlags(passwordCompareCmd, &plainPassword, "Plain password")
 	passwordCompareCmd.Flags().StringVarP(&hashedPassword, "hash", "H", "", "Hashed password (required)")
-	passwordCompareCmd.MarkFlagRequired("password")
 	passwordCompareCmd.MarkFlagRequired("hash")
+
+	// Benchmark flags
+	passwordBenchmarkCmd.Flags().IntVar(&targetMS, "target-ms", 250, "Longest acceptable time to hash a password, in milliseconds")
+	passwordBenchmarkCmd.Flags().IntVar(&benchIters, "iterations", 3, "Timed runs per setting, after a warm-up run")
+	passwordBenchmarkCmd.Flags().IntVar(&benchMaxCost, "max-cost", 20, "Highest bcrypt cost to try")
+	passwordBenchmarkCmd.Flags().StringVarP(&benchAlgorithm, "algorithm", "a", "all", "Algorithms to time (bcrypt, argon2id, all)")
 }
 
 func runPasswordHash(cmd *cobra.Command, args []string) {
-	hashed, err := authkit.HashPasswordStatic(plainPassword, bcryptCost)
+	password, err := readPassword(cmd, plainPassword, false)
 	checkError(err)
 
-	fmt.Printf("Password hashed successfully!\n")
-	printOutput(map[string]interface{}{
-		"original": plainPassword,
-		"hashed":   hashed,
-		"cost":     bcryptCost,
-	})
+	// The password itself is left out, it may have been typed at a prompt
+	output := map[string]interface{}{
+		"algorithm": hashAlgorithm,
+	}
+
+	var hashed string
+	switch hashAlgorithm {
+	case authkit.PasswordHasherBcrypt:
+		hashed, err = authkit.HashPasswordStatic(password, bcryptCost)
+		output["cost"] = bcryptCost
+	case authkit.PasswordHasherArgon2id:
+		hashed, err = authkit.HashPasswordArgon2(password, authkit.Argon2Params{})
+	default:
+		err = fmt.Errorf("unsupported algorithm %q", hashAlgorithm)
+	}
+	checkError(err)
+	output["hashed"] = hashed
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Password hashed successfully!\n")
+	printOutput(output)
 }
 
 func runPasswordCompare(cmd *cobra.Command, args []string) {
-	isValid := authkit.ComparePasswordStatic(hashedPassword, plainPassword)
+	password, err := readPassword(cmd, plainPassword, false)
+	checkError(err)
+	isValid := authkit.ComparePasswordAny(hashedPassword, password)
 
 	if isValid {
-		fmt.Printf("Password matches hash!\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "Password matches hash!\n")
 	} else {
-		fmt.Printf("Password does not match hash!\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "Password does not match hash!\n")
 	}
 
 	printOutput(map[string]interface{}{
-		"valid":    isValid,
-		"password": plainPassword,
-		"hash":     hashedPassword,
+		"valid": isValid,
+		"hash":  hashedPassword,
 	})
 }
+
+func runPasswordBenchmark(cmd *cobra.Command, args []string) {
+	if targetMS <= 0 || benchIters <= 0 {
+		checkError(errors.New("--target-ms and --iterations must be positive"))
+	}
+	target := time.Duration(targetMS) * time.Millisecond
+
+	var settings []benchSetting
+	if benchAlgorithm == "all" || benchAlgorithm == authkit.PasswordHasherBcrypt {
+		for cost := 4; cost <= benchMaxCost && cost <= 31; cost++ {
+			cost := cost
+			settings = append(settings, benchSetting{
+				Algorithm: authkit.PasswordHasherBcrypt,
+				Setting:   fmt.Sprintf("cost=%d", cost),
+				hash: func() error {
+					_, err := authkit.HashPasswordStatic("benchmark-password", cost)
+					return err
+				},
+			})
+		}
+	}
+	if benchAlgorithm == "all" || benchAlgorithm == authkit.PasswordHasherArgon2id {
+		for _, preset := range argon2Presets {
+			params := preset.params
+			settings = append(settings, benchSetting{
+				Algorithm: authkit.PasswordHasherArgon2id,
+				Setting:   fmt.Sprintf("%s (m=%d,t=%d,p=%d)", preset.name, params.Memory, params.Time, params.Parallelism),
+				hash: func() error {
+					_, err := authkit.HashPasswordArgon2("benchmark-password", params)
+					return err
+				},
+			})
+		}
+	}
+	if len(settings) == 0 {
+		checkError(fmt.Errorf("unsupported --algorithm %q, use bcrypt, argon2id or all", benchAlgorithm))
+	}
+
+	// Settings well past the target can't be recommended, no need to wait for them
+	abort := benchmarkAbort
+	if 4*target < abort {
+		abort = 4 * target
+	}
+	results, err := benchmarkHashes(settings, benchIters, abort)
+	checkError(err)
+	report := benchmarkReport{TargetMS: targetMS, Results: results, Recommended: recommendSettings(results, target)}
+
+	// The table is the default, JSON only when asked for
+	if flag := cmd.Flag("output"); flag != nil && flag.Changed && outputFormat == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		checkError(encoder.Encode(report))
+		return
+	}
+	checkError(writeBenchmarkTable(cmd.OutOrStdout(), report))
+}
+
+// benchSetting is a hashing setting to time
+type benchSetting struct {
+	Algorithm string
+	Setting   string
+	hash      func() error
+}
+
+// benchResult is the median time a setting took to hash a password
+type benchResult struct {
+	Algorithm    string  `json:"algorithm"`
+	Setting      string  `json:"setting"`
+	Milliseconds float64 `json:"ms"`
+}
+
+// benchmarkReport is the output of password benchmark
+type benchmarkReport struct {
+	TargetMS    int               `json:"target_ms"`
+	Results     []benchResult     `json:"results"`
+	Recommended map[string]string `json:"recommended"`
+}
+
+// benchmarkHashes times each setting with a warm-up run followed by
+// iterations timed runs, taking the median. Settings of an algorithm are
+// expected from weakest to strongest: once a run takes longer than abort,
+// that algorithm's remaining settings are skipped.
+func benchmarkHashes(settings []benchSetting, iterations int, abort time.Duration) ([]benchResult, error) {
+	var results []benchResult
+	aborted := make(map[string]bool)
+	for _, setting := range settings {
+		if aborted[setting.Algorithm] {
+			continue
+		}
+
+		start := time.Now()
+		if err := setting.hash(); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", setting.Algorithm, setting.Setting, err)
+		}
+		durations := []time.Duration{time.Since(start)}
+		if durations[0] <= abort {
+			// The warm-up only counts when it's all there is
+			durations = durations[:0]
+			for i := 0; i < iterations; i++ {
+				start := time.Now()
+				if err := setting.hash(); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", setting.Algorithm, setting.Setting, err)
+				}
+				durations = append(durations, time.Since(start))
+			}
+		}
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		median := durations[len(durations)/2]
+		results = append(results, benchResult{
+			Algorithm:    setting.Algorithm,
+			Setting:      setting.Setting,
+			Milliseconds: float64(median.Microseconds()) / 1000,
+		})
+		if median > abort || durations[len(durations)-1] > abort {
+			aborted[setting.Algorithm] = true
+		}
+	}
+	return results, nil
+}
+
+// recommendSettings picks, per algorithm, the last setting within target,
+// results being ordered from weakest to strongest
+func recommendSettings(results []benchResult, target time.Duration) map[string]string {
+	recommended := make(map[string]string)
+	for _, result := range results {
+		if result.Milliseconds <= float64(target.Microseconds())/1000 {
+			recommended[result.Algorithm] = result.Setting
+		}
+	}
+	return recommended
+}
+
+// writeBenchmarkTable writes the results as a table followed by the recommendations
+func writeBenchmarkTable(w io.Writer, report benchmarkReport) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "ALGORITHM\tSETTING\tMS\t\n")
+	for _, result := range report.Results {
+		marker := ""
+		if report.Recommended[result.Algorithm] == result.Setting {
+			marker = "<- recommended"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%.1f\t%s\n", result.Algorithm, result.Setting, result.Milliseconds, marker)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nTarget: %d ms\n", report.TargetMS)
+	for _, algorithm := range []string{authkit.PasswordHasherBcrypt, authkit.PasswordHasherArgon2id} {
+		if setting, ok := report.Recommended[algorithm]; ok {
+			fmt.Fprintf(w, "Recommended %s: %s\n", algorithm, setting)
+		} else if hasResults(report.Results, algorithm) {
+			fmt.Fprintf(w, "Recommended %s: none within the target\n", algorithm)
+		}
+	}
+	return nil
+}
+
+// hasResults reports whether results has any for algorithm
+func hasResults(results []benchResult, algorithm string) bool {
+	for _, result := range results {
+		if result.Algorithm == algorithm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passwordStdin is the --password-stdin flag of commands taking a password
+var passwordStdin bool
+
+// errNoPassword is returned when a password is needed but there is no
+// terminal to prompt on
+var errNoPassword = errors.New("no password given: set --password-stdin to read it from stdin, or run in a terminal to be prompted")
+
+// passwordPrompter asks for passwords without echoing them
+type passwordPrompter interface {
+	// PromptPassword writes prompt and reads a password, failing with
+	// errNoPassword if it can't prompt
+	PromptPassword(prompt string) (string, error)
+}
+
+// prompter is the passwordPrompter of the commands, replaced in tests
+var prompter passwordPrompter = terminalPrompter{}
+
+// terminalPrompter prompts on stderr and reads from stdin with echo turned off
+type terminalPrompter struct{}
+
+func (terminalPrompter) PromptPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errNoPassword
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+// addPasswordFlags adds --password and --password-stdin to cmd
+func addPasswordFlags(cmd *cobra.Command, password *string, usage string) {
+	cmd.Flags().StringVarP(password, "password", "p", "", usage+" (prompted for if not set; visible to other users in shell history and ps)")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from the first line of stdin")
+}
+
+// readPassword returns the password of cmd: the --password value if set, the
+// first line of stdin with --password-stdin, or else what the user types at
+// a prompt, twice with confirm
+func readPassword(cmd *cobra.Command, password string, confirm bool) (string, error) {
+	if cmd.Flags().Changed("password") {
+		if passwordStdin {
+			return "", errors.New("--password and --password-stdin can't be used together")
+		}
+		return password, nil
+	}
+
+	if passwordStdin {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("reading the password from stdin: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		var err error
+		if password, err = prompter.PromptPassword("Password: "); err != nil {
+			return "", err
+		}
+		if confirm && password != "" {
+			again, err := prompter.PromptPassword("Confirm password: ")
+			if err != nil {
+				return "", err
+			}
+			if again != password {
+				return "", errors.New("the passwords don't match")
+			}
+		}
+	}
+
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+	return password, nil
+}
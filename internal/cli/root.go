@@ -1,16 +1,24 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"text/tabwriter"
 
+	"github.com/codedbygo/go-authkit"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var (
 	// Global flags
 	secretKey    string
+	configFile   string
 	outputFormat string
 )
 
@@ -22,7 +30,8 @@ var rootCmd = &cobra.Command{
 and authentication operations using the AuthKit library.
 
 Examples:
-  authkit user register --email user@example.com --password pass123 --name "John Doe"
+  authkit user register --email user@example.com --name "John Doe" --secret mySecret
+  echo "$PASSWORD" | authkit user login --email user@example.com --password-stdin --secret mySecret
   authkit token generate --user-id user123 --secret mySecret
   authkit token validate --token "eyJhbGc..." --secret mySecret`,
 }
@@ -36,11 +45,38 @@ func Execute() {
 
 func init() {
 	// Global flags
-	rootCmd.PersistentFlags().StringVarP(&secretKey, "secret", "s", "", "JWT secret key (required)")
+	rootCmd.PersistentFlags().StringVarP(&secretKey, "secret", "s", "", "JWT secret key (required unless set in --config)")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML or JSON config file (see authkit.LoadConfig)")
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "json", "Output format (json, table, yaml)")
+}
 
-	// Mark secret as required for commands that need it
-	rootCmd.MarkPersistentFlagRequired("secret")
+// loadConfig returns the --config file's configuration, or the CLI defaults
+// without one. --secret overrides the file's secret.
+func loadConfig() authkit.Config {
+	config := authkit.Config{TokenExpiry: "24h", BCryptCost: 12}
+	if configFile != "" {
+		var err error
+		config, err = authkit.LoadConfig(configFile)
+		checkError(err)
+	}
+	if secretKey != "" {
+		config.JWTSecret = secretKey
+	}
+	if config.JWTSecret == "" && config.PrivateKeyPEM == "" && config.PublicKeyPEM == "" && config.JWKSURL == "" {
+		checkError(errors.New("a JWT secret is required, set --secret or jwt_secret in --config"))
+	}
+	return config
+}
+
+// newAuthKit creates an AuthKit from loadConfig, after edit adjusts the configuration
+func newAuthKit(edit func(config *authkit.Config)) *authkit.AuthKit {
+	config := loadConfig()
+	if edit != nil {
+		edit(&config)
+	}
+	auth, err := authkit.NewValidated(config)
+	checkError(err)
+	return auth
 }
 
 // Common helper functions
@@ -52,22 +88,72 @@ func checkError(err error) {
 }
 
 func printJSON(data interface{}) {
-	// Implementation for JSON output
-	fmt.Printf("JSON output: %+v\n", data)
+	encoder := json.NewEncoder(rootCmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	checkError(encoder.Encode(data))
+}
+
+func printYAML(data interface{}) {
+	generic, err := genericValue(data)
+	checkError(err)
+	encoder := yaml.NewEncoder(rootCmd.OutOrStdout())
+	encoder.SetIndent(2)
+	checkError(encoder.Encode(generic))
 }
 
+// printTable prints an object as KEY VALUE rows sorted by key, nested values
+// as compact JSON. Anything but an object is printed as JSON.
 func printTable(data interface{}) {
-	// Implementation for table output
-	fmt.Printf("Table output: %+v\n", data)
+	generic, err := genericValue(data)
+	checkError(err)
+	object, ok := generic.(map[string]interface{})
+	if !ok {
+		printJSON(data)
+		return
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	table := tabwriter.NewWriter(rootCmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		value := object[key]
+		if _, scalar := value.(string); !scalar {
+			encoded, _ := json.Marshal(value)
+			value = string(encoded)
+		}
+		fmt.Fprintf(table, "%s\t%v\n", key, value)
+	}
+	checkError(table.Flush())
 }
 
+// genericValue converts data to the maps, slices and scalars its JSON
+// encoding decodes to, so every format shows the same fields
+func genericValue(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return plainNumbers(generic), nil
+}
+
+// printOutput prints data in the --output format
 func printOutput(data interface{}) {
 	switch outputFormat {
-	case "json":
-		printJSON(data)
 	case "table":
 		printTable(data)
+	case "yaml":
+		printYAML(data)
 	default:
-		fmt.Printf("%+v\n", data)
+		printJSON(data)
 	}
 }
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/spf13/cobra"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Seed roles, groups and users",
+	Long:  "Load roles, permission groups and users from a YAML or JSON seed file",
+	Run:   runSeed,
+}
+
+// Flags for seed command
+var (
+	seedFile     string
+	seedStrategy string
+)
+
+func init() {
+	// Add seed command to root
+	rootCmd.AddCommand(seedCmd)
+
+	seedCmd.Flags().StringVarP(&seedFile, "file", "f", "", "Seed file (required)")
+	seedCmd.Flags().StringVar(&seedStrategy, "strategy", string(authkit.SeedSkipExisting), "What to do with existing users (skip, update)")
+	seedCmd.MarkFlagRequired("file")
+}
+
+func runSeed(cmd *cobra.Command, args []string) {
+	edit := func(config *authkit.Config) {
+		config.SeedFile = seedFile
+		if cmd.Flags().Changed("strategy") || config.SeedStrategy == "" {
+			config.SeedStrategy = authkit.SeedStrategy(seedStrategy)
+		}
+	}
+	withStore(true, edit, func(auth *authkit.AuthKit) {
+		users := auth.ListUsers()
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Seeded %s, the store has %d users\n", seedFile, len(users))
+		printOutput(map[string]interface{}{
+			"count": len(users),
+			"users": users,
+		})
+	})
+}
@@ -1,9 +1,22 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/codedbygo/go-authkit"
 	"github.com/spf13/cobra"
 )
 
@@ -16,25 +29,33 @@ var serverCmd = &cobra.Command{
 var serverStartCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start the server",
-	Long:  "Start the AuthKit demonstration server",
-	Run:   runServerStart,
+	Long: `Start the AuthKit demonstration server. Users and sessions are kept in the
+--store file, so they are shared with the other commands while it runs.`,
+	Run: runServerStart,
 }
 
 var serverTestCmd = &cobra.Command{
 	Use:   "test",
 	Short: "Test server endpoints",
-	Long:  "Test the AuthKit server endpoints with sample requests",
+	Long:  "Test a running AuthKit server with real requests, exiting non-zero if any check fails",
 	Run:   runServerTest,
 }
 
 // Flags for server commands
 var (
-	serverPort    string
-	serverHost    string
-	enableCORS    bool
-	enableLogging bool
+	serverPort     string
+	serverHost     string
+	enableCORS     bool
+	enableLogging  bool
+	serverCert     string
+	serverKey      string
+	serverTLS      bool
+	serverInsecure bool
 )
 
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func init() {
 	// Add server command to root
 	rootCmd.AddCommand(serverCmd)
@@ -48,85 +69,294 @@ func init() {
 	serverStartCmd.Flags().StringVarP(&serverHost, "host", "H", "localhost", "Server host")
 	serverStartCmd.Flags().BoolVarP(&enableCORS, "cors", "c", true, "Enable CORS")
 	serverStartCmd.Flags().BoolVarP(&enableLogging, "logging", "l", true, "Enable request logging")
+	serverStartCmd.Flags().StringVar(&serverCert, "cert", "", "TLS certificate file, serves HTTPS together with --key")
+	serverStartCmd.Flags().StringVar(&serverKey, "key", "", "TLS private key file")
 
 	// Test flags
 	serverTestCmd.Flags().StringVarP(&serverPort, "port", "p", "8080", "Server port")
 	serverTestCmd.Flags().StringVarP(&serverHost, "host", "H", "localhost", "Server host")
+	serverTestCmd.Flags().BoolVar(&serverTLS, "tls", false, "Connect over HTTPS")
+	serverTestCmd.Flags().BoolVar(&serverInsecure, "insecure", false, "Skip verifying the server certificate, for self-signed ones")
 }
 
 func runServerStart(cmd *cobra.Command, args []string) {
-	fmt.Printf("Starting AuthKit Server...\n")
-	fmt.Printf("Host: %s\n", serverHost)
-	fmt.Printf("Port: %s\n", serverPort)
-	fmt.Printf("JWT Secret: %s\n", secretKey)
-	fmt.Printf("CORS Enabled: %v\n", enableCORS)
-	fmt.Printf("Logging Enabled: %v\n", enableLogging)
-
-	// In a real implementation, this would start an HTTP server
-	fmt.Printf("\nAvailable endpoints:\n")
-	fmt.Printf("  POST /%s:%s/api/v1/register    - User registration\n", serverHost, serverPort)
-	fmt.Printf("  POST /%s:%s/api/v1/login       - User login\n", serverHost, serverPort)
-	fmt.Printf("  POST /%s:%s/api/v1/refresh     - Refresh token\n", serverHost, serverPort)
-	fmt.Printf("  GET  /%s:%s/api/v1/profile     - User profile (protected)\n", serverHost, serverPort)
-	fmt.Printf("  GET  /%s:%s/api/v1/health      - Health check\n", serverHost, serverPort)
-
-	fmt.Printf("\nExample requests:\n")
-	fmt.Printf("Register:\n")
-	fmt.Printf("  curl -X POST http://%s:%s/api/v1/register \\\n", serverHost, serverPort)
-	fmt.Printf("    -H \"Content-Type: application/json\" \\\n")
-	fmt.Printf("    -d '{\"email\":\"test@example.com\",\"password\":\"password123\",\"name\":\"Test User\"}'\n")
-
-	fmt.Printf("\nLogin:\n")
-	fmt.Printf("  curl -X POST http://%s:%s/api/v1/login \\\n", serverHost, serverPort)
-	fmt.Printf("    -H \"Content-Type: application/json\" \\\n")
-	fmt.Printf("    -d '{\"email\":\"test@example.com\",\"password\":\"password123\"}'\n")
-
-	// Simulate server running
-	fmt.Printf("\nServer would be running... (Press Ctrl+C to stop)\n")
-	fmt.Printf("Note: This is a demonstration. Implement actual HTTP server for production use.\n")
-
-	// Keep the process alive
-	for {
-		time.Sleep(time.Second)
+	if (serverCert == "") != (serverKey == "") {
+		checkError(errors.New("--cert and --key must be set together"))
+	}
+
+	var seedFile string
+	auth := newAuthKit(func(config *authkit.Config) {
+		seedFile, config.SeedFile = config.SeedFile, ""
+	})
+	defer auth.Close()
+
+	// Apply the seed file to the store once, as the requests reload it
+	store, err := openStore(true)
+	checkError(err)
+	err = store.load(auth)
+	if err == nil && seedFile != "" {
+		if err = auth.LoadSeedFile(seedFile); err == nil {
+			err = store.save(auth)
+		}
+	}
+	store.close()
+	checkError(err)
+
+	scheme := "http"
+	if serverCert != "" {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(serverHost, serverPort))
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Starting AuthKit Server...\n")
+	// The secret is only reported as configured, never echoed
+	fmt.Fprintf(out, "JWT Secret: %s\n", secretStatus(loadConfig()))
+	fmt.Fprintf(out, "CORS Enabled: %v\n", enableCORS)
+	fmt.Fprintf(out, "Logging Enabled: %v\n", enableLogging)
+
+	fmt.Fprintf(out, "\nAvailable endpoints:\n")
+	fmt.Fprintf(out, "  POST %s/api/v1/register    - User registration\n", baseURL)
+	fmt.Fprintf(out, "  POST %s/api/v1/login       - User login\n", baseURL)
+	fmt.Fprintf(out, "  POST %s/api/v1/refresh     - Refresh token\n", baseURL)
+	fmt.Fprintf(out, "  GET  %s/api/v1/profile     - User profile (protected)\n", baseURL)
+	fmt.Fprintf(out, "  GET  %s/api/v1/health      - Health check\n", baseURL)
+
+	fmt.Fprintf(out, "\nExample requests:\n")
+	fmt.Fprintf(out, "Register:\n")
+	fmt.Fprintf(out, "  curl -X POST %s/api/v1/register \\\n", baseURL)
+	fmt.Fprintf(out, "    -H \"Content-Type: application/json\" \\\n")
+	fmt.Fprintf(out, "    -d '{\"email\":\"test@example.com\",\"password\":\"password123\",\"name\":\"Test User\"}'\n")
+
+	fmt.Fprintf(out, "\nLogin:\n")
+	fmt.Fprintf(out, "  curl -X POST %s/api/v1/login \\\n", baseURL)
+	fmt.Fprintf(out, "    -H \"Content-Type: application/json\" \\\n")
+	fmt.Fprintf(out, "    -d '{\"email\":\"test@example.com\",\"password\":\"password123\"}'\n")
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(serverHost, serverPort),
+		Handler:           newServerHandler(auth, enableCORS, enableLogging),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		if serverCert != "" {
+			serveErr <- server.ListenAndServeTLS(serverCert, serverKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	fmt.Fprintf(out, "\nServer running on %s (Press Ctrl+C to stop)\n", baseURL)
+
+	select {
+	case err := <-serveErr:
+		checkError(err)
+	case <-ctx.Done():
+		fmt.Fprintf(out, "\nShutting down...\n")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		checkError(server.Shutdown(shutdownCtx))
 	}
 }
 
+// newServerHandler serves auth's net/http handlers under /api/v1, with the
+// users and sessions of the --store file
+func newServerHandler(auth *authkit.AuthKit, cors, logging bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/register", allowMethod(http.MethodPost, syncStore(auth, true, http.HandlerFunc(auth.RegisterHandlerHTTP))))
+	mux.Handle("/api/v1/login", allowMethod(http.MethodPost, syncStore(auth, true, http.HandlerFunc(auth.LoginHandlerHTTP))))
+	mux.Handle("/api/v1/refresh", allowMethod(http.MethodPost, syncStore(auth, true, http.HandlerFunc(auth.RefreshHandlerHTTP))))
+	mux.Handle("/api/v1/profile", allowMethod(http.MethodGet, syncStore(auth, false, auth.HTTPMiddleware(http.HandlerFunc(auth.ProfileHandlerHTTP)))))
+	mux.Handle("/api/v1/health", allowMethod(http.MethodGet, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "AuthKit API is running"})
+	})))
+
+	var handler http.Handler = mux
+	if cors {
+		handler = corsHandler(handler)
+	}
+	if logging {
+		handler = logHandler(handler)
+	}
+	return handler
+}
+
+// allowMethod answers 405 to requests not using method
+func allowMethod(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// syncStore reloads the --store file before each request, so the server sees
+// changes made by other commands, and saves it afterwards if write is set.
+// The store stays locked during the request, exclusively when writing.
+func syncStore(auth *authkit.AuthKit, write bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store, err := openStore(write)
+		if err == nil {
+			defer store.close()
+			err = store.load(auth)
+		}
+		if err != nil {
+			log.Printf("store: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+		if write {
+			if err := store.save(auth); err != nil {
+				log.Printf("store: %v", err)
+			}
+		}
+	})
+}
+
+// corsHandler allows requests from any origin and answers preflight requests
+func corsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logHandler logs each request with its status and duration
+func logHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		log.Printf("%s %s %d %v", r.Method, r.URL.Path, recorder.status, time.Since(start))
+	})
+}
+
 func runServerTest(cmd *cobra.Command, args []string) {
-	baseURL := fmt.Sprintf("http://%s:%s", serverHost, serverPort)
-
-	fmt.Printf("Testing AuthKit Server endpoints...\n")
-	fmt.Printf("Base URL: %s\n\n", baseURL)
-
-	// Simulate API tests
-	fmt.Printf("1. Testing health endpoint...\n")
-	fmt.Printf("   GET %s/api/v1/health\n", baseURL)
-	fmt.Printf("   Status: 200 OK\n")
-	fmt.Printf("   Response: {\"status\":\"ok\",\"message\":\"AuthKit API is running\"}\n\n")
-
-	fmt.Printf("2. Testing user registration...\n")
-	fmt.Printf("   POST %s/api/v1/register\n", baseURL)
-	fmt.Printf("   Body: {\"email\":\"test@example.com\",\"password\":\"password123\",\"name\":\"Test User\"}\n")
-	fmt.Printf("   Status: 201 Created\n")
-	fmt.Printf("   Response: {\"message\":\"User registered successfully\",\"user\":{...}}\n\n")
-
-	fmt.Printf("3. Testing user login...\n")
-	fmt.Printf("   POST %s/api/v1/login\n", baseURL)
-	fmt.Printf("   Body: {\"email\":\"test@example.com\",\"password\":\"password123\"}\n")
-	fmt.Printf("   Status: 200 OK\n")
-	fmt.Printf("   Response: {\"access_token\":\"eyJ...\",\"user\":{...}}\n\n")
-
-	fmt.Printf("4. Testing protected endpoint...\n")
-	fmt.Printf("   GET %s/api/v1/profile\n", baseURL)
-	fmt.Printf("   Headers: Authorization: Bearer eyJ...\n")
-	fmt.Printf("   Status: 200 OK\n")
-	fmt.Printf("   Response: {\"user\":{...}}\n\n")
-
-	fmt.Printf("5. Testing invalid token...\n")
-	fmt.Printf("   GET %s/api/v1/profile\n", baseURL)
-	fmt.Printf("   Headers: Authorization: Bearer invalid-token\n")
-	fmt.Printf("   Status: 401 Unauthorized\n")
-	fmt.Printf("   Response: {\"error\":\"Invalid token\"}\n\n")
-
-	fmt.Printf("All tests completed!\n")
-	fmt.Printf("Note: This is a simulation. Run 'authkit server start' to test with real server.\n")
+	scheme := "http"
+	client := &http.Client{Timeout: 10 * time.Second}
+	if serverTLS {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: serverInsecure}}
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(serverHost, serverPort))
+
+	if failed := testServer(cmd.OutOrStdout(), client, baseURL); failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d checks failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// testServer runs the endpoint checks against the server at baseURL,
+// returning how many failed. Checks depending on a failed one are skipped.
+func testServer(out io.Writer, client *http.Client, baseURL string) int {
+	fmt.Fprintf(out, "Testing AuthKit Server endpoints...\n")
+	fmt.Fprintf(out, "Base URL: %s\n\n", baseURL)
+
+	failed := 0
+	check := func(step int, name, method, path, token string, body interface{}, wantStatus int, result interface{}) bool {
+		fmt.Fprintf(out, "%d. %s\n   %s %s\n", step, name, method, baseURL+path)
+		status, err := serverRequest(client, method, baseURL+path, token, body, result)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "   FAIL: %v\n\n", err)
+		case status != wantStatus:
+			fmt.Fprintf(out, "   FAIL: expected status %d, got %d\n\n", wantStatus, status)
+		default:
+			fmt.Fprintf(out, "   PASS: %d %s\n\n", status, http.StatusText(status))
+			return true
+		}
+		failed++
+		return false
+	}
+
+	check(1, "Testing health endpoint...", http.MethodGet, "/api/v1/health", "", nil, http.StatusOK, nil)
+
+	// A fresh email per run, as the server keeps its users
+	credentials := map[string]string{
+		"email":    fmt.Sprintf("server-test-%d@example.com", time.Now().UnixNano()),
+		"password": "password123",
+		"name":     "Server Test",
+	}
+	var tokens authkit.TokenResponse
+	if check(2, "Testing user registration...", http.MethodPost, "/api/v1/register", "", credentials, http.StatusCreated, nil) &&
+		check(3, "Testing user login...", http.MethodPost, "/api/v1/login", "", credentials, http.StatusOK, &tokens) {
+		check(4, "Testing protected endpoint...", http.MethodGet, "/api/v1/profile", tokens.AccessToken, nil, http.StatusOK, nil)
+	} else {
+		fmt.Fprintf(out, "4. Testing protected endpoint...\n   SKIP: no token\n\n")
+	}
+	check(5, "Testing invalid token...", http.MethodGet, "/api/v1/profile", "invalid-token", nil, http.StatusUnauthorized, nil)
+
+	if failed == 0 {
+		fmt.Fprintf(out, "All tests passed!\n")
+	}
+	return failed
+}
+
+// serverRequest sends body as JSON, decoding the response into result if
+// it's not nil, and returns the response status
+func serverRequest(client *http.Client, method, url, token string, body, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return resp.StatusCode, fmt.Errorf("decoding the response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// secretStatus describes the signing secret without revealing it
+func secretStatus(config authkit.Config) string {
+	if config.JWTSecret == "" {
+		return "not used"
+	}
+	return "set (hidden)"
 }
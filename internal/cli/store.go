@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/codedbygo/go-authkit"
+)
+
+// storePath is the --store flag
+var storePath string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&storePath, "store", "", "File users and sessions are kept in between commands (default ~/.authkit/users.json)")
+}
+
+// cliStore is the --store file, locked while a command uses it
+type cliStore struct {
+	path string
+	lock *os.File
+}
+
+// openStore locks the --store file, exclusively if the command changes it,
+// creating its directory if needed
+func openStore(exclusive bool) (*cliStore, error) {
+	path := storePath
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding the default store: %w, set --store", err)
+		}
+		path = filepath.Join(home, ".authkit", "users.json")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	// The lock has its own file, as saving replaces the store file
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock, exclusive); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+	return &cliStore{path: path, lock: lock}, nil
+}
+
+// load reads the store into auth; a missing file is an empty store
+func (s *cliStore) load(auth *authkit.AuthKit) error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := auth.LoadState(file); err != nil {
+		return fmt.Errorf("reading %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// save writes auth's state to a temporary file and moves it over the store,
+// so an interrupted save leaves the previous store intact
+func (s *cliStore) save(auth *authkit.AuthKit) error {
+	file, err := os.CreateTemp(filepath.Dir(s.path), ".users-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(0o600); err != nil {
+		file.Close()
+		return err
+	}
+	if err := auth.SaveState(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
+
+// close releases the lock
+func (s *cliStore) close() {
+	s.lock.Close()
+}
+
+// withStore runs fn with an AuthKit from newAuthKit holding the --store
+// file's users and sessions. With write set, other commands wait until fn
+// is done and its changes are saved. A seed file from --config is applied
+// on top of the stored users.
+func withStore(write bool, edit func(config *authkit.Config), fn func(auth *authkit.AuthKit)) {
+	var seedFile string
+	auth := newAuthKit(func(config *authkit.Config) {
+		if edit != nil {
+			edit(config)
+		}
+		seedFile, config.SeedFile = config.SeedFile, ""
+	})
+	defer auth.Close()
+
+	store, err := openStore(write)
+	checkError(err)
+	defer store.close()
+	checkError(store.load(auth))
+	if seedFile != "" {
+		checkError(auth.LoadSeedFile(seedFile))
+	}
+
+	fn(auth)
+	if write {
+		checkError(store.save(auth))
+	}
+}
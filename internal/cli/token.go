@@ -1,11 +1,19 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/codedbygo/go-authkit"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var tokenCmd = &cobra.Command{
@@ -28,6 +36,15 @@ var tokenValidateCmd = &cobra.Command{
 	Run:   runTokenValidate,
 }
 
+var tokenDecodeCmd = &cobra.Command{
+	Use:   "decode",
+	Short: "Decode a JWT without verifying it",
+	Long: `Print the header and payload of a JWT without checking its signature, so no
+secret is needed. With --verify, the signature is checked against --secret or
+--config as well.`,
+	Run: runTokenDecode,
+}
+
 var tokenRefreshCmd = &cobra.Command{
 	Use:   "refresh",
 	Short: "Refresh an access token",
@@ -37,13 +54,29 @@ var tokenRefreshCmd = &cobra.Command{
 
 // Flags for token commands
 var (
-	tokenString  string
-	tokenUserID  string
-	tokenExpiry  string
-	refreshToken string
-	customClaims []string
+	tokenString     string
+	tokenUserID     string
+	tokenExpiry     string
+	refreshToken    string
+	customClaims    []string
+	claimsJSON      string
+	allowRegistered bool
+	verifyDecoded   bool
 )
 
+// registeredClaims are the JWT claim names GenerateCustomToken sets itself
+var registeredClaims = map[string]bool{
+	"exp": true, "iat": true, "iss": true, "aud": true, "nbf": true, "jti": true, "sub": true,
+}
+
+// standardClaims are the claims token validate already prints, or that
+// aren't the caller's own
+var standardClaims = map[string]bool{
+	"user_id": true, "email": true, "role": true, "permissions": true, "metadata": true,
+	"token_version": true, "amr": true, "token_use": true, "sid": true,
+	"exp": true, "iat": true, "iss": true, "aud": true, "nbf": true, "jti": true, "sub": true,
+}
+
 func init() {
 	// Add token command to root
 	rootCmd.AddCommand(tokenCmd)
@@ -52,96 +85,310 @@ func init() {
 	tokenCmd.AddCommand(tokenGenerateCmd)
 	tokenCmd.AddCommand(tokenValidateCmd)
 	tokenCmd.AddCommand(tokenRefreshCmd)
+	tokenCmd.AddCommand(tokenDecodeCmd)
 
 	// Generate flags
 	tokenGenerateCmd.Flags().StringVarP(&tokenUserID, "user-id", "u", "", "User ID (required)")
 	tokenGenerateCmd.Flags().StringVarP(&tokenExpiry, "expiry", "x", "24h", "Token expiry duration")
-	tokenGenerateCmd.Flags().StringSliceVarP(&customClaims, "claims", "c", []string{}, "Custom claims (key=value format)")
+	tokenGenerateCmd.Flags().StringArrayVarP(&customClaims, "claims", "c", []string{}, "Custom claim as key=value, repeat for more; true/false, numbers and quoted strings keep their type")
+	tokenGenerateCmd.Flags().StringVar(&claimsJSON, "claims-json", "", "Custom claims as a JSON object, for arrays and nested values")
+	tokenGenerateCmd.Flags().BoolVar(&allowRegistered, "allow-registered", false, "Allow overriding registered claims (exp, iat, iss, aud, nbf, jti, sub)")
 	tokenGenerateCmd.MarkFlagRequired("user-id")
 
 	// Validate flags
 	tokenValidateCmd.Flags().StringVarP(&tokenString, "token", "t", "", "JWT token to validate (required)")
 	tokenValidateCmd.MarkFlagRequired("token")
 
+	// Decode flags
+	tokenDecodeCmd.Flags().StringVarP(&tokenString, "token", "t", "", "JWT token to decode (required)")
+	tokenDecodeCmd.Flags().BoolVar(&verifyDecoded, "verify", false, "Also check the signature, expiry, issuer and audience")
+	tokenDecodeCmd.MarkFlagRequired("token")
+
 	// Refresh flags
 	tokenRefreshCmd.Flags().StringVarP(&refreshToken, "refresh-token", "r", "", "Refresh token (required)")
 	tokenRefreshCmd.MarkFlagRequired("refresh-token")
 }
 
 func runTokenGenerate(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: tokenExpiry,
-		BCryptCost:  12,
-	})
-
 	// Parse expiry duration
-	duration, err := time.ParseDuration(tokenExpiry)
+	duration, err := authkit.ParseDuration(tokenExpiry)
 	checkError(err)
 
-	// Parse custom claims
-	claims := make(map[string]interface{})
-	for _, claim := range customClaims {
-		// Simple key=value parsing (could be enhanced)
-		fmt.Printf("Custom claim: %s\n", claim)
-		// For demo, just add as string
-		claims[claim] = "custom-value"
+	edit := func(config *authkit.Config) {
+		config.TokenExpiry = tokenExpiry
 	}
-
-	token, err := auth.GenerateCustomToken(tokenUserID, claims, duration)
+	claims, err := parseClaims(claimsJSON, customClaims, allowRegistered)
 	checkError(err)
 
-	fmt.Printf("Token generated successfully!\n")
-	printOutput(map[string]interface{}{
-		"token":   token,
-		"user_id": tokenUserID,
-		"expiry":  tokenExpiry,
-		"claims":  claims,
+	withStore(false, edit, func(auth *authkit.AuthKit) {
+		token, err := auth.GenerateCustomToken(tokenUserID, claims, duration)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Token generated successfully!\n")
+		printOutput(map[string]interface{}{
+			"token":   token,
+			"user_id": tokenUserID,
+			"expiry":  tokenExpiry,
+			"claims":  claims,
+		})
 	})
 }
 
 func runTokenValidate(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: "24h",
-		BCryptCost:  12,
-	})
+	// The store has the token versions of users whose tokens were revoked
+	withStore(false, nil, func(auth *authkit.AuthKit) {
+		claims, err := auth.ValidateToken(tokenString)
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Token validation failed: %v\n", err)
+			return
+		}
 
-	claims, err := auth.ValidateToken(tokenString)
-	if err != nil {
-		fmt.Printf("Token validation failed: %v\n", err)
-		return
-	}
-
-	fmt.Printf("Token is valid!\n")
-	printOutput(map[string]interface{}{
-		"valid":       true,
-		"user_id":     claims.UserID,
-		"email":       claims.Email,
-		"role":        claims.Role,
-		"permissions": claims.Permissions,
-		"issued_at":   claims.IssuedAt,
-		"expires_at":  claims.ExpiresAt,
+		custom, err := customTokenClaims(auth, tokenString)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Token is valid!\n")
+		if custom != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "Custom claims: %s\n", custom)
+		}
+		printOutput(map[string]interface{}{
+			"valid":       true,
+			"user_id":     claims.UserID,
+			"email":       claims.Email,
+			"role":        claims.Role,
+			"permissions": claims.Permissions,
+			"issued_at":   claims.IssuedAt,
+			"expires_at":  claims.ExpiresAt,
+		})
 	})
 }
 
+func runTokenDecode(cmd *cobra.Command, args []string) {
+	decoded, err := decodeToken(tokenString, time.Now())
+	checkError(err)
+
+	var verifyErr error
+	if verifyDecoded {
+		auth := newAuthKit(nil)
+		defer auth.Close()
+		_, verifyErr = authkit.ParseCustomToken[map[string]interface{}](auth, tokenString)
+		decoded.Signature = "valid"
+		if verifyErr != nil {
+			decoded.Signature = "INVALID: " + verifyErr.Error()
+		}
+	}
+
+	checkError(writeDecodedToken(cmd.OutOrStdout(), decoded, outputFormat))
+	if verifyErr != nil {
+		os.Exit(1)
+	}
+}
+
 func runTokenRefresh(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:     secretKey,
-		TokenExpiry:   "24h",
-		RefreshExpiry: "7d",
-		BCryptCost:    12,
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		newTokens, err := auth.RefreshToken(refreshToken)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Token refreshed successfully!\n")
+		printOutput(map[string]interface{}{
+			"access_token":  newTokens.AccessToken,
+			"refresh_token": newTokens.RefreshToken,
+			"token_type":    newTokens.TokenType,
+			"expires_in":    newTokens.ExpiresIn,
+			"user":          newTokens.User,
+		})
 	})
+}
 
-	newTokens, err := auth.RefreshToken(refreshToken)
-	checkError(err)
+// parseClaims builds the custom claims of token generate from a JSON object
+// and key=value pairs, the pairs taking precedence. Registered claims are
+// rejected unless allowRegistered is set.
+func parseClaims(object string, pairs []string, allowRegistered bool) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	if object != "" {
+		decoder := json.NewDecoder(strings.NewReader(object))
+		decoder.UseNumber() // keep large integers exact
+		if err := decoder.Decode(&claims); err != nil {
+			return nil, fmt.Errorf("--claims-json: %w", err)
+		}
+	}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--claims %q: expected key=value", pair)
+		}
+		claims[key] = claimValue(value)
+	}
 
-	fmt.Printf("Token refreshed successfully!\n")
-	printOutput(map[string]interface{}{
-		"access_token":  newTokens.AccessToken,
-		"refresh_token": newTokens.RefreshToken,
-		"token_type":    newTokens.TokenType,
-		"expires_in":    newTokens.ExpiresIn,
-		"user":          newTokens.User,
-	})
+	if !allowRegistered {
+		for key := range claims {
+			if registeredClaims[key] {
+				return nil, fmt.Errorf("claim %q is a registered claim, set --allow-registered to override it", key)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// claimValue coerces a --claims value: true and false are booleans, numbers
+// are integers or floats, a double-quoted value is the string it quotes and
+// anything else is a plain string
+func claimValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+	}
+	return value
+}
+
+// customTokenClaims returns the claims of a validated token that aren't
+// standard ones as a JSON object, or "" if there are none
+func customTokenClaims(auth *authkit.AuthKit, token string) (string, error) {
+	claims, err := authkit.ParseCustomToken[map[string]json.RawMessage](auth, token)
+	if err != nil {
+		return "", err
+	}
+	for key := range *claims {
+		if standardClaims[key] {
+			delete(*claims, key)
+		}
+	}
+	if len(*claims) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(*claims)
+	return string(data), err
+}
+
+// decodedToken is what token decode shows of a token
+type decodedToken struct {
+	Header    map[string]interface{} `json:"header" yaml:"header"`
+	Payload   map[string]interface{} `json:"payload" yaml:"payload"`
+	Algorithm string                 `json:"algorithm" yaml:"algorithm"`
+	KeyID     string                 `json:"kid,omitempty" yaml:"kid,omitempty"`
+	Expiry    string                 `json:"expiry" yaml:"expiry"`
+	Signature string                 `json:"signature" yaml:"signature"`
+}
+
+// decodeToken decodes the header and payload of a JWT without verifying
+// its signature, describing its expiry relative to now. It fails if the
+// token isn't three base64url parts with JSON objects for header and payload.
+func decodeToken(token string, now time.Time) (*decodedToken, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: expected 3 parts separated by dots, got %d", len(parts))
+	}
+
+	decoded := &decodedToken{Signature: "not verified"}
+	for i, part := range []struct {
+		name   string
+		target *map[string]interface{}
+	}{{"header", &decoded.Header}, {"payload", &decoded.Payload}} {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return nil, fmt.Errorf("malformed token %s: %w", part.name, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(part.target); err != nil || *part.target == nil {
+			return nil, fmt.Errorf("malformed token %s: not a JSON object", part.name)
+		}
+		*part.target = plainNumbers(*part.target).(map[string]interface{})
+	}
+
+	decoded.Algorithm, _ = decoded.Header["alg"].(string)
+	decoded.KeyID, _ = decoded.Header["kid"].(string)
+	decoded.Expiry = expiryStatus(decoded.Payload, now)
+	return decoded, nil
+}
+
+// plainNumbers replaces the json.Numbers in v with int64s, or float64s for
+// numbers that aren't integers, so every output format prints them as numbers
+func plainNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = plainNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = plainNumbers(value)
+		}
+	}
+	return v
+}
+
+// claimTime returns the time of a numeric date claim of payload
+func claimTime(payload map[string]interface{}, claim string) (time.Time, bool) {
+	switch seconds := payload[claim].(type) {
+	case int64:
+		return time.Unix(seconds, 0), true
+	case float64:
+		return time.Unix(int64(seconds), 0), true
+	}
+	return time.Time{}, false
+}
+
+// expiryStatus describes the exp and nbf claims of payload relative to now
+func expiryStatus(payload map[string]interface{}, now time.Time) string {
+	if notBefore, ok := claimTime(payload, "nbf"); ok && now.Before(notBefore) {
+		return fmt.Sprintf("NOT YET VALID, valid from %s (in %s)", notBefore.UTC().Format(time.RFC3339), notBefore.Sub(now).Round(time.Second))
+	}
+	expiresAt, ok := claimTime(payload, "exp")
+	if !ok {
+		return "never expires"
+	}
+	if !now.Before(expiresAt) {
+		return fmt.Sprintf("EXPIRED at %s (%s ago)", expiresAt.UTC().Format(time.RFC3339), now.Sub(expiresAt).Round(time.Second))
+	}
+	return fmt.Sprintf("valid until %s (in %s)", expiresAt.UTC().Format(time.RFC3339), expiresAt.Sub(now).Round(time.Second))
+}
+
+// writeDecodedToken writes decoded as indented JSON or YAML, or for any
+// other format as the pretty-printed header and payload followed by a summary
+func writeDecodedToken(w io.Writer, decoded *decodedToken, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(decoded)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		return encoder.Encode(decoded)
+	}
+
+	header, err := json.MarshalIndent(decoded.Header, "", "  ")
+	if err != nil {
+		return err
+	}
+	payload, err := json.MarshalIndent(decoded.Payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	keyID := decoded.KeyID
+	if keyID == "" {
+		keyID = "-"
+	}
+	_, err = fmt.Fprintf(w, "Header:\n%s\n\nPayload:\n%s\n\nAlgorithm: %s\nKey ID:    %s\nExpiry:    %s\nSignature: %s\n",
+		header, payload, decoded.Algorithm, keyID, decoded.Expiry, decoded.Signature)
+	return err
 }
@@ -1,7 +1,13 @@
 package cli
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/codedbygo/go-authkit"
 	"github.com/spf13/cobra"
@@ -10,7 +16,7 @@ import (
 var userCmd = &cobra.Command{
 	Use:   "user",
 	Short: "User management commands",
-	Long:  "Commands for managing users: register, login, list, update, delete",
+	Long:  "Commands for managing users: register, login, list, show, update, set-password, disable, enable, delete, import",
 }
 
 var userRegisterCmd = &cobra.Command{
@@ -41,6 +47,48 @@ var userDeleteCmd = &cobra.Command{
 	Run:   runUserDelete,
 }
 
+var userUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update a user",
+	Long:  "Change the name, role, permissions or metadata of a user; only the flags given are changed",
+	Run:   runUserUpdate,
+}
+
+var userSetPasswordCmd = &cobra.Command{
+	Use:   "set-password",
+	Short: "Set a user's password",
+	Long:  "Replace a user's password without the current one, revoking their tokens",
+	Run:   runUserSetPassword,
+}
+
+var userDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable a user",
+	Long:  "Stop a user from logging in or refreshing tokens until enabled again",
+	Run:   runUserDisable,
+}
+
+var userEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable a disabled user",
+	Long:  "Let a disabled user log in again",
+	Run:   runUserEnable,
+}
+
+var userShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a user",
+	Long:  "Print the full record of a user found by ID or email, without password hashes or MFA secrets",
+	Run:   runUserShow,
+}
+
+var userImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import users from a CSV file",
+	Long:  "Register users from a CSV file with an email, password, name and optional role column, reporting each row's outcome",
+	Run:   runUserImport,
+}
+
 // Flags for user commands
 var (
 	userEmail    string
@@ -48,6 +96,16 @@ var (
 	userName     string
 	userRole     string
 	userID       string
+	importFile   string
+
+	// user update has its own flags, as an unset flag must not look like an
+	// empty value
+	updateName        string
+	updateRole        string
+	updatePermissions []string
+	updateMetadata    []string
+	disableReason     string
+	temporaryPassword bool
 )
 
 func init() {
@@ -59,102 +117,335 @@ func init() {
 	userCmd.AddCommand(userLoginCmd)
 	userCmd.AddCommand(userListCmd)
 	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userImportCmd)
+	userCmd.AddCommand(userUpdateCmd)
+	userCmd.AddCommand(userSetPasswordCmd)
+	userCmd.AddCommand(userDisableCmd)
+	userCmd.AddCommand(userEnableCmd)
+	userCmd.AddCommand(userShowCmd)
 
 	// Register flags
 	userRegisterCmd.Flags().StringVarP(&userEmail, "email", "e", "", "User email (required)")
-	userRegisterCmd.Flags().StringVarP(&userPassword, "password", "p", "", "User password (required)")
+	addPasswordFlags(userRegisterCmd, &userPassword, "User password")
 	userRegisterCmd.Flags().StringVarP(&userName, "name", "n", "", "User name (required)")
 	userRegisterCmd.Flags().StringVarP(&userRole, "role", "r", "user", "User role")
 	userRegisterCmd.MarkFlagRequired("email")
-	userRegisterCmd.MarkFlagRequired("password")
 	userRegisterCmd.MarkFlagRequired("name")
 
 	// Login flags
 	userLoginCmd.Flags().StringVarP(&userEmail, "email", "e", "", "User email (required)")
-	userLoginCmd.Flags().StringVarP(&userPassword, "password", "p", "", "User password (required)")
+	addPasswordFlags(userLoginCmd, &userPassword, "User password")
 	userLoginCmd.MarkFlagRequired("email")
-	userLoginCmd.MarkFlagRequired("password")
 
 	// Delete flags
 	userDeleteCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID (required)")
 	userDeleteCmd.MarkFlagRequired("id")
+
+	// Update flags
+	userUpdateCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID (required)")
+	userUpdateCmd.Flags().StringVarP(&updateName, "name", "n", "", "New name")
+	userUpdateCmd.Flags().StringVarP(&updateRole, "role", "r", "", "New role")
+	userUpdateCmd.Flags().StringSliceVar(&updatePermissions, "permissions", nil, "New permissions, replacing the current ones (comma separated)")
+	userUpdateCmd.Flags().StringArrayVar(&updateMetadata, "metadata", nil, "Metadata to set as key=value, repeat for more; other keys are kept")
+	userUpdateCmd.MarkFlagRequired("id")
+
+	// Set password flags
+	userSetPasswordCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID (required)")
+	addPasswordFlags(userSetPasswordCmd, &userPassword, "New password")
+	userSetPasswordCmd.Flags().BoolVar(&temporaryPassword, "temporary", false, "Make the user change the password on next login")
+	userSetPasswordCmd.MarkFlagRequired("id")
+
+	// Disable and enable flags
+	userDisableCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID (required)")
+	userDisableCmd.Flags().StringVar(&disableReason, "reason", "", "Why the user is disabled")
+	userDisableCmd.MarkFlagRequired("id")
+	userEnableCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID (required)")
+	userEnableCmd.MarkFlagRequired("id")
+
+	// Show flags
+	userShowCmd.Flags().StringVarP(&userID, "id", "i", "", "User ID")
+	userShowCmd.Flags().StringVarP(&userEmail, "email", "e", "", "User email")
+	userShowCmd.MarkFlagsOneRequired("id", "email")
+	userShowCmd.MarkFlagsMutuallyExclusive("id", "email")
+
+	// Import flags
+	userImportCmd.Flags().StringVarP(&importFile, "file", "f", "", "CSV file (required)")
+	userImportCmd.MarkFlagRequired("file")
 }
 
 func runUserRegister(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: "24h",
-		BCryptCost:  12,
-	})
+	password, err := readPassword(cmd, userPassword, true)
+	checkError(err)
 
-	req := authkit.RegisterRequest{
-		Email:    userEmail,
-		Password: userPassword,
-		Name:     userName,
-		Role:     userRole,
-	}
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		req := authkit.RegisterRequest{
+			Email:    userEmail,
+			Password: password,
+			Name:     userName,
+			Role:     userRole,
+		}
 
-	user, err := auth.RegisterUser(req)
-	checkError(err)
+		user, err := auth.AdminCreateUser(req)
+		checkError(err)
 
-	fmt.Printf("User registered successfully!\n")
-	printOutput(map[string]interface{}{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"name":    user.Name,
-		"role":    user.Role,
+		fmt.Fprintf(cmd.OutOrStdout(), "User registered successfully!\n")
+		printOutput(map[string]interface{}{
+			"user_id": user.ID,
+			"email":   user.Email,
+			"name":    user.Name,
+			"role":    user.Role,
+		})
 	})
 }
 
 func runUserLogin(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: "24h",
-		BCryptCost:  12,
+	password, err := readPassword(cmd, userPassword, false)
+	checkError(err)
+
+	// Logins start a session, which token refresh needs later
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		tokenResponse, err := auth.LoginUser(userEmail, password)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Login successful!\n")
+		printOutput(map[string]interface{}{
+			"access_token":  tokenResponse.AccessToken,
+			"refresh_token": tokenResponse.RefreshToken,
+			"token_type":    tokenResponse.TokenType,
+			"expires_in":    tokenResponse.ExpiresIn,
+			"user":          tokenResponse.User,
+		})
+	})
+}
+
+func runUserList(cmd *cobra.Command, args []string) {
+	withStore(false, nil, func(auth *authkit.AuthKit) {
+		users := auth.ListUsers()
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Found %d users:\n", len(users))
+		printOutput(map[string]interface{}{
+			"count": len(users),
+			"users": users,
+		})
+	})
+}
+
+func runUserDelete(cmd *cobra.Command, args []string) {
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		err := auth.DeleteUser(userID)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "User deleted successfully!\n")
+		printOutput(map[string]interface{}{
+			"message": "User deleted",
+			"user_id": userID,
+		})
 	})
+}
+
+func runUserUpdate(cmd *cobra.Command, args []string) {
+	updates := make(map[string]interface{})
+	if cmd.Flags().Changed("name") {
+		updates["name"] = updateName
+	}
+	if cmd.Flags().Changed("role") {
+		updates["role"] = updateRole
+	}
+	if cmd.Flags().Changed("permissions") {
+		updates["permissions"] = append([]string{}, updatePermissions...)
+	}
+	if len(updates) == 0 && len(updateMetadata) == 0 {
+		checkError(errors.New("nothing to update, set --name, --role, --permissions or --metadata"))
+	}
+
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		if len(updateMetadata) > 0 {
+			// UpdateUser replaces the metadata, so start from the current keys
+			user, err := auth.GetUserByID(userID)
+			checkError(err)
+			metadata := make(map[string]interface{}, len(user.Metadata)+len(updateMetadata))
+			for key, value := range user.Metadata {
+				metadata[key] = value
+			}
+			for _, pair := range updateMetadata {
+				key, value, ok := strings.Cut(pair, "=")
+				if !ok || key == "" {
+					checkError(fmt.Errorf("--metadata %q: expected key=value", pair))
+				}
+				metadata[key] = claimValue(value)
+			}
+			updates["metadata"] = metadata
+		}
+
+		info, err := auth.UpdateUser(userID, updates)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "User updated successfully!\n")
+		printOutput(info)
+	})
+}
 
-	tokenResponse, err := auth.LoginUser(userEmail, userPassword)
+func runUserSetPassword(cmd *cobra.Command, args []string) {
+	password, err := readPassword(cmd, userPassword, true)
 	checkError(err)
 
-	fmt.Printf("Login successful!\n")
-	printOutput(map[string]interface{}{
-		"access_token":  tokenResponse.AccessToken,
-		"refresh_token": tokenResponse.RefreshToken,
-		"token_type":    tokenResponse.TokenType,
-		"expires_in":    tokenResponse.ExpiresIn,
-		"user":          tokenResponse.User,
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		set := auth.SetPassword
+		if temporaryPassword {
+			set = auth.SetTemporaryPassword
+		}
+		checkError(set(userID, password))
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Password set successfully!\n")
+		printOutput(map[string]interface{}{
+			"message":              "Password set, existing tokens revoked",
+			"user_id":              userID,
+			"must_change_password": temporaryPassword,
+		})
 	})
 }
 
-func runUserList(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: "24h",
-		BCryptCost:  12,
+func runUserDisable(cmd *cobra.Command, args []string) {
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		checkError(auth.DisableUser(userID, disableReason))
+
+		fmt.Fprintf(cmd.OutOrStdout(), "User disabled successfully!\n")
+		printOutput(map[string]interface{}{
+			"message": "User disabled",
+			"user_id": userID,
+		})
 	})
+}
 
-	users := auth.ListUsers()
+func runUserEnable(cmd *cobra.Command, args []string) {
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		checkError(auth.EnableUser(userID))
 
-	fmt.Printf("Found %d users:\n", len(users))
-	printOutput(map[string]interface{}{
-		"count": len(users),
-		"users": users,
+		fmt.Fprintf(cmd.OutOrStdout(), "User enabled successfully!\n")
+		printOutput(map[string]interface{}{
+			"message": "User enabled",
+			"user_id": userID,
+		})
 	})
 }
 
-func runUserDelete(cmd *cobra.Command, args []string) {
-	auth := authkit.New(authkit.Config{
-		JWTSecret:   secretKey,
-		TokenExpiry: "24h",
-		BCryptCost:  12,
+func runUserShow(cmd *cobra.Command, args []string) {
+	withStore(false, nil, func(auth *authkit.AuthKit) {
+		var user *authkit.User
+		var err error
+		if userID != "" {
+			user, err = auth.GetUserByID(userID)
+		} else {
+			user, err = auth.GetUserByEmail(userEmail)
+		}
+		checkError(err)
+		printOutput(newUserRecord(user))
 	})
+}
 
-	err := auth.DeleteUser(userID)
+// userRecord is what user show prints of a user, leaving out the password
+// hash, TOTP secret and recovery codes
+type userRecord struct {
+	ID                 string                 `json:"id"`
+	Email              string                 `json:"email"`
+	Name               string                 `json:"name"`
+	Role               string                 `json:"role"`
+	Permissions        []string               `json:"permissions"`
+	EmailVerified      bool                   `json:"email_verified"`
+	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+	MFAEnabled         bool                   `json:"mfa_enabled"`
+	Disabled           bool                   `json:"disabled"`
+	DisabledReason     string                 `json:"disabled_reason,omitempty"`
+	DisabledAt         *time.Time             `json:"disabled_at,omitempty"`
+	DeletedAt          *time.Time             `json:"deleted_at,omitempty"`
+	PurgeAt            *time.Time             `json:"purge_at,omitempty"`
+	TokenVersion       int                    `json:"token_version"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+	LastLoginAt        *time.Time             `json:"last_login_at,omitempty"`
+	MustChangePassword bool                   `json:"must_change_password"`
+}
+
+// newUserRecord returns the userRecord of user
+func newUserRecord(user *authkit.User) userRecord {
+	return userRecord{
+		ID:                 user.ID,
+		Email:              user.Email,
+		Name:               user.Name,
+		Role:               user.Role,
+		Permissions:        user.Permissions,
+		EmailVerified:      user.EmailVerified,
+		Metadata:           user.Metadata,
+		MFAEnabled:         user.TOTPEnabled,
+		Disabled:           user.Disabled,
+		DisabledReason:     user.DisabledReason,
+		DisabledAt:         user.DisabledAt,
+		DeletedAt:          user.DeletedAt,
+		PurgeAt:            user.PurgeAt,
+		TokenVersion:       user.TokenVersion,
+		CreatedAt:          user.CreatedAt,
+		UpdatedAt:          user.UpdatedAt,
+		LastLoginAt:        user.LastLoginAt,
+		MustChangePassword: user.MustChangePassword,
+	}
+}
+
+func runUserImport(cmd *cobra.Command, args []string) {
+	file, err := os.Open(importFile)
 	checkError(err)
+	defer file.Close()
 
-	fmt.Printf("User deleted successfully!\n")
-	printOutput(map[string]interface{}{
-		"message": "User deleted",
-		"user_id": userID,
+	reqs, err := readUserCSV(file)
+	checkError(err)
+
+	withStore(true, nil, func(auth *authkit.AuthKit) {
+		result, err := auth.RegisterUsersBulk(reqs)
+		checkError(err)
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %d users, %d failed\n", result.Succeeded, result.Failed)
+		printOutput(map[string]interface{}{
+			"succeeded": result.Succeeded,
+			"failed":    result.Failed,
+			"items":     result.Items,
+		})
 	})
 }
+
+// readUserCSV reads registration requests from CSV with a header row naming
+// the email, password, name and optional role columns
+func readUserCSV(r io.Reader) ([]authkit.RegisterRequest, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty CSV file")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"email", "password", "name"} {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	reqs := make([]authkit.RegisterRequest, 0, len(records)-1)
+	for _, record := range records[1:] {
+		reqs = append(reqs, authkit.RegisterRequest{
+			Email:    field(record, "email"),
+			Password: field(record, "password"),
+			Name:     field(record, "name"),
+			Role:     field(record, "role"),
+		})
+	}
+	return reqs, nil
+}
@@ -0,0 +1,37 @@
+package authkit
+
+import "time"
+
+// startJanitor runs fn every JanitorInterval in the background until Close is called
+func (a *AuthKit) startJanitor(fn func()) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.config.JanitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-a.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background janitors and waits for them to exit.
+// Calling Close more than once is a no-op, or a panic with DebugChecks enabled.
+func (a *AuthKit) Close() error {
+	if a.closed.Swap(true) && a.config.DebugChecks {
+		panic("authkit: Close called more than once")
+	}
+
+	a.closeOnce.Do(func() {
+		close(a.done)
+	})
+	a.wg.Wait()
+	return nil
+}
@@ -0,0 +1,132 @@
+package authkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWK is a public JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS renders the public keys tokens are verified against as an RFC 7517 key set.
+// The set is empty for HS256, whose secret must never be published.
+func (a *AuthKit) JWKS() ([]byte, error) {
+	k := a.keys
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if key.kid == "" {
+			continue
+		}
+		jwk, err := publicJWK(key.key)
+		if err != nil {
+			return nil, err
+		}
+		jwk.Kid = key.kid
+		jwk.Use = "sig"
+		jwk.Alg = k.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return json.Marshal(set)
+}
+
+// JWKSHandler serves the key set, typically mounted at /.well-known/jwks.json
+func (a *AuthKit) JWKSHandler(c *gin.Context) {
+	jwks, err := a.JWKS()
+	if err != nil {
+		a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", jwks)
+}
+
+// JWKSHandlerFiber serves the key set for Fiber
+func (a *AuthKit) JWKSHandlerFiber(c *fiber.Ctx) error {
+	jwks, err := a.JWKS()
+	if err != nil {
+		return a.fiberErrorCode(c, fiber.StatusInternalServerError, CodeInternalError)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(jwks)
+}
+
+// publicJWK converts a public key to its JWK members
+func publicJWK(public interface{}) (JWK, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   encodeSegment(key.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   encodeSegment(key.X.FillBytes(make([]byte, size))),
+			Y:   encodeSegment(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: encodeSegment(key)}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// keyID derives a kid from the RFC 7638 thumbprint of a public key
+func keyID(public interface{}) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+
+	// Required members only, in lexicographic order
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	default:
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return encodeSegment(sum[:]), nil
+}
+
+// encodeSegment base64url-encodes without padding
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
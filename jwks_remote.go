@@ -0,0 +1,356 @@
+package authkit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// defaultJWKSCacheTTL is how long a fetched key set is trusted before refetching
+	defaultJWKSCacheTTL = time.Hour
+	// jwksMinRefreshInterval limits refetches triggered by unknown kids, so
+	// tokens with made-up kids can't be used to hammer the provider
+	jwksMinRefreshInterval = 30 * time.Second
+	// maxJWKSResponseSize bounds how much of the provider's response is read
+	maxJWKSResponseSize = 1 << 20
+)
+
+// remoteSigningMethods are the algorithms accepted from a remote JWKS. HMAC is
+// never accepted: a key set only holds public keys.
+var remoteSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// validRemoteMethod reports whether method is accepted from a remote JWKS
+func validRemoteMethod(method jwt.SigningMethod) bool {
+	if method == nil {
+		return false
+	}
+	for _, alg := range remoteSigningMethods {
+		if method.Alg() == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteKey is a verification key fetched from a remote JWKS
+type remoteKey struct {
+	alg string // empty if the provider didn't pin one
+	key interface{}
+}
+
+// jwksFetch is an in-progress fetch other callers can wait on
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// remoteKeySet caches a provider's JWKS, refetching when it goes stale
+type remoteKeySet struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mutex     sync.RWMutex
+	keys      map[string]remoteKey
+	fetchedAt time.Time
+
+	fetchMutex sync.Mutex
+	inflight   *jwksFetch
+}
+
+// validateJWKSURL accepts https URLs, and plain http only for loopback hosts (local testing)
+func validateJWKSURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: invalid JWKSURL %q", ErrInvalidConfig, raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: JWKSURL must use https", ErrInvalidConfig)
+}
+
+// key returns the key for kid, fetching the key set if it is stale or doesn't know kid yet
+func (s *remoteKeySet) key(kid string) (remoteKey, error) {
+	s.mutex.RLock()
+	key, found := s.keys[kid]
+	fetchedAt := s.fetchedAt
+	s.mutex.RUnlock()
+
+	age := s.now().Sub(fetchedAt)
+	stale := fetchedAt.IsZero() || age >= s.ttl
+	if found && !stale {
+		return key, nil
+	}
+	if !found && !stale && age < jwksMinRefreshInterval {
+		return remoteKey{}, ErrInvalidToken
+	}
+
+	if err := s.refresh(fetchedAt); err != nil && !found {
+		return remoteKey{}, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if key, found = s.keys[kid]; !found {
+		return remoteKey{}, ErrInvalidToken
+	}
+	return key, nil
+}
+
+// refresh fetches the key set unless it has changed since seen. Concurrent
+// callers share a single request.
+func (s *remoteKeySet) refresh(seen time.Time) error {
+	s.fetchMutex.Lock()
+	if call := s.inflight; call != nil {
+		s.fetchMutex.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	s.mutex.RLock()
+	updated := s.fetchedAt.After(seen)
+	s.mutex.RUnlock()
+	if updated {
+		s.fetchMutex.Unlock()
+		return nil
+	}
+
+	call := &jwksFetch{done: make(chan struct{})}
+	s.inflight = call
+	s.fetchMutex.Unlock()
+
+	call.err = s.fetch()
+
+	s.fetchMutex.Lock()
+	s.inflight = nil
+	s.fetchMutex.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// fetch downloads and parses the key set, replacing the cache on success
+func (s *remoteKeySet) fetch() error {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSResponseSize)).Decode(&set); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]remoteKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the whole set
+		if public, err := jwkPublicKey(jwk); err == nil {
+			keys[jwk.Kid] = remoteKey{alg: jwk.Alg, key: public}
+		}
+	}
+
+	s.mutex.Lock()
+	s.keys = keys
+	s.fetchedAt = s.now()
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// keyFunc selects the verification key by kid
+func (s *remoteKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := s.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.key, nil
+}
+
+// jwkPublicKey converts a JWK to a public key
+func jwkPublicKey(jwk JWK) (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// validateRemoteToken validates a token issued by the external provider and
+// maps its OIDC claims into Claims
+func (a *AuthKit) validateRemoteToken(ctx context.Context, tokenString string) (*Claims, error) {
+	raw := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, raw, a.remoteKeys.keyFunc,
+		jwt.WithValidMethods(remoteSigningMethods),
+		jwt.WithIssuer(a.config.Issuer),
+		jwt.WithAudience(a.config.Audience[0]),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	claims := &Claims{
+		Role:        claimString(raw, a.config.RoleClaim),
+		Permissions: claimStrings(raw, a.config.PermissionsClaim),
+	}
+	claims.Email, _ = raw["email"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+	claims.UserID = claims.Subject
+	claims.ID, _ = raw["jti"].(string)
+	claims.Issuer, _ = raw.GetIssuer()
+	claims.Audience, _ = raw.GetAudience()
+	claims.ExpiresAt, _ = raw.GetExpirationTime()
+	claims.IssuedAt, _ = raw.GetIssuedAt()
+	claims.NotBefore, _ = raw.GetNotBefore()
+
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.ID != "" && a.isRevoked(ctx, claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// claimValue looks up a claim by path. The full path is tried as a key first,
+// since namespaced claims ("https://example.com/roles") contain dots; then it is
+// walked as dot-separated nested objects ("realm_access.roles").
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	if value, ok := claims[path]; ok {
+		return value
+	}
+
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// claimString reads a string claim; for a list, the first string is used
+func claimString(claims map[string]interface{}, path string) string {
+	switch value := claimValue(claims, path).(type) {
+	case string:
+		return value
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// claimStrings reads a list of strings; a string is split on spaces (OAuth "scope")
+func claimStrings(claims map[string]interface{}, path string) []string {
+	switch value := claimValue(claims, path).(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testProvider is a fake identity provider publishing a JWKS
+type testProvider struct {
+	server  *httptest.Server
+	fetches atomic.Int32
+	mutex   sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	delay   time.Duration
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{keys: map[string]*rsa.PrivateKey{}}
+	p.addKey(t, "key-1")
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		time.Sleep(p.delay)
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		set := JWKSet{Keys: []JWK{}}
+		for kid, key := range p.keys {
+			jwk, _ := publicJWK(&key.PublicKey)
+			jwk.Kid, jwk.Use, jwk.Alg = kid, "sig", "RS256"
+			set.Keys = append(set.Keys, jwk)
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mutex.Lock()
+	p.keys[kid] = key
+	p.mutex.Unlock()
+}
+
+// tokenWithKID signs with one key but names another in the kid header
+func (p *testProvider) tokenWithKID(signingKID, headerKID string) string {
+	p.mutex.Lock()
+	key := p.keys[signingKID]
+	p.mutex.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": "https://tenant.example.com/", "aud": "my-api", "sub": "x", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = headerKID
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+func (p *testProvider) token(kid string, claims jwt.MapClaims) string {
+	p.mutex.Lock()
+	key := p.keys[kid]
+	p.mutex.Unlock()
+
+	base := jwt.MapClaims{
+		"iss": "https://tenant.example.com/",
+		"aud": []string{"my-api"},
+		"sub": "auth0|12345",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		base[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	token.Header["kid"] = kid
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+// remoteConfig validates the tokens of p
+func remoteConfig(p *testProvider, config Config) Config {
+	config.JWKSURL = p.server.URL
+	config.Issuer = "https://tenant.example.com/"
+	config.Audience = []string{"my-api"}
+	return config
+}
+
+func TestRemoteJWKSValidation(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, remoteConfig(p, Config{RoleClaim: "https://example.com/roles"}))
+
+	claims, err := auth.ValidateToken(p.token("key-1", jwt.MapClaims{
+		"email":                     "remote@example.com",
+		"https://example.com/roles": []string{"admin", "user"},
+		"permissions":               []string{"read:orders"},
+	}))
+	if err != nil {
+		t.Fatalf("Expected provider token to validate, got %v", err)
+	}
+	if claims.UserID != "auth0|12345" || claims.Email != "remote@example.com" || claims.Role != "admin" {
+		t.Errorf("Expected mapped OIDC claims, got %+v", claims)
+	}
+	if len(claims.Permissions) != 1 || claims.Permissions[0] != "read:orders" {
+		t.Errorf("Expected mapped permissions, got %v", claims.Permissions)
+	}
+
+	for name, token := range map[string]string{
+		"wrong issuer":   p.token("key-1", jwt.MapClaims{"iss": "https://evil.example.com/"}),
+		"wrong audience": p.token("key-1", jwt.MapClaims{"aud": "other-api"}),
+		"unknown kid":    p.tokenWithKID("key-1", "missing"),
+	} {
+		if _, err := auth.ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// HS256 tokens are never accepted, whatever the secret
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://tenant.example.com/", "aud": "my-api", "sub": "x", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(""))
+	if _, err := auth.ValidateToken(hmac); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an HS256 token, got %v", err)
+	}
+
+	if _, err := auth.GenerateAccessToken(&User{ID: "u"}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Expected ErrNoSigningKey in JWKS mode, got %v", err)
+	}
+}
+
+func TestRemoteJWKSNestedRoleClaim(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, remoteConfig(p, Config{RoleClaim: "realm_access.roles", PermissionsClaim: "scope"}))
+
+	claims, err := auth.ValidateToken(p.token("key-1", jwt.MapClaims{
+		"realm_access": map[string]interface{}{"roles": []string{"editor"}},
+		"scope":        "openid read write",
+	}))
+	if err != nil {
+		t.Fatalf("Expected token to validate, got %v", err)
+	}
+	if claims.Role != "editor" || len(claims.Permissions) != 3 {
+		t.Errorf("Expected nested role and scope permissions, got %q %v", claims.Role, claims.Permissions)
+	}
+}
+
+func TestRemoteJWKSCaching(t *testing.T) {
+	p := newTestProvider(t)
+	p.delay = 50 * time.Millisecond
+	now := time.Now()
+	auth := newTestKit(t, remoteConfig(p, Config{JWKSCacheTTL: time.Hour, Clock: testClock(&now)}))
+	token := p.token("key-1", nil)
+
+	// Concurrent cold start shares one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := auth.ValidateToken(token); err != nil {
+				t.Errorf("Expected token to validate, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("Expected 1 JWKS fetch for concurrent cold start, got %d", n)
+	}
+
+	// Cached within the TTL
+	_, _ = auth.ValidateToken(token)
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("Expected cached keys within TTL, got %d fetches", n)
+	}
+
+	// A new kid shortly after a fetch doesn't trigger another request...
+	p.addKey(t, "key-2")
+	rotated := p.token("key-2", nil)
+	if _, err := auth.ValidateToken(rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for unknown kid inside the refresh interval, got %v", err)
+	}
+	// ...but does once the minimum refresh interval has passed
+	now = now.Add(jwksMinRefreshInterval)
+	if _, err := auth.ValidateToken(rotated); err != nil {
+		t.Errorf("Expected rotated key to be picked up, got %v", err)
+	}
+	if n := p.fetches.Load(); n != 2 {
+		t.Errorf("Expected 2 fetches after rotation, got %d", n)
+	}
+
+	// Stale keys are refetched after the TTL
+	now = now.Add(time.Hour)
+	_, _ = auth.ValidateToken(token)
+	if n := p.fetches.Load(); n != 3 {
+		t.Errorf("Expected refetch after TTL, got %d fetches", n)
+	}
+}
+
+func TestRemoteJWKSMiddleware(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, remoteConfig(p, Config{}))
+
+	r := gin.New()
+	r.GET("/admin", auth.GinMiddleware(), auth.RequireRole("admin"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	for role, want := range map[string]int{"admin": http.StatusOK, "user": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+p.token("key-1", jwt.MapClaims{"role": role}))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("role %s: expected %d, got %d", role, want, w.Code)
+		}
+	}
+}
+
+func TestRemoteJWKSConfig(t *testing.T) {
+	for name, config := range map[string]Config{
+		"plain http":       {JWKSURL: "http://idp.example.com/jwks", Issuer: "i", Audience: []string{"a"}},
+		"not a url":        {JWKSURL: "::", Issuer: "i", Audience: []string{"a"}},
+		"missing issuer":   {JWKSURL: "https://idp.example.com/jwks", Audience: []string{"a"}},
+		"missing audience": {JWKSURL: "https://idp.example.com/jwks", Issuer: "i"},
+	} {
+		if _, err := NewValidated(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+
+	if _, err := NewValidated(Config{JWKSURL: "https://idp.example.com/.well-known/jwks.json", Issuer: "i", Audience: []string{"a"}}); err != nil {
+		t.Errorf("Expected https JWKSURL to be accepted, got %v", err)
+	}
+}
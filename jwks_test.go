@@ -0,0 +1,158 @@
+package authkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyFromJWK rebuilds a public key from a published JWK, as a downstream service would
+func keyFromJWK(t *testing.T, jwk JWK) interface{} {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("Invalid base64url in JWK: %v", err)
+		}
+		return b
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(decode(jwk.X)), Y: new(big.Int).SetBytes(decode(jwk.Y))}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("Unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+func TestJWKSRotationRoundTrip(t *testing.T) {
+	for _, method := range []string{SigningMethodRS256, SigningMethodES256, SigningMethodEdDSA} {
+		t.Run(method, func(t *testing.T) {
+			keyA, _ := testKeyPair(t, method)
+			keyB, _ := testKeyPair(t, method)
+
+			auth := New(Config{SigningMethod: method, PrivateKeyPEM: keyA, BCryptCost: 4})
+			tokenA, _ := auth.GenerateCustomToken("user-a", nil, time.Hour)
+
+			if err := auth.RotateSigningKey(keyB); err != nil {
+				t.Fatalf("Expected rotation, got %v", err)
+			}
+			tokenB, _ := auth.GenerateCustomToken("user-b", nil, time.Hour)
+
+			r := gin.New()
+			r.GET("/.well-known/jwks.json", auth.JWKSHandler)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+			var set JWKSet
+			if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+				t.Fatalf("Expected JWKS JSON, got %v: %s", err, w.Body.String())
+			}
+			if len(set.Keys) != 2 {
+				t.Fatalf("Expected 2 published keys, got %d", len(set.Keys))
+			}
+
+			published := map[string]interface{}{}
+			for _, jwk := range set.Keys {
+				if jwk.Use != "sig" || jwk.Alg != method {
+					t.Errorf("Expected use=sig alg=%s, got %+v", method, jwk)
+				}
+				published[jwk.Kid] = keyFromJWK(t, jwk)
+			}
+
+			for _, token := range []string{tokenA, tokenB} {
+				parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+					key, ok := published[token.Header["kid"].(string)]
+					if !ok {
+						return nil, errors.New("unknown kid")
+					}
+					return key, nil
+				}, jwt.WithValidMethods([]string{method}))
+				if err != nil || !parsed.Valid {
+					t.Errorf("Expected token to verify against published JWKS, got %v", err)
+				}
+
+				if _, err := auth.ValidateToken(token); err != nil {
+					t.Errorf("Expected ValidateToken to accept token during rotation, got %v", err)
+				}
+			}
+
+			// Retiring key A rejects its tokens but keeps B working
+			header, _, _ := jwt.NewParser().ParseUnverified(tokenA, &Claims{})
+			if err := auth.RemoveVerificationKey(header.Header["kid"].(string)); err != nil {
+				t.Fatalf("Expected key removal, got %v", err)
+			}
+			if _, err := auth.ValidateToken(tokenA); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken after retiring key A, got %v", err)
+			}
+			if _, err := auth.ValidateToken(tokenB); err != nil {
+				t.Errorf("Expected key B token to stay valid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJWKSVerificationKeys(t *testing.T) {
+	oldPrivate, oldPublic := testKeyPair(t, SigningMethodRS256)
+	newPrivate, newPublic := testKeyPair(t, SigningMethodRS256)
+
+	oldToken, _ := New(Config{SigningMethod: SigningMethodRS256, PrivateKeyPEM: oldPrivate}).GenerateCustomToken("u", nil, time.Hour)
+	newToken, _ := New(Config{SigningMethod: SigningMethodRS256, PrivateKeyPEM: newPrivate}).GenerateCustomToken("u", nil, time.Hour)
+
+	verifier := New(Config{
+		SigningMethod:       SigningMethodRS256,
+		PublicKeyPEM:        newPublic,
+		VerificationKeysPEM: []string{oldPublic},
+	})
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := verifier.ValidateToken(token); err != nil {
+			t.Errorf("Expected token to validate with configured verification keys, got %v", err)
+		}
+	}
+
+	if err := verifier.RemoveVerificationKey("unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/.well-known/jwks.json", verifier.JWKSHandlerFiber)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if err != nil {
+		t.Fatalf("Fiber request failed: %v", err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var set JWKSet
+	if err := json.Unmarshal(raw, &set); err != nil || len(set.Keys) != 2 {
+		t.Errorf("Expected 2 keys from Fiber handler, got %s", raw)
+	}
+}
+
+func TestJWKSHS256(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	jwks, err := auth.JWKS()
+	if err != nil || string(jwks) != `{"keys":[]}` {
+		t.Errorf("Expected empty key set for HS256, got %s, %v", jwks, err)
+	}
+	if err := auth.RotateSigningKey("irrelevant"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig rotating an HS256 instance, got %v", err)
+	}
+}
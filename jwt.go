@@ -1,141 +1,398 @@
 package authkit
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// Default issuer and audience (see Config.Issuer and Config.Audience). Refresh
+// tokens use the issuer plus refreshTokenSuffix for both claims, so access and
+// refresh tokens can't be used in place of each other.
+const (
+	defaultIssuer      = "authkit"
+	defaultAudience    = "authkit-users"
+	refreshTokenSuffix = "-refresh"
+)
+
 // GenerateAccessToken generates a JWT access token for the user
 func (a *AuthKit) GenerateAccessToken(user *User) (string, error) {
-	duration, err := time.ParseDuration(a.config.TokenExpiry)
+	return a.accessToken(user, nil, "", a.accessExpiry)
+}
+
+// accessToken generates an access token lasting duration and carrying the
+// given authentication methods, tracked as part of the session if sessionID is set
+func (a *AuthKit) accessToken(user *User, amr []string, sessionID string, duration time.Duration) (string, error) {
+	subject, err := a.subjectFor(user)
 	if err != nil {
-		duration = 24 * time.Hour // default to 24 hours
+		return "", err
 	}
 
 	claims := &Claims{
-		UserID:      user.ID,
-		Email:       user.Email,
-		Role:        user.Role,
-		Permissions: user.Permissions,
-		Metadata:    user.Metadata,
+		UserID:                 user.ID,
+		Email:                  user.Email,
+		Role:                   user.Role,
+		Permissions:            a.sessionPermissions(user, sessionID),
+		Metadata:               a.tokenMetadata(user.Metadata),
+		TokenVersion:           user.TokenVersion,
+		AMR:                    amr,
+		SessionID:              sessionID,
+		TenantID:               user.TenantID,
+		PasswordChangeRequired: user.MustChangePassword,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        uuid.New().String(), // Add unique JTI (JWT ID)
-			Subject:   user.ID,
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "authkit",
-			Audience:  []string{"authkit-users"},
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(a.now()),
+			ExpiresAt: jwt.NewNumericDate(a.now().Add(duration)),
+			NotBefore: jwt.NewNumericDate(a.now()),
+			Issuer:    a.config.Issuer,
+			Audience:  append([]string{}, a.config.Audience...),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.config.JWTSecret))
+	if sessionID != "" {
+		if err := a.trackSessionToken(sessionID, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return "", err
+		}
+	}
+	return a.signToken(claims)
+}
+
+// tokenMetadata returns the subset of metadata whitelisted by Config.TokenMetadataFields
+func (a *AuthKit) tokenMetadata(metadata map[string]interface{}) map[string]interface{} {
+	var selected map[string]interface{}
+	for _, field := range a.config.TokenMetadataFields {
+		if field == AllTokenMetadata {
+			return copyMetadata(metadata)
+		}
+		if value, ok := metadata[field]; ok {
+			if selected == nil {
+				selected = make(map[string]interface{})
+			}
+			selected[field] = value
+		}
+	}
+	return selected
 }
 
 // GenerateRefreshToken generates a JWT refresh token
 func (a *AuthKit) GenerateRefreshToken(user *User) (string, error) {
-	duration, err := time.ParseDuration(a.config.RefreshExpiry)
+	return a.refreshToken(user, nil, "", a.refreshExpiry, a.now())
+}
+
+// refreshToken generates a refresh token lasting duration that passes amr, the
+// session and the time of the login on to refreshed tokens
+func (a *AuthKit) refreshToken(user *User, amr []string, sessionID string, duration time.Duration, authTime time.Time) (string, error) {
+	subject, err := a.subjectFor(user)
 	if err != nil {
-		duration = 7 * 24 * time.Hour // default to 7 days
+		return "", err
 	}
 
-	claims := &jwt.RegisteredClaims{
-		ID:        uuid.New().String(), // Add unique JTI (JWT ID)
-		Subject:   user.ID,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "authkit-refresh",
-		Audience:  []string{"authkit-refresh"},
+	claims := &refreshClaims{
+		TokenVersion: user.TokenVersion,
+		AMR:          amr,
+		SessionID:    sessionID,
+		AuthTime:     jwt.NewNumericDate(authTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(), // Add unique JTI (JWT ID)
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(a.now()),
+			ExpiresAt: jwt.NewNumericDate(a.now().Add(duration)),
+			NotBefore: jwt.NewNumericDate(a.now()),
+			Issuer:    a.refreshIssuer(),
+			Audience:  []string{a.refreshIssuer()},
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.config.JWTSecret))
+	if sessionID != "" {
+		if err := a.trackSessionToken(sessionID, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return "", err
+		}
+	}
+	return a.signToken(claims)
 }
 
 // ValidateToken validates and parses a JWT token
 func (a *AuthKit) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	return a.ValidateTokenCtx(context.Background(), tokenString)
+}
+
+// ValidateTokenCtx is ValidateToken with a context, which only carries the
+// trace: validation never blocks, so it doesn't fail once ctx is done
+func (a *AuthKit) ValidateTokenCtx(ctx context.Context, tokenString string) (*Claims, error) {
+	a.debugCheck()
+
+	ctx, span := a.startSpan(ctx, "ValidateToken")
+	// Only timed when metrics are recorded
+	var start time.Time
+	timed := a.metricsEnabled()
+	if timed {
+		start = time.Now()
+	}
+	claims, err := a.validateToken(ctx, tokenString)
+	if timed {
+		a.config.Metrics.TokenValidation(outcome(err), time.Since(start))
+	}
+	if err != nil {
+		a.logTokenRejected(tokenString, err)
+	} else {
+		span.SetAttribute(TraceAttrUserID, a.traceUserID(claims.UserID))
+	}
+	endSpan(span, err)
+	return claims, err
+}
+
+// validateToken implements ValidateTokenCtx
+func (a *AuthKit) validateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	if a.malformedToken(tokenString) {
+		return nil, ErrInvalidToken
+	}
+	if a.remoteKeys != nil {
+		return a.validateRemoteToken(ctx, tokenString)
+	}
+
+	claims, cached := a.tokenCache.get(tokenString, a.now())
+	if !cached {
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, a.keyFunc, jwt.WithIssuer(a.config.Issuer), jwt.WithAudience(a.config.Audience[0]), jwt.WithTimeFunc(a.now))
+		if err != nil {
+			return nil, tokenError(err)
+		}
+		parsed, ok := token.Claims.(*Claims)
+		if !ok || !token.Valid {
 			return nil, ErrInvalidToken
 		}
-		return []byte(a.config.JWTSecret), nil
-	})
+		claims = parsed
+	}
 
-	if err != nil {
+	// Cached tokens are checked again, so revocations and disabled users
+	// take effect immediately
+	if claims.ID != "" && a.isRevoked(ctx, claims.ID) {
+		a.tokenCache.evict(claims.ID)
+		return nil, ErrTokenRevoked
+	}
+	if a.validatesUser() && claims.TokenUse != TokenUseClient {
+		if err := a.checkUser(claims); err != nil {
+			return nil, err
+		}
+	} else if version, exists := a.tokenVersion(claims.UserID); exists && version != claims.TokenVersion {
+		return nil, ErrInvalidToken
+	}
+	if claims.TokenUse == TokenUseClient && !a.serviceAccountExists(claims.UserID) {
 		return nil, ErrInvalidToken
 	}
+	if !cached {
+		a.tokenCache.put(tokenString, claims, a.now())
+	}
+	return claims, nil
+}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+// malformedToken reports whether tokenString is longer than Config.MaxTokenSize
+// or doesn't have the three segments of a signed JWT, so oversized or garbage
+// input is rejected before any decoding
+func (a *AuthKit) malformedToken(tokenString string) bool {
+	return len(tokenString) > a.config.MaxTokenSize || strings.Count(tokenString, ".") != 2
+}
+
+// tokenError maps a jwt parse error to ErrTokenExpired for tokens that are only
+// expired, and to ErrInvalidToken for everything else (bad signature, format, ...)
+func tokenError(err error) error {
+	// The signature is verified before claims, so an expiry error implies a genuine token
+	if errors.Is(err, jwt.ErrTokenExpired) &&
+		!errors.Is(err, jwt.ErrTokenNotValidYet) &&
+		!errors.Is(err, jwt.ErrTokenInvalidIssuer) &&
+		!errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		return ErrTokenExpired
 	}
+	return ErrInvalidToken
+}
 
-	return nil, ErrInvalidToken
+// refreshIssuer is the iss and aud value of refresh tokens
+func (a *AuthKit) refreshIssuer() string {
+	return a.config.Issuer + refreshTokenSuffix
+}
+
+// tokenExpiredAt returns the exp claim of a token ValidateToken rejected with
+// ErrTokenExpired. The signature was verified before expiry was checked, but the
+// claims are otherwise untrusted, so nothing beyond exp is read.
+func tokenExpiredAt(tokenString string) (time.Time, bool) {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil || claims.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return claims.ExpiresAt.Time.UTC(), true
 }
 
 // RefreshToken validates a refresh token and generates new access token
 func (a *AuthKit) RefreshToken(refreshTokenString string) (*TokenResponse, error) {
+	return a.RefreshTokenCtx(context.Background(), refreshTokenString)
+}
+
+// RefreshTokenCtx is RefreshToken with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) RefreshTokenCtx(ctx context.Context, refreshTokenString string) (*TokenResponse, error) {
+	a.debugCheck()
+	return a.refreshTokens(ctx, refreshTokenString, nil)
+}
+
+// refreshTokens implements RefreshTokenCtx, narrowing the session's scope to
+// scope unless nil
+func (a *AuthKit) refreshTokens(ctx context.Context, refreshTokenString string, scope []string) (tokens *TokenResponse, err error) {
+	ctx, span := a.startSpan(ctx, "RefreshToken")
+	defer func() {
+		err = opError("refresh token", err)
+		endSpan(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Parse the refresh token
-	token, err := jwt.ParseWithClaims(refreshTokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(a.config.JWTSecret), nil
-	})
+	if a.malformedToken(refreshTokenString) {
+		return nil, ErrInvalidToken
+	}
+	token, err := jwt.ParseWithClaims(refreshTokenString, &refreshClaims{}, a.keyFunc, jwt.WithIssuer(a.refreshIssuer()), jwt.WithAudience(a.refreshIssuer()), jwt.WithTimeFunc(a.now))
 
 	if err != nil {
-		return nil, ErrInvalidToken
+		return nil, tokenError(err)
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*refreshClaims)
 	if !ok || !token.Valid {
 		return nil, ErrInvalidToken
 	}
+	if claims.ID != "" && a.isRevoked(ctx, claims.ID) {
+		return nil, ErrTokenRevoked
+	}
 
 	// Get user from claims
-	user, err := a.GetUserByID(claims.Subject)
+	user, err := a.resolveSubject(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute(TraceAttrUserID, a.traceUserID(user.ID))
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrInvalidToken
+	}
+	if user.PurgeAt != nil {
+		return nil, ErrAccountPendingDeletion
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	authTime := a.refreshAuthTime(claims)
+	if err := a.checkRefreshLimits(claims, authTime); err != nil {
+		return nil, err
+	}
+
+	// Refresh tokens issued before sessions were tracked start a new session
+	if claims.SessionID == "" {
+		tokens, err = a.issueTokens(user, claims.AMR, a.startSession(user.ID, a.defaultLifetimes(), scope), authTime, "")
+	} else if err = a.refreshSession(claims.SessionID, user.ID, scope); err == nil {
+		tokens, err = a.issueTokens(user, claims.AMR, claims.SessionID, authTime, "")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate new tokens
-	accessToken, err := a.GenerateAccessToken(user)
+	a.config.Metrics.Refresh()
+	a.audit(AuditEvent{Type: AuditTokenRefreshed, ActorID: user.ID, UserID: user.ID,
+		Metadata: map[string]string{"session_id": tokens.SessionID}})
+	if hook := a.config.Hooks.OnTokenRefreshed; hook != nil {
+		info := cloneUserInfo(tokens.User)
+		a.runHook("OnTokenRefreshed", func() error { return hook(info) })
+	}
+	return tokens, nil
+}
+
+// GenerateTokenPair generates an access and refresh token for the user
+func (a *AuthKit) GenerateTokenPair(user *User) (*TokenResponse, error) {
+	return a.tokenPair(user, nil, a.defaultLifetimes(), nil, "")
+}
+
+// tokenPair starts a session with the given token lifetimes and scope and
+// generates an access and refresh token for it carrying the given
+// authentication methods, plus an ID token with the nonce under Config.OIDC
+func (a *AuthKit) tokenPair(user *User, amr []string, lifetimes tokenLifetimes, scope []string, nonce string) (*TokenResponse, error) {
+	return a.issueTokens(user, amr, a.startSession(user.ID, lifetimes, scope), a.now(), nonce)
+}
+
+// issueTokens assembles the TokenResponse of every login and refresh: an access
+// and refresh token for an existing session, carrying the authentication methods
+// and the time of the login, and under Config.OIDC an ID token
+func (a *AuthKit) issueTokens(user *User, amr []string, sessionID string, authTime time.Time, nonce string) (*TokenResponse, error) {
+	lifetimes := a.sessionLifetimes(sessionID)
+	accessToken, err := a.accessToken(user, amr, sessionID, lifetimes.access)
 	if err != nil {
 		return nil, err
 	}
 
-	newRefreshToken, err := a.GenerateRefreshToken(user)
+	refreshToken, err := a.refreshToken(user, amr, sessionID, lifetimes.refresh, authTime)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse expiry duration
-	duration, _ := time.ParseDuration(a.config.TokenExpiry)
-	expiresIn := int64(duration.Seconds())
+	var idToken string
+	if a.config.OIDC != nil {
+		if idToken, err = a.idToken(user, amr, sessionID, authTime, nonce, lifetimes.access); err != nil {
+			return nil, err
+		}
+	}
 
 	return &TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		User:         a.userToUserInfo(user),
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		IDToken:                idToken,
+		TokenType:              "Bearer",
+		ExpiresIn:              int64(lifetimes.access.Seconds()),
+		RefreshExpiresIn:       int64(lifetimes.refresh.Seconds()),
+		User:                   a.userToUserInfo(user),
+		SessionID:              sessionID,
+		PasswordChangeRequired: user.MustChangePassword,
+		ReauthenticateAt:       a.reauthenticateAt(authTime),
+		Scope:                  a.grantedScope(user, sessionID),
 	}, nil
 }
 
+// IssueTokensForUser issues tokens for a user authenticated by other means
+// (SSO, magic link, ...), without checking a password
+func (a *AuthKit) IssueTokensForUser(userID string) (*TokenResponse, error) {
+	a.debugCheck()
+
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.PurgeAt != nil {
+		return nil, ErrAccountPendingDeletion
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return a.GenerateTokenPair(user)
+}
+
 // GenerateCustomToken generates a token with custom claims
 func (a *AuthKit) GenerateCustomToken(userID string, customClaims map[string]interface{}, expiry time.Duration) (string, error) {
 	claims := jwt.MapClaims{
 		"jti":     uuid.New().String(), // Add unique JTI
 		"user_id": userID,
-		"iss":     "authkit",
-		"aud":     "authkit-users",
-		"iat":     time.Now().Unix(),
-		"exp":     time.Now().Add(expiry).Unix(),
-		"nbf":     time.Now().Unix(),
+		"iss":     a.config.Issuer,
+		"aud":     a.config.Audience,
+		"iat":     a.now().Unix(),
+		"exp":     a.now().Add(expiry).Unix(),
+		"nbf":     a.now().Unix(),
 	}
 
 	// Add custom claims
@@ -143,6 +400,39 @@ func (a *AuthKit) GenerateCustomToken(userID string, customClaims map[string]int
 		claims[key] = value
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.config.JWTSecret))
+	return a.signToken(claims)
+}
+
+// ParseCustomToken validates a token the same way ValidateToken does (signing
+// method, signature, expiry, issuer, audience, revocation) and decodes its
+// payload into T, so claims set with GenerateCustomToken come back with their
+// original types rather than as float64 and []interface{}.
+func ParseCustomToken[T any](a *AuthKit, tokenString string) (*T, error) {
+	a.debugCheck()
+
+	if a.malformedToken(tokenString) {
+		return nil, ErrInvalidToken
+	}
+	registered := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, registered, a.keyFunc,
+		jwt.WithIssuer(a.config.Issuer), jwt.WithAudience(a.config.Audience[0]), jwt.WithTimeFunc(a.now))
+	if err != nil {
+		return nil, tokenError(err)
+	}
+	if jti, _ := registered["jti"].(string); jti != "" && a.IsTokenRevoked(jti) {
+		return nil, ErrTokenRevoked
+	}
+
+	// The token is verified; decode the raw payload so numbers keep their precision
+	parts := strings.Split(tokenString, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := new(T)
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
 }
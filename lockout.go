@@ -0,0 +1,210 @@
+package authkit
+
+import (
+	"sync"
+	"time"
+)
+
+// Lockout defaults (see Config.MaxLoginAttempts, LockoutWindow and LockoutDuration)
+const (
+	defaultMaxLoginAttempts = 5
+	defaultLockoutWindow    = 15 * time.Minute
+	defaultLockoutDuration  = 15 * time.Minute
+)
+
+// LockoutPolicy controls when repeated login attempts lock an account
+type LockoutPolicy struct {
+	MaxAttempts int           // Attempts allowed within Window
+	Window      time.Duration // Attempts older than this no longer count
+	Duration    time.Duration // How long the account stays locked
+}
+
+// LockoutState is the failed login state of a user
+type LockoutState struct {
+	Attempts    int       // Attempts counted in the current window
+	WindowStart time.Time // When the current window started
+	LockedUntil time.Time // Zero when the user has never been locked
+	LastAttempt time.Time // When the last attempt was counted
+}
+
+// Locked reports whether the user is locked at now
+func (s LockoutState) Locked(now time.Time) bool {
+	return now.Before(s.LockedUntil)
+}
+
+// LockoutStore counts login attempts per user. Attempts are recorded before the
+// password is checked, so concurrent guesses can't all slip in ahead of the lock.
+// BruteForceProtection counts the requests of client IPs in the same store,
+// under keys prefixed with "ip:", and relies on LastAttempt for its delays.
+type LockoutStore interface {
+	// RecordAttempt atomically counts an attempt for userID at now. It returns
+	// ErrAccountLocked without counting while the user is locked; otherwise the
+	// attempt that reaches policy.MaxAttempts locks the user for policy.Duration.
+	RecordAttempt(userID string, now time.Time, policy LockoutPolicy) (LockoutState, error)
+	// Get returns the state for userID (the zero state if none is stored)
+	Get(userID string) (LockoutState, error)
+	// Reset clears the attempts and any lock for userID
+	Reset(userID string) error
+}
+
+// LockoutForgiver is implemented by lockout stores that can take back counted
+// attempts. BruteForceProtection uses it to decay the counter of a client IP
+// after a success; with other stores, a success clears the counter.
+type LockoutForgiver interface {
+	// Forgive removes up to n attempts counted for key, leaving any lock in place
+	Forgive(key string, n int) error
+}
+
+// LockoutPruner is implemented by lockout stores that don't expire their
+// entries by themselves. AuthKit prunes them every JanitorInterval once
+// attempts are being counted.
+type LockoutPruner interface {
+	// Prune removes the entries whose window and lock have both passed at now
+	// and returns how many were removed
+	Prune(now time.Time) int
+}
+
+// MemoryLockoutStore is an in-memory LockoutStore
+type MemoryLockoutStore struct {
+	states  map[string]LockoutState
+	expires map[string]time.Time // When each state's window and lock have passed
+	mutex   sync.Mutex
+}
+
+// NewMemoryLockoutStore creates an empty in-memory lockout store
+func NewMemoryLockoutStore() *MemoryLockoutStore {
+	return &MemoryLockoutStore{states: make(map[string]LockoutState), expires: make(map[string]time.Time)}
+}
+
+// RecordAttempt counts an attempt for userID, locking it once policy.MaxAttempts is reached
+func (s *MemoryLockoutStore) RecordAttempt(userID string, now time.Time, policy LockoutPolicy) (LockoutState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.states[userID]
+	if state.Locked(now) {
+		return state, ErrAccountLocked
+	}
+
+	if state.WindowStart.IsZero() || !now.Before(state.WindowStart.Add(policy.Window)) || !state.LockedUntil.IsZero() {
+		// A new window, or the first attempt after a lock expired
+		state = LockoutState{WindowStart: now}
+	}
+	state.Attempts++
+	state.LastAttempt = now
+	if state.Attempts >= policy.MaxAttempts {
+		state.LockedUntil = now.Add(policy.Duration)
+	}
+
+	s.states[userID] = state
+	s.expires[userID] = state.WindowStart.Add(policy.Window)
+	if state.LockedUntil.After(s.expires[userID]) {
+		s.expires[userID] = state.LockedUntil
+	}
+	return state, nil
+}
+
+// Get returns the state for userID
+func (s *MemoryLockoutStore) Get(userID string) (LockoutState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.states[userID], nil
+}
+
+// Forgive removes up to n attempts counted for key, leaving any lock in place
+func (s *MemoryLockoutStore) Forgive(key string, n int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, exists := s.states[key]
+	if !exists {
+		return nil
+	}
+	state.Attempts -= n
+	if state.Attempts <= 0 && state.LockedUntil.IsZero() {
+		delete(s.states, key)
+		delete(s.expires, key)
+		return nil
+	}
+	if state.Attempts < 0 {
+		state.Attempts = 0
+	}
+	s.states[key] = state
+	return nil
+}
+
+// Reset clears the attempts and any lock for userID
+func (s *MemoryLockoutStore) Reset(userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.states, userID)
+	delete(s.expires, userID)
+	return nil
+}
+
+// Prune removes the states whose window and lock have passed; they behave
+// exactly like missing ones
+func (s *MemoryLockoutStore) Prune(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pruned := 0
+	for key, expires := range s.expires {
+		if !now.Before(expires) {
+			delete(s.states, key)
+			delete(s.expires, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// recordAttempt counts an attempt in the LockoutStore, making sure the
+// pruning janitor is running for stores that need one
+func (a *AuthKit) recordAttempt(key string, now time.Time, policy LockoutPolicy) (LockoutState, error) {
+	if pruner, ok := a.config.LockoutStore.(LockoutPruner); ok {
+		a.lockoutJanitor.Do(func() {
+			a.startJanitor(func() { pruner.Prune(a.now()) })
+		})
+	}
+	return a.config.LockoutStore.RecordAttempt(key, now, policy)
+}
+
+// lockoutPolicy returns the configured policy
+func (a *AuthKit) lockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts: a.config.MaxLoginAttempts,
+		Window:      a.config.LockoutWindow,
+		Duration:    a.config.LockoutDuration,
+	}
+}
+
+// lockoutEnabled reports whether failed logins lock accounts
+func (a *AuthKit) lockoutEnabled() bool {
+	return a.config.MaxLoginAttempts > 0
+}
+
+// lockedUntil returns when the user's lock expires, or nil if the user isn't locked
+func (a *AuthKit) lockedUntil(userID string) *time.Time {
+	if !a.lockoutEnabled() {
+		return nil
+	}
+	state, err := a.config.LockoutStore.Get(userID)
+	if err != nil || !state.Locked(a.now()) {
+		return nil
+	}
+	lockedUntil := state.LockedUntil
+	return &lockedUntil
+}
+
+// UnlockUser clears a user's failed login attempts and lifts any lock
+func (a *AuthKit) UnlockUser(userID string) error {
+	a.debugCheck()
+
+	if _, err := a.GetUserByID(userID); err != nil {
+		return err
+	}
+	return a.config.LockoutStore.Reset(userID)
+}
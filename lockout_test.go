@@ -0,0 +1,188 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newLockoutTestKit locks accounts out for an hour after three failed logins
+// within ten minutes, and registers locked@example.com
+func newLockoutTestKit(t *testing.T, now *time.Time) (*AuthKit, *UserInfo) {
+	t.Helper()
+	auth := newTestKit(t, Config{
+		MaxLoginAttempts: 3,
+		LockoutWindow:    10 * time.Minute,
+		LockoutDuration:  time.Hour,
+		Clock:            testClock(now),
+	})
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "locked@example.com", Password: "password123", Name: "Locked"})
+	return auth, user
+}
+
+func TestAccountLockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth, user := newLockoutTestKit(t, &now)
+	defer auth.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.LoginUser("locked@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+
+	if _, err := auth.LoginUser("locked@example.com", "password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Expected ErrAccountLocked with the correct password, got %v", err)
+	}
+
+	info := auth.ListUsers()[0]
+	if !info.Locked || info.LockedUntil == nil || !info.LockedUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected UserInfo to show the lock until %v, got %+v", now.Add(time.Hour), info)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := auth.LoginUser("locked@example.com", "password123"); err != nil {
+		t.Fatalf("Expected login after the lock expired, got %v", err)
+	}
+
+	// A success resets the count
+	for i := 0; i < 2; i++ {
+		_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	}
+	if _, err := auth.LoginUser("locked@example.com", "password123"); err != nil {
+		t.Fatalf("Expected login on the last allowed attempt, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	}
+	if _, err := auth.LoginUser("locked@example.com", "password123"); err != nil {
+		t.Fatalf("Expected a success to have reset the count, got %v", err)
+	}
+
+	// Attempts outside the window don't count
+	for i := 0; i < 2; i++ {
+		_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	}
+	now = now.Add(10 * time.Minute)
+	_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	if _, err := auth.LoginUser("locked@example.com", "password123"); err != nil {
+		t.Fatalf("Expected attempts outside the window to be forgotten, got %v", err)
+	}
+
+	if err := auth.UnlockUser(user.ID); err != nil {
+		t.Fatalf("Expected UnlockUser to succeed, got %v", err)
+	}
+	if err := auth.UnlockUser("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth, user := newLockoutTestKit(t, &now)
+	defer auth.Close()
+
+	for i := 0; i < 4; i++ {
+		_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	}
+	if info, _ := auth.UpdateUser(user.ID, nil); !info.Locked {
+		t.Fatal("Expected the user to be locked")
+	}
+
+	if err := auth.UnlockUser(user.ID); err != nil {
+		t.Fatalf("Expected UnlockUser to succeed, got %v", err)
+	}
+	if _, err := auth.LoginUser("locked@example.com", "password123"); err != nil {
+		t.Errorf("Expected login after unlocking, got %v", err)
+	}
+}
+
+func TestAccountLockoutConcurrent(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth, _ := newLockoutTestKit(t, &now)
+	defer auth.Close()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	counts := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := auth.LoginUser("locked@example.com", "wrong-password")
+			mutex.Lock()
+			counts[ErrorCode(err)]++
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counts[CodeInvalidCredentials] != 3 || counts[CodeAccountLocked] != 17 {
+		t.Errorf("Expected exactly 3 password checks before locking, got %v", counts)
+	}
+}
+
+func TestAccountLockoutDisabled(t *testing.T) {
+	auth := newTestKit(t, Config{MaxLoginAttempts: -1})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "open@example.com", Password: "password123", Name: "Open"})
+
+	for i := 0; i < 10; i++ {
+		_, _ = auth.LoginUser("open@example.com", "wrong-password")
+	}
+	if _, err := auth.LoginUser("open@example.com", "password123"); err != nil {
+		t.Errorf("Expected no lockout when disabled, got %v", err)
+	}
+}
+
+func TestMemoryLockoutStorePrune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryLockoutStore()
+	policy := LockoutPolicy{MaxAttempts: 2, Window: 10 * time.Minute, Duration: time.Hour}
+	_, _ = store.RecordAttempt("failed", now, policy)
+	_, _ = store.RecordAttempt("locked", now, policy)
+	_, _ = store.RecordAttempt("locked", now, policy)
+
+	if pruned := store.Prune(now.Add(10*time.Minute - time.Second)); pruned != 0 {
+		t.Errorf("Expected nothing to be pruned within the window, pruned %d", pruned)
+	}
+	if pruned := store.Prune(now.Add(10 * time.Minute)); pruned != 1 {
+		t.Errorf("Expected the attempts to be pruned once the window passed, pruned %d", pruned)
+	}
+	if state, _ := store.Get("locked"); !state.Locked(now.Add(10 * time.Minute)) {
+		t.Errorf("Expected the lock to outlive the window, got %+v", state)
+	}
+	if pruned := store.Prune(now.Add(time.Hour)); pruned != 1 {
+		t.Errorf("Expected the lock to be pruned once it expired, pruned %d", pruned)
+	}
+	if state, _ := store.Get("locked"); state != (LockoutState{}) {
+		t.Errorf("Expected the zero state after pruning, got %+v", state)
+	}
+}
+
+func TestAccountLockoutHandler(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth, _ := newLockoutTestKit(t, &now)
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+
+	for i := 0; i < 3; i++ {
+		_, _ = auth.LoginUser("locked@example.com", "wrong-password")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"locked@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), CodeAccountLocked) {
+		t.Errorf("Expected 423 with %s, got %d: %s", CodeAccountLocked, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,54 @@
+package authkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+)
+
+// discardHandler is a slog.Handler dropping every record, so AuthKit stays
+// silent unless Config.Logger is set
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// fingerprint identifies a token or ID in logs and traces without revealing
+// it: the hex of the first 8 bytes of its SHA-256
+func fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// logLogin logs the outcome of a login attempt. userID is empty for unknown
+// emails, which are logged instead; passwords never are.
+func (a *AuthKit) logLogin(userID, email, ip string, err error) {
+	if err == nil {
+		a.config.Logger.Info("login succeeded", "user_id", userID, "ip", ip)
+		return
+	}
+	attrs := []any{"reason", ErrorCode(err), "ip", ip}
+	if userID != "" {
+		attrs = append(attrs, "user_id", userID)
+	} else {
+		attrs = append(attrs, "email", email)
+	}
+	a.config.Logger.Warn("login failed", attrs...)
+}
+
+// logTokenRejected logs a token that failed validation, identified by its
+// fingerprint
+func (a *AuthKit) logTokenRejected(token string, err error) {
+	a.config.Logger.Info("token validation failed", "reason", ErrorCode(err), "token", fingerprint(token))
+}
+
+// logRejection logs and counts a request the middleware turned away, and
+// records it on the span in ctx
+func (a *AuthKit) logRejection(ctx context.Context, path, code string) {
+	a.config.Logger.Info("request rejected", "path", path, "reason", code)
+	a.config.Metrics.MiddlewareRejection(code)
+	a.config.Tracer.SpanFromContext(ctx).AddEvent(TraceEventRejected, map[string]string{TraceAttrErrorCode: code})
+}
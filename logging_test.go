@@ -0,0 +1,143 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureHandler is a slog.Handler keeping every record with its attributes
+type captureHandler struct {
+	mutex   sync.Mutex
+	records []capturedRecord
+}
+
+type capturedRecord struct {
+	level   slog.Level
+	message string
+	attrs   map[string]string
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	record := capturedRecord{level: r.Level, message: r.Message, attrs: make(map[string]string)}
+	r.Attrs(func(attr slog.Attr) bool {
+		record.attrs[attr.Key] = attr.Value.String()
+		return true
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, record)
+	return nil
+}
+
+// find returns the records with the message
+func (h *captureHandler) find(message string) []capturedRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var found []capturedRecord
+	for _, record := range h.records {
+		if record.message == message {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// String renders every record, for redaction checks
+func (h *captureHandler) String() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var b strings.Builder
+	for _, record := range h.records {
+		fmt.Fprintf(&b, "%s %s %v\n", record.level, record.message, record.attrs)
+	}
+	return b.String()
+}
+
+func TestStructuredLogging(t *testing.T) {
+	handler := &captureHandler{}
+	auth := newTestKit(t, Config{
+		Logger: slog.New(handler),
+	})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "log@example.com", Password: "secret-password-1", Name: "Log"})
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "log@example.com", Password: "secret-password-1", Name: "Log"})
+	_, _ = auth.LoginUser("log@example.com", "wrong-password-2", LoginContext{IP: "203.0.113.5"})
+	_, _ = auth.LoginUser("nobody@example.com", "wrong-password-3")
+	tokens, _ := auth.LoginUser("log@example.com", "secret-password-1")
+	_ = auth.RevokeToken(tokens.AccessToken)
+	_, _ = auth.ValidateToken(tokens.AccessToken)
+
+	r := gin.New()
+	r.GET("/protected", auth.GinMiddleware(), func(c *gin.Context) {})
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Token abc")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if registered := handler.find("user registered"); len(registered) != 1 || registered[0].attrs["user_id"] != user.ID {
+		t.Errorf("Expected the registration, got %+v", registered)
+	}
+	if rejected := handler.find("registration rejected"); len(rejected) != 1 || rejected[0].attrs["reason"] != CodeUserAlreadyExists {
+		t.Errorf("Expected the registration conflict, got %+v", rejected)
+	}
+
+	failed := handler.find("login failed")
+	if len(failed) != 2 || failed[0].level != slog.LevelWarn {
+		t.Fatalf("Expected two warnings for failed logins, got %+v", failed)
+	}
+	if failed[0].attrs["user_id"] != user.ID || failed[0].attrs["reason"] != CodeInvalidCredentials || failed[0].attrs["ip"] != "203.0.113.5" {
+		t.Errorf("Expected the failed login with user ID, reason and IP, got %+v", failed[0])
+	}
+	if failed[1].attrs["email"] != "nobody@example.com" || failed[1].attrs["user_id"] != "" {
+		t.Errorf("Expected the unknown email to be logged, got %+v", failed[1])
+	}
+	if succeeded := handler.find("login succeeded"); len(succeeded) != 1 || succeeded[0].attrs["user_id"] != user.ID {
+		t.Errorf("Expected the successful login, got %+v", succeeded)
+	}
+
+	if revoked := handler.find("token revoked"); len(revoked) != 1 || revoked[0].attrs["jti"] == "" {
+		t.Errorf("Expected the revocation with its JTI, got %+v", revoked)
+	}
+	invalid := handler.find("token validation failed")
+	if len(invalid) != 1 || invalid[0].attrs["reason"] != CodeTokenRevoked || invalid[0].attrs["token"] != fingerprint(tokens.AccessToken) {
+		t.Errorf("Expected the validation failure with the token fingerprint, got %+v", invalid)
+	}
+	if rejected := handler.find("request rejected"); len(rejected) != 1 || rejected[0].attrs["path"] != "/protected" || rejected[0].attrs["reason"] != CodeInvalidAuthorizationFormat {
+		t.Errorf("Expected the middleware rejection with its path, got %+v", rejected)
+	}
+
+	output := handler.String()
+	for _, secret := range []string{"secret-password-1", "wrong-password-2", "wrong-password-3", "test-secret-key-for-testing-only", tokens.AccessToken, tokens.RefreshToken} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected %q to be redacted from the logs:\n%s", secret, output)
+		}
+	}
+}
+
+func TestLoggingDefaultsToDiscard(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if auth.config.Logger == nil || auth.config.Logger.Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected a logger discarding every record by default")
+	}
+	if _, err := auth.LoginUser("nobody@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
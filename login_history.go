@@ -0,0 +1,169 @@
+package authkit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultLoginHistorySize is how many login events are kept per user (see Config.LoginHistorySize)
+const defaultLoginHistorySize = 20
+
+// LoginContext describes the client of a login, see LoginUser. The bundled
+// handlers fill it in from the request.
+type LoginContext struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginEvent is a login attempt in a user's history
+type LoginEvent struct {
+	UserID    string    `json:"user_id"`
+	Time      time.Time `json:"time"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // Error code of failed attempts
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// LoginHistoryStore keeps the most recent login events of each user
+type LoginHistoryStore interface {
+	// Record adds an event to the user's history, keeping at most max events
+	Record(event LoginEvent, max int) error
+	// List returns up to limit of the user's events, newest first (all of them if limit <= 0)
+	List(userID string, limit int) ([]LoginEvent, error)
+	// Delete removes the user's history
+	Delete(userID string) error
+}
+
+// MemoryLoginHistoryStore is an in-memory LoginHistoryStore
+type MemoryLoginHistoryStore struct {
+	events map[string][]LoginEvent // Oldest first
+	mutex  sync.Mutex
+}
+
+// NewMemoryLoginHistoryStore creates an empty in-memory login history store
+func NewMemoryLoginHistoryStore() *MemoryLoginHistoryStore {
+	return &MemoryLoginHistoryStore{events: make(map[string][]LoginEvent)}
+}
+
+// Record adds an event, dropping the oldest ones beyond max
+func (s *MemoryLoginHistoryStore) Record(event LoginEvent, max int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := append(s.events[event.UserID], event)
+	if len(events) > max {
+		events = append([]LoginEvent(nil), events[len(events)-max:]...)
+	}
+	s.events[event.UserID] = events
+	return nil
+}
+
+// List returns up to limit of the user's events, newest first
+func (s *MemoryLoginHistoryStore) List(userID string, limit int) ([]LoginEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := s.events[userID]
+	if limit <= 0 || limit > len(events) {
+		limit = len(events)
+	}
+	result := make([]LoginEvent, 0, limit)
+	for i := len(events) - 1; len(result) < limit; i-- {
+		result = append(result, events[i])
+	}
+	return result, nil
+}
+
+// Delete removes the user's history
+func (s *MemoryLoginHistoryStore) Delete(userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.events, userID)
+	return nil
+}
+
+// GetLoginHistory returns up to limit of the user's most recent login
+// attempts, newest first (all kept attempts if limit <= 0)
+func (a *AuthKit) GetLoginHistory(userID string, limit int) ([]LoginEvent, error) {
+	a.debugCheck()
+
+	if _, err := a.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	if !a.loginHistoryEnabled() {
+		return []LoginEvent{}, nil
+	}
+	return a.config.LoginHistoryStore.List(userID, limit)
+}
+
+// loginHistoryEnabled reports whether login attempts are recorded
+func (a *AuthKit) loginHistoryEnabled() bool {
+	return a.config.LoginHistorySize > 0
+}
+
+// recordLogin records the outcome of a login attempt by a known user in the
+// login history and audit log, runs the login hooks and sets
+// User.LastLoginAt on success. MFA challenges are recorded once completed.
+// History is best effort: store errors don't fail the login.
+func (a *AuthKit) recordLogin(ctx context.Context, user *User, lc []LoginContext, tokens *TokenResponse, err error) {
+	if err == nil && tokens.MFARequired {
+		a.config.Metrics.LoginAttempt(MetricResultMFARequired)
+		return
+	}
+	userID := user.ID
+
+	now := a.now()
+	if err == nil {
+		a.mutex.Lock()
+		if stored, exists := a.users.get(userID); exists {
+			user := cloneUser(stored)
+			user.LastLoginAt = &now
+			a.users.put(user)
+		}
+		a.mutex.Unlock()
+	}
+
+	event := LoginEvent{UserID: userID, Time: now, Success: err == nil}
+	if err != nil {
+		event.Reason = ErrorCode(err)
+	}
+	if len(lc) > 0 {
+		event.IP = lc[0].IP
+		event.UserAgent = lc[0].UserAgent
+	}
+	a.logLogin(userID, user.Email, event.IP, err)
+	a.config.Metrics.LoginAttempt(outcome(err))
+	if a.loginHistoryEnabled() {
+		recordErr := a.traceStore(ctx, "LoginHistoryStore.Record", func() error {
+			return a.config.LoginHistoryStore.Record(event, a.config.LoginHistorySize)
+		})
+		if recordErr != nil {
+			a.config.Logger.Error("recording login history failed", "user_id", userID, "error", recordErr)
+		}
+	}
+
+	audit := AuditEvent{Type: AuditLoginSucceeded, ActorID: userID, UserID: userID, Time: now, IP: event.IP}
+	if err != nil {
+		audit.Type = AuditLoginFailed
+		audit.Metadata = map[string]string{"reason": event.Reason}
+	}
+	a.audit(audit)
+
+	if err != nil {
+		a.loginFailed(user.Email, err)
+	} else if hook := a.config.Hooks.OnLogin; hook != nil {
+		info := cloneUserInfo(tokens.User)
+		a.runHook("OnLogin", func() error { return hook(info) })
+	}
+}
+
+// loginIP returns the IP address of an optional LoginContext
+func loginIP(lc []LoginContext) string {
+	if len(lc) == 0 {
+		return ""
+	}
+	return lc[0].IP
+}
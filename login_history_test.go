@@ -0,0 +1,101 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginHistory(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{LoginHistorySize: 3, Clock: testClock(&now)})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "history@example.com", Password: "password123", Name: "History"})
+	if user.LastLoginAt != nil {
+		t.Errorf("Expected no LastLoginAt before the first login, got %v", user.LastLoginAt)
+	}
+
+	client := LoginContext{IP: "203.0.113.7", UserAgent: "test-agent"}
+	_, _ = auth.LoginUser("history@example.com", "wrong-password", client)
+	now = now.Add(time.Minute)
+	if _, err := auth.LoginUser("history@example.com", "password123", client); err != nil {
+		t.Fatal(err)
+	}
+	loggedInAt := now
+
+	events, err := auth.GetLoginHistory(user.ID, 0)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected two events, got %+v %v", events, err)
+	}
+	if !events[0].Success || events[0].IP != client.IP || events[0].UserAgent != client.UserAgent || !events[0].Time.Equal(loggedInAt) {
+		t.Errorf("Expected the successful login first, got %+v", events[0])
+	}
+	if events[1].Success || events[1].Reason != CodeInvalidCredentials {
+		t.Errorf("Expected the failed attempt with its reason, got %+v", events[1])
+	}
+	if stored, _ := auth.GetUserByID(user.ID); stored.LastLoginAt == nil || !stored.LastLoginAt.Equal(loggedInAt) {
+		t.Errorf("Expected LastLoginAt to be set, got %v", stored.LastLoginAt)
+	}
+
+	// Logins without a context are recorded too, and the history is bounded
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		_, _ = auth.LoginUser("history@example.com", "password123")
+	}
+	if events, _ := auth.GetLoginHistory(user.ID, 0); len(events) != 3 || events[0].IP != "" {
+		t.Errorf("Expected the three newest events, got %+v", events)
+	}
+	if events, _ := auth.GetLoginHistory(user.ID, 1); len(events) != 1 || !events[0].Time.Equal(now) {
+		t.Errorf("Expected only the newest event, got %+v", events)
+	}
+
+	if _, err := auth.GetLoginHistory("missing", 0); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	_ = auth.DeleteUser(user.ID)
+	if events, _ := auth.config.LoginHistoryStore.List(user.ID, 0); len(events) != 0 {
+		t.Errorf("Expected the history to be deleted with the user, got %+v", events)
+	}
+}
+
+func TestLoginHistoryDisabled(t *testing.T) {
+	auth := newTestKit(t, Config{LoginHistorySize: -1})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "nohistory@example.com")
+
+	if events, err := auth.GetLoginHistory(tokens.User.ID, 0); err != nil || len(events) != 0 {
+		t.Errorf("Expected no history, got %+v %v", events, err)
+	}
+	if user, _ := auth.GetUserByID(tokens.User.ID); user.LastLoginAt == nil {
+		t.Error("Expected LastLoginAt to be set without a history")
+	}
+}
+
+func TestLoginHistoryHandler(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "handler@example.com", Password: "password123", Name: "Handler"})
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"handler@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "handler-agent")
+	req.RemoteAddr = "198.51.100.4:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+
+	events, _ := auth.GetLoginHistory(user.ID, 0)
+	if len(events) != 1 || events[0].IP != "198.51.100.4" || events[0].UserAgent != "handler-agent" {
+		t.Errorf("Expected the handler to record the client, got %+v", events)
+	}
+}
@@ -0,0 +1,65 @@
+package authkit
+
+import "time"
+
+// LoginOptions tune a login made with LoginUserWithOptions
+type LoginOptions struct {
+	// TenantID selects the user with the email in a tenant, see LoginUserInTenant
+	TenantID string
+	// Context describes the client in the user's login history
+	Context LoginContext
+	// RememberMe extends the refresh token to Config.RememberMeExpiry, for
+	// "keep me signed in" logins. RefreshExpiry takes precedence when set.
+	RememberMe bool
+	// AccessExpiry and RefreshExpiry override the token lifetimes, clamped
+	// to Config.MaxTokenExpiry and Config.MaxRefreshExpiry. Zero keeps the
+	// configured lifetime.
+	AccessExpiry  time.Duration
+	RefreshExpiry time.Duration
+	// Scope limits the permissions in the session's tokens to those listed,
+	// like OAuth2 scopes. Nil leaves them unrestricted and an empty Scope
+	// grants none; the role is unaffected.
+	Scope []string
+	// Nonce is echoed in the nonce claim of the ID token, see Config.OIDC
+	Nonce string
+}
+
+// tokenLifetimes are the access and refresh token lifetimes of a session
+type tokenLifetimes struct {
+	access  time.Duration
+	refresh time.Duration
+}
+
+// defaultLifetimes are the lifetimes of sessions started without LoginOptions
+func (a *AuthKit) defaultLifetimes() tokenLifetimes {
+	return tokenLifetimes{access: a.accessExpiry, refresh: a.refreshExpiry}
+}
+
+// loginLifetimes returns the lifetimes opts ask for, within the caps
+func (a *AuthKit) loginLifetimes(opts LoginOptions) tokenLifetimes {
+	lifetimes := a.defaultLifetimes()
+	if opts.RememberMe {
+		lifetimes.refresh = a.rememberMe
+	}
+	if opts.AccessExpiry > 0 {
+		lifetimes.access = opts.AccessExpiry
+	}
+	if opts.RefreshExpiry > 0 {
+		lifetimes.refresh = opts.RefreshExpiry
+	}
+	return a.clampLifetimes(lifetimes)
+}
+
+// clampLifetimes fills in unset lifetimes with the defaults and shortens
+// those above the caps
+func (a *AuthKit) clampLifetimes(lifetimes tokenLifetimes) tokenLifetimes {
+	if lifetimes.access <= 0 {
+		lifetimes.access = a.accessExpiry
+	}
+	if lifetimes.refresh <= 0 {
+		lifetimes.refresh = a.refreshExpiry
+	}
+	lifetimes.access = min(lifetimes.access, a.maxAccess)
+	lifetimes.refresh = min(lifetimes.refresh, a.maxRefresh)
+	return lifetimes
+}
@@ -0,0 +1,164 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenExpiry returns how long after now a token expires
+func tokenExpiry(t *testing.T, token string, now time.Time) time.Duration {
+	t.Helper()
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		t.Fatalf("Expected a JWT with an expiry, got %v", err)
+	}
+	return claims.ExpiresAt.Sub(now)
+}
+
+func TestLoginUserWithOptions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{TokenExpiry: "15m", RefreshExpiry: "1d", MaxTokenExpiry: "1h", Clock: testClock(&now)})
+	defer auth.Close()
+
+	defaults := loginTestUser(t, auth, "remember@example.com")
+	if defaults.ExpiresIn != 15*60 || defaults.RefreshExpiresIn != 24*60*60 {
+		t.Errorf("Expected the configured lifetimes, got %d and %d", defaults.ExpiresIn, defaults.RefreshExpiresIn)
+	}
+
+	remembered, err := auth.LoginUserWithOptions("remember@example.com", "password123", LoginOptions{RememberMe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remembered.ExpiresIn != 15*60 || remembered.RefreshExpiresIn != 30*24*60*60 {
+		t.Errorf("Expected a 30 day refresh token, got %d and %d", remembered.ExpiresIn, remembered.RefreshExpiresIn)
+	}
+	if d := tokenExpiry(t, remembered.RefreshToken, now); d != 30*24*time.Hour {
+		t.Errorf("Expected the refresh token to expire in 30 days, got %v", d)
+	}
+
+	// Longer lifetimes than the caps are clamped rather than rejected
+	clamped, err := auth.LoginUserWithOptions("remember@example.com", "password123", LoginOptions{
+		AccessExpiry:  48 * time.Hour,
+		RefreshExpiry: 365 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clamped.ExpiresIn != 60*60 || clamped.RefreshExpiresIn != 30*24*60*60 {
+		t.Errorf("Expected the lifetimes to be clamped to the caps, got %d and %d", clamped.ExpiresIn, clamped.RefreshExpiresIn)
+	}
+	if d := tokenExpiry(t, clamped.AccessToken, now); d != time.Hour {
+		t.Errorf("Expected the access token to expire in an hour, got %v", d)
+	}
+
+	// Refreshes keep the session's lifetimes, also across SaveState
+	now = now.Add(2 * 24 * time.Hour)
+	var state bytes.Buffer
+	if err := auth.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := auth.RefreshToken(remembered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected the remembered session to outlive RefreshExpiry, got %v", err)
+	}
+	if refreshed.RefreshExpiresIn != 30*24*60*60 || tokenExpiry(t, refreshed.RefreshToken, now) != 30*24*time.Hour {
+		t.Errorf("Expected the refresh to keep the 30 day lifetime, got %d", refreshed.RefreshExpiresIn)
+	}
+	sessions, _ := auth.ListSessions(remembered.User.ID)
+	for _, session := range sessions {
+		if session.ID == remembered.SessionID && !session.ExpiresAt.Equal(now.Add(30*24*time.Hour)) {
+			t.Errorf("Expected the session to be extended by 30 days, got %v", session.ExpiresAt)
+		}
+	}
+	if _, err := auth.RefreshToken(defaults.RefreshToken); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected the default refresh token to have expired, got %v", err)
+	}
+}
+
+func TestLoginOptionsThroughMFA(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "remember-mfa@example.com", Password: "password123", Name: "MFA"})
+	secret := enrollTestTOTP(t, auth, user.ID)
+	pending, err := auth.LoginUserWithOptions(user.Email, "password123", LoginOptions{RememberMe: true})
+	if err != nil || !pending.MFARequired {
+		t.Fatalf("Expected an MFA token, got %+v %v", pending, err)
+	}
+	now = now.Add(totpPeriod * time.Second)
+	tokens, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, now.Unix()/totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.RefreshExpiresIn != 30*24*60*60 {
+		t.Errorf("Expected remember-me to carry through MFA, got %d", tokens.RefreshExpiresIn)
+	}
+}
+
+func TestRememberMeHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1})
+	defer auth.Close()
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "remember-handlers@example.com", Password: "password123", Name: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := mountRoutes(t, auth, RouteOptions{})
+	handlers["http"] = http.HandlerFunc(auth.LoginHandlerHTTP)
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			for _, remember := range []bool{false, true} {
+				body := `{"email":"remember-handlers@example.com","password":"password123"}`
+				want := int64(7 * 24 * 60 * 60)
+				if remember {
+					body = `{"email":"remember-handlers@example.com","password":"password123","remember_me":true}`
+					want = 30 * 24 * 60 * 60
+				}
+				req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+				}
+				var tokens TokenResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+					t.Fatal(err)
+				}
+				if tokens.RefreshExpiresIn != want {
+					t.Errorf("Expected refresh_expires_in %d with remember_me %v, got %d", want, remember, tokens.RefreshExpiresIn)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLifetimeConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"invalid remember me expiry", Config{RememberMeExpiry: "forever"}},
+		{"access cap below the default", Config{TokenExpiry: "1h", MaxTokenExpiry: "30m"}},
+		{"refresh cap below the default", Config{MaxRefreshExpiry: "1d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.JWTSecret = "test-secret-key-for-testing-only"
+			if err := tt.config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package authkit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NoncePurposeLoginLink is the nonce purpose of magic link login tokens
+const NoncePurposeLoginLink = "login_link"
+
+// loginLinkSentMessage is the request link response, whether or not the email exists
+const loginLinkSentMessage = "If the email can sign in, a login link has been sent"
+
+// defaultLoginLinkExpiry is Config.LoginLinkExpiry when unset
+const defaultLoginLinkExpiry = 15 * time.Minute
+
+// CreateLoginLinkToken issues a single-use token that logs in the user with
+// the given email (default expiry: Config.LoginLinkExpiry). Unknown emails
+// return ErrUserNotFound unless Config.AutoCreateOnMagicLink is set, in which
+// case LoginWithLinkToken creates the account.
+func (a *AuthKit) CreateLoginLinkToken(email string, expiry time.Duration) (string, error) {
+	return a.CreateLoginLinkTokenInTenant("", email, expiry)
+}
+
+// CreateLoginLinkTokenInTenant is CreateLoginLinkToken for the user with the
+// email in the tenant, see LoginUserInTenant. Accounts it leads to create are
+// created in the tenant.
+func (a *AuthKit) CreateLoginLinkTokenInTenant(tenantID, email string, expiry time.Duration) (string, error) {
+	a.debugCheck()
+
+	if expiry <= 0 {
+		expiry = a.config.LoginLinkExpiry
+	}
+
+	meta := map[string]string{"tenant_id": tenantID}
+	user, err := a.GetUserByEmailInTenant(tenantID, email)
+	if err == nil {
+		meta["user_id"] = user.ID
+		meta["email"] = user.Email
+	} else if !a.config.AutoCreateOnMagicLink {
+		return "", err
+	} else if meta["email"], err = a.NormalizeEmail(email); err != nil {
+		return "", err
+	}
+
+	return a.IssueNonce(NoncePurposeLoginLink, expiry, meta)
+}
+
+// RequestLoginLink creates a login link token and delivers it with
+// Config.SendLoginLink, or else as the built-in email through
+// Config.EmailSender. Emails that can't sign in return nil without sending
+// anything, so callers can't learn which emails are registered.
+func (a *AuthKit) RequestLoginLink(email string) error {
+	return a.RequestLoginLinkInTenant("", email)
+}
+
+// RequestLoginLinkInTenant is RequestLoginLink for the user with the email in
+// the tenant, see LoginUserInTenant
+func (a *AuthKit) RequestLoginLinkInTenant(tenantID, email string) error {
+	if a.config.SendLoginLink == nil && a.config.EmailSender == nil {
+		return ErrNoEmailSender
+	}
+
+	token, err := a.CreateLoginLinkTokenInTenant(tenantID, email, 0)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	info := &UserInfo{Email: email}
+	if user, err := a.GetUserByEmailInTenant(tenantID, email); err == nil {
+		info = a.userToUserInfo(user)
+	}
+	return a.deliverToken(EmailLoginLink, a.config.SendLoginLink, a.config.LoginLinkURL,
+		a.config.LoginLinkExpiry, info, token)
+}
+
+// LoginWithLinkToken logs in with a token from CreateLoginLinkToken, consuming
+// it, and returns the user's tokens (or an MFA token for users with MFA
+// enabled). Following the link proves the user controls the email, so it is
+// marked verified. Tokens issued before the user's email changed are rejected.
+func (a *AuthKit) LoginWithLinkToken(token string) (*TokenResponse, error) {
+	a.debugCheck()
+
+	meta, err := a.ConsumeNonce(token, NoncePurposeLoginLink)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *User
+	if userID := meta["user_id"]; userID != "" {
+		user, err = a.markLinkEmailVerified(userID, meta["email"])
+	} else {
+		user, err = a.createLinkUser(meta["tenant_id"], meta["email"])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.PurgeAt != nil {
+		return nil, ErrAccountPendingDeletion
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if user.TOTPEnabled {
+		return a.mfaToken(user, nil, a.defaultLifetimes(), nil, "")
+	}
+
+	tokens, err := a.GenerateTokenPair(user)
+	if err != nil {
+		return nil, err
+	}
+	a.sendNewLoginAlert(tokens.User)
+	return tokens, nil
+}
+
+// markLinkEmailVerified returns the user a login link was issued to, marking
+// their email verified, if the email hasn't changed since
+func (a *AuthKit) markLinkEmailVerified(userID, email string) (*User, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists || stored.DeletedAt != nil || stored.Email != email {
+		return nil, ErrInvalidNonce
+	}
+	user := cloneUser(stored)
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		user.UpdatedAt = a.now()
+		a.users.put(cloneUser(user))
+	}
+	return user, nil
+}
+
+// createLinkUser creates a passwordless user in the tenant for a login link
+// issued under Config.AutoCreateOnMagicLink. If the email was registered in
+// the meantime, that user is logged in instead.
+func (a *AuthKit) createLinkUser(tenantID, email string) (*User, error) {
+	now := a.now()
+	user := &User{
+		ID:            uuid.New().String(),
+		TenantID:      tenantID,
+		Email:         email,
+		Role:          defaultRole,
+		Permissions:   []string{},
+		EmailVerified: true,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	// Snapshot before storing, afterwards the user may be updated concurrently
+	snapshot := cloneUser(user)
+
+	switch err := a.insertUser(user); {
+	case err == nil:
+		return snapshot, nil
+	case errors.Is(err, ErrUserAlreadyExists):
+		existing, err := a.GetUserByEmailInTenant(tenantID, email)
+		if err != nil {
+			return nil, ErrInvalidNonce
+		}
+		return a.markLinkEmailVerified(existing.ID, email)
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,213 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLoginLink(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{EmailRequired: true, Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "link@example.com", Password: "password123", Name: "Link"})
+
+	if _, err := auth.CreateLoginLinkToken("nobody@example.com", 0); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound without AutoCreateOnMagicLink, got %v", err)
+	}
+
+	token, err := auth.CreateLoginLinkToken("link@example.com", 0)
+	if err != nil {
+		t.Fatalf("Expected a login link token, got %v", err)
+	}
+	tokens, err := auth.LoginWithLinkToken(token)
+	if err != nil {
+		t.Fatalf("Expected the link to log in, got %v", err)
+	}
+	if tokens.User.ID != user.ID || !tokens.User.EmailVerified {
+		t.Errorf("Expected the existing user with a verified email, got %+v", tokens.User)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected a valid access token, got %v", err)
+	}
+	if _, err := auth.LoginWithLinkToken(token); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected the token to be single-use, got %v", err)
+	}
+
+	short, _ := auth.CreateLoginLinkToken("link@example.com", time.Minute)
+	now = now.Add(2 * time.Minute)
+	if _, err := auth.LoginWithLinkToken(short); !errors.Is(err, ErrNonceExpired) {
+		t.Errorf("Expected ErrNonceExpired, got %v", err)
+	}
+
+	stale, _ := auth.CreateLoginLinkToken("link@example.com", 0)
+	auth.mutex.Lock()
+	stored, _ := auth.users.get(user.ID)
+	changed := cloneUser(stored)
+	changed.Email = "changed@example.com"
+	auth.users.put(changed)
+	auth.mutex.Unlock()
+	if _, err := auth.LoginWithLinkToken(stale); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected a link for the old email to be rejected, got %v", err)
+	}
+}
+
+func TestLoginLinkAutoCreate(t *testing.T) {
+	auth := newTestKit(t, Config{AutoCreateOnMagicLink: true})
+	defer auth.Close()
+
+	token, err := auth.CreateLoginLinkToken("new@example.com", 0)
+	if err != nil {
+		t.Fatalf("Expected a token for an unregistered email, got %v", err)
+	}
+	if _, err := auth.GetUserByEmail("new@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected no user before the link is used, got %v", err)
+	}
+
+	tokens, err := auth.LoginWithLinkToken(token)
+	if err != nil {
+		t.Fatalf("Expected the link to create and log in the user, got %v", err)
+	}
+	if tokens.User.Email != "new@example.com" || tokens.User.Role != "user" || !tokens.User.EmailVerified {
+		t.Errorf("Unexpected user %+v", tokens.User)
+	}
+	created, _ := auth.GetUserByEmail("new@example.com")
+	if created == nil || created.Password != "" {
+		t.Fatalf("Expected a passwordless user, got %+v", created)
+	}
+	if _, err := auth.LoginUser("new@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected password login to fail for a passwordless user, got %v", err)
+	}
+
+	// Two links issued before the account existed log in the same user
+	first, _ := auth.CreateLoginLinkToken("race@example.com", 0)
+	second, _ := auth.CreateLoginLinkToken("race@example.com", 0)
+	firstLogin, _ := auth.LoginWithLinkToken(first)
+	secondLogin, err := auth.LoginWithLinkToken(second)
+	if err != nil || firstLogin.User.ID != secondLogin.User.ID {
+		t.Errorf("Expected both links to log in the same user, got %v", err)
+	}
+}
+
+func TestLoginLinkRequiresMFA(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "linkmfa@example.com", Password: "password123", Name: "MFA"})
+	secret := enrollTestTOTP(t, auth, user.ID)
+
+	token, _ := auth.CreateLoginLinkToken("linkmfa@example.com", 0)
+	pending, err := auth.LoginWithLinkToken(token)
+	if err != nil || !pending.MFARequired || pending.AccessToken != "" {
+		t.Fatalf("Expected an MFA challenge, got %+v %v", pending, err)
+	}
+
+	now = now.Add(totpPeriod * time.Second)
+	tokens, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, now.Unix()/totpPeriod))
+	if err != nil {
+		t.Fatalf("Expected CompleteMFALogin to succeed, got %v", err)
+	}
+	claims, _ := auth.ValidateToken(tokens.AccessToken)
+	if claims == nil || strings.Join(claims.AMR, ",") != "otp,mfa" {
+		t.Errorf("Expected amr [otp mfa] without a password, got %+v", claims)
+	}
+}
+
+func TestLoginLinkEmail(t *testing.T) {
+	sender := NewMemoryEmailSender()
+	auth := newTestKit(t, Config{
+		EmailSender:  sender,
+		LoginLinkURL: "https://app.example.com/login/link",
+	})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "mail@example.com", Password: "password123", Name: "Mail"})
+
+	if err := auth.RequestLoginLink("nobody@example.com"); err != nil || len(sender.Messages()) != 0 {
+		t.Fatalf("Expected nothing sent to an unknown email, got %v %v", err, sender.Messages())
+	}
+	if err := auth.RequestLoginLink("mail@example.com"); err != nil {
+		t.Fatalf("Expected the link to be sent, got %v", err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "mail@example.com" || messages[0].Subject != "Your sign-in link" {
+		t.Fatalf("Unexpected messages %+v", messages)
+	}
+	start := strings.Index(messages[0].TextBody, "https://app.example.com/login/link?token=")
+	if start < 0 {
+		t.Fatalf("Expected a link in %q", messages[0].TextBody)
+	}
+	link := strings.Fields(messages[0].TextBody[start:])[0]
+	token := strings.TrimPrefix(link, "https://app.example.com/login/link?token=")
+	if _, err := auth.LoginWithLinkToken(token); err != nil {
+		t.Errorf("Expected the emailed token to log in, got %v", err)
+	}
+
+	noSender := newTestKit(t, Config{})
+	defer noSender.Close()
+	if err := noSender.RequestLoginLink("mail@example.com"); !errors.Is(err, ErrNoEmailSender) {
+		t.Errorf("Expected ErrNoEmailSender, got %v", err)
+	}
+}
+
+func TestLoginLinkHandlers(t *testing.T) {
+	sent := map[string]string{}
+	auth := newTestKit(t, Config{
+		SendLoginLink: func(user *UserInfo, token string) error {
+			sent[user.Email] = token
+			return nil
+		},
+	})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "handler@example.com", Password: "password123", Name: "Handler"})
+
+	r := gin.New()
+	r.POST("/login/link", auth.RequestLoginLinkHandler)
+	r.POST("/login/link/verify", auth.LoginWithLinkHandler)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	known := post("/login/link", `{"email":"handler@example.com"}`)
+	unknown := post("/login/link", `{"email":"nobody@example.com"}`)
+	if known.Code != http.StatusAccepted || known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("Expected identical 202 responses, got %d %s and %d %s", known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+	if len(sent) != 1 || sent["handler@example.com"] == "" {
+		t.Fatalf("Expected a token sent to the registered email only, got %v", sent)
+	}
+
+	w := post("/login/link/verify", `{"token":"`+sent["handler@example.com"]+`"}`)
+	var tokens TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	if w.Code != http.StatusOK || tokens.AccessToken == "" {
+		t.Fatalf("Expected tokens, got %d: %s", w.Code, w.Body.String())
+	}
+	w = post("/login/link/verify", `{"token":"`+sent["handler@example.com"]+`"}`)
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || errorField(body, "code") != CodeInvalidNonce {
+		t.Errorf("Expected 400 %s on replay, got %d: %s", CodeInvalidNonce, w.Code, w.Body.String())
+	}
+
+	app := fiber.New()
+	app.Post("/login/link/verify", auth.LoginWithLinkHandlerFiber)
+	token, _ := auth.CreateLoginLinkToken("handler@example.com", 0)
+	req := httptest.NewRequest(http.MethodPost, "/login/link/verify", strings.NewReader(`{"token":"`+token+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+}
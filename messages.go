@@ -0,0 +1,486 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Stable, machine-readable error codes used in API responses and as message catalog keys
+const (
+	CodeUserNotFound               = "user_not_found"
+	CodeInvalidPassword            = "invalid_password"
+	CodeInvalidCredentials         = "invalid_credentials"
+	CodeUserAlreadyExists          = "user_already_exists"
+	CodeInvalidToken               = "invalid_token"
+	CodeTokenExpired               = "token_expired"
+	CodeUnauthorized               = "unauthorized"
+	CodeInsufficientRole           = "insufficient_role"
+	CodeInvalidConfig              = "invalid_config"
+	CodeInvalidSubject             = "invalid_subject"
+	CodeAccountPendingDeletion     = "account_pending_deletion"
+	CodeAccountNotPendingDeletion  = "account_not_pending_deletion"
+	CodeInvalidNonce               = "invalid_nonce"
+	CodeNonceExpired               = "nonce_expired"
+	CodeTokenRevoked               = "token_revoked"
+	CodeAccountLocked              = "account_locked"
+	CodeRateLimited                = "rate_limited"
+	CodeServerBusy                 = "server_busy"
+	CodeWeakPassword               = "weak_password"
+	CodeEmailNotVerified           = "email_not_verified"
+	CodeInvalidMFACode             = "invalid_mfa_code"
+	CodeMFANotEnabled              = "mfa_not_enabled"
+	CodeMFAAlreadyEnabled          = "mfa_already_enabled"
+	CodeInvalidClientCredentials   = "invalid_client_credentials"
+	CodeServiceAccountNotFound     = "service_account_not_found"
+	CodeSessionNotFound            = "session_not_found"
+	CodeInvalidCSRFToken           = "invalid_csrf_token"
+	CodeInvalidEmail               = "invalid_email"
+	CodeRoleNotFound               = "role_not_found"
+	CodeInvalidRole                = "invalid_role"
+	CodeUserDisabled               = "user_disabled"
+	CodeUserNotDeleted             = "user_not_deleted"
+	CodeInvalidSearchQuery         = "invalid_search_query"
+	CodeBatchTooLarge              = "batch_too_large"
+	CodePasswordBreached           = "password_breached"
+	CodeBreachCheckUnavailable     = "breach_check_unavailable"
+	CodeRoleNotAllowed             = "role_not_allowed"
+	CodeRestrictedField            = "restricted_field"
+	CodeMissingAuthorization       = "missing_authorization"
+	CodeInvalidAuthorizationFormat = "invalid_authorization_format"
+	CodeNotAuthenticated           = "not_authenticated"
+	CodeInsufficientPermissions    = "insufficient_permissions"
+	CodeInvalidPermissionsFormat   = "invalid_permissions_format"
+	CodeTenantMismatch             = "tenant_mismatch"
+	CodeTenantRequired             = "tenant_required"
+	CodePasswordChangeRequired     = "password_change_required"
+	CodeSessionExpired             = "session_expired"
+	CodeSessionIdle                = "session_idle"
+	CodeIdentityNotLinked          = "identity_not_linked"
+	CodeIdentityAlreadyLinked      = "identity_already_linked"
+	CodeIdentityNotFound           = "identity_not_found"
+	CodeUnknownIdentityProvider    = "unknown_identity_provider"
+	CodeIdentityProviderFailed     = "identity_provider_failed"
+	CodeOIDCDisabled               = "oidc_disabled"
+	CodeMFARequired                = "mfa_required"
+	CodeAccessDenied               = "access_denied"
+	CodeBruteForceDisabled         = "brute_force_disabled"
+	CodeIPBanned                   = "ip_banned"
+	CodeInvalidIPAddress           = "invalid_ip_address"
+	CodeInvalidRequest             = "invalid_request"
+	CodeInternalError              = "internal_error"
+)
+
+// messageAccountRecoveryHint is the catalog key of the hint returned for logins to accounts pending deletion
+const messageAccountRecoveryHint = "account_recovery_hint"
+
+// errorCodes maps sentinel errors to their codes and suggested HTTP statuses,
+// checked in order with errors.Is
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{ErrUserNotFound, CodeUserNotFound, http.StatusNotFound},
+	{ErrInvalidPassword, CodeInvalidPassword, http.StatusUnauthorized},
+	{ErrInvalidCredentials, CodeInvalidCredentials, http.StatusUnauthorized},
+	{ErrUserAlreadyExists, CodeUserAlreadyExists, http.StatusConflict},
+	{ErrTokenExpired, CodeTokenExpired, http.StatusUnauthorized},
+	{ErrInvalidToken, CodeInvalidToken, http.StatusUnauthorized},
+	{ErrUnauthorized, CodeUnauthorized, http.StatusUnauthorized},
+	{ErrInsufficientRole, CodeInsufficientRole, http.StatusForbidden},
+	{ErrInvalidConfig, CodeInvalidConfig, http.StatusInternalServerError},
+	{ErrInvalidSubject, CodeInvalidSubject, http.StatusUnauthorized},
+	{ErrAccountPendingDeletion, CodeAccountPendingDeletion, http.StatusForbidden},
+	{ErrAccountNotPendingDeletion, CodeAccountNotPendingDeletion, http.StatusConflict},
+	{ErrInvalidNonce, CodeInvalidNonce, http.StatusBadRequest},
+	{ErrNonceExpired, CodeNonceExpired, http.StatusBadRequest},
+	{ErrTokenRevoked, CodeTokenRevoked, http.StatusUnauthorized},
+	{ErrAccountLocked, CodeAccountLocked, http.StatusLocked},
+	{ErrRateLimited, CodeRateLimited, http.StatusTooManyRequests},
+	{ErrServerBusy, CodeServerBusy, http.StatusServiceUnavailable},
+	{ErrWeakPassword, CodeWeakPassword, http.StatusBadRequest},
+	{ErrEmailNotVerified, CodeEmailNotVerified, http.StatusForbidden},
+	{ErrInvalidMFACode, CodeInvalidMFACode, http.StatusUnauthorized},
+	{ErrMFANotEnabled, CodeMFANotEnabled, http.StatusBadRequest},
+	{ErrMFAAlreadyEnabled, CodeMFAAlreadyEnabled, http.StatusConflict},
+	{ErrInvalidClientCredentials, CodeInvalidClientCredentials, http.StatusUnauthorized},
+	{ErrServiceAccountNotFound, CodeServiceAccountNotFound, http.StatusNotFound},
+	{ErrSessionNotFound, CodeSessionNotFound, http.StatusNotFound},
+	{ErrSessionExpired, CodeSessionExpired, http.StatusUnauthorized},
+	{ErrSessionIdle, CodeSessionIdle, http.StatusUnauthorized},
+	{ErrInvalidCSRFToken, CodeInvalidCSRFToken, http.StatusForbidden},
+	{ErrInvalidEmail, CodeInvalidEmail, http.StatusBadRequest},
+	{ErrRoleNotFound, CodeRoleNotFound, http.StatusNotFound},
+	{ErrInvalidRole, CodeInvalidRole, http.StatusBadRequest},
+	{ErrUserDisabled, CodeUserDisabled, http.StatusForbidden},
+	{ErrUserNotDeleted, CodeUserNotDeleted, http.StatusConflict},
+	{ErrInvalidSearchQuery, CodeInvalidSearchQuery, http.StatusBadRequest},
+	{ErrBatchTooLarge, CodeBatchTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrPasswordBreached, CodePasswordBreached, http.StatusBadRequest},
+	{ErrBreachCheckUnavailable, CodeBreachCheckUnavailable, http.StatusServiceUnavailable},
+	{ErrRoleNotAllowed, CodeRoleNotAllowed, http.StatusForbidden},
+	{ErrRestrictedField, CodeRestrictedField, http.StatusForbidden},
+	{ErrIdentityNotLinked, CodeIdentityNotLinked, http.StatusConflict},
+	{ErrIdentityAlreadyLinked, CodeIdentityAlreadyLinked, http.StatusConflict},
+	{ErrIdentityNotFound, CodeIdentityNotFound, http.StatusNotFound},
+	{ErrUnknownIdentityProvider, CodeUnknownIdentityProvider, http.StatusNotFound},
+	{ErrIdentityProviderFailed, CodeIdentityProviderFailed, http.StatusBadGateway},
+	{ErrOIDCDisabled, CodeOIDCDisabled, http.StatusNotFound},
+	{ErrMFARequired, CodeMFARequired, http.StatusForbidden},
+	{ErrAccessDenied, CodeAccessDenied, http.StatusForbidden},
+	{ErrBruteForceDisabled, CodeBruteForceDisabled, http.StatusNotFound},
+	{ErrIPBanned, CodeIPBanned, http.StatusTooManyRequests},
+	{ErrInvalidIPAddress, CodeInvalidIPAddress, http.StatusBadRequest},
+}
+
+// ErrorCode returns the stable code for an AuthKit error, or CodeInternalError for unknown errors
+func ErrorCode(err error) string {
+	var authErr *AuthError
+	if errors.As(err, &authErr) && authErr.Code != "" {
+		return authErr.Code
+	}
+	for _, entry := range errorCodes {
+		if errors.Is(err, entry.err) {
+			return entry.code
+		}
+	}
+	return CodeInternalError
+}
+
+// DefaultLocale is the locale used when no better match is available
+const DefaultLocale = "en"
+
+// LocaleContextKey is the Gin/Fiber context key that overrides the response locale for a request
+const LocaleContextKey = "authkit_locale"
+
+// builtinMessages holds the shipped translations
+var builtinMessages = map[string]map[string]string{
+	"en": {
+		CodeUserNotFound:               "User not found",
+		CodeInvalidPassword:            "Invalid password",
+		CodeInvalidCredentials:         "Invalid email or password",
+		CodeUserAlreadyExists:          "User already exists",
+		CodeInvalidToken:               "Invalid token",
+		CodeTokenExpired:               "Token expired",
+		CodeUnauthorized:               "Unauthorized",
+		CodeInsufficientRole:           "Insufficient role permissions",
+		CodeInvalidConfig:              "Invalid configuration",
+		CodeInvalidSubject:             "Invalid token subject",
+		CodeAccountPendingDeletion:     "Account is pending deletion",
+		CodeAccountNotPendingDeletion:  "Account is not pending deletion",
+		CodeInvalidNonce:               "Invalid nonce",
+		CodeNonceExpired:               "Nonce expired",
+		CodeTokenRevoked:               "Token revoked",
+		CodeAccountLocked:              "Account is temporarily locked after too many login attempts",
+		CodeRateLimited:                "Too many requests, please try again later",
+		CodeServerBusy:                 "The server is busy, please try again later",
+		CodeWeakPassword:               "Password does not meet the password policy",
+		CodeEmailNotVerified:           "Email address has not been verified",
+		CodeInvalidMFACode:             "Invalid or expired authentication code",
+		CodeMFANotEnabled:              "Two-factor authentication is not enabled",
+		CodeMFAAlreadyEnabled:          "Two-factor authentication is already enabled",
+		CodeInvalidClientCredentials:   "Invalid client ID or secret",
+		CodeServiceAccountNotFound:     "Service account not found",
+		CodeSessionNotFound:            "Session not found",
+		CodeInvalidCSRFToken:           "Missing or invalid CSRF token",
+		CodeInvalidEmail:               "Invalid email address",
+		CodeRoleNotFound:               "Role not found",
+		CodeInvalidRole:                "Invalid role",
+		CodeUserDisabled:               "Account is disabled",
+		CodeUserNotDeleted:             "User is not deleted",
+		CodeInvalidSearchQuery:         "Search query is required",
+		CodeBatchTooLarge:              "Too many items in one batch",
+		CodePasswordBreached:           "This password has appeared in a data breach, please choose another one",
+		CodeBreachCheckUnavailable:     "The password could not be checked, please try again later",
+		CodeRoleNotAllowed:             "This role cannot be requested at registration",
+		CodeRestrictedField:            "This field cannot be changed on your own profile",
+		CodeMissingAuthorization:       "Authorization header required",
+		CodeInvalidAuthorizationFormat: "Invalid authorization header format",
+		CodeNotAuthenticated:           "User not authenticated",
+		CodeInsufficientPermissions:    "Insufficient permissions",
+		CodeInvalidPermissionsFormat:   "Invalid permissions format",
+		CodeTenantMismatch:             "This resource belongs to another tenant",
+		CodeTenantRequired:             "A tenant is required for this request",
+		CodePasswordChangeRequired:     "You must change your password before continuing",
+		CodeSessionExpired:             "Your session has ended, please log in again",
+		CodeSessionIdle:                "Your session timed out due to inactivity, please log in again",
+		CodeIdentityNotLinked:          "An account with this email already exists, log in to link this provider",
+		CodeIdentityAlreadyLinked:      "This identity is already linked to an account",
+		CodeIdentityNotFound:           "Identity not found",
+		CodeUnknownIdentityProvider:    "Unknown identity provider",
+		CodeIdentityProviderFailed:     "Signing in with the identity provider failed",
+		CodeOIDCDisabled:               "OpenID Connect is not enabled",
+		CodeMFARequired:                "Two-factor authentication is required, which this login method does not support",
+		CodeAccessDenied:               "You are not allowed to perform this action on this resource",
+		CodeBruteForceDisabled:         "Brute-force protection is not enabled",
+		CodeIPBanned:                   "Too many failed attempts from your network, please try again later",
+		CodeInvalidIPAddress:           "Invalid IP address",
+		CodeInvalidRequest:             "Invalid request",
+		CodeInternalError:              "Internal server error",
+		messageAccountRecoveryHint:     "This account is scheduled for deletion. Send your credentials to the account recovery endpoint to restore it.",
+	},
+	"fr": {
+		CodeUserNotFound:               "Utilisateur introuvable",
+		CodeInvalidPassword:            "Mot de passe invalide",
+		CodeInvalidCredentials:         "Adresse e-mail ou mot de passe invalide",
+		CodeUserAlreadyExists:          "L'utilisateur existe déjà",
+		CodeInvalidToken:               "Jeton invalide",
+		CodeTokenExpired:               "Jeton expiré",
+		CodeUnauthorized:               "Non autorisé",
+		CodeInsufficientRole:           "Rôle insuffisant",
+		CodeInvalidConfig:              "Configuration invalide",
+		CodeInvalidSubject:             "Sujet du jeton invalide",
+		CodeAccountPendingDeletion:     "Le compte est en attente de suppression",
+		CodeAccountNotPendingDeletion:  "Le compte n'est pas en attente de suppression",
+		CodeInvalidNonce:               "Nonce invalide",
+		CodeNonceExpired:               "Nonce expiré",
+		CodeTokenRevoked:               "Jeton révoqué",
+		CodeAccountLocked:              "Compte temporairement verrouillé après trop de tentatives de connexion",
+		CodeRateLimited:                "Trop de requêtes, veuillez réessayer plus tard",
+		CodeServerBusy:                 "Le serveur est occupé, veuillez réessayer plus tard",
+		CodeWeakPassword:               "Le mot de passe ne respecte pas la politique de mots de passe",
+		CodeEmailNotVerified:           "L'adresse e-mail n'a pas été vérifiée",
+		CodeInvalidMFACode:             "Code d'authentification invalide ou expiré",
+		CodeMFANotEnabled:              "L'authentification à deux facteurs n'est pas activée",
+		CodeMFAAlreadyEnabled:          "L'authentification à deux facteurs est déjà activée",
+		CodeInvalidClientCredentials:   "Identifiant client ou secret invalide",
+		CodeServiceAccountNotFound:     "Compte de service introuvable",
+		CodeSessionNotFound:            "Session introuvable",
+		CodeInvalidCSRFToken:           "Jeton CSRF manquant ou invalide",
+		CodeInvalidEmail:               "Adresse e-mail invalide",
+		CodeRoleNotFound:               "Rôle introuvable",
+		CodeInvalidRole:                "Rôle invalide",
+		CodeUserDisabled:               "Compte désactivé",
+		CodeUserNotDeleted:             "L'utilisateur n'est pas supprimé",
+		CodeInvalidSearchQuery:         "La requête de recherche est obligatoire",
+		CodeBatchTooLarge:              "Trop d'éléments dans un même lot",
+		CodePasswordBreached:           "Ce mot de passe figure dans une fuite de données, veuillez en choisir un autre",
+		CodeBreachCheckUnavailable:     "Le mot de passe n'a pas pu être vérifié, veuillez réessayer plus tard",
+		CodeRoleNotAllowed:             "Ce rôle ne peut pas être demandé à l'inscription",
+		CodeRestrictedField:            "Ce champ ne peut pas être modifié sur votre propre profil",
+		CodeMissingAuthorization:       "En-tête d'autorisation requis",
+		CodeInvalidAuthorizationFormat: "Format de l'en-tête d'autorisation invalide",
+		CodeNotAuthenticated:           "Utilisateur non authentifié",
+		CodeInsufficientPermissions:    "Permissions insuffisantes",
+		CodeInvalidPermissionsFormat:   "Format des permissions invalide",
+		CodeTenantMismatch:             "Cette ressource appartient à un autre locataire",
+		CodeTenantRequired:             "Un locataire est requis pour cette requête",
+		CodePasswordChangeRequired:     "Vous devez changer votre mot de passe avant de continuer",
+		CodeSessionExpired:             "Votre session est terminée, veuillez vous reconnecter",
+		CodeSessionIdle:                "Votre session a expiré pour cause d'inactivité, veuillez vous reconnecter",
+		CodeIdentityNotLinked:          "Un compte existe déjà avec cette adresse email, connectez-vous pour lier ce fournisseur",
+		CodeIdentityAlreadyLinked:      "Cette identité est déjà liée à un compte",
+		CodeIdentityNotFound:           "Identité introuvable",
+		CodeUnknownIdentityProvider:    "Fournisseur d'identité inconnu",
+		CodeIdentityProviderFailed:     "La connexion avec le fournisseur d'identité a échoué",
+		CodeOIDCDisabled:               "OpenID Connect n'est pas activé",
+		CodeMFARequired:                "L'authentification à deux facteurs est requise, mais cette méthode de connexion ne la prend pas en charge",
+		CodeAccessDenied:               "Vous n'êtes pas autorisé à effectuer cette action sur cette ressource",
+		CodeBruteForceDisabled:         "La protection contre la force brute n'est pas activée",
+		CodeIPBanned:                   "Trop de tentatives échouées depuis votre réseau, veuillez réessayer plus tard",
+		CodeInvalidIPAddress:           "Adresse IP invalide",
+		CodeInvalidRequest:             "Requête invalide",
+		CodeInternalError:              "Erreur interne du serveur",
+		messageAccountRecoveryHint:     "Ce compte est programmé pour suppression. Envoyez vos identifiants au point de récupération de compte pour le restaurer.",
+	},
+	"de": {
+		CodeUserNotFound:               "Benutzer nicht gefunden",
+		CodeInvalidPassword:            "Ungültiges Passwort",
+		CodeInvalidCredentials:         "Ungültige E-Mail-Adresse oder ungültiges Passwort",
+		CodeUserAlreadyExists:          "Benutzer existiert bereits",
+		CodeInvalidToken:               "Ungültiges Token",
+		CodeTokenExpired:               "Token abgelaufen",
+		CodeUnauthorized:               "Nicht autorisiert",
+		CodeInsufficientRole:           "Unzureichende Rolle",
+		CodeInvalidConfig:              "Ungültige Konfiguration",
+		CodeInvalidSubject:             "Ungültiger Token-Betreff",
+		CodeAccountPendingDeletion:     "Das Konto ist zur Löschung vorgemerkt",
+		CodeAccountNotPendingDeletion:  "Das Konto ist nicht zur Löschung vorgemerkt",
+		CodeInvalidNonce:               "Ungültige Nonce",
+		CodeNonceExpired:               "Nonce abgelaufen",
+		CodeTokenRevoked:               "Token widerrufen",
+		CodeAccountLocked:              "Konto nach zu vielen Anmeldeversuchen vorübergehend gesperrt",
+		CodeRateLimited:                "Zu viele Anfragen, bitte versuchen Sie es später erneut",
+		CodeServerBusy:                 "Der Server ist ausgelastet, bitte versuchen Sie es später erneut",
+		CodeWeakPassword:               "Das Passwort erfüllt nicht die Passwortrichtlinie",
+		CodeEmailNotVerified:           "Die E-Mail-Adresse wurde noch nicht bestätigt",
+		CodeInvalidMFACode:             "Ungültiger oder abgelaufener Authentifizierungscode",
+		CodeMFANotEnabled:              "Die Zwei-Faktor-Authentifizierung ist nicht aktiviert",
+		CodeMFAAlreadyEnabled:          "Die Zwei-Faktor-Authentifizierung ist bereits aktiviert",
+		CodeInvalidClientCredentials:   "Ungültige Client-ID oder ungültiges Secret",
+		CodeServiceAccountNotFound:     "Dienstkonto nicht gefunden",
+		CodeSessionNotFound:            "Sitzung nicht gefunden",
+		CodeInvalidCSRFToken:           "Fehlendes oder ungültiges CSRF-Token",
+		CodeInvalidEmail:               "Ungültige E-Mail-Adresse",
+		CodeRoleNotFound:               "Rolle nicht gefunden",
+		CodeInvalidRole:                "Ungültige Rolle",
+		CodeUserDisabled:               "Konto ist deaktiviert",
+		CodeUserNotDeleted:             "Benutzer ist nicht gelöscht",
+		CodeInvalidSearchQuery:         "Suchbegriff ist erforderlich",
+		CodeBatchTooLarge:              "Zu viele Einträge in einem Stapel",
+		CodePasswordBreached:           "Dieses Passwort ist in einem Datenleck aufgetaucht, bitte wählen Sie ein anderes",
+		CodeBreachCheckUnavailable:     "Das Passwort konnte nicht geprüft werden, bitte versuchen Sie es später erneut",
+		CodeRoleNotAllowed:             "Diese Rolle kann bei der Registrierung nicht angefordert werden",
+		CodeRestrictedField:            "Dieses Feld kann im eigenen Profil nicht geändert werden",
+		CodeMissingAuthorization:       "Authorization-Header erforderlich",
+		CodeInvalidAuthorizationFormat: "Ungültiges Format des Authorization-Headers",
+		CodeNotAuthenticated:           "Benutzer nicht authentifiziert",
+		CodeInsufficientPermissions:    "Unzureichende Berechtigungen",
+		CodeInvalidPermissionsFormat:   "Ungültiges Berechtigungsformat",
+		CodeTenantMismatch:             "Diese Ressource gehört zu einem anderen Mandanten",
+		CodeTenantRequired:             "Für diese Anfrage ist ein Mandant erforderlich",
+		CodePasswordChangeRequired:     "Sie müssen Ihr Passwort ändern, bevor Sie fortfahren",
+		CodeSessionExpired:             "Ihre Sitzung ist abgelaufen, bitte melden Sie sich erneut an",
+		CodeSessionIdle:                "Ihre Sitzung wurde wegen Inaktivität beendet, bitte melden Sie sich erneut an",
+		CodeIdentityNotLinked:          "Für diese E-Mail-Adresse existiert bereits ein Konto, melden Sie sich an, um diesen Anbieter zu verknüpfen",
+		CodeIdentityAlreadyLinked:      "Diese Identität ist bereits mit einem Konto verknüpft",
+		CodeIdentityNotFound:           "Identität nicht gefunden",
+		CodeUnknownIdentityProvider:    "Unbekannter Identitätsanbieter",
+		CodeIdentityProviderFailed:     "Die Anmeldung beim Identitätsanbieter ist fehlgeschlagen",
+		CodeOIDCDisabled:               "OpenID Connect ist nicht aktiviert",
+		CodeMFARequired:                "Die Zwei-Faktor-Authentifizierung ist erforderlich, wird von dieser Anmeldemethode aber nicht unterstützt",
+		CodeAccessDenied:               "Sie dürfen diese Aktion für diese Ressource nicht ausführen",
+		CodeBruteForceDisabled:         "Der Schutz vor Brute-Force-Angriffen ist nicht aktiviert",
+		CodeIPBanned:                   "Zu viele fehlgeschlagene Versuche aus Ihrem Netzwerk, bitte versuchen Sie es später erneut",
+		CodeInvalidIPAddress:           "Ungültige IP-Adresse",
+		CodeInvalidRequest:             "Ungültige Anfrage",
+		CodeInternalError:              "Interner Serverfehler",
+		messageAccountRecoveryHint:     "Dieses Konto ist zur Löschung vorgemerkt. Senden Sie Ihre Zugangsdaten an den Kontowiederherstellungs-Endpunkt, um es wiederherzustellen.",
+	},
+}
+
+// MessageCatalog holds localized error messages keyed by locale and error code
+type MessageCatalog struct {
+	messages  map[string]map[string]string
+	mutex     sync.RWMutex
+	fallbacks atomic.Uint64
+}
+
+// NewMessageCatalog creates a catalog preloaded with the built-in en/fr/de messages
+func NewMessageCatalog() *MessageCatalog {
+	catalog := &MessageCatalog{messages: make(map[string]map[string]string)}
+	for locale, messages := range builtinMessages {
+		catalog.Register(locale, messages)
+	}
+	return catalog
+}
+
+// Register adds or overrides messages for a locale
+func (m *MessageCatalog) Register(locale string, messages map[string]string) {
+	locale = normalizeLocale(locale)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.messages[locale] == nil {
+		m.messages[locale] = make(map[string]string, len(messages))
+	}
+	for code, message := range messages {
+		m.messages[locale][code] = message
+	}
+}
+
+// HasLocale reports whether any messages are registered for locale
+func (m *MessageCatalog) HasLocale(locale string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.messages[normalizeLocale(locale)]
+	return exists
+}
+
+// Message returns the message for code in locale, falling back to English
+// (and counting the fallback) when the locale doesn't define it
+func (m *MessageCatalog) Message(locale, code string) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if message, ok := m.messages[normalizeLocale(locale)][code]; ok {
+		return message
+	}
+
+	m.fallbacks.Add(1)
+	if message, ok := m.messages[DefaultLocale][code]; ok {
+		return message
+	}
+	return code
+}
+
+// Fallbacks returns how many lookups fell back to English
+func (m *MessageCatalog) Fallbacks() uint64 {
+	return m.fallbacks.Load()
+}
+
+// Messages returns the AuthKit's message catalog, e.g. to register more locales
+func (a *AuthKit) Messages() *MessageCatalog {
+	return a.config.Messages
+}
+
+// resolveLocale picks the response locale from an explicit override or an
+// Accept-Language header, using the catalog's registered locales
+func (a *AuthKit) resolveLocale(override, acceptLanguage string) string {
+	if override != "" && a.config.Messages.HasLocale(override) {
+		return normalizeLocale(override)
+	}
+
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if a.config.Messages.HasLocale(tag) {
+			return normalizeLocale(tag)
+		}
+		if primary, _, found := strings.Cut(tag, "-"); found && a.config.Messages.HasLocale(primary) {
+			return normalizeLocale(primary)
+		}
+	}
+
+	return a.config.DefaultLocale
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language header ordered by preference
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// normalizeLocale lower-cases a locale tag and uses "-" as the separator
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
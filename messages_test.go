@@ -0,0 +1,134 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLocalizedMiddlewareErrors(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	tests := []struct {
+		acceptLanguage string
+		expected       string
+	}{
+		{"", "Authorization header required"},
+		{"fr-FR,fr;q=0.9,en;q=0.8", "En-tête d'autorisation requis"},
+		{"de", "Authorization-Header erforderlich"},
+		{"ja, de;q=0.5", "Authorization-Header erforderlich"},
+		{"ja", "Authorization header required"},
+	}
+
+	for _, tt := range tests {
+		t.Run("Gin/"+tt.acceptLanguage, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/protected", auth.GinMiddleware())
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var body map[string]interface{}
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if errorField(body, "message") != tt.expected {
+				t.Errorf("Expected message %q, got %v", tt.expected, errorField(body, "message"))
+			}
+			if errorField(body, "code") != CodeMissingAuthorization {
+				t.Errorf("Expected code %q to stay unchanged, got %v", CodeMissingAuthorization, errorField(body, "code"))
+			}
+		})
+
+		t.Run("Fiber/"+tt.acceptLanguage, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/protected", auth.FiberMiddleware())
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Fiber request failed: %v", err)
+			}
+
+			var body map[string]interface{}
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if errorField(body, "message") != tt.expected {
+				t.Errorf("Expected message %q, got %v", tt.expected, errorField(body, "message"))
+			}
+			if errorField(body, "code") != CodeMissingAuthorization {
+				t.Errorf("Expected code %q to stay unchanged, got %v", CodeMissingAuthorization, errorField(body, "code"))
+			}
+		})
+	}
+}
+
+func TestLocaleOverride(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	r := gin.New()
+	r.GET("/protected", func(c *gin.Context) {
+		c.Set(LocaleContextKey, "de")
+	}, auth.GinMiddleware())
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Accept-Language", "fr")
+	req.Header.Set("Authorization", "Bearer garbage")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if errorField(body, "message") != "Ungültiges Token" || errorField(body, "code") != CodeInvalidToken {
+		t.Errorf("Expected German invalid token message, got %v", body)
+	}
+}
+
+func TestMessageCatalogFallback(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	auth.Messages().Register("es", map[string]string{
+		CodeInvalidToken: "Token inválido",
+	})
+
+	if got := auth.Messages().Message("es", CodeInvalidToken); got != "Token inválido" {
+		t.Errorf("Expected registered Spanish message, got %q", got)
+	}
+	if auth.Messages().Fallbacks() != 0 {
+		t.Errorf("Expected no fallbacks yet, got %d", auth.Messages().Fallbacks())
+	}
+
+	if got := auth.Messages().Message("es", CodeTokenExpired); got != "Token expired" {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+	if got := auth.Messages().Message("es", "unknown_code"); got != "unknown_code" {
+		t.Errorf("Expected code when no message exists, got %q", got)
+	}
+	if auth.Messages().Fallbacks() != 2 {
+		t.Errorf("Expected 2 fallbacks, got %d", auth.Messages().Fallbacks())
+	}
+
+	if got := auth.resolveLocale("", "es-MX, en;q=0.5"); got != "es" {
+		t.Errorf("Expected es-MX to resolve to es, got %q", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if code := ErrorCode(fmt.Errorf("login: %w", ErrUserNotFound)); code != CodeUserNotFound {
+		t.Errorf("Expected %q for wrapped error, got %q", CodeUserNotFound, code)
+	}
+	if code := ErrorCode(errors.New("boom")); code != CodeInternalError {
+		t.Errorf("Expected %q for unknown error, got %q", CodeInternalError, code)
+	}
+
+	// Every code has a message in every built-in locale
+	for locale, messages := range builtinMessages {
+		for code := range builtinMessages[DefaultLocale] {
+			if _, ok := messages[code]; !ok {
+				t.Errorf("Locale %q is missing a message for %q", locale, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package authkit
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics receives counts and latencies of auth operations, see
+// NewPrometheusMetrics. Results and reasons are "success" or an error code,
+// such as "invalid_credentials", so label cardinality stays bounded.
+type Metrics interface {
+	// LoginAttempt counts a LoginUser or CompleteMFALogin call. The result is
+	// "mfa_required" when LoginUser stops at the MFA challenge.
+	LoginAttempt(result string)
+	// Registration counts a registered user
+	Registration()
+	// TokenValidation counts a ValidateToken call and how long it took
+	TokenValidation(result string, duration time.Duration)
+	// Refresh counts a successful RefreshToken call
+	Refresh()
+	// MiddlewareRejection counts a request the middleware turned away
+	MiddlewareRejection(reason string)
+}
+
+// HashMetrics is optionally implemented by a Metrics to observe the password
+// hashing limiter, see Config.MaxConcurrentHashes. PrometheusMetrics
+// implements it.
+type HashMetrics interface {
+	// HashWait reports how long a password hash waited for a slot. The result
+	// is "success", "server_busy" when the queue was full or "canceled" when
+	// the context was done first.
+	HashWait(result string, wait time.Duration)
+}
+
+// Metric results besides error codes
+const (
+	MetricResultSuccess     = "success"
+	MetricResultMFARequired = "mfa_required"
+	MetricResultCanceled    = "canceled"
+)
+
+// outcome is the result label or attribute for err
+func outcome(err error) string {
+	if err == nil {
+		return MetricResultSuccess
+	}
+	return ErrorCode(err)
+}
+
+// nopMetrics is the default Metrics, dropping everything
+type nopMetrics struct{}
+
+func (nopMetrics) LoginAttempt(string)                   {}
+func (nopMetrics) Registration()                         {}
+func (nopMetrics) TokenValidation(string, time.Duration) {}
+func (nopMetrics) Refresh()                              {}
+func (nopMetrics) MiddlewareRejection(string)            {}
+
+// metricsEnabled reports whether Config.Metrics records anything, so callers
+// can skip timing operations otherwise
+func (a *AuthKit) metricsEnabled() bool {
+	_, nop := a.config.Metrics.(nopMetrics)
+	return !nop
+}
+
+// PrometheusMetrics is a Metrics exporting Prometheus collectors, all
+// prefixed with "authkit_"
+type PrometheusMetrics struct {
+	logins                  *prometheus.CounterVec
+	registrations           prometheus.Counter
+	tokenValidations        *prometheus.CounterVec
+	tokenValidationDuration prometheus.Histogram
+	refreshes               prometheus.Counter
+	middlewareRejections    *prometheus.CounterVec
+	hashWait                *prometheus.HistogramVec
+}
+
+// NewPrometheusMetrics creates the collectors and registers them on reg,
+// failing if any of them is already registered:
+//
+//	authkit_logins_total{result}
+//	authkit_registrations_total
+//	authkit_token_validations_total{result}
+//	authkit_token_validation_duration_seconds
+//	authkit_refreshes_total
+//	authkit_middleware_rejections_total{reason}
+//	authkit_hash_wait_seconds{result}
+func NewPrometheusMetrics(reg prometheus.Registerer) (*PrometheusMetrics, error) {
+	const namespace = "authkit"
+	m := &PrometheusMetrics{
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Registered users.",
+		}),
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validations_total",
+			Help:      "Token validations by result.",
+		}, []string{"result"}),
+		tokenValidationDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "token_validation_duration_seconds",
+			Help:      "Time taken to validate a token.",
+			Buckets:   []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .1},
+		}),
+		refreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refreshes_total",
+			Help:      "Successful token refreshes.",
+		}),
+		middlewareRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "middleware_rejections_total",
+			Help:      "Requests rejected by the middleware by reason.",
+		}, []string{"reason"}),
+		hashWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "hash_wait_seconds",
+			Help:      "Time password hashes waited for a slot, with Config.MaxConcurrentHashes set.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"result"}),
+	}
+
+	collectors := []prometheus.Collector{m.logins, m.registrations, m.tokenValidations,
+		m.tokenValidationDuration, m.refreshes, m.middlewareRejections, m.hashWait}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// LoginAttempt implements Metrics
+func (m *PrometheusMetrics) LoginAttempt(result string) {
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// Registration implements Metrics
+func (m *PrometheusMetrics) Registration() {
+	m.registrations.Inc()
+}
+
+// TokenValidation implements Metrics
+func (m *PrometheusMetrics) TokenValidation(result string, duration time.Duration) {
+	m.tokenValidations.WithLabelValues(result).Inc()
+	m.tokenValidationDuration.Observe(duration.Seconds())
+}
+
+// Refresh implements Metrics
+func (m *PrometheusMetrics) Refresh() {
+	m.refreshes.Inc()
+}
+
+// MiddlewareRejection implements Metrics
+func (m *PrometheusMetrics) MiddlewareRejection(reason string) {
+	m.middlewareRejections.WithLabelValues(reason).Inc()
+}
+
+// HashWait implements HashMetrics
+func (m *PrometheusMetrics) HashWait(result string, wait time.Duration) {
+	m.hashWait.WithLabelValues(result).Observe(wait.Seconds())
+}
@@ -0,0 +1,100 @@
+package authkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewPrometheusMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newTestKit(t, Config{Metrics: metrics})
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "metrics@example.com")
+	_, _ = auth.LoginUser("metrics@example.com", "wrong-password")
+	_, _ = auth.LoginUser("nobody@example.com", "password123")
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = auth.ValidateToken(tokens.AccessToken)
+	_, _ = auth.ValidateToken("not-a-token")
+
+	r := gin.New()
+	r.GET("/protected", auth.GinMiddleware(), func(c *gin.Context) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/protected", nil))
+	app := fiber.New()
+	app.Get("/protected", auth.FiberMiddleware(), func(c *fiber.Ctx) error { return nil })
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/protected", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	counters := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{"successful logins", metrics.logins.WithLabelValues(MetricResultSuccess), 1},
+		{"failed logins", metrics.logins.WithLabelValues(CodeInvalidCredentials), 2},
+		{"registrations", metrics.registrations, 1},
+		{"refreshes", metrics.refreshes, 1},
+		{"valid tokens", metrics.tokenValidations.WithLabelValues(MetricResultSuccess), 1},
+		{"invalid tokens", metrics.tokenValidations.WithLabelValues(CodeInvalidToken), 1},
+		{"rejections", metrics.middlewareRejections.WithLabelValues(CodeMissingAuthorization), 2},
+	}
+	for _, c := range counters {
+		if got := testutil.ToFloat64(c.collector); got != c.want {
+			t.Errorf("Expected %v %s, got %v", c.want, c.name, got)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.tokenValidationDuration); n != 1 {
+		t.Errorf("Expected the validation duration histogram, got %d metrics", n)
+	}
+	if n, err := testutil.GatherAndCount(reg); err != nil || n == 0 {
+		t.Errorf("Expected the collectors on the registry, got %d, %v", n, err)
+	}
+
+	if _, err := NewPrometheusMetrics(reg); err == nil {
+		t.Error("Expected registering the collectors twice to fail")
+	}
+}
+
+func TestPrometheusMetricsMFALogin(t *testing.T) {
+	metrics, err := NewPrometheusMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newTestKit(t, Config{Metrics: metrics})
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "mfa-metrics@example.com")
+	enrollTestTOTP(t, auth, tokens.User.ID)
+	if _, err := auth.LoginUser("mfa-metrics@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.logins.WithLabelValues(MetricResultMFARequired)); got != 1 {
+		t.Errorf("Expected one login stopped at the MFA challenge, got %v", got)
+	}
+}
+
+func TestMetricsDefaultToNop(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if auth.metricsEnabled() {
+		t.Error("Expected no metrics by default")
+	}
+	tokens := loginTestUser(t, auth, "nop@example.com")
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the token to validate, got %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+package authkit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TOTP parameters (RFC 6238 defaults, understood by every authenticator app)
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20
+	// totpSkew is how many steps either side of the current one are accepted
+	totpSkew = 1
+)
+
+// defaultMFATokenExpiry is Config.MFATokenExpiry when unset
+const defaultMFATokenExpiry = 5 * time.Minute
+
+// mfaAudienceSuffix makes MFA tokens unusable as access or refresh tokens
+const mfaAudienceSuffix = "-mfa"
+
+// passwordAMR is the amr value (RFC 8176) recorded for a password login
+var passwordAMR = []string{"pwd"}
+
+// mfaClaims are the claims carried by the intermediate token LoginUser returns
+// for users with MFA enabled
+type mfaClaims struct {
+	TokenVersion int      `json:"token_version,omitempty"`
+	AMR          []string `json:"amr,omitempty"` // Methods used for the first factor
+	// AccessExpiry and RefreshExpiry are the token lifetimes chosen at
+	// login, in seconds
+	AccessExpiry  int64 `json:"access_expiry,omitempty"`
+	RefreshExpiry int64 `json:"refresh_expiry,omitempty"`
+	// Scope is LoginOptions.Scope, null when unrestricted
+	Scope []string `json:"scope"`
+	// Nonce is LoginOptions.Nonce
+	Nonce string `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// EnrollTOTP starts TOTP enrollment, returning the secret and an otpauth:// URL
+// to show as a QR code. MFA isn't enforced until ConfirmTOTP succeeds;
+// enrolling again before that replaces the secret.
+func (a *AuthKit) EnrollTOTP(userID string) (secret, otpauthURL string, err error) {
+	a.debugCheck()
+
+	raw := make([]byte, totpSecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	encrypted, err := a.encryptSecret(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return "", "", ErrUserNotFound
+	}
+	if stored.TOTPEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	user := cloneUser(stored)
+	user.TOTPSecret = encrypted
+	user.TOTPLastStep = 0
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+
+	secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+	return secret, a.otpauthURL(user.Email, secret), nil
+}
+
+// otpauthURL builds the key URI authenticator apps import
+func (a *AuthKit) otpauthURL(email, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", a.config.Issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(a.config.Issuer + ":" + email)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ConfirmTOTP activates TOTP for the user once they prove their authenticator
+// produces valid codes. From then on LoginUser requires a second factor.
+func (a *AuthKit) ConfirmTOTP(userID, code string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	if stored.TOTPEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	if stored.TOTPSecret == "" {
+		return ErrMFANotEnabled
+	}
+
+	user := cloneUser(stored)
+	ok, err := a.verifyTOTP(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	user.TOTPEnabled = true
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	return nil
+}
+
+// DisableTOTP turns MFA off for the user and forgets their secret and
+// recovery codes, for example after they lose their authenticator
+func (a *AuthKit) DisableTOTP(userID string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user := cloneUser(stored)
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	return nil
+}
+
+// mfaToken issues the intermediate token exchanged by CompleteMFALogin; amr
+// lists the methods the user has already authenticated with, and the token
+// lifetimes, scope and ID token nonce pass on to the tokens issued for it
+func (a *AuthKit) mfaToken(user *User, amr []string, lifetimes tokenLifetimes, scope []string, nonce string) (*TokenResponse, error) {
+	subject, err := a.subjectFor(user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+	claims := &mfaClaims{
+		TokenVersion:  user.TokenVersion,
+		AMR:           amr,
+		AccessExpiry:  int64(lifetimes.access.Seconds()),
+		RefreshExpiry: int64(lifetimes.refresh.Seconds()),
+		Scope:         scope,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.config.MFATokenExpiry)),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    a.config.Issuer,
+			Audience:  []string{a.mfaAudience()},
+		},
+	}
+
+	token, err := a.signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(a.config.MFATokenExpiry.Seconds()),
+	}, nil
+}
+
+// mfaAudience is the aud value of MFA tokens
+func (a *AuthKit) mfaAudience() string {
+	return a.config.Issuer + mfaAudienceSuffix
+}
+
+// CompleteMFALogin exchanges the MFA token returned by LoginUser and a current
+// TOTP code for the user's tokens, whose amr claim records that MFA was used.
+// An unused recovery code is accepted in place of the TOTP code and consumed.
+// Failed codes count towards the login lockout. The optional LoginContext
+// describes the client in the user's login history.
+func (a *AuthKit) CompleteMFALogin(mfaToken, totpCode string, lc ...LoginContext) (*TokenResponse, error) {
+	return a.CompleteMFALoginCtx(context.Background(), mfaToken, totpCode, lc...)
+}
+
+// CompleteMFALoginCtx is CompleteMFALogin with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) CompleteMFALoginCtx(ctx context.Context, mfaToken, totpCode string, lc ...LoginContext) (*TokenResponse, error) {
+	a.debugCheck()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	claims := &mfaClaims{}
+	_, err := jwt.ParseWithClaims(mfaToken, claims, a.keyFunc,
+		jwt.WithIssuer(a.config.Issuer), jwt.WithAudience(a.mfaAudience()), jwt.WithTimeFunc(a.now))
+	if err != nil {
+		return nil, tokenError(err)
+	}
+	if claims.ID == "" || a.IsTokenRevoked(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+
+	user, err := a.resolveSubject(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrInvalidToken
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	tokens, err := a.completeMFALogin(user, claims, totpCode)
+	a.recordLogin(ctx, user, lc, tokens, err)
+	return tokens, err
+}
+
+// completeMFALogin checks the second factor for a valid MFA token
+func (a *AuthKit) completeMFALogin(user *User, claims *mfaClaims, totpCode string) (*TokenResponse, error) {
+	if a.lockoutEnabled() {
+		if _, err := a.recordAttempt(user.ID, a.now(), a.lockoutPolicy()); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	amr := append([]string{}, claims.AMR...)
+	if isRecoveryCode(totpCode) {
+		amr = append(amr, "mfa")
+		err = a.useRecoveryCode(user.ID, totpCode)
+	} else {
+		amr = append(amr, "otp", "mfa")
+		err = a.checkMFACode(user.ID, totpCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if a.lockoutEnabled() {
+		if err := a.config.LockoutStore.Reset(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The MFA token is single-use
+	if err := a.revokeJTI(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	user, err = a.GetUserByID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	lifetimes := a.clampLifetimes(tokenLifetimes{
+		access:  time.Duration(claims.AccessExpiry) * time.Second,
+		refresh: time.Duration(claims.RefreshExpiry) * time.Second,
+	})
+	tokens, err := a.tokenPair(user, amr, lifetimes, claims.Scope, claims.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	a.sendNewLoginAlert(tokens.User)
+	return tokens, nil
+}
+
+// checkMFACode verifies a second factor for a user with MFA enabled
+func (a *AuthKit) checkMFACode(userID, code string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	if !stored.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+
+	user := cloneUser(stored)
+	ok, err := a.verifyTOTP(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	a.users.put(user)
+	return nil
+}
+
+// verifyTOTP checks code against the user's secret, accepting one step of
+// clock drift either way. A step can only be used once, so a code can't be
+// replayed. It records the step on user, a copy the caller holding the write
+// lock stores on success.
+func (a *AuthKit) verifyTOTP(user *User, code string) (bool, error) {
+	secret, err := a.decryptSecret(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+
+	current := a.now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			user.TOTPLastStep = step
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// mfaErrorStatus is the HTTP status the bundled MFA handlers respond with for err
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired), errors.Is(err, ErrTokenRevoked):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrAccountLocked):
+		return http.StatusLocked
+	case errors.Is(err, ErrUserDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, ErrMFANotEnabled), errors.Is(err, ErrMFAAlreadyEnabled):
+		return http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// encryptionKey returns the AES-256 key secrets on users are encrypted with.
+// It is never derived from JWTSecret, so rotating the signing secret can't
+// make stored secrets unreadable.
+func (a *AuthKit) encryptionKey() ([]byte, error) {
+	if a.config.EncryptionKey == "" {
+		return nil, fmt.Errorf("%w: EncryptionKey is required to store MFA secrets", ErrInvalidConfig)
+	}
+	sum := sha256.Sum256([]byte("authkit-encryption:" + a.config.EncryptionKey))
+	return sum[:], nil
+}
+
+// encryptSecret seals plaintext with AES-GCM, returning base64(nonce || ciphertext)
+func (a *AuthKit) encryptSecret(plaintext []byte) (string, error) {
+	gcm, err := a.secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// decryptSecret opens a value produced by encryptSecret
+func (a *AuthKit) decryptSecret(encoded string) ([]byte, error) {
+	gcm, err := a.secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("decrypting secret: malformed value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret: %w", err)
+	}
+	return plaintext, nil
+}
+
+// secretCipher returns the AES-GCM cipher for encryptSecret and decryptSecret
+func (a *AuthKit) secretCipher() (cipher.AEAD, error) {
+	key, err := a.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,296 @@
+package authkit
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// enrollTestTOTP enrolls and confirms TOTP for the user, returning the raw secret
+func enrollTestTOTP(t *testing.T, auth *AuthKit, userID string) []byte {
+	t.Helper()
+	secret, _, err := auth.EnrollTOTP(userID)
+	if err != nil {
+		t.Fatalf("Failed to enroll TOTP: %v", err)
+	}
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("Expected a base32 secret, got %q", secret)
+	}
+	if err := auth.ConfirmTOTP(userID, totpCode(raw, auth.now().Unix()/totpPeriod)); err != nil {
+		t.Fatalf("Failed to confirm TOTP: %v", err)
+	}
+	return raw
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		if got := totpCode(secret, unix/totpPeriod); got != want {
+			t.Errorf("At %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Issuer: "Example App", Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "mfa@example.com", Password: "password123", Name: "MFA"})
+
+	if err := auth.ConfirmTOTP(user.ID, "123456"); !errors.Is(err, ErrMFANotEnabled) {
+		t.Errorf("Expected ErrMFANotEnabled before enrolling, got %v", err)
+	}
+
+	secret, otpauthURL, err := auth.EnrollTOTP(user.ID)
+	if err != nil {
+		t.Fatalf("Expected enrollment to succeed, got %v", err)
+	}
+	if !strings.HasPrefix(otpauthURL, "otpauth://totp/Example%20App:mfa@example.com?") ||
+		!strings.Contains(otpauthURL, "secret="+secret) || !strings.Contains(otpauthURL, "issuer=Example+App") {
+		t.Errorf("Unexpected otpauth URL %q", otpauthURL)
+	}
+
+	stored, _ := auth.GetUserByID(user.ID)
+	if stored.TOTPSecret == "" || strings.Contains(stored.TOTPSecret, secret) {
+		t.Errorf("Expected the secret to be stored encrypted, got %q", stored.TOTPSecret)
+	}
+
+	// Not enforced until confirmed
+	if tokens, err := auth.LoginUser("mfa@example.com", "password123"); err != nil || tokens.MFARequired {
+		t.Fatalf("Expected a normal login before confirmation, got %+v %v", tokens, err)
+	}
+
+	raw, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err := auth.ConfirmTOTP(user.ID, totpCode(raw, now.Unix()/totpPeriod+2)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected ErrInvalidMFACode, got %v", err)
+	}
+	if err := auth.ConfirmTOTP(user.ID, totpCode(raw, now.Unix()/totpPeriod)); err != nil {
+		t.Fatalf("Expected confirmation to succeed, got %v", err)
+	}
+	if err := auth.ConfirmTOTP(user.ID, totpCode(raw, now.Unix()/totpPeriod)); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Expected ErrMFAAlreadyEnabled, got %v", err)
+	}
+	if _, _, err := auth.EnrollTOTP(user.ID); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Expected re-enrolling to fail while enabled, got %v", err)
+	}
+
+	stored, _ = auth.GetUserByID(user.ID)
+	if !auth.userToUserInfo(stored).MFAEnabled {
+		t.Error("Expected UserInfo.MFAEnabled")
+	}
+
+	if err := auth.DisableTOTP(user.ID); err != nil {
+		t.Fatalf("Expected DisableTOTP to succeed, got %v", err)
+	}
+	if tokens, err := auth.LoginUser("mfa@example.com", "password123"); err != nil || tokens.MFARequired {
+		t.Errorf("Expected a normal login after disabling, got %+v %v", tokens, err)
+	}
+}
+
+func TestTOTPRequiresEncryptionKey(t *testing.T) {
+	// Not even with a JWTSecret to derive one from
+	auth := New(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "nokey@example.com", Password: "password123", Name: "No Key"})
+
+	if _, _, err := auth.EnrollTOTP(user.ID); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig without an EncryptionKey, got %v", err)
+	}
+	if stored, _ := auth.GetUserByID(user.ID); stored.TOTPSecret != "" {
+		t.Errorf("Expected no secret to be stored, got %q", stored.TOTPSecret)
+	}
+}
+
+func TestMFALogin(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "mfa@example.com", Password: "password123", Name: "MFA"})
+	secret := enrollTestTOTP(t, auth, user.ID)
+
+	pending, err := auth.LoginUser("mfa@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected the password step to succeed, got %v", err)
+	}
+	if !pending.MFARequired || pending.MFAToken == "" || pending.AccessToken != "" || pending.RefreshToken != "" {
+		t.Fatalf("Expected only an MFA token, got %+v", pending)
+	}
+	if _, err := auth.ValidateToken(pending.MFAToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the MFA token to be rejected as an access token, got %v", err)
+	}
+	if _, err := auth.RefreshToken(pending.MFAToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the MFA token to be rejected as a refresh token, got %v", err)
+	}
+
+	// The code used to confirm enrollment can't be replayed
+	step := now.Unix() / totpPeriod
+	if _, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, step)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected a reused code to be rejected, got %v", err)
+	}
+
+	now = now.Add(totpPeriod * time.Second)
+	tokens, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, step+1))
+	if err != nil {
+		t.Fatalf("Expected CompleteMFALogin to succeed, got %v", err)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected a valid access token, got %v", err)
+	}
+	if strings.Join(claims.AMR, ",") != "pwd,otp,mfa" {
+		t.Errorf("Expected amr [pwd otp mfa], got %v", claims.AMR)
+	}
+
+	if _, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, step+2)); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected the MFA token to be single-use, got %v", err)
+	}
+
+	refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected refresh to succeed, got %v", err)
+	}
+	if claims, _ := auth.ValidateToken(refreshed.AccessToken); claims == nil || len(claims.AMR) != 3 {
+		t.Errorf("Expected refreshed tokens to keep amr, got %+v", claims)
+	}
+
+	pending, _ = auth.LoginUser("mfa@example.com", "password123")
+	now = now.Add(6 * time.Minute)
+	if _, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, now.Unix()/totpPeriod)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected an expired MFA token to be rejected, got %v", err)
+	}
+}
+
+func TestTOTPClockDrift(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "drift@example.com", Password: "password123", Name: "Drift"})
+	secret := enrollTestTOTP(t, auth, user.ID)
+
+	now = now.Add(10 * time.Minute)
+	step := now.Unix() / totpPeriod
+
+	for _, tc := range []struct {
+		step int64
+		err  error
+	}{
+		{step - 2, ErrInvalidMFACode},
+		{step - 1, nil},
+		{step - 1, ErrInvalidMFACode}, // already used
+		{step + 1, nil},
+		{step, ErrInvalidMFACode}, // older than the last accepted step
+		{step + 2, ErrInvalidMFACode},
+	} {
+		pending, _ := auth.LoginUser("drift@example.com", "password123")
+		if _, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, tc.step)); err != tc.err {
+			t.Errorf("Step %+d: expected %v, got %v", tc.step-step, tc.err, err)
+		}
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth, user := newLockoutTestKit(t, &now)
+	defer auth.Close()
+	secret := enrollTestTOTP(t, auth, user.ID)
+	now = now.Add(time.Minute)
+
+	// Logging in again doesn't reset the counter between guesses
+	for i := 0; i < 2; i++ {
+		pending, err := auth.LoginUser("locked@example.com", "password123")
+		if err != nil {
+			t.Fatalf("Attempt %d: expected the password step to succeed, got %v", i+1, err)
+		}
+		if i == 0 {
+			if _, err := auth.CompleteMFALogin(pending.MFAToken, "not-a-code"); !errors.Is(err, ErrInvalidMFACode) {
+				t.Fatalf("Expected ErrInvalidMFACode, got %v", err)
+			}
+			continue
+		}
+		if _, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, now.Unix()/totpPeriod)); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("Expected ErrAccountLocked, got %v", err)
+		}
+	}
+}
+
+func TestMFAHandlers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "handlers@example.com")
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/mfa/verify", auth.VerifyMFAHandler)
+	protected := r.Group("/", auth.GinMiddleware())
+	protected.POST("/mfa/totp", auth.EnrollTOTPHandler)
+	protected.POST("/mfa/totp/confirm", auth.ConfirmTOTPHandler)
+	post := func(path, body, bearer string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var decoded map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &decoded)
+		return w.Code, decoded
+	}
+
+	code, body := post("/mfa/totp", "", tokens.AccessToken)
+	if code != http.StatusOK || body["secret"] == nil || body["otpauth_url"] == nil {
+		t.Fatalf("Expected a secret and otpauth URL, got %d %v", code, body)
+	}
+	secret, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(body["secret"].(string))
+	step := now.Unix() / totpPeriod
+
+	code, body = post("/mfa/totp/confirm", `{"code":"`+totpCode(secret, step-1)+`"}`, tokens.AccessToken)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 confirming, got %d %v", code, body)
+	}
+	code, body = post("/mfa/totp/confirm", `{"code":"`+totpCode(secret, step)+`"}`, tokens.AccessToken)
+	if code != http.StatusConflict || errorField(body, "code") != CodeMFAAlreadyEnabled {
+		t.Errorf("Expected 409 %s, got %d %v", CodeMFAAlreadyEnabled, code, body)
+	}
+
+	code, body = post("/login", `{"email":"handlers@example.com","password":"password123"}`, "")
+	if code != http.StatusOK || body["mfa_required"] != true || body["access_token"] != "" {
+		t.Fatalf("Expected an MFA challenge, got %d %v", code, body)
+	}
+	mfaToken := body["mfa_token"].(string)
+
+	code, body = post("/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"abcdef"}`, "")
+	if code != http.StatusUnauthorized || errorField(body, "code") != CodeInvalidMFACode {
+		t.Errorf("Expected 401 %s, got %d %v", CodeInvalidMFACode, code, body)
+	}
+	code, body = post("/mfa/verify", `{"mfa_token":"`+mfaToken+`","code":"`+totpCode(secret, step)+`"}`, "")
+	if code != http.StatusOK || body["access_token"] == nil {
+		t.Fatalf("Expected tokens, got %d %v", code, body)
+	}
+
+	app := fiber.New()
+	app.Post("/mfa/verify", auth.VerifyMFAHandlerFiber)
+	pending, _ := auth.LoginUser("handlers@example.com", "password123")
+	req := httptest.NewRequest(http.MethodPost, "/mfa/verify",
+		strings.NewReader(`{"mfa_token":"`+pending.MFAToken+`","code":"`+totpCode(secret, step+1)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+}
@@ -1,73 +1,132 @@
 package authkit
 
 import (
-	"strings"
+	"errors"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // FiberMiddleware returns a Fiber middleware function for authentication
 func (a *AuthKit) FiberMiddleware() fiber.Handler {
+	return a.fiberMiddleware(authRequired)
+}
+
+// OptionalFiberMiddleware returns a Fiber middleware that authenticates
+// requests carrying a token but lets anonymous requests through without claims.
+// Invalid tokens are still rejected unless Config.OptionalAuthIgnoreInvalid is set.
+func (a *AuthKit) OptionalFiberMiddleware() fiber.Handler {
+	return a.fiberMiddleware(authOptional)
+}
+
+// PasswordChangeFiberMiddleware is FiberMiddleware that also accepts tokens
+// restricted to changing the password (Claims.PasswordChangeRequired), which
+// the other middlewares reject with CodePasswordChangeRequired. Use it only
+// for ChangePasswordHandlerFiber; RegisterRoutesFiber does.
+func (a *AuthKit) PasswordChangeFiberMiddleware() fiber.Handler {
+	return a.fiberMiddleware(authPasswordChange)
+}
+
+// fiberMiddleware implements FiberMiddleware and its variants
+func (a *AuthKit) fiberMiddleware(mode authMode) fiber.Handler {
+	optional := mode == authOptional
+	ignoreInvalid := optional && a.config.OptionalAuthIgnoreInvalid
 	return func(c *fiber.Ctx) error {
-		// Get token from Authorization header
+		// Get token from Authorization header, or else the access token cookie
 		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authorization header required",
-			})
+		tokenString, fromCookie := a.fiberCookieToken(c)
+		if authHeader == "" && !fromCookie {
+			if optional {
+				return c.Next()
+			}
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeMissingAuthorization)
 		}
 
-		// Check if the header starts with "Bearer "
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization header format",
-			})
+		if authHeader != "" {
+			// Extract the token from the "Bearer <token>" header
+			bearer, ok := bearerToken(authHeader)
+			if !ok {
+				if ignoreInvalid {
+					return c.Next()
+				}
+				return a.fiberReject(c, fiber.StatusUnauthorized, CodeInvalidAuthorizationFormat)
+			}
+			tokenString = bearer
+		} else if !a.fiberValidCSRF(c) {
+			if ignoreInvalid {
+				return c.Next()
+			}
+			return a.fiberReject(c, fiber.StatusForbidden, CodeInvalidCSRFToken)
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
 		// Validate the token
-		claims, err := a.ValidateToken(tokenString)
+		claims, err := a.ValidateTokenCtx(c.UserContext(), tokenString)
 		if err != nil {
-			status := fiber.StatusUnauthorized
-			message := "Invalid token"
+			if ignoreInvalid {
+				return c.Next()
+			}
 
-			if err == ErrTokenExpired {
-				status = fiber.StatusUnauthorized
-				message = "Token expired"
+			code := ErrorCode(err)
+			if errors.Is(err, ErrTokenExpired) {
+				code = CodeTokenExpired
 			}
 
-			return c.Status(status).JSON(fiber.Map{
-				"error": message,
-			})
+			a.logRejection(c.UserContext(), c.Path(), code)
+			resp := a.fiberErrorResponse(c, fiber.StatusUnauthorized, code, err)
+			c.Set("WWW-Authenticate", a.bearerChallenge(fiber.StatusUnauthorized, code))
+			if code == CodeTokenExpired {
+				// Expiry metadata lets clients choose between a silent refresh and a new login
+				if expiredAt, ok := tokenExpiredAt(tokenString); ok {
+					c.Set(expiredAtHeader, expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_at", expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_seconds_ago", int64(a.now().Sub(expiredAt).Seconds()))
+				}
+			}
+
+			return a.fiberRespondError(c, resp)
 		}
+		if claims.PasswordChangeRequired && mode != authPasswordChange {
+			if ignoreInvalid {
+				return c.Next()
+			}
+			return a.fiberReject(c, fiber.StatusForbidden, CodePasswordChangeRequired)
+		}
+
+		a.traceAuthenticated(c.UserContext(), claims)
 
-		// Set user information in context
-		c.Locals("user_id", claims.UserID)
-		c.Locals("user_email", claims.Email)
-		c.Locals("user_role", claims.Role)
-		c.Locals("user_permissions", claims.Permissions)
-		c.Locals("user_claims", claims)
+		// Renew tokens close to expiry, see Config.SlidingSession
+		if renewed := a.renewAccessToken(claims); renewed != nil {
+			if authHeader == "" {
+				c.Cookie(toFiberCookie(a.renewalCookie(renewed)))
+			} else {
+				c.Set(a.config.SlidingSession.Header, renewed.token)
+			}
+		}
 
+		fiberSetClaims(c, claims)
 		return c.Next()
 	}
 }
 
+// fiberSetClaims sets the user information of authenticated requests in the context
+func fiberSetClaims(c *fiber.Ctx, claims *Claims) {
+	c.Locals("user_id", claims.UserID)
+	c.Locals("user_email", claims.Email)
+	c.Locals("user_role", claims.Role)
+	c.Locals("user_permissions", claims.Permissions)
+	c.Locals("user_claims", claims)
+}
+
 // RequireRoleFiber returns a Fiber middleware that requires a specific role
 func (a *AuthKit) RequireRoleFiber(role string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userRole := c.Locals("user_role")
 		if userRole == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "User not authenticated",
-			})
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
 		}
 
-		if userRole != role {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Insufficient permissions",
-			})
+		if userRoleString, _ := userRole.(string); !a.RoleSatisfies(userRoleString, role) {
+			return a.fiberReject(c, fiber.StatusForbidden, CodeInsufficientPermissions)
 		}
 
 		return c.Next()
@@ -79,23 +138,11 @@ func (a *AuthKit) RequireRolesFiber(roles []string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userRole := c.Locals("user_role")
 		if userRole == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "User not authenticated",
-			})
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
 		}
 
-		hasRole := false
-		for _, role := range roles {
-			if userRole == role {
-				hasRole = true
-				break
-			}
-		}
-
-		if !hasRole {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Insufficient permissions",
-			})
+		if userRoleString, _ := userRole.(string); !a.roleSatisfiesAny(userRoleString, roles) {
+			return a.fiberReject(c, fiber.StatusForbidden, CodeInsufficientPermissions)
 		}
 
 		return c.Next()
@@ -107,30 +154,33 @@ func (a *AuthKit) RequirePermissionFiber(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userPermissions := c.Locals("user_permissions")
 		if userPermissions == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "User not authenticated",
-			})
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
 		}
 
 		permissions, ok := userPermissions.([]string)
 		if !ok {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Invalid permissions format",
-			})
+			return a.fiberReject(c, fiber.StatusInternalServerError, CodeInvalidPermissionsFormat)
 		}
 
-		hasPermission := false
-		for _, perm := range permissions {
-			if perm == permission {
-				hasPermission = true
-				break
-			}
+		if !hasPermission(permissions, permission) {
+			return a.fiberReject(c, fiber.StatusForbidden, CodeInsufficientPermissions)
 		}
 
-		if !hasPermission {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Insufficient permissions",
-			})
+		return c.Next()
+	}
+}
+
+// RequireTenantFiber returns a Fiber middleware that requires tokens issued
+// to users of the tenant
+func (a *AuthKit) RequireTenantFiber(tenantID string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, exists := GetUserFromFiberContext(c)
+		if !exists {
+			return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+		}
+
+		if claims.TenantID != tenantID {
+			return a.fiberReject(c, fiber.StatusForbidden, CodeTenantMismatch)
 		}
 
 		return c.Next()
@@ -147,3 +197,69 @@ func GetUserFromFiberContext(c *fiber.Ctx) (*Claims, bool) {
 	userClaims, ok := claims.(*Claims)
 	return userClaims, ok
 }
+
+// fiberCookieToken returns the access token cookie when Config.CookieConfig is set
+func (a *AuthKit) fiberCookieToken(c *fiber.Ctx) (string, bool) {
+	if a.config.CookieConfig == nil {
+		return "", false
+	}
+	return fiberCookie(c, a.config.CookieConfig.AccessTokenName)
+}
+
+// fiberValidCSRF checks the double-submit CSRF token of a request
+// authenticated by cookie. Config.CookieConfig must be set.
+func (a *AuthKit) fiberValidCSRF(c *fiber.Ctx) bool {
+	cfg := a.config.CookieConfig
+	cookie, _ := fiberCookie(c, cfg.CSRFCookieName)
+	return a.validCSRF(c.Method(), cookie, c.Get(cfg.CSRFHeaderName))
+}
+
+// fiberCookie returns the value of a non-empty request cookie
+func fiberCookie(c *fiber.Ctx, name string) (string, bool) {
+	value := c.Cookies(name)
+	return value, value != ""
+}
+
+// fiberLocale resolves the response locale for a Fiber request
+func (a *AuthKit) fiberLocale(c *fiber.Ctx) string {
+	override, _ := c.Locals(LocaleContextKey).(string)
+	return a.resolveLocale(override, c.Get("Accept-Language"))
+}
+
+// fiberReject logs a request the middleware turned away and sends its error response,
+// with a WWW-Authenticate challenge for bearer token failures
+func (a *AuthKit) fiberReject(c *fiber.Ctx, status int, code string) error {
+	a.logRejection(c.UserContext(), c.Path(), code)
+	if challenge := a.bearerChallenge(status, code); challenge != "" {
+		c.Set("WWW-Authenticate", challenge)
+	}
+	return a.fiberErrorCode(c, status, code)
+}
+
+// fiberError sends the error response for err
+func (a *AuthKit) fiberError(c *fiber.Ctx, status int, err error) error {
+	return a.fiberRespondError(c, a.fiberErrorResponse(c, status, ErrorCode(err), err))
+}
+
+// fiberErrorCode sends an error response with a stable error code
+func (a *AuthKit) fiberErrorCode(c *fiber.Ctx, status int, code string) error {
+	return a.fiberRespondError(c, a.fiberErrorResponse(c, status, code, nil))
+}
+
+// fiberBindError sends the error response for a request body that failed to parse
+func (a *AuthKit) fiberBindError(c *fiber.Ctx, err error) error {
+	resp := a.fiberErrorResponse(c, fiber.StatusBadRequest, CodeInvalidRequest, nil)
+	resp.addDetail("reason", err.Error())
+	return a.fiberRespondError(c, resp)
+}
+
+// fiberErrorResponse describes an error response to a Fiber request
+func (a *AuthKit) fiberErrorResponse(c *fiber.Ctx, status int, code string, err error) ErrorResponse {
+	return a.errorResponse(status, code, err, c.Method(), c.Path(), a.fiberLocale(c))
+}
+
+// fiberRespondError sends resp through the ErrorResponder
+func (a *AuthKit) fiberRespondError(c *fiber.Ctx, resp ErrorResponse) error {
+	status, contentType, body := a.renderError(resp)
+	return c.Status(status).JSON(body, contentType)
+}
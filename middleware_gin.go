@@ -1,72 +1,150 @@
 package authkit
 
 import (
+	"errors"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GinMiddleware returns a Gin middleware function for authentication
 func (a *AuthKit) GinMiddleware() gin.HandlerFunc {
+	return a.ginMiddleware(authRequired)
+}
+
+// OptionalGinMiddleware returns a Gin middleware that authenticates requests
+// carrying a token but lets anonymous requests through without claims.
+// Invalid tokens are still rejected unless Config.OptionalAuthIgnoreInvalid is set.
+func (a *AuthKit) OptionalGinMiddleware() gin.HandlerFunc {
+	return a.ginMiddleware(authOptional)
+}
+
+// PasswordChangeGinMiddleware is GinMiddleware that also accepts tokens
+// restricted to changing the password (Claims.PasswordChangeRequired), which
+// the other middlewares reject with CodePasswordChangeRequired. Use it only
+// for ChangePasswordHandler; RegisterRoutes does.
+func (a *AuthKit) PasswordChangeGinMiddleware() gin.HandlerFunc {
+	return a.ginMiddleware(authPasswordChange)
+}
+
+// ginMiddleware implements GinMiddleware and its variants
+func (a *AuthKit) ginMiddleware(mode authMode) gin.HandlerFunc {
+	optional := mode == authOptional
+	ignoreInvalid := optional && a.config.OptionalAuthIgnoreInvalid
 	return func(c *gin.Context) {
-		// Get token from Authorization header
+		// Get token from Authorization header, or else the access token cookie
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		tokenString, fromCookie := a.ginCookieToken(c)
+		if authHeader == "" && !fromCookie {
+			if optional {
+				c.Next()
+				return
+			}
+			a.ginReject(c, http.StatusUnauthorized, CodeMissingAuthorization)
 			c.Abort()
 			return
 		}
 
-		// Check if the header starts with "Bearer "
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		if authHeader != "" {
+			// Extract the token from the "Bearer <token>" header
+			bearer, ok := bearerToken(authHeader)
+			if !ok {
+				if ignoreInvalid {
+					c.Next()
+					return
+				}
+				a.ginReject(c, http.StatusUnauthorized, CodeInvalidAuthorizationFormat)
+				c.Abort()
+				return
+			}
+			tokenString = bearer
+		} else if !a.ginValidCSRF(c) {
+			if ignoreInvalid {
+				c.Next()
+				return
+			}
+			a.ginReject(c, http.StatusForbidden, CodeInvalidCSRFToken)
 			c.Abort()
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
 		// Validate the token
-		claims, err := a.ValidateToken(tokenString)
+		claims, err := a.ValidateTokenCtx(c.Request.Context(), tokenString)
 		if err != nil {
-			status := http.StatusUnauthorized
-			message := "Invalid token"
+			if ignoreInvalid {
+				c.Next()
+				return
+			}
 
-			if err == ErrTokenExpired {
-				status = http.StatusUnauthorized
-				message = "Token expired"
+			code := ErrorCode(err)
+			if errors.Is(err, ErrTokenExpired) {
+				code = CodeTokenExpired
 			}
 
-			c.JSON(status, gin.H{"error": message})
+			a.logRejection(c.Request.Context(), c.Request.URL.Path, code)
+			resp := a.ginErrorResponse(c, http.StatusUnauthorized, code, err)
+			c.Header("WWW-Authenticate", a.bearerChallenge(http.StatusUnauthorized, code))
+			if code == CodeTokenExpired {
+				// Expiry metadata lets clients choose between a silent refresh and a new login
+				if expiredAt, ok := tokenExpiredAt(tokenString); ok {
+					c.Header(expiredAtHeader, expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_at", expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_seconds_ago", int64(a.now().Sub(expiredAt).Seconds()))
+				}
+			}
+
+			a.ginRespondError(c, resp)
+			c.Abort()
+			return
+		}
+		if claims.PasswordChangeRequired && mode != authPasswordChange {
+			if ignoreInvalid {
+				c.Next()
+				return
+			}
+			a.ginReject(c, http.StatusForbidden, CodePasswordChangeRequired)
 			c.Abort()
 			return
 		}
 
-		// Set user information in context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
-		c.Set("user_permissions", claims.Permissions)
-		c.Set("user_claims", claims)
+		a.traceAuthenticated(c.Request.Context(), claims)
+
+		// Renew tokens close to expiry, see Config.SlidingSession
+		if renewed := a.renewAccessToken(claims); renewed != nil {
+			if authHeader == "" {
+				http.SetCookie(c.Writer, a.renewalCookie(renewed))
+			} else {
+				c.Header(a.config.SlidingSession.Header, renewed.token)
+			}
+		}
 
+		ginSetClaims(c, claims)
 		c.Next()
 	}
 }
 
+// ginSetClaims sets the user information of authenticated requests in the context
+func ginSetClaims(c *gin.Context, claims *Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_role", claims.Role)
+	c.Set("user_permissions", claims.Permissions)
+	c.Set("user_claims", claims)
+}
+
 // RequireRole returns a Gin middleware that requires a specific role
 func (a *AuthKit) RequireRole(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("user_role")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
 			c.Abort()
 			return
 		}
 
-		if userRole != role {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		if userRoleString, _ := userRole.(string); !a.RoleSatisfies(userRoleString, role) {
+			a.ginReject(c, http.StatusForbidden, CodeInsufficientPermissions)
 			c.Abort()
 			return
 		}
@@ -80,21 +158,13 @@ func (a *AuthKit) RequireRoles(roles []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("user_role")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
 			c.Abort()
 			return
 		}
 
-		hasRole := false
-		for _, role := range roles {
-			if userRole == role {
-				hasRole = true
-				break
-			}
-		}
-
-		if !hasRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		if userRoleString, _ := userRole.(string); !a.roleSatisfiesAny(userRoleString, roles) {
+			a.ginReject(c, http.StatusForbidden, CodeInsufficientPermissions)
 			c.Abort()
 			return
 		}
@@ -108,28 +178,41 @@ func (a *AuthKit) RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userPermissions, exists := c.Get("user_permissions")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
 			c.Abort()
 			return
 		}
 
 		permissions, ok := userPermissions.([]string)
 		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid permissions format"})
+			a.ginReject(c, http.StatusInternalServerError, CodeInvalidPermissionsFormat)
 			c.Abort()
 			return
 		}
 
-		hasPermission := false
-		for _, perm := range permissions {
-			if perm == permission {
-				hasPermission = true
-				break
-			}
+		if !hasPermission(permissions, permission) {
+			a.ginReject(c, http.StatusForbidden, CodeInsufficientPermissions)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTenant returns a Gin middleware that requires tokens issued to users
+// of the tenant
+func (a *AuthKit) RequireTenant(tenantID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := GetUserFromGinContext(c)
+		if !exists {
+			a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
+			c.Abort()
+			return
 		}
 
-		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		if claims.TenantID != tenantID {
+			a.ginReject(c, http.StatusForbidden, CodeTenantMismatch)
 			c.Abort()
 			return
 		}
@@ -148,3 +231,69 @@ func GetUserFromGinContext(c *gin.Context) (*Claims, bool) {
 	userClaims, ok := claims.(*Claims)
 	return userClaims, ok
 }
+
+// ginCookieToken returns the access token cookie when Config.CookieConfig is set
+func (a *AuthKit) ginCookieToken(c *gin.Context) (string, bool) {
+	if a.config.CookieConfig == nil {
+		return "", false
+	}
+	return ginCookie(c, a.config.CookieConfig.AccessTokenName)
+}
+
+// ginValidCSRF checks the double-submit CSRF token of a request authenticated
+// by cookie. Config.CookieConfig must be set.
+func (a *AuthKit) ginValidCSRF(c *gin.Context) bool {
+	cfg := a.config.CookieConfig
+	cookie, _ := ginCookie(c, cfg.CSRFCookieName)
+	return a.validCSRF(c.Request.Method, cookie, c.GetHeader(cfg.CSRFHeaderName))
+}
+
+// ginCookie returns the value of a non-empty request cookie
+func ginCookie(c *gin.Context, name string) (string, bool) {
+	value, err := c.Cookie(name)
+	return value, err == nil && value != ""
+}
+
+// ginLocale resolves the response locale for a Gin request
+func (a *AuthKit) ginLocale(c *gin.Context) string {
+	return a.resolveLocale(c.GetString(LocaleContextKey), c.GetHeader("Accept-Language"))
+}
+
+// ginReject logs a request the middleware turned away and sends its error response,
+// with a WWW-Authenticate challenge for bearer token failures
+func (a *AuthKit) ginReject(c *gin.Context, status int, code string) {
+	a.logRejection(c.Request.Context(), c.Request.URL.Path, code)
+	if challenge := a.bearerChallenge(status, code); challenge != "" {
+		c.Header("WWW-Authenticate", challenge)
+	}
+	a.ginErrorCode(c, status, code)
+}
+
+// ginError sends the error response for err
+func (a *AuthKit) ginError(c *gin.Context, status int, err error) {
+	a.ginRespondError(c, a.ginErrorResponse(c, status, ErrorCode(err), err))
+}
+
+// ginErrorCode sends an error response with a stable error code
+func (a *AuthKit) ginErrorCode(c *gin.Context, status int, code string) {
+	a.ginRespondError(c, a.ginErrorResponse(c, status, code, nil))
+}
+
+// ginBindError sends the error response for a request body that failed to bind
+func (a *AuthKit) ginBindError(c *gin.Context, err error) {
+	resp := a.ginErrorResponse(c, http.StatusBadRequest, CodeInvalidRequest, nil)
+	resp.addDetail("reason", err.Error())
+	a.ginRespondError(c, resp)
+}
+
+// ginErrorResponse describes an error response to a Gin request
+func (a *AuthKit) ginErrorResponse(c *gin.Context, status int, code string, err error) ErrorResponse {
+	return a.errorResponse(status, code, err, c.Request.Method, c.Request.URL.Path, a.ginLocale(c))
+}
+
+// ginRespondError sends resp through the ErrorResponder
+func (a *AuthKit) ginRespondError(c *gin.Context, resp ErrorResponse) {
+	status, contentType, body := a.renderError(resp)
+	c.Header("Content-Type", contentType)
+	c.JSON(status, body)
+}
@@ -0,0 +1,297 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// claimsContextKey is the request context key HTTPMiddleware stores claims under
+type claimsContextKey struct{}
+
+// authMode says which requests an authentication middleware lets through
+type authMode int
+
+const (
+	authRequired       authMode = iota // A valid, unrestricted token
+	authOptional                       // No token, or a valid unrestricted one
+	authPasswordChange                 // A valid token, restricted to changing the password or not
+)
+
+// HTTPMiddleware returns a net/http middleware for authentication. Handlers
+// read the validated claims with GetUserFromContext.
+func (a *AuthKit) HTTPMiddleware(next http.Handler) http.Handler {
+	return a.httpMiddleware(next, authRequired)
+}
+
+// OptionalHTTPMiddleware returns a net/http middleware that authenticates
+// requests carrying a token but lets anonymous requests through without claims.
+// Invalid tokens are still rejected unless Config.OptionalAuthIgnoreInvalid is set.
+func (a *AuthKit) OptionalHTTPMiddleware(next http.Handler) http.Handler {
+	return a.httpMiddleware(next, authOptional)
+}
+
+// PasswordChangeHTTPMiddleware is HTTPMiddleware that also accepts tokens
+// restricted to changing the password (Claims.PasswordChangeRequired), which
+// the other middlewares reject with CodePasswordChangeRequired. Use it only
+// on the route calling ChangePassword.
+func (a *AuthKit) PasswordChangeHTTPMiddleware(next http.Handler) http.Handler {
+	return a.httpMiddleware(next, authPasswordChange)
+}
+
+// httpMiddleware implements HTTPMiddleware and its variants
+func (a *AuthKit) httpMiddleware(next http.Handler, mode authMode) http.Handler {
+	optional := mode == authOptional
+	ignoreInvalid := optional && a.config.OptionalAuthIgnoreInvalid
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get token from Authorization header, or else the access token cookie
+		authHeader := r.Header.Get("Authorization")
+		tokenString, fromCookie := a.httpCookieToken(r)
+		if authHeader == "" && !fromCookie {
+			if optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			a.httpReject(w, r, http.StatusUnauthorized, CodeMissingAuthorization)
+			return
+		}
+
+		if authHeader != "" {
+			// Extract the token from the "Bearer <token>" header
+			bearer, ok := bearerToken(authHeader)
+			if !ok {
+				if ignoreInvalid {
+					next.ServeHTTP(w, r)
+					return
+				}
+				a.httpReject(w, r, http.StatusUnauthorized, CodeInvalidAuthorizationFormat)
+				return
+			}
+			tokenString = bearer
+		} else if !a.httpValidCSRF(r) {
+			if ignoreInvalid {
+				next.ServeHTTP(w, r)
+				return
+			}
+			a.httpReject(w, r, http.StatusForbidden, CodeInvalidCSRFToken)
+			return
+		}
+
+		// Validate the token
+		claims, err := a.ValidateTokenCtx(r.Context(), tokenString)
+		if err != nil {
+			if ignoreInvalid {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			code := ErrorCode(err)
+			if errors.Is(err, ErrTokenExpired) {
+				code = CodeTokenExpired
+			}
+
+			a.logRejection(r.Context(), r.URL.Path, code)
+			resp := a.httpErrorResponse(r, http.StatusUnauthorized, code, err)
+			w.Header().Set("WWW-Authenticate", a.bearerChallenge(http.StatusUnauthorized, code))
+			if code == CodeTokenExpired {
+				// Expiry metadata lets clients choose between a silent refresh and a new login
+				if expiredAt, ok := tokenExpiredAt(tokenString); ok {
+					w.Header().Set(expiredAtHeader, expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_at", expiredAt.Format(time.RFC3339))
+					resp.addDetail("expired_seconds_ago", int64(a.now().Sub(expiredAt).Seconds()))
+				}
+			}
+
+			a.httpRespondError(w, resp)
+			return
+		}
+		if claims.PasswordChangeRequired && mode != authPasswordChange {
+			if ignoreInvalid {
+				next.ServeHTTP(w, r)
+				return
+			}
+			a.httpReject(w, r, http.StatusForbidden, CodePasswordChangeRequired)
+			return
+		}
+
+		a.traceAuthenticated(r.Context(), claims)
+
+		// Renew tokens close to expiry, see Config.SlidingSession
+		if renewed := a.renewAccessToken(claims); renewed != nil {
+			if authHeader == "" {
+				http.SetCookie(w, a.renewalCookie(renewed))
+			} else {
+				w.Header().Set(a.config.SlidingSession.Header, renewed.token)
+			}
+		}
+
+		// Set user information in context
+		ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRoleHTTP returns a net/http middleware that requires a specific role
+func (a *AuthKit) RequireRoleHTTP(role string) func(http.Handler) http.Handler {
+	return a.RequireRolesHTTP([]string{role})
+}
+
+// RequireRolesHTTP returns a net/http middleware that requires one of the specified roles
+func (a *AuthKit) RequireRolesHTTP(roles []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, exists := GetUserFromContext(r.Context())
+			if !exists {
+				a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+				return
+			}
+
+			if !a.roleSatisfiesAny(claims.Role, roles) {
+				a.httpReject(w, r, http.StatusForbidden, CodeInsufficientPermissions)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermissionHTTP returns a net/http middleware that requires a specific permission
+func (a *AuthKit) RequirePermissionHTTP(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, exists := GetUserFromContext(r.Context())
+			if !exists {
+				a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+				return
+			}
+
+			if !claims.HasPermission(permission) {
+				a.httpReject(w, r, http.StatusForbidden, CodeInsufficientPermissions)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireTenantHTTP returns a net/http middleware that requires tokens issued
+// to users of the tenant
+func (a *AuthKit) RequireTenantHTTP(tenantID string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, exists := GetUserFromContext(r.Context())
+			if !exists {
+				a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+				return
+			}
+
+			if claims.TenantID != tenantID {
+				a.httpReject(w, r, http.StatusForbidden, CodeTenantMismatch)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetUserFromContext extracts user information stored by HTTPMiddleware
+func GetUserFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// httpCookieToken returns the access token cookie when Config.CookieConfig is set
+func (a *AuthKit) httpCookieToken(r *http.Request) (string, bool) {
+	if a.config.CookieConfig == nil {
+		return "", false
+	}
+	return httpCookie(r, a.config.CookieConfig.AccessTokenName)
+}
+
+// httpValidCSRF checks the double-submit CSRF token of a request
+// authenticated by cookie. Config.CookieConfig must be set.
+func (a *AuthKit) httpValidCSRF(r *http.Request) bool {
+	cfg := a.config.CookieConfig
+	cookie, _ := httpCookie(r, cfg.CSRFCookieName)
+	return a.validCSRF(r.Method, cookie, r.Header.Get(cfg.CSRFHeaderName))
+}
+
+// httpCookie returns the value of a non-empty request cookie
+func httpCookie(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// httpLocale resolves the response locale for a net/http request
+func (a *AuthKit) httpLocale(r *http.Request) string {
+	return a.resolveLocale("", r.Header.Get("Accept-Language"))
+}
+
+// httpReject logs a request the middleware turned away and sends its error response,
+// with a WWW-Authenticate challenge for bearer token failures
+func (a *AuthKit) httpReject(w http.ResponseWriter, r *http.Request, status int, code string) {
+	a.logRejection(r.Context(), r.URL.Path, code)
+	if challenge := a.bearerChallenge(status, code); challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	a.httpErrorCode(w, r, status, code)
+}
+
+// httpError sends the error response for err
+func (a *AuthKit) httpError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	a.httpRespondError(w, a.httpErrorResponse(r, status, ErrorCode(err), err))
+}
+
+// httpErrorCode sends an error response with a stable error code
+func (a *AuthKit) httpErrorCode(w http.ResponseWriter, r *http.Request, status int, code string) {
+	a.httpRespondError(w, a.httpErrorResponse(r, status, code, nil))
+}
+
+// httpBindError sends the error response for a request body that failed to decode
+func (a *AuthKit) httpBindError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := a.httpErrorResponse(r, http.StatusBadRequest, CodeInvalidRequest, nil)
+	resp.addDetail("reason", err.Error())
+	a.httpRespondError(w, resp)
+}
+
+// httpErrorResponse describes an error response to a net/http request
+func (a *AuthKit) httpErrorResponse(r *http.Request, status int, code string, err error) ErrorResponse {
+	return a.errorResponse(status, code, err, r.Method, r.URL.Path, a.httpLocale(r))
+}
+
+// httpRespondError sends resp through the ErrorResponder
+func (a *AuthKit) httpRespondError(w http.ResponseWriter, resp ErrorResponse) {
+	status, contentType, body := a.renderError(resp)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// jsonContentType is the content type of JSON responses
+const jsonContentType = "application/json; charset=utf-8"
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// httpClientIP returns the IP address of the client that sent r. Forwarding
+// headers are ignored since net/http has no notion of trusted proxies.
+func httpClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
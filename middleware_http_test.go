@@ -0,0 +1,136 @@
+package authkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newHTTPTestMux(auth *AuthKit) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", auth.RegisterHandlerHTTP)
+	mux.HandleFunc("/login", auth.LoginHandlerHTTP)
+	mux.HandleFunc("/refresh", auth.RefreshHandlerHTTP)
+	mux.HandleFunc("/logout", auth.LogoutHandlerHTTP)
+	mux.Handle("/profile", auth.HTTPMiddleware(http.HandlerFunc(auth.ProfileHandlerHTTP)))
+	mux.Handle("/admin", auth.HTTPMiddleware(auth.RequireRoleHTTP("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))))
+	mux.Handle("/reports", auth.HTTPMiddleware(auth.RequirePermissionHTTP("reports:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := GetUserFromContext(r.Context())
+		writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": claims.UserID})
+	}))))
+	return mux
+}
+
+func TestHTTPHandlersMatchGin(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1})
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/refresh", auth.RefreshHandler)
+	r.GET("/profile", auth.GinMiddleware(), auth.ProfileHandler)
+	mux := newHTTPTestMux(auth)
+
+	tokens := loginTestUser(t, auth, "parity@example.com")
+	cases := []struct {
+		method, path, auth, body string
+	}{
+		{http.MethodPost, "/register", "", `{"email":"not-an-email","password":"password123","name":"X"}`},
+		{http.MethodPost, "/register", "", `{"email":"parity@example.com","password":"password123","name":"X"}`},
+		{http.MethodPost, "/register", "", `{"email":"weak@example.com","password":"short","name":"X"}`},
+		{http.MethodPost, "/login", "", `{"email":"parity@example.com","password":"wrong-password"}`},
+		{http.MethodPost, "/login", "", `{"email":"parity@example.com"}`},
+		{http.MethodPost, "/refresh", "", `{"refresh_token":"garbage"}`},
+		{http.MethodGet, "/profile", "", ""},
+		{http.MethodGet, "/profile", "Token abc", ""},
+		{http.MethodGet, "/profile", "Bearer garbage", ""},
+		{http.MethodGet, "/profile", "Bearer " + tokens.AccessToken, ""},
+	}
+
+	for _, tc := range cases {
+		send := func(h http.Handler) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", "fr")
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w
+		}
+
+		ginResp, httpResp := send(r), send(mux)
+		var ginBody, httpBody interface{}
+		_ = json.Unmarshal(ginResp.Body.Bytes(), &ginBody)
+		_ = json.Unmarshal(httpResp.Body.Bytes(), &httpBody)
+		ginJSON, _ := json.Marshal(ginBody)
+		httpJSON, _ := json.Marshal(httpBody)
+		if ginResp.Code != httpResp.Code || string(ginJSON) != string(httpJSON) {
+			t.Errorf("%s %s %s: Gin responded %d %s, net/http %d %s", tc.method, tc.path, tc.body,
+				ginResp.Code, ginJSON, httpResp.Code, httpJSON)
+		}
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	mux := newHTTPTestMux(auth)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/register", "", `{"email":"http@example.com","password":"password123","name":"HTTP"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	user, _ := auth.GetUserByEmail("http@example.com")
+	_, _ = auth.UpdateUser(user.ID, map[string]interface{}{"permissions": []string{"reports:read"}})
+
+	w = do(http.MethodPost, "/login", "", `{"email":"http@example.com","password":"password123"}`)
+	var tokens TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	if w.Code != http.StatusOK || tokens.AccessToken == "" {
+		t.Fatalf("Expected tokens, got %d: %s", w.Code, w.Body.String())
+	}
+	if sessions, _ := auth.ListSessions(user.ID); len(sessions) != 1 || sessions[0].IP != "192.0.2.1" {
+		t.Errorf("Expected the session to record the client IP, got %+v", sessions)
+	}
+
+	if w := do(http.MethodGet, "/reports", tokens.AccessToken, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), user.ID) {
+		t.Errorf("Expected the permission check to pass, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/admin", tokens.AccessToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without the admin role, got %d", w.Code)
+	}
+
+	w = do(http.MethodPost, "/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the refresh to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/logout", tokens.AccessToken, `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/profile", tokens.AccessToken, ""); w.Code != http.StatusUnauthorized ||
+		!strings.Contains(w.Body.String(), CodeTokenRevoked) {
+		t.Errorf("Expected the revoked token to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
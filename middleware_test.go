@@ -0,0 +1,315 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// ginRequest runs a request through a Gin engine with the AuthKit middleware on /protected
+func ginRequest(auth *AuthKit, authHeader string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/protected", auth.GinMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// fiberRequest runs a request through a Fiber app with the AuthKit middleware on /protected
+func fiberRequest(t *testing.T, auth *AuthKit, authHeader string) *http.Response {
+	app := fiber.New()
+	app.Get("/protected", auth.FiberMiddleware(), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"ok": true})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Fiber request failed: %v", err)
+	}
+	return resp
+}
+
+func TestMiddlewareExpiredToken(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	expired, _ := auth.GenerateCustomToken("expired-user", nil, -time.Minute)
+	const expiredTokenChallenge = `Bearer realm="authkit", error="invalid_token", error_description="Token expired"`
+
+	t.Run("Gin", func(t *testing.T) {
+		w := ginRequest(auth, "Bearer "+expired)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401, got %d", w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != expiredTokenChallenge {
+			t.Errorf("Expected WWW-Authenticate %q, got %q", expiredTokenChallenge, got)
+		}
+		var body map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if errorField(body, "message") != "Token expired" {
+			t.Errorf("Expected expired error body, got %v", body)
+		}
+
+		w = ginRequest(auth, "Bearer not-a-token")
+		if got := w.Header().Get("WWW-Authenticate"); got == expiredTokenChallenge {
+			t.Error("Expected no expiry challenge for an invalid token")
+		}
+	})
+
+	t.Run("Fiber", func(t *testing.T) {
+		resp := fiberRequest(t, auth, "Bearer "+expired)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected 401, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("WWW-Authenticate"); got != expiredTokenChallenge {
+			t.Errorf("Expected WWW-Authenticate %q, got %q", expiredTokenChallenge, got)
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if errorField(body, "message") != "Token expired" {
+			t.Errorf("Expected expired error body, got %v", body)
+		}
+	})
+}
+
+func TestMiddlewareExpiredTokenMetadata(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+
+	for _, tc := range []struct {
+		name string
+		ago  time.Duration
+	}{
+		{"Fresh", 5 * time.Second},
+		{"Long", 21 * 24 * time.Hour},
+	} {
+		exp := now.Add(-tc.ago)
+		expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			UserID: "secret-user-id",
+			Email:  "secret@example.com",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "secret-subject",
+				Issuer:    defaultIssuer,
+				Audience:  []string{defaultAudience},
+				ExpiresAt: jwt.NewNumericDate(exp),
+			},
+		}).SignedString([]byte("test-secret-key-for-testing-only"))
+
+		check := func(t *testing.T, header string, raw []byte) {
+			if header != exp.Format(time.RFC3339) {
+				t.Errorf("Expected %s %s, got %q", expiredAtHeader, exp.Format(time.RFC3339), header)
+			}
+			var body map[string]interface{}
+			_ = json.Unmarshal(raw, &body)
+			if errorDetail(body, "expired_at") != exp.Format(time.RFC3339) {
+				t.Errorf("Expected expired_at %s, got %v", exp.Format(time.RFC3339), errorDetail(body, "expired_at"))
+			}
+			if errorDetail(body, "expired_seconds_ago") != tc.ago.Seconds() {
+				t.Errorf("Expected expired_seconds_ago %v, got %v", tc.ago.Seconds(), errorDetail(body, "expired_seconds_ago"))
+			}
+			for _, secret := range []string{"secret-user-id", "secret@example.com", "secret-subject"} {
+				if strings.Contains(string(raw), secret) {
+					t.Errorf("Expected response not to expose %q: %s", secret, raw)
+				}
+			}
+		}
+
+		t.Run(tc.name+"/Gin", func(t *testing.T) {
+			w := ginRequest(auth, "Bearer "+expired)
+			check(t, w.Header().Get(expiredAtHeader), w.Body.Bytes())
+		})
+
+		t.Run(tc.name+"/Fiber", func(t *testing.T) {
+			resp := fiberRequest(t, auth, "Bearer "+expired)
+			raw, _ := io.ReadAll(resp.Body)
+			check(t, resp.Header.Get(expiredAtHeader), raw)
+		})
+	}
+
+	// A forged expired token is merely invalid and reveals nothing
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(-time.Hour)),
+	}).SignedString([]byte("wrong-secret"))
+	if w := ginRequest(auth, "Bearer "+forged); w.Header().Get(expiredAtHeader) != "" {
+		t.Error("Expected no expiry metadata for a token with a bad signature")
+	}
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	for _, ignoreInvalid := range []bool{false, true} {
+		auth := newTestKit(t, Config{
+			OptionalAuthIgnoreInvalid: ignoreInvalid,
+		})
+		defer auth.Close()
+		tokens := loginTestUser(t, auth, "optional@example.com")
+
+		r := gin.New()
+		r.GET("/feed", auth.OptionalGinMiddleware(), func(c *gin.Context) {
+			claims, ok := GetUserFromGinContext(c)
+			if !ok {
+				c.JSON(http.StatusOK, gin.H{"user": nil})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"user": claims.Email})
+		})
+		app := fiber.New()
+		app.Get("/feed", auth.OptionalFiberMiddleware(), func(c *fiber.Ctx) error {
+			claims, ok := GetUserFromFiberContext(c)
+			if !ok {
+				return c.JSON(fiber.Map{"user": nil})
+			}
+			return c.JSON(fiber.Map{"user": claims.Email})
+		})
+		mux := auth.OptionalHTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetUserFromContext(r.Context())
+			if !ok {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"user": nil})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"user": claims.Email})
+		}))
+
+		invalidStatus, invalidBody := http.StatusUnauthorized, CodeInvalidToken
+		if ignoreInvalid {
+			invalidStatus, invalidBody = http.StatusOK, `"user":null`
+		}
+		cases := []struct {
+			name, header string
+			status       int
+			body         string
+		}{
+			{"anonymous", "", http.StatusOK, `"user":null`},
+			{"valid", "Bearer " + tokens.AccessToken, http.StatusOK, `"user":"optional@example.com"`},
+			{"invalid", "Bearer garbage", invalidStatus, invalidBody},
+		}
+		for _, tc := range cases {
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+				if tc.header != "" {
+					req.Header.Set("Authorization", tc.header)
+				}
+				return req
+			}
+			check := func(framework string, status int, body string) {
+				if status != tc.status || !strings.Contains(body, tc.body) {
+					t.Errorf("%s %s (ignore invalid %v): expected %d %s, got %d %s",
+						framework, tc.name, ignoreInvalid, tc.status, tc.body, status, body)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, newRequest())
+			check("Gin", w.Code, w.Body.String())
+
+			resp, err := app.Test(newRequest())
+			if err != nil {
+				t.Fatalf("Fiber request failed: %v", err)
+			}
+			raw, _ := io.ReadAll(resp.Body)
+			check("Fiber", resp.StatusCode, string(raw))
+
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, newRequest())
+			check("net/http", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMiddlewareAuthorizationHeader(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	token := loginTestUser(t, auth, "header@example.com").AccessToken
+
+	tests := []struct {
+		name    string
+		header  string
+		code    int
+		errCode string
+	}{
+		{"canonical", "Bearer " + token, http.StatusOK, ""},
+		{"lowercase scheme", "bearer " + token, http.StatusOK, ""},
+		{"uppercase scheme", "BEARER " + token, http.StatusOK, ""},
+		{"extra spaces", "  Bearer   " + token + "  ", http.StatusOK, ""},
+		{"scheme only", "Bearer", http.StatusUnauthorized, CodeInvalidAuthorizationFormat},
+		{"empty token", "Bearer   ", http.StatusUnauthorized, CodeInvalidAuthorizationFormat},
+		{"other scheme", "Basic " + token, http.StatusUnauthorized, CodeInvalidAuthorizationFormat},
+		{"missing segment", "Bearer " + token[:strings.LastIndex(token, ".")], http.StatusUnauthorized, CodeInvalidToken},
+		{"extra segment", "Bearer " + token + ".x", http.StatusUnauthorized, CodeInvalidToken},
+	}
+	for name, handler := range protectedHandlers(auth) {
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.errCode) {
+				t.Errorf("%s/%s: expected %d %s, got %d %s", name, tt.name, tt.code, tt.errCode, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	// Tokens over MaxTokenSize are rejected before parsing, whatever the
+	// header size limit of the server in front
+	oversized := token[:strings.LastIndex(token, ".")+1] + strings.Repeat("a", 4<<20)
+	if _, err := auth.ValidateToken(oversized); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an oversized token, got %v", err)
+	}
+}
+
+func FuzzBearerToken(f *testing.F) {
+	for _, seed := range []string{"Bearer abc", "bearer  abc ", "Bearer", "Basic abc", " ", "Bearer \t", "BEARER a b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		token, ok := bearerToken(header)
+		if ok && (token == "" || token != strings.TrimSpace(token)) {
+			t.Errorf("Expected a trimmed, non-empty token from %q, got %q", header, token)
+		}
+		if !ok && token != "" {
+			t.Errorf("Expected no token from rejected header %q, got %q", header, token)
+		}
+	})
+}
+
+func FuzzValidateToken(f *testing.F) {
+	auth := newTestKit(f, Config{})
+	defer auth.Close()
+	token, err := auth.GenerateCustomToken("fuzz-user", nil, time.Hour)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{token, token + ".", "a.b.c", "..", "", "eyJhbGciOiJub25lIn0.e30.", strings.Repeat(".", 3)} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, tokenString string) {
+		claims, err := auth.ValidateToken(tokenString)
+		if (claims == nil) == (err == nil) {
+			t.Errorf("Expected either claims or an error for %q, got %+v %v", tokenString, claims, err)
+		}
+		if _, err := auth.RefreshToken(tokenString); err == nil {
+			t.Errorf("Expected %q to be rejected as a refresh token", tokenString)
+		}
+	})
+}
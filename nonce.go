@@ -0,0 +1,179 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NonceEntry is a stored single-use nonce
+type NonceEntry struct {
+	Purpose   string
+	Meta      map[string]string
+	ExpiresAt time.Time
+}
+
+// NonceStore persists single-use nonces. Keys are hashes of the nonce, never the nonce itself.
+type NonceStore interface {
+	// Put stores a new nonce entry
+	Put(key string, entry NonceEntry) error
+	// Take atomically removes and returns the entry for key if it exists and matches purpose.
+	// A purpose mismatch must leave the entry in place and return ErrInvalidNonce.
+	Take(key, purpose string) (NonceEntry, error)
+	// Prune removes entries expired at now and returns how many were removed
+	Prune(now time.Time) int
+}
+
+// NonceStats reports nonce usage counters
+type NonceStats struct {
+	Issued   uint64 `json:"issued"`
+	Consumed uint64 `json:"consumed"`
+	Expired  uint64 `json:"expired"`
+}
+
+// MemoryNonceStore is an in-memory NonceStore
+type MemoryNonceStore struct {
+	entries map[string]NonceEntry
+	mutex   sync.Mutex
+}
+
+// NewMemoryNonceStore creates an empty in-memory nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{entries: make(map[string]NonceEntry)}
+}
+
+// Put stores a new nonce entry
+func (s *MemoryNonceStore) Put(key string, entry NonceEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[key] = entry
+	return nil
+}
+
+// Take atomically removes and returns the entry for key
+func (s *MemoryNonceStore) Take(key, purpose string) (NonceEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists || entry.Purpose != purpose {
+		return NonceEntry{}, ErrInvalidNonce
+	}
+
+	delete(s.entries, key)
+	return entry, nil
+}
+
+// Prune removes expired entries
+func (s *MemoryNonceStore) Prune(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pruned := 0
+	for key, entry := range s.entries {
+		if !now.Before(entry.ExpiresAt) {
+			delete(s.entries, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// nonceState holds the nonce counters and pruning schedule for an AuthKit
+type nonceState struct {
+	issued    atomic.Uint64
+	consumed  atomic.Uint64
+	expired   atomic.Uint64
+	lastPrune atomic.Int64
+}
+
+// IssueNonce creates a random single-use nonce scoped to purpose, valid for ttl.
+// The optional meta is returned by ConsumeNonce.
+func (a *AuthKit) IssueNonce(purpose string, ttl time.Duration, meta map[string]string) (string, error) {
+	if purpose == "" || ttl <= 0 {
+		return "", ErrInvalidNonce
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Copy meta so later changes by the caller don't leak into the store
+	stored := make(map[string]string, len(meta))
+	for k, v := range meta {
+		stored[k] = v
+	}
+
+	now := a.now()
+	a.pruneNonces(now)
+
+	err := a.config.NonceStore.Put(nonceKey(nonce), NonceEntry{
+		Purpose:   purpose,
+		Meta:      stored,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	a.nonces.issued.Add(1)
+	return nonce, nil
+}
+
+// ConsumeNonce redeems a nonce issued for purpose, returning its metadata.
+// A nonce can only be consumed once; expired nonces return ErrNonceExpired.
+func (a *AuthKit) ConsumeNonce(nonce, purpose string) (map[string]string, error) {
+	if nonce == "" {
+		return nil, ErrInvalidNonce
+	}
+
+	entry, err := a.config.NonceStore.Take(nonceKey(nonce), purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.now().Before(entry.ExpiresAt) {
+		a.nonces.expired.Add(1)
+		return nil, ErrNonceExpired
+	}
+
+	a.nonces.consumed.Add(1)
+	return entry.Meta, nil
+}
+
+// NonceStats returns the issued/consumed/expired nonce counters
+func (a *AuthKit) NonceStats() NonceStats {
+	return NonceStats{
+		Issued:   a.nonces.issued.Load(),
+		Consumed: a.nonces.consumed.Load(),
+		Expired:  a.nonces.expired.Load(),
+	}
+}
+
+// pruneNonces removes expired nonces at most once per JanitorInterval
+func (a *AuthKit) pruneNonces(now time.Time) {
+	last := a.nonces.lastPrune.Load()
+	if now.UnixNano()-last < int64(a.config.JanitorInterval) {
+		return
+	}
+	if !a.nonces.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	if pruned := a.config.NonceStore.Prune(now); pruned > 0 {
+		a.nonces.expired.Add(uint64(pruned))
+	}
+}
+
+// nonceKey hashes a nonce for storage so a store dump doesn't reveal usable nonces
+func nonceKey(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+package authkit
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNonceIssueAndConsume(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	nonce, err := auth.IssueNonce("device-proof", time.Minute, map[string]string{"device": "abc"})
+	if err != nil {
+		t.Fatalf("Expected nonce, got error: %v", err)
+	}
+
+	meta, err := auth.ConsumeNonce(nonce, "device-proof")
+	if err != nil {
+		t.Fatalf("Expected nonce to be consumed, got %v", err)
+	}
+	if meta["device"] != "abc" {
+		t.Errorf("Expected metadata to round-trip, got %v", meta)
+	}
+
+	if _, err := auth.ConsumeNonce(nonce, "device-proof"); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce on second consume, got %v", err)
+	}
+
+	stats := auth.NonceStats()
+	if stats.Issued != 1 || stats.Consumed != 1 {
+		t.Errorf("Expected 1 issued and 1 consumed, got %+v", stats)
+	}
+}
+
+func TestNoncePurposeMismatch(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	nonce, _ := auth.IssueNonce("oauth-state", time.Minute, nil)
+
+	if _, err := auth.ConsumeNonce(nonce, "device-proof"); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce for purpose mismatch, got %v", err)
+	}
+
+	// A mismatched attempt must not burn the nonce for its real flow
+	if _, err := auth.ConsumeNonce(nonce, "oauth-state"); err != nil {
+		t.Errorf("Expected nonce to remain consumable for its purpose, got %v", err)
+	}
+}
+
+func TestNonceExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+
+	nonce, _ := auth.IssueNonce("challenge", time.Minute, nil)
+	now = now.Add(2 * time.Minute)
+
+	if _, err := auth.ConsumeNonce(nonce, "challenge"); !errors.Is(err, ErrNonceExpired) {
+		t.Errorf("Expected ErrNonceExpired, got %v", err)
+	}
+
+	// Expired entries are pruned on the next issue once the janitor interval passes
+	_, _ = auth.IssueNonce("challenge", time.Second, nil)
+	now = now.Add(2 * time.Minute)
+	_, _ = auth.IssueNonce("challenge", time.Minute, nil)
+
+	if stats := auth.NonceStats(); stats.Expired != 2 {
+		t.Errorf("Expected 2 expired nonces, got %+v", stats)
+	}
+}
+
+func TestNonceConcurrentConsume(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	nonce, _ := auth.IssueNonce("race", time.Minute, nil)
+
+	var successes atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := auth.ConsumeNonce(nonce, "race"); err == nil {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes.Load() != 1 {
+		t.Errorf("Expected exactly one successful consume, got %d", successes.Load())
+	}
+}
@@ -0,0 +1,196 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// stateCookieName is the cookie binding a pending sign-in to the browser
+const stateCookieName = "authkit_oauth_state"
+
+// RegisterRoutes mounts the Gin handlers on r: GET /:provider,
+// /:provider/callback and /:provider/link, the latter behind the AuthKit
+// middleware
+//
+//	social.RegisterRoutes(r.Group("/auth"))
+func (o *Client) RegisterRoutes(r gin.IRouter) {
+	r.GET("/:provider", o.LoginHandler)
+	r.GET("/:provider/callback", o.CallbackHandler)
+	r.GET("/:provider/link", o.auth.GinMiddleware(), o.LinkHandler)
+}
+
+// RegisterRoutesFiber is RegisterRoutes for Fiber
+func (o *Client) RegisterRoutesFiber(r fiber.Router) {
+	r.Get("/:provider", o.LoginHandlerFiber)
+	r.Get("/:provider/callback", o.CallbackHandlerFiber)
+	r.Get("/:provider/link", o.auth.FiberMiddleware(), o.LinkHandlerFiber)
+}
+
+// LoginHandler redirects to the sign-in page of the provider named by the
+// :provider path parameter, setting the state cookie CallbackHandler checks
+func (o *Client) LoginHandler(c *gin.Context) {
+	authURL, state, err := o.AuthCodeURL(c.Param("provider"))
+	o.ginRedirect(c, authURL, state, err)
+}
+
+// LinkHandler is LoginHandler for linking the provider to the logged-in
+// user, behind the AuthKit middleware. Browsers following a link only send
+// the access token with cookie transport, see authkit.CookieConfig;
+// clients holding the token can call LinkURL from their own handler instead.
+func (o *Client) LinkHandler(c *gin.Context) {
+	claims, ok := authkit.GetUserFromGinContext(c)
+	if !ok {
+		o.auth.RespondError(c, authkit.ErrUnauthorized)
+		return
+	}
+	authURL, state, err := o.LinkURL(c.Param("provider"), claims.UserID)
+	o.ginRedirect(c, authURL, state, err)
+}
+
+// ginRedirect sends the browser to the provider with the state cookie set
+func (o *Client) ginRedirect(c *gin.Context, authURL, state string, err error) {
+	if err != nil {
+		o.auth.RespondError(c, err)
+		return
+	}
+	http.SetCookie(c.Writer, o.stateCookie(state))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// CallbackHandler completes the sign-in when the provider redirects back,
+// checking the state against the cookie, and responds like the AuthKit login
+// handlers, with the tokens or an MFA challenge. Users are found and created
+// in the tenant authkit.Config.TenantResolver resolves for the callback.
+func (o *Client) CallbackHandler(c *gin.Context) {
+	cookie, _ := c.Cookie(stateCookieName)
+	http.SetCookie(c.Writer, o.stateCookie(""))
+	state := c.Query("state")
+	if err := checkCallback(state, cookie, c.Query("error")); err != nil {
+		o.auth.RespondError(c, err)
+		return
+	}
+
+	tenantID, ok := o.auth.ResolveTenantGin(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := o.HandleCallback(c.Request.Context(), c.Param("provider"), c.Query("code"), state, authkit.LoginOptions{
+		TenantID: tenantID,
+		Context:  authkit.LoginContext{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()},
+	})
+	if err != nil {
+		o.auth.RespondError(c, err)
+		return
+	}
+	o.auth.RespondTokens(c, tokens)
+}
+
+// LoginHandlerFiber is LoginHandler for Fiber
+func (o *Client) LoginHandlerFiber(c *fiber.Ctx) error {
+	authURL, state, err := o.AuthCodeURL(c.Params("provider"))
+	return o.fiberRedirect(c, authURL, state, err)
+}
+
+// LinkHandlerFiber is LinkHandler for Fiber
+func (o *Client) LinkHandlerFiber(c *fiber.Ctx) error {
+	claims, ok := authkit.GetUserFromFiberContext(c)
+	if !ok {
+		return o.auth.RespondErrorFiber(c, authkit.ErrUnauthorized)
+	}
+	authURL, state, err := o.LinkURL(c.Params("provider"), claims.UserID)
+	return o.fiberRedirect(c, authURL, state, err)
+}
+
+// fiberRedirect sends the browser to the provider with the state cookie set
+func (o *Client) fiberRedirect(c *fiber.Ctx, authURL, state string, err error) error {
+	if err != nil {
+		return o.auth.RespondErrorFiber(c, err)
+	}
+	c.Cookie(fiberCookie(o.stateCookie(state)))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// CallbackHandlerFiber is CallbackHandler for Fiber
+func (o *Client) CallbackHandlerFiber(c *fiber.Ctx) error {
+	cookie := c.Cookies(stateCookieName)
+	c.Cookie(fiberCookie(o.stateCookie("")))
+	state := c.Query("state")
+	if err := checkCallback(state, cookie, c.Query("error")); err != nil {
+		return o.auth.RespondErrorFiber(c, err)
+	}
+
+	tenantID, ok := o.auth.ResolveTenantFiber(c)
+	if !ok {
+		return nil
+	}
+
+	tokens, err := o.HandleCallback(c.UserContext(), c.Params("provider"), c.Query("code"), state, authkit.LoginOptions{
+		TenantID: tenantID,
+		Context:  authkit.LoginContext{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)},
+	})
+	if err != nil {
+		return o.auth.RespondErrorFiber(c, err)
+	}
+	return o.auth.RespondTokensFiber(c, tokens)
+}
+
+// checkCallback rejects redirects reporting a provider error, such as the
+// user denying access, and states not matching the cookie, which could be
+// another browser's sign-in forced on this one
+func checkCallback(state, cookie, providerError string) error {
+	if providerError != "" {
+		return &authkit.AuthError{
+			Code:   authkit.CodeIdentityProviderFailed,
+			Status: http.StatusUnauthorized,
+			Err:    fmt.Errorf("%w: %s", authkit.ErrIdentityProviderFailed, providerError),
+		}
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		return authkit.ErrInvalidNonce
+	}
+	return nil
+}
+
+// stateCookie returns the state cookie, or an expired one clearing it for an
+// empty state. It must survive the cross-site redirect back, so it is Lax.
+func (o *Client) stateCookie(state string) *http.Cookie {
+	maxAge := int(o.config.StateExpiry.Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+	return &http.Cookie{
+		Name:     stateCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   !o.config.InsecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// fiberCookie converts a cookie built by stateCookie for Fiber
+func fiberCookie(cookie *http.Cookie) *fiber.Cookie {
+	fc := &fiber.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		MaxAge:   cookie.MaxAge,
+		HTTPOnly: cookie.HttpOnly,
+		Secure:   cookie.Secure,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if cookie.MaxAge < 0 {
+		// fasthttp only deletes cookies through an expiry in the past
+		fc.MaxAge = 0
+		fc.Expires = time.Unix(0, 0)
+	}
+	return fc
+}
@@ -0,0 +1,321 @@
+// Package oauth adds "Sign in with Google/GitHub" to AuthKit. It runs the
+// OAuth2 authorization code flow with PKCE against the provider, fetches the
+// user's profile and logs them in with AuthKit.LoginWithIdentity, which
+// finds, links or creates the AuthKit user.
+//
+//	social, err := oauth.New(auth, oauth.Config{
+//	    Providers: []oauth.Provider{
+//	        oauth.Google(googleClientID, googleSecret, "https://example.com/auth/google/callback"),
+//	        oauth.GitHub(githubClientID, githubSecret, "https://example.com/auth/github/callback"),
+//	    },
+//	})
+//	social.RegisterRoutes(r.Group("/auth"))
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+)
+
+// NoncePurpose is the AuthKit nonce purpose of the state of pending sign-ins
+const NoncePurpose = "oauth_state"
+
+// maxResponseSize bounds the responses read from providers
+const maxResponseSize = 1 << 20
+
+// Provider is an OAuth2 identity provider users can sign in with. Google and
+// GitHub return the built-in ones.
+type Provider struct {
+	// Name identifies the provider in URLs and LinkedIdentity.Provider
+	Name         string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the provider
+	RedirectURL string
+	AuthURL     string
+	TokenURL    string
+	// ProfileURL is the endpoint Profile reads the user's profile from
+	ProfileURL string
+	Scopes     []string
+	// OpenID sends an OpenID Connect nonce, which Profile must check
+	// against Token.Nonce
+	OpenID bool
+	// Profile fetches the signed-in user's identity with the provider's token
+	Profile func(ctx context.Context, client *http.Client, p *Provider, token *Token) (*authkit.ExternalIdentity, error)
+}
+
+// Token is a provider's response to the code exchange
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token"`
+	// Nonce is the OpenID Connect nonce the ID token must carry
+	Nonce string `json:"-"`
+}
+
+// Config configures a Client
+type Config struct {
+	Providers []Provider
+	// HTTPClient makes the requests to the providers (default: a client
+	// with a 10s timeout)
+	HTTPClient *http.Client
+	// StateExpiry is how long users have to sign in with the provider
+	// (default: 10m)
+	StateExpiry time.Duration
+	// InsecureCookies sends the state cookie of the handlers without the
+	// Secure attribute, for development over plain HTTP
+	InsecureCookies bool
+}
+
+// Client signs users in to an AuthKit with OAuth2 identity providers
+type Client struct {
+	auth      *authkit.AuthKit
+	config    Config
+	providers map[string]*Provider
+}
+
+// New creates a Client for auth, returning an error wrapping
+// authkit.ErrInvalidConfig for incomplete or duplicate providers
+func New(auth *authkit.AuthKit, config Config) (*Client, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.StateExpiry == 0 {
+		config.StateExpiry = 10 * time.Minute
+	}
+	if config.StateExpiry < 0 {
+		return nil, fmt.Errorf("%w: negative StateExpiry", authkit.ErrInvalidConfig)
+	}
+
+	providers := make(map[string]*Provider, len(config.Providers))
+	for i := range config.Providers {
+		p := config.Providers[i]
+		if p.Name == "" || p.ClientID == "" || p.RedirectURL == "" || p.AuthURL == "" || p.TokenURL == "" || p.Profile == nil {
+			return nil, fmt.Errorf("%w: provider %q needs a name, client ID, redirect URL, endpoints and Profile", authkit.ErrInvalidConfig, p.Name)
+		}
+		if _, exists := providers[p.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate provider %q", authkit.ErrInvalidConfig, p.Name)
+		}
+		p.Scopes = append([]string(nil), p.Scopes...)
+		providers[p.Name] = &p
+	}
+	return &Client{auth: auth, config: config, providers: providers}, nil
+}
+
+// AuthCodeURL returns the URL of the provider's sign-in page and the state
+// of the sign-in. The state is single-use and expires after
+// Config.StateExpiry; bind it to the browser, e.g. in a cookie as the
+// handlers do, and check it comes back with the callback before calling
+// HandleCallback.
+func (o *Client) AuthCodeURL(provider string) (authURL, state string, err error) {
+	return o.authCodeURL(provider, "")
+}
+
+// LinkURL is AuthCodeURL for linking the provider to a logged-in user:
+// HandleCallback links the identity to the user before logging them in
+func (o *Client) LinkURL(provider, userID string) (authURL, state string, err error) {
+	if userID == "" {
+		return "", "", authkit.ErrUserNotFound
+	}
+	return o.authCodeURL(provider, userID)
+}
+
+// authCodeURL starts a sign-in, storing the PKCE verifier, the OpenID nonce
+// and the user to link in an AuthKit nonce whose value is the state
+func (o *Client) authCodeURL(provider, userID string) (string, string, error) {
+	p, ok := o.providers[provider]
+	if !ok {
+		return "", "", authkit.ErrUnknownIdentityProvider
+	}
+
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	meta := map[string]string{"provider": p.Name, "verifier": verifier}
+	if userID != "" {
+		meta["user_id"] = userID
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.Scopes) > 0 {
+		params.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if p.OpenID {
+		nonce, err := randomString()
+		if err != nil {
+			return "", "", err
+		}
+		meta["nonce"] = nonce
+		params.Set("nonce", nonce)
+	}
+
+	state, err := o.auth.IssueNonce(NoncePurpose, o.config.StateExpiry, meta)
+	if err != nil {
+		return "", "", err
+	}
+	params.Set("state", state)
+
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + params.Encode(), state, nil
+}
+
+// HandleCallback completes a sign-in started by AuthCodeURL or LinkURL with
+// the code and state the provider redirected back with: it consumes the
+// state, exchanges the code, fetches the profile and logs the user in with
+// AuthKit.LoginWithIdentity, returning the same TokenResponse as LoginUser.
+// Unknown, used or expired states fail with authkit.ErrInvalidNonce or
+// authkit.ErrNonceExpired, provider errors with
+// authkit.ErrIdentityProviderFailed.
+func (o *Client) HandleCallback(ctx context.Context, provider, code, state string, opts authkit.LoginOptions) (*authkit.TokenResponse, error) {
+	p, ok := o.providers[provider]
+	if !ok {
+		return nil, authkit.ErrUnknownIdentityProvider
+	}
+	meta, err := o.auth.ConsumeNonce(state, NoncePurpose)
+	if err != nil {
+		return nil, err
+	}
+	if meta["provider"] != p.Name {
+		return nil, authkit.ErrInvalidNonce
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%w: no authorization code", authkit.ErrIdentityProviderFailed)
+	}
+
+	token, err := o.exchange(ctx, p, code, meta["verifier"])
+	if err != nil {
+		return nil, err
+	}
+	token.Nonce = meta["nonce"]
+	identity, err := p.Profile(ctx, o.config.HTTPClient, p, token)
+	if err != nil {
+		return nil, err
+	}
+	if identity == nil || identity.Subject == "" {
+		return nil, fmt.Errorf("%w: profile without a user ID", authkit.ErrIdentityProviderFailed)
+	}
+	identity.Provider = p.Name
+
+	if userID := meta["user_id"]; userID != "" {
+		if err := o.auth.LinkIdentity(userID, *identity); err != nil {
+			return nil, err
+		}
+		user, err := o.auth.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		opts.TenantID = user.TenantID
+	}
+	return o.auth.LoginWithIdentityCtx(ctx, *identity, opts)
+}
+
+// exchange trades an authorization code for the provider's token
+func (o *Client) exchange(ctx context.Context, p *Provider, code, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		Token
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := doJSON(o.config.HTTPClient, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	// GitHub reports errors with a 200
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: code exchange: %s %s", authkit.ErrIdentityProviderFailed, resp.Error, resp.ErrorDescription)
+	}
+	if status != http.StatusOK || resp.AccessToken == "" {
+		return nil, fmt.Errorf("%w: code exchange: status %d without access token", authkit.ErrIdentityProviderFailed, status)
+	}
+	return &resp.Token, nil
+}
+
+// GetJSON fetches url with the provider's access token and decodes the JSON
+// response into v, for Profile implementations
+func GetJSON(ctx context.Context, client *http.Client, url string, token *Token, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	status, err := doJSON(client, req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", authkit.ErrIdentityProviderFailed, url, status)
+	}
+	return nil
+}
+
+// doJSON sends req and decodes the JSON response into v, returning the status
+func doJSON(client *http.Client, req *http.Request, v interface{}) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", authkit.ErrIdentityProviderFailed, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", authkit.ErrIdentityProviderFailed, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: malformed response from %s", authkit.ErrIdentityProviderFailed, req.URL.Host)
+	}
+	return resp.StatusCode, nil
+}
+
+// randomString returns 256 random bits, base64url-encoded, as PKCE verifiers
+// and OpenID nonces
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// pkceChallenge returns the S256 code challenge of a PKCE verifier (RFC 7636)
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
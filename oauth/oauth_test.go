@@ -0,0 +1,455 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is an OAuth2 provider serving both the Google token endpoint,
+// with ID tokens, and the GitHub API, for one user
+type fakeProvider struct {
+	server   *httptest.Server
+	subject  string
+	email    string
+	verified bool
+	// badNonce makes ID tokens carry the wrong nonce
+	badNonce bool
+
+	mutex  sync.Mutex
+	grants map[string]url.Values // Authorization requests by code
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{subject: "1001", email: "octo@example.com", verified: true, grants: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id, _ := json.Number(f.subject).Int64()
+		writeJSON(w, map[string]interface{}{"id": id, "login": "octocat", "avatar_url": "https://avatars.example.com/octocat"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, []map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": f.email, "primary": true, "verified": f.verified},
+		})
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// approve plays the user signing in at authURL, returning the code the
+// provider redirects back with
+func (f *fakeProvider) approve(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("state") == "" {
+		t.Fatalf("Expected a PKCE challenge and a state, got %s", authURL)
+	}
+	code := "code-" + query.Get("state")[:8]
+	f.mutex.Lock()
+	f.grants[code] = query
+	f.mutex.Unlock()
+	return code
+}
+
+// token exchanges codes, checking the client, redirect URI and PKCE verifier
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	grant, exists := f.grants[r.FormValue("code")]
+	delete(f.grants, r.FormValue("code"))
+	f.mutex.Unlock()
+
+	switch {
+	case !exists:
+		writeJSON(w, map[string]string{"error": "bad_verification_code"})
+		return
+	case r.FormValue("client_id") != grant.Get("client_id") || r.FormValue("client_secret") != "secret" ||
+		r.FormValue("redirect_uri") != grant.Get("redirect_uri"):
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"error": "invalid_client"})
+		return
+	case pkceChallenge(r.FormValue("code_verifier")) != grant.Get("code_challenge"):
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := grant.Get("nonce")
+	if f.badNonce {
+		nonce = "forged"
+	}
+	idToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            grant.Get("client_id"),
+		"sub":            f.subject,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          f.email,
+		"email_verified": f.verified,
+		"name":           "Octo Cat",
+		"picture":        "https://avatars.example.com/octocat",
+	}).SignedString([]byte("unchecked"))
+	writeJSON(w, map[string]string{"access_token": "access-" + f.subject, "token_type": "bearer", "id_token": idToken})
+}
+
+func (f *fakeProvider) authorized(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "Bearer access-"+f.subject
+}
+
+// providers returns the built-in providers pointed at the fake
+func (f *fakeProvider) providers() []Provider {
+	google := Google("google-client", "secret", "https://app.example.com/auth/google/callback")
+	google.AuthURL = f.server.URL + "/authorize"
+	google.TokenURL = f.server.URL + "/token"
+	github := GitHub("github-client", "secret", "https://app.example.com/auth/github/callback")
+	github.AuthURL = f.server.URL + "/authorize?allow_signup=true"
+	github.TokenURL = f.server.URL + "/token"
+	github.ProfileURL = f.server.URL + "/user"
+	return []Provider{google, github}
+}
+
+func newTestClient(t *testing.T, config authkit.Config) (*authkit.AuthKit, *Client, *fakeProvider) {
+	t.Helper()
+	config.JWTSecret = "test-secret-key-for-testing-only"
+	config.BCryptCost = 4
+	auth := authkit.New(config)
+	t.Cleanup(func() { auth.Close() })
+
+	fake := newFakeProvider(t)
+	client, err := New(auth, Config{Providers: fake.providers()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth, client, fake
+}
+
+// routes serves the handlers of every framework under /auth
+func routes(client *Client) map[string]http.Handler {
+	r := gin.New()
+	client.RegisterRoutes(r.Group("/auth"))
+
+	app := fiber.New()
+	client.RegisterRoutesFiber(app.Group("/auth"))
+
+	return map[string]http.Handler{
+		"gin": r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			resp, err := app.Test(req)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			defer resp.Body.Close()
+			for key, values := range resp.Header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(resp.StatusCode)
+			_, _ = io.Copy(w, resp.Body)
+		}),
+	}
+}
+
+// start requests path, which redirects to the provider, returning the
+// redirect and the state cookie
+func start(t *testing.T, handler http.Handler, path, accessToken string) (string, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the provider, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == stateCookieName && cookie.HttpOnly && cookie.Secure && cookie.SameSite == http.SameSiteLaxMode {
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatalf("Expected a secure state cookie, got %v", w.Header()["Set-Cookie"])
+	return "", nil
+}
+
+// callback sends the provider's redirect back with the state cookie
+func callback(handler http.Handler, provider string, query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/"+provider+"/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// signIn runs a sign-in with provider through the handlers
+func signIn(t *testing.T, handler http.Handler, fake *fakeProvider, path, provider, accessToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	authURL, cookie := start(t, handler, path, accessToken)
+	code := fake.approve(t, authURL)
+	state, _ := url.Parse(authURL)
+	return callback(handler, provider, url.Values{"code": {code}, "state": {state.Query().Get("state")}}, cookie)
+}
+
+// decodeTokens checks for a 200 with tokens and decodes them
+func decodeTokens(t *testing.T, w *httptest.ResponseRecorder) authkit.TokenResponse {
+	t.Helper()
+	var tokens authkit.TokenResponse
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Expected tokens, got %s", w.Body.String())
+	}
+	return tokens
+}
+
+// checkError checks an AuthKit error response
+func checkError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != status || resp.Error.Code != code {
+		t.Fatalf("Expected %d %s, got %d: %s", status, code, w.Code, w.Body.String())
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	for _, provider := range []string{"google", "github"} {
+		auth, client, fake := newTestClient(t, authkit.Config{})
+		for name, handler := range routes(client) {
+			t.Run(provider+"/"+name, func(t *testing.T) {
+				tokens := decodeTokens(t, signIn(t, handler, fake, "/auth/"+provider, provider, ""))
+				user, err := auth.GetUserByIdentity(provider, "1001")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tokens.User.ID != user.ID || user.Email != "octo@example.com" || !user.EmailVerified || user.Name == "" {
+					t.Errorf("Expected a verified user from the profile, got %+v", user)
+				}
+				if len(user.Identities) != 1 || user.Identities[0].AvatarURL != "https://avatars.example.com/octocat" {
+					t.Errorf("Expected the identity to be linked with its avatar, got %+v", user.Identities)
+				}
+				if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+					t.Errorf("Expected a valid access token, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestCallbackRejectsBadState(t *testing.T) {
+	_, client, fake := newTestClient(t, authkit.Config{})
+	for name, handler := range routes(client) {
+		t.Run(name, func(t *testing.T) {
+			authURL, cookie := start(t, handler, "/auth/github", "")
+			query := url.Values{"code": {fake.approve(t, authURL)}}
+			parsed, _ := url.Parse(authURL)
+			state := parsed.Query().Get("state")
+
+			query.Set("state", state)
+			checkError(t, callback(handler, "github", query, nil), http.StatusBadRequest, authkit.CodeInvalidNonce)
+			checkError(t, callback(handler, "github", query, &http.Cookie{Name: stateCookieName, Value: "other"}), http.StatusBadRequest, authkit.CodeInvalidNonce)
+			checkError(t, callback(handler, "google", query, cookie), http.StatusBadRequest, authkit.CodeInvalidNonce)
+
+			// The state was consumed by the callback for the wrong provider
+			checkError(t, callback(handler, "github", query, cookie), http.StatusBadRequest, authkit.CodeInvalidNonce)
+
+			denied := url.Values{"error": {"access_denied"}, "state": {state}}
+			checkError(t, callback(handler, "github", denied, cookie), http.StatusUnauthorized, authkit.CodeIdentityProviderFailed)
+		})
+	}
+}
+
+func TestCallbackProviderFailures(t *testing.T) {
+	_, client, fake := newTestClient(t, authkit.Config{})
+	handler := routes(client)["gin"]
+
+	// A code exchanged with another verifier fails PKCE
+	authURL, cookie := start(t, handler, "/auth/github", "")
+	code := fake.approve(t, authURL)
+	fake.grants[code].Set("code_challenge", pkceChallenge("another verifier"))
+	parsed, _ := url.Parse(authURL)
+	w := callback(handler, "github", url.Values{"code": {code}, "state": {parsed.Query().Get("state")}}, cookie)
+	checkError(t, w, http.StatusBadGateway, authkit.CodeIdentityProviderFailed)
+
+	fake.badNonce = true
+	w = signIn(t, handler, fake, "/auth/google", "google", "")
+	checkError(t, w, http.StatusBadGateway, authkit.CodeIdentityProviderFailed)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/gitlab", nil))
+	checkError(t, w, http.StatusNotFound, authkit.CodeUnknownIdentityProvider)
+}
+
+func TestSignInEmailCollision(t *testing.T) {
+	for _, linkByEmail := range []bool{false, true} {
+		auth, client, fake := newTestClient(t, authkit.Config{LinkIdentitiesByEmail: linkByEmail})
+		registered, err := auth.RegisterUser(authkit.RegisterRequest{Email: "octo@example.com", Password: "password123", Name: "Octo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := routes(client)["gin"]
+
+		fake.verified = false
+		checkError(t, signIn(t, handler, fake, "/auth/github", "github", ""), http.StatusConflict, authkit.CodeIdentityNotLinked)
+
+		fake.verified = true
+		w := signIn(t, handler, fake, "/auth/github", "github", "")
+		if !linkByEmail {
+			checkError(t, w, http.StatusConflict, authkit.CodeIdentityNotLinked)
+			continue
+		}
+		if tokens := decodeTokens(t, w); tokens.User.ID != registered.ID {
+			t.Errorf("Expected the registered user to be logged in, got %+v", tokens.User)
+		}
+	}
+}
+
+func TestSignInTenants(t *testing.T) {
+	auth, client, fake := newTestClient(t, authkit.Config{
+		LinkIdentitiesByEmail: true,
+		TenantResolver:        &authkit.TenantResolver{Header: "X-Tenant-ID", Required: true},
+	})
+	users := map[string]string{}
+	for _, tenant := range []string{"acme", "globex"} {
+		user, err := auth.RegisterUser(authkit.RegisterRequest{TenantID: tenant, Email: "octo@example.com", Password: "password123", Name: "Octo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[tenant] = user.ID
+	}
+
+	for name, handler := range routes(client) {
+		t.Run(name, func(t *testing.T) {
+			for _, tenant := range []string{"globex", "acme"} {
+				authURL, cookie := start(t, handler, "/auth/github", "")
+				parsed, _ := url.Parse(authURL)
+				query := url.Values{"code": {fake.approve(t, authURL)}, "state": {parsed.Query().Get("state")}}
+				req := httptest.NewRequest(http.MethodGet, "/auth/github/callback?"+query.Encode(), nil)
+				req.Header.Set("X-Tenant-ID", tenant)
+				req.AddCookie(cookie)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+
+				tokens := decodeTokens(t, w)
+				if tokens.User.ID != users[tenant] || tokens.User.TenantID != tenant {
+					t.Errorf("Expected the %s user to be logged in, got %+v", tenant, tokens.User)
+				}
+			}
+
+			// Without the required tenant the callback is rejected
+			checkError(t, signIn(t, handler, fake, "/auth/github", "github", ""), http.StatusBadRequest, authkit.CodeTenantRequired)
+		})
+	}
+
+	for tenant, userID := range users {
+		user, _ := auth.GetUserByID(userID)
+		if len(user.Identities) != 1 || user.TenantID != tenant {
+			t.Errorf("Expected the identity linked to the %s user only, got %+v", tenant, user)
+		}
+	}
+}
+
+func TestLinkProviders(t *testing.T) {
+	auth, client, fake := newTestClient(t, authkit.Config{})
+	if _, err := auth.RegisterUser(authkit.RegisterRequest{Email: "user@example.com", Password: "password123", Name: "User"}); err != nil {
+		t.Fatal(err)
+	}
+	login, err := auth.LoginUser("user@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, handler := range routes(client) {
+		t.Run(name, func(t *testing.T) {
+			for _, provider := range []string{"github", "google"} {
+				tokens := decodeTokens(t, signIn(t, handler, fake, "/auth/"+provider+"/link", provider, login.AccessToken))
+				if tokens.User.ID != login.User.ID {
+					t.Errorf("Expected %s to log in the linked user, got %+v", provider, tokens.User)
+				}
+			}
+			user, _ := auth.GetUserByID(login.User.ID)
+			if len(user.Identities) != 2 || user.Email != "user@example.com" {
+				t.Errorf("Expected both providers linked to the user, got %+v", user.Identities)
+			}
+
+			// Signing in again logs in the linked user
+			tokens := decodeTokens(t, signIn(t, handler, fake, "/auth/github", "github", ""))
+			if tokens.User.ID != login.User.ID {
+				t.Errorf("Expected the linked user to be logged in, got %+v", tokens.User)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/github/link", nil))
+			checkError(t, w, http.StatusUnauthorized, authkit.CodeMissingAuthorization)
+		})
+	}
+
+	// The identity can't be linked to a second user
+	other, err := auth.RegisterUser(authkit.RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, state, err := client.LinkURL("github", other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HandleCallback(context.Background(), "github", fake.approve(t, authURL), state, authkit.LoginOptions{}); !errors.Is(err, authkit.ErrIdentityAlreadyLinked) {
+		t.Errorf("Expected ErrIdentityAlreadyLinked, got %v", err)
+	}
+}
+
+func TestNewValidatesProviders(t *testing.T) {
+	auth := authkit.New(authkit.Config{JWTSecret: "test-secret-key-for-testing-only"})
+	defer auth.Close()
+
+	incomplete := GitHub("", "secret", "https://app.example.com/callback")
+	for name, providers := range map[string][]Provider{
+		"incomplete": {incomplete},
+		"duplicate":  {Google("a", "b", "https://c"), Google("d", "e", "https://f")},
+	} {
+		if _, err := New(auth, Config{Providers: providers}); !errors.Is(err, authkit.ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+	if !strings.HasPrefix(Google("a", "b", "c").AuthURL, "https://accounts.google.com/") {
+		t.Error("Expected Google's authorization endpoint")
+	}
+}
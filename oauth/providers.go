@@ -0,0 +1,130 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Google returns the Google provider, named "google". Profiles come from the
+// OpenID Connect ID token, with the email Google verified.
+func Google(clientID, clientSecret, redirectURL string) Provider {
+	return Provider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		Scopes:       []string{"openid", "email", "profile"},
+		OpenID:       true,
+		Profile:      googleProfile,
+	}
+}
+
+// googleIssuers are the issuers of Google ID tokens
+var googleIssuers = map[string]bool{"https://accounts.google.com": true, "accounts.google.com": true}
+
+// googleClaims are the claims read from Google ID tokens
+type googleClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// googleProfile reads the identity from the ID token. Its signature isn't
+// checked: it came straight from Google's token endpoint over TLS (OpenID
+// Connect Core section 3.1.3.7), but its issuer, audience, expiry and nonce
+// are.
+func googleProfile(ctx context.Context, client *http.Client, p *Provider, token *Token) (*authkit.ExternalIdentity, error) {
+	var claims googleClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token.IDToken, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token", authkit.ErrIdentityProviderFailed)
+	}
+
+	switch {
+	case !googleIssuers[claims.Issuer]:
+		return nil, fmt.Errorf("%w: ID token from issuer %q", authkit.ErrIdentityProviderFailed, claims.Issuer)
+	case len(claims.Audience) != 1 || claims.Audience[0] != p.ClientID:
+		return nil, fmt.Errorf("%w: ID token for another client", authkit.ErrIdentityProviderFailed)
+	case claims.ExpiresAt == nil || !time.Now().Before(claims.ExpiresAt.Time):
+		return nil, fmt.Errorf("%w: expired ID token", authkit.ErrIdentityProviderFailed)
+	case claims.Nonce == "" || claims.Nonce != token.Nonce:
+		return nil, fmt.Errorf("%w: ID token nonce mismatch", authkit.ErrIdentityProviderFailed)
+	}
+	return &authkit.ExternalIdentity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// GitHub returns the GitHub provider, named "github". GitHub doesn't support
+// OpenID Connect, so profiles come from its REST API, with the primary email
+// from the user's email addresses.
+func GitHub(clientID, clientSecret, redirectURL string) Provider {
+	return Provider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		ProfileURL:   "https://api.github.com/user",
+		Scopes:       []string{"read:user", "user:email"},
+		Profile:      githubProfile,
+	}
+}
+
+// githubProfile fetches the user and their primary email from the GitHub API
+func githubProfile(ctx context.Context, client *http.Client, p *Provider, token *Token) (*authkit.ExternalIdentity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := GetJSON(ctx, client, p.ProfileURL, token, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: profile without a user ID", authkit.ErrIdentityProviderFailed)
+	}
+
+	// The profile's email is only the public one, and doesn't say whether
+	// it was verified
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := GetJSON(ctx, client, p.ProfileURL+"/emails", token, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &authkit.ExternalIdentity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,363 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OAuth2 grant types accepted by TokenEndpointHandler
+const (
+	GrantTypePassword          = "password"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuth2 error codes (RFC 6749 section 5.2)
+const (
+	oauth2InvalidRequest         = "invalid_request"
+	oauth2InvalidClient          = "invalid_client"
+	oauth2InvalidGrant           = "invalid_grant"
+	oauth2UnsupportedGrantType   = "unsupported_grant_type"
+	oauth2InvalidScope           = "invalid_scope"
+	oauth2ServerError            = "server_error"
+	oauth2TemporarilyUnavailable = "temporarily_unavailable"
+)
+
+// maxOAuth2FormSize bounds the form body of token requests
+const maxOAuth2FormSize = 64 << 10
+
+// OAuth2TokenResponse is the successful response of TokenEndpointHandler
+// (RFC 6749 section 5.1)
+type OAuth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Scope is the permissions granted, space-separated, for requests
+	// with a scope
+	Scope string `json:"scope,omitempty"`
+	// IDToken is the OpenID Connect ID token of users, set with Config.OIDC
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// OAuth2Error is the error response of TokenEndpointHandler (RFC 6749
+// section 5.2). Descriptions are the English messages of the AuthKit error
+// codes.
+type OAuth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// oauth2Request is a token endpoint request as read by the handlers
+type oauth2Request struct {
+	contentType   string
+	body          io.Reader
+	authorization string // The Authorization header, for client authentication
+	tenantID      string
+	client        LoginContext
+	limitedIP     string // The client IP the rate limit is keyed on
+}
+
+// oauth2Failure is an OAuth2 error with the status and headers to send it with
+type oauth2Failure struct {
+	status     int
+	err        OAuth2Error
+	challenge  bool          // Ask for HTTP Basic client authentication
+	retryAfter time.Duration // Set for rate limited requests
+}
+
+// newOAuth2Failure returns a failure with the message of an AuthKit error code
+// as description
+func newOAuth2Failure(status int, code, authkitCode string) *oauth2Failure {
+	return &oauth2Failure{status: status, err: OAuth2Error{Code: code, Description: errorDescription(authkitCode)}}
+}
+
+// oauth2Response runs a token endpoint request, returning the status, the
+// headers and the body to respond with
+func (a *AuthKit) oauth2Response(ctx context.Context, req oauth2Request) (int, http.Header, interface{}) {
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	header := http.Header{}
+	header.Set("Cache-Control", "no-store")
+	header.Set("Pragma", "no-cache")
+
+	tokens, failure := a.oauth2Token(ctx, req)
+	if failure == nil {
+		return http.StatusOK, header, tokens
+	}
+	if failure.challenge {
+		header.Set("WWW-Authenticate", `Basic realm="`+a.config.BearerRealm+`"`)
+	}
+	if failure.retryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(retryAfterSeconds(failure.retryAfter)))
+	}
+	return failure.status, header, failure.err
+}
+
+// oauth2Token authenticates the client and runs the grant of a token request
+func (a *AuthKit) oauth2Token(ctx context.Context, req oauth2Request) (*OAuth2TokenResponse, *oauth2Failure) {
+	form, failure := parseOAuth2Form(req.contentType, req.body)
+	if failure != nil {
+		return nil, failure
+	}
+	scope, ok := parseScope(form.Get("scope"))
+	if !ok {
+		return nil, &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2InvalidScope, Description: "Malformed scope"}}
+	}
+	scope = a.withoutOIDCScopes(scope)
+
+	client, failure := a.oauth2Client(form, req.authorization)
+	if failure != nil {
+		return nil, failure
+	}
+	if allowed, wait := a.allowClient(req.limitedIP, form.Get("username")); !allowed {
+		failure := newOAuth2Failure(http.StatusTooManyRequests, oauth2TemporarilyUnavailable, CodeRateLimited)
+		failure.retryAfter = wait
+		return nil, failure
+	}
+
+	var tokens *TokenResponse
+	var err error
+	switch grantType := form.Get("grant_type"); grantType {
+	case GrantTypePassword:
+		username, password := form.Get("username"), form.Get("password")
+		if username == "" || password == "" {
+			return nil, oauth2MissingParameter("username and password")
+		}
+		tokens, err = a.LoginUserWithOptionsCtx(ctx, username, password, LoginOptions{TenantID: req.tenantID, Context: req.client, Scope: scope, Nonce: form.Get("nonce")})
+		if err == nil && tokens.MFARequired {
+			// The password grant has no step for a second factor
+			return nil, &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2InvalidGrant, Description: "Two-factor authentication is required"}}
+		}
+	case GrantTypeRefreshToken:
+		refreshToken := form.Get("refresh_token")
+		if refreshToken == "" {
+			return nil, oauth2MissingParameter("refresh_token")
+		}
+		tokens, err = a.refreshTokens(ctx, refreshToken, scope)
+	case GrantTypeClientCredentials:
+		if client == nil {
+			return nil, &oauth2Failure{status: http.StatusUnauthorized, err: OAuth2Error{Code: oauth2InvalidClient, Description: errorDescription(CodeInvalidClientCredentials)}, challenge: true}
+		}
+		tokens, err = a.clientToken(client, scope)
+	case "":
+		return nil, oauth2MissingParameter("grant_type")
+	default:
+		return nil, &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2UnsupportedGrantType, Description: "Unsupported grant type " + strconv.Quote(grantType)}}
+	}
+	if err != nil {
+		return nil, oauth2GrantFailure(err)
+	}
+
+	a.setSessionClient(tokens.SessionID, req.client.UserAgent, req.client.IP)
+	return &OAuth2TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+		IDToken:      tokens.IDToken,
+	}, nil
+}
+
+// oauth2Client authenticates the client of a token request with HTTP Basic
+// authentication or the client_id and client_secret parameters. Requests
+// without a secret are from public clients and get a nil service account,
+// unless the client ID is a service account's, which must authenticate.
+func (a *AuthKit) oauth2Client(form url.Values, authorization string) (*ServiceAccount, *oauth2Failure) {
+	invalid := &oauth2Failure{status: http.StatusUnauthorized, err: OAuth2Error{Code: oauth2InvalidClient, Description: errorDescription(CodeInvalidClientCredentials)}}
+
+	clientID, clientSecret := form.Get("client_id"), form.Get("client_secret")
+	if authorization != "" {
+		invalid.challenge = true
+		if clientSecret != "" {
+			return nil, &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2InvalidRequest, Description: "Only one client authentication method may be used"}}
+		}
+		var ok bool
+		if clientID, clientSecret, ok = parseClientBasicAuth(authorization); !ok {
+			return nil, invalid
+		}
+	} else if clientSecret == "" {
+		if clientID != "" && a.serviceAccountExists(clientID) {
+			return nil, invalid
+		}
+		return nil, nil
+	}
+
+	client, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+// oauth2GrantFailure maps the error of a grant to its OAuth2 error
+func oauth2GrantFailure(err error) *oauth2Failure {
+	code := ErrorCode(err)
+	switch {
+	case errors.Is(err, ErrServerBusy):
+		return newOAuth2Failure(http.StatusServiceUnavailable, oauth2TemporarilyUnavailable, code)
+	case code == CodeInternalError:
+		return newOAuth2Failure(http.StatusInternalServerError, oauth2ServerError, code)
+	}
+	return newOAuth2Failure(http.StatusBadRequest, oauth2InvalidGrant, code)
+}
+
+// oauth2MissingParameter is the invalid_request error of a request missing
+// required parameters
+func oauth2MissingParameter(names string) *oauth2Failure {
+	return &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2InvalidRequest, Description: "Missing " + names}}
+}
+
+// parseOAuth2Form reads the form-encoded body of a token request, rejecting
+// other content types and repeated parameters (RFC 6749 section 3.2)
+func parseOAuth2Form(contentType string, body io.Reader) (url.Values, *oauth2Failure) {
+	invalid := func(description string) *oauth2Failure {
+		return &oauth2Failure{status: http.StatusBadRequest, err: OAuth2Error{Code: oauth2InvalidRequest, Description: description}}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil, invalid("Expected an application/x-www-form-urlencoded body")
+	}
+	raw, err := io.ReadAll(io.LimitReader(body, maxOAuth2FormSize+1))
+	if err != nil || len(raw) > maxOAuth2FormSize {
+		return nil, invalid("Unreadable or oversized body")
+	}
+	form, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return nil, invalid("Malformed form body")
+	}
+	for name, values := range form {
+		if len(values) > 1 {
+			return nil, invalid("Repeated parameter " + strconv.Quote(name))
+		}
+	}
+	return form, nil
+}
+
+// parseClientBasicAuth decodes client credentials sent with HTTP Basic
+// authentication, which are form-encoded before base64 (RFC 6749 section 2.3.1)
+func parseClientBasicAuth(authorization string) (clientID, clientSecret string, ok bool) {
+	scheme, encoded, found := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+	if clientID, err = url.QueryUnescape(rawID); err != nil {
+		return "", "", false
+	}
+	if clientSecret, err = url.QueryUnescape(rawSecret); err != nil {
+		return "", "", false
+	}
+	return clientID, clientSecret, true
+}
+
+// parseScope splits a space-delimited scope parameter (RFC 6749 section 3.3),
+// returning nil for an empty one and false for characters scopes can't hold
+func parseScope(scope string) ([]string, bool) {
+	if scope == "" {
+		return nil, true
+	}
+	for _, r := range scope {
+		if r != ' ' && (r < 0x21 || r > 0x7e || r == '"' || r == '\\') {
+			return nil, false
+		}
+	}
+	return strings.Fields(scope), true
+}
+
+// TokenEndpointHandler is an OAuth2 token endpoint (RFC 6749) for Gin, for
+// clients that can't use LoginHandler and RefreshHandler. It accepts
+// form-encoded password, refresh_token and client_credentials grants, with
+// clients authenticated as service accounts through HTTP Basic authentication
+// or the client_id and client_secret parameters. The scope parameter limits
+// the token's permissions to those listed, see LoginOptions.Scope. Under
+// Config.OIDC, user tokens come with an ID token, password grants take its
+// nonce parameter, and the openid, profile and email scope values are
+// ignored. Errors use the OAuth2 error format rather than the AuthKit one.
+func (a *AuthKit) TokenEndpointHandler(c *gin.Context) {
+	tenantID, ok := a.config.TenantResolver.resolve(c.Param, c.GetHeader, c.Request.Host)
+	if !ok {
+		a.ginRespondOAuth2(c, http.StatusBadRequest, nil, OAuth2Error{Code: oauth2InvalidRequest, Description: errorDescription(CodeTenantRequired)})
+		return
+	}
+
+	status, header, body := a.oauth2Response(c.Request.Context(), oauth2Request{
+		contentType:   c.GetHeader("Content-Type"),
+		body:          c.Request.Body,
+		authorization: c.GetHeader("Authorization"),
+		tenantID:      tenantID,
+		client:        LoginContext{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()},
+		limitedIP:     a.limitedIP(c.Request),
+	})
+	a.ginRespondOAuth2(c, status, header, body)
+}
+
+// ginRespondOAuth2 sends a token endpoint response
+func (a *AuthKit) ginRespondOAuth2(c *gin.Context, status int, header http.Header, body interface{}) {
+	for name, values := range header {
+		c.Header(name, values[0])
+	}
+	c.JSON(status, body)
+}
+
+// TokenEndpointHandlerFiber is TokenEndpointHandler for Fiber
+func (a *AuthKit) TokenEndpointHandlerFiber(c *fiber.Ctx) error {
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(OAuth2Error{Code: oauth2InvalidRequest, Description: errorDescription(CodeTenantRequired)})
+	}
+
+	status, header, body := a.oauth2Response(c.UserContext(), oauth2Request{
+		contentType:   c.Get(fiber.HeaderContentType),
+		body:          bytes.NewReader(c.Body()),
+		authorization: c.Get(fiber.HeaderAuthorization),
+		tenantID:      tenantID,
+		client:        LoginContext{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)},
+		limitedIP:     c.IP(),
+	})
+	for name, values := range header {
+		c.Set(name, values[0])
+	}
+	return c.Status(status).JSON(body)
+}
+
+// TokenEndpointHandlerHTTP is TokenEndpointHandler for net/http
+func (a *AuthKit) TokenEndpointHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := a.config.TenantResolver.resolve(nil, r.Header.Get, r.Host)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, OAuth2Error{Code: oauth2InvalidRequest, Description: errorDescription(CodeTenantRequired)})
+		return
+	}
+
+	status, header, body := a.oauth2Response(r.Context(), oauth2Request{
+		contentType:   r.Header.Get("Content-Type"),
+		body:          r.Body,
+		authorization: r.Header.Get("Authorization"),
+		tenantID:      tenantID,
+		client:        LoginContext{IP: httpClientIP(r), UserAgent: r.UserAgent()},
+		limitedIP:     a.limitedIP(r),
+	})
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	writeJSON(w, status, body)
+}
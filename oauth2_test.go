@@ -0,0 +1,307 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The client credentials of the RFC 6749 examples
+const (
+	rfcClientID     = "s6BhdRkqt3"
+	rfcClientSecret = "gX1fBat3bV"
+	rfcBasicAuth    = "Basic czZCaGRSa3F0MzpnWDFmQmF0M2JW"
+)
+
+// newOAuth2TestKit returns an AuthKit with the client of the RFC examples and
+// an editor, johndoe@example.com, allowed to read and write posts
+func newOAuth2TestKit(t *testing.T, config Config) *AuthKit {
+	t.Helper()
+	auth := newTestKit(t, config)
+	t.Cleanup(func() { auth.Close() })
+
+	auth.serviceAccounts[rfcClientID] = &ServiceAccount{ID: rfcClientID, Name: "Example client", Role: "service", Permissions: []string{"posts:read"}, SecretHash: hashClientSecret(rfcClientSecret)}
+	if err := auth.DefineRole("editor", []string{"posts:read", "posts:write"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.AdminCreateUser(RegisterRequest{Email: "johndoe@example.com", Password: "A3ddj3w-password", Name: "John Doe", Role: "editor"}); err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// tokenEndpoints serves the token endpoint of every framework on /token
+func tokenEndpoints(auth *AuthKit) map[string]http.Handler {
+	r := gin.New()
+	r.POST("/token", auth.TokenEndpointHandler)
+
+	app := fiber.New()
+	app.Post("/token", auth.TokenEndpointHandlerFiber)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", auth.TokenEndpointHandlerHTTP)
+
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  mux,
+	}
+}
+
+// postToken sends a form-encoded token request with an optional Authorization
+// header
+func postToken(handler http.Handler, form, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// decodeTokenResponse checks a successful token response and decodes it
+func decodeTokenResponse(t *testing.T, w *httptest.ResponseRecorder) OAuth2TokenResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected a JSON response, got %q", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Pragma") != "no-cache" {
+		t.Errorf("Expected an uncacheable response, got Cache-Control %q and Pragma %q", w.Header().Get("Cache-Control"), w.Header().Get("Pragma"))
+	}
+	var resp OAuth2TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken == "" || resp.TokenType != "Bearer" || resp.ExpiresIn <= 0 {
+		t.Fatalf("Expected an access token, token type and lifetime, got %s", w.Body.String())
+	}
+	return resp
+}
+
+// checkOAuth2Error checks an error response's status and error code
+func checkOAuth2Error(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected a JSON error, got %q", w.Body.String())
+	}
+	if w.Code != status || resp["error"] != code {
+		t.Fatalf("Expected %d %s, got %d: %s", status, code, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected an uncacheable error, got Cache-Control %q", w.Header().Get("Cache-Control"))
+	}
+}
+
+// RFC 6749 sections 4.3.2, 6 and 4.4.2
+func TestTokenEndpointRFCExamples(t *testing.T) {
+	for name, handler := range tokenEndpoints(newOAuth2TestKit(t, Config{})) {
+		t.Run(name, func(t *testing.T) {
+			w := postToken(handler, "grant_type=password&username=johndoe%40example.com&password=A3ddj3w-password", rfcBasicAuth)
+			tokens := decodeTokenResponse(t, w)
+			if tokens.RefreshToken == "" || tokens.Scope != "" {
+				t.Fatalf("Expected a refresh token and no scope, got %s", w.Body.String())
+			}
+
+			w = postToken(handler, "grant_type=refresh_token&refresh_token="+url.QueryEscape(tokens.RefreshToken), rfcBasicAuth)
+			refreshed := decodeTokenResponse(t, w)
+			if refreshed.RefreshToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+				t.Errorf("Expected a rotated refresh token, got %s", w.Body.String())
+			}
+
+			w = postToken(handler, "grant_type=client_credentials", rfcBasicAuth)
+			client := decodeTokenResponse(t, w)
+			if client.RefreshToken != "" {
+				t.Errorf("Expected no refresh token for client credentials, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenEndpointErrors(t *testing.T) {
+	auth := newOAuth2TestKit(t, Config{})
+	mfaUser, err := auth.AdminCreateUser(RegisterRequest{Email: "mfa@example.com", Password: "password123", Name: "MFA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollTestTOTP(t, auth, mfaUser.ID)
+	wrongSecret := "Basic " + base64.StdEncoding.EncodeToString([]byte(rfcClientID+":wrong"))
+
+	tests := []struct {
+		name          string
+		form          string
+		authorization string
+		status        int
+		code          string
+		challenge     bool
+	}{
+		{"wrong password", "grant_type=password&username=johndoe%40example.com&password=wrong", "", http.StatusBadRequest, "invalid_grant", false},
+		{"unknown user", "grant_type=password&username=nobody%40example.com&password=wrong", "", http.StatusBadRequest, "invalid_grant", false},
+		{"second factor", "grant_type=password&username=mfa%40example.com&password=password123", "", http.StatusBadRequest, "invalid_grant", false},
+		{"invalid refresh token", "grant_type=refresh_token&refresh_token=tGzv3JOkF0XG5Qx2TlKWIA", "", http.StatusBadRequest, "invalid_grant", false},
+		{"missing grant type", "username=johndoe%40example.com&password=A3ddj3w-password", "", http.StatusBadRequest, "invalid_request", false},
+		{"missing password", "grant_type=password&username=johndoe%40example.com", "", http.StatusBadRequest, "invalid_request", false},
+		{"missing refresh token", "grant_type=refresh_token", "", http.StatusBadRequest, "invalid_request", false},
+		{"repeated parameter", "grant_type=password&grant_type=password&username=johndoe%40example.com&password=A3ddj3w-password", "", http.StatusBadRequest, "invalid_request", false},
+		{"unsupported grant type", "grant_type=authorization_code&code=SplxlOBeZQQYbYS6WxSbIA", "", http.StatusBadRequest, "unsupported_grant_type", false},
+		{"malformed scope", "grant_type=password&username=johndoe%40example.com&password=A3ddj3w-password&scope=posts%22read", "", http.StatusBadRequest, "invalid_scope", false},
+		{"wrong basic secret", "grant_type=client_credentials", wrongSecret, http.StatusUnauthorized, "invalid_client", true},
+		{"malformed basic auth", "grant_type=client_credentials", "Basic !!!", http.StatusUnauthorized, "invalid_client", true},
+		{"wrong form secret", "grant_type=client_credentials&client_id=s6BhdRkqt3&client_secret=wrong", "", http.StatusUnauthorized, "invalid_client", false},
+		{"service account without secret", "grant_type=password&client_id=s6BhdRkqt3&username=johndoe%40example.com&password=A3ddj3w-password", "", http.StatusUnauthorized, "invalid_client", false},
+		{"two client authentications", "grant_type=client_credentials&client_secret=gX1fBat3bV", rfcBasicAuth, http.StatusBadRequest, "invalid_request", false},
+		{"unauthenticated client credentials", "grant_type=client_credentials", "", http.StatusUnauthorized, "invalid_client", true},
+	}
+	for name, handler := range tokenEndpoints(auth) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				w := postToken(handler, tt.form, tt.authorization)
+				checkOAuth2Error(t, w, tt.status, tt.code)
+				if challenge := w.Header().Get("WWW-Authenticate"); (challenge != "") != tt.challenge || tt.challenge && !strings.HasPrefix(challenge, "Basic ") {
+					t.Errorf("Expected challenge %v, got %q", tt.challenge, challenge)
+				}
+			})
+		}
+
+		t.Run(name+"/json body", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(`{"grant_type":"password","username":"johndoe@example.com","password":"A3ddj3w-password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			checkOAuth2Error(t, w, http.StatusBadRequest, "invalid_request")
+		})
+	}
+}
+
+func TestTokenEndpointRateLimit(t *testing.T) {
+	for name := range tokenEndpoints(newTestKit(t, Config{})) {
+		t.Run(name, func(t *testing.T) {
+			auth := newTestKit(t, Config{RateLimitRPM: 1})
+			defer auth.Close()
+			handler := tokenEndpoints(auth)[name]
+
+			form := "grant_type=password&username=limited%40example.com&password=wrong"
+			checkOAuth2Error(t, postToken(handler, form, ""), http.StatusBadRequest, "invalid_grant")
+			w := postToken(handler, form, "")
+			checkOAuth2Error(t, w, http.StatusTooManyRequests, "temporarily_unavailable")
+			if w.Header().Get("Retry-After") == "" {
+				t.Error("Expected a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestTokenEndpointScope(t *testing.T) {
+	auth := newOAuth2TestKit(t, Config{})
+	permissions := func(t *testing.T, token string) []string {
+		t.Helper()
+		claims, err := auth.ValidateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims.Permissions
+	}
+
+	for name, handler := range tokenEndpoints(auth) {
+		t.Run(name, func(t *testing.T) {
+			// Scopes the user doesn't hold are dropped
+			w := postToken(handler, "grant_type=password&username=johndoe%40example.com&password=A3ddj3w-password&scope=posts:write+posts:read+admin", "")
+			tokens := decodeTokenResponse(t, w)
+			if tokens.Scope != "posts:read posts:write" {
+				t.Errorf("Expected the held scopes to be granted, got %q", tokens.Scope)
+			}
+			if got := permissions(t, tokens.AccessToken); !reflect.DeepEqual(got, []string{"posts:read", "posts:write"}) {
+				t.Errorf("Expected the granted permissions, got %v", got)
+			}
+
+			// Refreshes keep the scope, or narrow it
+			w = postToken(handler, "grant_type=refresh_token&refresh_token="+url.QueryEscape(tokens.RefreshToken), "")
+			tokens = decodeTokenResponse(t, w)
+			if tokens.Scope != "posts:read posts:write" {
+				t.Errorf("Expected the refresh to keep the scope, got %q", tokens.Scope)
+			}
+			w = postToken(handler, "grant_type=refresh_token&scope=posts:read+users:write&refresh_token="+url.QueryEscape(tokens.RefreshToken), "")
+			tokens = decodeTokenResponse(t, w)
+			if got := permissions(t, tokens.AccessToken); tokens.Scope != "posts:read" || !reflect.DeepEqual(got, []string{"posts:read"}) {
+				t.Errorf("Expected the refresh to narrow the scope to posts:read, got %q and %v", tokens.Scope, got)
+			}
+			w = postToken(handler, "grant_type=refresh_token&scope=posts:write&refresh_token="+url.QueryEscape(tokens.RefreshToken), "")
+			tokens = decodeTokenResponse(t, w)
+			if got := permissions(t, tokens.AccessToken); tokens.Scope != "" || len(got) != 0 {
+				t.Errorf("Expected a refresh not to widen the scope, got %q and %v", tokens.Scope, got)
+			}
+
+			// Service accounts are limited the same way
+			w = postToken(handler, "grant_type=client_credentials&client_id=s6BhdRkqt3&client_secret=gX1fBat3bV&scope=posts:read+posts:write", "")
+			tokens = decodeTokenResponse(t, w)
+			if got := permissions(t, tokens.AccessToken); tokens.Scope != "posts:read" || !reflect.DeepEqual(got, []string{"posts:read"}) {
+				t.Errorf("Expected the client's scope to be posts:read, got %q and %v", tokens.Scope, got)
+			}
+		})
+	}
+}
+
+func TestLoginScope(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newOAuth2TestKit(t, Config{Clock: testClock(&now)})
+	user, err := auth.GetUserByEmail("johndoe@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := auth.LoginUserWithOptions("johndoe@example.com", "A3ddj3w-password", LoginOptions{Scope: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := mustValidate(t, auth, tokens.AccessToken)
+	if len(claims.Permissions) != 0 || claims.Role != "editor" {
+		t.Errorf("Expected an empty scope to grant no permissions but keep the role, got %v and %q", claims.Permissions, claims.Role)
+	}
+
+	// The scope survives the second factor and a state round trip
+	secret := enrollTestTOTP(t, auth, user.ID)
+	tokens, err = auth.LoginUserWithOptions("johndoe@example.com", "A3ddj3w-password", LoginOptions{Scope: []string{"posts:write"}})
+	if err != nil || !tokens.MFARequired {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+	now = now.Add(totpPeriod * time.Second)
+	tokens, err = auth.CompleteMFALogin(tokens.MFAToken, totpCode(secret, now.Unix()/totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims := mustValidate(t, auth, tokens.AccessToken); tokens.Scope != "posts:write" || !reflect.DeepEqual(claims.Permissions, []string{"posts:write"}) {
+		t.Errorf("Expected the scope to carry through the second factor, got %q and %v", tokens.Scope, claims.Permissions)
+	}
+
+	var state bytes.Buffer
+	if err := auth.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestKit(t, Config{Clock: testClock(&now)})
+	defer restored.Close()
+	if err := restored.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := restored.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Scope != "posts:write" {
+		t.Errorf("Expected the scope to be restored, got %q", refreshed.Scope)
+	}
+}
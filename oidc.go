@@ -0,0 +1,301 @@
+package authkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// oidcScopes are the OpenID Connect scope values, which the token endpoint
+// doesn't treat as permissions
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// oidcClaims are the claims of ID tokens and UserInfoHandler responses
+var oidcClaims = []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "sid", "email", "email_verified", "name", "updated_at"}
+
+// OIDCConfig makes AuthKit an OpenID Connect provider for its users: logins
+// and refreshes also return an ID token, and OpenIDConfigurationHandler and
+// UserInfoHandler serve discovery and the standard claims. Config.Issuer must
+// be the URL the discovery document is served under, and tokens must be
+// signed with an asymmetric SigningMethod, since clients verify ID tokens
+// against the JWKS.
+type OIDCConfig struct {
+	// ClientID is the aud of ID tokens, the client ID relying parties verify
+	// them with. It can't be one of Config.Audience, so ID tokens are never
+	// accepted as access tokens.
+	ClientID string
+	// TokenEndpoint, UserInfoEndpoint and JWKSURI are the URLs the discovery
+	// document advertises for TokenEndpointHandler, UserInfoHandler and
+	// JWKSHandler (default: /oauth/token, /userinfo and
+	// /.well-known/jwks.json under Config.Issuer)
+	TokenEndpoint    string
+	UserInfoEndpoint string
+	JWKSURI          string
+}
+
+// withDefaults returns a copy of the OIDC config with the endpoints under
+// issuer filled in
+func (o OIDCConfig) withDefaults(issuer string) *OIDCConfig {
+	base := strings.TrimSuffix(issuer, "/")
+	if o.TokenEndpoint == "" {
+		o.TokenEndpoint = base + "/oauth/token"
+	}
+	if o.UserInfoEndpoint == "" {
+		o.UserInfoEndpoint = base + "/userinfo"
+	}
+	if o.JWKSURI == "" {
+		o.JWKSURI = base + "/.well-known/jwks.json"
+	}
+	return &o
+}
+
+// validate checks the OIDC config against the rest of the configuration
+func (o *OIDCConfig) validate(c Config) error {
+	if c.JWKSURL != "" {
+		return fmt.Errorf("%w: OIDC can't be used with JWKSURL, AuthKit doesn't issue tokens then", ErrInvalidConfig)
+	}
+	if c.SigningMethod == "" || c.SigningMethod == SigningMethodHS256 {
+		return fmt.Errorf("%w: OIDC requires an asymmetric SigningMethod, clients can't verify HS256 ID tokens", ErrInvalidConfig)
+	}
+	if !validOIDCURL(c.Issuer) {
+		return fmt.Errorf("%w: OIDC requires an http(s) Issuer URL without query or fragment, got %q", ErrInvalidConfig, c.Issuer)
+	}
+	audience := c.Audience
+	if len(audience) == 0 {
+		audience = []string{defaultAudience}
+	}
+	if o.ClientID == "" || slices.Contains(audience, o.ClientID) {
+		return fmt.Errorf("%w: OIDC.ClientID must be set and not be one of Audience", ErrInvalidConfig)
+	}
+	for name, endpoint := range map[string]string{"TokenEndpoint": o.TokenEndpoint, "UserInfoEndpoint": o.UserInfoEndpoint, "JWKSURI": o.JWKSURI} {
+		if endpoint != "" && !validOIDCURL(endpoint) {
+			return fmt.Errorf("%w: OIDC.%s %q is not an http(s) URL", ErrInvalidConfig, name, endpoint)
+		}
+	}
+	return nil
+}
+
+// validOIDCURL reports whether raw is an absolute http(s) URL without query
+// or fragment, as OpenID Connect requires of the issuer
+func validOIDCURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" &&
+		u.RawQuery == "" && u.Fragment == "" && !u.ForceQuery
+}
+
+// idTokenClaims are the claims of ID tokens (OpenID Connect Core section 2)
+type idTokenClaims struct {
+	Email         string           `json:"email,omitempty"`
+	EmailVerified bool             `json:"email_verified"`
+	Name          string           `json:"name,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	Nonce         string           `json:"nonce,omitempty"`
+	AMR           []string         `json:"amr,omitempty"`
+	SessionID     string           `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// idToken generates the ID token of a login at authTime, lasting as long as
+// the access token issued with it
+func (a *AuthKit) idToken(user *User, amr []string, sessionID string, authTime time.Time, nonce string, duration time.Duration) (string, error) {
+	subject, err := a.subjectFor(user)
+	if err != nil {
+		return "", err
+	}
+
+	now := a.now()
+	return a.signToken(&idTokenClaims{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		AuthTime:      jwt.NewNumericDate(authTime),
+		Nonce:         nonce,
+		AMR:           amr,
+		SessionID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			Issuer:    a.config.Issuer,
+			Audience:  []string{a.config.OIDC.ClientID},
+		},
+	})
+}
+
+// withoutOIDCScopes drops the OpenID Connect scope values from a requested
+// scope when OIDC is enabled. A scope of only those leaves the permissions
+// unrestricted.
+func (a *AuthKit) withoutOIDCScopes(scope []string) []string {
+	if a.config.OIDC == nil || scope == nil {
+		return scope
+	}
+	permissions := make([]string, 0, len(scope))
+	for _, value := range scope {
+		if !slices.Contains(oidcScopes, value) {
+			permissions = append(permissions, value)
+		}
+	}
+	if len(permissions) == 0 && len(scope) > 0 {
+		return nil
+	}
+	return permissions
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// OpenIDConfiguration returns the discovery document describing the
+// configuration, failing with ErrOIDCDisabled without Config.OIDC
+func (a *AuthKit) OpenIDConfiguration() (*OpenIDConfiguration, error) {
+	a.debugCheck()
+
+	oidc := a.config.OIDC
+	if oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	return &OpenIDConfiguration{
+		Issuer:           a.config.Issuer,
+		TokenEndpoint:    oidc.TokenEndpoint,
+		UserInfoEndpoint: oidc.UserInfoEndpoint,
+		JWKSURI:          oidc.JWKSURI,
+		// There is no authorization endpoint, tokens come from the token
+		// endpoint and the login handlers
+		ResponseTypesSupported:            []string{},
+		GrantTypesSupported:               []string{GrantTypePassword, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{a.keys.method.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ScopesSupported:                   append([]string{}, oidcScopes...),
+		ClaimsSupported:                   append([]string{}, oidcClaims...),
+	}, nil
+}
+
+// StandardClaims are the OpenID Connect standard claims of a user, as served
+// by UserInfoHandler. Subject matches the sub of the user's tokens.
+type StandardClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+}
+
+// UserStandardClaims returns the OpenID Connect standard claims of a user
+func (a *AuthKit) UserStandardClaims(userID string) (*StandardClaims, error) {
+	a.debugCheck()
+
+	user, exists := a.users.get(userID)
+	if !exists || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	subject, err := a.subjectFor(user)
+	if err != nil {
+		return nil, err
+	}
+	return &StandardClaims{
+		Subject:       subject,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		UpdatedAt:     user.UpdatedAt.Unix(),
+	}, nil
+}
+
+// OpenIDConfigurationHandler serves the discovery document, to be mounted at
+// /.well-known/openid-configuration under Config.Issuer
+func (a *AuthKit) OpenIDConfigurationHandler(c *gin.Context) {
+	document, err := a.OpenIDConfiguration()
+	if err != nil {
+		a.ginErrorCode(c, http.StatusNotFound, CodeOIDCDisabled)
+		return
+	}
+	c.JSON(http.StatusOK, document)
+}
+
+// OpenIDConfigurationHandlerFiber is OpenIDConfigurationHandler for Fiber
+func (a *AuthKit) OpenIDConfigurationHandlerFiber(c *fiber.Ctx) error {
+	document, err := a.OpenIDConfiguration()
+	if err != nil {
+		return a.fiberErrorCode(c, fiber.StatusNotFound, CodeOIDCDisabled)
+	}
+	return c.JSON(document)
+}
+
+// OpenIDConfigurationHandlerHTTP is OpenIDConfigurationHandler for net/http
+func (a *AuthKit) OpenIDConfigurationHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	document, err := a.OpenIDConfiguration()
+	if err != nil {
+		a.httpErrorCode(w, r, http.StatusNotFound, CodeOIDCDisabled)
+		return
+	}
+	writeJSON(w, http.StatusOK, document)
+}
+
+// UserInfoHandler is the OpenID Connect UserInfo endpoint for Gin, serving
+// the standard claims of the user behind GinMiddleware. Tokens of deleted or
+// disabled users are rejected like invalid ones.
+func (a *AuthKit) UserInfoHandler(c *gin.Context) {
+	claims, exists := GetUserFromGinContext(c)
+	if !exists {
+		a.ginReject(c, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+	info, err := a.UserStandardClaims(claims.UserID)
+	if err != nil {
+		a.ginReject(c, http.StatusUnauthorized, ErrorCode(err))
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// UserInfoHandlerFiber is UserInfoHandler for Fiber, behind FiberMiddleware
+func (a *AuthKit) UserInfoHandlerFiber(c *fiber.Ctx) error {
+	claims, exists := GetUserFromFiberContext(c)
+	if !exists {
+		return a.fiberReject(c, fiber.StatusUnauthorized, CodeNotAuthenticated)
+	}
+	info, err := a.UserStandardClaims(claims.UserID)
+	if err != nil {
+		return a.fiberReject(c, fiber.StatusUnauthorized, ErrorCode(err))
+	}
+	return c.JSON(info)
+}
+
+// UserInfoHandlerHTTP is UserInfoHandler for net/http, behind HTTPMiddleware
+func (a *AuthKit) UserInfoHandlerHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, exists := GetUserFromContext(r.Context())
+	if !exists {
+		a.httpReject(w, r, http.StatusUnauthorized, CodeNotAuthenticated)
+		return
+	}
+	info, err := a.UserStandardClaims(claims.UserID)
+	if err != nil {
+		a.httpReject(w, r, http.StatusUnauthorized, ErrorCode(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,287 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+)
+
+// newOIDCServer serves the OpenID Connect endpoints of an AuthKit issuing
+// ID tokens to the "spa" client, with the framework's handlers, at the
+// default paths under the server's URL, the issuer
+func newOIDCServer(t *testing.T, framework string, clock Clock) (*AuthKit, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(nil)
+	t.Cleanup(srv.Close)
+
+	privatePEM, _ := testKeyPair(t, SigningMethodES256)
+	auth := newTestKit(t, Config{
+		SigningMethod: SigningMethodES256,
+		PrivateKeyPEM: privatePEM,
+		EncryptionKey: "encryption-secret-key",
+		Issuer:        srv.URL,
+		OIDC:          &OIDCConfig{ClientID: "spa"},
+		Clock:         clock,
+	})
+	t.Cleanup(func() { auth.Close() })
+	if err := auth.DefineRole("editor", []string{"posts:read", "posts:write"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.AdminCreateUser(RegisterRequest{Email: "johndoe@example.com", Password: "A3ddj3w-password", Name: "John Doe", Role: "editor"}); err != nil {
+		t.Fatal(err)
+	}
+
+	switch framework {
+	case "gin":
+		r := gin.New()
+		r.GET("/.well-known/openid-configuration", auth.OpenIDConfigurationHandler)
+		r.GET("/.well-known/jwks.json", auth.JWKSHandler)
+		r.POST("/oauth/token", auth.TokenEndpointHandler)
+		r.GET("/userinfo", auth.GinMiddleware(), auth.UserInfoHandler)
+		r.POST("/login", auth.LoginHandler)
+		srv.Config.Handler = r
+	case "fiber":
+		app := fiber.New()
+		app.Get("/.well-known/openid-configuration", auth.OpenIDConfigurationHandlerFiber)
+		app.Get("/.well-known/jwks.json", auth.JWKSHandlerFiber)
+		app.Post("/oauth/token", auth.TokenEndpointHandlerFiber)
+		app.Get("/userinfo", auth.FiberMiddleware(), auth.UserInfoHandlerFiber)
+		app.Post("/login", auth.LoginHandlerFiber)
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) })
+	case "http":
+		mux := http.NewServeMux()
+		mux.HandleFunc("/.well-known/openid-configuration", auth.OpenIDConfigurationHandlerHTTP)
+		mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+			jwks, _ := auth.JWKS()
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(jwks)
+		})
+		mux.HandleFunc("/oauth/token", auth.TokenEndpointHandlerHTTP)
+		mux.Handle("/userinfo", auth.HTTPMiddleware(http.HandlerFunc(auth.UserInfoHandlerHTTP)))
+		mux.HandleFunc("/login", auth.LoginHandlerHTTP)
+		srv.Config.Handler = mux
+	}
+	return auth, srv
+}
+
+// oidcIDClaims are the claims of ID tokens checked beyond those go-oidc reads
+type oidcIDClaims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	AuthTime      int64  `json:"auth_time"`
+	SessionID     string `json:"sid"`
+}
+
+func TestOIDCWithGoOIDC(t *testing.T) {
+	for _, framework := range []string{"gin", "fiber", "http"} {
+		t.Run(framework, func(t *testing.T) {
+			auth, srv := newOIDCServer(t, framework, nil)
+			ctx := context.Background()
+
+			// Discovery checks the issuer and finds the endpoints and key set
+			provider, err := oidc.NewProvider(ctx, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var discovery OpenIDConfiguration
+			if err := provider.Claims(&discovery); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(discovery.IDTokenSigningAlgValuesSupported, []string{"ES256"}) || discovery.UserInfoEndpoint != srv.URL+"/userinfo" {
+				t.Errorf("Expected the discovery document to match the config, got %+v", discovery)
+			}
+
+			endpoint := provider.Endpoint()
+			endpoint.AuthStyle = oauth2.AuthStyleInParams
+			config := oauth2.Config{ClientID: "spa", Endpoint: endpoint, Scopes: []string{oidc.ScopeOpenID, "profile", "email"}}
+			token, err := config.PasswordCredentialsToken(ctx, "johndoe@example.com", "A3ddj3w-password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verifier := provider.Verifier(&oidc.Config{ClientID: "spa"})
+			rawIDToken, _ := token.Extra("id_token").(string)
+			idToken, err := verifier.Verify(ctx, rawIDToken)
+			if err != nil {
+				t.Fatalf("Expected go-oidc to verify the ID token, got %v", err)
+			}
+			var claims oidcIDClaims
+			if err := idToken.Claims(&claims); err != nil {
+				t.Fatal(err)
+			}
+			user, _ := auth.GetUserByEmail("johndoe@example.com")
+			if idToken.Subject != user.ID || claims.Email != user.Email || claims.EmailVerified == nil || claims.Name != "John Doe" || claims.AuthTime == 0 || claims.SessionID == "" {
+				t.Errorf("Expected the standard claims of the user, got %s %+v", idToken.Subject, claims)
+			}
+
+			// The OIDC scope values don't restrict the permissions
+			access := mustValidate(t, auth, token.AccessToken)
+			if !reflect.DeepEqual(access.Permissions, []string{"posts:read", "posts:write"}) {
+				t.Errorf("Expected unrestricted permissions, got %v", access.Permissions)
+			}
+			if _, err := auth.ValidateToken(rawIDToken); err == nil {
+				t.Error("Expected the ID token to be rejected as an access token")
+			}
+			if _, err := verifier.Verify(ctx, token.AccessToken); err == nil {
+				t.Error("Expected the access token to be rejected as an ID token")
+			}
+
+			userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var info StandardClaims
+			if err := userInfo.Claims(&info); err != nil {
+				t.Fatal(err)
+			}
+			if userInfo.Subject != idToken.Subject || userInfo.Email != user.Email || info.Name != "John Doe" || info.UpdatedAt == 0 {
+				t.Errorf("Expected the user's standard claims, got %+v", info)
+			}
+
+			// Refreshed ID tokens keep the time of the login and the session
+			expired := *token
+			expired.Expiry = time.Now().Add(-time.Minute)
+			refreshed, err := config.TokenSource(ctx, &expired).Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rawRefreshed, _ := refreshed.Extra("id_token").(string)
+			refreshedID, err := verifier.Verify(ctx, rawRefreshed)
+			if err != nil {
+				t.Fatalf("Expected a refreshed ID token, got %v", err)
+			}
+			var refreshedClaims oidcIDClaims
+			_ = refreshedID.Claims(&refreshedClaims)
+			if refreshedClaims.AuthTime != claims.AuthTime || refreshedClaims.SessionID != claims.SessionID || refreshedID.Subject != idToken.Subject {
+				t.Errorf("Expected auth_time and sid to carry over, got %+v, was %+v", refreshedClaims, claims)
+			}
+
+			if err := auth.DisableUser(user.ID, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(refreshed)); err == nil {
+				t.Error("Expected UserInfo to reject a disabled user")
+			}
+		})
+	}
+}
+
+func TestOIDCNonce(t *testing.T) {
+	now := time.Now()
+	auth, srv := newOIDCServer(t, "gin", testClock(&now))
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(srv.URL+"/login", "application/json", strings.NewReader(`{"email":"johndoe@example.com","password":"A3ddj3w-password","nonce":"n-0S6_WzA2Mj"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var tokens TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil || tokens.IDToken == "" {
+		t.Fatalf("Expected an ID token from the login handler, got %+v %v", tokens, err)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: "spa"}).Verify(ctx, tokens.IDToken)
+	if err != nil || idToken.Nonce != "n-0S6_WzA2Mj" {
+		t.Fatalf("Expected the nonce in the ID token, got %+v %v", idToken, err)
+	}
+
+	// The nonce survives the second factor
+	secret := enrollTestTOTP(t, auth, tokens.User.ID)
+	pending, err := auth.LoginUserWithOptions("johndoe@example.com", "A3ddj3w-password", LoginOptions{Nonce: "mfa-nonce"})
+	if err != nil || !pending.MFARequired || pending.IDToken != "" {
+		t.Fatalf("Expected an MFA challenge without ID token, got %+v %v", pending, err)
+	}
+	completed, err := auth.CompleteMFALogin(pending.MFAToken, totpCode(secret, now.Unix()/totpPeriod+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := provider.Verifier(&oidc.Config{ClientID: "spa", Now: func() time.Time { return now }})
+	idToken, err = verifier.Verify(ctx, completed.IDToken)
+	var claims struct {
+		AMR []string `json:"amr"`
+	}
+	if err != nil || idToken.Nonce != "mfa-nonce" || idToken.Claims(&claims) != nil || len(claims.AMR) == 0 {
+		t.Errorf("Expected the nonce and amr after MFA, got %+v %+v %v", idToken, claims, err)
+	}
+}
+
+func TestOIDCConfigValidation(t *testing.T) {
+	privatePEM, _ := testKeyPair(t, SigningMethodRS256)
+	valid := Config{SigningMethod: SigningMethodRS256, PrivateKeyPEM: privatePEM, Issuer: "https://auth.example.com", OIDC: &OIDCConfig{ClientID: "spa"}}
+	auth, err := NewValidated(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, _ := auth.OpenIDConfiguration()
+	if document.TokenEndpoint != "https://auth.example.com/oauth/token" || document.JWKSURI != "https://auth.example.com/.well-known/jwks.json" {
+		t.Errorf("Expected the default endpoints under the issuer, got %+v", document)
+	}
+	auth.Close()
+
+	for name, mutate := range map[string]func(*Config){
+		"HS256":            func(c *Config) { c.SigningMethod, c.PrivateKeyPEM, c.JWTSecret = "", "", "secret" },
+		"default issuer":   func(c *Config) { c.Issuer = "" },
+		"issuer query":     func(c *Config) { c.Issuer = "https://auth.example.com?tenant=a" },
+		"no client ID":     func(c *Config) { c.OIDC = &OIDCConfig{} },
+		"client audience":  func(c *Config) { c.Audience = []string{"api", "spa"} },
+		"default audience": func(c *Config) { c.OIDC = &OIDCConfig{ClientID: defaultAudience} },
+		"endpoint":         func(c *Config) { c.OIDC = &OIDCConfig{ClientID: "spa", UserInfoEndpoint: "/userinfo"} },
+		"remote JWKS": func(c *Config) {
+			c.JWKSURL, c.Audience = "https://auth.example.com/jwks.json", []string{"api"}
+		},
+	} {
+		config := valid
+		mutate(&config)
+		if _, err := NewValidated(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if _, err := auth.OpenIDConfiguration(); !errors.Is(err, ErrOIDCDisabled) {
+		t.Errorf("Expected ErrOIDCDisabled, got %v", err)
+	}
+	tokens := loginTestUser(t, auth, "plain@example.com")
+	if tokens.IDToken != "" {
+		t.Error("Expected no ID token without Config.OIDC")
+	}
+
+	r := gin.New()
+	r.GET("/.well-known/openid-configuration", auth.OpenIDConfigurationHandler)
+	r.GET("/userinfo", auth.GinMiddleware(), auth.UserInfoHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), CodeOIDCDisabled) {
+		t.Errorf("Expected 404 %s, got %d: %s", CodeOIDCDisabled, w.Code, w.Body.String())
+	}
+
+	// UserInfo only needs an access token
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var info StandardClaims
+	if err := json.Unmarshal(w.Body.Bytes(), &info); w.Code != http.StatusOK || err != nil || info.Subject != tokens.User.ID || info.Email != "plain@example.com" {
+		t.Errorf("Expected the user's claims, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,433 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the document OpenAPISpec generates
+const (
+	SpecFormatJSON = "json"
+	SpecFormatYAML = "yaml"
+)
+
+// SpecOptions configures the document OpenAPISpec generates
+type SpecOptions struct {
+	// Title of the API (default: "AuthKit API")
+	Title string
+	// Version of the API (default: "1.0.0")
+	Version string
+	// ServerURL is listed as the server, e.g. "https://api.example.com"
+	ServerURL string
+	// Routes selects the endpoints and their paths; pass the options given to
+	// RegisterRoutes so the document matches what is mounted. Routes.Prefix
+	// is the base path.
+	Routes RouteOptions
+	// Format is SpecFormatJSON (default) or SpecFormatYAML
+	Format string
+}
+
+// routeDoc describes the request and success response of a route
+type routeDoc struct {
+	summary      string
+	request      interface{} // Body, or nil
+	optionalBody bool
+	query        []specParam
+	status       int
+	response     interface{}
+}
+
+// specParam is a query parameter
+type specParam struct {
+	name     string
+	kind     string // OpenAPI type
+	required bool
+}
+
+// Response bodies of the bundled handlers
+type (
+	specMessage struct {
+		Message string `json:"message"`
+	}
+	specUser struct {
+		Message string    `json:"message"`
+		User    *UserInfo `json:"user"`
+	}
+	specProfile struct {
+		User *UserInfo `json:"user"`
+	}
+	specChangePassword struct {
+		Message string         `json:"message"`
+		Tokens  *TokenResponse `json:"tokens,omitempty"` // Unless Config.KeepTokensOnPasswordChange
+	}
+	specTOTPEnrollment struct {
+		Secret     string `json:"secret"`
+		OtpauthURL string `json:"otpauth_url"`
+	}
+	specRecoveryCodes struct {
+		Message       string   `json:"message,omitempty"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	specSessions struct {
+		Sessions []Session `json:"sessions"`
+	}
+	specRoles struct {
+		Roles []RoleDefinition `json:"roles"`
+	}
+	specDeleteAccount struct {
+		Message string     `json:"message"`
+		PurgeAt *time.Time `json:"purge_at,omitempty"` // With Config.DeletionGracePeriod
+	}
+	specError struct {
+		Error specErrorBody `json:"error"`
+	}
+	specErrorBody struct {
+		Code    string                 `json:"code"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details,omitempty"`
+	}
+)
+
+// specTypeNames names the schemas of the unexported response bodies
+var specTypeNames = map[reflect.Type]string{
+	reflect.TypeOf(specMessage{}):        "MessageResponse",
+	reflect.TypeOf(specUser{}):           "UserResponse",
+	reflect.TypeOf(specProfile{}):        "ProfileResponse",
+	reflect.TypeOf(specChangePassword{}): "ChangePasswordResponse",
+	reflect.TypeOf(specTOTPEnrollment{}): "TOTPEnrollment",
+	reflect.TypeOf(specRecoveryCodes{}):  "RecoveryCodesResponse",
+	reflect.TypeOf(specSessions{}):       "SessionsResponse",
+	reflect.TypeOf(specRoles{}):          "RolesResponse",
+	reflect.TypeOf(specDeleteAccount{}):  "DeleteAccountResponse",
+	reflect.TypeOf(specError{}):          "Error",
+	reflect.TypeOf(specErrorBody{}):      "ErrorBody",
+}
+
+// pageParams are the query parameters of the paginated admin routes
+var pageParams = []specParam{{"offset", "integer", false}, {"limit", "integer", false}}
+
+// routeDocs documents every route in routeSpecs
+var routeDocs = map[Route]routeDoc{
+	RouteRegister:           {summary: "Register a user", request: RegisterRequest{}, status: http.StatusCreated, response: specUser{}},
+	RouteLogin:              {summary: "Log in with email and password", request: LoginRequest{}, status: http.StatusOK, response: TokenResponse{}},
+	RouteRefresh:            {summary: "Exchange a refresh token for new tokens", request: RefreshRequest{}, optionalBody: true, status: http.StatusOK, response: TokenResponse{}},
+	RouteLogout:             {summary: "Revoke the presented tokens", request: LogoutRequest{}, optionalBody: true, status: http.StatusOK, response: specMessage{}},
+	RouteClientCredentials:  {summary: "Issue a service account token", request: ClientCredentialsRequest{}, status: http.StatusOK, response: TokenResponse{}},
+	RouteVerifyMFA:          {summary: "Complete a login with a TOTP or recovery code", request: MFALoginRequest{}, status: http.StatusOK, response: TokenResponse{}},
+	RouteForgotPassword:     {summary: "Send a password reset token", request: ForgotPasswordRequest{}, status: http.StatusAccepted, response: specMessage{}},
+	RouteResetPassword:      {summary: "Set a new password with a reset token", request: ResetPasswordRequest{}, status: http.StatusOK, response: specMessage{}},
+	RouteResendVerification: {summary: "Send a new email verification token", request: ResendVerificationRequest{}, status: http.StatusAccepted, response: specMessage{}},
+	RouteVerifyEmail:        {summary: "Verify an email", query: []specParam{{"token", "string", true}}, status: http.StatusOK, response: specMessage{}},
+	RouteConfirmEmailChange: {summary: "Confirm an email change", query: []specParam{{"token", "string", true}}, status: http.StatusOK, response: specMessage{}},
+	RouteRequestLoginLink:   {summary: "Send a magic login link", request: LoginLinkRequest{}, status: http.StatusAccepted, response: specMessage{}},
+	RouteLoginWithLink:      {summary: "Log in with a magic link token", request: LinkLoginRequest{}, status: http.StatusOK, response: TokenResponse{}},
+	RouteRecoverAccount:     {summary: "Restore an account pending deletion", request: LoginRequest{}, status: http.StatusOK, response: specUser{}},
+	RouteJWKS:               {summary: "Public keys tokens are verified against", status: http.StatusOK, response: JWKSet{}},
+
+	RouteProfile:            {summary: "Get the current user", status: http.StatusOK, response: specProfile{}},
+	RouteUpdateProfile:      {summary: "Update the current user's name and metadata", request: ProfileUpdate{}, status: http.StatusOK, response: specUser{}},
+	RouteChangePassword:     {summary: "Change the current user's password", request: ChangePasswordRequest{}, status: http.StatusOK, response: specChangePassword{}},
+	RouteRequestEmailChange: {summary: "Send a confirmation link to a new email", request: EmailChangeRequest{}, status: http.StatusAccepted, response: specMessage{}},
+	RouteEnrollTOTP:         {summary: "Start TOTP enrollment", status: http.StatusOK, response: specTOTPEnrollment{}},
+	RouteConfirmTOTP:        {summary: "Activate TOTP", request: TOTPCodeRequest{}, status: http.StatusOK, response: specRecoveryCodes{}},
+	RouteRecoveryCodes:      {summary: "Replace the recovery codes", status: http.StatusOK, response: specRecoveryCodes{}},
+	RouteDeleteAccount:      {summary: "Delete the current user's account", status: http.StatusOK, response: specDeleteAccount{}},
+	RouteListSessions:       {summary: "List the current user's sessions", status: http.StatusOK, response: specSessions{}},
+	RouteRevokeSession:      {summary: "End one of the current user's sessions", status: http.StatusOK, response: specMessage{}},
+
+	RouteAdminListUsers:     {summary: "List users", query: pageParams, status: http.StatusOK, response: UserPage{}},
+	RouteAdminCreateUser:    {summary: "Create a user with any role", request: RegisterRequest{}, status: http.StatusCreated, response: specUser{}},
+	RouteAdminSearchUsers:   {summary: "Search users by email or name", query: append([]specParam{{"q", "string", true}, {"metadata_key", "string", false}}, pageParams...), status: http.StatusOK, response: UserPage{}},
+	RouteAdminGetUser:       {summary: "Get a user", status: http.StatusOK, response: UserInfo{}},
+	RouteAdminUpdateUser:    {summary: "Update a user", request: AdminUpdateUserRequest{}, status: http.StatusOK, response: specUser{}},
+	RouteAdminDeleteUser:    {summary: "Delete a user", status: http.StatusOK, response: specMessage{}},
+	RouteAdminSetRole:       {summary: "Set a user's role", request: SetRoleRequest{}, status: http.StatusOK, response: specUser{}},
+	RouteAdminDisableUser:   {summary: "Disable a user", request: DisableUserRequest{}, optionalBody: true, status: http.StatusOK, response: specMessage{}},
+	RouteAdminEnableUser:    {summary: "Enable a user", status: http.StatusOK, response: specMessage{}},
+	RouteAdminListSessions:  {summary: "List a user's sessions", status: http.StatusOK, response: specSessions{}},
+	RouteAdminRevokeSession: {summary: "End any session", status: http.StatusOK, response: specMessage{}},
+	RouteAdminListRoles:     {summary: "List role definitions", status: http.StatusOK, response: specRoles{}},
+	RouteAdminDefineRole:    {summary: "Create or replace a role definition", request: DefineRoleRequest{}, status: http.StatusOK, response: RoleDefinition{}},
+}
+
+// routeTags group the operations by access
+var routeTags = map[routeAccess]string{routePublic: "auth", routeProtected: "account", routeAdmin: "admin"}
+
+// OpenAPISpec generates an OpenAPI 3.0 document of the routes RegisterRoutes
+// mounts with opts.Routes, with the request and response schemas, the error
+// envelope of DefaultErrorResponder and a bearer security scheme. It returns
+// the error of opts.Routes.Validate for invalid route options.
+func OpenAPISpec(opts SpecOptions) ([]byte, error) {
+	routes, err := opts.Routes.routes()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Title == "" {
+		opts.Title = "AuthKit API"
+	}
+	if opts.Version == "" {
+		opts.Version = "1.0.0"
+	}
+
+	schemas := &specSchemas{components: make(map[string]interface{})}
+	errorRef := schemas.schema(reflect.TypeOf(specError{}))
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		path, params := specPath(route.fullPath)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.method)] = schemas.operation(route, params, errorRef)
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": opts.Title, "version": opts.Version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+	if opts.ServerURL != "" {
+		document["servers"] = []interface{}{map[string]interface{}{"url": opts.ServerURL}}
+	}
+
+	switch opts.Format {
+	case "", SpecFormatJSON:
+		return json.MarshalIndent(document, "", "  ")
+	case SpecFormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported spec format %q", ErrInvalidConfig, opts.Format)
+}
+
+// specPath converts a Gin/Fiber path to an OpenAPI path, returning its
+// path parameters
+func specPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// specSchemas collects the component schemas of a document
+type specSchemas struct {
+	components map[string]interface{}
+}
+
+// operation describes a mounted route
+func (s *specSchemas) operation(route mountedRoute, pathParams []string, errorRef map[string]interface{}) map[string]interface{} {
+	doc := routeDocs[route.route]
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorRef}},
+		}
+	}
+
+	responses := map[string]interface{}{
+		fmt.Sprint(doc.status): map[string]interface{}{
+			"description": http.StatusText(doc.status),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(doc.response))},
+			},
+		},
+		"default": errorResponse("Error"),
+	}
+	if doc.request != nil || len(doc.query) > 0 {
+		responses["400"] = errorResponse("Invalid request")
+	}
+	if route.access != routePublic {
+		responses["401"] = errorResponse("Missing or invalid access token")
+	}
+	if route.access == routeAdmin {
+		responses["403"] = errorResponse("Insufficient role")
+	}
+
+	operation := map[string]interface{}{
+		"operationId": string(route.route),
+		"summary":     doc.summary,
+		"tags":        []string{routeTags[route.access]},
+		"responses":   responses,
+	}
+	var params []interface{}
+	for _, name := range pathParams {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, param := range doc.query {
+		params = append(params, map[string]interface{}{
+			"name": param.name, "in": "query", "required": param.required, "schema": map[string]interface{}{"type": param.kind},
+		})
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+	if doc.request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": !doc.optionalBody,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(doc.request))},
+			},
+		}
+	}
+	if route.access != routePublic {
+		operation["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+	return operation
+}
+
+// timeType is encoded as an RFC 3339 string
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t, registering named structs as components
+// and referencing them
+func (s *specSchemas) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "object", "additionalProperties": true}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		name, ok := specTypeNames[t]
+		if !ok {
+			name = t.Name()
+		}
+		if _, exists := s.components[name]; !exists {
+			s.components[name] = nil // Reserve the name for recursive types
+			s.components[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct from its json and binding tags
+func (s *specSchemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.schema(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			switch {
+			case rule == "required":
+				required = append(required, name)
+			case rule == "email":
+				schema["format"] = "email"
+			case strings.HasPrefix(rule, "min=") && field.Type.Kind() == reflect.String:
+				var n int
+				if _, err := fmt.Sscan(strings.TrimPrefix(rule, "min="), &n); err == nil {
+					schema["minLength"] = n
+				}
+			}
+		}
+		properties[name] = schema
+	}
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// OpenAPIHandler serves the document OpenAPISpec generates for opts, e.g. at
+// /openapi.json, for Gin. The document is generated on the first request.
+func (a *AuthKit) OpenAPIHandler(opts SpecOptions) gin.HandlerFunc {
+	spec := &specCache{opts: opts}
+	return func(c *gin.Context) {
+		document, err := spec.document()
+		if err != nil {
+			a.ginRespondError(c, a.ginErrorResponse(c, http.StatusInternalServerError, CodeInternalError, err))
+			return
+		}
+		c.Data(http.StatusOK, spec.contentType(), document)
+	}
+}
+
+// OpenAPIHandlerFiber serves the document OpenAPISpec generates for opts for Fiber
+func (a *AuthKit) OpenAPIHandlerFiber(opts SpecOptions) fiber.Handler {
+	spec := &specCache{opts: opts}
+	return func(c *fiber.Ctx) error {
+		document, err := spec.document()
+		if err != nil {
+			return a.fiberRespondError(c, a.fiberErrorResponse(c, fiber.StatusInternalServerError, CodeInternalError, err))
+		}
+		c.Set(fiber.HeaderContentType, spec.contentType())
+		return c.Send(document)
+	}
+}
+
+// specCache generates a document once
+type specCache struct {
+	opts SpecOptions
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// document returns the generated document
+func (s *specCache) document() ([]byte, error) {
+	s.once.Do(func() { s.data, s.err = OpenAPISpec(s.opts) })
+	return s.data, s.err
+}
+
+// contentType returns the media type of the document
+func (s *specCache) contentType() string {
+	if s.opts.Format == SpecFormatYAML {
+		return "application/yaml"
+	}
+	return "application/json"
+}
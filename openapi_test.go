@@ -0,0 +1,159 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// specRefs collects the $ref values in a decoded document
+func specRefs(value interface{}, refs map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				refs[ref] = true
+			}
+			specRefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range value {
+			specRefs(child, refs)
+		}
+	}
+}
+
+func TestRouteDocsCoverRoutes(t *testing.T) {
+	for _, spec := range routeSpecs {
+		doc, ok := routeDocs[spec.route]
+		if !ok || doc.summary == "" || doc.status == 0 || doc.response == nil {
+			t.Errorf("Expected %q to be documented, got %+v", spec.route, doc)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	routes := RouteOptions{Prefix: "/auth", Disable: []Route{RouteRegister}, DisableAdmin: true}
+	data, err := OpenAPISpec(SpecOptions{Title: "Acme Auth", ServerURL: "https://api.example.com", Routes: routes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if document["openapi"] != "3.0.3" || document["info"].(map[string]interface{})["title"] != "Acme Auth" {
+		t.Errorf("Expected an OpenAPI 3 document with the title, got %v %v", document["openapi"], document["info"])
+	}
+
+	// The operations match what RegisterRoutes mounts
+	paths := document["paths"].(map[string]interface{})
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	r := gin.New()
+	if err := auth.RegisterRoutes(r, routes); err != nil {
+		t.Fatal(err)
+	}
+	operations := 0
+	for _, item := range paths {
+		operations += len(item.(map[string]interface{}))
+	}
+	if operations != len(r.Routes()) {
+		t.Errorf("Expected %d operations, got %d", len(r.Routes()), operations)
+	}
+	for _, route := range r.Routes() {
+		path, _ := specPath(route.Path)
+		item, _ := paths[path].(map[string]interface{})
+		if item[strings.ToLower(route.Method)] == nil {
+			t.Errorf("Expected %s %s in the document", route.Method, path)
+		}
+	}
+	if paths["/auth/register"] != nil || paths["/auth/admin/users"] != nil {
+		t.Error("Expected the disabled routes to be left out")
+	}
+
+	login := paths["/auth/login"].(map[string]interface{})["post"].(map[string]interface{})
+	if login["security"] != nil {
+		t.Errorf("Expected login to be public, got %v", login["security"])
+	}
+	success := login["responses"].(map[string]interface{})["200"].(map[string]interface{})
+	if ref := success["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"]; ref.(map[string]interface{})["$ref"] != "#/components/schemas/TokenResponse" {
+		t.Errorf("Expected a TokenResponse, got %v", ref)
+	}
+	revoke := paths["/auth/sessions/{id}"].(map[string]interface{})["delete"].(map[string]interface{})
+	if revoke["security"] == nil || revoke["parameters"].([]interface{})[0].(map[string]interface{})["in"] != "path" {
+		t.Errorf("Expected a protected operation with an id path parameter, got %v", revoke)
+	}
+
+	components := document["components"].(map[string]interface{})
+	schemas := components["schemas"].(map[string]interface{})
+	loginRequest := schemas["LoginRequest"].(map[string]interface{})
+	if required := loginRequest["required"].([]interface{}); len(required) != 2 {
+		t.Errorf("Expected email and password to be required, got %v", required)
+	}
+	if schemas["Error"] == nil || components["securitySchemes"].(map[string]interface{})["bearerAuth"] == nil {
+		t.Error("Expected the error envelope and the bearer scheme")
+	}
+	refs := make(map[string]bool)
+	specRefs(document, refs)
+	for ref := range refs {
+		if schemas[strings.TrimPrefix(ref, "#/components/schemas/")] == nil {
+			t.Errorf("Expected %s to be defined", ref)
+		}
+	}
+}
+
+func TestOpenAPISpecYAML(t *testing.T) {
+	data, err := OpenAPISpec(SpecOptions{Format: SpecFormatYAML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	paths := document["paths"].(map[string]interface{})
+	if paths["/register"] == nil || paths["/admin/users/{id}/role"] == nil {
+		t.Errorf("Expected every route at its default path, got %d paths", len(paths))
+	}
+
+	if _, err := OpenAPISpec(SpecOptions{Format: "xml"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an unknown format, got %v", err)
+	}
+	if _, err := OpenAPISpec(SpecOptions{Routes: RouteOptions{Prefix: "auth"}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for invalid routes, got %v", err)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	r := gin.New()
+	r.GET("/openapi.json", auth.OpenAPIHandler(SpecOptions{}))
+	r.GET("/openapi.yaml", auth.OpenAPIHandler(SpecOptions{Format: SpecFormatYAML}))
+	app := fiber.New()
+	app.Get("/openapi.json", auth.OpenAPIHandlerFiber(SpecOptions{}))
+	app.Get("/openapi.yaml", auth.OpenAPIHandlerFiber(SpecOptions{Format: SpecFormatYAML}))
+
+	handlers := map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+	}
+	for name, handler := range handlers {
+		for path, contentType := range map[string]string{"/openapi.json": "application/json", "/openapi.yaml": "application/yaml"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != contentType || !strings.Contains(w.Body.String(), "openapi") {
+				t.Errorf("%s %s: expected the document as %s, got %d %q", name, path, contentType, w.Code, w.Header().Get("Content-Type"))
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package authkit
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Option configures an AuthKit created by NewWithOptions
+type Option func(*options) error
+
+// options collects what the options of NewWithOptions set
+type options struct {
+	config    Config
+	lifetimes tokenLifetimes // Set by WithTokenExpiry and WithRefreshExpiry
+}
+
+// NewWithOptions creates a new AuthKit instance from functional options,
+// returning an error if the combined configuration is invalid or options
+// conflict, such as WithJWTSecret together with WithSigningKey. Options are
+// applied in order; WithConfig replaces everything set before it.
+//
+//	auth, err := authkit.NewWithOptions(
+//	    authkit.WithJWTSecret(secret),
+//	    authkit.WithTokenExpiry(15*time.Minute),
+//	    authkit.WithStore(redisStore),
+//	)
+func NewWithOptions(opts ...Option) (*AuthKit, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return newAuthKit(o.config, o.lifetimes)
+}
+
+// WithConfig starts from a Config, as passed to New
+func WithConfig(config Config) Option {
+	return func(o *options) error {
+		*o = options{config: config}
+		return nil
+	}
+}
+
+// WithJWTSecret signs tokens with HS256 and secret. Previous secrets are still
+// accepted when validating tokens, see Config.PreviousJWTSecrets.
+func WithJWTSecret(secret string, previous ...string) Option {
+	return func(o *options) error {
+		if secret == "" {
+			return fmt.Errorf("%w: empty JWT secret", ErrInvalidConfig)
+		}
+		o.config.SigningMethod = SigningMethodHS256
+		o.config.JWTSecret = secret
+		o.config.PreviousJWTSecrets = append([]string{}, previous...)
+		return nil
+	}
+}
+
+// WithSigningKey signs tokens with an asymmetric method ("RS256", "RS512",
+// "ES256" or "EdDSA") and a PEM-encoded private key
+func WithSigningKey(method, privateKeyPEM string) Option {
+	return func(o *options) error {
+		if method == "" || method == SigningMethodHS256 {
+			return fmt.Errorf("%w: WithSigningKey requires an asymmetric method, use WithJWTSecret for HS256", ErrInvalidConfig)
+		}
+		o.config.SigningMethod = method
+		o.config.PrivateKeyPEM = privateKeyPEM
+		return nil
+	}
+}
+
+// WithTokenExpiry sets how long access tokens stay valid (default: 24h)
+func WithTokenExpiry(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: invalid token expiry %v", ErrInvalidConfig, d)
+		}
+		o.lifetimes.access = d
+		return nil
+	}
+}
+
+// WithRefreshExpiry sets how long refresh tokens stay valid (default: 7 days)
+func WithRefreshExpiry(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: invalid refresh expiry %v", ErrInvalidConfig, d)
+		}
+		o.lifetimes.refresh = d
+		return nil
+	}
+}
+
+// WithBCryptCost sets the bcrypt cost of password hashes (default: 12)
+func WithBCryptCost(cost int) Option {
+	return func(o *options) error {
+		o.config.BCryptCost = cost
+		return nil
+	}
+}
+
+// WithArgon2id hashes new passwords with Argon2id using params; zero fields
+// take the defaults. Existing bcrypt hashes keep working, see Config.RehashOnLogin.
+func WithArgon2id(params Argon2Params) Option {
+	return func(o *options) error {
+		o.config.PasswordHasher = PasswordHasherArgon2id
+		o.config.Argon2 = params
+		return nil
+	}
+}
+
+// WithPasswordPepper mixes pepper into passwords before hashing them, still
+// accepting hashes made with the previous peppers, newest first
+func WithPasswordPepper(pepper string, previous ...string) Option {
+	return func(o *options) error {
+		if pepper == "" {
+			return fmt.Errorf("%w: empty password pepper", ErrInvalidConfig)
+		}
+		o.config.PasswordPepper = pepper
+		o.config.PreviousPasswordPeppers = previous
+		return nil
+	}
+}
+
+// WithBreachChecker rejects new passwords checker finds in known data breaches
+func WithBreachChecker(checker BreachChecker) Option {
+	return func(o *options) error {
+		o.config.BreachChecker = checker
+		return nil
+	}
+}
+
+// WithStore uses store for every store interface it implements: NonceStore,
+// RevocationStore, LockoutStore and LoginHistoryStore. It fails if store
+// implements none of them.
+func WithStore(store interface{}) Option {
+	return func(o *options) error {
+		used := false
+		if s, ok := store.(NonceStore); ok {
+			o.config.NonceStore, used = s, true
+		}
+		if s, ok := store.(RevocationStore); ok {
+			o.config.RevocationStore, used = s, true
+		}
+		if s, ok := store.(LockoutStore); ok {
+			o.config.LockoutStore, used = s, true
+		}
+		if s, ok := store.(LoginHistoryStore); ok {
+			o.config.LoginHistoryStore, used = s, true
+		}
+		if !used {
+			return fmt.Errorf("%w: WithStore got %T, which implements no store interface", ErrInvalidConfig, store)
+		}
+		return nil
+	}
+}
+
+// WithLogger sets the structured logger, see Config.Logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) error {
+		o.config.Logger = logger
+		return nil
+	}
+}
+
+// WithHooks sets the callbacks run after auth events, see Hooks
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) error {
+		o.config.Hooks = hooks
+		return nil
+	}
+}
+
+// WithPasswordPolicy sets the policy enforced on new passwords
+func WithPasswordPolicy(policy PasswordPolicy) Option {
+	return func(o *options) error {
+		o.config.PasswordPolicy = policy
+		return nil
+	}
+}
+
+// WithAuditLogger sets the audit event sink, see Config.AuditLogger
+func WithAuditLogger(logger AuditLogger) Option {
+	return func(o *options) error {
+		o.config.AuditLogger = logger
+		return nil
+	}
+}
+
+// WithMetrics sets the metrics sink, see Config.Metrics
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) error {
+		o.config.Metrics = metrics
+		return nil
+	}
+}
+
+// WithTracer sets the tracer, see Config.Tracer
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) error {
+		o.config.Tracer = tracer
+		return nil
+	}
+}
+
+// WithClock sets the time source, see Config.Clock
+func WithClock(clock Clock) Option {
+	return func(o *options) error {
+		o.config.Clock = clock
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package authkit
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	handler := &captureHandler{}
+	var registered []string
+	auth, err := NewWithOptions(
+		WithJWTSecret("test-secret-key-for-testing-only"),
+		WithBCryptCost(4),
+		WithLogger(slog.New(handler)),
+		WithHooks(Hooks{OnRegister: func(user *UserInfo) error {
+			registered = append(registered, user.Email)
+			return nil
+		}}),
+		WithPasswordPolicy(PasswordPolicy{MinLength: 12}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "short@example.com", Password: "password123", Name: "Short"}); err == nil {
+		t.Error("Expected the password policy to reject an 11 character password")
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "long@example.com", Password: "long-password123", Name: "Long"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 1 || registered[0] != "long@example.com" {
+		t.Errorf("Expected the OnRegister hook to run, got %v", registered)
+	}
+	if len(handler.find("user registered")) != 1 {
+		t.Error("Expected the registration to be logged")
+	}
+}
+
+func TestNewWithOptionsDurations(t *testing.T) {
+	auth, err := NewWithOptions(
+		WithJWTSecret("test-secret-key-for-testing-only"),
+		WithTokenExpiry(15*time.Minute),
+		WithRefreshExpiry(36*time.Hour),
+		WithBCryptCost(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "durations@example.com")
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != 15*time.Minute {
+		t.Errorf("Expected a 15m access token, got %v", lifetime)
+	}
+	if auth.refreshExpiry != 36*time.Hour {
+		t.Errorf("Expected a 36h refresh expiry, got %v", auth.refreshExpiry)
+	}
+}
+
+func TestNewWithOptionsStore(t *testing.T) {
+	store := NewMemoryLockoutStore()
+	auth, err := NewWithOptions(WithJWTSecret("test-secret-key-for-testing-only"), WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	if auth.config.LockoutStore != store {
+		t.Error("Expected WithStore to set the lockout store")
+	}
+	if _, ok := auth.config.RevocationStore.(*MemoryRevocationStore); !ok {
+		t.Error("Expected the other stores to keep their defaults")
+	}
+}
+
+func TestNewWithOptionsErrors(t *testing.T) {
+	privatePEM, _ := testKeyPair(t, SigningMethodRS256)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"secret and key pair", []Option{WithJWTSecret("secret"), WithSigningKey(SigningMethodRS256, privatePEM)}, "JWTSecret can't be combined"},
+		{"key pair and secret", []Option{WithSigningKey(SigningMethodRS256, privatePEM), WithJWTSecret("secret")}, "JWTSecret can't be combined"},
+		{"config with secret and key pair", []Option{WithConfig(Config{JWTSecret: "secret", SigningMethod: SigningMethodRS256, PrivateKeyPEM: privatePEM})}, "JWTSecret can't be combined"},
+		{"empty secret", []Option{WithJWTSecret("")}, "empty JWT secret"},
+		{"HS256 key pair", []Option{WithSigningKey(SigningMethodHS256, privatePEM)}, "asymmetric"},
+		{"zero token expiry", []Option{WithJWTSecret("secret"), WithTokenExpiry(0)}, "token expiry"},
+		{"negative refresh expiry", []Option{WithJWTSecret("secret"), WithRefreshExpiry(-time.Hour)}, "refresh expiry"},
+		{"token expiry above maximum", []Option{WithConfig(Config{MaxTokenExpiry: "1h"}), WithJWTSecret("secret"), WithTokenExpiry(2 * time.Hour)}, "MaxTokenExpiry"},
+		{"not a store", []Option{WithJWTSecret("secret"), WithStore("redis")}, "no store interface"},
+		{"invalid combined config", []Option{WithJWTSecret("secret"), WithPasswordPolicy(PasswordPolicy{MinLength: 20, MaxLength: 10})}, "MinLength"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewWithOptions(tt.opts...)
+			if err == nil {
+				auth.Close()
+				t.Fatal("Expected an error")
+			}
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected ErrInvalidConfig mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNewWithOptionsSigningKey(t *testing.T) {
+	privatePEM, _ := testKeyPair(t, SigningMethodES256)
+	auth, err := NewWithOptions(WithSigningKey(SigningMethodES256, privatePEM), WithBCryptCost(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "es256@example.com")
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the ES256 token to validate, got %v", err)
+	}
+}
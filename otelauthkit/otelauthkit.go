@@ -0,0 +1,74 @@
+// Package otelauthkit adapts OpenTelemetry tracing to authkit.Tracer, so
+// applications not using OpenTelemetry don't depend on it through authkit.
+//
+//	auth := authkit.New(authkit.Config{
+//	    JWTSecret: "your-secret",
+//	    Tracer:    otelauthkit.NewTracer(nil), // the global TracerProvider
+//	})
+package otelauthkit
+
+import (
+	"context"
+
+	"github.com/codedbygo/go-authkit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans
+const ScopeName = "github.com/codedbygo/go-authkit"
+
+// Tracer is an authkit.Tracer starting OpenTelemetry spans
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates a Tracer from provider, or from the global
+// TracerProvider when provider is nil
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(ScopeName)}
+}
+
+// Start implements authkit.Tracer
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, authkit.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, otelSpan{span}
+}
+
+// SpanFromContext implements authkit.Tracer
+func (t *Tracer) SpanFromContext(ctx context.Context) authkit.Span {
+	return otelSpan{trace.SpanFromContext(ctx)}
+}
+
+// otelSpan is an authkit.Span wrapping an OpenTelemetry span
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttribute implements authkit.Span
+func (s otelSpan) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// AddEvent implements authkit.Span
+func (s otelSpan) AddEvent(name string, attrs map[string]string) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for key, value := range attrs {
+		kvs = append(kvs, attribute.String(key, value))
+	}
+	s.span.AddEvent(name, trace.WithAttributes(kvs...))
+}
+
+// End implements authkit.Span, recording err and an error status
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, authkit.ErrorCode(err))
+	}
+	s.span.End()
+}
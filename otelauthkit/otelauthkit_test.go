@@ -0,0 +1,170 @@
+package otelauthkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codedbygo/go-authkit"
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracedKit(hashUserIDs bool) (*authkit.AuthKit, *tracetest.SpanRecorder, trace.TracerProvider) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	auth := authkit.New(authkit.Config{
+		JWTSecret:        "test-secret-key-for-testing-only",
+		BCryptCost:       4,
+		MaxLoginAttempts: 5,
+		Tracer:           NewTracer(provider),
+		TraceHashUserIDs: hashUserIDs,
+	})
+	return auth, recorder, provider
+}
+
+// spanAttrs returns the string attributes of a span
+func spanAttrs(span sdktrace.ReadOnlySpan) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsString()
+	}
+	return attrs
+}
+
+// findSpans returns the ended spans with the name
+func findSpans(recorder *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+func TestTracerSpans(t *testing.T) {
+	auth, recorder, provider := newTracedKit(false)
+	defer auth.Close()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	user, err := auth.RegisterUserCtx(ctx, authkit.RegisterRequest{Email: "trace@example.com", Password: "password123", Name: "Trace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoginUserCtx(ctx, "trace@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = auth.LoginUserCtx(ctx, "trace@example.com", "wrong-password")
+	if _, err := auth.ValidateTokenCtx(ctx, tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.RefreshTokenCtx(ctx, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	for _, name := range []string{"authkit.RegisterUser", "authkit.ValidateToken", "authkit.RefreshToken"} {
+		spans := findSpans(recorder, name)
+		if len(spans) != 1 {
+			t.Fatalf("Expected one %s span, got %d", name, len(spans))
+		}
+		attrs := spanAttrs(spans[0])
+		if attrs[authkit.TraceAttrUserID] != user.ID || attrs[authkit.TraceAttrResult] != "success" {
+			t.Errorf("Expected %s with the user ID and result, got %v", name, attrs)
+		}
+		if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of the caller's span", name)
+		}
+	}
+
+	logins := findSpans(recorder, "authkit.LoginUser")
+	if len(logins) != 2 {
+		t.Fatalf("Expected two login spans, got %d", len(logins))
+	}
+	failed := logins[1]
+	if attrs := spanAttrs(failed); attrs[authkit.TraceAttrErrorCode] != authkit.CodeInvalidCredentials {
+		t.Errorf("Expected the failed login's error code, got %v", attrs)
+	}
+	if failed.Status().Code.String() != "Error" || len(failed.Events()) == 0 {
+		t.Errorf("Expected the failed login to record its error, got %+v", failed.Status())
+	}
+
+	for _, name := range []string{"authkit.LockoutStore.RecordAttempt", "authkit.LockoutStore.Reset", "authkit.LoginHistoryStore.Record", "authkit.RevocationStore.IsRevoked"} {
+		spans := findSpans(recorder, name)
+		if len(spans) == 0 {
+			t.Errorf("Expected a %s span", name)
+			continue
+		}
+		if spans[0].Parent().TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("Expected %s to be in the caller's trace", name)
+		}
+	}
+}
+
+func TestTracerHashesUserIDs(t *testing.T) {
+	auth, recorder, _ := newTracedKit(true)
+	defer auth.Close()
+
+	user, err := auth.RegisterUser(authkit.RegisterRequest{Email: "hash@example.com", Password: "password123", Name: "Hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := findSpans(recorder, "authkit.RegisterUser")
+	if len(spans) != 1 {
+		t.Fatalf("Expected one registration span, got %d", len(spans))
+	}
+	if id := spanAttrs(spans[0])[authkit.TraceAttrUserID]; id == "" || id == user.ID {
+		t.Errorf("Expected a hashed user ID, got %q", id)
+	}
+}
+
+func TestMiddlewareSpanEvents(t *testing.T) {
+	auth, recorder, provider := newTracedKit(false)
+	defer auth.Close()
+
+	if _, err := auth.RegisterUser(authkit.RegisterRequest{Email: "mw@example.com", Password: "password123", Name: "MW"}); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoginUser("mw@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/protected", auth.GinMiddleware(), func(c *gin.Context) {})
+	serve := func(header string) sdktrace.ReadOnlySpan {
+		ctx, server := provider.Tracer("test").Start(context.Background(), "GET /protected", trace.WithSpanKind(trace.SpanKindServer))
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil).WithContext(ctx)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		server.End()
+		ended := recorder.Ended()
+		return ended[len(ended)-1]
+	}
+
+	accepted := serve("Bearer " + tokens.AccessToken)
+	if events := accepted.Events(); len(events) != 1 || events[0].Name != authkit.TraceEventAuthenticated {
+		t.Errorf("Expected the authenticated event on the server span, got %+v", events)
+	}
+	validations := findSpans(recorder, "authkit.ValidateToken")
+	if len(validations) != 1 || validations[0].Parent().SpanID() != accepted.SpanContext().SpanID() {
+		t.Error("Expected the validation span to be a child of the server span")
+	}
+
+	rejected := serve("")
+	events := rejected.Events()
+	if len(events) != 1 || events[0].Name != authkit.TraceEventRejected {
+		t.Fatalf("Expected the rejected event on the server span, got %+v", events)
+	}
+	if code := events[0].Attributes[0].Value.AsString(); code != authkit.CodeMissingAuthorization {
+		t.Errorf("Expected the rejection reason, got %q", code)
+	}
+}
@@ -1,11 +1,32 @@
 package authkit
 
 import (
+	"context"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password with the configured Config.PasswordHasher.
+// With Config.MaxConcurrentHashes set, it waits for a free slot first.
 func (a *AuthKit) HashPassword(password string) (string, error) {
+	return a.hashPasswordCtx(context.Background(), password)
+}
+
+// hashPasswordCtx is HashPassword waiting for a slot until ctx is done
+func (a *AuthKit) hashPasswordCtx(ctx context.Context, password string) (hashedPassword string, err error) {
+	err = a.withHashSlot(ctx, func() error {
+		hashedPassword, err = a.hashPassword(password)
+		return err
+	})
+	return hashedPassword, err
+}
+
+// hashPassword hashes a password right away, see HashPassword
+func (a *AuthKit) hashPassword(password string) (string, error) {
+	password = pepperPassword(password, a.config.PasswordPepper)
+	if a.config.PasswordHasher == PasswordHasherArgon2id {
+		return HashPasswordArgon2(password, a.config.Argon2)
+	}
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), a.config.BCryptCost)
 	if err != nil {
 		return "", err
@@ -13,13 +34,133 @@ func (a *AuthKit) HashPassword(password string) (string, error) {
 	return string(hashedBytes), nil
 }
 
-// ComparePassword compares a hashed password with a plaintext password
+// ComparePassword compares a hashed password with a plaintext password. Both
+// bcrypt and Argon2id hashes are accepted, whatever the configured hasher, as
+// are hashes made with a previous pepper. With Config.MaxConcurrentHashes
+// set, it waits for a free slot first, and returns false if the queue is full.
 func (a *AuthKit) ComparePassword(hashedPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	ok, _ := a.comparePasswordCtx(context.Background(), hashedPassword, password)
+	return ok
+}
+
+// comparePasswordCtx is ComparePassword waiting for a slot until ctx is done
+func (a *AuthKit) comparePasswordCtx(ctx context.Context, hashedPassword, password string) (ok bool, err error) {
+	err = a.withHashSlot(ctx, func() error {
+		ok, _ = a.matchPassword(hashedPassword, password)
+		return nil
+	})
+	return ok, err
+}
+
+// compareDummyPassword spends as long as a real password check, so logins for
+// unknown emails can't be told apart by response time
+func (a *AuthKit) compareDummyPassword(ctx context.Context, password string) error {
+	a.dummyHashOnce.Do(func() {
+		a.dummyHash, _ = a.hashPassword("authkit-dummy-password")
+	})
+	_, err := a.comparePasswordCtx(ctx, a.dummyHash, password)
+	return err
+}
+
+// ChangePassword replaces a user's password after verifying the current one,
+// clearing User.MustChangePassword. Unless Config.KeepTokensOnPasswordChange
+// is set, every token issued to the user so far stops working.
+func (a *AuthKit) ChangePassword(userID, oldPassword, newPassword string) error {
+	return a.ChangePasswordCtx(context.Background(), userID, oldPassword, newPassword)
+}
+
+// ChangePasswordCtx is ChangePassword with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) ChangePasswordCtx(ctx context.Context, userID, oldPassword, newPassword string) (err error) {
+	a.debugCheck()
+	defer func() { err = opError("change password", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	ok, err := a.comparePasswordCtx(ctx, user.Password, oldPassword)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidPassword
+	}
+	if err := a.checkNewPassword(ctx, newPassword, user.Email); err != nil {
+		return err
+	}
+
+	return a.replacePassword(ctx, userID, user.Password, newPassword, false)
+}
+
+// SetPassword replaces a user's password without the current one, for admins.
+// Tokens are revoked as with ChangePassword; the BreachChecker isn't consulted.
+// It clears User.MustChangePassword, unlike SetTemporaryPassword.
+func (a *AuthKit) SetPassword(userID, newPassword string) error {
+	a.debugCheck()
+
+	return a.replacePassword(context.Background(), userID, "", newPassword, false)
+}
+
+// SetTemporaryPassword is SetPassword for a password the user must replace:
+// it sets User.MustChangePassword, so logins succeed with tokens that only
+// permit changing the password until ChangePassword is called.
+func (a *AuthKit) SetTemporaryPassword(userID, newPassword string) error {
+	a.debugCheck()
+
+	return a.replacePassword(context.Background(), userID, "", newPassword, true)
+}
+
+// replacePassword checks and hashes newPassword and stores it, setting
+// User.MustChangePassword to mustChange. A non-empty expectedHash makes it
+// fail with ErrInvalidPassword if the password was changed concurrently after
+// the caller verified it.
+func (a *AuthKit) replacePassword(ctx context.Context, userID, expectedHash, newPassword string, mustChange bool) error {
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := a.CheckPassword(newPassword, user.Email); err != nil {
+		return err
+	}
+
+	// Hash before taking the lock so concurrent operations aren't blocked on
+	// bcrypt, and not at all if the request was given up on
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hashedPassword, err := a.hashPasswordCtx(ctx, newPassword)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	if expectedHash != "" && stored.Password != expectedHash {
+		return ErrInvalidPassword
+	}
+
+	updated := cloneUser(stored)
+	a.setPassword(updated, hashedPassword)
+	if mustChange {
+		a.requirePasswordChange(updated)
+	} else {
+		updated.MustChangePassword = false
+	}
+	updated.UpdatedAt = a.now()
+	a.users.put(updated)
+	return nil
 }
 
-// HashPasswordStatic is a static method for hashing passwords without AuthKit instance
+// HashPasswordStatic is a static method for hashing passwords with bcrypt without AuthKit instance
 func HashPasswordStatic(password string, cost int) (string, error) {
 	if cost == 0 {
 		cost = 12 // default cost
@@ -31,7 +172,8 @@ func HashPasswordStatic(password string, cost int) (string, error) {
 	return string(hashedBytes), nil
 }
 
-// ComparePasswordStatic is a static method for comparing passwords without AuthKit instance
+// ComparePasswordStatic is a static method for comparing passwords with a bcrypt hash without
+// AuthKit instance; see ComparePasswordAny for Argon2id hashes
 func ComparePasswordStatic(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
@@ -0,0 +1,225 @@
+package authkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported values for Config.PasswordHasher
+const (
+	PasswordHasherBcrypt   = "bcrypt"
+	PasswordHasherArgon2id = "argon2id"
+)
+
+// argon2idPrefix starts Argon2id hashes in the PHC string format
+const argon2idPrefix = "$argon2id$"
+
+// Sizes of the salt and derived key of Argon2id hashes, in bytes
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// prehashedMaxPasswordLength is PasswordPolicy.MaxLength's upper bound when
+// the whole password is hashed: with Argon2id, or with a pepper
+const prehashedMaxPasswordLength = 1024
+
+// maxPreviousPasswordPeppers bounds Config.PreviousPasswordPeppers, as failed
+// logins hash the password once per pepper
+const maxPreviousPasswordPeppers = 5
+
+// Argon2Params tunes Argon2id hashing. Zero fields take the defaults, which
+// follow RFC 9106's recommendation for memory-constrained environments.
+type Argon2Params struct {
+	Memory      uint32 // Memory in KiB (default: 65536, 64 MiB)
+	Time        uint32 // Number of passes over the memory (default: 3)
+	Parallelism uint8  // Number of threads (default: 2)
+}
+
+// withDefaults fills in the zero fields of p
+func (p Argon2Params) withDefaults() Argon2Params {
+	if p.Memory == 0 {
+		p.Memory = 64 * 1024
+	}
+	if p.Time == 0 {
+		p.Time = 3
+	}
+	if p.Parallelism == 0 {
+		p.Parallelism = 2
+	}
+	return p
+}
+
+// HashPasswordArgon2 hashes a password with Argon2id, encoding the parameters
+// and salt in the PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$key)
+// so ComparePasswordAny needs nothing else to check it
+func HashPasswordArgon2(password string, params Argon2Params) (string, error) {
+	params = params.withDefaults()
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Time, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// ComparePasswordAny compares a plaintext password with a bcrypt or Argon2id
+// hash, telling them apart by their prefix
+func ComparePasswordAny(hashedPassword, password string) bool {
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		return compareArgon2(hashedPassword, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+}
+
+// compareArgon2 checks password against an Argon2id hash in the PHC string format
+func compareArgon2(hashedPassword, password string) bool {
+	params, salt, key, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return false
+	}
+	derived := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+// parseArgon2Hash splits an Argon2id hash into its parameters, salt and key
+func parseArgon2Hash(hashedPassword string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != PasswordHasherArgon2id {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if params.Time == 0 || params.Parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	return params, salt, key, nil
+}
+
+// pepperPassword returns what is hashed in place of password with pepper: the
+// base64 of HMAC-SHA256(pepper, password). At 44 bytes it fits bcrypt's 72
+// byte input, so no part of a long password is ignored. An empty pepper
+// leaves the password as it is.
+func pepperPassword(password, pepper string) string {
+	if pepper == "" {
+		return password
+	}
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HashPasswordStaticPeppered is HashPasswordStatic mixing pepper into the password
+func HashPasswordStaticPeppered(password, pepper string, cost int) (string, error) {
+	return HashPasswordStatic(pepperPassword(password, pepper), cost)
+}
+
+// HashPasswordArgon2Peppered is HashPasswordArgon2 mixing pepper into the password
+func HashPasswordArgon2Peppered(password, pepper string, params Argon2Params) (string, error) {
+	return HashPasswordArgon2(pepperPassword(password, pepper), params)
+}
+
+// ComparePasswordPeppered is ComparePasswordAny for hashes made with one of
+// peppers, which are tried in order. An empty pepper matches hashes made
+// without one.
+func ComparePasswordPeppered(hashedPassword, password string, peppers ...string) bool {
+	for _, pepper := range peppers {
+		if ComparePasswordAny(hashedPassword, pepperPassword(password, pepper)) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordPeppers returns the configured peppers, current first
+func (a *AuthKit) passwordPeppers() []string {
+	return append([]string{a.config.PasswordPepper}, a.config.PreviousPasswordPeppers...)
+}
+
+// matchPassword compares password with a hash made with any configured
+// pepper, reporting whether it matched and whether it was the current one
+func (a *AuthKit) matchPassword(hashedPassword, password string) (ok, currentPepper bool) {
+	for i, pepper := range a.passwordPeppers() {
+		if ComparePasswordAny(hashedPassword, pepperPassword(password, pepper)) {
+			return true, i == 0
+		}
+	}
+	return false, false
+}
+
+// isPasswordHash reports whether s is a bcrypt or Argon2id hash rather than a
+// plaintext password
+func isPasswordHash(s string) bool {
+	if strings.HasPrefix(s, argon2idPrefix) {
+		_, _, _, err := parseArgon2Hash(s)
+		return err == nil
+	}
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil
+}
+
+// needsRehash reports whether hashedPassword was made with another scheme or
+// other parameters than the configured ones
+func (a *AuthKit) needsRehash(hashedPassword string) bool {
+	if a.config.PasswordHasher == PasswordHasherArgon2id {
+		params, _, _, err := parseArgon2Hash(hashedPassword)
+		return err != nil || params != a.config.Argon2
+	}
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != a.config.BCryptCost
+}
+
+// rehashPassword replaces the hash of a user who just logged in with password
+// by one made with the current pepper and configured scheme. It does so when
+// the hash used a previous pepper, or if Config.RehashOnLogin is set and the
+// scheme or its parameters are outdated. Failures are logged and otherwise
+// ignored, the old hash keeps working.
+func (a *AuthKit) rehashPassword(ctx context.Context, user *User, password string, currentPepper bool) {
+	if currentPepper && (!a.config.RehashOnLogin || !a.needsRehash(user.Password)) {
+		return
+	}
+	hashedPassword, err := a.hashPasswordCtx(ctx, password)
+	if err != nil {
+		a.config.Logger.Warn("password rehash failed", "user_id", user.ID, "error", err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Skip it if the password changed meanwhile. Tokens stay valid, as the
+	// password itself is the same.
+	if stored, exists := a.users.get(user.ID); exists && stored.Password == user.Password {
+		rehashed := cloneUser(stored)
+		rehashed.Password = hashedPassword
+		a.users.put(rehashed)
+		a.config.Logger.Info("password rehashed", "user_id", user.ID, "hasher", a.config.PasswordHasher)
+	}
+}
@@ -0,0 +1,257 @@
+package authkit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps Argon2id hashing fast in tests
+var testArgon2 = Argon2Params{Memory: 1024, Time: 1, Parallelism: 1}
+
+func TestHashPasswordArgon2(t *testing.T) {
+	hash, err := HashPasswordArgon2("password123", testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected a PHC string with the parameters, got %s", hash)
+	}
+	if !ComparePasswordAny(hash, "password123") {
+		t.Error("Expected the password to match")
+	}
+	if ComparePasswordAny(hash, "password124") {
+		t.Error("Expected another password not to match")
+	}
+	if other, _ := HashPasswordArgon2("password123", testArgon2); other == hash {
+		t.Error("Expected a random salt")
+	}
+
+	// Unlike bcrypt, bytes beyond the 72nd count
+	long := strings.Repeat("a", 80)
+	hash, _ = HashPasswordArgon2(long, testArgon2)
+	if ComparePasswordAny(hash, long[:72]) {
+		t.Error("Expected a truncated password not to match")
+	}
+
+	bcryptHash, _ := HashPasswordStatic("password123", 4)
+	if !ComparePasswordAny(bcryptHash, "password123") {
+		t.Error("Expected bcrypt hashes to be accepted")
+	}
+	for _, invalid := range []string{"", "password123", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if ComparePasswordAny(invalid, "password123") {
+			t.Errorf("Expected %q not to match", invalid)
+		}
+	}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	auth := newTestKit(t, Config{PasswordHasher: PasswordHasherArgon2id, Argon2: testArgon2})
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "argon@example.com")
+	user, _ := auth.GetUserByID(tokens.User.ID)
+	if !strings.HasPrefix(user.Password, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected an Argon2id hash with the configured parameters, got %s", user.Password)
+	}
+	if _, err := auth.LoginUser("argon@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestPasswordHasherCrossSchemeLogin(t *testing.T) {
+	auth := newTestKit(t, Config{Argon2: testArgon2})
+	defer auth.Close()
+	old := loginTestUser(t, auth, "bcrypt@example.com")
+
+	// Switching hashers leaves existing hashes alone unless RehashOnLogin is set
+	auth.config.PasswordHasher = PasswordHasherArgon2id
+	loginTestUser(t, auth, "argon@example.com")
+	if _, err := auth.LoginUser("bcrypt@example.com", "password123"); err != nil {
+		t.Fatalf("Expected the bcrypt user to log in, got %v", err)
+	}
+	user, _ := auth.GetUserByID(old.User.ID)
+	if _, err := bcrypt.Cost([]byte(user.Password)); err != nil {
+		t.Errorf("Expected the bcrypt hash to be kept, got %s", user.Password)
+	}
+
+	auth.config.PasswordHasher = PasswordHasherBcrypt
+	if _, err := auth.LoginUser("argon@example.com", "password123"); err != nil {
+		t.Errorf("Expected the Argon2id user to log in with the bcrypt hasher, got %v", err)
+	}
+}
+
+func TestRehashOnLogin(t *testing.T) {
+	auth := newTestKit(t, Config{Argon2: testArgon2})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "upgrade@example.com")
+
+	auth.config.PasswordHasher = PasswordHasherArgon2id
+	auth.config.RehashOnLogin = true
+	if _, err := auth.LoginUser("upgrade@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	user, _ := auth.GetUserByID(tokens.User.ID)
+	if strings.HasPrefix(user.Password, argon2idPrefix) {
+		t.Fatal("Expected a failed login not to rehash")
+	}
+
+	if _, err := auth.LoginUser("upgrade@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = auth.GetUserByID(tokens.User.ID)
+	if !strings.HasPrefix(user.Password, argon2idPrefix) {
+		t.Fatalf("Expected the hash to be upgraded to Argon2id, got %s", user.Password)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Errorf("Expected tokens to survive the rehash, got %v", err)
+	}
+	if _, err := auth.LoginUser("upgrade@example.com", "password123"); err != nil {
+		t.Errorf("Expected the upgraded hash to work, got %v", err)
+	}
+
+	// New parameters are picked up too
+	upgraded := user.Password
+	auth.config.Argon2.Time = 2
+	if _, err := auth.LoginUser("upgrade@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = auth.GetUserByID(tokens.User.ID)
+	if user.Password == upgraded || !strings.Contains(user.Password, "t=2") {
+		t.Errorf("Expected a rehash with the new parameters, got %s", user.Password)
+	}
+}
+
+func TestPasswordHasherValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"unknown hasher", Config{PasswordHasher: "scrypt"}, false},
+		{"long passwords with bcrypt", Config{PasswordPolicy: PasswordPolicy{MaxLength: 128}}, false},
+		{"long passwords with argon2id", Config{PasswordHasher: PasswordHasherArgon2id, PasswordPolicy: PasswordPolicy{MaxLength: 128}}, true},
+		{"too long passwords with argon2id", Config{PasswordHasher: PasswordHasherArgon2id, PasswordPolicy: PasswordPolicy{MaxLength: 4096}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.JWTSecret = "test-secret-key-for-testing-only"
+			auth, err := NewValidated(tt.config)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Expected a valid config, got %v", err)
+				}
+				auth.Close()
+			} else if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPasswordHasher(t *testing.T) {
+	path := writeConfigFile(t, "authkit.yaml", `
+jwt_secret: secret
+password_hasher: argon2id
+argon2:
+  memory: 32768
+  time: 2
+rehash_on_login: true
+`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PasswordHasher != PasswordHasherArgon2id || !config.RehashOnLogin || config.Argon2 != (Argon2Params{Memory: 32768, Time: 2}) {
+		t.Errorf("Expected the Argon2id settings, got %q, %v and %+v", config.PasswordHasher, config.RehashOnLogin, config.Argon2)
+	}
+}
+
+func TestPasswordPepper(t *testing.T) {
+	auth := newTestKit(t, Config{PasswordPepper: "pepper-one"})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "pepper@example.com")
+
+	user, _ := auth.GetUserByID(tokens.User.ID)
+	if ComparePasswordAny(user.Password, "password123") {
+		t.Error("Expected the hash not to match the password without the pepper")
+	}
+	if !ComparePasswordPeppered(user.Password, "password123", "pepper-two", "pepper-one") {
+		t.Error("Expected the hash to match with the pepper")
+	}
+
+	auth.config.PasswordPepper = "pepper-two"
+	if _, err := auth.LoginUser("pepper@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected another pepper to reject the password, got %v", err)
+	}
+}
+
+func TestPasswordPepperRotation(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "rotation@example.com")
+
+	// Introducing a pepper: hashes without one still work and get upgraded
+	auth.config.PasswordPepper = "pepper-one"
+	auth.config.PreviousPasswordPeppers = []string{""}
+	if _, err := auth.LoginUser("rotation@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := auth.GetUserByID(tokens.User.ID)
+	if !ComparePasswordPeppered(user.Password, "password123", "pepper-one") {
+		t.Fatal("Expected a rehash with the new pepper")
+	}
+
+	auth.config.PasswordPepper = "pepper-two"
+	auth.config.PreviousPasswordPeppers = []string{"pepper-one"}
+	if _, err := auth.LoginUser("rotation@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := auth.LoginUser("rotation@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = auth.GetUserByID(tokens.User.ID)
+	if !ComparePasswordPeppered(user.Password, "password123", "pepper-two") {
+		t.Error("Expected a rehash with the current pepper")
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Errorf("Expected tokens to survive the rehash, got %v", err)
+	}
+
+	auth.config.PreviousPasswordPeppers = nil
+	if _, err := auth.LoginUser("rotation@example.com", "password123"); err != nil {
+		t.Errorf("Expected the login to work once the old pepper is dropped, got %v", err)
+	}
+}
+
+func TestPasswordPepperLongPasswords(t *testing.T) {
+	long := strings.Repeat("x", 72) + "-and-more"
+
+	// bcrypt alone refuses input beyond 72 bytes
+	if _, err := HashPasswordStatic(long, 4); !errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		t.Errorf("Expected bcrypt.ErrPasswordTooLong, got %v", err)
+	}
+
+	// With a pepper it hashes a fixed-size digest of the whole password
+	hash, err := HashPasswordStaticPeppered(long, "pepper", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ComparePasswordPeppered(hash, long, "pepper") {
+		t.Error("Expected the long password to match")
+	}
+	if ComparePasswordPeppered(hash, long[:72], "pepper") {
+		t.Error("Expected the bytes beyond the 72nd to count")
+	}
+
+	hash, _ = HashPasswordArgon2Peppered(long, "pepper", testArgon2)
+	if !ComparePasswordPeppered(hash, long, "pepper") || ComparePasswordPeppered(hash, long, "other") {
+		t.Error("Expected the Argon2id hash to match with its pepper only")
+	}
+
+	if _, err := NewValidated(Config{JWTSecret: "secret", PasswordPepper: "pepper", PasswordPolicy: PasswordPolicy{MaxLength: 256}}); err != nil {
+		t.Errorf("Expected passwords beyond 72 bytes to be allowed with a pepper, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package authkit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// bcryptMaxPasswordLength is the number of bytes bcrypt looks at; anything
+// beyond it is silently ignored
+const bcryptMaxPasswordLength = 72
+
+// defaultMinPasswordLength is PasswordPolicy.MinLength when unset
+const defaultMinPasswordLength = 8
+
+// Rules reported in PasswordPolicyError.Failures
+const (
+	PasswordRuleMinLength    = "min_length"
+	PasswordRuleMaxLength    = "max_length"
+	PasswordRuleUppercase    = "uppercase"
+	PasswordRuleLowercase    = "lowercase"
+	PasswordRuleDigit        = "digit"
+	PasswordRuleSymbol       = "symbol"
+	PasswordRuleMatchesEmail = "matches_email"
+)
+
+// PasswordPolicy is the strength policy new passwords must meet. The zero
+// value requires 8 to 72 characters and a password different from the email.
+type PasswordPolicy struct {
+	// Disabled turns off every check
+	Disabled bool
+	// MinLength is the minimum number of characters (default: 8)
+	MinLength int
+	// MaxLength is the maximum length in bytes, at most bcrypt's 72 or 1024 with
+	// the argon2id PasswordHasher (default: 72)
+	MaxLength int
+
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+}
+
+// PasswordPolicyError lists the rules a password failed. It matches ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Failures []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error() + ": " + strings.Join(e.Failures, ", ")
+}
+
+// Unwrap returns ErrWeakPassword
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Check returns a *PasswordPolicyError if password fails the policy
+func (p PasswordPolicy) Check(password, email string) error {
+	if p.Disabled {
+		return nil
+	}
+
+	minLength, maxLength := p.MinLength, p.MaxLength
+	if minLength <= 0 {
+		minLength = defaultMinPasswordLength
+	}
+	if maxLength <= 0 {
+		maxLength = bcryptMaxPasswordLength
+	}
+
+	var upper, lower, digit, symbol bool
+	length := 0
+	for _, r := range password {
+		length++
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var failures []string
+	if length < minLength {
+		failures = append(failures, PasswordRuleMinLength)
+	}
+	if len(password) > maxLength {
+		failures = append(failures, PasswordRuleMaxLength)
+	}
+	if p.RequireUppercase && !upper {
+		failures = append(failures, PasswordRuleUppercase)
+	}
+	if p.RequireLowercase && !lower {
+		failures = append(failures, PasswordRuleLowercase)
+	}
+	if p.RequireDigit && !digit {
+		failures = append(failures, PasswordRuleDigit)
+	}
+	if p.RequireSymbol && !symbol {
+		failures = append(failures, PasswordRuleSymbol)
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		failures = append(failures, PasswordRuleMatchesEmail)
+	}
+
+	if len(failures) > 0 {
+		return &PasswordPolicyError{Failures: failures}
+	}
+	return nil
+}
+
+// CheckPassword checks password against the configured PasswordPolicy
+func (a *AuthKit) CheckPassword(password, email string) error {
+	return a.config.PasswordPolicy.Check(password, email)
+}
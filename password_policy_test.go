@@ -0,0 +1,87 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 10, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		email    string
+		failures []string
+	}{
+		{"default accepts 8 characters", PasswordPolicy{}, "abcdefgh", "", nil},
+		{"default rejects short", PasswordPolicy{}, "a", "", []string{PasswordRuleMinLength}},
+		{"default rejects over 72 bytes", PasswordPolicy{}, strings.Repeat("a", 73), "", []string{PasswordRuleMaxLength}},
+		{"length counts characters", PasswordPolicy{}, "ééééééé", "", []string{PasswordRuleMinLength}},
+		{"rejects the email", PasswordPolicy{}, "User@Example.com", "user@example.com", []string{PasswordRuleMatchesEmail}},
+		{"strict accepts", strict, "Correct-Horse-1", "", nil},
+		{"strict lists every failure", strict, "lowercase", "", []string{PasswordRuleMinLength, PasswordRuleUppercase, PasswordRuleDigit, PasswordRuleSymbol}},
+		{"disabled accepts anything", PasswordPolicy{Disabled: true}, "a", "a", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password, tt.email)
+			if tt.failures == nil {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("Expected a PasswordPolicyError wrapping ErrWeakPassword, got %v", err)
+			}
+			if !reflect.DeepEqual(policyErr.Failures, tt.failures) {
+				t.Errorf("Expected failures %v, got %v", tt.failures, policyErr.Failures)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	if err := (Config{PasswordPolicy: PasswordPolicy{MaxLength: 100}}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected MaxLength over 72 to be rejected, got %v", err)
+	}
+	if err := (Config{PasswordPolicy: PasswordPolicy{MinLength: 20, MaxLength: 10}}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected MinLength over MaxLength to be rejected, got %v", err)
+	}
+}
+
+func TestRegisterUserEnforcesPasswordPolicy(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "weak@example.com", Password: "x", Name: "Weak"}); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := auth.GetUserByEmail("weak@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the user not to be stored, got %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	// Bypasses the min=8 binding tag, so the policy must catch it
+	body := `{"email":"weak@example.com","password":"weak@example.com","name":"Weak"}`
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"rules":["matches_email"]`) {
+		t.Errorf("Expected 400 listing the failed rule, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,117 @@
+package authkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// NoncePurposePasswordReset is the nonce purpose of password reset tokens
+const NoncePurposePasswordReset = "password_reset"
+
+// passwordResetSentMessage is the forgot password response, whether or not the email exists
+const passwordResetSentMessage = "If the email is registered, a password reset link has been sent"
+
+// defaultPasswordResetExpiry is Config.PasswordResetExpiry when unset
+const defaultPasswordResetExpiry = 30 * time.Minute
+
+// CreatePasswordResetToken issues a single-use token that lets the user with
+// the given email set a new password within Config.PasswordResetExpiry. The
+// token also stops working once the password changes by other means.
+func (a *AuthKit) CreatePasswordResetToken(email string) (string, error) {
+	return a.CreatePasswordResetTokenInTenant("", email)
+}
+
+// CreatePasswordResetTokenInTenant is CreatePasswordResetToken for the user
+// with the email in the tenant, see LoginUserInTenant
+func (a *AuthKit) CreatePasswordResetTokenInTenant(tenantID, email string) (string, error) {
+	a.debugCheck()
+
+	user, err := a.GetUserByEmailInTenant(tenantID, email)
+	if err != nil {
+		return "", err
+	}
+	return a.passwordResetToken(user)
+}
+
+// passwordResetToken issues a reset token bound to the user's current password
+func (a *AuthKit) passwordResetToken(user *User) (string, error) {
+	return a.IssueNonce(NoncePurposePasswordReset, a.config.PasswordResetExpiry, map[string]string{
+		"user_id":  user.ID,
+		"password": passwordFingerprint(user.Password),
+	})
+}
+
+// RequestPasswordReset creates a reset token and delivers it with
+// Config.SendPasswordReset, or else as the built-in email through
+// Config.EmailSender. Unknown emails return nil without sending anything, so
+// callers can't learn which emails are registered.
+func (a *AuthKit) RequestPasswordReset(email string) error {
+	return a.RequestPasswordResetInTenant("", email)
+}
+
+// RequestPasswordResetInTenant is RequestPasswordReset for the user with the
+// email in the tenant, see LoginUserInTenant
+func (a *AuthKit) RequestPasswordResetInTenant(tenantID, email string) error {
+	if a.config.SendPasswordReset == nil && a.config.EmailSender == nil {
+		return ErrNoEmailSender
+	}
+
+	user, err := a.GetUserByEmailInTenant(tenantID, email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := a.passwordResetToken(user)
+	if err != nil {
+		return err
+	}
+	return a.deliverToken(EmailPasswordReset, a.config.SendPasswordReset, a.config.PasswordResetURL,
+		a.config.PasswordResetExpiry, a.userToUserInfo(user), token)
+}
+
+// ResetPassword sets a new password using a token from CreatePasswordResetToken,
+// consuming the token. Like ChangePassword, it revokes the user's existing
+// tokens; it also lifts any login lockout.
+func (a *AuthKit) ResetPassword(token, newPassword string) (err error) {
+	a.debugCheck()
+	defer func() { err = opError("reset password", err) }()
+
+	// Catch most policy failures and breached passwords before the token is spent
+	if err := a.checkNewPassword(context.Background(), newPassword, ""); err != nil {
+		return err
+	}
+
+	meta, err := a.ConsumeNonce(token, NoncePurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.GetUserByID(meta["user_id"])
+	if err != nil {
+		return ErrInvalidNonce
+	}
+	if passwordFingerprint(user.Password) != meta["password"] {
+		return ErrInvalidNonce
+	}
+
+	if err := a.replacePassword(context.Background(), user.ID, user.Password, newPassword, false); err != nil {
+		if errors.Is(err, ErrInvalidPassword) {
+			return ErrInvalidNonce
+		}
+		return err
+	}
+
+	if a.lockoutEnabled() {
+		return a.config.LockoutStore.Reset(user.ID)
+	}
+	return nil
+}
+
+// passwordFingerprint identifies a password hash without storing it alongside the token
+func passwordFingerprint(hashedPassword string) string {
+	sum := sha256.Sum256([]byte(hashedPassword))
+	return hex.EncodeToString(sum[:])
+}
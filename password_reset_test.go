@@ -0,0 +1,143 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPasswordReset(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "forgot@example.com")
+
+	if _, err := auth.CreatePasswordResetToken("missing@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	token, err := auth.CreatePasswordResetToken("forgot@example.com")
+	if err != nil {
+		t.Fatalf("Expected a reset token, got %v", err)
+	}
+
+	if err := auth.ResetPassword(token, "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if err := auth.ResetPassword(token, "newpassword123"); err != nil {
+		t.Fatalf("Expected ResetPassword to succeed, got %v", err)
+	}
+	if err := auth.ResetPassword(token, "otherpassword123"); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected the token to be single-use, got %v", err)
+	}
+
+	if _, err := auth.LoginUser("forgot@example.com", "newpassword123"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected existing tokens to be revoked, got %v", err)
+	}
+
+	expired, _ := auth.CreatePasswordResetToken("forgot@example.com")
+	now = now.Add(31 * time.Minute)
+	if err := auth.ResetPassword(expired, "newpassword456"); !errors.Is(err, ErrNonceExpired) {
+		t.Errorf("Expected ErrNonceExpired, got %v", err)
+	}
+}
+
+func TestPasswordResetTokenBoundToPassword(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "bound@example.com")
+
+	token, _ := auth.CreatePasswordResetToken("bound@example.com")
+	if err := auth.ChangePassword(tokens.User.ID, "password123", "newpassword123"); err != nil {
+		t.Fatalf("Expected ChangePassword to succeed, got %v", err)
+	}
+	if err := auth.ResetPassword(token, "otherpassword123"); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected the token to stop working after a password change, got %v", err)
+	}
+}
+
+func TestPasswordResetLiftsLockout(t *testing.T) {
+	auth := newTestKit(t, Config{MaxLoginAttempts: 1})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "lockedout@example.com", Password: "password123", Name: "Locked"})
+	_, _ = auth.LoginUser("lockedout@example.com", "wrong-password")
+
+	token, _ := auth.CreatePasswordResetToken("lockedout@example.com")
+	if err := auth.ResetPassword(token, "newpassword123"); err != nil {
+		t.Fatalf("Expected ResetPassword to succeed, got %v", err)
+	}
+	if _, err := auth.LoginUser("lockedout@example.com", "newpassword123"); err != nil {
+		t.Errorf("Expected the reset to lift the lockout, got %v", err)
+	}
+}
+
+func TestPasswordResetHandlers(t *testing.T) {
+	sent := map[string]string{}
+	auth := newTestKit(t, Config{
+		SendPasswordReset: func(user *UserInfo, token string) error {
+			sent[user.Email] = token
+			return nil
+		},
+	})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "reset@example.com", Password: "password123", Name: "Reset"})
+
+	r := gin.New()
+	r.POST("/password/forgot", auth.ForgotPasswordHandler)
+	r.POST("/password/reset", auth.ResetPasswordHandler)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	known := post("/password/forgot", `{"email":"reset@example.com"}`)
+	unknown := post("/password/forgot", `{"email":"nobody@example.com"}`)
+	if known.Code != http.StatusAccepted || known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("Expected identical 202 responses, got %d %s and %d %s", known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+	if len(sent) != 1 || sent["reset@example.com"] == "" {
+		t.Fatalf("Expected a token sent to the registered email only, got %v", sent)
+	}
+
+	w := post("/password/reset", `{"token":"`+sent["reset@example.com"]+`","new_password":"newpassword123"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = post("/password/reset", `{"token":"`+sent["reset@example.com"]+`","new_password":"newpassword123"}`)
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || errorField(body, "code") != CodeInvalidNonce {
+		t.Errorf("Expected 400 %s on replay, got %d: %s", CodeInvalidNonce, w.Code, w.Body.String())
+	}
+
+	app := fiber.New()
+	app.Post("/password/forgot", auth.ForgotPasswordHandlerFiber)
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"nobody@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusAccepted {
+		t.Errorf("Expected 202 from Fiber, got %v %v", resp, err)
+	}
+}
+
+func TestForgotPasswordRequiresSender(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	if err := auth.RequestPasswordReset("anyone@example.com"); !errors.Is(err, ErrNoEmailSender) {
+		t.Errorf("Expected ErrNoEmailSender without a sender, got %v", err)
+	}
+}
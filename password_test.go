@@ -0,0 +1,250 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "change@example.com")
+
+	if err := auth.ChangePassword(tokens.User.ID, "wrong-password", "newpassword123"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if err := auth.ChangePassword(tokens.User.ID, "password123", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if err := auth.ChangePassword("missing", "password123", "newpassword123"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := auth.ChangePassword(tokens.User.ID, "password123", "newpassword123"); err != nil {
+		t.Fatalf("Expected ChangePassword to succeed, got %v", err)
+	}
+
+	if _, err := auth.LoginUser("change@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to be rejected, got %v", err)
+	}
+	if _, err := auth.LoginUser("change@example.com", "newpassword123"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the old refresh token to be revoked, got %v", err)
+	}
+
+	user, _ := auth.GetUserByID(tokens.User.ID)
+	if !user.UpdatedAt.Equal(now) {
+		t.Errorf("Expected UpdatedAt %v, got %v", now, user.UpdatedAt)
+	}
+	if cost, _ := bcrypt.Cost([]byte(user.Password)); cost != 4 {
+		t.Errorf("Expected the configured bcrypt cost, got %d", cost)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "admin-set@example.com")
+
+	if err := auth.SetPassword(tokens.User.ID, "admin-set@example.com"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Expected the policy to apply, got %v", err)
+	}
+	if err := auth.SetPassword("missing", "newpassword123"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := auth.SetPassword(tokens.User.ID, "newpassword123"); err != nil {
+		t.Fatalf("Expected SetPassword to succeed, got %v", err)
+	}
+	if _, err := auth.LoginUser("admin-set@example.com", "newpassword123"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+}
+
+func TestChangePasswordHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "handler-change@example.com")
+
+	r := gin.New()
+	r.POST("/password", auth.GinMiddleware(), auth.ChangePasswordHandler)
+	app := fiber.New()
+	app.Post("/password", auth.FiberMiddleware(), auth.ChangePasswordHandlerFiber)
+
+	post := func(accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/password", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(tokens.AccessToken, `{"current_password":"wrong-password","new_password":"newpassword123"}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a wrong current password, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = post(tokens.AccessToken, `{"current_password":"password123","new_password":"short"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), PasswordRuleMinLength) {
+		t.Errorf("Expected 400 listing the failed rule, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = post(tokens.AccessToken, `{"current_password":"password123","new_password":"newpassword123"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Tokens *TokenResponse `json:"tokens"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Tokens == nil {
+		t.Fatalf("Expected fresh tokens in the response, got %s", w.Body.String())
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the old access token to be revoked, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/password", strings.NewReader(`{"current_password":"newpassword123","new_password":"another-password1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+response.Tokens.AccessToken)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Fiber request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || !strings.Contains(string(body), "tokens") {
+		t.Errorf("Expected 200 with tokens from Fiber, got %d: %s", resp.StatusCode, body)
+	}
+	if _, err := auth.LoginUser("handler-change@example.com", "another-password1"); err != nil {
+		t.Errorf("Expected the password changed through Fiber to work, got %v", err)
+	}
+}
+
+func TestMustChangePassword(t *testing.T) {
+	for _, keepTokens := range []bool{false, true} {
+		auth := newTestKit(t, Config{KeepTokensOnPasswordChange: keepTokens})
+		defer auth.Close()
+
+		handlers := mountRoutes(t, auth, RouteOptions{})
+		mux := http.NewServeMux()
+		mux.Handle("/profile", auth.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		mux.Handle("/password", auth.PasswordChangeHTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := GetUserFromContext(r.Context())
+			var req ChangePasswordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if err := auth.ChangePassword(claims.UserID, req.CurrentPassword, req.NewPassword); err != nil {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			tokens, _ := auth.IssueTokensForUser(claims.UserID)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+		})))
+		handlers["http"] = mux
+
+		for name, handler := range handlers {
+			send := func(method, path, accessToken, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+accessToken)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w
+			}
+
+			email := name + "-temporary@example.com"
+			old := loginTestUser(t, auth, email)
+			if err := auth.SetTemporaryPassword(old.User.ID, "temporary-password"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := auth.ValidateToken(old.AccessToken); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("%s: expected tokens from before the temporary password to be revoked, got %v", name, err)
+			}
+
+			restricted, err := auth.LoginUser(email, "temporary-password")
+			if err != nil {
+				t.Fatalf("%s: expected the login to succeed, got %v", name, err)
+			}
+			if !restricted.PasswordChangeRequired || !restricted.User.MustChangePassword {
+				t.Errorf("%s: expected a restricted token response, got %+v", name, restricted)
+			}
+			if claims, err := auth.ValidateToken(restricted.AccessToken); err != nil || !claims.PasswordChangeRequired {
+				t.Errorf("%s: expected the pwd_change_required claim, got %v, %v", name, claims, err)
+			}
+
+			if w := send(http.MethodGet, "/profile", restricted.AccessToken, ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodePasswordChangeRequired) {
+				t.Errorf("%s: expected 403 %s on other routes, got %d: %s", name, CodePasswordChangeRequired, w.Code, w.Body.String())
+			}
+
+			w := send(http.MethodPost, "/password", restricted.AccessToken, `{"current_password":"temporary-password","new_password":"my-own-password"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected the restricted token to change the password, got %d: %s", name, w.Code, w.Body.String())
+			}
+			var response struct {
+				Tokens *TokenResponse `json:"tokens"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Tokens == nil || response.Tokens.PasswordChangeRequired {
+				t.Fatalf("%s: expected unrestricted tokens in the response, got %s", name, w.Body.String())
+			}
+			if w := send(http.MethodGet, "/profile", response.Tokens.AccessToken, ""); w.Code != http.StatusOK {
+				t.Errorf("%s: expected the new token to be accepted, got %d: %s", name, w.Code, w.Body.String())
+			}
+
+			tokens, err := auth.LoginUser(email, "my-own-password")
+			if err != nil || tokens.PasswordChangeRequired {
+				t.Errorf("%s: expected a normal login after the change, got %+v, %v", name, tokens, err)
+			}
+		}
+	}
+}
+
+func TestMustChangePasswordUpdates(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "flagged@example.com")
+
+	info, err := auth.UpdateUser(tokens.User.ID, map[string]interface{}{"must_change_password": true})
+	if err != nil || !info.MustChangePassword {
+		t.Fatalf("Expected the flag to be set, got %+v, %v", info, err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err == nil {
+		t.Error("Expected the unrestricted refresh token to be revoked")
+	}
+	restricted, err := auth.LoginUser("flagged@example.com", "password123")
+	if err != nil || !restricted.PasswordChangeRequired {
+		t.Fatalf("Expected a restricted login, got %+v, %v", restricted, err)
+	}
+	refreshed, err := auth.RefreshToken(restricted.RefreshToken)
+	if err != nil || !refreshed.PasswordChangeRequired {
+		t.Errorf("Expected refreshing to keep the restriction, got %+v, %v", refreshed, err)
+	}
+
+	if err := auth.SetPassword(tokens.User.ID, "newpassword123"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := auth.GetUserByID(tokens.User.ID); user.MustChangePassword {
+		t.Error("Expected SetPassword to clear the flag")
+	}
+
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "self@example.com", Password: "password123", Name: "Self", MustChangePassword: true}); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := auth.GetUserByEmail("self@example.com"); user.MustChangePassword {
+		t.Error("Expected RegisterUser to ignore MustChangePassword")
+	}
+	created, err := auth.AdminCreateUser(RegisterRequest{Email: "invited@example.com", Password: "password123", Name: "Invited", MustChangePassword: true})
+	if err != nil || !created.MustChangePassword {
+		t.Errorf("Expected AdminCreateUser to set the flag, got %+v, %v", created, err)
+	}
+}
@@ -0,0 +1,147 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ProfileUpdate is a change users may make to their own profile, see
+// UpdateOwnProfile. Nil fields are left unchanged.
+type ProfileUpdate struct {
+	Name *string `json:"name,omitempty"`
+	// Metadata sets the given keys, which must be listed in
+	// Config.SelfServiceMetadataKeys; a nil value removes the key. Other
+	// keys are kept.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// RestrictedFieldError is returned for profile updates touching a field users
+// can't change themselves, such as their role. It matches ErrRestrictedField
+// with errors.Is.
+type RestrictedFieldError struct {
+	Field string // e.g. "role" or "metadata.plan"
+}
+
+func (e *RestrictedFieldError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRestrictedField.Error(), e.Field)
+}
+
+// Unwrap returns ErrRestrictedField
+func (e *RestrictedFieldError) Unwrap() error {
+	return ErrRestrictedField
+}
+
+// readOnlyProfileFields are echoed back by clients sending a whole profile
+// and are ignored by the update profile handlers rather than rejected
+var readOnlyProfileFields = []string{"id", "email", "created_at", "updated_at"}
+
+// UpdateOwnProfile applies a change users make to their own profile. Unlike
+// UpdateUser, it can't touch the role, permissions or any other admin-only
+// field, and only sets the metadata keys listed in Config.SelfServiceMetadataKeys;
+// other keys fail with a *RestrictedFieldError.
+func (a *AuthKit) UpdateOwnProfile(userID string, update ProfileUpdate) (*UserInfo, error) {
+	return a.UpdateOwnProfileCtx(context.Background(), userID, update)
+}
+
+// UpdateOwnProfileCtx is UpdateOwnProfile with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) UpdateOwnProfileCtx(ctx context.Context, userID string, update ProfileUpdate) (_ *UserInfo, err error) {
+	a.debugCheck()
+	defer func() { err = opError("update profile", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for key := range update.Metadata {
+		if !slices.Contains(a.config.SelfServiceMetadataKeys, key) {
+			return nil, &RestrictedFieldError{Field: "metadata." + key}
+		}
+	}
+
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists {
+		a.mutex.Unlock()
+		return nil, ErrUserNotFound
+	}
+	user := cloneUser(stored)
+
+	var fields []string
+	if update.Name != nil {
+		user.Name = *update.Name
+		fields = append(fields, "name")
+	}
+	if len(update.Metadata) > 0 {
+		metadata := copyMetadata(user.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+		}
+		for key, value := range update.Metadata {
+			if value == nil {
+				delete(metadata, key)
+			} else {
+				metadata[key] = value
+			}
+		}
+		user.Metadata = metadata
+		fields = append(fields, "metadata")
+	}
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	info := a.userToUserInfo(user)
+	a.mutex.Unlock()
+
+	a.userUpdated(userID, info, fields)
+	return info, nil
+}
+
+// userUpdated audits an update of the given fields by actorID and runs the
+// OnUserUpdated hook
+func (a *AuthKit) userUpdated(actorID string, info *UserInfo, fields []string) {
+	a.audit(AuditEvent{Type: AuditUserUpdated, ActorID: actorID, UserID: info.ID,
+		Metadata: map[string]string{"fields": strings.Join(fields, ",")}})
+	if hook := a.config.Hooks.OnUserUpdated; hook != nil {
+		hookInfo := cloneUserInfo(info)
+		a.runHook("OnUserUpdated", func() error { return hook(hookInfo) })
+	}
+}
+
+// profileUpdateFromBody converts the JSON body of an update profile request,
+// rejecting fields users can't change with a *RestrictedFieldError
+func profileUpdateFromBody(body map[string]interface{}) (ProfileUpdate, error) {
+	var update ProfileUpdate
+	for field, value := range body {
+		switch {
+		case field == "name":
+			name, ok := value.(string)
+			if !ok {
+				return update, fmt.Errorf("name must be a string")
+			}
+			update.Name = &name
+		case field == "metadata":
+			metadata, ok := value.(map[string]interface{})
+			if !ok {
+				return update, fmt.Errorf("metadata must be an object")
+			}
+			update.Metadata = metadata
+		case slices.Contains(readOnlyProfileFields, field):
+		default:
+			return update, &RestrictedFieldError{Field: field}
+		}
+	}
+	return update, nil
+}
+
+// profileErrorStatus maps UpdateOwnProfile errors to HTTP statuses
+func profileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRestrictedField):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
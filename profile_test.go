@@ -0,0 +1,128 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateProfileHandlersRejectEscalation(t *testing.T) {
+	auth := newTestKit(t, Config{SelfServiceMetadataKeys: []string{"timezone"}})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "profile@example.com")
+
+	r := gin.New()
+	r.PUT("/profile", auth.GinMiddleware(), auth.UpdateProfileHandler)
+	app := fiber.New()
+	app.Put("/profile", auth.FiberMiddleware(), auth.UpdateProfileHandlerFiber)
+
+	put := map[string]func(body string) (int, string){
+		"gin": func(body string) (int, string) {
+			req := httptest.NewRequest(http.MethodPut, "/profile", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w.Code, w.Body.String()
+		},
+		"fiber": func(body string) (int, string) {
+			req := httptest.NewRequest(http.MethodPut, "/profile", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, string(data)
+		},
+	}
+
+	for name, put := range put {
+		t.Run(name, func(t *testing.T) {
+			before, _ := auth.GetUserByID(tokens.User.ID)
+			for body, field := range map[string]string{
+				`{"role":"admin"}`:                         "role",
+				`{"name":"Mallory","permissions":["*"]}`:   "permissions",
+				`{"email_verified":true}`:                  "email_verified",
+				`{"metadata":{"plan":"enterprise"}}`:       "metadata.plan",
+				`{"password":"new-password123","name":""}`: "password",
+			} {
+				code, response := put(body)
+				var decoded map[string]interface{}
+				_ = json.Unmarshal([]byte(response), &decoded)
+				if code != http.StatusForbidden || errorField(decoded, "code") != CodeRestrictedField || errorDetail(decoded, "field") != field {
+					t.Errorf("%s: expected 403 naming %q, got %d: %s", body, field, code, response)
+				}
+			}
+
+			user, _ := auth.GetUserByID(tokens.User.ID)
+			if user.Role != defaultRole || len(user.Permissions) != 0 || user.Name != before.Name {
+				t.Fatalf("Expected rejected updates to change nothing, got role %q, permissions %v, name %q", user.Role, user.Permissions, user.Name)
+			}
+
+			code, response := put(`{"id":"ignored","email":"ignored@example.com","name":"Renamed ` + name + `","metadata":{"timezone":"Europe/Paris"}}`)
+			if code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", code, response)
+			}
+			user, _ = auth.GetUserByID(tokens.User.ID)
+			if user.Name != "Renamed "+name || user.Metadata["timezone"] != "Europe/Paris" || user.Email != "profile@example.com" {
+				t.Errorf("Expected the name and allowed metadata to change, got %+v", user)
+			}
+
+			if code, response := put(`{"name":42}`); code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for a malformed name, got %d: %s", code, response)
+			}
+		})
+	}
+}
+
+func TestUpdateOwnProfile(t *testing.T) {
+	sink := NewMemoryAuditLog(0)
+	auth := newTestKit(t, Config{AuditLogger: sink,
+		SelfServiceMetadataKeys: []string{"timezone", "theme"}})
+	defer auth.Close()
+
+	user, err := auth.AdminCreateUser(RegisterRequest{Email: "own@example.com", Password: "password123", Name: "Own",
+		Metadata: map[string]interface{}{"plan": "pro", "theme": "dark"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := auth.UpdateOwnProfile(user.ID, ProfileUpdate{Metadata: map[string]interface{}{"timezone": "UTC", "theme": nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Metadata["plan"] != "pro" || info.Metadata["timezone"] != "UTC" {
+		t.Errorf("Expected the admin metadata to be kept and the timezone set, got %v", info.Metadata)
+	}
+	if _, ok := info.Metadata["theme"]; ok {
+		t.Errorf("Expected a nil value to remove the key, got %v", info.Metadata)
+	}
+	events := sink.Query(AuditQuery{Type: AuditUserUpdated})
+	if len(events) != 1 || events[0].ActorID != user.ID || events[0].Metadata["fields"] != "metadata" {
+		t.Errorf("Expected the update audited with the user as actor, got %+v", events)
+	}
+
+	var fieldErr *RestrictedFieldError
+	_, err = auth.UpdateOwnProfile(user.ID, ProfileUpdate{Metadata: map[string]interface{}{"plan": "free"}})
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "metadata.plan" || !errors.Is(err, ErrRestrictedField) {
+		t.Errorf("Expected a RestrictedFieldError for metadata.plan, got %v", err)
+	}
+	if _, err := auth.UpdateOwnProfile("missing", ProfileUpdate{}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	// Admins keep full access
+	if info, err := auth.UpdateUser(user.ID, map[string]interface{}{"role": "admin", "permissions": []string{"*"}}); err != nil || info.Role != "admin" {
+		t.Errorf("Expected UpdateUser to set the role, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,148 @@
+package authkit
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket holds the tokens left for one key
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a token-bucket limiter allowing RateLimitRPM requests per
+// minute per key, with bursts of up to RateLimitRPM
+type rateLimiter struct {
+	rpm       int
+	now       func() time.Time
+	interval  time.Duration // How often idle buckets are pruned
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune atomic.Int64
+}
+
+// newRateLimiter creates a limiter; a non-positive rpm allows everything
+func newRateLimiter(rpm int, interval time.Duration, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		rpm:      rpm,
+		now:      now,
+		interval: interval,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token for key, returning how long until one is available if none is
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l.rpm <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.prune(now)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(l.rpm), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = l.refill(bucket, now)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / l.perSecond() * float64(time.Second))
+	return false, wait
+}
+
+// perSecond is the refill rate
+func (l *rateLimiter) perSecond() float64 {
+	return float64(l.rpm) / 60
+}
+
+// refill returns the bucket's tokens at now, capped at rpm
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.rpm), bucket.tokens+elapsed*l.perSecond())
+}
+
+// prune drops full buckets at most once per interval; they behave exactly like
+// missing ones, so memory only grows with recently active keys
+func (l *rateLimiter) prune(now time.Time) {
+	last := l.lastPrune.Load()
+	if now.UnixNano()-last < int64(l.interval) {
+		return
+	}
+	if !l.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, bucket := range l.buckets {
+		if l.refill(bucket, now) >= float64(l.rpm) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// size returns the number of tracked buckets
+func (l *rateLimiter) size() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.buckets)
+}
+
+// AllowRequest reports whether a request for key (a client IP, an email, ...)
+// is within Config.RateLimitRPM, taking a token from its bucket if so
+func (a *AuthKit) AllowRequest(key string) bool {
+	allowed, _ := a.limiter.allow(key)
+	return allowed
+}
+
+// allowClient checks the rate limit for the client IP and, when
+// Config.RateLimitByEmail is set and an email is given, for the email too.
+// It returns how long the client should wait when the limit is exceeded.
+func (a *AuthKit) allowClient(ip, email string) (bool, time.Duration) {
+	if allowed, wait := a.limiter.allow("ip:" + ip); !allowed {
+		return false, wait
+	}
+	if a.config.RateLimitByEmail && email != "" {
+		return a.limiter.allow("email:" + a.emailKey(email))
+	}
+	return true, 0
+}
+
+// limitedIP returns the client IP of r that rate limits are keyed on: the peer
+// address, or with Config.BruteForce the client named by X-Forwarded-For
+// behind its TrustedProxies. Client-sent forwarding headers never count, so
+// rotating them can't dodge the limit.
+func (a *AuthKit) limitedIP(r *http.Request) string {
+	if a.bruteForce != nil {
+		return a.bruteForce.clientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+	}
+	return httpClientIP(r)
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds for the Retry-After header
+func retryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
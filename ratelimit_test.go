@@ -0,0 +1,170 @@
+package authkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAllowRequest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{RateLimitRPM: 3, Clock: testClock(&now)})
+	defer auth.Close()
+
+	for i := 0; i < 3; i++ {
+		if !auth.AllowRequest("client") {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	if auth.AllowRequest("client") {
+		t.Fatal("Expected the fourth request to be limited")
+	}
+	if !auth.AllowRequest("other") {
+		t.Error("Expected other keys to have their own bucket")
+	}
+
+	// 3 per minute refills one token every 20s
+	now = now.Add(20 * time.Second)
+	if !auth.AllowRequest("client") {
+		t.Error("Expected a refilled token to be allowed")
+	}
+	if auth.AllowRequest("client") {
+		t.Error("Expected only one token to have been refilled")
+	}
+}
+
+func TestRateLimiterPrunesIdleBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(60, time.Minute, func() time.Time { return now })
+
+	for _, key := range []string{"a", "b", "c"} {
+		limiter.allow(key)
+	}
+	if limiter.size() != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", limiter.size())
+	}
+
+	now = now.Add(2 * time.Minute)
+	limiter.allow("d")
+	if limiter.size() != 1 {
+		t.Errorf("Expected idle buckets to be pruned, got %d", limiter.size())
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	limiter := newRateLimiter(50, time.Minute, func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) })
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := limiter.allow("client"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 50 {
+		t.Errorf("Expected exactly 50 allowed requests, got %d", allowed.Load())
+	}
+}
+
+func TestRateLimitedHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: 2})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "limited@example.com", Password: "password123", Name: "Limited"})
+	credentials := `{"email":"limited@example.com","password":"password123"}`
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected 429 with Retry-After 30, got %d (%q): %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), CodeRateLimited) {
+		t.Errorf("Expected %s code, got %s", CodeRateLimited, w.Body.String())
+	}
+
+	app := fiber.New()
+	app.Post("/login", auth.LoginHandlerFiber)
+
+	var resp *http.Response
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials))
+		req.Header.Set("Content-Type", "application/json")
+		var err error
+		if resp, err = app.Test(req); err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After from Fiber, got %d (%q)", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	login := func(auth *AuthKit, forwardedFor string) int {
+		r := gin.New()
+		r.POST("/login", auth.LoginHandler)
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"nobody@example.com","password":"password123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	auth := newTestKit(t, Config{RateLimitRPM: 2})
+	defer auth.Close()
+	var status int
+	for i := 0; i < 3; i++ {
+		status = login(auth, "203.0.113."+strconv.Itoa(i))
+	}
+	if status != http.StatusTooManyRequests {
+		t.Errorf("Expected rotating X-Forwarded-For to be ignored, got %d", status)
+	}
+
+	// Behind the trusted proxies of brute-force protection, the header names the client
+	proxied := newTestKit(t, Config{RateLimitRPM: 2,
+		BruteForce: &BruteForceConfig{TrustedProxies: []string{"192.0.2.0/24"}}})
+	defer proxied.Close()
+	for i := 0; i < 3; i++ {
+		status = login(proxied, "203.0.113."+strconv.Itoa(i))
+	}
+	if status != http.StatusUnauthorized {
+		t.Errorf("Expected clients behind a trusted proxy to be limited separately, got %d", status)
+	}
+}
+
+func TestRateLimitByEmail(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: 1, RateLimitByEmail: true})
+	defer auth.Close()
+
+	if allowed, _ := auth.allowClient("192.0.2.1", "Target@example.com"); !allowed {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if allowed, _ := auth.allowClient("192.0.2.2", "target@example.com"); allowed {
+		t.Error("Expected the email's limit to apply across IPs")
+	}
+	if allowed, _ := auth.allowClient("192.0.2.3", ""); !allowed {
+		t.Error("Expected requests without an email to be limited by IP only")
+	}
+}
@@ -0,0 +1,168 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Recovery code format: three dash-separated groups of four characters from
+// an alphabet without look-alikes (0/o, 1/l/i), about 59 bits of entropy
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeGroups   = 3
+	recoveryCodeGroupLen = 4
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+)
+
+// recoveryCodeCost is the bcrypt cost of recovery code hashes. The codes are
+// random rather than chosen by users, so the minimum cost is plenty and keeps
+// checking a code against the whole set fast.
+const recoveryCodeCost = bcrypt.MinCost
+
+// GenerateRecoveryCodes creates a new set of single-use recovery codes for a
+// user with MFA enabled, replacing any previous set. Only bcrypt hashes are
+// stored, so the codes must be shown to the user now.
+func (a *AuthKit) GenerateRecoveryCodes(userID string) ([]string, error) {
+	a.debugCheck()
+
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code)), recoveryCodeCost)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = string(hash)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if !stored.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	updated := cloneUser(stored)
+	updated.RecoveryCodes = hashes
+	updated.UpdatedAt = a.now()
+	a.users.put(updated)
+	return codes, nil
+}
+
+// RemainingRecoveryCodes returns how many of the user's recovery codes are unused
+func (a *AuthKit) RemainingRecoveryCodes(userID string) (int, error) {
+	a.debugCheck()
+
+	user, exists := a.users.get(userID)
+	if !exists {
+		return 0, ErrUserNotFound
+	}
+	return len(user.RecoveryCodes), nil
+}
+
+// useRecoveryCode consumes a matching recovery code
+func (a *AuthKit) useRecoveryCode(userID, code string) error {
+	user, err := a.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+
+	// Compare outside the lock, then remove the hash only if it's still there,
+	// so a code used concurrently is accepted once
+	normalized := []byte(normalizeRecoveryCode(code))
+	var matched string
+	for _, hash := range user.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), normalized) == nil {
+			matched = hash
+			break
+		}
+	}
+	if matched == "" {
+		return ErrInvalidMFACode
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	for i, hash := range stored.RecoveryCodes {
+		if hash == matched {
+			updated := cloneUser(stored)
+			updated.RecoveryCodes = append(updated.RecoveryCodes[:i:i], updated.RecoveryCodes[i+1:]...)
+			updated.UpdatedAt = a.now()
+			a.users.put(updated)
+			return nil
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+// newRecoveryCode returns a random code formatted as xxxx-xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	var code strings.Builder
+	for i := 0; i < recoveryCodeGroups*recoveryCodeGroupLen; i++ {
+		if i > 0 && i%recoveryCodeGroupLen == 0 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// normalizeRecoveryCode drops separators and case so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, code)
+}
+
+// isRecoveryCode reports whether code has the shape of a recovery code rather than a TOTP code
+func isRecoveryCode(code string) bool {
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeGroups*recoveryCodeGroupLen {
+		return false
+	}
+	for _, r := range normalized {
+		if !strings.ContainsRune(recoveryCodeAlphabet, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package authkit
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var recoveryCodePattern = regexp.MustCompile(`^[2-9a-hjkmnp-z]{4}-[2-9a-hjkmnp-z]{4}-[2-9a-hjkmnp-z]{4}$`)
+
+func newRecoveryTestKit(t *testing.T) (*AuthKit, *UserInfo) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{MaxLoginAttempts: -1, Clock: testClock(&now)})
+	user, _ := auth.RegisterUser(RegisterRequest{Email: "recovery@example.com", Password: "password123", Name: "Recovery"})
+	return auth, user
+}
+
+func mfaPending(t *testing.T, auth *AuthKit) string {
+	t.Helper()
+	pending, err := auth.LoginUser("recovery@example.com", "password123")
+	if err != nil || !pending.MFARequired {
+		t.Fatalf("Expected an MFA challenge, got %+v %v", pending, err)
+	}
+	return pending.MFAToken
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	auth, user := newRecoveryTestKit(t)
+	defer auth.Close()
+
+	if _, err := auth.GenerateRecoveryCodes(user.ID); !errors.Is(err, ErrMFANotEnabled) {
+		t.Errorf("Expected ErrMFANotEnabled without MFA, got %v", err)
+	}
+	enrollTestTOTP(t, auth, user.ID)
+
+	codes, err := auth.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatalf("Expected recovery codes, got %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes, got %d", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !recoveryCodePattern.MatchString(code) {
+			t.Errorf("Unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	stored, _ := auth.GetUserByID(user.ID)
+	for _, hash := range stored.RecoveryCodes {
+		if !strings.HasPrefix(hash, "$2") || seen[hash] {
+			t.Errorf("Expected only bcrypt hashes to be stored, got %q", hash)
+		}
+	}
+	if remaining, _ := auth.RemainingRecoveryCodes(user.ID); remaining != 10 {
+		t.Errorf("Expected 10 remaining codes, got %d", remaining)
+	}
+	if _, err := auth.RemainingRecoveryCodes("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestRecoveryCodeLogin(t *testing.T) {
+	auth, user := newRecoveryTestKit(t)
+	defer auth.Close()
+	enrollTestTOTP(t, auth, user.ID)
+	codes, _ := auth.GenerateRecoveryCodes(user.ID)
+
+	// Codes can be typed without dashes and in upper case
+	tokens, err := auth.CompleteMFALogin(mfaPending(t, auth), strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")))
+	if err != nil {
+		t.Fatalf("Expected a recovery code to complete the login, got %v", err)
+	}
+	claims, _ := auth.ValidateToken(tokens.AccessToken)
+	if claims == nil || strings.Join(claims.AMR, ",") != "pwd,mfa" {
+		t.Errorf("Expected amr [pwd mfa], got %+v", claims)
+	}
+	if remaining, _ := auth.RemainingRecoveryCodes(user.ID); remaining != 9 {
+		t.Errorf("Expected 9 remaining codes, got %d", remaining)
+	}
+
+	if _, err := auth.CompleteMFALogin(mfaPending(t, auth), codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected a used code to be rejected, got %v", err)
+	}
+
+	for _, code := range codes[1:] {
+		if _, err := auth.CompleteMFALogin(mfaPending(t, auth), code); err != nil {
+			t.Fatalf("Expected code %s to work, got %v", code, err)
+		}
+	}
+	if remaining, _ := auth.RemainingRecoveryCodes(user.ID); remaining != 0 {
+		t.Errorf("Expected the codes to be exhausted, got %d remaining", remaining)
+	}
+	if _, err := auth.CompleteMFALogin(mfaPending(t, auth), codes[5]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected ErrInvalidMFACode once exhausted, got %v", err)
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	auth, user := newRecoveryTestKit(t)
+	defer auth.Close()
+	enrollTestTOTP(t, auth, user.ID)
+
+	old, _ := auth.GenerateRecoveryCodes(user.ID)
+	fresh, _ := auth.GenerateRecoveryCodes(user.ID)
+
+	if _, err := auth.CompleteMFALogin(mfaPending(t, auth), old[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Expected the old set to be invalidated, got %v", err)
+	}
+	if _, err := auth.CompleteMFALogin(mfaPending(t, auth), fresh[0]); err != nil {
+		t.Errorf("Expected the new set to work, got %v", err)
+	}
+
+	if err := auth.DisableTOTP(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if remaining, _ := auth.RemainingRecoveryCodes(user.ID); remaining != 0 {
+		t.Errorf("Expected DisableTOTP to drop the codes, got %d remaining", remaining)
+	}
+}
+
+func TestRecoveryCodeHandlers(t *testing.T) {
+	auth, user := newRecoveryTestKit(t)
+	defer auth.Close()
+	tokens, _ := auth.LoginUser("recovery@example.com", "password123")
+	secret, _, _ := auth.EnrollTOTP(user.ID)
+
+	r := gin.New()
+	protected := r.Group("/", auth.GinMiddleware())
+	protected.POST("/mfa/totp/confirm", auth.ConfirmTOTPHandler)
+	protected.POST("/mfa/recovery-codes", auth.RecoveryCodesHandler)
+	post := func(path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var decoded map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &decoded)
+		return w.Code, decoded
+	}
+
+	if code, body := post("/mfa/recovery-codes", ""); code != http.StatusConflict || errorField(body, "code") != CodeMFANotEnabled {
+		t.Errorf("Expected 409 %s before MFA is enabled, got %d %v", CodeMFANotEnabled, code, body)
+	}
+
+	raw, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	code, body := post("/mfa/totp/confirm", `{"code":"`+totpCode(raw, auth.now().Unix()/totpPeriod)+`"}`)
+	if codes, _ := body["recovery_codes"].([]interface{}); code != http.StatusOK || len(codes) != 10 {
+		t.Fatalf("Expected recovery codes on confirmation, got %d %v", code, body)
+	}
+
+	code, body = post("/mfa/recovery-codes", "")
+	if codes, _ := body["recovery_codes"].([]interface{}); code != http.StatusOK || len(codes) != 10 {
+		t.Errorf("Expected a new set of recovery codes, got %d %v", code, body)
+	}
+}
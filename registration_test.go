@@ -0,0 +1,158 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+const escalationBody = `{"email":"mallory@example.com","password":"password123","name":"Mallory","role":"admin","metadata":{"tenant_id":"acme","plan":"free"}}`
+
+// registerRoutes serves the register handlers of every framework and an
+// admin-only route behind each middleware
+func registerRoutes(auth *AuthKit) map[string]http.Handler {
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	r.GET("/admin", auth.GinMiddleware(), auth.RequireRole("admin"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	app := fiber.New()
+	app.Post("/register", auth.RegisterHandlerFiber)
+	app.Get("/admin", auth.FiberMiddleware(), auth.RequireRoleFiber("admin"), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", auth.RegisterHandlerHTTP)
+	mux.Handle("/admin", auth.HTTPMiddleware(auth.RequireRoleHTTP("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  mux,
+	}
+}
+
+// serveFiber runs req through app, copying the response to w
+func serveFiber(app *fiber.App, w http.ResponseWriter, req *http.Request) {
+	resp, err := app.Test(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func TestRegisterHandlersRejectPrivilegedRoles(t *testing.T) {
+	for name, handler := range registerRoutes(newTestKit(t, Config{})) {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(escalationBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), CodeRoleNotAllowed) {
+				t.Errorf("Expected 403 %s, got %d: %s", CodeRoleNotAllowed, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegisterHandlersDowngradePrivilegedRoles(t *testing.T) {
+	auth := newTestKit(t, Config{
+		DowngradeSelfRegisterRoles: true, TokenMetadataFields: []string{"tenant_id"}})
+	defer auth.Close()
+
+	for name, handler := range registerRoutes(auth) {
+		t.Run(name, func(t *testing.T) {
+			email := name + "-mallory@example.com"
+			body := strings.Replace(escalationBody, "mallory@example.com", email, 1)
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+
+			user, err := auth.GetUserByEmail(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != defaultRole {
+				t.Errorf("Expected the role to be downgraded to %q, got %q", defaultRole, user.Role)
+			}
+			if _, ok := user.Metadata["tenant_id"]; ok || user.Metadata["plan"] != "free" {
+				t.Errorf("Expected only the token metadata to be dropped, got %v", user.Metadata)
+			}
+
+			tokens, err := auth.LoginUser(email, "password123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected the admin route to stay forbidden, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestAllowedSelfRegisterRoles(t *testing.T) {
+	auth := newTestKit(t, Config{AllowedSelfRegisterRoles: []string{"user", "seller"}})
+	defer auth.Close()
+
+	seller, err := auth.RegisterUser(RegisterRequest{Email: "seller@example.com", Password: "password123", Name: "Seller", Role: "seller"})
+	if err != nil || seller.Role != "seller" {
+		t.Fatalf("Expected an allowed role to be kept, got %v, %v", seller, err)
+	}
+	plain, err := auth.RegisterUser(RegisterRequest{Email: "plain@example.com", Password: "password123", Name: "Plain"})
+	if err != nil || plain.Role != defaultRole {
+		t.Fatalf("Expected the default role, got %v, %v", plain, err)
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "admin@example.com", Password: "password123", Name: "Admin", Role: "admin"}); !errors.Is(err, ErrRoleNotAllowed) {
+		t.Errorf("Expected ErrRoleNotAllowed, got %v", err)
+	}
+	if _, err := auth.GetUserByEmail("admin@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the rejected user not to be stored, got %v", err)
+	}
+}
+
+func TestAdminCreateUser(t *testing.T) {
+	auth := newTestKit(t, Config{TokenMetadataFields: []string{"tenant_id"}})
+	defer auth.Close()
+
+	admin, err := auth.AdminCreateUser(RegisterRequest{Email: "admin@example.com", Password: "password123", Name: "Admin", Role: "admin",
+		Metadata: map[string]interface{}{"tenant_id": "acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Role != "admin" {
+		t.Errorf("Expected the requested role, got %q", admin.Role)
+	}
+
+	tokens, err := auth.LoginUser("admin@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Role != "admin" || claims.Metadata["tenant_id"] != "acme" {
+		raw, _ := json.Marshal(claims)
+		t.Errorf("Expected the admin role and tenant in the token, got %s", raw)
+	}
+}
@@ -0,0 +1,208 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RevocationStore records revoked token IDs (JTIs) until the tokens would have expired anyway
+type RevocationStore interface {
+	// Revoke marks jti as revoked until expiresAt
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked reports whether jti is revoked at now
+	IsRevoked(jti string, now time.Time) bool
+	// Prune removes entries whose expiry has passed and returns how many were removed
+	Prune(now time.Time) int
+}
+
+// MemoryRevocationStore is an in-memory RevocationStore
+type MemoryRevocationStore struct {
+	revoked map[string]time.Time
+	mutex   sync.RWMutex
+}
+
+// NewMemoryRevocationStore creates an empty in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+// Revoke marks jti as revoked until expiresAt
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether jti is revoked at now
+func (s *MemoryRevocationStore) IsRevoked(jti string, now time.Time) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	expiresAt, exists := s.revoked[jti]
+	return exists && now.Before(expiresAt)
+}
+
+// Prune removes entries whose expiry has passed
+func (s *MemoryRevocationStore) Prune(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pruned := 0
+	for jti, expiresAt := range s.revoked {
+		if !now.Before(expiresAt) {
+			delete(s.revoked, jti)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// RevokeToken invalidates an access or refresh token before its expiry.
+// Revoking a refresh token also ends its session (see RevokeSession).
+// Revoking an already expired token is a no-op.
+func (a *AuthKit) RevokeToken(tokenString string) error {
+	if a.malformedToken(tokenString) {
+		return ErrInvalidToken
+	}
+	claims := &refreshClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, a.keyFunc, jwt.WithTimeFunc(a.now))
+	if err != nil {
+		if tokenError(err) == ErrTokenExpired {
+			return nil
+		}
+		return ErrInvalidToken
+	}
+
+	if claims.ID == "" {
+		return ErrInvalidToken
+	}
+
+	// Tokens without an expiry stay revoked for the longest lifetime AuthKit issues
+	expiresAt := a.now().Add(a.maxTokenLifetime())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	if err := a.revokeJTI(claims.ID, expiresAt); err != nil {
+		return err
+	}
+	a.config.Logger.Info("token revoked", "jti", claims.ID)
+	a.audit(AuditEvent{Type: AuditTokenRevoked, Metadata: map[string]string{"jti": claims.ID}})
+	if claims.SessionID != "" && claims.Issuer == a.refreshIssuer() {
+		if err := a.revokeSession(claims.SessionID, ""); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether the token with the given JTI has been revoked
+func (a *AuthKit) IsTokenRevoked(jti string) bool {
+	return a.config.RevocationStore.IsRevoked(jti, a.now())
+}
+
+// isRevoked is IsTokenRevoked in a span
+func (a *AuthKit) isRevoked(ctx context.Context, jti string) bool {
+	var revoked bool
+	_ = a.traceStore(ctx, "RevocationStore.IsRevoked", func() error {
+		revoked = a.IsTokenRevoked(jti)
+		return nil
+	})
+	return revoked
+}
+
+// revokeJTI records a revocation and makes sure the pruning janitor is running
+func (a *AuthKit) revokeJTI(jti string, expiresAt time.Time) error {
+	if err := a.config.RevocationStore.Revoke(jti, expiresAt); err != nil {
+		return err
+	}
+	a.tokenCache.evict(jti)
+
+	a.revocationJanitor.Do(func() {
+		a.startJanitor(func() {
+			a.config.RevocationStore.Prune(a.now())
+		})
+	})
+	return nil
+}
+
+// maxTokenLifetime returns the longest lifetime a token may be issued with
+func (a *AuthKit) maxTokenLifetime() time.Duration {
+	return max(a.maxAccess, a.maxRefresh)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+// value. The scheme is case-insensitive (RFC 7235) and whitespace around the
+// token is ignored.
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RevokeAllUserTokens invalidates every access and refresh token issued to the
+// user so far by bumping their token version
+func (a *AuthKit) RevokeAllUserTokens(userID string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+
+	user := cloneUser(stored)
+	user.TokenVersion++
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	a.deleteUserSessions(userID)
+	a.mutex.Unlock()
+
+	a.config.Logger.Info("user tokens revoked", "user_id", userID)
+	a.audit(AuditEvent{Type: AuditUserTokensRevoked, UserID: userID})
+	return nil
+}
+
+// tokenVersion returns the stored token version for userID, if the user exists
+func (a *AuthKit) tokenVersion(userID string) (int, bool) {
+	user, exists := a.users.get(userID)
+	if !exists {
+		return 0, false
+	}
+	return user.TokenVersion, true
+}
+
+// setPassword stores a new password hash, revoking the user's tokens unless
+// Config.KeepTokensOnPasswordChange is set. The caller must hold the write lock.
+func (a *AuthKit) setPassword(user *User, hashedPassword string) {
+	if user.Password == hashedPassword {
+		return
+	}
+	user.Password = hashedPassword
+	if !a.config.KeepTokensOnPasswordChange {
+		user.TokenVersion++
+		a.deleteUserSessions(user.ID)
+	}
+}
+
+// requirePasswordChange sets User.MustChangePassword, revoking the tokens
+// issued without the restriction. The caller must hold the write lock.
+func (a *AuthKit) requirePasswordChange(user *User) {
+	if user.MustChangePassword {
+		return
+	}
+	user.MustChangePassword = true
+	user.TokenVersion++
+	a.deleteUserSessions(user.ID)
+}
@@ -0,0 +1,193 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func loginTestUser(t *testing.T, auth *AuthKit, email string) *TokenResponse {
+	t.Helper()
+	if _, err := auth.RegisterUser(RegisterRequest{Email: email, Password: "password123", Name: "Test"}); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	tokens, err := auth.LoginUser(email, "password123")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	return tokens
+}
+
+func TestRevokeToken(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "revoke@example.com")
+
+	if err := auth.RevokeToken(tokens.AccessToken); err != nil {
+		t.Fatalf("Expected access token revocation, got %v", err)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+
+	if err := auth.RevokeToken(tokens.RefreshToken); err != nil {
+		t.Fatalf("Expected refresh token revocation, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked refreshing a revoked token, got %v", err)
+	}
+
+	claims, _ := auth.ValidateToken(mustLogin(t, auth, "revoke@example.com").AccessToken)
+	if auth.IsTokenRevoked(claims.ID) {
+		t.Error("Expected a fresh token not to be revoked")
+	}
+
+	if err := auth.RevokeToken("garbage"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken revoking garbage, got %v", err)
+	}
+
+	expired, _ := auth.GenerateCustomToken("someone", nil, -time.Minute)
+	if err := auth.RevokeToken(expired); err != nil {
+		t.Errorf("Expected revoking an expired token to be a no-op, got %v", err)
+	}
+}
+
+func mustLogin(t *testing.T, auth *AuthKit, email string) *TokenResponse {
+	t.Helper()
+	tokens, err := auth.LoginUser(email, "password123")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	return tokens
+}
+
+func TestMemoryRevocationStorePrune(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	now := time.Now()
+	_ = store.Revoke("old", now.Add(time.Minute))
+	_ = store.Revoke("new", now.Add(time.Hour))
+
+	if !store.IsRevoked("old", now) {
+		t.Error("Expected old to be revoked before its expiry")
+	}
+	if pruned := store.Prune(now.Add(2 * time.Minute)); pruned != 1 {
+		t.Errorf("Expected one entry pruned, got %d", pruned)
+	}
+	if store.IsRevoked("old", now) {
+		t.Error("Expected old to be gone after pruning")
+	}
+	if !store.IsRevoked("new", now) {
+		t.Error("Expected new to remain revoked")
+	}
+}
+
+func TestLogoutHandlerRevokesTokens(t *testing.T) {
+	t.Run("Gin", func(t *testing.T) {
+		auth := newTestKit(t, Config{})
+		defer auth.Close()
+		tokens := loginTestUser(t, auth, "logout-gin@example.com")
+
+		r := gin.New()
+		r.POST("/logout", auth.GinMiddleware(), auth.LogoutHandler)
+
+		body := `{"refresh_token":"` + tokens.RefreshToken + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w = ginRequest(auth, "Bearer "+tokens.AccessToken)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeTokenRevoked) {
+			t.Errorf("Expected revoked token to be rejected, got %d: %s", w.Code, w.Body.String())
+		}
+		if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Expected refresh token to be revoked, got %v", err)
+		}
+	})
+
+	t.Run("Fiber", func(t *testing.T) {
+		auth := newTestKit(t, Config{})
+		defer auth.Close()
+		tokens := loginTestUser(t, auth, "logout-fiber@example.com")
+
+		app := fiber.New()
+		app.Post("/logout", auth.FiberMiddleware(), auth.LogoutHandlerFiber)
+
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v %v", resp.StatusCode, err)
+		}
+
+		resp = fiberRequest(t, auth, "Bearer "+tokens.AccessToken)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected revoked token to be rejected, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestRevokeAllUserTokens(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	first := loginTestUser(t, auth, "everywhere@example.com")
+	second, _ := auth.LoginUser("everywhere@example.com", "password123")
+
+	if err := auth.RevokeAllUserTokens(first.User.ID); err != nil {
+		t.Fatalf("Expected revocation, got %v", err)
+	}
+
+	for _, tokens := range []*TokenResponse{first, second} {
+		if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken for old access token, got %v", err)
+		}
+		if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken for old refresh token, got %v", err)
+		}
+	}
+
+	// Tokens issued after the bump carry the new version
+	fresh, err := auth.LoginUser("everywhere@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected login after revocation, got %v", err)
+	}
+	if claims, err := auth.ValidateToken(fresh.AccessToken); err != nil || claims.TokenVersion != 1 {
+		t.Errorf("Expected fresh token with version 1, got %+v, %v", claims, err)
+	}
+	if _, err := auth.RefreshToken(fresh.RefreshToken); err != nil {
+		t.Errorf("Expected fresh refresh token to work, got %v", err)
+	}
+
+	if err := auth.RevokeAllUserTokens("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestPasswordChangeBumpsTokenVersion(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		auth := newTestKit(t, Config{KeepTokensOnPasswordChange: keep})
+		tokens := loginTestUser(t, auth, "change@example.com")
+
+		if err := auth.SetPassword(tokens.User.ID, "newpassword123"); err != nil {
+			t.Fatalf("Expected SetPassword to succeed, got %v", err)
+		}
+
+		_, err := auth.ValidateToken(tokens.AccessToken)
+		if keep && err != nil {
+			t.Errorf("Expected tokens kept with KeepTokensOnPasswordChange, got %v", err)
+		}
+		if !keep && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken after password change, got %v", err)
+		}
+	}
+}
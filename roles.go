@@ -0,0 +1,222 @@
+package authkit
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultRole is the role of users registered without one
+const defaultRole = "user"
+
+// RoleDefinition is a role and the permissions it grants, see DefineRole
+type RoleDefinition struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// DefineRole creates or replaces a role definition. Access tokens of users
+// with the role, or a role inheriting it through Config.RoleHierarchy, carry
+// its permissions in addition to the users' own. Existing tokens keep the
+// permissions they were issued with.
+func (a *AuthKit) DefineRole(name string, permissions []string) error {
+	a.debugCheck()
+
+	if name == "" {
+		return fmt.Errorf("%w: role name is required", ErrInvalidRole)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.roles[name] = uniqueSorted(permissions)
+	return nil
+}
+
+// GetRole returns a role definition
+func (a *AuthKit) GetRole(name string) (*RoleDefinition, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	permissions, exists := a.roles[name]
+	if !exists {
+		return nil, ErrRoleNotFound
+	}
+	return &RoleDefinition{Name: name, Permissions: append([]string{}, permissions...)}, nil
+}
+
+// ListRoles returns all role definitions sorted by name
+func (a *AuthKit) ListRoles() []RoleDefinition {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	roles := make([]RoleDefinition, 0, len(a.roles))
+	for name, permissions := range a.roles {
+		roles = append(roles, RoleDefinition{Name: name, Permissions: append([]string{}, permissions...)})
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+	return roles
+}
+
+// AssignRole gives a user a defined role, replacing their current one
+func (a *AuthKit) AssignRole(userID, role string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	if _, exists := a.roles[role]; !exists {
+		a.mutex.Unlock()
+		return ErrRoleNotFound
+	}
+	stored, exists := a.users.get(userID)
+	if !exists {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+
+	user := cloneUser(stored)
+	previousRole := user.Role
+	user.Role = role
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	a.mutex.Unlock()
+
+	a.auditRoleChange("", userID, previousRole, role)
+	return nil
+}
+
+// RemoveRole takes a role from a user, who falls back to the default "user"
+// role. Removing a role the user doesn't have does nothing.
+func (a *AuthKit) RemoveRole(userID, role string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	stored, exists := a.users.get(userID)
+	if !exists {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+	if stored.Role != role {
+		a.mutex.Unlock()
+		return nil
+	}
+
+	user := cloneUser(stored)
+	user.Role = defaultRole
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	a.mutex.Unlock()
+
+	a.auditRoleChange("", userID, role, defaultRole)
+	return nil
+}
+
+// RoleSatisfies reports whether a user with userRole passes a check for
+// requiredRole: the roles are equal, or userRole inherits requiredRole
+// directly or transitively through Config.RoleHierarchy
+func (a *AuthKit) RoleSatisfies(userRole, requiredRole string) bool {
+	for _, role := range a.roleClosure(userRole) {
+		if role == requiredRole {
+			return true
+		}
+	}
+	return false
+}
+
+// roleClosure returns role followed by every role it inherits through
+// Config.RoleHierarchy
+func (a *AuthKit) roleClosure(role string) []string {
+	// The hierarchy is acyclic (see Config.Validate), but a role can be
+	// reachable along several paths
+	closure := []string{role}
+	seen := map[string]bool{role: true}
+	for i := 0; i < len(closure); i++ {
+		for _, inherited := range a.config.RoleHierarchy[closure[i]] {
+			if !seen[inherited] {
+				seen[inherited] = true
+				closure = append(closure, inherited)
+			}
+		}
+	}
+	return closure
+}
+
+// effectivePermissions returns the permissions for a token of a user with
+// role: their own grants plus those of the role definitions the role
+// satisfies. Without matching definitions the grants are returned unchanged.
+func (a *AuthKit) effectivePermissions(role string, granted []string) []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	var fromRoles []string
+	for _, r := range a.roleClosure(role) {
+		fromRoles = append(fromRoles, a.roles[r]...)
+	}
+	if len(fromRoles) == 0 {
+		return granted
+	}
+	return uniqueSorted(append(append([]string{}, granted...), fromRoles...))
+}
+
+// roleSatisfiesAny reports whether userRole satisfies one of the required roles
+func (a *AuthKit) roleSatisfiesAny(userRole string, requiredRoles []string) bool {
+	for _, role := range requiredRoles {
+		if a.RoleSatisfies(userRole, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRoleHierarchy rejects hierarchies in which a role inherits itself
+func validateRoleHierarchy(hierarchy map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+
+	var visit func(role string, path []string) error
+	visit = func(role string, path []string) error {
+		switch state[role] {
+		case visiting:
+			return fmt.Errorf("%w: RoleHierarchy cycle %v", ErrInvalidConfig, append(path, role))
+		case done:
+			return nil
+		}
+		state[role] = visiting
+		for _, inherited := range hierarchy[role] {
+			if err := visit(inherited, append(path, role)); err != nil {
+				return err
+			}
+		}
+		state[role] = done
+		return nil
+	}
+
+	// Visit in a fixed order so the reported cycle is deterministic
+	roles := make([]string, 0, len(hierarchy))
+	for role := range hierarchy {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if err := visit(role, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyRoleHierarchy deep-copies a role hierarchy so callers can't change it after New
+func copyRoleHierarchy(hierarchy map[string][]string) map[string][]string {
+	if hierarchy == nil {
+		return nil
+	}
+	copied := make(map[string][]string, len(hierarchy))
+	for role, inherited := range hierarchy {
+		copied[role] = append([]string{}, inherited...)
+	}
+	return copied
+}
@@ -0,0 +1,242 @@
+package authkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// testRoleHierarchy makes admins moderators and billing managers, and
+// moderators users
+var testRoleHierarchy = map[string][]string{
+	"admin":     {"moderator", "billing"},
+	"moderator": {"user"},
+}
+
+func TestRoleSatisfies(t *testing.T) {
+	auth := newTestKit(t, Config{RoleHierarchy: testRoleHierarchy})
+	defer auth.Close()
+
+	cases := []struct {
+		userRole, requiredRole string
+		want                   bool
+	}{
+		{"user", "user", true},
+		{"admin", "admin", true},
+		{"admin", "moderator", true},
+		{"admin", "user", true},
+		{"admin", "billing", true},
+		{"moderator", "user", true},
+		{"moderator", "admin", false},
+		{"user", "moderator", false},
+		{"billing", "user", false},
+		{"", "user", false},
+	}
+	for _, tc := range cases {
+		if got := auth.RoleSatisfies(tc.userRole, tc.requiredRole); got != tc.want {
+			t.Errorf("RoleSatisfies(%q, %q) = %v, want %v", tc.userRole, tc.requiredRole, got, tc.want)
+		}
+	}
+}
+
+func TestRoleHierarchyCycles(t *testing.T) {
+	hierarchies := []map[string][]string{
+		{"admin": {"admin"}},
+		{"admin": {"moderator"}, "moderator": {"admin"}},
+		{"admin": {"moderator"}, "moderator": {"user"}, "user": {"admin"}},
+	}
+	for _, hierarchy := range hierarchies {
+		_, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", RoleHierarchy: hierarchy})
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected the cycle in %v to be rejected, got %v", hierarchy, err)
+		}
+	}
+
+	// Diamonds are fine
+	diamond := map[string][]string{"admin": {"moderator", "editor"}, "moderator": {"user"}, "editor": {"user"}}
+	if _, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", RoleHierarchy: diamond}); err != nil {
+		t.Errorf("Expected a diamond hierarchy to be accepted, got %v", err)
+	}
+
+	// The hierarchy is copied
+	auth := newTestKit(t, Config{RoleHierarchy: diamond})
+	defer auth.Close()
+	diamond["user"] = []string{"admin"}
+	if auth.RoleSatisfies("user", "admin") {
+		t.Error("Expected later changes to the caller's map to be ignored")
+	}
+}
+
+func TestRequireRoleHierarchy(t *testing.T) {
+	auth := newTestKit(t, Config{RoleHierarchy: testRoleHierarchy})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "moderator@example.com")
+	if _, err := auth.UpdateUser(tokens.User.ID, map[string]interface{}{"role": "moderator"}); err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ = auth.LoginUser("moderator@example.com", "password123")
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	r.GET("/user", auth.GinMiddleware(), auth.RequireRole("user"), ok)
+	r.GET("/staff", auth.GinMiddleware(), auth.RequireRoles([]string{"billing", "moderator"}), ok)
+	r.GET("/admin", auth.GinMiddleware(), auth.RequireRole("admin"), ok)
+
+	fiberOK := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+	app := fiber.New()
+	app.Get("/user", auth.FiberMiddleware(), auth.RequireRoleFiber("user"), fiberOK)
+	app.Get("/staff", auth.FiberMiddleware(), auth.RequireRolesFiber([]string{"billing", "moderator"}), fiberOK)
+	app.Get("/admin", auth.FiberMiddleware(), auth.RequireRoleFiber("admin"), fiberOK)
+
+	httpOK := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux := http.NewServeMux()
+	mux.Handle("/user", auth.HTTPMiddleware(auth.RequireRoleHTTP("user")(httpOK)))
+	mux.Handle("/staff", auth.HTTPMiddleware(auth.RequireRolesHTTP([]string{"billing", "moderator"})(httpOK)))
+	mux.Handle("/admin", auth.HTTPMiddleware(auth.RequireRoleHTTP("admin")(httpOK)))
+
+	for path, want := range map[string]int{"/user": http.StatusOK, "/staff": http.StatusOK, "/admin": http.StatusForbidden} {
+		newRequest := func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			return req
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest())
+		if w.Code != want {
+			t.Errorf("Gin %s: expected %d, got %d", path, want, w.Code)
+		}
+
+		resp, err := app.Test(newRequest())
+		if err != nil || resp.StatusCode != want {
+			t.Errorf("Fiber %s: expected %d, got %v %v", path, want, resp.StatusCode, err)
+		}
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, newRequest())
+		if w.Code != want {
+			t.Errorf("net/http %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestRoleDefinitions(t *testing.T) {
+	auth := newTestKit(t, Config{RoleHierarchy: testRoleHierarchy})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "editor@example.com")
+	userID := tokens.User.ID
+	_, _ = auth.UpdateUser(userID, map[string]interface{}{"permissions": []string{"profile:write"}})
+
+	if err := auth.DefineRole("", nil); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected an unnamed role to be rejected, got %v", err)
+	}
+	if err := auth.AssignRole(userID, "moderator"); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("Expected assigning an undefined role to fail, got %v", err)
+	}
+	if _, err := auth.GetRole("moderator"); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("Expected ErrRoleNotFound, got %v", err)
+	}
+
+	_ = auth.DefineRole("user", []string{"posts:read"})
+	_ = auth.DefineRole("moderator", []string{"posts:delete", "posts:read", "posts:delete"})
+	if err := auth.AssignRole(userID, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AssignRole("missing", "moderator"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	role, err := auth.GetRole("moderator")
+	if err != nil || !reflect.DeepEqual(role.Permissions, []string{"posts:delete", "posts:read"}) {
+		t.Errorf("Expected deduplicated permissions, got %+v %v", role, err)
+	}
+	if roles := auth.ListRoles(); len(roles) != 2 || roles[0].Name != "moderator" || roles[1].Name != "user" {
+		t.Errorf("Expected roles sorted by name, got %+v", roles)
+	}
+
+	permissions := func() []string {
+		t.Helper()
+		tokens, err := auth.LoginUser("editor@example.com", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, _ := auth.ValidateToken(tokens.AccessToken)
+		return claims.Permissions
+	}
+
+	// Moderators inherit user through the hierarchy
+	if got, want := permissions(), []string{"posts:delete", "posts:read", "profile:write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected permissions %v, got %v", want, got)
+	}
+
+	_ = auth.DefineRole("moderator", []string{"comments:delete"})
+	if got, want := permissions(), []string{"comments:delete", "posts:read", "profile:write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the new definition in new tokens, got %v", got)
+	}
+	if user, _ := auth.GetUserByID(userID); !reflect.DeepEqual(user.Permissions, []string{"profile:write"}) {
+		t.Errorf("Expected the user's own grants to be untouched, got %v", user.Permissions)
+	}
+
+	if err := auth.RemoveRole(userID, "admin"); err != nil {
+		t.Errorf("Expected removing an unassigned role to do nothing, got %v", err)
+	}
+	if err := auth.RemoveRole(userID, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := auth.GetUserByID(userID); user.Role != "user" {
+		t.Errorf("Expected the default role after RemoveRole, got %q", user.Role)
+	}
+	if got, want := permissions(), []string{"posts:read", "profile:write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected permissions %v, got %v", want, got)
+	}
+}
+
+func TestRoleHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	r := gin.New()
+	r.GET("/admin/roles", auth.AdminListRolesHandler)
+	r.PUT("/admin/roles", auth.AdminDefineRoleHandler)
+	app := fiber.New()
+	app.Get("/admin/roles", auth.AdminListRolesHandlerFiber)
+	app.Put("/admin/roles", auth.AdminDefineRoleHandlerFiber)
+
+	send := func(method, body string) (int, string) {
+		req := httptest.NewRequest(method, "/admin/roles", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	sendFiber := func(method, body string) (int, string) {
+		req := httptest.NewRequest(method, "/admin/roles", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+
+	for name, send := range map[string]func(method, body string) (int, string){"Gin": send, "Fiber": sendFiber} {
+		role := strings.ToLower(name) + "-editor"
+		if code, body := send(http.MethodPut, `{"name":"`+role+`","permissions":["posts:write"]}`); code != http.StatusOK || !strings.Contains(body, `"permissions":["posts:write"]`) {
+			t.Errorf("%s: expected the role to be defined, got %d %s", name, code, body)
+		}
+		if code, body := send(http.MethodPut, `{"permissions":["posts:write"]}`); code != http.StatusBadRequest {
+			t.Errorf("%s: expected an unnamed role to be rejected, got %d %s", name, code, body)
+		}
+		if code, body := send(http.MethodGet, ""); code != http.StatusOK || !strings.Contains(body, `"name":"`+role+`"`) {
+			t.Errorf("%s: expected the role in the list, got %d %s", name, code, body)
+		}
+	}
+}
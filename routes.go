@@ -0,0 +1,276 @@
+package authkit
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Route names an endpoint mounted by RegisterRoutes and RegisterRoutesFiber
+type Route string
+
+// Public routes
+const (
+	RouteRegister           Route = "register"             // POST /register
+	RouteLogin              Route = "login"                // POST /login
+	RouteRefresh            Route = "refresh"              // POST /refresh
+	RouteLogout             Route = "logout"               // POST /logout
+	RouteClientCredentials  Route = "client_credentials"   // POST /client/token
+	RouteVerifyMFA          Route = "verify_mfa"           // POST /mfa/verify
+	RouteForgotPassword     Route = "forgot_password"      // POST /password/forgot
+	RouteResetPassword      Route = "reset_password"       // POST /password/reset
+	RouteResendVerification Route = "resend_verification"  // POST /verify-email/resend
+	RouteVerifyEmail        Route = "verify_email"         // GET /verify-email
+	RouteConfirmEmailChange Route = "confirm_email_change" // GET /email/confirm
+	RouteRequestLoginLink   Route = "request_login_link"   // POST /login/link
+	RouteLoginWithLink      Route = "login_with_link"      // POST /login/link/verify
+	RouteRecoverAccount     Route = "recover_account"      // POST /account/recover
+	RouteJWKS               Route = "jwks"                 // GET /.well-known/jwks.json
+)
+
+// Routes requiring a valid access token
+const (
+	RouteProfile            Route = "profile"              // GET /profile
+	RouteUpdateProfile      Route = "update_profile"       // PUT /profile
+	RouteChangePassword     Route = "change_password"      // POST /password
+	RouteRequestEmailChange Route = "request_email_change" // POST /email
+	RouteEnrollTOTP         Route = "enroll_totp"          // POST /mfa/totp
+	RouteConfirmTOTP        Route = "confirm_totp"         // POST /mfa/totp/confirm
+	RouteRecoveryCodes      Route = "recovery_codes"       // POST /mfa/recovery-codes
+	RouteDeleteAccount      Route = "delete_account"       // DELETE /account
+	RouteListSessions       Route = "list_sessions"        // GET /sessions
+	RouteRevokeSession      Route = "revoke_session"       // DELETE /sessions/:id
+)
+
+// Routes requiring RouteOptions.AdminRole
+const (
+	RouteAdminListUsers     Route = "admin_list_users"     // GET /admin/users
+	RouteAdminCreateUser    Route = "admin_create_user"    // POST /admin/users
+	RouteAdminSearchUsers   Route = "admin_search_users"   // GET /admin/users/search
+	RouteAdminGetUser       Route = "admin_get_user"       // GET /admin/users/:id
+	RouteAdminUpdateUser    Route = "admin_update_user"    // PATCH /admin/users/:id
+	RouteAdminDeleteUser    Route = "admin_delete_user"    // DELETE /admin/users/:id
+	RouteAdminSetRole       Route = "admin_set_role"       // PUT /admin/users/:id/role
+	RouteAdminDisableUser   Route = "admin_disable_user"   // POST /admin/users/:id/disable
+	RouteAdminEnableUser    Route = "admin_enable_user"    // POST /admin/users/:id/enable
+	RouteAdminListSessions  Route = "admin_list_sessions"  // GET /admin/users/:id/sessions
+	RouteAdminRevokeSession Route = "admin_revoke_session" // DELETE /admin/sessions/:id
+	RouteAdminListRoles     Route = "admin_list_roles"     // GET /admin/roles
+	RouteAdminDefineRole    Route = "admin_define_role"    // PUT /admin/roles
+)
+
+// RouteOptions configures the routes mounted by RegisterRoutes and
+// RegisterRoutesFiber. The zero value mounts every route at its default path.
+type RouteOptions struct {
+	// Prefix is prepended to every path, e.g. "/auth"
+	Prefix string
+	// Disable lists routes not to mount, e.g. RouteRegister for invite-only apps
+	Disable []Route
+	// DisableAdmin leaves out all admin routes
+	DisableAdmin bool
+	// Paths overrides the default paths, relative to Prefix
+	Paths map[Route]string
+	// AdminRole is required by the admin routes (default: "admin")
+	AdminRole string
+	// AdminMiddleware runs on the Gin admin routes after the role check
+	AdminMiddleware []gin.HandlerFunc
+	// AdminMiddlewareFiber runs on the Fiber admin routes after the role check
+	AdminMiddlewareFiber []fiber.Handler
+}
+
+// routeAccess says what a route requires from the request
+type routeAccess int
+
+const (
+	routePublic routeAccess = iota
+	routeProtected
+	routeAdmin
+)
+
+// routeSpec is a route with its default method and path and its handlers
+type routeSpec struct {
+	route  Route
+	access routeAccess
+	method string
+	path   string
+	gin    func(*AuthKit, *gin.Context)
+	fiber  func(*AuthKit, *fiber.Ctx) error
+}
+
+// routeSpecs lists every route RegisterRoutes can mount
+var routeSpecs = []routeSpec{
+	{RouteRegister, routePublic, http.MethodPost, "/register", (*AuthKit).RegisterHandler, (*AuthKit).RegisterHandlerFiber},
+	{RouteLogin, routePublic, http.MethodPost, "/login", (*AuthKit).LoginHandler, (*AuthKit).LoginHandlerFiber},
+	{RouteRefresh, routePublic, http.MethodPost, "/refresh", (*AuthKit).RefreshHandler, (*AuthKit).RefreshHandlerFiber},
+	// Logout checks the token itself, so expired sessions can still log out
+	{RouteLogout, routePublic, http.MethodPost, "/logout", (*AuthKit).LogoutHandler, (*AuthKit).LogoutHandlerFiber},
+	{RouteClientCredentials, routePublic, http.MethodPost, "/client/token", (*AuthKit).ClientCredentialsHandler, (*AuthKit).ClientCredentialsHandlerFiber},
+	{RouteVerifyMFA, routePublic, http.MethodPost, "/mfa/verify", (*AuthKit).VerifyMFAHandler, (*AuthKit).VerifyMFAHandlerFiber},
+	{RouteForgotPassword, routePublic, http.MethodPost, "/password/forgot", (*AuthKit).ForgotPasswordHandler, (*AuthKit).ForgotPasswordHandlerFiber},
+	{RouteResetPassword, routePublic, http.MethodPost, "/password/reset", (*AuthKit).ResetPasswordHandler, (*AuthKit).ResetPasswordHandlerFiber},
+	{RouteResendVerification, routePublic, http.MethodPost, "/verify-email/resend", (*AuthKit).ResendVerificationHandler, (*AuthKit).ResendVerificationHandlerFiber},
+	{RouteVerifyEmail, routePublic, http.MethodGet, "/verify-email", (*AuthKit).VerifyEmailHandler, (*AuthKit).VerifyEmailHandlerFiber},
+	{RouteConfirmEmailChange, routePublic, http.MethodGet, "/email/confirm", (*AuthKit).ConfirmEmailChangeHandler, (*AuthKit).ConfirmEmailChangeHandlerFiber},
+	{RouteRequestLoginLink, routePublic, http.MethodPost, "/login/link", (*AuthKit).RequestLoginLinkHandler, (*AuthKit).RequestLoginLinkHandlerFiber},
+	{RouteLoginWithLink, routePublic, http.MethodPost, "/login/link/verify", (*AuthKit).LoginWithLinkHandler, (*AuthKit).LoginWithLinkHandlerFiber},
+	{RouteRecoverAccount, routePublic, http.MethodPost, "/account/recover", (*AuthKit).RecoverAccountHandler, (*AuthKit).RecoverAccountHandlerFiber},
+	{RouteJWKS, routePublic, http.MethodGet, "/.well-known/jwks.json", (*AuthKit).JWKSHandler, (*AuthKit).JWKSHandlerFiber},
+
+	{RouteProfile, routeProtected, http.MethodGet, "/profile", (*AuthKit).ProfileHandler, (*AuthKit).ProfileHandlerFiber},
+	{RouteUpdateProfile, routeProtected, http.MethodPut, "/profile", (*AuthKit).UpdateProfileHandler, (*AuthKit).UpdateProfileHandlerFiber},
+	{RouteChangePassword, routeProtected, http.MethodPost, "/password", (*AuthKit).ChangePasswordHandler, (*AuthKit).ChangePasswordHandlerFiber},
+	{RouteRequestEmailChange, routeProtected, http.MethodPost, "/email", (*AuthKit).RequestEmailChangeHandler, (*AuthKit).RequestEmailChangeHandlerFiber},
+	{RouteEnrollTOTP, routeProtected, http.MethodPost, "/mfa/totp", (*AuthKit).EnrollTOTPHandler, (*AuthKit).EnrollTOTPHandlerFiber},
+	{RouteConfirmTOTP, routeProtected, http.MethodPost, "/mfa/totp/confirm", (*AuthKit).ConfirmTOTPHandler, (*AuthKit).ConfirmTOTPHandlerFiber},
+	{RouteRecoveryCodes, routeProtected, http.MethodPost, "/mfa/recovery-codes", (*AuthKit).RecoveryCodesHandler, (*AuthKit).RecoveryCodesHandlerFiber},
+	{RouteDeleteAccount, routeProtected, http.MethodDelete, "/account", (*AuthKit).DeleteAccountHandler, (*AuthKit).DeleteAccountHandlerFiber},
+	{RouteListSessions, routeProtected, http.MethodGet, "/sessions", (*AuthKit).ListSessionsHandler, (*AuthKit).ListSessionsHandlerFiber},
+	{RouteRevokeSession, routeProtected, http.MethodDelete, "/sessions/:id", (*AuthKit).RevokeSessionHandler, (*AuthKit).RevokeSessionHandlerFiber},
+
+	{RouteAdminListUsers, routeAdmin, http.MethodGet, "/admin/users", (*AuthKit).AdminListUsersHandler, (*AuthKit).AdminListUsersHandlerFiber},
+	{RouteAdminCreateUser, routeAdmin, http.MethodPost, "/admin/users", (*AuthKit).AdminCreateUserHandler, (*AuthKit).AdminCreateUserHandlerFiber},
+	// Before the :id routes, Fiber matches routes in order
+	{RouteAdminSearchUsers, routeAdmin, http.MethodGet, "/admin/users/search", (*AuthKit).AdminSearchUsersHandler, (*AuthKit).AdminSearchUsersHandlerFiber},
+	{RouteAdminGetUser, routeAdmin, http.MethodGet, "/admin/users/:id", (*AuthKit).AdminGetUserHandler, (*AuthKit).AdminGetUserHandlerFiber},
+	{RouteAdminUpdateUser, routeAdmin, http.MethodPatch, "/admin/users/:id", (*AuthKit).AdminUpdateUserHandler, (*AuthKit).AdminUpdateUserHandlerFiber},
+	{RouteAdminDeleteUser, routeAdmin, http.MethodDelete, "/admin/users/:id", (*AuthKit).AdminDeleteUserHandler, (*AuthKit).AdminDeleteUserHandlerFiber},
+	{RouteAdminSetRole, routeAdmin, http.MethodPut, "/admin/users/:id/role", (*AuthKit).AdminSetRoleHandler, (*AuthKit).AdminSetRoleHandlerFiber},
+	{RouteAdminDisableUser, routeAdmin, http.MethodPost, "/admin/users/:id/disable", (*AuthKit).AdminDisableUserHandler, (*AuthKit).AdminDisableUserHandlerFiber},
+	{RouteAdminEnableUser, routeAdmin, http.MethodPost, "/admin/users/:id/enable", (*AuthKit).AdminEnableUserHandler, (*AuthKit).AdminEnableUserHandlerFiber},
+	{RouteAdminListSessions, routeAdmin, http.MethodGet, "/admin/users/:id/sessions", (*AuthKit).AdminListSessionsHandler, (*AuthKit).AdminListSessionsHandlerFiber},
+	{RouteAdminRevokeSession, routeAdmin, http.MethodDelete, "/admin/sessions/:id", (*AuthKit).AdminRevokeSessionHandler, (*AuthKit).AdminRevokeSessionHandlerFiber},
+	{RouteAdminListRoles, routeAdmin, http.MethodGet, "/admin/roles", (*AuthKit).AdminListRolesHandler, (*AuthKit).AdminListRolesHandlerFiber},
+	{RouteAdminDefineRole, routeAdmin, http.MethodPut, "/admin/roles", (*AuthKit).AdminDefineRoleHandler, (*AuthKit).AdminDefineRoleHandlerFiber},
+}
+
+// mountedRoute is an enabled route with its final path
+type mountedRoute struct {
+	routeSpec
+	fullPath string
+}
+
+// Validate checks the options, returning an error wrapping ErrInvalidConfig
+// for unknown routes, malformed paths and routes sharing a method and path
+func (o RouteOptions) Validate() error {
+	_, err := o.routes()
+	return err
+}
+
+// routes validates the options and returns the routes to mount
+func (o RouteOptions) routes() ([]mountedRoute, error) {
+	if o.Prefix != "" && (!strings.HasPrefix(o.Prefix, "/") || strings.HasSuffix(o.Prefix, "/")) {
+		return nil, fmt.Errorf("%w: route prefix %q must start and not end with /", ErrInvalidConfig, o.Prefix)
+	}
+	for _, route := range o.Disable {
+		if !knownRoute(route) {
+			return nil, fmt.Errorf("%w: unknown route %q in Disable", ErrInvalidConfig, route)
+		}
+	}
+	for route, path := range o.Paths {
+		if !knownRoute(route) {
+			return nil, fmt.Errorf("%w: unknown route %q in Paths", ErrInvalidConfig, route)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%w: path %q of route %q must start with /", ErrInvalidConfig, path, route)
+		}
+	}
+
+	var routes []mountedRoute
+	seen := make(map[string]Route)
+	for _, spec := range routeSpecs {
+		if slices.Contains(o.Disable, spec.route) || (o.DisableAdmin && spec.access == routeAdmin) {
+			continue
+		}
+		path := spec.path
+		if override, ok := o.Paths[spec.route]; ok {
+			path = override
+		}
+		key := spec.method + " " + o.Prefix + path
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%w: routes %q and %q are both mounted at %s", ErrInvalidConfig, other, spec.route, key)
+		}
+		seen[key] = spec.route
+		routes = append(routes, mountedRoute{routeSpec: spec, fullPath: o.Prefix + path})
+	}
+	return routes, nil
+}
+
+// adminRole returns the role the admin routes require
+func (o RouteOptions) adminRole() string {
+	if o.AdminRole == "" {
+		return "admin"
+	}
+	return o.AdminRole
+}
+
+// knownRoute reports whether RegisterRoutes knows the route
+func knownRoute(route Route) bool {
+	for _, spec := range routeSpecs {
+		if spec.route == route {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterRoutes mounts the bundled Gin handlers on r: the public routes, the
+// routes behind GinMiddleware and the admin routes behind GinMiddleware,
+// RequireRole(opts.AdminRole) and opts.AdminMiddleware. It mounts nothing
+// and returns the error of opts.Validate for invalid options.
+//
+//	if err := auth.RegisterRoutes(r, authkit.RouteOptions{Prefix: "/auth", Disable: []authkit.Route{authkit.RouteRegister}}); err != nil {
+//	    log.Fatal(err)
+//	}
+func (a *AuthKit) RegisterRoutes(r gin.IRouter, opts RouteOptions) error {
+	routes, err := opts.routes()
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		var handlers []gin.HandlerFunc
+		if route.route == RouteChangePassword {
+			handlers = append(handlers, a.PasswordChangeGinMiddleware())
+		} else if route.access != routePublic {
+			handlers = append(handlers, a.GinMiddleware())
+		}
+		if route.access == routeAdmin {
+			handlers = append(handlers, a.RequireRole(opts.adminRole()))
+			handlers = append(handlers, opts.AdminMiddleware...)
+		}
+		handler := route.gin
+		handlers = append(handlers, func(c *gin.Context) { handler(a, c) })
+		r.Handle(route.method, route.fullPath, handlers...)
+	}
+	return nil
+}
+
+// RegisterRoutesFiber mounts the bundled Fiber handlers on app like
+// RegisterRoutes, running opts.AdminMiddlewareFiber on the admin routes
+func (a *AuthKit) RegisterRoutesFiber(app fiber.Router, opts RouteOptions) error {
+	routes, err := opts.routes()
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		var handlers []fiber.Handler
+		if route.route == RouteChangePassword {
+			handlers = append(handlers, a.PasswordChangeFiberMiddleware())
+		} else if route.access != routePublic {
+			handlers = append(handlers, a.FiberMiddleware())
+		}
+		if route.access == routeAdmin {
+			handlers = append(handlers, a.RequireRoleFiber(opts.adminRole()))
+			handlers = append(handlers, opts.AdminMiddlewareFiber...)
+		}
+		handler := route.fiber
+		handlers = append(handlers, func(c *fiber.Ctx) error { return handler(a, c) })
+		app.Add(route.method, route.fullPath, handlers...)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// mountRoutes mounts the routes with opts on a Gin engine and a Fiber app
+func mountRoutes(t *testing.T, auth *AuthKit, opts RouteOptions) map[string]http.Handler {
+	t.Helper()
+	r := gin.New()
+	if err := auth.RegisterRoutes(r, opts); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	if err := auth.RegisterRoutesFiber(app, opts); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+	}
+}
+
+// routeStatus sends an unauthenticated request to the route's path
+func routeStatus(handler http.Handler, method, path string) int {
+	req := httptest.NewRequest(method, strings.ReplaceAll(path, ":id", "some-id"), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+// unmounted reports whether a status means no route matched
+func unmounted(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed
+}
+
+func TestRegisterRoutesToggles(t *testing.T) {
+	auth := newTestKit(t, Config{RateLimitRPM: -1})
+	defer auth.Close()
+
+	for name, handler := range mountRoutes(t, auth, RouteOptions{}) {
+		for _, spec := range routeSpecs {
+			status := routeStatus(handler, spec.method, spec.path)
+			if unmounted(status) {
+				t.Errorf("%s: expected %s %s to be mounted, got %d", name, spec.method, spec.path, status)
+			}
+			if spec.access != routePublic && status != http.StatusUnauthorized {
+				t.Errorf("%s: expected %s %s to require a token, got %d", name, spec.method, spec.path, status)
+			}
+		}
+	}
+
+	for _, disabled := range routeSpecs {
+		for name, routes := range mountedRoutes(t, auth, RouteOptions{Disable: []Route{disabled.route}}) {
+			for _, spec := range routeSpecs {
+				if mounted := routes[spec.method+" "+spec.path]; mounted != (spec.route != disabled.route) {
+					t.Errorf("%s: disabling %q left %s %s mounted=%v", name, disabled.route, spec.method, spec.path, mounted)
+				}
+			}
+		}
+	}
+
+	for name, routes := range mountedRoutes(t, auth, RouteOptions{DisableAdmin: true}) {
+		for _, spec := range routeSpecs {
+			if mounted := routes[spec.method+" "+spec.path]; mounted != (spec.access != routeAdmin) {
+				t.Errorf("%s: DisableAdmin left %s %s mounted=%v", name, spec.method, spec.path, mounted)
+			}
+		}
+	}
+}
+
+// mountedRoutes mounts the routes with opts and returns the "METHOD path"
+// pairs Gin and Fiber report
+func mountedRoutes(t *testing.T, auth *AuthKit, opts RouteOptions) map[string]map[string]bool {
+	t.Helper()
+	routes := map[string]map[string]bool{"gin": {}, "fiber": {}}
+	r := gin.New()
+	if err := auth.RegisterRoutes(r, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range r.Routes() {
+		routes["gin"][route.Method+" "+route.Path] = true
+	}
+	app := fiber.New()
+	if err := auth.RegisterRoutesFiber(app, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range app.GetRoutes() {
+		routes["fiber"][route.Method+" "+route.Path] = true
+	}
+	return routes
+}
+
+func TestRegisterRoutesOptions(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	user := loginTestUser(t, auth, "routes@example.com")
+	admin, _ := auth.AdminCreateUser(RegisterRequest{Email: "routes-admin@example.com", Password: "password123", Name: "Admin", Role: "staff"})
+	adminTokens, err := auth.LoginUser(admin.Email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var adminCalls int
+	opts := RouteOptions{
+		Prefix:               "/auth",
+		Paths:                map[Route]string{RouteLogin: "/signin"},
+		AdminRole:            "staff",
+		AdminMiddleware:      []gin.HandlerFunc{func(c *gin.Context) { adminCalls++ }},
+		AdminMiddlewareFiber: []fiber.Handler{func(c *fiber.Ctx) error { adminCalls++; return c.Next() }},
+	}
+	for name, handler := range mountRoutes(t, auth, opts) {
+		t.Run(name, func(t *testing.T) {
+			send := func(method, path, token, body string) int {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			if code := send(http.MethodPost, "/auth/signin", "", `{"email":"routes@example.com","password":"password123"}`); code != http.StatusOK {
+				t.Errorf("Expected login at the overridden path, got %d", code)
+			}
+			if code := send(http.MethodPost, "/auth/login", "", `{}`); !unmounted(code) {
+				t.Errorf("Expected the default login path to be free, got %d", code)
+			}
+			if code := send(http.MethodGet, "/profile", user.AccessToken, ""); !unmounted(code) {
+				t.Errorf("Expected routes only under the prefix, got %d", code)
+			}
+			if code := send(http.MethodGet, "/auth/profile", user.AccessToken, ""); code != http.StatusOK {
+				t.Errorf("Expected the profile under the prefix, got %d", code)
+			}
+
+			adminCalls = 0
+			if code := send(http.MethodGet, "/auth/admin/roles", user.AccessToken, ""); code != http.StatusForbidden || adminCalls != 0 {
+				t.Errorf("Expected 403 before the admin middleware, got %d with %d calls", code, adminCalls)
+			}
+			if code := send(http.MethodGet, "/auth/admin/roles", adminTokens.AccessToken, ""); code != http.StatusOK || adminCalls != 1 {
+				t.Errorf("Expected the admin route after the admin middleware, got %d with %d calls", code, adminCalls)
+			}
+		})
+	}
+}
+
+func TestRouteOptionsValidate(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	for name, opts := range map[string]RouteOptions{
+		"relative prefix":      {Prefix: "auth"},
+		"trailing slash":       {Prefix: "/auth/"},
+		"unknown disabled":     {Disable: []Route{"signup"}},
+		"unknown path":         {Paths: map[Route]string{"signup": "/signup"}},
+		"relative path":        {Paths: map[Route]string{RouteLogin: "signin"}},
+		"conflicting paths":    {Paths: map[Route]string{RouteLogin: "/register"}},
+		"conflicting defaults": {Paths: map[Route]string{RouteChangePassword: "/password/reset"}},
+	} {
+		if err := opts.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+		r := gin.New()
+		if err := auth.RegisterRoutes(r, opts); err == nil || len(r.Routes()) != 0 {
+			t.Errorf("%s: expected an error and no routes, got %v with %d routes", name, err, len(r.Routes()))
+		}
+		if err := auth.RegisterRoutesFiber(fiber.New(), opts); err == nil {
+			t.Errorf("%s: expected an error from RegisterRoutesFiber", name)
+		}
+	}
+
+	valid := RouteOptions{Prefix: "/auth", Disable: []Route{RouteRegister}, Paths: map[Route]string{RouteRegister: "/login"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected a disabled route's path to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package authkit
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// SecretProvider supplies the HS256 secrets tokens are signed and verified
+// with. It is asked on every signature and validation, so secrets can be
+// rotated without a restart; cache anything expensive, such as KMS calls.
+type SecretProvider interface {
+	// CurrentSecret is the secret new tokens are signed with
+	CurrentSecret() []byte
+	// AllSecrets are the secrets tokens are accepted with, current first
+	AllSecrets() [][]byte
+}
+
+// staticSecrets is a SecretProvider with fixed secrets, current first. It's
+// used through a pointer so formatting a Config never prints the secrets.
+type staticSecrets struct {
+	secrets [][]byte
+}
+
+// StaticSecrets returns a SecretProvider signing with current and still
+// accepting tokens signed with the previous secrets. It is the default,
+// built from Config.JWTSecret and Config.PreviousJWTSecrets.
+func StaticSecrets(current string, previous ...string) SecretProvider {
+	s := &staticSecrets{secrets: [][]byte{[]byte(current)}}
+	for _, secret := range previous {
+		s.secrets = append(s.secrets, []byte(secret))
+	}
+	return s
+}
+
+func (s *staticSecrets) CurrentSecret() []byte { return s.secrets[0] }
+func (s *staticSecrets) AllSecrets() [][]byte  { return s.secrets }
+
+// defaultSecretRefresh is how often FileSecretProvider rereads its file by default
+const defaultSecretRefresh = time.Minute
+
+// FileSecretProvider is a SecretProvider reading secrets from a file, one per
+// line with the current secret first. The file is reread at most once per
+// refresh interval; if it can't be read or is empty, the last secrets stay in use.
+type FileSecretProvider struct {
+	path     string
+	interval time.Duration
+
+	mutex    sync.Mutex
+	secrets  [][]byte
+	loadedAt time.Time
+}
+
+// NewFileSecretProvider reads the secrets at path, failing if there are none.
+// refreshInterval is how often the file is reread (default: 1m).
+func NewFileSecretProvider(path string, refreshInterval time.Duration) (*FileSecretProvider, error) {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultSecretRefresh
+	}
+	p := &FileSecretProvider{path: path, interval: refreshInterval}
+	secrets, err := readSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p.secrets, p.loadedAt = secrets, time.Now()
+	return p, nil
+}
+
+// CurrentSecret implements SecretProvider
+func (p *FileSecretProvider) CurrentSecret() []byte {
+	return p.AllSecrets()[0]
+}
+
+// AllSecrets implements SecretProvider
+func (p *FileSecretProvider) AllSecrets() [][]byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.loadedAt) >= p.interval {
+		if secrets, err := readSecretFile(p.path); err == nil {
+			p.secrets = secrets
+		}
+		p.loadedAt = time.Now()
+	}
+	return p.secrets
+}
+
+// readSecretFile returns the non-empty lines of a secret file
+func readSecretFile(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var secrets [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			secrets = append(secrets, line)
+		}
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w: no secrets in %s", ErrInvalidConfig, path)
+	}
+	return secrets, nil
+}
+
+// redactedMarker replaces secrets in formatted configurations
+const redactedMarker = "[REDACTED]"
+
+// configFields is Config without its methods, for formatting
+type configFields Config
+
+// String formats the configuration like %+v with secrets redacted, so
+// configurations can be logged or printed safely
+func (c Config) String() string {
+	return fmt.Sprintf("%+v", configFields(c.redacted()))
+}
+
+// GoString is String for %#v
+func (c Config) GoString() string {
+	return c.String()
+}
+
+// LogValue implements slog.LogValuer with secrets redacted
+func (c Config) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
+
+// redacted returns a copy of the configuration with secrets replaced by redactedMarker
+func (c Config) redacted() Config {
+	redact := func(secret string) string {
+		if secret == "" {
+			return ""
+		}
+		return redactedMarker
+	}
+	c.JWTSecret = redact(c.JWTSecret)
+	c.PrivateKeyPEM = redact(c.PrivateKeyPEM)
+	c.EncryptionKey = redact(c.EncryptionKey)
+	c.PasswordPepper = redact(c.PasswordPepper)
+	redactAll := func(secrets []string) []string {
+		if len(secrets) == 0 {
+			return secrets
+		}
+		redacted := make([]string, len(secrets))
+		for i, secret := range secrets {
+			redacted[i] = redact(secret)
+		}
+		return redacted
+	}
+	c.PreviousJWTSecrets = redactAll(c.PreviousJWTSecrets)
+	c.PreviousPasswordPeppers = redactAll(c.PreviousPasswordPeppers)
+	return c
+}
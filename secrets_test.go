@@ -0,0 +1,159 @@
+package authkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	secret := "super-secret-signing-key"
+	cfg := Config{
+		JWTSecret:          secret,
+		PreviousJWTSecrets: []string{"previous-secret-key"},
+		EncryptionKey:      "encryption-secret-key",
+		PasswordPepper:     "pepper-secret-key",
+		SecretProvider:     StaticSecrets("provider-secret-key"),
+		Issuer:             "issuer.example.com",
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("config", "config", cfg)
+
+	outputs := map[string]string{
+		"%v":   fmt.Sprintf("%v", cfg),
+		"%+v":  fmt.Sprintf("%+v", cfg),
+		"%#v":  fmt.Sprintf("%#v", cfg),
+		"%s":   fmt.Sprintf("%s", cfg),
+		"&%+v": fmt.Sprintf("%+v", &cfg),
+		"slog": logged.String(),
+	}
+	for verb, output := range outputs {
+		if !strings.Contains(output, redactedMarker) {
+			t.Errorf("%s: expected the redaction marker, got %s", verb, output)
+		}
+		for _, s := range []string{secret, "previous-secret-key", "encryption-secret-key", "pepper-secret-key", "provider-secret-key"} {
+			if strings.Contains(output, s) {
+				t.Errorf("%s: expected %q to be redacted, got %s", verb, s, output)
+			}
+		}
+		if !strings.Contains(output, "issuer.example.com") {
+			t.Errorf("%s: expected other fields to be kept, got %s", verb, output)
+		}
+	}
+	if cfg.JWTSecret != secret {
+		t.Error("Expected formatting not to modify the configuration")
+	}
+}
+
+// rotatingSecrets is a SecretProvider whose secrets can be swapped
+type rotatingSecrets struct {
+	mutex   sync.Mutex
+	secrets [][]byte
+}
+
+func (r *rotatingSecrets) set(secrets ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.secrets = nil
+	for _, secret := range secrets {
+		r.secrets = append(r.secrets, []byte(secret))
+	}
+}
+
+func (r *rotatingSecrets) CurrentSecret() []byte { return r.AllSecrets()[0] }
+
+func (r *rotatingSecrets) AllSecrets() [][]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.secrets
+}
+
+func TestSecretProviderRotation(t *testing.T) {
+	provider := &rotatingSecrets{}
+	provider.set("first-secret")
+	auth := New(Config{SecretProvider: provider, BCryptCost: 4})
+	defer auth.Close()
+
+	first := loginTestUser(t, auth, "rotate@example.com")
+
+	// Rotated without a restart: old tokens stay valid while the old secret is listed
+	provider.set("second-secret", "first-secret")
+	second, err := auth.LoginUser("rotate@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"first": first.AccessToken, "second": second.AccessToken} {
+		if _, err := auth.ValidateToken(token); err != nil {
+			t.Errorf("Expected the %s token to be valid, got %v", name, err)
+		}
+	}
+
+	provider.set("second-secret")
+	if _, err := auth.ValidateToken(first.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected tokens of the retired secret to be rejected, got %v", err)
+	}
+	if _, err := auth.ValidateToken(second.AccessToken); err != nil {
+		t.Errorf("Expected the current token to be valid, got %v", err)
+	}
+
+	other := New(Config{JWTSecret: "first-secret", BCryptCost: 4})
+	defer other.Close()
+	if _, err := other.ValidateToken(first.AccessToken); err != nil {
+		t.Errorf("Expected the token to be signed with the provider's secret, got %v", err)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-secrets")
+	if err := os.WriteFile(path, []byte("file-secret-one\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewFileSecretProvider(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(provider.CurrentSecret()); got != "file-secret-one" {
+		t.Errorf("Expected the file's secret, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("file-secret-two\nfile-secret-one\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(provider.CurrentSecret()); got != "file-secret-one" {
+		t.Errorf("Expected the secret to be cached until the refresh interval, got %q", got)
+	}
+
+	provider.loadedAt = time.Now().Add(-2 * time.Hour)
+	if all := provider.AllSecrets(); len(all) != 2 || string(all[0]) != "file-secret-two" {
+		t.Errorf("Expected the rotated secrets after the refresh interval, got %q", all)
+	}
+
+	// A broken file keeps the last secrets
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider.loadedAt = time.Now().Add(-2 * time.Hour)
+	if got := string(provider.CurrentSecret()); got != "file-secret-two" {
+		t.Errorf("Expected the last secrets to stay in use, got %q", got)
+	}
+
+	if _, err := NewFileSecretProvider(path, 0); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an empty secret file to be rejected, got %v", err)
+	}
+}
+
+func TestSecretProviderRequiresHS256(t *testing.T) {
+	privatePEM, _ := testKeyPair(t, SigningMethodRS256)
+	_, err := NewValidated(Config{SigningMethod: SigningMethodRS256, PrivateKeyPEM: privatePEM, SecretProvider: StaticSecrets("secret")})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
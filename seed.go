@@ -0,0 +1,264 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// SeedStrategy controls what LoadSeed does with users that already exist
+type SeedStrategy string
+
+const (
+	// SeedSkipExisting leaves existing users untouched (default)
+	SeedSkipExisting SeedStrategy = "skip"
+	// SeedUpdateExisting overwrites existing users with the seeded values
+	SeedUpdateExisting SeedStrategy = "update"
+)
+
+// SeedDocument describes roles, permission groups and users to load into AuthKit.
+// It is read from YAML or JSON.
+type SeedDocument struct {
+	Roles  []SeedRole  `yaml:"roles" json:"roles"`
+	Groups []SeedGroup `yaml:"groups" json:"groups"`
+	Users  []SeedUser  `yaml:"users" json:"users"`
+}
+
+// SeedRole declares a role and the permissions it grants
+type SeedRole struct {
+	Name        string   `yaml:"name" json:"name"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// SeedGroup declares a named bundle of permissions users can be placed in
+type SeedGroup struct {
+	Name        string   `yaml:"name" json:"name"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// SeedUser declares a user. Exactly one of Password (plaintext) or PasswordHash (bcrypt or Argon2id) is required.
+type SeedUser struct {
+	Email         string                 `yaml:"email" json:"email"`
+	Password      string                 `yaml:"password" json:"password"`
+	PasswordHash  string                 `yaml:"password_hash" json:"password_hash"`
+	Name          string                 `yaml:"name" json:"name"`
+	Role          string                 `yaml:"role" json:"role"`
+	Permissions   []string               `yaml:"permissions" json:"permissions"`
+	Groups        []string               `yaml:"groups" json:"groups"`
+	EmailVerified *bool                  `yaml:"email_verified" json:"email_verified"`
+	Metadata      map[string]interface{} `yaml:"metadata" json:"metadata"`
+}
+
+// SeedError reports an invalid entry in a seed document
+type SeedError struct {
+	Path    string // e.g. "users[2].email"
+	Message string
+}
+
+func (e *SeedError) Error() string {
+	return fmt.Sprintf("seed: %s: %s", e.Path, e.Message)
+}
+
+// LoadSeedFile applies the seed document at path
+func (a *AuthKit) LoadSeedFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return a.LoadSeed(file)
+}
+
+// LoadSeed reads a YAML or JSON seed document and applies it. The whole document
+// is validated before anything is written, and applying the same document twice
+// is idempotent: existing users (matched by email) are skipped or updated
+// according to Config.SeedStrategy.
+func (a *AuthKit) LoadSeed(r io.Reader) error {
+	var doc SeedDocument
+
+	// YAML is a superset of JSON, so one strict decoder handles both
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("seed: %w", err)
+	}
+
+	if err := a.validateSeed(&doc); err != nil {
+		return err
+	}
+
+	rolePermissions := make(map[string][]string, len(doc.Roles))
+	for _, role := range doc.Roles {
+		rolePermissions[role.Name] = role.Permissions
+	}
+	groupPermissions := make(map[string][]string, len(doc.Groups))
+	for _, group := range doc.Groups {
+		groupPermissions[group.Name] = group.Permissions
+	}
+
+	for i, seed := range doc.Users {
+		if err := a.applySeedUser(seed, rolePermissions, groupPermissions); err != nil {
+			return &SeedError{Path: fmt.Sprintf("users[%d]", i), Message: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// validateSeed checks every entry of the document, returning the first problem found
+func (a *AuthKit) validateSeed(doc *SeedDocument) error {
+	roles := make(map[string]bool, len(doc.Roles))
+	for i, role := range doc.Roles {
+		path := fmt.Sprintf("roles[%d]", i)
+		if role.Name == "" {
+			return &SeedError{Path: path + ".name", Message: "is required"}
+		}
+		if roles[role.Name] {
+			return &SeedError{Path: path + ".name", Message: fmt.Sprintf("duplicate role %q", role.Name)}
+		}
+		roles[role.Name] = true
+	}
+
+	groups := make(map[string]bool, len(doc.Groups))
+	for i, group := range doc.Groups {
+		path := fmt.Sprintf("groups[%d]", i)
+		if group.Name == "" {
+			return &SeedError{Path: path + ".name", Message: "is required"}
+		}
+		if groups[group.Name] {
+			return &SeedError{Path: path + ".name", Message: fmt.Sprintf("duplicate group %q", group.Name)}
+		}
+		groups[group.Name] = true
+	}
+
+	emails := make(map[string]bool, len(doc.Users))
+	for i, user := range doc.Users {
+		path := fmt.Sprintf("users[%d]", i)
+		if user.Email == "" {
+			return &SeedError{Path: path + ".email", Message: "is required"}
+		}
+		email, err := a.NormalizeEmail(user.Email)
+		if err != nil {
+			return &SeedError{Path: path + ".email", Message: fmt.Sprintf("invalid email %q", user.Email)}
+		}
+		if emails[email] {
+			return &SeedError{Path: path + ".email", Message: fmt.Sprintf("duplicate user %q", user.Email)}
+		}
+		emails[email] = true
+
+		switch {
+		case user.Password == "" && user.PasswordHash == "":
+			return &SeedError{Path: path + ".password", Message: "password or password_hash is required"}
+		case user.Password != "" && user.PasswordHash != "":
+			return &SeedError{Path: path + ".password", Message: "only one of password and password_hash may be set"}
+		case user.PasswordHash != "":
+			if !isPasswordHash(user.PasswordHash) {
+				return &SeedError{Path: path + ".password_hash", Message: "is not a bcrypt or argon2id hash"}
+			}
+		}
+
+		if user.Role != "" && len(doc.Roles) > 0 && !roles[user.Role] {
+			return &SeedError{Path: path + ".role", Message: fmt.Sprintf("unknown role %q", user.Role)}
+		}
+		for j, group := range user.Groups {
+			if !groups[group] {
+				return &SeedError{Path: fmt.Sprintf("%s.groups[%d]", path, j), Message: fmt.Sprintf("unknown group %q", group)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// applySeedUser creates a seeded user, or skips/updates an existing one
+func (a *AuthKit) applySeedUser(seed SeedUser, rolePermissions, groupPermissions map[string][]string) error {
+	role := seed.Role
+	if role == "" {
+		role = defaultRole
+	}
+
+	// Effective permissions: explicit grants plus those of the role and groups
+	permissions := append([]string{}, seed.Permissions...)
+	permissions = append(permissions, rolePermissions[role]...)
+	for _, group := range seed.Groups {
+		permissions = append(permissions, groupPermissions[group]...)
+	}
+	permissions = uniqueSorted(permissions)
+
+	existing, err := a.GetUserByEmail(seed.Email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if existing != nil && a.config.SeedStrategy != SeedUpdateExisting {
+		return nil
+	}
+
+	password := seed.PasswordHash
+	if password == "" {
+		// Avoid re-hashing (and changing) an unchanged plaintext password on re-application
+		if existing != nil && a.ComparePassword(existing.Password, seed.Password) {
+			password = existing.Password
+		} else if password, err = a.HashPassword(seed.Password); err != nil {
+			return err
+		}
+	}
+
+	emailVerified := !a.config.EmailRequired
+	if seed.EmailVerified != nil {
+		emailVerified = *seed.EmailVerified
+	}
+
+	if existing == nil {
+		now := a.now()
+		return a.insertUser(&User{
+			ID:            uuid.New().String(),
+			Email:         a.emailKey(seed.Email),
+			Password:      password,
+			Name:          seed.Name,
+			Role:          role,
+			Permissions:   permissions,
+			EmailVerified: emailVerified,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			Metadata:      copyMetadata(seed.Metadata),
+		})
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(existing.ID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	user := cloneUser(stored)
+	a.setPassword(user, password)
+	user.Name = seed.Name
+	user.Role = role
+	user.Permissions = permissions
+	user.EmailVerified = emailVerified
+	user.Metadata = copyMetadata(seed.Metadata)
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	return nil
+}
+
+// uniqueSorted returns the distinct values of s in sorted order
+func uniqueSorted(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	result := make([]string, 0, len(s))
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,175 @@
+package authkit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSeed = `
+roles:
+  - name: admin
+    permissions: [users.read, users.write]
+  - name: user
+    permissions: [profile.read]
+groups:
+  - name: billing
+    permissions: [invoices.read]
+users:
+  - email: admin@example.com
+    password: adminpassword123
+    name: Admin
+    role: admin
+    groups: [billing]
+    metadata:
+      team: platform
+  - email: user@example.com
+    password: userpassword123
+    name: Regular User
+`
+
+func TestLoadSeed(t *testing.T) {
+	auth := newTestKit(t, Config{})
+
+	if err := auth.LoadSeed(strings.NewReader(testSeed)); err != nil {
+		t.Fatalf("Expected seed to load, got %v", err)
+	}
+
+	admin, err := auth.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatalf("Expected seeded admin, got %v", err)
+	}
+	if admin.Role != "admin" || admin.Metadata["team"] != "platform" {
+		t.Errorf("Expected admin role and metadata, got %+v", admin)
+	}
+	want := []string{"invoices.read", "users.read", "users.write"}
+	if !reflect.DeepEqual(admin.Permissions, want) {
+		t.Errorf("Expected permissions %v, got %v", want, admin.Permissions)
+	}
+
+	user, _ := auth.GetUserByEmail("user@example.com")
+	if user == nil || user.Role != "user" || !reflect.DeepEqual(user.Permissions, []string{"profile.read"}) {
+		t.Errorf("Expected default role with its permissions, got %+v", user)
+	}
+
+	if _, err := auth.LoginUser("user@example.com", "userpassword123"); err != nil {
+		t.Errorf("Expected seeded user to log in, got %v", err)
+	}
+
+	// Re-applying the same document changes nothing
+	if err := auth.LoadSeed(strings.NewReader(testSeed)); err != nil {
+		t.Fatalf("Expected re-application to succeed, got %v", err)
+	}
+	if n := len(auth.ListUsers()); n != 2 {
+		t.Errorf("Expected 2 users after re-application, got %d", n)
+	}
+	again, _ := auth.GetUserByEmail("admin@example.com")
+	if again.ID != admin.ID || again.Password != admin.Password {
+		t.Error("Expected re-application to leave existing user untouched")
+	}
+}
+
+func TestLoadSeedStrategies(t *testing.T) {
+	hash, _ := HashPasswordStatic("seededpassword123", 4)
+	updated := `
+users:
+  - email: existing@example.com
+    password_hash: "` + hash + `"
+    name: Seeded Name
+    role: editor
+`
+
+	for _, tc := range []struct {
+		strategy SeedStrategy
+		wantName string
+		wantRole string
+	}{
+		{SeedSkipExisting, "Original", "user"},
+		{SeedUpdateExisting, "Seeded Name", "editor"},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			auth := newTestKit(t, Config{SeedStrategy: tc.strategy})
+			registered, _ := auth.RegisterUser(RegisterRequest{Email: "existing@example.com", Password: "originalpassword123", Name: "Original"})
+
+			for i := 0; i < 2; i++ {
+				if err := auth.LoadSeed(strings.NewReader(updated)); err != nil {
+					t.Fatalf("Expected seed to load, got %v", err)
+				}
+			}
+
+			user, _ := auth.GetUserByEmail("existing@example.com")
+			if user.ID != registered.ID {
+				t.Errorf("Expected existing user to keep its ID")
+			}
+			if user.Name != tc.wantName || user.Role != tc.wantRole {
+				t.Errorf("Expected name %q role %q, got %q %q", tc.wantName, tc.wantRole, user.Name, user.Role)
+			}
+			if tc.strategy == SeedUpdateExisting && user.Password != hash {
+				t.Error("Expected pre-hashed password to be stored as given")
+			}
+			if n := len(auth.ListUsers()); n != 1 {
+				t.Errorf("Expected 1 user, got %d", n)
+			}
+		})
+	}
+}
+
+func TestLoadSeedValidationErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		doc  string
+		path string
+	}{
+		{"missing email", "users:\n  - password: x\n", "users[0].email"},
+		{"no password", "users:\n  - email: a@example.com\n", "users[0].password"},
+		{"bad hash", "users:\n  - email: a@example.com\n    password_hash: plain\n", "users[0].password_hash"},
+		{"duplicate email", "users:\n  - {email: a@example.com, password: x}\n  - {email: a@example.com, password: y}\n", "users[1].email"},
+		{"unknown role", "roles: [{name: admin}]\nusers:\n  - {email: a@example.com, password: x, role: root}\n", "users[0].role"},
+		{"unknown group", "users:\n  - {email: a@example.com, password: x, groups: [ops]}\n", "users[0].groups[0]"},
+		{"unnamed role", "roles: [{permissions: [a]}]\n", "roles[0].name"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := newTestKit(t, Config{})
+
+			err := auth.LoadSeed(strings.NewReader(tc.doc))
+			var seedErr *SeedError
+			if !errors.As(err, &seedErr) || seedErr.Path != tc.path {
+				t.Fatalf("Expected SeedError at %s, got %v", tc.path, err)
+			}
+			if n := len(auth.ListUsers()); n != 0 {
+				t.Errorf("Expected nothing applied from an invalid document, got %d users", n)
+			}
+		})
+	}
+
+	auth := newTestKit(t, Config{})
+	if err := auth.LoadSeed(strings.NewReader("users:\n  - {email: a@example.com, pasword: x}\n")); err == nil {
+		t.Error("Expected unknown field to be rejected")
+	}
+}
+
+func TestConfigSeedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.json")
+	doc := `{"users": [{"email": "json@example.com", "password": "jsonpassword123", "role": "admin"}]}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", BCryptCost: 4, SeedFile: path})
+	if err != nil {
+		t.Fatalf("Expected seed file to load, got %v", err)
+	}
+	if user, err := auth.GetUserByEmail("json@example.com"); err != nil || user.Role != "admin" {
+		t.Errorf("Expected seeded admin from JSON file, got %+v, %v", user, err)
+	}
+
+	if _, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", SeedFile: filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("Expected error for a missing seed file")
+	}
+	if _, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", SeedStrategy: "merge"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for unknown SeedStrategy, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TokenUseClient is the token_use claim of access tokens issued to service accounts
+const TokenUseClient = "client"
+
+// defaultServiceAccountRole is Config.ServiceAccountRole when unset
+const defaultServiceAccountRole = "service"
+
+// serviceAccountIDPrefix keeps client IDs apart from user IDs
+const serviceAccountIDPrefix = "sa_"
+
+// ServiceAccount is a non-human client that authenticates with a client ID
+// and secret, e.g. a background worker
+type ServiceAccount struct {
+	ID          string    `json:"id"` // The client ID
+	Name        string    `json:"name"`
+	Role        string    `json:"role"`
+	Permissions []string  `json:"permissions"`
+	SecretHash  string    `json:"secret_hash,omitempty"` // SHA-256 of the client secret
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CreateServiceAccount registers a service account with the given permissions
+// and Config.ServiceAccountRole. The secret is only returned here; AuthKit
+// stores a hash of it.
+func (a *AuthKit) CreateServiceAccount(name string, permissions []string) (clientID, clientSecret string, err error) {
+	a.debugCheck()
+
+	clientSecret, secretHash, err := newClientSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := a.now()
+	account := &ServiceAccount{
+		ID:          serviceAccountIDPrefix + uuid.New().String(),
+		Name:        name,
+		Role:        a.config.ServiceAccountRole,
+		Permissions: append([]string{}, permissions...),
+		SecretHash:  secretHash,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.serviceAccounts[account.ID] = account
+	return account.ID, clientSecret, nil
+}
+
+// RotateServiceAccountSecret replaces a service account's secret, returning
+// the new one. The old secret stops working immediately; tokens already issued
+// stay valid until they expire.
+func (a *AuthKit) RotateServiceAccountSecret(clientID string) (string, error) {
+	a.debugCheck()
+
+	clientSecret, secretHash, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	account, exists := a.serviceAccounts[clientID]
+	if !exists {
+		return "", ErrServiceAccountNotFound
+	}
+	account.SecretHash = secretHash
+	account.UpdatedAt = a.now()
+	return clientSecret, nil
+}
+
+// GetServiceAccount returns a copy of the service account with the given client ID
+func (a *AuthKit) GetServiceAccount(clientID string) (*ServiceAccount, error) {
+	a.debugCheck()
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	account, exists := a.serviceAccounts[clientID]
+	if !exists {
+		return nil, ErrServiceAccountNotFound
+	}
+	return cloneServiceAccount(account), nil
+}
+
+// ListServiceAccounts returns all service accounts, ordered by creation time
+func (a *AuthKit) ListServiceAccounts() []*ServiceAccount {
+	a.debugCheck()
+
+	a.mutex.RLock()
+	accounts := make([]*ServiceAccount, 0, len(a.serviceAccounts))
+	for _, account := range a.serviceAccounts {
+		accounts = append(accounts, cloneServiceAccount(account))
+	}
+	a.mutex.RUnlock()
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+	})
+	return accounts
+}
+
+// DeleteServiceAccount removes a service account; its tokens stop validating
+func (a *AuthKit) DeleteServiceAccount(clientID string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, exists := a.serviceAccounts[clientID]; !exists {
+		return ErrServiceAccountNotFound
+	}
+	delete(a.serviceAccounts, clientID)
+	return nil
+}
+
+// ClientCredentialsLogin authenticates a service account and issues an access
+// token carrying its role and permissions and a token_use claim of "client".
+// No refresh token is issued; clients log in again when the token expires.
+func (a *AuthKit) ClientCredentialsLogin(clientID, clientSecret string) (*TokenResponse, error) {
+	a.debugCheck()
+
+	account, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return a.clientToken(account, nil)
+}
+
+// authenticateClient returns the service account with the given credentials,
+// or ErrInvalidClientCredentials
+func (a *AuthKit) authenticateClient(clientID, clientSecret string) (*ServiceAccount, error) {
+	account, err := a.GetServiceAccount(clientID)
+	if err != nil {
+		return nil, ErrInvalidClientCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(clientSecret)), []byte(account.SecretHash)) != 1 {
+		return nil, ErrInvalidClientCredentials
+	}
+	return account, nil
+}
+
+// clientToken issues the access token of ClientCredentialsLogin, limited to
+// the permissions in scope unless it is nil
+func (a *AuthKit) clientToken(account *ServiceAccount, scope []string) (*TokenResponse, error) {
+	duration := a.accessExpiry
+	permissions := a.effectivePermissions(account.Role, account.Permissions)
+	var grantedScope string
+	if scope != nil {
+		permissions = limitPermissions(permissions, scope)
+		grantedScope = strings.Join(permissions, " ")
+	}
+
+	now := a.now()
+	claims := &Claims{
+		UserID:      account.ID,
+		Role:        account.Role,
+		Permissions: permissions,
+		TokenUse:    TokenUseClient,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   account.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    a.config.Issuer,
+			Audience:  append([]string{}, a.config.Audience...),
+		},
+	}
+
+	accessToken, err := a.signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(duration.Seconds()),
+		Scope:       grantedScope,
+	}, nil
+}
+
+// serviceAccountExists reports whether a client ID belongs to a live service account
+func (a *AuthKit) serviceAccountExists(clientID string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	_, exists := a.serviceAccounts[clientID]
+	return exists
+}
+
+// newClientSecret returns a random client secret and the hash stored for it
+func newClientSecret() (secret, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(buf)
+	return secret, hashClientSecret(secret), nil
+}
+
+// hashClientSecret hashes a client secret for storage. Secrets are 256 random
+// bits, so a fast hash is enough and keeps client logins cheap.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// cloneServiceAccount returns a copy of a stored service account
+func cloneServiceAccount(account *ServiceAccount) *ServiceAccount {
+	clone := *account
+	clone.Permissions = append([]string{}, account.Permissions...)
+	return &clone
+}
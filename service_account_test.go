@@ -0,0 +1,136 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestServiceAccountLogin(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	clientID, clientSecret, err := auth.CreateServiceAccount("billing-worker", []string{"invoices:write"})
+	if err != nil {
+		t.Fatalf("Expected a service account, got %v", err)
+	}
+	account, _ := auth.GetServiceAccount(clientID)
+	if account.Name != "billing-worker" || account.Role != "service" || account.SecretHash == clientSecret {
+		t.Errorf("Unexpected account %+v", account)
+	}
+
+	tokens, err := auth.ClientCredentialsLogin(clientID, clientSecret)
+	if err != nil {
+		t.Fatalf("Expected a client login, got %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken != "" || tokens.User != nil {
+		t.Errorf("Expected only an access token, got %+v", tokens)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if claims.TokenUse != TokenUseClient || claims.UserID != clientID || claims.Role != "service" ||
+		len(claims.Permissions) != 1 || claims.Permissions[0] != "invoices:write" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := auth.ClientCredentialsLogin(clientID, "wrong"); !errors.Is(err, ErrInvalidClientCredentials) {
+		t.Errorf("Expected ErrInvalidClientCredentials for a wrong secret, got %v", err)
+	}
+	if _, err := auth.ClientCredentialsLogin("sa_missing", clientSecret); !errors.Is(err, ErrInvalidClientCredentials) {
+		t.Errorf("Expected ErrInvalidClientCredentials for an unknown client, got %v", err)
+	}
+
+	if err := auth.DeleteServiceAccount(clientID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected tokens of a deleted account to be rejected, got %v", err)
+	}
+}
+
+func TestRotateServiceAccountSecret(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	clientID, oldSecret, _ := auth.CreateServiceAccount("worker", nil)
+
+	newSecret, err := auth.RotateServiceAccountSecret(clientID)
+	if err != nil || newSecret == oldSecret {
+		t.Fatalf("Expected a new secret, got %q %v", newSecret, err)
+	}
+	if _, err := auth.ClientCredentialsLogin(clientID, oldSecret); !errors.Is(err, ErrInvalidClientCredentials) {
+		t.Errorf("Expected the old secret to stop working, got %v", err)
+	}
+	if _, err := auth.ClientCredentialsLogin(clientID, newSecret); err != nil {
+		t.Errorf("Expected the new secret to work, got %v", err)
+	}
+	if _, err := auth.RotateServiceAccountSecret("sa_missing"); !errors.Is(err, ErrServiceAccountNotFound) {
+		t.Errorf("Expected ErrServiceAccountNotFound, got %v", err)
+	}
+	if accounts := auth.ListServiceAccounts(); len(accounts) != 1 || accounts[0].ID != clientID {
+		t.Errorf("Unexpected accounts %+v", accounts)
+	}
+}
+
+func TestServiceAccountMiddleware(t *testing.T) {
+	auth := newTestKit(t, Config{ServiceAccountRole: "worker"})
+	defer auth.Close()
+	clientID, clientSecret, _ := auth.CreateServiceAccount("worker", []string{"jobs:run"})
+
+	r := gin.New()
+	r.POST("/oauth/token", auth.ClientCredentialsHandler)
+	r.GET("/jobs", auth.GinMiddleware(), auth.RequireRole("worker"), auth.RequirePermission("jobs:run"), func(c *gin.Context) {
+		claims, _ := GetUserFromGinContext(c)
+		c.JSON(http.StatusOK, gin.H{"client": claims.UserID})
+	})
+	r.GET("/admin", auth.GinMiddleware(), auth.RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token",
+		strings.NewReader(`{"client_id":"`+clientID+`","client_secret":"wrong"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeInvalidClientCredentials) {
+		t.Errorf("Expected 401 %s, got %d: %s", CodeInvalidClientCredentials, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/oauth/token",
+		strings.NewReader(`{"client_id":"`+clientID+`","client_secret":"`+clientSecret+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var tokens TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	if w.Code != http.StatusOK || tokens.AccessToken == "" {
+		t.Fatalf("Expected a token, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for path, want := range map[string]int{"/jobs": http.StatusOK, "/admin": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d: %s", path, want, w.Code, w.Body.String())
+		}
+	}
+
+	app := fiber.New()
+	app.Post("/oauth/token", auth.ClientCredentialsHandlerFiber)
+	req = httptest.NewRequest(http.MethodPost, "/oauth/token",
+		strings.NewReader(`{"client_id":"`+clientID+`","client_secret":"`+clientSecret+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+}
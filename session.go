@@ -0,0 +1,328 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device: the refresh token issued at login and
+// every token refreshed from it belong to the same session
+type Session struct {
+	ID              string    `json:"id"`
+	UserID          string    `json:"user_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	// UserAgent and IP are recorded by the bundled handlers at login and on
+	// each refresh; they are empty for sessions started from Go code
+	UserAgent string `json:"user_agent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+// sessionRecord is a stored session and the tokens issued for it
+type sessionRecord struct {
+	Session
+	tokens    map[string]time.Time // JTI to expiry, revoked with the session
+	lifetimes tokenLifetimes       // Chosen at login, zero in older saved states
+	scope     []string             // LoginOptions.Scope, nil when unrestricted
+}
+
+// ListSessions returns the user's active sessions, oldest first
+func (a *AuthKit) ListSessions(userID string) ([]Session, error) {
+	a.debugCheck()
+
+	a.mutex.RLock()
+	if _, exists := a.users.get(userID); !exists {
+		a.mutex.RUnlock()
+		return nil, ErrUserNotFound
+	}
+	now := a.now()
+	sessions := []Session{}
+	for _, record := range a.sessions {
+		if record.UserID == userID && now.Before(record.ExpiresAt) {
+			sessions = append(sessions, record.Session)
+		}
+	}
+	a.mutex.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession ends a session: its refresh tokens stop working and its
+// outstanding access tokens are revoked through Config.RevocationStore
+func (a *AuthKit) RevokeSession(sessionID string) error {
+	a.debugCheck()
+	return a.revokeSession(sessionID, "")
+}
+
+// revokeSession ends a session, which must belong to userID unless it is empty
+func (a *AuthKit) revokeSession(sessionID, userID string) error {
+	a.mutex.Lock()
+	record, exists := a.sessions[sessionID]
+	if !exists || (userID != "" && record.UserID != userID) {
+		a.mutex.Unlock()
+		return ErrSessionNotFound
+	}
+	delete(a.sessions, sessionID)
+	a.mutex.Unlock()
+
+	now := a.now()
+	for jti, expiresAt := range record.tokens {
+		if !now.Before(expiresAt) {
+			continue
+		}
+		if err := a.revokeJTI(jti, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	a.config.Logger.Info("session revoked", "session_id", sessionID, "user_id", record.UserID)
+	a.audit(AuditEvent{Type: AuditSessionRevoked, ActorID: userID, UserID: record.UserID,
+		Metadata: map[string]string{"session_id": sessionID}})
+	return nil
+}
+
+// startSession records a new session for the user, issuing tokens with the
+// given lifetimes and scope, and returns its ID
+func (a *AuthKit) startSession(userID string, lifetimes tokenLifetimes, scope []string) string {
+	now := a.now()
+	record := &sessionRecord{
+		Session: Session{
+			ID:              uuid.New().String(),
+			UserID:          userID,
+			CreatedAt:       now,
+			LastRefreshedAt: now,
+			ExpiresAt:       a.sessionEnd(now, now.Add(lifetimes.refresh)),
+		},
+		tokens:    make(map[string]time.Time),
+		lifetimes: lifetimes,
+		scope:     copyScope(scope),
+	}
+
+	a.mutex.Lock()
+	a.sessions[record.ID] = record
+	a.mutex.Unlock()
+
+	a.sessionJanitor.Do(func() {
+		a.startJanitor(func() { a.pruneSessions() })
+	})
+	return record.ID
+}
+
+// refreshSession marks a session as refreshed by the user, extending it to the
+// lifetime of the new refresh token and narrowing its scope to scope unless
+// nil. Ended sessions return ErrTokenRevoked.
+func (a *AuthKit) refreshSession(sessionID, userID string, scope []string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.now()
+	record, exists := a.sessions[sessionID]
+	if !exists || record.UserID != userID || !now.Before(record.ExpiresAt) {
+		return ErrTokenRevoked
+	}
+	record.LastRefreshedAt = now
+	record.ExpiresAt = a.sessionEnd(record.CreatedAt, now.Add(a.clampLifetimes(record.lifetimes).refresh))
+	if scope != nil {
+		// A refresh can only narrow the scope granted at login
+		if record.scope != nil {
+			scope = limitPermissions(scope, record.scope)
+		}
+		record.scope = copyScope(scope)
+	}
+	return nil
+}
+
+// sessionEnd returns when a session started at createdAt ends if its refresh
+// token lasts until refreshedUntil, within Config.RefreshAbsoluteLifetime
+func (a *AuthKit) sessionEnd(createdAt, refreshedUntil time.Time) time.Time {
+	if deadline := a.reauthenticateAt(createdAt); deadline != nil && deadline.Before(refreshedUntil) {
+		return *deadline
+	}
+	return refreshedUntil
+}
+
+// reauthenticateAt returns when a session logged in to at authTime ends
+// however often it is refreshed, or nil without Config.RefreshAbsoluteLifetime
+func (a *AuthKit) reauthenticateAt(authTime time.Time) *time.Time {
+	if a.config.RefreshAbsoluteLifetime <= 0 {
+		return nil
+	}
+	deadline := authTime.Add(a.config.RefreshAbsoluteLifetime)
+	return &deadline
+}
+
+// refreshAuthTime returns when the user logged in to start the chain of a
+// refresh token. Tokens issued before the auth_time claim fall back to their
+// session's start, or else to their own issue time.
+func (a *AuthKit) refreshAuthTime(claims *refreshClaims) time.Time {
+	if claims.AuthTime != nil {
+		return claims.AuthTime.Time
+	}
+	a.mutex.RLock()
+	record, exists := a.sessions[claims.SessionID]
+	a.mutex.RUnlock()
+	if exists {
+		return record.CreatedAt
+	}
+	if claims.IssuedAt != nil {
+		return claims.IssuedAt.Time
+	}
+	return a.now()
+}
+
+// checkRefreshLimits rejects refresh tokens of sessions older than
+// Config.RefreshAbsoluteLifetime with ErrSessionExpired, and tokens unused for
+// Config.RefreshIdleTimeout with ErrSessionIdle
+func (a *AuthKit) checkRefreshLimits(claims *refreshClaims, authTime time.Time) error {
+	now := a.now()
+	if deadline := a.reauthenticateAt(authTime); deadline != nil && !now.Before(*deadline) {
+		return ErrSessionExpired
+	}
+	if idle := a.config.RefreshIdleTimeout; idle > 0 && claims.IssuedAt != nil && !now.Before(claims.IssuedAt.Add(idle)) {
+		return ErrSessionIdle
+	}
+	return nil
+}
+
+// sessionLifetimes returns the token lifetimes of a session, within the
+// current caps. Tokens outside a session get the defaults.
+func (a *AuthKit) sessionLifetimes(sessionID string) tokenLifetimes {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	record, exists := a.sessions[sessionID]
+	if !exists {
+		return a.defaultLifetimes()
+	}
+	return a.clampLifetimes(record.lifetimes)
+}
+
+// sessionPermissions returns the permissions of the user's tokens in a
+// session, limited to the session's scope
+func (a *AuthKit) sessionPermissions(user *User, sessionID string) []string {
+	permissions := a.effectivePermissions(user.Role, user.Permissions)
+	if scope, scoped := a.sessionScope(sessionID); scoped {
+		return limitPermissions(permissions, scope)
+	}
+	return permissions
+}
+
+// sessionScope returns the scope of a session, reporting false for sessions
+// without one and tokens outside a session
+func (a *AuthKit) sessionScope(sessionID string) ([]string, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	record, exists := a.sessions[sessionID]
+	if !exists || record.scope == nil {
+		return nil, false
+	}
+	return record.scope, true
+}
+
+// grantedScope returns the permissions in a scoped session's tokens as an
+// OAuth2 scope, or "" for sessions without a scope
+func (a *AuthKit) grantedScope(user *User, sessionID string) string {
+	if _, scoped := a.sessionScope(sessionID); !scoped {
+		return ""
+	}
+	return strings.Join(a.sessionPermissions(user, sessionID), " ")
+}
+
+// limitPermissions returns the permissions that are also in scope
+func limitPermissions(permissions, scope []string) []string {
+	limited := []string{}
+	for _, permission := range permissions {
+		if slices.Contains(scope, permission) {
+			limited = append(limited, permission)
+		}
+	}
+	return limited
+}
+
+// copyScope copies a scope, keeping nil and empty scopes apart
+func copyScope(scope []string) []string {
+	if scope == nil {
+		return nil
+	}
+	return append([]string{}, scope...)
+}
+
+// trackSessionToken records a token issued for a session so RevokeSession can
+// revoke it. It returns ErrTokenRevoked if the session ended in the meantime.
+func (a *AuthKit) trackSessionToken(sessionID, jti string, expiresAt time.Time) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	record, exists := a.sessions[sessionID]
+	if !exists {
+		return ErrTokenRevoked
+	}
+	now := a.now()
+	for tracked, trackedExpiry := range record.tokens {
+		if !now.Before(trackedExpiry) {
+			delete(record.tokens, tracked)
+		}
+	}
+	record.tokens[jti] = expiresAt
+	return nil
+}
+
+// setSessionClient records the user agent and IP address a session was last used from
+func (a *AuthKit) setSessionClient(sessionID, userAgent, ip string) {
+	if sessionID == "" {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if record, exists := a.sessions[sessionID]; exists {
+		record.UserAgent = userAgent
+		record.IP = ip
+	}
+}
+
+// deleteUserSessions forgets the user's sessions without revoking their tokens,
+// once the user is deleted or their token version was bumped. The caller must
+// hold the write lock.
+func (a *AuthKit) deleteUserSessions(userID string) {
+	for id, record := range a.sessions {
+		if record.UserID == userID {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+// pruneSessions forgets expired sessions
+func (a *AuthKit) pruneSessions() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.now()
+	for id, record := range a.sessions {
+		if !now.Before(record.ExpiresAt) {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+// sessionErrorStatus is the HTTP status the bundled session handlers respond with for err
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,249 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{Clock: testClock(&now)})
+	defer auth.Close()
+
+	laptop := loginTestUser(t, auth, "sessions@example.com")
+	now = now.Add(time.Minute)
+	phone, _ := auth.LoginUser("sessions@example.com", "password123")
+	if laptop.SessionID == "" || laptop.SessionID == phone.SessionID {
+		t.Fatalf("Expected a session per login, got %q and %q", laptop.SessionID, phone.SessionID)
+	}
+	claims, _ := auth.ValidateToken(laptop.AccessToken)
+	if claims.SessionID != laptop.SessionID {
+		t.Errorf("Expected the access token to carry sid %q, got %q", laptop.SessionID, claims.SessionID)
+	}
+
+	now = now.Add(time.Hour)
+	refreshed, err := auth.RefreshToken(laptop.RefreshToken)
+	if err != nil || refreshed.SessionID != laptop.SessionID {
+		t.Fatalf("Expected the refresh to stay in the session, got %+v %v", refreshed, err)
+	}
+
+	sessions, err := auth.ListSessions(laptop.User.ID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %+v %v", sessions, err)
+	}
+	if sessions[0].ID != laptop.SessionID || !sessions[0].LastRefreshedAt.Equal(now) || sessions[1].LastRefreshedAt.Equal(now) {
+		t.Errorf("Expected only the refreshed session to be updated, got %+v", sessions)
+	}
+
+	if err := auth.RevokeSession(laptop.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{laptop.AccessToken, refreshed.AccessToken} {
+		if _, err := auth.ValidateToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Expected access tokens of a revoked session to be revoked, got %v", err)
+		}
+	}
+	for _, token := range []string{laptop.RefreshToken, refreshed.RefreshToken} {
+		if _, err := auth.RefreshToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Expected refresh tokens of a revoked session to fail, got %v", err)
+		}
+	}
+	if _, err := auth.ValidateToken(phone.AccessToken); err != nil {
+		t.Errorf("Expected other sessions to be unaffected, got %v", err)
+	}
+	if err := auth.RevokeSession(laptop.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := auth.RevokeToken(phone.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := auth.ListSessions(laptop.User.ID); len(sessions) != 0 {
+		t.Errorf("Expected revoking the refresh token to end its session, got %+v", sessions)
+	}
+	if _, err := auth.ValidateToken(phone.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected logging out to revoke the session's access token, got %v", err)
+	}
+
+	if _, err := auth.ListSessions("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestSessionsEndWithTokenVersion(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "version@example.com")
+
+	if err := auth.RevokeAllUserTokens(tokens.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := auth.ListSessions(tokens.User.ID); len(sessions) != 0 {
+		t.Errorf("Expected RevokeAllUserTokens to end every session, got %+v", sessions)
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "owner@example.com", Password: "password123", Name: "Owner"})
+	other := loginTestUser(t, auth, "other@example.com")
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.GET("/sessions", auth.GinMiddleware(), auth.ListSessionsHandler)
+	r.DELETE("/sessions/:id", auth.GinMiddleware(), auth.RevokeSessionHandler)
+	r.GET("/admin/users/:id/sessions", auth.AdminListSessionsHandler)
+	r.DELETE("/admin/sessions/:id", auth.AdminRevokeSessionHandler)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "session-test/1.0")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/login", "", `{"email":"owner@example.com","password":"password123"}`)
+	var tokens TokenResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	if w.Code != http.StatusOK || tokens.SessionID == "" {
+		t.Fatalf("Expected a login with a session, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/sessions", tokens.AccessToken, "")
+	var listed struct {
+		Sessions []Session `json:"sessions"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &listed)
+	if w.Code != http.StatusOK || len(listed.Sessions) != 1 ||
+		listed.Sessions[0].UserAgent != "session-test/1.0" || listed.Sessions[0].IP == "" {
+		t.Fatalf("Expected the session with its client, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodDelete, "/sessions/"+other.SessionID, tokens.AccessToken, "")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), CodeSessionNotFound) {
+		t.Errorf("Expected 404 for another user's session, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/admin/users/"+other.User.ID+"/sessions", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), other.SessionID) {
+		t.Errorf("Expected the admin to list the session, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodDelete, "/admin/sessions/"+other.SessionID, "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the admin to revoke the session, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodDelete, "/sessions/"+tokens.SessionID, tokens.AccessToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the session to be revoked, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/sessions", tokens.AccessToken, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked session's token to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	app := fiber.New()
+	app.Get("/sessions", auth.FiberMiddleware(), auth.ListSessionsHandlerFiber)
+	app.Delete("/sessions/:id", auth.FiberMiddleware(), auth.RevokeSessionHandlerFiber)
+	fiberTokens, _ := auth.LoginUser("owner@example.com", "password123")
+	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+fiberTokens.AccessToken)
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+	req = httptest.NewRequest(http.MethodDelete, "/sessions/"+fiberTokens.SessionID, nil)
+	req.Header.Set("Authorization", "Bearer "+fiberTokens.AccessToken)
+	resp, err = app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected 200 from Fiber, got %v %v", resp, err)
+	}
+}
+
+func TestRefreshAbsoluteLifetime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	auth := newTestKit(t, Config{RefreshAbsoluteLifetime: 30 * 24 * time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "absolute@example.com")
+	deadline := start.Add(30 * 24 * time.Hour)
+	if tokens.ReauthenticateAt == nil || !tokens.ReauthenticateAt.Equal(deadline) {
+		t.Fatalf("Expected re-login to be required at %v, got %v", deadline, tokens.ReauthenticateAt)
+	}
+
+	// Rotating carries the original login time along
+	for day := 6; day < 30; day += 6 {
+		now = start.Add(time.Duration(day) * 24 * time.Hour)
+		refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+		if err != nil {
+			t.Fatalf("Expected day %d to refresh, got %v", day, err)
+		}
+		if !refreshed.ReauthenticateAt.Equal(deadline) {
+			t.Errorf("Expected the deadline to stay at %v, got %v", deadline, refreshed.ReauthenticateAt)
+		}
+		tokens = refreshed
+	}
+	sessions, _ := auth.ListSessions(tokens.User.ID)
+	if len(sessions) != 1 || !sessions[0].ExpiresAt.Equal(deadline) {
+		t.Errorf("Expected the session to end at the deadline, got %+v", sessions)
+	}
+
+	now = deadline
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("Expected ErrSessionExpired past the absolute lifetime, got %v", err)
+	}
+
+	// The handlers answer with a code telling clients to log in again
+	r := gin.New()
+	r.POST("/refresh", auth.RefreshHandler)
+	req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refresh_token":"`+tokens.RefreshToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeSessionExpired) {
+		t.Errorf("Expected 401 %s, got %d: %s", CodeSessionExpired, w.Code, w.Body.String())
+	}
+}
+
+func TestRefreshIdleTimeout(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	auth := newTestKit(t, Config{RefreshExpiry: "30d", RefreshIdleTimeout: 7 * 24 * time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+
+	tokens := loginTestUser(t, auth, "idle@example.com")
+	if tokens.ReauthenticateAt != nil {
+		t.Errorf("Expected no re-login deadline without an absolute lifetime, got %v", tokens.ReauthenticateAt)
+	}
+
+	now = start.Add(6 * 24 * time.Hour)
+	refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected a refresh within the idle timeout, got %v", err)
+	}
+
+	// The idle timeout runs from the last refresh
+	now = start.Add(12 * 24 * time.Hour)
+	if _, err := auth.RefreshToken(refreshed.RefreshToken); err != nil {
+		t.Fatalf("Expected the rotated token to be fresh, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrSessionIdle) {
+		t.Errorf("Expected ErrSessionIdle for a token unused for 12 days, got %v", err)
+	}
+	if ErrorCode(ErrSessionIdle) != CodeSessionIdle || ErrorCode(ErrSessionExpired) != CodeSessionExpired {
+		t.Error("Expected distinct codes for idle and expired sessions")
+	}
+}
@@ -0,0 +1,270 @@
+package authkit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultMaxTokenSize keeps tokens well inside common proxy header limits
+const defaultMaxTokenSize = 8192
+
+// maxPreviousJWTSecrets caps Config.PreviousJWTSecrets; each one costs an extra
+// HMAC verification for tokens signed with an unknown secret
+const maxPreviousJWTSecrets = 5
+
+// Supported values for Config.SigningMethod
+const (
+	SigningMethodHS256 = "HS256"
+	SigningMethodRS256 = "RS256"
+	SigningMethodRS512 = "RS512"
+	SigningMethodES256 = "ES256"
+	SigningMethodEdDSA = "EdDSA"
+)
+
+// verificationKey is a key tokens may be verified against, identified by kid
+type verificationKey struct {
+	kid string
+	key interface{}
+}
+
+// keyring holds the current signing key and every key still accepted for verification
+type keyring struct {
+	method     jwt.SigningMethod
+	mutex      sync.RWMutex
+	signingKey interface{} // nil when the instance can only validate
+	signingKID string
+	keys       []verificationKey // current key first
+	secrets    SecretProvider    // Set for HS256 instead of signingKey and keys
+}
+
+// newKeyring resolves the configured signing method and parses its keys
+func newKeyring(config Config) (*keyring, error) {
+	switch config.SigningMethod {
+	case "", SigningMethodHS256:
+		// Previous secrets only verify, so rotation doesn't log everyone out
+		return &keyring{method: jwt.SigningMethodHS256, secrets: config.SecretProvider}, nil
+	case SigningMethodRS256, SigningMethodRS512, SigningMethodES256, SigningMethodEdDSA:
+	default:
+		return nil, fmt.Errorf("%w: unsupported SigningMethod %q", ErrInvalidConfig, config.SigningMethod)
+	}
+
+	if config.PrivateKeyPEM == "" && config.PublicKeyPEM == "" {
+		return nil, fmt.Errorf("%w: %s requires PrivateKeyPEM or PublicKeyPEM", ErrInvalidConfig, config.SigningMethod)
+	}
+
+	k := &keyring{method: jwt.GetSigningMethod(config.SigningMethod)}
+
+	var public interface{}
+	if config.PrivateKeyPEM != "" {
+		private, err := parsePrivateKey(config.SigningMethod, []byte(config.PrivateKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid PrivateKeyPEM: %v", ErrInvalidConfig, err)
+		}
+		k.signingKey = private
+		public = private.(crypto.Signer).Public()
+	}
+	if config.PublicKeyPEM != "" {
+		key, err := parsePublicKey(config.SigningMethod, []byte(config.PublicKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid PublicKeyPEM: %v", ErrInvalidConfig, err)
+		}
+		public = key
+	}
+	if err := k.addPublicKey(public, true); err != nil {
+		return nil, err
+	}
+
+	for i, pemKey := range config.VerificationKeysPEM {
+		key, err := parsePublicKey(config.SigningMethod, []byte(pemKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid VerificationKeysPEM[%d]: %v", ErrInvalidConfig, i, err)
+		}
+		if err := k.addPublicKey(key, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// addPublicKey registers a verification key, making it current if requested.
+// The caller must hold the write lock once the keyring is shared.
+func (k *keyring) addPublicKey(public interface{}, current bool) error {
+	if k.method.Alg() == SigningMethodES256 {
+		if key, ok := public.(*ecdsa.PublicKey); !ok || key.Curve.Params().BitSize != 256 {
+			return fmt.Errorf("%w: ES256 requires a P-256 key", ErrInvalidConfig)
+		}
+	}
+
+	kid, err := keyID(public)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// Drop an existing entry for the same key so it isn't listed twice
+	keys := make([]verificationKey, 0, len(k.keys)+1)
+	for _, existing := range k.keys {
+		if existing.kid != kid {
+			keys = append(keys, existing)
+		}
+	}
+
+	entry := verificationKey{kid: kid, key: public}
+	if current {
+		k.signingKID = kid
+		k.keys = append([]verificationKey{entry}, keys...)
+	} else {
+		k.keys = append(keys, entry)
+	}
+	return nil
+}
+
+// parsePrivateKey parses a PEM private key of the type the method expects
+func parsePrivateKey(method string, data []byte) (interface{}, error) {
+	switch method {
+	case SigningMethodRS256, SigningMethodRS512:
+		return jwt.ParseRSAPrivateKeyFromPEM(data)
+	case SigningMethodES256:
+		return jwt.ParseECPrivateKeyFromPEM(data)
+	default:
+		return jwt.ParseEdPrivateKeyFromPEM(data)
+	}
+}
+
+// parsePublicKey parses a PEM public key of the type the method expects
+func parsePublicKey(method string, data []byte) (interface{}, error) {
+	switch method {
+	case SigningMethodRS256, SigningMethodRS512:
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	case SigningMethodES256:
+		return jwt.ParseECPublicKeyFromPEM(data)
+	default:
+		return jwt.ParseEdPublicKeyFromPEM(data)
+	}
+}
+
+// RotateSigningKey makes privateKeyPEM the key new tokens are signed with.
+// Previous public keys stay valid for verification (and in the JWKS) until
+// removed with RemoveVerificationKey. Only supported for asymmetric methods.
+func (a *AuthKit) RotateSigningKey(privateKeyPEM string) error {
+	k := a.keys
+	if _, ok := k.method.(*jwt.SigningMethodHMAC); ok {
+		return fmt.Errorf("%w: key rotation requires an asymmetric SigningMethod", ErrInvalidConfig)
+	}
+
+	private, err := parsePrivateKey(k.method.Alg(), []byte(privateKeyPEM))
+	if err != nil {
+		return fmt.Errorf("%w: invalid private key: %v", ErrInvalidConfig, err)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.addPublicKey(private.(crypto.Signer).Public(), true); err != nil {
+		return err
+	}
+	k.signingKey = private
+	return nil
+}
+
+// RemoveVerificationKey stops accepting tokens signed by the key with the given
+// kid. The current signing key cannot be removed.
+func (a *AuthKit) RemoveVerificationKey(kid string) error {
+	k := a.keys
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if kid == k.signingKID {
+		return fmt.Errorf("%w: cannot remove the current signing key", ErrInvalidConfig)
+	}
+	for i, key := range k.keys {
+		if key.kid == kid {
+			k.keys = append(k.keys[:i:i], k.keys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// signToken signs claims with the current key, stamping its kid in the header
+func (a *AuthKit) signToken(claims jwt.Claims) (string, error) {
+	k := a.keys
+	k.mutex.RLock()
+	signingKey, kid := k.signingKey, k.signingKID
+	k.mutex.RUnlock()
+	if k.secrets != nil {
+		if secret := k.secrets.CurrentSecret(); len(secret) > 0 {
+			signingKey = secret
+		}
+	}
+
+	if signingKey == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", err
+	}
+	if len(signed) > a.config.MaxTokenSize {
+		return "", fmt.Errorf("%w: %d bytes exceeds MaxTokenSize of %d", ErrTokenTooLarge, len(signed), a.config.MaxTokenSize)
+	}
+	return signed, nil
+}
+
+// keyFunc returns the verification key, rejecting tokens whose alg differs from
+// the configured method so a public key can never be used as an HMAC secret.
+// Tokens with a kid are checked against that key only; tokens without one
+// (HS256, or issued before kids were added) against the current key, falling
+// back to previous HS256 secrets.
+func (a *AuthKit) keyFunc(token *jwt.Token) (interface{}, error) {
+	if a.remoteKeys != nil {
+		if !validRemoteMethod(token.Method) {
+			return nil, ErrInvalidToken
+		}
+		return a.remoteKeys.keyFunc(token)
+	}
+
+	k := a.keys
+	if token.Method == nil || token.Method.Alg() != k.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+
+	if k.secrets != nil {
+		secrets := k.secrets.AllSecrets()
+		switch len(secrets) {
+		case 0:
+			return nil, ErrInvalidToken
+		case 1:
+			return secrets[0], nil
+		}
+		set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(secrets))}
+		for _, secret := range secrets {
+			set.Keys = append(set.Keys, secret)
+		}
+		return set, nil
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return k.keys[0].key, nil
+	}
+	for _, key := range k.keys {
+		if key.kid == kid {
+			return key.key, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
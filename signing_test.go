@@ -0,0 +1,204 @@
+package authkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeyPair generates a PEM encoded key pair for the signing method
+func testKeyPair(t *testing.T, method string) (privatePEM, publicPEM string) {
+	t.Helper()
+
+	var private, public interface{}
+	switch method {
+	case SigningMethodRS256, SigningMethodRS512:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, public = key, &key.PublicKey
+	case SigningMethodES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, public = key, &key.PublicKey
+	case SigningMethodEdDSA:
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, public = key, pub
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	for _, method := range []string{SigningMethodRS256, SigningMethodRS512, SigningMethodES256, SigningMethodEdDSA} {
+		t.Run(method, func(t *testing.T) {
+			privatePEM, publicPEM := testKeyPair(t, method)
+
+			issuer := New(Config{SigningMethod: method, PrivateKeyPEM: privatePEM, BCryptCost: 4})
+			verifier := New(Config{SigningMethod: method, PublicKeyPEM: publicPEM, BCryptCost: 4})
+
+			user := &User{ID: "user-1", Email: "asym@example.com", Role: "user"}
+			access, err := issuer.GenerateAccessToken(user)
+			if err != nil {
+				t.Fatalf("Expected token generation, got %v", err)
+			}
+
+			token, _, _ := jwt.NewParser().ParseUnverified(access, &Claims{})
+			if token.Method.Alg() != method {
+				t.Errorf("Expected alg %s, got %s", method, token.Method.Alg())
+			}
+
+			claims, err := verifier.ValidateToken(access)
+			if err != nil {
+				t.Fatalf("Expected public-key-only instance to validate, got %v", err)
+			}
+			if claims.UserID != user.ID {
+				t.Errorf("Expected user ID %s, got %s", user.ID, claims.UserID)
+			}
+
+			custom, _ := issuer.GenerateCustomToken("custom", nil, time.Hour)
+			if _, err := verifier.ValidateToken(custom); err != nil {
+				t.Errorf("Expected custom token to validate, got %v", err)
+			}
+
+			if _, err := verifier.GenerateAccessToken(user); !errors.Is(err, ErrNoSigningKey) {
+				t.Errorf("Expected ErrNoSigningKey without a private key, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSigningAlgorithmConfusion(t *testing.T) {
+	_, publicPEM := testKeyPair(t, SigningMethodRS256)
+	verifier := New(Config{SigningMethod: SigningMethodRS256, PublicKeyPEM: publicPEM})
+
+	// An HS256 token "signed" with the public key must not pass as RS256
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: "attacker",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    defaultIssuer,
+			Audience:  []string{defaultAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(publicPEM))
+	if _, err := verifier.ValidateToken(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for HS256 token, got %v", err)
+	}
+
+	// HS256 stays the default and rejects RS256 tokens
+	privatePEM, _ := testKeyPair(t, SigningMethodRS256)
+	rsa := New(Config{SigningMethod: SigningMethodRS256, PrivateKeyPEM: privatePEM})
+	hmac := newTestKit(t, Config{})
+	token, _ := rsa.GenerateCustomToken("user", nil, time.Hour)
+	if _, err := hmac.ValidateToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for RS256 token on HS256 instance, got %v", err)
+	}
+}
+
+func TestSigningConfigValidation(t *testing.T) {
+	_, rsaPublic := testKeyPair(t, SigningMethodRS256)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&p384.PublicKey)
+	p384PEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	for name, config := range map[string]Config{
+		"unknown method": {SigningMethod: "none"},
+		"missing keys":   {SigningMethod: SigningMethodRS256},
+		"wrong key type": {SigningMethod: SigningMethodES256, PublicKeyPEM: rsaPublic},
+		"wrong curve":    {SigningMethod: SigningMethodES256, PublicKeyPEM: p384PEM},
+		"garbage":        {SigningMethod: SigningMethodEdDSA, PrivateKeyPEM: "not a key"},
+	} {
+		if _, err := NewValidated(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestJWTSecretWithKeyPair(t *testing.T) {
+	rsaPrivate, rsaPublic := testKeyPair(t, SigningMethodRS256)
+
+	for name, config := range map[string]Config{
+		"asymmetric method": {JWTSecret: "secret", SigningMethod: SigningMethodRS256, PrivateKeyPEM: rsaPrivate},
+		"private key":       {JWTSecret: "secret", PrivateKeyPEM: rsaPrivate},
+		"public key":        {JWTSecret: "secret", SigningMethod: SigningMethodHS256, PublicKeyPEM: rsaPublic},
+	} {
+		if err := config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected Validate to return ErrInvalidConfig, got %v", name, err)
+		}
+		if _, err := NewValidated(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected New to panic on a JWTSecret with an asymmetric key")
+		}
+	}()
+	New(Config{JWTSecret: "secret", SigningMethod: SigningMethodRS256, PrivateKeyPEM: rsaPrivate})
+}
+
+func TestPreviousJWTSecrets(t *testing.T) {
+	old := New(Config{JWTSecret: "old-secret", BCryptCost: 4})
+	tokens := loginTestUser(t, old, "rotate@example.com")
+	oldCustom, _ := old.GenerateCustomToken("custom", nil, time.Hour)
+	oldExpired, _ := old.GenerateCustomToken("custom", nil, -time.Hour)
+
+	rotated := New(Config{JWTSecret: "new-secret", PreviousJWTSecrets: []string{"older-secret", "old-secret"}, BCryptCost: 4})
+	if _, err := rotated.ValidateToken(oldCustom); err != nil {
+		t.Errorf("Expected token signed with a previous secret to validate, got %v", err)
+	}
+	if _, err := rotated.ValidateToken(oldExpired); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected expiry to be enforced for previous secrets, got %v", err)
+	}
+
+	// New tokens are signed with the current secret only
+	fresh, _ := rotated.GenerateCustomToken("custom", nil, time.Hour)
+	if _, err := old.ValidateToken(fresh); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected new token to be signed with the new secret, got %v", err)
+	}
+
+	// Refresh tokens need their user and session in the store, so rotate the original instance's view
+	rotated.users = old.users
+	rotated.sessions = old.sessions
+	if _, err := rotated.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Errorf("Expected refresh token signed with a previous secret to work, got %v", err)
+	}
+
+	unknown := New(Config{JWTSecret: "new-secret", PreviousJWTSecrets: []string{"other-secret"}})
+	if _, err := unknown.ValidateToken(oldCustom); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an unknown secret, got %v", err)
+	}
+
+	tooMany := Config{JWTSecret: "s", PreviousJWTSecrets: []string{"1", "2", "3", "4", "5", "6"}}
+	if _, err := NewValidated(tooMany); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for more than %d previous secrets, got %v", maxPreviousJWTSecrets, err)
+	}
+	if _, err := NewValidated(Config{JWTSecret: "s", PreviousJWTSecrets: []string{""}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an empty previous secret, got %v", err)
+	}
+}
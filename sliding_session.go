@@ -0,0 +1,117 @@
+package authkit
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultRefreshedTokenHeader is the default SlidingSession.Header
+const defaultRefreshedTokenHeader = "X-Refreshed-Token"
+
+// SlidingSession makes the middlewares renew access tokens close to expiry,
+// so active clients aren't logged out without calling the refresh endpoint.
+// The renewed token is sent in the access token cookie when the request was
+// authenticated by cookie, and in the Header response header otherwise. Only
+// tokens of a session are renewed, and the session's revocation and the
+// user's token version are checked first.
+type SlidingSession struct {
+	// Window is the final fraction of an access token's lifetime in which
+	// it is renewed (default: 0.2)
+	Window float64
+	// MaxLifetime is the absolute session lifetime: renewed tokens never
+	// last past this long after the login, nor past
+	// Config.RefreshAbsoluteLifetime (default: RefreshExpiry)
+	MaxLifetime time.Duration
+	// Header is the response header carrying renewed tokens (default:
+	// "X-Refreshed-Token"). Browsers only let scripts read it from
+	// cross-origin responses listing it in Access-Control-Expose-Headers.
+	Header string
+}
+
+// withDefaults returns a copy of the sliding session config with defaults
+// filled in, capping sessions at maxLifetime unless set
+func (s SlidingSession) withDefaults(maxLifetime time.Duration) *SlidingSession {
+	if s.Window == 0 {
+		s.Window = 0.2
+	}
+	if s.MaxLifetime == 0 {
+		s.MaxLifetime = maxLifetime
+	}
+	if s.Header == "" {
+		s.Header = defaultRefreshedTokenHeader
+	}
+	return &s
+}
+
+// validate checks the sliding session config for values that cannot be used
+func (s *SlidingSession) validate() error {
+	if s.Window < 0 || s.Window > 1 {
+		return fmt.Errorf("%w: SlidingSession.Window %v is outside 0 to 1", ErrInvalidConfig, s.Window)
+	}
+	if s.MaxLifetime < 0 {
+		return fmt.Errorf("%w: negative SlidingSession.MaxLifetime", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// renewedToken is an access token issued by the middlewares in place of one
+// close to expiry
+type renewedToken struct {
+	token    string
+	lifetime time.Duration
+}
+
+// renewAccessToken returns a fresh access token for the validated claims if
+// sliding sessions are enabled and the token is in its renewal window. It
+// returns nil when there is nothing to renew, including once the session has
+// reached SlidingSession.MaxLifetime.
+func (a *AuthKit) renewAccessToken(claims *Claims) *renewedToken {
+	cfg := a.config.SlidingSession
+	if cfg == nil || claims.SessionID == "" || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil
+	}
+
+	now := a.now()
+	expiresAt := claims.ExpiresAt.Time
+	lifetime := expiresAt.Sub(claims.IssuedAt.Time)
+	if expiresAt.Sub(now) > time.Duration(float64(lifetime)*cfg.Window) {
+		return nil
+	}
+
+	// Ended sessions aren't renewed, nor extended past the absolute lifetime
+	a.mutex.RLock()
+	record, exists := a.sessions[claims.SessionID]
+	var renewedUntil time.Time
+	if exists && now.Before(record.ExpiresAt) {
+		renewedUntil = now.Add(a.clampLifetimes(record.lifetimes).access)
+		if deadline := record.CreatedAt.Add(cfg.MaxLifetime); renewedUntil.After(deadline) {
+			renewedUntil = deadline
+		}
+		renewedUntil = a.sessionEnd(record.CreatedAt, renewedUntil)
+	}
+	a.mutex.RUnlock()
+	if !renewedUntil.After(expiresAt) {
+		return nil
+	}
+
+	// Validation checked revocation and the token version; the user is
+	// checked as stored now, as the token may have been a cached one
+	user, err := a.GetUserByID(claims.UserID)
+	if err != nil || user.TokenVersion != claims.TokenVersion || user.Disabled || user.PurgeAt != nil || user.DeletedAt != nil {
+		return nil
+	}
+
+	token, err := a.accessToken(user, claims.AMR, claims.SessionID, renewedUntil.Sub(now))
+	if err != nil {
+		a.config.Logger.Warn("renewing access token failed", "session_id", claims.SessionID, "error", err)
+		return nil
+	}
+	return &renewedToken{token: token, lifetime: renewedUntil.Sub(now)}
+}
+
+// renewalCookie returns the access token cookie delivering a renewed token to
+// a client authenticated by cookie
+func (a *AuthKit) renewalCookie(renewed *renewedToken) *http.Cookie {
+	return a.cookie(a.config.CookieConfig.AccessTokenName, renewed.token, int(renewed.lifetime.Seconds()), true)
+}
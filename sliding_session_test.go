@@ -0,0 +1,176 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// protectedHandlers returns a protected endpoint behind each middleware
+func protectedHandlers(auth *AuthKit) map[string]http.Handler {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	r := gin.New()
+	r.Any("/me", auth.GinMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	app := fiber.New()
+	app.All("/me", auth.FiberMiddleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  auth.HTTPMiddleware(ok),
+	}
+}
+
+func TestSlidingSession(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	auth := newTestKit(t, Config{TokenExpiry: "10m", SlidingSession: &SlidingSession{MaxLifetime: 30 * time.Minute}, Clock: testClock(&now)})
+	defer auth.Close()
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "sliding@example.com", Password: "password123", Name: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, handler := range protectedHandlers(auth) {
+		t.Run(name, func(t *testing.T) {
+			now = start
+			tokens, err := auth.LoginUser("sliding@example.com", "password123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			get := func(token string) string {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+				}
+				return w.Header().Get(defaultRefreshedTokenHeader)
+			}
+
+			now = start.Add(time.Minute)
+			if renewed := get(tokens.AccessToken); renewed != "" {
+				t.Errorf("Expected no renewal outside the window, got %q", renewed)
+			}
+
+			// Renewed in the last 20% of the lifetime, up to 30 minutes after login
+			token := tokens.AccessToken
+			for _, step := range []struct {
+				at, expiresIn time.Duration
+			}{
+				{9 * time.Minute, 10 * time.Minute},
+				{18 * time.Minute, 10 * time.Minute},
+				{27 * time.Minute, 3 * time.Minute},
+			} {
+				now = start.Add(step.at)
+				renewed := get(token)
+				if renewed == "" {
+					t.Fatalf("Expected a renewed token at %v", step.at)
+				}
+				claims, err := auth.ValidateToken(renewed)
+				if err != nil || claims.SessionID != tokens.SessionID {
+					t.Fatalf("Expected a valid token in the session, got %+v %v", claims, err)
+				}
+				if d := claims.ExpiresAt.Sub(now); d != step.expiresIn {
+					t.Errorf("Expected the token renewed at %v to last %v, got %v", step.at, step.expiresIn, d)
+				}
+				token = renewed
+			}
+
+			now = start.Add(29 * time.Minute)
+			if renewed := get(token); renewed != "" {
+				t.Errorf("Expected no renewal past the absolute lifetime, got %q", renewed)
+			}
+		})
+	}
+}
+
+func TestSlidingSessionChecks(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	auth := newTestKit(t, Config{TokenExpiry: "10m", SlidingSession: &SlidingSession{},
+		CookieConfig: &CookieConfig{Insecure: true}, Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "sliding-checks@example.com")
+	handler := protectedHandlers(auth)["http"]
+
+	// Clients authenticated by cookie get the cookie rotated instead
+	now = start.Add(9 * time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(&http.Cookie{Name: defaultAccessTokenCookie, Value: tokens.AccessToken})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	cookies := w.Result().Cookies()
+	if w.Header().Get(defaultRefreshedTokenHeader) != "" || len(cookies) != 1 || cookies[0].Name != defaultAccessTokenCookie || cookies[0].MaxAge != 600 {
+		t.Fatalf("Expected a rotated access token cookie, got %v", cookies)
+	}
+	if _, err := auth.ValidateToken(cookies[0].Value); err != nil {
+		t.Errorf("Expected the rotated cookie to hold a valid token, got %v", err)
+	}
+
+	// A revoked session isn't renewed, even for claims validated before
+	if auth.renewAccessToken(mustValidate(t, auth, tokens.AccessToken)) == nil {
+		t.Fatal("Expected the token to be renewable")
+	}
+	claims := mustValidate(t, auth, tokens.AccessToken)
+	if err := auth.RevokeSession(tokens.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := auth.renewAccessToken(claims); renewed != nil {
+		t.Error("Expected no renewal for a revoked session")
+	}
+
+	// Nor are tokens predating a token version bump
+	other, _ := auth.LoginUser("sliding-checks@example.com", "password123")
+	now = now.Add(9 * time.Minute)
+	claims = mustValidate(t, auth, other.AccessToken)
+	if err := auth.RevokeAllUserTokens(other.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := auth.renewAccessToken(claims); renewed != nil {
+		t.Error("Expected no renewal after the token version changed")
+	}
+}
+
+func TestSlidingSessionOffByDefault(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth := newTestKit(t, Config{TokenExpiry: "10m", Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "sliding-off@example.com")
+
+	now = now.Add(9 * time.Minute)
+	for name, handler := range protectedHandlers(auth) {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get(defaultRefreshedTokenHeader) != "" {
+			t.Errorf("%s: expected 200 without renewal, got %d %v", name, w.Code, w.Header())
+		}
+	}
+}
+
+func TestSlidingSessionConfig(t *testing.T) {
+	for _, s := range []SlidingSession{{Window: 1.5}, {Window: -0.1}, {MaxLifetime: -time.Hour}} {
+		config := Config{JWTSecret: "test-secret-key-for-testing-only", SlidingSession: &s}
+		if err := config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", s, err)
+		}
+	}
+}
+
+// mustValidate validates a token the test expects to be valid
+func mustValidate(t *testing.T, auth *AuthKit, token string) *Claims {
+	t.Helper()
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	return claims
+}
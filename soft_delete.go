@@ -0,0 +1,65 @@
+package authkit
+
+// RestoreUser brings back a user soft-deleted under Config.SoftDelete. It
+// returns ErrUserNotDeleted for users that aren't deleted, and
+// ErrUserAlreadyExists if the email was registered again in the meantime
+// (see Config.ReuseDeletedEmails).
+func (a *AuthKit) RestoreUser(userID string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.users.get(userID)
+	if !exists {
+		return ErrUserNotFound
+	}
+	if stored.DeletedAt == nil {
+		return ErrUserNotDeleted
+	}
+	if a.emailTaken(stored.TenantID, stored.Email, stored.ID) {
+		return ErrUserAlreadyExists
+	}
+
+	user := cloneUser(stored)
+	user.DeletedAt = nil
+	user.PurgeAt = nil
+	user.UpdatedAt = a.now()
+	a.users.put(user)
+	return nil
+}
+
+// PurgeUser permanently removes a user, whether or not they were soft-deleted
+func (a *AuthKit) PurgeUser(userID string) error {
+	a.debugCheck()
+
+	a.mutex.Lock()
+	if _, exists := a.users.get(userID); !exists {
+		a.mutex.Unlock()
+		return ErrUserNotFound
+	}
+	a.users.delete(userID)
+	a.deleteUserSessions(userID)
+	a.mutex.Unlock()
+
+	_ = a.config.LoginHistoryStore.Delete(userID)
+	a.audit(AuditEvent{Type: AuditUserPurged, UserID: userID})
+	return nil
+}
+
+// removeUser deletes a user, or with Config.SoftDelete marks them deleted.
+// Either way their sessions end. Callers must hold a.mutex for writing.
+func (a *AuthKit) removeUser(user *User) {
+	a.deleteUserSessions(user.ID)
+	if !a.config.SoftDelete {
+		a.users.delete(user.ID)
+		_ = a.config.LoginHistoryStore.Delete(user.ID)
+		return
+	}
+
+	now := a.now()
+	user = cloneUser(user)
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	a.users.put(user)
+}
@@ -0,0 +1,125 @@
+package authkit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	auth := newTestKit(t, Config{SoftDelete: true})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "soft@example.com")
+	userID := tokens.User.ID
+
+	if err := auth.DeleteUser(userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.DeleteUser(userID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected deleting twice to fail with ErrUserNotFound, got %v", err)
+	}
+
+	user, err := auth.GetUserByID(userID)
+	if err != nil || user.DeletedAt == nil {
+		t.Fatalf("Expected the record to be kept with DeletedAt, got %+v %v", user, err)
+	}
+	if _, err := auth.GetUserByEmail("soft@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected GetUserByEmail to skip deleted users, got %v", err)
+	}
+	if _, err := auth.LoginUser("soft@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials on login, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err == nil {
+		t.Error("Expected refreshing a deleted user's token to fail")
+	}
+	if _, err := auth.IssueTokensForUser(userID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound from IssueTokensForUser, got %v", err)
+	}
+	if users := auth.ListUsers(); len(users) != 0 {
+		t.Errorf("Expected ListUsers to leave out deleted users, got %+v", users)
+	}
+	if deleted := auth.ListUsersByStatus(UserStatusDeleted); len(deleted) != 1 || deleted[0].DeletedAt == nil {
+		t.Errorf("Expected the deleted user, got %+v", deleted)
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "soft@example.com", Password: "password123", Name: "Again"}); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected the email to stay taken, got %v", err)
+	}
+
+	if err := auth.RestoreUser(userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RestoreUser(userID); !errors.Is(err, ErrUserNotDeleted) {
+		t.Errorf("Expected ErrUserNotDeleted, got %v", err)
+	}
+	if _, err := auth.LoginUser("soft@example.com", "password123"); err != nil {
+		t.Errorf("Expected login after RestoreUser, got %v", err)
+	}
+
+	if err := auth.PurgeUser(userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.GetUserByID(userID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the record to be gone after PurgeUser, got %v", err)
+	}
+	if err := auth.PurgeUser(userID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestSoftDeleteReuseEmail(t *testing.T) {
+	auth := newTestKit(t, Config{SoftDelete: true, ReuseDeletedEmails: true})
+	defer auth.Close()
+	old := loginTestUser(t, auth, "reuse@example.com").User
+
+	_ = auth.DeleteUser(old.ID)
+	replacement, err := auth.RegisterUser(RegisterRequest{Email: "reuse@example.com", Password: "password123", Name: "New"})
+	if err != nil {
+		t.Fatalf("Expected the email to be reusable, got %v", err)
+	}
+	if found, _ := auth.GetUserByEmail("reuse@example.com"); found == nil || found.ID != replacement.ID {
+		t.Errorf("Expected the email to find the new user, got %+v", found)
+	}
+	if err := auth.RestoreUser(old.ID); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected restoring the orphaned record to conflict, got %v", err)
+	}
+}
+
+func TestSoftDeleteCheckUserOnRequest(t *testing.T) {
+	auth := newTestKit(t, Config{SoftDelete: true, CheckUserOnRequest: true})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "checked@example.com")
+
+	_ = auth.DeleteUser(tokens.User.ID)
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a deleted user, got %v", err)
+	}
+	_ = auth.RestoreUser(tokens.User.ID)
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the token to work after RestoreUser, got %v", err)
+	}
+}
+
+func TestSoftDeleteGracePeriod(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{SoftDelete: true, DeletionGracePeriod: time.Hour, Clock: testClock(&now)})
+	defer auth.Close()
+	userID := loginTestUser(t, auth, "grace@example.com").User.ID
+
+	_ = auth.DeleteAccount(userID)
+	now = now.Add(2 * time.Hour)
+	if purged := auth.PurgeExpiredAccounts(); purged != 1 {
+		t.Fatalf("Expected one purged account, got %d", purged)
+	}
+	if purged := auth.PurgeExpiredAccounts(); purged != 0 {
+		t.Errorf("Expected soft-deleted accounts not to be purged again, got %d", purged)
+	}
+	if user, err := auth.GetUserByID(userID); err != nil || user.DeletedAt == nil {
+		t.Errorf("Expected the purge to soft delete, got %+v %v", user, err)
+	}
+	if err := auth.RestoreUser(userID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := auth.GetUserByID(userID); user.PurgeAt != nil {
+		t.Errorf("Expected RestoreUser to clear the pending deletion, got %v", user.PurgeAt)
+	}
+}
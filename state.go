@@ -0,0 +1,142 @@
+package authkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// stateVersion is the format version SaveState writes and LoadState accepts
+const stateVersion = 1
+
+// savedState is the document written by SaveState
+type savedState struct {
+	Version  int                 `json:"version"`
+	Users    []savedUser         `json:"users"`
+	Sessions []savedSession      `json:"sessions"`
+	Roles    map[string][]string `json:"roles,omitempty"`
+}
+
+// userFields is User without its MarshalJSON, which leaves out the hash
+type userFields User
+
+// savedUser is a user with its password hash
+type savedUser struct {
+	userFields
+	Password string `json:"password"`
+}
+
+// savedSession is a session with the tokens issued for it
+type savedSession struct {
+	Session
+	Tokens map[string]time.Time `json:"tokens,omitempty"`
+	// AccessExpiry and RefreshExpiry are the token lifetimes chosen at
+	// login; states saved before they were recorded get the defaults
+	AccessExpiry  time.Duration `json:"access_expiry,omitempty"`
+	RefreshExpiry time.Duration `json:"refresh_expiry,omitempty"`
+	// Scope is LoginOptions.Scope, null when unrestricted
+	Scope []string `json:"scope"`
+}
+
+// SaveState writes the users, including password hashes and soft-deleted
+// users, their active sessions and the defined roles as JSON, for LoadState
+// to restore in another process. Service accounts, revoked tokens and the
+// other stores are not included. Treat the output like the user store itself.
+func (a *AuthKit) SaveState(w io.Writer) error {
+	a.debugCheck()
+
+	a.mutex.RLock()
+	state := savedState{Version: stateVersion, Users: []savedUser{}, Sessions: []savedSession{}, Roles: make(map[string][]string)}
+	for _, user := range a.users.all() {
+		saved := userFields(*cloneUser(user))
+		state.Users = append(state.Users, savedUser{userFields: saved, Password: user.Password})
+	}
+	now := a.now()
+	for _, record := range a.sessions {
+		if !now.Before(record.ExpiresAt) {
+			continue
+		}
+		tokens := make(map[string]time.Time, len(record.tokens))
+		for jti, expiresAt := range record.tokens {
+			tokens[jti] = expiresAt
+		}
+		state.Sessions = append(state.Sessions, savedSession{Session: record.Session, Tokens: tokens,
+			AccessExpiry: record.lifetimes.access, RefreshExpiry: record.lifetimes.refresh, Scope: copyScope(record.scope)})
+	}
+	for name, permissions := range a.roles {
+		state.Roles[name] = append([]string{}, permissions...)
+	}
+	a.mutex.RUnlock()
+
+	sort.Slice(state.Users, func(i, j int) bool { return state.Users[i].ID < state.Users[j].ID })
+	sort.Slice(state.Sessions, func(i, j int) bool { return state.Sessions[i].ID < state.Sessions[j].ID })
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
+
+// LoadState replaces the users, sessions and roles with those written by
+// SaveState. Nothing is changed if the state can't be read, or if it has
+// users with duplicate IDs, or emails within a tenant.
+func (a *AuthKit) LoadState(r io.Reader) error {
+	a.debugCheck()
+
+	var state savedState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("load state: unsupported version %d", state.Version)
+	}
+
+	users := make([]*User, 0, len(state.Users))
+	ids := make(map[string]bool, len(state.Users))
+	emails := make(map[[2]string]bool, len(state.Users)) // Keyed by tenant and email
+	for _, saved := range state.Users {
+		user := User(saved.userFields)
+		user.Password = saved.Password
+		if user.ID == "" || ids[user.ID] {
+			return fmt.Errorf("load state: missing or duplicate user ID %q", user.ID)
+		}
+		if key := [2]string{user.TenantID, a.emailKey(user.Email)}; user.DeletedAt == nil {
+			if emails[key] {
+				return fmt.Errorf("%w: load state: duplicate email %s", ErrUserAlreadyExists, user.Email)
+			}
+			emails[key] = true
+		}
+		ids[user.ID] = true
+		users = append(users, &user)
+	}
+
+	a.mutex.Lock()
+	for _, user := range a.users.all() {
+		a.users.delete(user.ID)
+	}
+	for _, user := range users {
+		a.users.put(user)
+	}
+	a.sessions = make(map[string]*sessionRecord, len(state.Sessions))
+	for _, saved := range state.Sessions {
+		tokens := saved.Tokens
+		if tokens == nil {
+			tokens = make(map[string]time.Time)
+		}
+		a.sessions[saved.ID] = &sessionRecord{Session: saved.Session, tokens: tokens,
+			lifetimes: tokenLifetimes{access: saved.AccessExpiry, refresh: saved.RefreshExpiry}, scope: saved.Scope}
+	}
+	a.roles = make(map[string][]string, len(state.Roles))
+	for name, permissions := range state.Roles {
+		a.roles[name] = uniqueSorted(permissions)
+	}
+	a.mutex.Unlock()
+
+	if len(state.Sessions) > 0 {
+		a.sessionJanitor.Do(func() {
+			a.startJanitor(func() { a.pruneSessions() })
+		})
+	}
+	return nil
+}
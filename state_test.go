@@ -0,0 +1,73 @@
+package authkit
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	source := newTestKit(t, Config{})
+	defer source.Close()
+	tokens := loginTestUser(t, source, "state@example.com")
+	_ = source.DefineRole("editor", []string{"posts:write"})
+	if err := source.RevokeAllUserTokens(tokens.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := source.LoginUser("state@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"password": "$2a$`) {
+		t.Error("Expected the state to carry the password hash")
+	}
+
+	target := newTestKit(t, Config{})
+	defer target.Close()
+	loginTestUser(t, target, "replaced@example.com")
+	if err := target.LoadState(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := target.GetUserByEmail("replaced@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the previous users to be replaced, got %v", err)
+	}
+	if _, err := target.LoginUser("state@example.com", "password123"); err != nil {
+		t.Errorf("Expected the loaded user to log in, got %v", err)
+	}
+	if _, err := target.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected a token carrying the loaded token version to be valid, got %v", err)
+	}
+	if _, err := target.RefreshToken(tokens.RefreshToken); err != nil {
+		t.Errorf("Expected the loaded session to refresh, got %v", err)
+	}
+	if role, err := target.GetRole("editor"); err != nil || role.Permissions[0] != "posts:write" {
+		t.Errorf("Expected the loaded role, got %v, %v", role, err)
+	}
+}
+
+func TestLoadStateInvalid(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	loginTestUser(t, auth, "kept@example.com")
+
+	for name, state := range map[string]string{
+		"malformed":       `{"version":`,
+		"version":         `{"version":2,"users":[]}`,
+		"duplicate ID":    `{"version":1,"users":[{"id":"1","email":"a@example.com"},{"id":"1","email":"b@example.com"}]}`,
+		"duplicate email": `{"version":1,"users":[{"id":"1","email":"a@example.com"},{"id":"2","email":"A@example.com"}]}`,
+	} {
+		if err := auth.LoadState(strings.NewReader(state)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := auth.GetUserByEmail("kept@example.com"); err != nil {
+		t.Errorf("Expected a failed load to leave the users alone, got %v", err)
+	}
+}
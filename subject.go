@@ -0,0 +1,57 @@
+package authkit
+
+// SubjectByID is the default SubjectMapper, using the user's ID as the "sub" claim
+func SubjectByID(user *User) string {
+	return user.ID
+}
+
+// ResolveSubjectByID is the default SubjectResolver, looking the subject up as a user ID
+func ResolveSubjectByID(a *AuthKit, subject string) (*User, error) {
+	return a.GetUserByID(subject)
+}
+
+// SubjectByEmail is a SubjectMapper using the user's email as the "sub" claim
+func SubjectByEmail(user *User) string {
+	return user.Email
+}
+
+// ResolveSubjectByEmail is the SubjectResolver matching SubjectByEmail
+func ResolveSubjectByEmail(a *AuthKit, subject string) (*User, error) {
+	return a.GetUserByEmail(subject)
+}
+
+// subjectFor maps a user to its token subject and makes sure the subject
+// resolves back to the same user, guarding against empty or colliding subjects
+func (a *AuthKit) subjectFor(user *User) (string, error) {
+	subject := a.config.SubjectMapper(user)
+	if subject == "" {
+		return "", ErrInvalidSubject
+	}
+	if !a.customSubject {
+		return subject, nil
+	}
+
+	resolved, err := a.config.SubjectResolver(a, subject)
+	if err != nil || resolved == nil || resolved.ID != user.ID {
+		return "", ErrInvalidSubject
+	}
+
+	return subject, nil
+}
+
+// resolveSubject maps a token subject back to a user
+func (a *AuthKit) resolveSubject(subject string) (*User, error) {
+	if subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.config.SubjectResolver(a, subject)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
@@ -0,0 +1,99 @@
+package authkit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEmailSubjectRoundTrip(t *testing.T) {
+	auth := New(Config{
+		JWTSecret:       "test-secret",
+		BCryptCost:      4,
+		SubjectMapper:   SubjectByEmail,
+		SubjectResolver: ResolveSubjectByEmail,
+	})
+
+	user, err := auth.RegisterUser(RegisterRequest{Email: "subject@example.com", Password: "password123", Name: "Subject"})
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	tokens, err := auth.LoginUser("subject@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected successful login, got %v", err)
+	}
+
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if claims.Subject != "subject@example.com" {
+		t.Errorf("Expected email subject, got %q", claims.Subject)
+	}
+	if claims.UserID != user.ID {
+		t.Errorf("Expected user_id claim %s, got %s", user.ID, claims.UserID)
+	}
+
+	refreshClaims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokens.RefreshToken, refreshClaims); err != nil {
+		t.Fatalf("Failed to decode refresh token: %v", err)
+	}
+	if refreshClaims.Subject != "subject@example.com" {
+		t.Errorf("Expected email subject in refresh token, got %q", refreshClaims.Subject)
+	}
+
+	refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected successful refresh, got %v", err)
+	}
+	if refreshed.User.ID != user.ID {
+		t.Errorf("Expected refresh for user %s, got %s", user.ID, refreshed.User.ID)
+	}
+}
+
+func TestSubjectMapperValidation(t *testing.T) {
+	_, err := NewValidated(Config{JWTSecret: "test-secret", SubjectMapper: SubjectByEmail})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for mapper without resolver, got %v", err)
+	}
+
+	t.Run("EmptySubject", func(t *testing.T) {
+		auth := New(Config{
+			JWTSecret:       "test-secret",
+			BCryptCost:      4,
+			SubjectMapper:   func(user *User) string { return "" },
+			SubjectResolver: ResolveSubjectByID,
+		})
+		_, _ = auth.RegisterUser(RegisterRequest{Email: "empty@example.com", Password: "password123", Name: "Empty"})
+
+		_, err := auth.LoginUser("empty@example.com", "password123")
+		if !errors.Is(err, ErrInvalidSubject) {
+			t.Errorf("Expected ErrInvalidSubject, got %v", err)
+		}
+	})
+
+	t.Run("CollidingSubject", func(t *testing.T) {
+		var first *User
+		auth := New(Config{
+			JWTSecret:     "test-secret",
+			BCryptCost:    4,
+			SubjectMapper: func(user *User) string { return "shared" },
+			SubjectResolver: func(a *AuthKit, subject string) (*User, error) {
+				return first, nil
+			},
+		})
+		info, _ := auth.RegisterUser(RegisterRequest{Email: "one@example.com", Password: "password123", Name: "One"})
+		_, _ = auth.RegisterUser(RegisterRequest{Email: "two@example.com", Password: "password123", Name: "Two"})
+		first, _ = auth.GetUserByID(info.ID)
+
+		if _, err := auth.LoginUser("one@example.com", "password123"); err != nil {
+			t.Errorf("Expected login for resolvable subject, got %v", err)
+		}
+		_, err := auth.LoginUser("two@example.com", "password123")
+		if !errors.Is(err, ErrInvalidSubject) {
+			t.Errorf("Expected ErrInvalidSubject for colliding subject, got %v", err)
+		}
+	})
+}
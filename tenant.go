@@ -0,0 +1,75 @@
+package authkit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantResolver tells the bundled register and login handlers which tenant a
+// request is for. The sources are tried in field order and the first non-empty
+// tenant wins. Users registered without a tenant are in the default tenant,
+// whose ID is empty.
+type TenantResolver struct {
+	// PathParam is the route parameter holding the tenant, such as "tenant"
+	// for "/t/:tenant/auth/login". Only the Gin and Fiber handlers have
+	// route parameters.
+	PathParam string
+	// Header is the request header holding the tenant, such as "X-Tenant-ID"
+	Header string
+	// FromHost derives the tenant from the request's host without its port,
+	// for example the subdomain of "acme.example.com"
+	FromHost func(host string) string
+	// Required rejects requests without a tenant with CodeTenantRequired,
+	// instead of using the default tenant
+	Required bool
+}
+
+// resolve returns the tenant of a request from its path parameter, header and
+// host, and whether the request may go ahead
+func (r *TenantResolver) resolve(param, header func(string) string, host string) (string, bool) {
+	if r == nil {
+		return "", true
+	}
+
+	var tenant string
+	if r.PathParam != "" && param != nil {
+		tenant = strings.TrimSpace(param(r.PathParam))
+	}
+	if tenant == "" && r.Header != "" {
+		tenant = strings.TrimSpace(header(r.Header))
+	}
+	if tenant == "" && r.FromHost != nil {
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		tenant = r.FromHost(host)
+	}
+	return tenant, tenant != "" || !r.Required
+}
+
+// ResolveTenantGin returns the tenant of a request with Config.TenantResolver,
+// as the bundled login handlers do, for handlers outside this package. When
+// a required tenant is missing it responds 400 with CodeTenantRequired and
+// returns false; handlers should then return without responding.
+func (a *AuthKit) ResolveTenantGin(c *gin.Context) (string, bool) {
+	return a.ginTenant(c)
+}
+
+// ResolveTenantFiber is ResolveTenantGin for Fiber. When it returns false the
+// error response has been sent and handlers should return nil.
+func (a *AuthKit) ResolveTenantFiber(c *fiber.Ctx) (string, bool) {
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		_ = a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+	return tenantID, ok
+}
+
+// ResolveTenantHTTP is ResolveTenantGin for net/http
+func (a *AuthKit) ResolveTenantHTTP(w http.ResponseWriter, r *http.Request) (string, bool) {
+	return a.httpTenant(w, r)
+}
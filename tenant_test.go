@@ -0,0 +1,351 @@
+package authkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTenantScopedEmails(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	acme, err := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "acme-password", Name: "Bob", TenantID: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	globex, err := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "globex-password", Name: "Bob", TenantID: "globex"})
+	if err != nil {
+		t.Fatalf("Expected the email to be free in another tenant, got %v", err)
+	}
+	if acme.ID == globex.ID || acme.TenantID != "acme" || globex.TenantID != "globex" {
+		t.Fatalf("Expected two users in their tenants, got %+v and %+v", acme, globex)
+	}
+	if _, err := auth.RegisterUser(RegisterRequest{Email: "BOB@example.com", Password: "password123", Name: "Bob", TenantID: "acme"}); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists within a tenant, got %v", err)
+	}
+
+	user, err := auth.GetUserByEmailInTenant("globex", "bob@example.com")
+	if err != nil || user.ID != globex.ID {
+		t.Errorf("Expected the globex user, got %v, %v", user, err)
+	}
+	if _, err := auth.GetUserByEmail("bob@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected tenant users to be outside the default tenant, got %v", err)
+	}
+
+	if _, err := auth.LoginUserInTenant("acme", "bob@example.com", "globex-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected another tenant's password to be rejected, got %v", err)
+	}
+	if _, err := auth.LoginUser("bob@example.com", "acme-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected LoginUser to only look in the default tenant, got %v", err)
+	}
+	tokens, err := auth.LoginUserInTenant("acme", "bob@example.com", "acme-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.User.ID != acme.ID || tokens.User.TenantID != "acme" {
+		t.Errorf("Expected the acme user, got %+v", tokens.User)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil || claims.TenantID != "acme" {
+		t.Errorf("Expected the tenant in the access token, got %v, %v", claims, err)
+	}
+
+	refreshed, err := auth.RefreshToken(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := auth.ValidateToken(refreshed.AccessToken); err != nil || claims.TenantID != "acme" {
+		t.Errorf("Expected refreshed tokens to keep the tenant, got %v, %v", claims, err)
+	}
+}
+
+func TestTenantStateRoundTrip(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	for _, tenant := range []string{"", "acme"} {
+		if _, err := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "password123", Name: "Bob", TenantID: tenant}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var state bytes.Buffer
+	if err := auth.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestKit(t, Config{})
+	defer loaded.Close()
+	if err := loaded.LoadState(&state); err != nil {
+		t.Fatalf("Expected the same email in two tenants to load, got %v", err)
+	}
+	if _, err := loaded.LoginUserInTenant("acme", "bob@example.com", "password123"); err != nil {
+		t.Error(err)
+	}
+
+	var exported bytes.Buffer
+	if err := auth.ExportUsers(&exported, ExportCSV); err != nil {
+		t.Fatal(err)
+	}
+	imported := newTestKit(t, Config{})
+	defer imported.Close()
+	report, err := imported.ImportUsers(&exported, ExportCSV, ImportOptions{})
+	if err != nil || report.Imported != 2 {
+		t.Fatalf("Expected both users to be imported, got %+v, %v", report, err)
+	}
+	if user, err := imported.GetUserByEmailInTenant("acme", "bob@example.com"); err != nil || user.TenantID != "acme" {
+		t.Errorf("Expected the tenant to survive the CSV export, got %v, %v", user, err)
+	}
+}
+
+func TestRequireTenant(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	r := gin.New()
+	r.GET("/acme", auth.GinMiddleware(), auth.RequireTenant("acme"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	app := fiber.New()
+	app.Get("/acme", auth.FiberMiddleware(), auth.RequireTenantFiber("acme"), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+
+	mux := http.NewServeMux()
+	mux.Handle("/acme", auth.HTTPMiddleware(auth.RequireTenantHTTP("acme")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	tokens := map[string]string{}
+	for _, tenant := range []string{"acme", "globex", ""} {
+		if _, err := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "password123", Name: "Bob", TenantID: tenant}); err != nil {
+			t.Fatal(err)
+		}
+		issued, err := auth.LoginUserInTenant(tenant, "bob@example.com", "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[tenant] = issued.AccessToken
+	}
+
+	handlers := map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  mux,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			for tenant, want := range map[string]int{"acme": http.StatusOK, "globex": http.StatusForbidden, "": http.StatusForbidden} {
+				req := httptest.NewRequest(http.MethodGet, "/acme", nil)
+				req.Header.Set("Authorization", "Bearer "+tokens[tenant])
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("Expected %d for a %q token, got %d: %s", want, tenant, w.Code, w.Body.String())
+				}
+				if want == http.StatusForbidden && !strings.Contains(w.Body.String(), CodeTenantMismatch) {
+					t.Errorf("Expected %s, got %s", CodeTenantMismatch, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// tenantRoutes serves the register and login handlers of every framework,
+// under /t/:tenant for the frameworks with route parameters
+func tenantRoutes(auth *AuthKit) map[string]http.Handler {
+	r := gin.New()
+	r.POST("/register", auth.RegisterHandler)
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/t/:tenant/login", auth.LoginHandler)
+
+	app := fiber.New()
+	app.Post("/register", auth.RegisterHandlerFiber)
+	app.Post("/login", auth.LoginHandlerFiber)
+	app.Post("/t/:tenant/login", auth.LoginHandlerFiber)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", auth.RegisterHandlerHTTP)
+	mux.HandleFunc("/login", auth.LoginHandlerHTTP)
+
+	return map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+		"http":  mux,
+	}
+}
+
+func TestTenantHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{TenantResolver: &TenantResolver{
+		PathParam: "tenant",
+		Header:    "X-Tenant-ID",
+		FromHost: func(host string) string {
+			if subdomain, _, found := strings.Cut(host, ".auth.example.com"); found {
+				return subdomain
+			}
+			return ""
+		},
+		Required: true,
+	}})
+	defer auth.Close()
+
+	send := func(handler http.Handler, path, host string, header http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, handler := range tenantRoutes(auth) {
+		t.Run(name, func(t *testing.T) {
+			email := name + "@example.com"
+			register := `{"email":"` + email + `","password":"password123","name":"Bob","tenant_id":"spoofed"}`
+			login := `{"email":"` + email + `","password":"password123"}`
+
+			if w := send(handler, "/register", "example.com", nil, register); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), CodeTenantRequired) {
+				t.Fatalf("Expected 400 %s without a tenant, got %d: %s", CodeTenantRequired, w.Code, w.Body.String())
+			}
+			if w := send(handler, "/register", "example.com", http.Header{"X-Tenant-Id": {"acme"}}, register); w.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+			user, err := auth.GetUserByEmailInTenant("acme", email)
+			if err != nil {
+				t.Fatalf("Expected the user in the header's tenant rather than the body's, got %v", err)
+			}
+
+			var tokens TokenResponse
+			w := send(handler, "/login", "acme.auth.example.com:8080", nil, login)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected the subdomain's tenant to log in, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+				t.Fatal(err)
+			}
+			if claims, err := auth.ValidateToken(tokens.AccessToken); err != nil || claims.UserID != user.ID || claims.TenantID != "acme" {
+				t.Errorf("Expected an acme token for %s, got %v, %v", user.ID, claims, err)
+			}
+
+			if w := send(handler, "/login", "globex.auth.example.com", nil, login); w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected another tenant's login to fail, got %d: %s", w.Code, w.Body.String())
+			}
+			if name != "http" {
+				if w := send(handler, "/t/acme/login", "globex.auth.example.com", nil, login); w.Code != http.StatusOK {
+					t.Errorf("Expected the path parameter to take precedence, got %d: %s", w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTenantEmailHandlers(t *testing.T) {
+	sent := map[string]string{} // Token by user ID, or by email for new users
+	record := func(user *UserInfo, token string) error {
+		if user.ID == "" {
+			sent[user.Email] = token
+		} else {
+			sent[user.ID] = token
+		}
+		return nil
+	}
+	auth := newTestKit(t, Config{
+		RateLimitRPM:          -1,
+		EmailRequired:         true,
+		TenantResolver:        &TenantResolver{Header: "X-Tenant-ID"},
+		SendPasswordReset:     record,
+		SendEmailVerification: record,
+		SendLoginLink:         record,
+		AutoCreateOnMagicLink: true,
+	})
+	defer auth.Close()
+	acme, _ := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "password123", Name: "Bob", TenantID: "acme"})
+	globex, _ := auth.RegisterUser(RegisterRequest{Email: "bob@example.com", Password: "password123", Name: "Bob", TenantID: "globex"})
+
+	r := gin.New()
+	r.POST("/password/forgot", auth.ForgotPasswordHandler)
+	r.POST("/verify-email/resend", auth.ResendVerificationHandler)
+	r.POST("/login/link", auth.RequestLoginLinkHandler)
+	app := fiber.New()
+	app.Post("/password/forgot", auth.ForgotPasswordHandlerFiber)
+	app.Post("/verify-email/resend", auth.ResendVerificationHandlerFiber)
+	app.Post("/login/link", auth.RequestLoginLinkHandlerFiber)
+	handlers := map[string]http.Handler{
+		"gin":   r,
+		"fiber": http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { serveFiber(app, w, req) }),
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			send := func(path, tenant, email string) {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"email":"`+email+`"}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Tenant-ID", tenant)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusAccepted {
+					t.Fatalf("Expected 202 from %s, got %d: %s", path, w.Code, w.Body.String())
+				}
+			}
+
+			for _, path := range []string{"/password/forgot", "/verify-email/resend", "/login/link"} {
+				for tenant, user := range map[string]*UserInfo{"acme": acme, "globex": globex} {
+					clear(sent)
+					send(path, tenant, "bob@example.com")
+					if _, ok := sent[user.ID]; !ok || len(sent) != 1 {
+						t.Errorf("Expected %s to send to the %s user only, sent %v", path, tenant, sent)
+					}
+				}
+			}
+
+			email := name + "-new@example.com"
+			send("/login/link", "acme", email)
+			tokens, err := auth.LoginWithLinkToken(sent[email])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tokens.User.TenantID != "acme" {
+				t.Errorf("Expected the login link to create the user in acme, got %+v", tokens.User)
+			}
+		})
+	}
+}
+
+func TestTenantHandlersWithoutResolver(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+
+	for name, handler := range tenantRoutes(auth) {
+		t.Run(name, func(t *testing.T) {
+			email := name + "@example.com"
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"`+email+`","password":"password123","name":"Bob","tenant_id":"spoofed"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Tenant-ID", "acme")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "tenant_id") {
+				t.Errorf("Expected no tenant in single-tenant responses, got %s", w.Body.String())
+			}
+			if _, err := auth.LoginUser(email, "password123"); err != nil {
+				t.Errorf("Expected the user in the default tenant, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantResolverConfig(t *testing.T) {
+	if err := (Config{TenantResolver: &TenantResolver{Required: true}}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a TenantResolver without sources to be rejected, got %v", err)
+	}
+	if err := (Config{TenantResolver: &TenantResolver{Header: "X-Tenant-ID"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
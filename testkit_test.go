@@ -0,0 +1,30 @@
+package authkit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestKit returns an AuthKit for a test. Unless config says otherwise it
+// signs with a test secret, encrypts MFA secrets with a test key and hashes
+// with the cheapest bcrypt cost, so tests only spell out the settings they
+// exercise. A fixed clock goes in config.Clock, see testClock.
+func newTestKit(t testing.TB, config Config) *AuthKit {
+	t.Helper()
+	if config.JWTSecret == "" && config.SecretProvider == nil && config.JWKSURL == "" && config.SigningMethod == "" {
+		config.JWTSecret = "test-secret-key-for-testing-only"
+	}
+	if config.EncryptionKey == "" {
+		config.EncryptionKey = "test-encryption-key"
+	}
+	if config.BCryptCost == 0 {
+		config.BCryptCost = 4
+	}
+	return New(config)
+}
+
+// testClock returns a Clock that reads *now, so a test moves time by
+// assigning to now.
+func testClock(now *time.Time) Clock {
+	return ClockFunc(func() time.Time { return *now })
+}
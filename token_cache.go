@@ -0,0 +1,134 @@
+package authkit
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// defaultTokenCacheTTL is how long parsed tokens are cached when
+// Config.TokenCacheTTL isn't set
+const defaultTokenCacheTTL = time.Minute
+
+// tokenCacheEntry is a parsed token kept by tokenCache
+type tokenCacheEntry struct {
+	key     [sha256.Size]byte
+	claims  *Claims
+	expires time.Time // The token's expiry or the cache TTL, whichever comes first
+}
+
+// tokenCache is an LRU cache of validated tokens, keyed by a hash of the token
+// string, sparing ValidateToken the signature check and claims decoding of
+// tokens it has seen. It is nil when Config.TokenCacheSize is 0; every method
+// is a no-op on a nil cache.
+type tokenCache struct {
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	order   *list.List // Of *tokenCacheEntry, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+	byJTI   map[string][sha256.Size]byte
+}
+
+// newTokenCache creates a cache holding up to size tokens for at most ttl,
+// or returns nil if size isn't positive
+func newTokenCache(size int, ttl time.Duration) *tokenCache {
+	if size <= 0 {
+		return nil
+	}
+	return &tokenCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		byJTI:   make(map[string][sha256.Size]byte),
+	}
+}
+
+// get returns a copy of the claims cached for tokenString, unless they expired at now
+func (c *tokenCache) get(tokenString string, now time.Time) (*Claims, bool) {
+	if c == nil {
+		return nil, false
+	}
+	key := sha256.Sum256([]byte(tokenString))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return cloneClaims(entry.claims), true
+}
+
+// put caches a copy of the claims of a token that passed validation at now,
+// evicting the least recently used token when the cache is full
+func (c *tokenCache) put(tokenString string, claims *Claims, now time.Time) {
+	if c == nil {
+		return
+	}
+	expires := now.Add(c.ttl)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expires) {
+		expires = claims.ExpiresAt.Time
+	}
+	entry := &tokenCacheEntry{key: sha256.Sum256([]byte(tokenString)), claims: cloneClaims(claims), expires: expires}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[entry.key]; exists {
+		c.remove(element)
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	if claims.ID != "" {
+		c.byJTI[claims.ID] = entry.key
+	}
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// evict drops the token with the given JTI
+func (c *tokenCache) evict(jti string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if key, exists := c.byJTI[jti]; exists {
+		c.remove(c.entries[key])
+	}
+}
+
+// remove drops an element; the caller holds mutex
+func (c *tokenCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*tokenCacheEntry)
+	delete(c.entries, entry.key)
+	if entry.claims.ID != "" && c.byJTI[entry.claims.ID] == entry.key {
+		delete(c.byJTI, entry.claims.ID)
+	}
+}
+
+// cloneClaims makes a copy of claims sharing nothing mutable with the original
+func cloneClaims(claims *Claims) *Claims {
+	clone := *claims
+	clone.Permissions = copyStrings(claims.Permissions)
+	clone.AMR = copyStrings(claims.AMR)
+	clone.Metadata = copyMetadata(claims.Metadata)
+	clone.Audience = copyStrings(claims.Audience)
+	return &clone
+}
+
+// copyStrings copies a slice, keeping nil and empty slices apart
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
@@ -0,0 +1,156 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{TokenExpiry: "1h", TokenCacheSize: 2, TokenCacheTTL: 10 * time.Minute, Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "cached@example.com")
+
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil || auth.tokenCache.order.Len() != 1 {
+		t.Fatalf("Expected the token cached, got %v with %d entries", err, auth.tokenCache.order.Len())
+	}
+	claims.Permissions = append(claims.Permissions, "mutated")
+	claims.Role = "mutated"
+	if cached, err := auth.ValidateToken(tokens.AccessToken); err != nil || cached.Role == "mutated" || len(cached.Permissions) != len(claims.Permissions)-1 {
+		t.Errorf("Expected the cached claims unaffected by callers, got %+v %v", cached, err)
+	}
+
+	// Entries expire after TokenCacheTTL, and tokens are still rejected once expired
+	now = now.Add(11 * time.Minute)
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired for a cached token past its expiry, got %v", err)
+	}
+	if auth.tokenCache.order.Len() != 0 {
+		t.Errorf("Expected the expired token evicted, got %d entries", auth.tokenCache.order.Len())
+	}
+
+	// The least recently used token is evicted when the cache is full
+	var access []string
+	for i := 0; i < 3; i++ {
+		token, _ := auth.GenerateCustomToken(fmt.Sprintf("user-%d", i), nil, time.Hour)
+		access = append(access, token)
+		if _, err := auth.ValidateToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, cached := auth.tokenCache.get(access[0], now); cached || auth.tokenCache.order.Len() != 2 {
+		t.Errorf("Expected the oldest token evicted, got %d entries", auth.tokenCache.order.Len())
+	}
+}
+
+func TestTokenCacheChecks(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{TokenExpiry: "1h", TokenCacheSize: 10, TokenCacheTTL: 10 * time.Minute, Clock: testClock(&now)})
+	defer auth.Close()
+	auth.config.CheckUserOnRequest = true
+	tokens := loginTestUser(t, auth, "checked@example.com")
+
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.DisableUser(tokens.User.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected a cached token of a disabled user rejected, got %v", err)
+	}
+
+	other := loginTestUser(t, auth, "revoked@example.com")
+	claims, err := auth.ValidateToken(other.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RevokeToken(other.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ValidateToken(other.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected a cached token rejected once revoked, got %v", err)
+	}
+	if _, exists := auth.tokenCache.byJTI[claims.ID]; exists {
+		t.Error("Expected the revoked token evicted")
+	}
+}
+
+func TestTokenCacheConcurrentRevocation(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{TokenExpiry: "1h", TokenCacheSize: 64, TokenCacheTTL: 10 * time.Minute, Clock: testClock(&now)})
+	defer auth.Close()
+
+	var tokens []string
+	for i := 0; i < 32; i++ {
+		token, _ := auth.GenerateCustomToken(fmt.Sprintf("user-%d", i), nil, time.Hour)
+		tokens = append(tokens, token)
+	}
+
+	var wg sync.WaitGroup
+	for _, token := range tokens {
+		token := token
+		revoked := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					select {
+					case <-revoked:
+						if _, err := auth.ValidateToken(token); !errors.Is(err, ErrTokenRevoked) {
+							t.Errorf("Expected ErrTokenRevoked after revocation, got %v", err)
+						}
+					default:
+						_, _ = auth.ValidateToken(token)
+					}
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := auth.RevokeToken(token); err != nil {
+				t.Error(err)
+			}
+			close(revoked)
+		}()
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		if _, err := auth.ValidateToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Expected ErrTokenRevoked, got %v", err)
+		}
+	}
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	for _, size := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			auth := newTestKit(b, Config{TokenCacheSize: size})
+			defer auth.Close()
+			user, _ := auth.AdminCreateUser(RegisterRequest{Email: "bench@example.com", Password: "password123", Name: "Bench"})
+			tokens, err := auth.IssueTokensForUser(user.ID)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
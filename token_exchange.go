@@ -0,0 +1,389 @@
+package authkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// firebaseJWKSURL publishes the keys Firebase Authentication signs ID tokens with
+	firebaseJWKSURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+	// defaultExchangeReplayWindow is how long an exchange's response is
+	// returned again for the same external token
+	defaultExchangeReplayWindow = time.Minute
+)
+
+// TokenExchangeConfig lets clients that authenticated with an external
+// identity provider, such as Firebase Authentication in a mobile app,
+// exchange the provider's ID token for AuthKit tokens, see
+// ExchangeExternalToken
+type TokenExchangeConfig struct {
+	// Providers are the identity providers whose ID tokens are accepted
+	Providers []ExternalTokenProvider
+	// ReplayWindow is how long exchanging the same ID token again returns
+	// the same response instead of starting another session, so clients can
+	// retry an exchange whose response they didn't receive (default: 1m,
+	// negative disables). Responses are kept in memory, per instance.
+	ReplayWindow time.Duration
+	// HTTPClient fetches the providers' keys (default: Config.HTTPClient, or
+	// a client with a 10s timeout)
+	HTTPClient *http.Client
+}
+
+// ExternalTokenProvider is an identity provider whose ID tokens
+// ExchangeExternalToken accepts. Tokens must be signed with one of the keys
+// published at JWKSURL and carry the provider's Issuer, one of Audience and
+// a sub claim. Their sub, email and email_verified claims are mapped to a
+// local user like the identities of LoginWithIdentity.
+type ExternalTokenProvider struct {
+	// Name identifies the provider in exchange requests and is the
+	// LinkedIdentity.Provider of its identities, e.g. "firebase"
+	Name string
+	// Issuer is the iss claim of the provider's ID tokens
+	Issuer string
+	// Audience lists the accepted aud claims, usually the client or project ID
+	Audience []string
+	// JWKSURL is the provider's key set, usually the jwks_uri of its OpenID
+	// Connect discovery document
+	JWKSURL string
+	// LinkedOnly only logs in users the identity is linked to, or whose
+	// email it verifies with Config.LinkIdentitiesByEmail, failing with
+	// ErrUserNotFound instead of creating users
+	LinkedOnly bool
+}
+
+// FirebaseProvider returns the provider "firebase" for the ID tokens
+// Firebase Authentication issues to the apps of the project
+func FirebaseProvider(projectID string) ExternalTokenProvider {
+	return ExternalTokenProvider{
+		Name:     "firebase",
+		Issuer:   "https://securetoken.google.com/" + projectID,
+		Audience: []string{projectID},
+		JWKSURL:  firebaseJWKSURL,
+	}
+}
+
+// withDefaults returns a copy of the token exchange config with the HTTP
+// client and replay window filled in
+func (t TokenExchangeConfig) withDefaults(client *http.Client) *TokenExchangeConfig {
+	t.Providers = slices.Clone(t.Providers)
+	for i := range t.Providers {
+		t.Providers[i].Audience = slices.Clone(t.Providers[i].Audience)
+	}
+	if t.ReplayWindow == 0 {
+		t.ReplayWindow = defaultExchangeReplayWindow
+	}
+	if t.HTTPClient == nil {
+		t.HTTPClient = client
+	}
+	if t.HTTPClient == nil {
+		t.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &t
+}
+
+// validate checks the token exchange config against the rest of the configuration
+func (t *TokenExchangeConfig) validate(c Config) error {
+	if c.JWKSURL != "" {
+		return fmt.Errorf("%w: TokenExchange can't be used with JWKSURL, AuthKit doesn't issue tokens then", ErrInvalidConfig)
+	}
+	if len(t.Providers) == 0 {
+		return fmt.Errorf("%w: TokenExchange needs at least one provider", ErrInvalidConfig)
+	}
+	seen := make(map[string]bool, len(t.Providers))
+	for i, p := range t.Providers {
+		if p.Name == "" || seen[p.Name] {
+			return fmt.Errorf("%w: TokenExchange.Providers[%d] needs a unique Name", ErrInvalidConfig, i)
+		}
+		seen[p.Name] = true
+		if p.Issuer == "" {
+			return fmt.Errorf("%w: TokenExchange provider %q needs an Issuer", ErrInvalidConfig, p.Name)
+		}
+		if len(p.Audience) == 0 || slices.Contains(p.Audience, "") {
+			return fmt.Errorf("%w: TokenExchange provider %q needs a non-empty Audience", ErrInvalidConfig, p.Name)
+		}
+		if err := validateJWKSURL(p.JWKSURL); err != nil {
+			return fmt.Errorf("TokenExchange provider %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// tokenExchange holds the key sets of the token exchange providers and the
+// responses of recent exchanges
+type tokenExchange struct {
+	providers map[string]*exchangeProvider
+
+	mutex     sync.Mutex
+	exchanges map[string]*exchangeResult
+}
+
+// exchangeProvider is a configured provider with its cached keys
+type exchangeProvider struct {
+	ExternalTokenProvider
+	keys *remoteKeySet
+}
+
+// exchangeResult is the response to an exchange, returned again for the
+// same ID token until expires. done is closed once it is set.
+type exchangeResult struct {
+	done    chan struct{}
+	tokens  *TokenResponse
+	err     error
+	expires time.Time
+}
+
+// newTokenExchange builds the key sets of the configured providers
+func newTokenExchange(config *TokenExchangeConfig, ttl time.Duration, now func() time.Time) *tokenExchange {
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+	exchange := &tokenExchange{
+		providers: make(map[string]*exchangeProvider, len(config.Providers)),
+		exchanges: make(map[string]*exchangeResult),
+	}
+	for _, p := range config.Providers {
+		exchange.providers[p.Name] = &exchangeProvider{
+			ExternalTokenProvider: p,
+			keys:                  &remoteKeySet{url: p.JWKSURL, ttl: ttl, client: config.HTTPClient, now: now},
+		}
+	}
+	return exchange
+}
+
+// keyFunc selects the provider's key for a token. Failures to fetch the
+// key set are reported as ErrIdentityProviderFailed rather than as an
+// invalid token.
+func (p *exchangeProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	key, err := p.keys.keyFunc(token)
+	if err != nil && !errors.Is(err, ErrInvalidToken) {
+		return nil, fmt.Errorf("%w: %s: %v", ErrIdentityProviderFailed, p.Name, err)
+	}
+	return key, err
+}
+
+// ExchangeExternalToken logs in with an ID token issued by the configured
+// provider, see Config.TokenExchange. The user is found, linked or created
+// from the token's sub, email and email_verified claims like the identity of
+// LoginWithIdentity, and gets standard AuthKit tokens, or an MFA token for
+// users with TOTP enabled. Exchanging the same ID token again within
+// TokenExchangeConfig.ReplayWindow returns the same response.
+func (a *AuthKit) ExchangeExternalToken(provider string, idToken string) (*TokenResponse, error) {
+	return a.ExchangeExternalTokenWithOptionsCtx(context.Background(), provider, idToken, LoginOptions{})
+}
+
+// ExchangeExternalTokenWithOptions is ExchangeExternalToken with login
+// options, such as the tenant to log in to
+func (a *AuthKit) ExchangeExternalTokenWithOptions(provider string, idToken string, opts LoginOptions) (*TokenResponse, error) {
+	return a.ExchangeExternalTokenWithOptionsCtx(context.Background(), provider, idToken, opts)
+}
+
+// ExchangeExternalTokenWithOptionsCtx is ExchangeExternalTokenWithOptions with a context, failing with ctx.Err() once ctx is done
+func (a *AuthKit) ExchangeExternalTokenWithOptionsCtx(ctx context.Context, provider string, idToken string, opts LoginOptions) (tokens *TokenResponse, err error) {
+	a.debugCheck()
+
+	ctx, span := a.startSpan(ctx, "ExchangeExternalToken")
+	defer func() {
+		err = opError("exchange external token", err)
+		endSpan(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if a.exchange == nil {
+		return nil, ErrUnknownIdentityProvider
+	}
+	p, ok := a.exchange.providers[provider]
+	if !ok {
+		return nil, ErrUnknownIdentityProvider
+	}
+	identity, expires, err := a.verifyExternalToken(p, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.config.TokenExchange.ReplayWindow < 0 {
+		return a.loginWithIdentity(ctx, span, identity, opts, !p.LinkedOnly)
+	}
+	if replay := a.config.TokenExchange.ReplayWindow; expires.Sub(a.now()) > replay {
+		expires = a.now().Add(replay)
+	}
+	return a.exchange.once(ctx, exchangeKey(provider, opts, idToken), expires, a.now, func() (*TokenResponse, error) {
+		return a.loginWithIdentity(ctx, span, identity, opts, !p.LinkedOnly)
+	})
+}
+
+// verifyExternalToken validates an ID token of the provider, returning the
+// identity it asserts and its expiry
+func (a *AuthKit) verifyExternalToken(p *exchangeProvider, idToken string) (ExternalIdentity, time.Time, error) {
+	if len(idToken) > a.config.MaxTokenSize {
+		return ExternalIdentity{}, time.Time{}, ErrInvalidToken
+	}
+
+	raw := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, raw, p.keyFunc,
+		jwt.WithValidMethods(remoteSigningMethods),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil {
+		if errors.Is(err, ErrIdentityProviderFailed) {
+			return ExternalIdentity{}, time.Time{}, err
+		}
+		return ExternalIdentity{}, time.Time{}, tokenError(err)
+	}
+	audience, _ := raw.GetAudience()
+	if !slices.ContainsFunc(audience, func(aud string) bool { return slices.Contains(p.Audience, aud) }) {
+		return ExternalIdentity{}, time.Time{}, ErrInvalidToken
+	}
+
+	identity := ExternalIdentity{Provider: p.Name}
+	identity.Subject, _ = raw.GetSubject()
+	if identity.Subject == "" {
+		return ExternalIdentity{}, time.Time{}, ErrInvalidToken
+	}
+	identity.Email = claimString(raw, "email")
+	identity.Name = claimString(raw, "name")
+	identity.AvatarURL = claimString(raw, "picture")
+	// Some providers send email_verified as a string
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	expires, _ := raw.GetExpirationTime()
+	return identity, expires.Time, nil
+}
+
+// exchangeKey identifies an exchange of idToken into the tenant for the
+// nonce without keeping the token itself
+func exchangeKey(provider string, opts LoginOptions, idToken string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + opts.TenantID + "\x00" + opts.Nonce + "\x00" + idToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// once runs exchange for key, or returns a copy of the response of a
+// previous exchange for key that hasn't expired, waiting for it if it is
+// still running. Failed exchanges aren't kept.
+func (e *tokenExchange) once(ctx context.Context, key string, expires time.Time, now func() time.Time, exchange func() (*TokenResponse, error)) (*TokenResponse, error) {
+	e.mutex.Lock()
+	if result, found := e.exchanges[key]; found && now().Before(result.expires) {
+		e.mutex.Unlock()
+		select {
+		case <-result.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if result.err != nil {
+			return nil, result.err
+		}
+		return cloneTokenResponse(result.tokens), nil
+	}
+	for k, result := range e.exchanges {
+		if !now().Before(result.expires) {
+			delete(e.exchanges, k)
+		}
+	}
+	result := &exchangeResult{done: make(chan struct{}), expires: expires}
+	e.exchanges[key] = result
+	e.mutex.Unlock()
+
+	result.tokens, result.err = exchange()
+	if result.err != nil {
+		e.mutex.Lock()
+		if e.exchanges[key] == result {
+			delete(e.exchanges, key)
+		}
+		e.mutex.Unlock()
+	}
+	close(result.done)
+
+	if result.err != nil {
+		return nil, result.err
+	}
+	return cloneTokenResponse(result.tokens), nil
+}
+
+// cloneTokenResponse returns a copy of tokens that doesn't alias its user
+func cloneTokenResponse(tokens *TokenResponse) *TokenResponse {
+	clone := *tokens
+	if tokens.User != nil {
+		clone.User = cloneUserInfo(tokens.User)
+	}
+	if tokens.ReauthenticateAt != nil {
+		at := *tokens.ReauthenticateAt
+		clone.ReauthenticateAt = &at
+	}
+	return &clone
+}
+
+// TokenExchangeHandler exchanges the ID token of a configured provider for
+// AuthKit tokens for Gin, see ExchangeExternalToken. It responds like
+// LoginHandler, with the tokens or an MFA challenge.
+//
+//	r.POST("/token/exchange", auth.TokenExchangeHandler)
+func (a *AuthKit) TokenExchangeHandler(c *gin.Context) {
+	var req TokenExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.ginBindError(c, err)
+		return
+	}
+	if !a.ginAllowClient(c, "") {
+		return
+	}
+	tenantID, ok := a.ginTenant(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := a.ExchangeExternalTokenWithOptionsCtx(c.Request.Context(), req.Provider, req.IDToken, LoginOptions{
+		TenantID: tenantID,
+		Context:  LoginContext{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()},
+		Nonce:    req.Nonce,
+	})
+	if err != nil {
+		a.RespondError(c, err)
+		return
+	}
+	a.ginRespondTokens(c, tokens)
+}
+
+// TokenExchangeHandlerFiber is TokenExchangeHandler for Fiber
+func (a *AuthKit) TokenExchangeHandlerFiber(c *fiber.Ctx) error {
+	var req TokenExchangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return a.fiberBindError(c, err)
+	}
+	if allowed, wait := a.allowClient(c.IP(), ""); !allowed {
+		return a.fiberRateLimited(c, wait)
+	}
+	tenantID, ok := a.fiberTenant(c)
+	if !ok {
+		return a.fiberErrorCode(c, fiber.StatusBadRequest, CodeTenantRequired)
+	}
+
+	tokens, err := a.ExchangeExternalTokenWithOptionsCtx(c.UserContext(), req.Provider, req.IDToken, LoginOptions{
+		TenantID: tenantID,
+		Context:  LoginContext{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)},
+		Nonce:    req.Nonce,
+	})
+	if err != nil {
+		return a.RespondErrorFiber(c, err)
+	}
+	return a.fiberRespondTokens(c, tokens)
+}
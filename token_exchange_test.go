@@ -0,0 +1,257 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// exchangeConfig trusts the Firebase project "my-project", with its keys
+// served by p
+func exchangeConfig(p *testProvider, config Config, linkedOnly bool) Config {
+	firebase := FirebaseProvider("my-project")
+	firebase.JWKSURL = p.server.URL
+	firebase.LinkedOnly = linkedOnly
+	config.TokenExchange = &TokenExchangeConfig{Providers: []ExternalTokenProvider{firebase}}
+	return config
+}
+
+// firebaseToken is an ID token of the Firebase project "my-project"
+func firebaseToken(p *testProvider, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{
+		"iss":            "https://securetoken.google.com/my-project",
+		"aud":            "my-project",
+		"sub":            "firebase-uid-1",
+		"iat":            time.Now().Unix(),
+		"email":          "Mobile@Example.com",
+		"email_verified": true,
+		"name":           "Mobile User",
+	}
+	for k, v := range claims {
+		base[k] = v
+	}
+	return p.token("key-1", base)
+}
+
+func TestExchangeExternalToken(t *testing.T) {
+	p := newTestProvider(t)
+	now := time.Now()
+	auth := newTestKit(t, exchangeConfig(p, Config{Clock: testClock(&now)}, false))
+	defer auth.Close()
+
+	idToken := firebaseToken(p, nil)
+	tokens, err := auth.ExchangeExternalToken("firebase", idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ValidateToken(tokens.AccessToken)
+	if err != nil || claims.UserID != tokens.User.ID {
+		t.Fatalf("Expected a valid AuthKit access token, got %+v %v", claims, err)
+	}
+	user, err := auth.GetUserByIdentity("firebase", "firebase-uid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "mobile@example.com" || !user.EmailVerified || user.Name != "Mobile User" {
+		t.Errorf("Expected a user from the token's claims, got %+v", user)
+	}
+
+	// Retrying the exchange returns the same session
+	replay, err := auth.ExchangeExternalToken("firebase", idToken)
+	if err != nil || replay.AccessToken != tokens.AccessToken || replay.SessionID != tokens.SessionID {
+		t.Errorf("Expected the replayed exchange to return the same tokens, got %+v %v", replay, err)
+	}
+
+	// Past the replay window, or with another token, it is a new login
+	now = now.Add(2 * time.Minute)
+	again, err := auth.ExchangeExternalToken("firebase", idToken)
+	if err != nil || again.SessionID == tokens.SessionID || again.User.ID != user.ID {
+		t.Errorf("Expected a new session for the same user, got %+v %v", again, err)
+	}
+	other, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, jwt.MapClaims{"iat": time.Now().Add(-time.Second).Unix()}))
+	if err != nil || other.SessionID == again.SessionID || other.User.ID != user.ID {
+		t.Errorf("Expected a new session for another token, got %+v %v", other, err)
+	}
+}
+
+func TestExchangeExternalTokenRejects(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, exchangeConfig(p, Config{}, false))
+	defer auth.Close()
+
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://securetoken.google.com/my-project", "aud": "my-project", "sub": "x", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret-key-for-testing-only"))
+
+	tests := []struct {
+		name     string
+		provider string
+		token    string
+		want     error
+	}{
+		{"wrong issuer", "firebase", firebaseToken(p, jwt.MapClaims{"iss": "https://securetoken.google.com/other"}), ErrInvalidToken},
+		{"wrong audience", "firebase", firebaseToken(p, jwt.MapClaims{"aud": "other"}), ErrInvalidToken},
+		{"no subject", "firebase", firebaseToken(p, jwt.MapClaims{"sub": ""}), ErrInvalidToken},
+		{"issued in the future", "firebase", firebaseToken(p, jwt.MapClaims{"iat": time.Now().Add(time.Hour).Unix()}), ErrInvalidToken},
+		{"expired", "firebase", firebaseToken(p, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), ErrTokenExpired},
+		{"unknown kid", "firebase", p.tokenWithKID("key-1", "key-2"), ErrInvalidToken},
+		{"HMAC", "firebase", hmac, ErrInvalidToken},
+		{"unknown provider", "auth0", firebaseToken(p, nil), ErrUnknownIdentityProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.ExchangeExternalToken(tt.provider, tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Tokens without a verified email can't take over a registered user
+	loginTestUser(t, auth, "taken@example.com")
+	if _, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, jwt.MapClaims{"email": "taken@example.com", "email_verified": false})); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Errorf("Expected ErrIdentityNotLinked, got %v", err)
+	}
+
+	disabled := newTestKit(t, Config{})
+	defer disabled.Close()
+	if _, err := disabled.ExchangeExternalToken("firebase", firebaseToken(p, nil)); !errors.Is(err, ErrUnknownIdentityProvider) {
+		t.Errorf("Expected ErrUnknownIdentityProvider without TokenExchange, got %v", err)
+	}
+
+	p.server.Close()
+	unreachable := newTestKit(t, exchangeConfig(p, Config{}, false))
+	defer unreachable.Close()
+	if _, err := unreachable.ExchangeExternalToken("firebase", firebaseToken(p, nil)); !errors.Is(err, ErrIdentityProviderFailed) {
+		t.Errorf("Expected ErrIdentityProviderFailed without the provider's keys, got %v", err)
+	}
+}
+
+func TestExchangeExternalTokenLinkedOnly(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, exchangeConfig(p, Config{}, true))
+	defer auth.Close()
+
+	if _, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, nil)); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound for an unlinked identity, got %v", err)
+	}
+	user := loginTestUser(t, auth, "user@example.com").User
+	if err := auth.LinkIdentity(user.ID, ExternalIdentity{Provider: "firebase", Subject: "firebase-uid-1"}); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, nil))
+	if err != nil || tokens.User.ID != user.ID {
+		t.Errorf("Expected the linked user to log in, got %+v %v", tokens, err)
+	}
+}
+
+func TestExchangeExternalTokenMFA(t *testing.T) {
+	p := newTestProvider(t)
+	auth := newTestKit(t, exchangeConfig(p, Config{}, false))
+	defer auth.Close()
+
+	tokens, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollTestTOTP(t, auth, tokens.User.ID)
+	pending, err := auth.ExchangeExternalToken("firebase", firebaseToken(p, jwt.MapClaims{"iat": time.Now().Add(-time.Second).Unix()}))
+	if err != nil || !pending.MFARequired || pending.AccessToken != "" {
+		t.Errorf("Expected an MFA challenge, got %+v %v", pending, err)
+	}
+}
+
+func TestTokenExchangeConfigValidation(t *testing.T) {
+	valid := FirebaseProvider("my-project")
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"no providers", Config{TokenExchange: &TokenExchangeConfig{}}},
+		{"no name", Config{TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{{Issuer: valid.Issuer, Audience: valid.Audience, JWKSURL: valid.JWKSURL}}}}},
+		{"duplicate name", Config{TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{valid, valid}}}},
+		{"no project", Config{TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{FirebaseProvider("")}}}},
+		{"no issuer", Config{TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{{Name: "idp", Audience: []string{"app"}, JWKSURL: valid.JWKSURL}}}}},
+		{"http JWKS", Config{TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{{Name: "idp", Issuer: "https://idp.example.com", Audience: []string{"app"}, JWKSURL: "http://idp.example.com/jwks"}}}}},
+		{"remote JWKS mode", Config{JWKSURL: "https://idp.example.com/jwks", Issuer: "https://idp.example.com", Audience: []string{"api"}, TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{valid}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.JWTSecret = "test-secret-key-for-testing-only"
+			if _, err := NewValidated(tt.config); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+
+	auth, err := NewValidated(Config{JWTSecret: "test-secret-key-for-testing-only", TokenExchange: &TokenExchangeConfig{Providers: []ExternalTokenProvider{valid}}})
+	if err != nil {
+		t.Fatalf("Expected the Firebase provider to be valid, got %v", err)
+	}
+	auth.Close()
+}
+
+func TestTokenExchangeHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := newTestProvider(t)
+	auth := newTestKit(t, exchangeConfig(p, Config{RateLimitRPM: -1}, false))
+	defer auth.Close()
+
+	r := gin.New()
+	r.POST("/token/exchange", auth.TokenExchangeHandler)
+	app := fiber.New()
+	app.Post("/token/exchange", auth.TokenExchangeHandlerFiber)
+
+	frameworks := map[string]func(req *http.Request) *httptest.ResponseRecorder{
+		"gin": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		},
+		"fiber": func(req *http.Request) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			serveFiber(app, w, req)
+			return w
+		},
+	}
+	for name, serve := range frameworks {
+		t.Run(name, func(t *testing.T) {
+			exchange := func(provider, token string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(TokenExchangeRequest{Provider: provider, IDToken: token})
+				req := httptest.NewRequest(http.MethodPost, "/token/exchange", strings.NewReader(string(body)))
+				req.Header.Set("Content-Type", "application/json")
+				return serve(req)
+			}
+
+			w := exchange("firebase", firebaseToken(p, nil))
+			var tokens TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || w.Code != http.StatusOK || tokens.AccessToken == "" {
+				t.Fatalf("Expected tokens, got %d %s", w.Code, w.Body.String())
+			}
+			if tokens.User == nil || tokens.User.Email != "mobile@example.com" {
+				t.Errorf("Expected the user in the response, got %+v", tokens.User)
+			}
+
+			for _, tt := range []struct {
+				provider, token string
+				status          int
+				code            string
+			}{
+				{"firebase", firebaseToken(p, jwt.MapClaims{"aud": "other"}), http.StatusUnauthorized, CodeInvalidToken},
+				{"auth0", firebaseToken(p, nil), http.StatusNotFound, CodeUnknownIdentityProvider},
+			} {
+				w := exchange(tt.provider, tt.token)
+				if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+					t.Errorf("Expected %d %s, got %d %s", tt.status, tt.code, w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
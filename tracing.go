@@ -0,0 +1,84 @@
+package authkit
+
+import "context"
+
+// Tracer starts spans around auth operations. AuthKit doesn't depend on a
+// tracing library itself; the otelauthkit package adapts OpenTelemetry.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, returning
+	// a context carrying the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// SpanFromContext returns the span in ctx, such as the server span of an
+	// instrumented handler, or a no-op span
+	SpanFromContext(ctx context.Context) Span
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttribute(key, value string)
+	AddEvent(name string, attrs map[string]string)
+	// End ends the span, marking it failed when err is not nil
+	End(err error)
+}
+
+// Span attributes and events set by AuthKit
+const (
+	TraceAttrUserID    = "enduser.id"
+	TraceAttrResult    = "authkit.result"
+	TraceAttrErrorCode = "authkit.error_code"
+
+	TraceEventAuthenticated = "authkit.authenticated"
+	TraceEventRejected      = "authkit.rejected"
+)
+
+// nopTracer is the default Tracer, starting no spans
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+func (nopTracer) SpanFromContext(context.Context) Span { return nopSpan{} }
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, string)        {}
+func (nopSpan) AddEvent(string, map[string]string) {}
+func (nopSpan) End(error)                          {}
+
+// startSpan starts the span of an auth operation
+func (a *AuthKit) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	return a.config.Tracer.Start(ctx, "authkit."+name)
+}
+
+// endSpan records the outcome of an operation on its span and ends it
+func endSpan(span Span, err error) {
+	span.SetAttribute(TraceAttrResult, outcome(err))
+	if err != nil {
+		span.SetAttribute(TraceAttrErrorCode, ErrorCode(err))
+	}
+	span.End(err)
+}
+
+// traceUserID is the enduser.id attribute for a user, hashed when
+// Config.TraceHashUserIDs is set
+func (a *AuthKit) traceUserID(userID string) string {
+	if a.config.TraceHashUserIDs {
+		return fingerprint(userID)
+	}
+	return userID
+}
+
+// traceStore runs a store call in a child span of ctx
+func (a *AuthKit) traceStore(ctx context.Context, name string, call func() error) error {
+	_, span := a.startSpan(ctx, name)
+	err := call()
+	endSpan(span, err)
+	return err
+}
+
+// traceAuthenticated records on the span in ctx that the middleware let the
+// request through
+func (a *AuthKit) traceAuthenticated(ctx context.Context, claims *Claims) {
+	a.config.Tracer.SpanFromContext(ctx).AddEvent(TraceEventAuthenticated,
+		map[string]string{TraceAttrUserID: a.traceUserID(claims.UserID)})
+}
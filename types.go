@@ -1,8 +1,12 @@
 package authkit
 
 import (
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,32 +15,441 @@ import (
 // AuthKit is the main struct that holds configuration and methods
 type AuthKit struct {
 	config Config
-	users  map[string]*User // In-memory storage for demo (use database in production)
-	mutex  sync.RWMutex     // For thread-safe operations
+	// users is the in-memory user table; writes to it are serialized by mutex
+	users *userStore
+	// serviceAccounts are keyed by client ID and guarded by mutex
+	serviceAccounts map[string]*ServiceAccount
+	// roles maps defined roles to their permissions and is guarded by mutex
+	roles map[string][]string
+	// policies maps resource types to the policies registered with
+	// RegisterPolicy and is guarded by mutex
+	policies map[string]Policy
+	// sessions are keyed by session ID and guarded by mutex
+	sessions map[string]*sessionRecord
+	mutex    sync.RWMutex // For thread-safe operations
+
+	customSubject bool          // SubjectMapper was supplied by the caller
+	accessExpiry  time.Duration // Config.TokenExpiry, parsed by New
+	refreshExpiry time.Duration // Config.RefreshExpiry, parsed by New
+	rememberMe    time.Duration // Config.RememberMeExpiry, parsed by New
+	maxAccess     time.Duration // Config.MaxTokenExpiry, parsed by New
+	maxRefresh    time.Duration // Config.MaxRefreshExpiry, parsed by New
+	done          chan struct{} // Closed by Close to stop background janitors
+	closeOnce     sync.Once
+	closed        atomic.Bool
+	wg            sync.WaitGroup
+	nonces        nonceState
+
+	revocationJanitor sync.Once // Starts pruning on first revocation
+	lockoutJanitor    sync.Once // Starts pruning on first counted attempt
+	sessionJanitor    sync.Once // Starts pruning on first session
+	fingerprint       string    // Config snapshot for DebugChecks
+
+	dummyHash     string // Compared against for unknown users, see compareDummyPassword
+	dummyHashOnce sync.Once
+
+	limiter        *rateLimiter                 // Per-client request limits, see AllowRequest
+	hashLimiter    *hashLimiter                 // Bounds concurrent hashes, nil unless Config.MaxConcurrentHashes is set
+	tokenCache     *tokenCache                  // Validated tokens, nil unless Config.TokenCacheSize is set
+	userStatuses   *userStatusCache             // Nil unless Config.ValidateUserOnRequest is set
+	emailTemplates map[EmailKind]*emailTemplate // Parsed Config.EmailTemplates
+
+	keys       *keyring       // Signing and verification keys
+	remoteKeys *remoteKeySet  // Set when validating against Config.JWKSURL
+	exchange   *tokenExchange // Set with Config.TokenExchange
+	bruteForce *bruteForce    // Set with Config.BruteForce
+
+	webhooks *webhookDispatcher // Set when Config.Webhooks has endpoints
 }
 
 // Config holds the configuration for AuthKit
 type Config struct {
 	JWTSecret     string
-	TokenExpiry   string // e.g., "24h", "1h", "30m"
-	RefreshExpiry string // e.g., "7d", "30d"
+	TokenExpiry   string // e.g., "24h", "1h", "30m", "7d"
+	RefreshExpiry string // e.g., "7d", "30d", "2w"
 	BCryptCost    int    // bcrypt cost (default: 12)
-	RateLimitRPM  int    // Rate limit per minute
-	EmailRequired bool   // Require email verification
+	RateLimitRPM  int    // Requests per minute per client for the bundled handlers (default: 60, negative disables)
+	EmailRequired bool   // Require a verified email to log in (see VerifyEmail)
+
+	// RememberMeExpiry is the refresh token lifetime of logins with
+	// LoginOptions.RememberMe (default: "30d")
+	RememberMeExpiry string
+	// MaxTokenExpiry and MaxRefreshExpiry cap the lifetimes LoginOptions may
+	// ask for; longer requests are clamped. They default to TokenExpiry and
+	// to the longer of RefreshExpiry and RememberMeExpiry.
+	MaxTokenExpiry   string
+	MaxRefreshExpiry string
+	// RefreshAbsoluteLifetime ends sessions this long after the login,
+	// however often they are refreshed (default: 0, no limit)
+	RefreshAbsoluteLifetime time.Duration
+	// RefreshIdleTimeout rejects refresh tokens that went unused for this
+	// long (default: 0, no limit)
+	RefreshIdleTimeout time.Duration
+
+	// CaseSensitiveEmailLocalPart keeps the case of the part of emails before
+	// the "@" when normalizing them (see NormalizeEmail). Domains are always
+	// case-insensitive.
+	CaseSensitiveEmailLocalPart bool
+
+	// PasswordHasher hashes new passwords: "bcrypt" (default) or "argon2id".
+	// Hashes of either scheme are accepted on login, so both can coexist.
+	PasswordHasher string
+	// Argon2 tunes the "argon2id" PasswordHasher
+	Argon2 Argon2Params
+	// RehashOnLogin replaces a user's password hash on successful login when it
+	// was made with another PasswordHasher, BCryptCost or Argon2 than configured
+	RehashOnLogin bool
+	// MaxConcurrentHashes bounds how many password hashes and comparisons run
+	// at once, so bursts of logins and registrations can't take every core
+	// from token validation (default: unlimited). Others wait for a slot
+	// until their context is done.
+	MaxConcurrentHashes int
+	// MaxHashQueue is how many hashes may wait for a slot before new ones
+	// fail fast with ErrServerBusy (default: unlimited)
+	MaxHashQueue int
+
+	// PasswordPepper is a server-side secret mixed into passwords before they
+	// are hashed, as HMAC-SHA256(pepper, password), so a dump of the user store
+	// alone isn't enough to crack them. Keep it out of the store it protects.
+	PasswordPepper string
+	// PreviousPasswordPeppers are retired peppers, newest first and at most 5,
+	// that hashes are still checked with. Logging in with one rehashes the
+	// password with PasswordPepper. An empty entry matches hashes made without
+	// a pepper, for introducing one.
+	PreviousPasswordPeppers []string
+
+	// BreachChecker rejects new passwords found in known data breaches, such
+	// as HIBPChecker, in RegisterUser, ChangePassword and ResetPassword
+	BreachChecker BreachChecker
+	// BreachCheckFailClosed rejects passwords with ErrBreachCheckUnavailable
+	// when the BreachChecker fails, instead of accepting them
+	BreachCheckFailClosed bool
+
+	// AllowedSelfRegisterRoles are the roles RegisterUser accepts in requests
+	// (default: ["user"]). Use AdminCreateUser to register other roles.
+	AllowedSelfRegisterRoles []string
+	// DowngradeSelfRegisterRoles registers requests for other roles with the
+	// default "user" role instead of failing with ErrRoleNotAllowed
+	DowngradeSelfRegisterRoles bool
+	// SelfServiceMetadataKeys are the User.Metadata keys users may set on
+	// their own profile with UpdateOwnProfile (default: none)
+	SelfServiceMetadataKeys []string
+
+	// Issuer is the "iss" claim of issued tokens, enforced by ValidateToken (default: "authkit")
+	Issuer string
+	// Audience is the "aud" claim of issued tokens (default: ["authkit-users"]).
+	// ValidateToken requires tokens to carry Audience[0], this service's own audience.
+	Audience []string
+
+	// JWKSURL switches to validating tokens issued by an external provider
+	// (Auth0, Cognito, Keycloak, ...) against its published keys. Issuer and
+	// Audience must be set to the provider's values; AuthKit can't issue tokens
+	// in this mode and needs no local users.
+	JWKSURL string
+	// JWKSCacheTTL is how long fetched keys are cached (default: 1h)
+	JWKSCacheTTL time.Duration
+	// RoleClaim is the claim path mapped to Claims.Role, e.g.
+	// "https://example.com/roles" or "realm_access.roles" (default: "role")
+	RoleClaim string
+	// PermissionsClaim is the claim path mapped to Claims.Permissions (default: "permissions")
+	PermissionsClaim string
+	// HTTPClient fetches the JWKS (default: a client with a 10s timeout)
+	HTTPClient *http.Client
+
+	// TokenMetadataFields lists the User.Metadata keys embedded in access tokens,
+	// which anyone holding the token can read. None are embedded by default;
+	// use []string{AllTokenMetadata} to embed everything.
+	TokenMetadataFields []string
+	// MaxTokenSize is the largest encoded token, in bytes, AuthKit will issue
+	// or accept (default: 8192). Longer tokens are rejected before parsing.
+	MaxTokenSize int
+
+	// PreviousJWTSecrets are retired HS256 secrets still accepted when validating
+	// tokens (newest first, at most 5). Signing always uses JWTSecret.
+	PreviousJWTSecrets []string
+	// SecretProvider supplies the HS256 secrets instead of JWTSecret and
+	// PreviousJWTSecrets, e.g. from a file or a KMS, see FileSecretProvider
+	SecretProvider SecretProvider
+
+	// SigningMethod is the JWT algorithm: "HS256" (default), "RS256", "RS512", "ES256" or "EdDSA"
+	SigningMethod string
+	// PrivateKeyPEM signs tokens for asymmetric methods. Services that only
+	// validate tokens can leave it empty and set PublicKeyPEM alone.
+	PrivateKeyPEM string
+	// PublicKeyPEM verifies tokens for asymmetric methods (default: derived from PrivateKeyPEM)
+	PublicKeyPEM string
+	// VerificationKeysPEM are extra public keys still accepted during key rotation
+	VerificationKeysPEM []string
+
+	// SubjectMapper maps a user to the JWT "sub" claim (default: user ID)
+	SubjectMapper func(user *User) string
+	// SubjectResolver maps a "sub" claim back to a user; required when SubjectMapper is set
+	SubjectResolver func(a *AuthKit, subject string) (*User, error)
+
+	// DeletionGracePeriod keeps self-deleted accounts recoverable for this long before purging (0 = delete immediately)
+	DeletionGracePeriod time.Duration
+	// SoftDelete makes DeleteUser, and purges after DeletionGracePeriod, set
+	// User.DeletedAt instead of removing the record, see RestoreUser and PurgeUser
+	SoftDelete bool
+	// ReuseDeletedEmails lets new users register the email of a soft-deleted
+	// user, orphaning the old record. By default the email stays taken.
+	ReuseDeletedEmails bool
+	// JanitorInterval controls how often background cleanup runs (default: 1m)
+	JanitorInterval time.Duration
+	// Clock is the time source for timestamps and expiry checks (default: SystemClock)
+	Clock Clock
+	// TokenCacheSize is how many validated access tokens ValidateToken keeps
+	// parsed, skipping the signature check on repeat validations (0 disables).
+	// Revocation, token version and user checks still run on every call.
+	TokenCacheSize int
+	// TokenCacheTTL bounds how long a token stays cached, and so how long a
+	// retired signing secret keeps being accepted for it (default: 1m)
+	TokenCacheTTL time.Duration
+
+	// NonceStore holds single-use nonces (default: in-memory)
+	NonceStore NonceStore
+	// RevocationStore holds revoked token IDs (default: in-memory)
+	RevocationStore RevocationStore
+
+	// Messages is the catalog used to localize error responses (default: built-in en/fr/de)
+	Messages *MessageCatalog
+	// DefaultLocale is used when a request doesn't ask for a supported locale (default: "en")
+	DefaultLocale string
+	// ErrorResponder builds the error responses of the bundled handlers and
+	// middleware, e.g. as RFC 7807 problem details (default: DefaultErrorResponder)
+	ErrorResponder ErrorResponder
+
+	// SeedFile is a YAML or JSON seed document applied by New (see LoadSeed)
+	SeedFile string
+	// SeedStrategy decides whether seeding skips or updates existing users (default: SeedSkipExisting)
+	SeedStrategy SeedStrategy
+
+	// PasswordPolicy is enforced on new passwords (default: 8 to 72 characters)
+	PasswordPolicy PasswordPolicy
+
+	// PasswordResetExpiry is how long password reset tokens stay valid (default: 30m)
+	PasswordResetExpiry time.Duration
+	// SendPasswordReset delivers a password reset token to the user, replacing
+	// the built-in email sent through EmailSender
+	SendPasswordReset func(user *UserInfo, token string) error
+	// PasswordResetURL is the page reset links point to; the token is added as
+	// the "token" query parameter
+	PasswordResetURL string
+
+	// EmailVerificationExpiry is how long email verification tokens stay valid (default: 24h)
+	EmailVerificationExpiry time.Duration
+	// SendEmailVerification delivers an email verification token to the user,
+	// replacing the built-in email sent through EmailSender
+	SendEmailVerification func(user *UserInfo, token string) error
+	// EmailVerificationURL is the page verification links point to; the token
+	// is added as the "token" query parameter
+	EmailVerificationURL string
+	// SendEmailChange delivers an email change confirmation token to the
+	// requested address, set as user.Email, replacing the built-in email sent
+	// through EmailSender
+	SendEmailChange func(user *UserInfo, token string) error
+	// EmailChangeURL is the page email change links point to; the token is
+	// added as the "token" query parameter
+	EmailChangeURL string
+
+	// LoginLinkExpiry is how long magic link login tokens stay valid (default: 15m)
+	LoginLinkExpiry time.Duration
+	// SendLoginLink delivers a magic link login token, replacing the built-in
+	// email sent through EmailSender. For emails that aren't registered yet
+	// (see AutoCreateOnMagicLink) user only has Email set.
+	SendLoginLink func(user *UserInfo, token string) error
+	// LoginLinkURL is the page login links point to; the token is added as the
+	// "token" query parameter
+	LoginLinkURL string
+	// AutoCreateOnMagicLink lets login links be requested for unregistered
+	// emails, creating a passwordless account when the link is used
+	AutoCreateOnMagicLink bool
+	// LinkIdentitiesByEmail lets LoginWithIdentity log in the user with the
+	// identity's email, linking the identity, when the provider verified the
+	// email. Otherwise users must link identities while logged in.
+	LinkIdentitiesByEmail bool
+
+	// EmailSender sends the built-in emails (see SMTPSender and MemoryEmailSender)
+	EmailSender EmailSender
+	// EmailTemplates overrides the built-in emails
+	EmailTemplates map[EmailKind]EmailTemplate
+	// NewLoginAlerts emails users after each successful login
+	NewLoginAlerts bool
+
+	// RateLimitByEmail also rate limits login and registration per email address,
+	// which slows down attacks spread across many IPs
+	RateLimitByEmail bool
+
+	// MaxLoginAttempts is how many logins within LockoutWindow lock an account
+	// unless one succeeds (default: 5, negative disables lockout)
+	MaxLoginAttempts int
+	// LockoutWindow is how long login attempts keep counting (default: 15m)
+	LockoutWindow time.Duration
+	// LockoutDuration is how long a locked account rejects logins (default: 15m)
+	LockoutDuration time.Duration
+	// LockoutStore holds login attempt counters (default: in-memory)
+	LockoutStore LockoutStore
+
+	// LoginHistorySize is how many login attempts are kept per user, see
+	// GetLoginHistory (default: 20, negative disables the history)
+	LoginHistorySize int
+	// LoginHistoryStore holds the login history (default: in-memory)
+	LoginHistoryStore LoginHistoryStore
+
+	// UserSearcher runs SearchUsers against a backend (default: scanning the
+	// in-memory users)
+	UserSearcher UserSearcher
+
+	// AuditLogger receives an AuditEvent for registrations, logins, refreshes,
+	// user updates, role changes, deletions, revocations and IP bans (default: none),
+	// see MemoryAuditLog and JSONAuditLogger
+	AuditLogger AuditLogger
+
+	// Hooks are callbacks run after registrations, logins, refreshes, updates
+	// and deletions
+	Hooks Hooks
+	// Webhooks posts audit events to external endpoints (default: none)
+	Webhooks *WebhookConfig
+	// Logger receives structured records of logins, token validation failures,
+	// registration conflicts, revocations and middleware rejections (default:
+	// discarded). Passwords, tokens and secrets are never logged.
+	Logger *slog.Logger
+	// Metrics counts logins, registrations, token validations, refreshes and
+	// middleware rejections (default: none), see NewPrometheusMetrics
+	Metrics Metrics
+	// Tracer wraps logins, registrations, token validations, refreshes and
+	// store calls in spans (default: none), see the otelauthkit package
+	Tracer Tracer
+	// TraceHashUserIDs replaces user IDs in span attributes with a hash
+	TraceHashUserIDs bool
+
+	// EncryptionKey encrypts secrets stored on users, such as TOTP secrets;
+	// two-factor authentication fails with ErrInvalidConfig without it
+	EncryptionKey string
+	// MFATokenExpiry is how long the token LoginUser returns for MFA users
+	// stays valid (default: 5m)
+	MFATokenExpiry time.Duration
+
+	// ServiceAccountRole is the role of service accounts, checked by
+	// RequireRole like a user's role (default: "service")
+	ServiceAccountRole string
+
+	// RoleHierarchy maps a role to the roles it inherits, such as
+	// {"admin": {"moderator"}, "moderator": {"user"}}. Role checks accept any
+	// role that inherits the required one, transitively. Cycles are rejected.
+	RoleHierarchy map[string][]string
+
+	// Enforcer decides the checks of the RequirePolicy middlewares, such as a
+	// *casbin.Enforcer (default: nil, RequirePolicy panics)
+	Enforcer Enforcer
+	// PolicySubject selects the subject RequirePolicy passes to Enforcer
+	// (default: PolicySubjectUserID)
+	PolicySubject PolicySubject
+
+	// GRPCPublicMethods lists full gRPC method names, such as
+	// "/grpc.health.v1.Health/Check", that the gRPC interceptors let through
+	// without a token
+	GRPCPublicMethods []string
+
+	// CookieConfig makes the bundled handlers deliver tokens in HttpOnly
+	// cookies rather than the response body (default: nil, tokens in the body)
+	CookieConfig *CookieConfig
+
+	// TenantResolver derives the tenant of requests to the bundled register
+	// and login handlers (default: nil, every user in the default tenant)
+	TenantResolver *TenantResolver
+
+	// SlidingSession makes the middlewares renew access tokens close to
+	// expiry (default: nil, tokens are only renewed by refreshing)
+	SlidingSession *SlidingSession
+
+	// OIDC makes AuthKit an OpenID Connect provider, issuing ID tokens with
+	// every login (default: nil, no ID tokens)
+	OIDC *OIDCConfig
+
+	// TokenExchange lets clients exchange the ID tokens of external identity
+	// providers, such as Firebase, for AuthKit tokens (default: nil, disabled)
+	TokenExchange *TokenExchangeConfig
+
+	// BruteForce configures BruteForceProtection, which throttles and bans
+	// client IPs that keep failing requests (default: nil, disabled)
+	BruteForce *BruteForceConfig
+
+	// BearerRealm is the realm of the WWW-Authenticate challenge the
+	// middlewares send with 401 and 403 responses (default: Issuer)
+	BearerRealm string
+
+	// OptionalAuthIgnoreInvalid makes the optional middlewares treat requests
+	// with an invalid or expired token as anonymous instead of rejecting them
+	OptionalAuthIgnoreInvalid bool
+
+	// KeepTokensOnPasswordChange stops password changes from revoking the user's
+	// existing tokens (by default they bump User.TokenVersion)
+	KeepTokensOnPasswordChange bool
+
+	// ValidateUserOnRequest makes ValidateToken, and so every middleware, check
+	// the user on each request and reject tokens of deleted users and of users
+	// whose token version changed with ErrInvalidToken, and of disabled users
+	// with ErrUserDisabled; the middlewares answer 401. Without it, access
+	// tokens issued before DeleteUser or DisableUser keep working until they
+	// expire. User statuses are cached, see UserStatusCacheSize.
+	ValidateUserOnRequest bool
+	// UserStatusCacheSize is how many users ValidateUserOnRequest keeps the
+	// status of (default: 10000). Entries are dropped whenever the user changes.
+	UserStatusCacheSize int
+	// UserStatusCacheTTL bounds how long a user's status stays cached (default: 30s)
+	UserStatusCacheTTL time.Duration
+	// CheckUserOnRequest is the former name of ValidateUserOnRequest; setting
+	// either enables the check.
+	//
+	// Deprecated: use ValidateUserOnRequest.
+	CheckUserOnRequest bool
+
+	// DebugChecks enables runtime assertions that detect API misuse, such as
+	// mutating configuration shared with New or calling Close twice. Not for production.
+	DebugChecks bool
 }
 
 // User represents a user in the system
 type User struct {
-	ID            string                 `json:"id"`
-	Email         string                 `json:"email"`
-	Password      string                 `json:"password,omitempty"` // Hashed password
-	Name          string                 `json:"name"`
-	Role          string                 `json:"role"`
-	Permissions   []string               `json:"permissions"`
-	EmailVerified bool                   `json:"email_verified"`
-	CreatedAt     time.Time              `json:"created_at"`
-	UpdatedAt     time.Time              `json:"updated_at"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	ID             string                 `json:"id"`
+	TenantID       string                 `json:"tenant_id,omitempty"` // Scopes the email, see LoginUserInTenant
+	Email          string                 `json:"email"`
+	Password       string                 `json:"-"` // Hashed password, never marshaled, see ExportUser
+	Name           string                 `json:"name"`
+	Role           string                 `json:"role"`
+	Permissions    []string               `json:"permissions"`
+	EmailVerified  bool                   `json:"email_verified"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	PurgeAt        *time.Time             `json:"purge_at,omitempty"`     // Set while the account is pending deletion
+	TokenVersion   int                    `json:"token_version"`          // Bumped to invalidate every issued token
+	TOTPSecret     string                 `json:"totp_secret,omitempty"`  // Encrypted, see EnrollTOTP
+	TOTPEnabled    bool                   `json:"totp_enabled,omitempty"` // Set by ConfirmTOTP
+	TOTPLastStep   int64                  `json:"totp_last_step,omitempty"`
+	RecoveryCodes  []string               `json:"recovery_codes,omitempty"` // bcrypt hashes of unused recovery codes
+	Disabled       bool                   `json:"disabled,omitempty"`       // Set by DisableUser
+	DisabledReason string                 `json:"disabled_reason,omitempty"`
+	DisabledAt     *time.Time             `json:"disabled_at,omitempty"`
+	DeletedAt      *time.Time             `json:"deleted_at,omitempty"` // Set by DeleteUser with Config.SoftDelete
+	LastLoginAt    *time.Time             `json:"last_login_at,omitempty"`
+	// MustChangePassword restricts the user's tokens to changing the password,
+	// see SetTemporaryPassword
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+	// Identities are the external identities the user can log in with, see
+	// LinkIdentity
+	Identities []LinkedIdentity `json:"identities,omitempty"`
+}
+
+// MarshalJSON leaves out the password hash, even if the field's tag is
+// changed. Use ExportUser or ExportUsers to move hashes between stores.
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return json.Marshal(struct {
+		user
+		Password string `json:"password,omitempty"` // Shadows the hash, always empty
+	}{user: user(u)})
 }
 
 // Claims represents JWT claims
@@ -46,6 +459,30 @@ type Claims struct {
 	Role        string                 `json:"role"`
 	Permissions []string               `json:"permissions"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	// TokenVersion must match the user's stored version for the token to be accepted
+	TokenVersion int `json:"token_version,omitempty"`
+	// AMR lists the authentication methods used (RFC 8176), set when MFA was completed
+	AMR []string `json:"amr,omitempty"`
+	// TokenUse is TokenUseClient for tokens issued to service accounts, in
+	// which case UserID is the client ID
+	TokenUse string `json:"token_use,omitempty"`
+	// SessionID is the session the token was issued for, see ListSessions
+	SessionID string `json:"sid,omitempty"`
+	// TenantID is the tenant of the user, empty in single-tenant deployments
+	TenantID string `json:"tenant_id,omitempty"`
+	// PasswordChangeRequired restricts the token to the change password
+	// route, see User.MustChangePassword
+	PasswordChangeRequired bool `json:"pwd_change_required,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// refreshClaims are the claims carried by refresh tokens
+type refreshClaims struct {
+	TokenVersion int      `json:"token_version,omitempty"`
+	AMR          []string `json:"amr,omitempty"`
+	SessionID    string   `json:"sid,omitempty"`
+	// AuthTime is when the user logged in, carried over by each refresh
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -56,23 +493,67 @@ type TokenResponse struct {
 	TokenType    string    `json:"token_type"`
 	ExpiresIn    int64     `json:"expires_in"`
 	User         *UserInfo `json:"user"`
+	// IDToken is the OpenID Connect ID token, set with Config.OIDC
+	IDToken string `json:"id_token,omitempty"`
+	// RefreshExpiresIn is the lifetime of RefreshToken in seconds
+	RefreshExpiresIn int64 `json:"refresh_expires_in,omitempty"`
+	// MFARequired is set instead of the tokens above for users with MFA
+	// enabled; exchange MFAToken with CompleteMFALogin
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	// SessionID identifies the session the tokens belong to
+	SessionID string `json:"session_id,omitempty"`
+	// PasswordChangeRequired is set when the access token only permits
+	// changing the password, see User.MustChangePassword
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// ReauthenticateAt is when the session ends however often it is
+	// refreshed, set with Config.RefreshAbsoluteLifetime
+	ReauthenticateAt *time.Time `json:"reauthenticate_at,omitempty"`
+	// Scope lists the permissions in the access token, space-separated,
+	// for logins with LoginOptions.Scope
+	Scope string `json:"scope,omitempty"`
 }
 
 // UserInfo represents safe user information (without password)
 type UserInfo struct {
-	ID            string                 `json:"id"`
-	Email         string                 `json:"email"`
-	Name          string                 `json:"name"`
-	Role          string                 `json:"role"`
-	Permissions   []string               `json:"permissions"`
-	EmailVerified bool                   `json:"email_verified"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	ID                 string                 `json:"id"`
+	TenantID           string                 `json:"tenant_id,omitempty"`
+	Email              string                 `json:"email"`
+	Name               string                 `json:"name"`
+	Role               string                 `json:"role"`
+	Permissions        []string               `json:"permissions"`
+	EmailVerified      bool                   `json:"email_verified"`
+	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+	PendingDeletion    bool                   `json:"pending_deletion,omitempty"`
+	PurgeAt            *time.Time             `json:"purge_at,omitempty"`
+	Locked             bool                   `json:"locked,omitempty"`
+	LockedUntil        *time.Time             `json:"locked_until,omitempty"`
+	MFAEnabled         bool                   `json:"mfa_enabled,omitempty"`
+	Disabled           bool                   `json:"disabled,omitempty"`
+	DisabledReason     string                 `json:"disabled_reason,omitempty"`
+	DisabledAt         *time.Time             `json:"disabled_at,omitempty"`
+	DeletedAt          *time.Time             `json:"deleted_at,omitempty"`
+	LastLoginAt        *time.Time             `json:"last_login_at,omitempty"`
+	MustChangePassword bool                   `json:"must_change_password,omitempty"`
+	Identities         []LinkedIdentity       `json:"identities,omitempty"`
 }
 
 // LoginRequest represents login request payload
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// RememberMe asks for a refresh token lasting Config.RememberMeExpiry
+	RememberMe bool `json:"remember_me,omitempty"`
+	// Nonce is echoed in the ID token, see LoginOptions.Nonce
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// TokenExchangeRequest represents the payload of TokenExchangeHandler
+type TokenExchangeRequest struct {
+	Provider string `json:"provider" binding:"required"` // See ExternalTokenProvider.Name
+	IDToken  string `json:"id_token" binding:"required"`
+	// Nonce is echoed in the ID token, see LoginOptions.Nonce
+	Nonce string `json:"nonce,omitempty"`
 }
 
 // RegisterRequest represents registration request payload
@@ -82,6 +563,93 @@ type RegisterRequest struct {
 	Name     string                 `json:"name" binding:"required"`
 	Role     string                 `json:"role,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// TenantID is the tenant to register in. The bundled register handlers
+	// replace it with the tenant of the request, see Config.TenantResolver.
+	TenantID string `json:"tenant_id,omitempty"`
+	// MustChangePassword makes the user change the password on first login.
+	// It is ignored by RegisterUser.
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+}
+
+// ChangePasswordRequest represents the change password request payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest represents the forgot password request payload
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the reset password request payload
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResendVerificationRequest represents the resend verification email request payload
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// TOTPCodeRequest represents the confirm TOTP request payload
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginRequest represents the MFA verification request payload
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// LoginLinkRequest represents the request login link payload
+type LoginLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// LinkLoginRequest represents the login with link token payload
+type LinkLoginRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DisableUserRequest represents the optional disable user payload
+type DisableUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminUpdateUserRequest represents the admin update user payload. Absent
+// fields are left unchanged; metadata replaces the stored metadata.
+type AdminUpdateUserRequest struct {
+	Name        *string                `json:"name,omitempty"`
+	Role        *string                `json:"role,omitempty"`
+	Permissions []string               `json:"permissions,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	// MustChangePassword restricts the user's tokens until they change their password
+	MustChangePassword *bool `json:"must_change_password,omitempty"`
+}
+
+// SetRoleRequest represents the admin set role payload
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// DefineRoleRequest represents the define role payload
+type DefineRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// EmailChangeRequest represents the request email change payload
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+}
+
+// ClientCredentialsRequest represents the service account login payload
+type ClientCredentialsRequest struct {
+	ClientID     string `json:"client_id" binding:"required"`
+	ClientSecret string `json:"client_secret" binding:"required"`
 }
 
 // RefreshRequest represents refresh token request
@@ -89,13 +657,122 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// LogoutRequest represents the optional logout request payload
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// AllTokenMetadata in Config.TokenMetadataFields embeds all user metadata in access tokens
+const AllTokenMetadata = "*"
+
+// expiredAtHeader carries the exp timestamp of a rejected expired token
+const expiredAtHeader = "X-Token-Expired-At"
+
 // Common errors
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrInvalidPassword   = errors.New("invalid password")
-	ErrUserAlreadyExists = errors.New("user already exists")
-	ErrInvalidToken      = errors.New("invalid token")
-	ErrTokenExpired      = errors.New("token expired")
-	ErrUnauthorized      = errors.New("unauthorized")
-	ErrInsufficientRole  = errors.New("insufficient role permissions")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrInvalidCredentials is returned by LoginUser for both unknown emails and
+	// wrong passwords, so callers can't probe which emails are registered
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserAlreadyExists  = errors.New("user already exists")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrInsufficientRole   = errors.New("insufficient role permissions")
+	ErrInvalidConfig      = errors.New("invalid configuration")
+	ErrInvalidSubject     = errors.New("invalid token subject")
+
+	ErrAccountPendingDeletion    = errors.New("account is pending deletion")
+	ErrAccountNotPendingDeletion = errors.New("account is not pending deletion")
+	ErrInvalidNonce              = errors.New("invalid nonce")
+	ErrNonceExpired              = errors.New("nonce expired")
+	ErrTokenRevoked              = errors.New("token revoked")
+	ErrNoSigningKey              = errors.New("no signing key configured")
+	ErrKeyNotFound               = errors.New("key not found")
+	ErrTokenTooLarge             = errors.New("token too large")
+	ErrAccountLocked             = errors.New("account is locked")
+	ErrRateLimited               = errors.New("rate limit exceeded")
+	// ErrServerBusy is returned when more password hashes are waiting than
+	// Config.MaxHashQueue allows
+	ErrServerBusy = errors.New("server busy")
+	// ErrWeakPassword is wrapped by a *PasswordPolicyError listing the failed rules
+	ErrWeakPassword = errors.New("password does not meet the password policy")
+	// ErrPasswordBreached is wrapped by a *PasswordBreachedError with the breach count
+	ErrPasswordBreached = errors.New("password appears in known data breaches")
+	// ErrBreachCheckUnavailable is returned when the BreachChecker fails and
+	// Config.BreachCheckFailClosed is set
+	ErrBreachCheckUnavailable = errors.New("breached password check unavailable")
+	// ErrEmailNotVerified is returned by LoginUser when Config.EmailRequired is
+	// set and the user hasn't verified their email
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrNoEmailSender is returned by flows that need to send an email when
+	// neither Config.EmailSender nor the flow's callback is set
+	ErrNoEmailSender = errors.New("no email sender configured")
+	ErrInvalidEmail  = errors.New("invalid email address")
+	// ErrInvalidMFACode is returned for a wrong, expired or already used TOTP code
+	ErrInvalidMFACode    = errors.New("invalid MFA code")
+	ErrMFANotEnabled     = errors.New("MFA is not enabled")
+	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
+	// ErrMFARequired rejects users with TOTP enabled where no second factor
+	// can be given, such as BasicAuthMiddleware
+	ErrMFARequired = errors.New("MFA is required")
+	// ErrInvalidClientCredentials is returned by ClientCredentialsLogin for both
+	// unknown client IDs and wrong secrets
+	ErrInvalidClientCredentials = errors.New("invalid client credentials")
+	ErrServiceAccountNotFound   = errors.New("service account not found")
+	ErrSessionNotFound          = errors.New("session not found")
+	// ErrSessionExpired is returned by RefreshToken once the session is older
+	// than Config.RefreshAbsoluteLifetime; the user must log in again
+	ErrSessionExpired = errors.New("session expired")
+	// ErrSessionIdle is returned by RefreshToken for refresh tokens unused for
+	// longer than Config.RefreshIdleTimeout; the user must log in again
+	ErrSessionIdle = errors.New("session idle for too long")
+	// ErrInvalidCSRFToken rejects cookie-authenticated requests without a
+	// matching CSRF token, see CookieConfig.CSRF
+	ErrInvalidCSRFToken = errors.New("invalid CSRF token")
+
+	ErrRoleNotFound = errors.New("role not found")
+	ErrInvalidRole  = errors.New("invalid role")
+	// ErrRoleNotAllowed is returned by RegisterUser for roles outside
+	// Config.AllowedSelfRegisterRoles
+	ErrRoleNotAllowed = errors.New("role not allowed for self-registration")
+	// ErrRestrictedField is wrapped by a *RestrictedFieldError naming a field
+	// users can't change on their own profile
+	ErrRestrictedField = errors.New("field cannot be changed by the user")
+	// ErrAccessDenied is wrapped by an *AccessDeniedError naming the policy
+	// that denied an action in Authorize
+	ErrAccessDenied = errors.New("access denied")
+	// ErrUserDisabled is returned when a user disabled with DisableUser tries
+	// to log in or refresh, or uses a token with Config.ValidateUserOnRequest set
+	ErrUserDisabled   = errors.New("user is disabled")
+	ErrUserNotDeleted = errors.New("user is not deleted")
+	// ErrInvalidSearchQuery is returned by SearchUsers for an empty query
+	ErrInvalidSearchQuery = errors.New("search query is required")
+	// ErrBatchTooLarge is returned by the bulk operations for more than 10000 items
+	ErrBatchTooLarge = errors.New("batch too large")
+	// ErrIdentityNotLinked is returned by LoginWithIdentity for an identity
+	// whose email belongs to a user it isn't linked to
+	ErrIdentityNotLinked = errors.New("email is registered to a user the identity isn't linked to")
+	// ErrIdentityAlreadyLinked is returned by LinkIdentity for an identity
+	// linked to another user, or a provider the user has another identity at
+	ErrIdentityAlreadyLinked = errors.New("identity is already linked")
+	ErrIdentityNotFound      = errors.New("identity not found")
+	// ErrUnknownIdentityProvider is returned for providers that aren't configured
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	// ErrIdentityProviderFailed is returned when signing in with an identity
+	// provider fails, e.g. exchanging the code or fetching the profile
+	ErrIdentityProviderFailed = errors.New("identity provider sign-in failed")
+	// ErrOIDCDisabled is returned by OpenIDConfiguration without Config.OIDC
+	ErrOIDCDisabled = errors.New("OpenID Connect is not enabled")
+	// ErrBruteForceDisabled is returned by the brute-force admin API without
+	// Config.BruteForce
+	ErrBruteForceDisabled = errors.New("brute-force protection is not enabled")
+	// ErrIPBanned rejects requests from a client IP banned by
+	// BruteForceProtection after too many failures
+	ErrIPBanned         = errors.New("client IP is temporarily banned")
+	ErrInvalidIPAddress = errors.New("invalid IP address")
+	// ErrWebhookQueueFull is passed to WebhookConfig.OnError for events
+	// dropped because an endpoint's queue was full
+	ErrWebhookQueueFull = errors.New("webhook queue full")
 )
@@ -0,0 +1,173 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for ListOptions
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// ListOptions selects a page of users
+type ListOptions struct {
+	Offset int
+	Limit  int // Default 50, at most 500
+	// MetadataKey makes SearchUsers also match the value stored under this
+	// metadata key
+	MetadataKey string
+}
+
+// UserPage is a page of users and the total number of matches
+type UserPage struct {
+	Users  []*UserInfo `json:"users"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+// UserSearcher runs SearchUsers against a backend, e.g. as a SQL LIKE
+// query, see Config.UserSearcher. It receives the caller's context, a
+// non-empty query and options with the defaults applied.
+type UserSearcher interface {
+	SearchUsers(ctx context.Context, query string, opts ListOptions) (*UserPage, error)
+}
+
+// withDefaults clamps the offset and limit to their allowed range
+func (o ListOptions) withDefaults() ListOptions {
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+	if o.Limit <= 0 {
+		o.Limit = defaultPageSize
+	}
+	if o.Limit > maxPageSize {
+		o.Limit = maxPageSize
+	}
+	return o
+}
+
+// SearchUsers returns the users whose email or name contains query, ignoring
+// case, ordered by email. Soft-deleted users are left out. An empty query
+// returns ErrInvalidSearchQuery rather than everyone; use ListUsers for that.
+func (a *AuthKit) SearchUsers(query string, opts ListOptions) (*UserPage, error) {
+	return a.SearchUsersCtx(context.Background(), query, opts)
+}
+
+// SearchUsersCtx is SearchUsers with a context, failing with ctx.Err() once
+// ctx is done. The context is passed on to Config.UserSearcher.
+func (a *AuthKit) SearchUsersCtx(ctx context.Context, query string, opts ListOptions) (*UserPage, error) {
+	a.debugCheck()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrInvalidSearchQuery
+	}
+	opts = opts.withDefaults()
+
+	if a.config.UserSearcher != nil {
+		return a.config.UserSearcher.SearchUsers(ctx, query, opts)
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	needle := strings.ToLower(query)
+	var matches []*User
+	for _, user := range a.users.all() {
+		if user.DeletedAt == nil && userMatches(user, needle, opts.MetadataKey) {
+			matches = append(matches, user)
+		}
+	}
+	return a.userPage(matches, opts), nil
+}
+
+// ListUsersPage returns a page of all users ordered by email, then tenant
+// and ID, leaving out soft-deleted users like ListUsers. opts.MetadataKey is
+// ignored.
+func (a *AuthKit) ListUsersPage(opts ListOptions) *UserPage {
+	a.debugCheck()
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	var users []*User
+	for _, user := range a.users.all() {
+		if user.DeletedAt == nil {
+			users = append(users, user)
+		}
+	}
+	return a.userPage(users, opts.withDefaults())
+}
+
+// userPage sorts users by email, then tenant and ID, so users sharing an
+// email across tenants keep their order between pages, and returns the page
+// opts selects. Callers must hold a.mutex.
+func (a *AuthKit) userPage(users []*User, opts ListOptions) *UserPage {
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].Email != users[j].Email {
+			return users[i].Email < users[j].Email
+		}
+		if users[i].TenantID != users[j].TenantID {
+			return users[i].TenantID < users[j].TenantID
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	page := &UserPage{Users: make([]*UserInfo, 0), Total: len(users), Offset: opts.Offset, Limit: opts.Limit}
+	for i := opts.Offset; i < len(users) && len(page.Users) < opts.Limit; i++ {
+		page.Users = append(page.Users, a.userToUserInfo(users[i]))
+	}
+	return page
+}
+
+// userMatches reports whether the user's email, name or metadata value
+// under key contains the lowercase needle
+func userMatches(user *User, needle, key string) bool {
+	if strings.Contains(strings.ToLower(user.Email), needle) || strings.Contains(strings.ToLower(user.Name), needle) {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	value, exists := user.Metadata[key]
+	return exists && value != nil && strings.Contains(strings.ToLower(fmt.Sprint(value)), needle)
+}
+
+// parseListOptions reads the offset, limit and metadata_key query parameters
+func parseListOptions(query func(string) string) (ListOptions, error) {
+	opts := ListOptions{MetadataKey: query("metadata_key")}
+	params := []struct {
+		name   string
+		target *int
+	}{{"offset", &opts.Offset}, {"limit", &opts.Limit}}
+	for _, param := range params {
+		if value := query(param.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q", param.name, value)
+			}
+			*param.target = n
+		}
+	}
+	return opts, nil
+}
+
+// searchErrorStatus maps SearchUsers errors to HTTP status codes
+func searchErrorStatus(err error) int {
+	if errors.Is(err, ErrInvalidSearchQuery) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,191 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newSearchTestKit creates users to search through, one of them soft-deleted
+func newSearchTestKit(t *testing.T) *AuthKit {
+	t.Helper()
+	auth := newTestKit(t, Config{SoftDelete: true})
+	users := []RegisterRequest{
+		{Email: "alice@example.com", Name: "Alice Smith", Metadata: map[string]interface{}{"company": "Acme"}},
+		{Email: "bob@example.org", Name: "Bob Jones", Metadata: map[string]interface{}{"company": "Globex"}},
+		{Email: "carol@acme.io", Name: "Carol Smith"},
+		{Email: "dave@example.com", Name: "Dave Smithers"},
+	}
+	for _, req := range users {
+		req.Password = "password123"
+		if _, err := auth.RegisterUser(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dave, _ := auth.GetUserByEmail("dave@example.com")
+	_ = auth.DeleteUser(dave.ID)
+	return auth
+}
+
+func searchEmails(page *UserPage) []string {
+	emails := make([]string, 0, len(page.Users))
+	for _, user := range page.Users {
+		emails = append(emails, user.Email)
+	}
+	return emails
+}
+
+func TestSearchUsers(t *testing.T) {
+	auth := newSearchTestKit(t)
+	defer auth.Close()
+
+	tests := []struct {
+		name  string
+		query string
+		opts  ListOptions
+		want  string
+		total int
+	}{
+		{"email substring", "EXAMPLE", ListOptions{}, "alice@example.com,bob@example.org", 2},
+		{"name substring", "smith", ListOptions{}, "alice@example.com,carol@acme.io", 2},
+		{"email prefix", "bob@", ListOptions{}, "bob@example.org", 1},
+		{"metadata ignored by default", "globex", ListOptions{}, "", 0},
+		{"metadata key", "acme", ListOptions{MetadataKey: "company"}, "alice@example.com,carol@acme.io", 2},
+		{"limit", "o", ListOptions{Limit: 2}, "alice@example.com,bob@example.org", 3},
+		{"offset", "o", ListOptions{Offset: 2, Limit: 2}, "carol@acme.io", 3},
+		{"offset past the end", "o", ListOptions{Offset: 10}, "", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := auth.SearchUsers(tt.query, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(searchEmails(page), ","); got != tt.want || page.Total != tt.total {
+				t.Errorf("Expected %q of %d, got %q of %d", tt.want, tt.total, got, page.Total)
+			}
+		})
+	}
+
+	for _, query := range []string{"", "   "} {
+		if _, err := auth.SearchUsers(query, ListOptions{}); !errors.Is(err, ErrInvalidSearchQuery) {
+			t.Errorf("Expected ErrInvalidSearchQuery for %q, got %v", query, err)
+		}
+	}
+	if page, _ := auth.SearchUsers("a", ListOptions{Offset: -1, Limit: 1000}); page.Offset != 0 || page.Limit != maxPageSize {
+		t.Errorf("Expected the options to be clamped, got offset %d and limit %d", page.Offset, page.Limit)
+	}
+}
+
+// staticSearcher is a UserSearcher recording what it was asked
+type staticSearcher struct {
+	query string
+	opts  ListOptions
+}
+
+func (s *staticSearcher) SearchUsers(ctx context.Context, query string, opts ListOptions) (*UserPage, error) {
+	s.query, s.opts = query, opts
+	return &UserPage{Users: []*UserInfo{{Email: "sql@example.com"}}, Total: 1, Limit: opts.Limit}, nil
+}
+
+func TestListUsersPageTenants(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	for _, tenant := range []string{"globex", "acme", ""} {
+		if _, err := auth.RegisterUser(RegisterRequest{TenantID: tenant, Email: "shared@example.com", Password: "password123"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Paging one user at a time visits each tenant's user once, in the same
+	// order every time
+	for round := 0; round < 10; round++ {
+		var tenants []string
+		for offset := 0; offset < 3; offset++ {
+			page := auth.ListUsersPage(ListOptions{Offset: offset, Limit: 1})
+			if len(page.Users) != 1 || page.Total != 3 {
+				t.Fatalf("Expected one of 3 users, got %+v", page)
+			}
+			tenants = append(tenants, page.Users[0].TenantID)
+		}
+		if got := strings.Join(tenants, ","); got != ",acme,globex" {
+			t.Fatalf("Expected the users ordered by tenant, got %q", got)
+		}
+	}
+}
+
+func TestSearchUsersWithSearcher(t *testing.T) {
+	searcher := &staticSearcher{}
+	auth := newTestKit(t, Config{UserSearcher: searcher})
+	defer auth.Close()
+
+	page, err := auth.SearchUsers("  sql ", ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != 1 || page.Users[0].Email != "sql@example.com" {
+		t.Errorf("Expected the searcher's page, got %+v", page)
+	}
+	if searcher.query != "sql" || searcher.opts.Limit != defaultPageSize {
+		t.Errorf("Expected the trimmed query and default limit, got %q and %+v", searcher.query, searcher.opts)
+	}
+	if _, err := auth.SearchUsers("", ListOptions{}); !errors.Is(err, ErrInvalidSearchQuery) {
+		t.Errorf("Expected empty queries to be rejected before the searcher, got %v", err)
+	}
+}
+
+func TestSearchUsersHandlers(t *testing.T) {
+	auth := newSearchTestKit(t)
+	defer auth.Close()
+
+	r := gin.New()
+	r.GET("/admin/users/search", auth.AdminSearchUsersHandler)
+	app := fiber.New()
+	app.Get("/admin/users/search", auth.AdminSearchUsersHandlerFiber)
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+	getFiber := func(path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		if err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+
+	for name, get := range map[string]func(path string) (int, string){"Gin": get, "Fiber": getFiber} {
+		code, body := get("/admin/users/search?q=smith&limit=1")
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d %s", name, code, body)
+		}
+		var page UserPage
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if emails := searchEmails(&page); len(emails) != 1 || emails[0] != "alice@example.com" || page.Total != 2 || page.Limit != 1 {
+			t.Errorf("%s: expected the first of two matches, got %+v", name, page)
+		}
+		if strings.Contains(body, "password") {
+			t.Errorf("%s: expected no password hashes in the response, got %s", name, body)
+		}
+
+		if code, body := get("/admin/users/search"); code != http.StatusBadRequest || !strings.Contains(body, CodeInvalidSearchQuery) {
+			t.Errorf("%s: expected 400 invalid_search_query, got %d %s", name, code, body)
+		}
+		if code, body := get("/admin/users/search?q=smith&offset=x"); code != http.StatusBadRequest || !strings.Contains(body, CodeInvalidRequest) {
+			t.Errorf("%s: expected 400 invalid_request for a bad offset, got %d %s", name, code, body)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package authkit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultUserStatusCacheSize is how many users the status cache holds
+	// when Config.UserStatusCacheSize isn't set
+	defaultUserStatusCacheSize = 10000
+	// defaultUserStatusCacheTTL is how long a user's status is cached when
+	// Config.UserStatusCacheTTL isn't set
+	defaultUserStatusCacheTTL = 30 * time.Second
+)
+
+// userSnapshot is what Config.ValidateUserOnRequest checks about a user
+type userSnapshot struct {
+	exists       bool // False for unknown and soft-deleted users
+	disabled     bool
+	tokenVersion int
+}
+
+// userStatusEntry is a snapshot kept by userStatusCache
+type userStatusEntry struct {
+	userID   string
+	snapshot userSnapshot
+	expires  time.Time
+}
+
+// userStatusCache is an LRU cache of user snapshots keyed by user ID, sparing
+// ValidateUserOnRequest a user table lookup per request. The user table
+// evicts a user on every write, so DeleteUser, DisableUser, UpdateUser and
+// token version bumps take effect on the next request; the TTL only bounds
+// how long an entry lives. It is nil unless Config.ValidateUserOnRequest is
+// set; get falls through to load on a nil cache.
+type userStatusCache struct {
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	order   *list.List // Of *userStatusEntry, most recently used first
+	entries map[string]*list.Element
+	epoch   uint64 // Bumped by evict, so a load racing a write isn't cached
+}
+
+// newUserStatusCache creates a cache holding up to size users for at most ttl
+func newUserStatusCache(size int, ttl time.Duration) *userStatusCache {
+	return &userStatusCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the snapshot cached for userID, calling load and caching its
+// result if there is none or it expired at now
+func (c *userStatusCache) get(userID string, now time.Time, load func() userSnapshot) userSnapshot {
+	if c == nil {
+		return load()
+	}
+
+	c.mutex.Lock()
+	if element, exists := c.entries[userID]; exists {
+		entry := element.Value.(*userStatusEntry)
+		if now.Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.mutex.Unlock()
+			return entry.snapshot
+		}
+		c.remove(element)
+	}
+	epoch := c.epoch
+	c.mutex.Unlock()
+
+	snapshot := load()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.epoch != epoch {
+		return snapshot
+	}
+	if element, exists := c.entries[userID]; exists {
+		c.remove(element)
+	}
+	c.entries[userID] = c.order.PushFront(&userStatusEntry{userID: userID, snapshot: snapshot, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return snapshot
+}
+
+// evict drops the snapshot of userID after the user changed
+func (c *userStatusCache) evict(userID string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.epoch++
+	if element, exists := c.entries[userID]; exists {
+		c.remove(element)
+	}
+}
+
+// remove drops an element; the caller holds mutex
+func (c *userStatusCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*userStatusEntry)
+	delete(c.entries, entry.userID)
+}
@@ -0,0 +1,97 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUserStatusCache(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{TokenExpiry: "1h", ValidateUserOnRequest: true, UserStatusCacheSize: 2, UserStatusCacheTTL: time.Minute, Clock: testClock(&now)})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "cached@example.com")
+	userID := tokens.User.ID
+
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil || auth.userStatuses.order.Len() != 1 {
+		t.Fatalf("Expected the user status cached, got %v with %d entries", err, auth.userStatuses.order.Len())
+	}
+
+	// Cached statuses are served without a lookup until the TTL passes
+	loads := 0
+	load := func() userSnapshot {
+		loads++
+		return userSnapshot{exists: true}
+	}
+	auth.userStatuses.get(userID, now, load)
+	if loads != 0 {
+		t.Errorf("Expected the cached status served, got %d loads", loads)
+	}
+	now = now.Add(2 * time.Minute)
+	auth.userStatuses.get(userID, now, load)
+	if loads != 1 {
+		t.Errorf("Expected an expired status reloaded, got %d loads", loads)
+	}
+
+	// Any write to the user drops their status
+	if err := auth.DisableUser(userID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, cached := auth.userStatuses.entries[userID]; cached {
+		t.Error("Expected DisableUser to evict the cached status")
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled, got %v", err)
+	}
+
+	// The least recently used user is evicted when the cache is full
+	for i := 0; i < 3; i++ {
+		token, _ := auth.GenerateCustomToken(fmt.Sprintf("user-%d", i), nil, time.Hour)
+		_, _ = auth.ValidateToken(token)
+	}
+	if _, cached := auth.userStatuses.entries["user-0"]; cached || auth.userStatuses.order.Len() != 2 {
+		t.Errorf("Expected the oldest user evicted, got %d entries", auth.userStatuses.order.Len())
+	}
+
+	if err := (Config{JWTSecret: "secret", UserStatusCacheSize: -1}).Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for a negative UserStatusCacheSize, got %v", err)
+	}
+}
+
+func TestUserStatusCacheRacingWrite(t *testing.T) {
+	cache := newUserStatusCache(10, time.Minute)
+	now := time.Now()
+
+	// A status loaded while the user changes is returned but not cached
+	cache.get("user", now, func() userSnapshot {
+		cache.evict("user")
+		return userSnapshot{exists: true}
+	})
+	if cache.order.Len() != 0 {
+		t.Errorf("Expected a status loaded during a write not cached, got %d entries", cache.order.Len())
+	}
+	cache.get("user", now, func() userSnapshot { return userSnapshot{exists: true} })
+	if cache.order.Len() != 1 {
+		t.Errorf("Expected the status cached, got %d entries", cache.order.Len())
+	}
+}
+
+func TestCheckUserOnRequestAlias(t *testing.T) {
+	auth := newTestKit(t, Config{CheckUserOnRequest: true})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "alias@example.com")
+
+	if auth.userStatuses == nil {
+		t.Fatal("Expected the deprecated CheckUserOnRequest to enable the user status cache")
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.DeleteUser(tokens.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a deleted user, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package authkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDisableUser(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "disabled@example.com")
+	userID := tokens.User.ID
+	loginTestUser(t, auth, "active@example.com")
+
+	if err := auth.DisableUser("missing", ""); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := auth.DisableUser(userID, "chargeback"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := auth.GetUserByID(userID)
+	if !user.Disabled || user.DisabledReason != "chargeback" || user.DisabledAt == nil {
+		t.Errorf("Expected the user to be disabled with a reason and time, got %+v", user)
+	}
+	if _, err := auth.LoginUser("disabled@example.com", "password123"); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled on login, got %v", err)
+	}
+	if _, err := auth.LoginUser("disabled@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a wrong password to stay ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled on refresh, got %v", err)
+	}
+	if _, err := auth.IssueTokensForUser(userID); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled from IssueTokensForUser, got %v", err)
+	}
+	// Without CheckUserOnRequest the access token works until it expires
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the access token to stay valid, got %v", err)
+	}
+
+	disabled := auth.ListUsersByStatus(UserStatusDisabled)
+	if len(disabled) != 1 || disabled[0].ID != userID || !disabled[0].Disabled {
+		t.Errorf("Expected only the disabled user, got %+v", disabled)
+	}
+	if active := auth.ListUsersByStatus(UserStatusActive); len(active) != 1 || active[0].Email != "active@example.com" {
+		t.Errorf("Expected only the active user, got %+v", active)
+	}
+	if unknown := auth.ListUsersByStatus("unknown"); len(unknown) != 0 {
+		t.Errorf("Expected no users for an unknown status, got %+v", unknown)
+	}
+
+	if err := auth.EnableUser(userID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := auth.GetUserByID(userID); user.Disabled || user.DisabledReason != "" || user.DisabledAt != nil {
+		t.Errorf("Expected the disabled fields to be cleared, got %+v", user)
+	}
+	if _, err := auth.LoginUser("disabled@example.com", "password123"); err != nil {
+		t.Errorf("Expected login after EnableUser, got %v", err)
+	}
+	if err := auth.EnableUser("missing"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestCheckUserOnRequest(t *testing.T) {
+	auth := newTestKit(t, Config{
+		CheckUserOnRequest: true,
+	})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "checked@example.com")
+
+	if w := ginRequest(auth, "Bearer "+tokens.AccessToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 before disabling, got %d", w.Code)
+	}
+	_ = auth.DisableUser(tokens.User.ID, "")
+
+	if _, err := auth.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled, got %v", err)
+	}
+	w := ginRequest(auth, "Bearer "+tokens.AccessToken)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), CodeUserDisabled) {
+		t.Errorf("Expected 401 user_disabled, got %d %s", w.Code, w.Body.String())
+	}
+
+	_ = auth.EnableUser(tokens.User.ID)
+	if _, err := auth.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected the token to work again after EnableUser, got %v", err)
+	}
+}
+
+func TestUserStatusHandlers(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	tokens := loginTestUser(t, auth, "status@example.com")
+	userID := tokens.User.ID
+
+	r := gin.New()
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/admin/users/:id/disable", auth.AdminDisableUserHandler)
+	r.POST("/admin/users/:id/enable", auth.AdminEnableUserHandler)
+	app := fiber.New()
+	app.Post("/login", auth.LoginHandlerFiber)
+	app.Post("/admin/users/:id/disable", auth.AdminDisableUserHandlerFiber)
+	app.Post("/admin/users/:id/enable", auth.AdminEnableUserHandlerFiber)
+
+	send := func(path, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	sendFiber := func(path, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Fiber request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+
+	login := `{"email":"status@example.com","password":"password123"}`
+	for name, send := range map[string]func(path, body string) (int, string){"Gin": send, "Fiber": sendFiber} {
+		if code, body := send("/admin/users/"+userID+"/disable", `{"reason":"`+name+`"}`); code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d %s", name, code, body)
+		}
+		if user, _ := auth.GetUserByID(userID); user.DisabledReason != name {
+			t.Errorf("%s: expected the reason to be stored, got %q", name, user.DisabledReason)
+		}
+		if code, body := send("/login", login); code != http.StatusForbidden || !strings.Contains(body, CodeUserDisabled) {
+			t.Errorf("%s: expected 403 user_disabled on login, got %d %s", name, code, body)
+		}
+		if code, body := send("/admin/users/"+userID+"/enable", ""); code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d %s", name, code, body)
+		}
+		if code, body := send("/login", login); code != http.StatusOK {
+			t.Errorf("%s: expected login after enabling, got %d %s", name, code, body)
+		}
+		if code, _ := send("/admin/users/missing/disable", ""); code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for an unknown user, got %d", name, code)
+		}
+	}
+}
+
+func TestValidateUserOnRequestMiddlewares(t *testing.T) {
+	now := time.Now()
+	auth := newTestKit(t, Config{TokenExpiry: "1h", TokenCacheSize: 10, TokenCacheTTL: 10 * time.Minute, ValidateUserOnRequest: true, Clock: testClock(&now)})
+	defer auth.Close()
+
+	for name, handler := range protectedHandlers(auth) {
+		t.Run(name, func(t *testing.T) {
+			get := func(token string) int {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			// Each change takes effect on the very next request, even for
+			// tokens and users already in the token and user status caches
+			for change, apply := range map[string]func(userID string) error{
+				"deleted":  func(userID string) error { return auth.DeleteUser(userID) },
+				"disabled": func(userID string) error { return auth.DisableUser(userID, "") },
+				"revoked":  func(userID string) error { return auth.RevokeAllUserTokens(userID) },
+				"updated": func(userID string) error {
+					_, err := auth.UpdateUser(userID, map[string]interface{}{"must_change_password": true})
+					return err
+				},
+			} {
+				tokens := loginTestUser(t, auth, name+"-"+change+"@example.com")
+				if code := get(tokens.AccessToken); code != http.StatusOK {
+					t.Fatalf("Expected 200 before the user was %s, got %d", change, code)
+				}
+				if err := apply(tokens.User.ID); err != nil {
+					t.Fatal(err)
+				}
+				if code := get(tokens.AccessToken); code != http.StatusUnauthorized {
+					t.Errorf("Expected 401 once the user was %s, got %d", change, code)
+				}
+			}
+		})
+	}
+}
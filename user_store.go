@@ -0,0 +1,159 @@
+package authkit
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// userShardCount is the number of independently locked shards of a userStore
+const userShardCount = 32
+
+// userShard holds the users whose IDs hash to it
+type userShard struct {
+	mutex sync.RWMutex
+	users map[string]*User
+}
+
+// userStore is the in-memory user table. Users are split across shards keyed
+// by a hash of their ID, each with its own lock, and indexed by email, so
+// lookups neither contend with each other nor wait for writes to other users.
+//
+// Stored users are copy-on-write: get returns the stored record, which must
+// not be modified; writers modify a cloneUser copy and put it back. Writers
+// are serialized by AuthKit.mutex, which keeps read-modify-write sequences
+// and cross-user invariants such as unique emails atomic.
+type userStore struct {
+	seed     maphash.Seed
+	shards   [userShardCount]userShard
+	emailKey func(string) string // The form emails are indexed in
+	changed  func(userID string) // Called after every put and delete, if set
+
+	emailMutex sync.RWMutex
+	emails     map[string]map[string]struct{} // Email key to the IDs of users with that email
+}
+
+// newUserStore creates an empty store indexing emails by emailKey
+func newUserStore(emailKey func(string) string) *userStore {
+	s := &userStore{
+		seed:     maphash.MakeSeed(),
+		emailKey: emailKey,
+		emails:   make(map[string]map[string]struct{}),
+	}
+	for i := range s.shards {
+		s.shards[i].users = make(map[string]*User)
+	}
+	return s
+}
+
+// shard returns the shard holding userID
+func (s *userStore) shard(userID string) *userShard {
+	return &s.shards[maphash.String(s.seed, userID)%userShardCount]
+}
+
+// get returns the stored user with the given ID, which must not be modified
+func (s *userStore) get(userID string) (*User, bool) {
+	shard := s.shard(userID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	user, exists := shard.users[userID]
+	return user, exists
+}
+
+// put stores user, replacing any user with the same ID. user must not be
+// modified afterwards.
+func (s *userStore) put(user *User) {
+	shard := s.shard(user.ID)
+	shard.mutex.Lock()
+	previous, existed := shard.users[user.ID]
+	shard.users[user.ID] = user
+	shard.mutex.Unlock()
+	if s.changed != nil {
+		s.changed(user.ID)
+	}
+
+	if existed && previous.Email == user.Email {
+		return
+	}
+	s.emailMutex.Lock()
+	defer s.emailMutex.Unlock()
+	if existed {
+		s.unindex(previous)
+	}
+	key := s.emailKey(user.Email)
+	if s.emails[key] == nil {
+		s.emails[key] = make(map[string]struct{})
+	}
+	s.emails[key][user.ID] = struct{}{}
+}
+
+// delete removes the user with the given ID
+func (s *userStore) delete(userID string) {
+	shard := s.shard(userID)
+	shard.mutex.Lock()
+	user, exists := shard.users[userID]
+	delete(shard.users, userID)
+	shard.mutex.Unlock()
+	if s.changed != nil {
+		s.changed(userID)
+	}
+
+	if exists {
+		s.emailMutex.Lock()
+		s.unindex(user)
+		s.emailMutex.Unlock()
+	}
+}
+
+// unindex drops user from the email index; the caller holds emailMutex
+func (s *userStore) unindex(user *User) {
+	key := s.emailKey(user.Email)
+	delete(s.emails[key], user.ID)
+	if len(s.emails[key]) == 0 {
+		delete(s.emails, key)
+	}
+}
+
+// withEmail returns the stored users whose email has the given key
+func (s *userStore) withEmail(key string) []*User {
+	s.emailMutex.RLock()
+	ids := make([]string, 0, len(s.emails[key]))
+	for id := range s.emails[key] {
+		ids = append(ids, id)
+	}
+	s.emailMutex.RUnlock()
+
+	users := make([]*User, 0, len(ids))
+	for _, id := range ids {
+		// Skip users whose email changed since the index was read
+		if user, exists := s.get(id); exists && s.emailKey(user.Email) == key {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// all returns the stored users, in no particular order
+func (s *userStore) all() []*User {
+	var users []*User
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mutex.RLock()
+		for _, user := range shard.users {
+			users = append(users, user)
+		}
+		shard.mutex.RUnlock()
+	}
+	return users
+}
+
+// len returns the number of stored users
+func (s *userStore) len() int {
+	n := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mutex.RLock()
+		n += len(shard.users)
+		shard.mutex.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package authkit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUserStoreEmailIndex(t *testing.T) {
+	store := newUserStore(strings.ToLower)
+	store.put(&User{ID: "1", Email: "a@example.com"})
+	store.put(&User{ID: "2", Email: "A@example.com"})
+	if users := store.withEmail("a@example.com"); len(users) != 2 {
+		t.Fatalf("Expected both users under the email key, got %d", len(users))
+	}
+
+	store.put(&User{ID: "1", Email: "b@example.com"})
+	if users := store.withEmail("a@example.com"); len(users) != 1 || users[0].ID != "2" {
+		t.Errorf("Expected the changed email to be unindexed, got %v", users)
+	}
+	if users := store.withEmail("b@example.com"); len(users) != 1 || users[0].ID != "1" {
+		t.Errorf("Expected the new email to be indexed, got %v", users)
+	}
+
+	store.delete("2")
+	if users := store.withEmail("a@example.com"); len(users) != 0 {
+		t.Errorf("Expected the deleted user to be unindexed, got %v", users)
+	}
+	if store.len() != 1 || len(store.all()) != 1 {
+		t.Errorf("Expected one stored user, got %d", store.len())
+	}
+}
+
+func TestUserStoreConcurrentReads(t *testing.T) {
+	auth := newTestKit(t, Config{})
+	defer auth.Close()
+	info, _ := auth.RegisterUser(RegisterRequest{Email: "reader@example.com", Password: "password123", Name: "Reader"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				_, _ = auth.UpdateUser(info.ID, map[string]interface{}{"name": fmt.Sprintf("Reader %d-%d", i, n)})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				if _, err := auth.GetUserByEmail("reader@example.com"); err != nil {
+					t.Errorf("Expected the user found during updates, got %v", err)
+					return
+				}
+				_, _ = auth.GetUserByID(info.ID)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkUsersMixed measures lookups by ID and email with one write in
+// every 16 operations, across a table of 1000 users
+func BenchmarkUsersMixed(b *testing.B) {
+	auth := newTestKit(b, Config{RateLimitRPM: -1})
+	defer auth.Close()
+	const count = 1000
+	ids := make([]string, count)
+	for i := range ids {
+		info, err := auth.AdminCreateUser(RegisterRequest{Email: fmt.Sprintf("user-%d@example.com", i), Password: "password123", Name: "User"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		ids[i] = info.ID
+	}
+
+	var counter int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := int(atomic.AddInt64(&counter, 1))
+			i := n % count
+			switch {
+			case n%16 == 0:
+				_, _ = auth.UpdateUser(ids[i], map[string]interface{}{"name": "Renamed"})
+			case n%2 == 0:
+				_, _ = auth.GetUserByEmail(fmt.Sprintf("user-%d@example.com", i))
+			default:
+				_, _ = auth.GetUserByID(ids[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook defaults (see WebhookConfig)
+const (
+	defaultWebhookMaxAttempts    = 5
+	defaultWebhookInitialBackoff = time.Second
+	defaultWebhookMaxBackoff     = time.Minute
+	defaultWebhookQueueSize      = 1000
+)
+
+// WebhookPayloadVersion is the version of the JSON body webhooks are delivered with
+const WebhookPayloadVersion = "1"
+
+// Webhook request headers
+const (
+	WebhookSignatureHeader = "X-AuthKit-Signature" // "sha256=" and the hex HMAC-SHA256 of the body
+	WebhookEventHeader     = "X-AuthKit-Event"
+	WebhookDeliveryHeader  = "X-AuthKit-Delivery"
+)
+
+// WebhookEndpoint is a URL audit events are posted to
+type WebhookEndpoint struct {
+	URL string
+	// Secret signs the deliveries, see WebhookSignatureHeader
+	Secret string
+	// Events restricts the endpoint to these event types (default: all)
+	Events []AuditEventType
+}
+
+// WebhookConfig posts audit events to external endpoints. Each endpoint has
+// its own bounded queue and delivery goroutine, so slow endpoints never block
+// requests; events that don't fit in the queue are dropped.
+type WebhookConfig struct {
+	Endpoints []WebhookEndpoint
+	// MaxAttempts is how often a delivery is tried before giving up (default: 5).
+	// Network errors, 429 and 5xx responses are retried.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubling after each
+	// one up to MaxBackoff (default: 1s and 1m)
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// QueueSize is how many events wait per endpoint (default: 1000)
+	QueueSize int
+	// HTTPClient delivers the webhooks (default: a client with a 10s timeout)
+	HTTPClient *http.Client
+	// OnError receives deliveries that failed for good and dropped events
+	OnError func(endpoint string, event AuditEvent, err error)
+}
+
+// WebhookPayload is the JSON body of webhook deliveries
+type WebhookPayload struct {
+	Version string     `json:"version"`
+	ID      string     `json:"id"`
+	Event   AuditEvent `json:"event"`
+}
+
+// withDefaults returns a copy of the webhook config with defaults filled in
+func (c WebhookConfig) withDefaults() *WebhookConfig {
+	endpoints := make([]WebhookEndpoint, len(c.Endpoints))
+	for i, endpoint := range c.Endpoints {
+		endpoint.Events = append([]AuditEventType(nil), endpoint.Events...)
+		endpoints[i] = endpoint
+	}
+	c.Endpoints = endpoints
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultWebhookInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultWebhookQueueSize
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &c
+}
+
+// validate checks every endpoint has an absolute http(s) URL and a secret
+func (c *WebhookConfig) validate() error {
+	for i, endpoint := range c.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: Webhooks.Endpoints[%d] has an invalid URL %q", ErrInvalidConfig, i, endpoint.URL)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("%w: Webhooks.Endpoints[%d] requires a Secret", ErrInvalidConfig, i)
+		}
+	}
+	return nil
+}
+
+// SignWebhook returns the WebhookSignatureHeader value for a body, which
+// receivers compare against with hmac.Equal
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher queues events for each endpoint and tracks undelivered ones for FlushWebhooks
+type webhookDispatcher struct {
+	config *WebhookConfig
+	queues []chan WebhookPayload
+
+	mutex   sync.Mutex
+	pending int
+	idle    []chan struct{} // Closed once pending drops to zero
+}
+
+// startWebhooks starts a delivery goroutine per endpoint, stopped by Close
+func (a *AuthKit) startWebhooks() {
+	d := &webhookDispatcher{config: a.config.Webhooks}
+	for _, endpoint := range d.config.Endpoints {
+		queue := make(chan WebhookPayload, d.config.QueueSize)
+		d.queues = append(d.queues, queue)
+
+		a.wg.Add(1)
+		go func(endpoint WebhookEndpoint) {
+			defer a.wg.Done()
+			for {
+				select {
+				case payload := <-queue:
+					a.deliverWebhook(d, endpoint, payload)
+					d.done()
+				case <-a.done:
+					return
+				}
+			}
+		}(endpoint)
+	}
+	a.webhooks = d
+}
+
+// enqueueWebhook queues the event for every endpoint subscribed to its type
+func (a *AuthKit) enqueueWebhook(event AuditEvent) {
+	d := a.webhooks
+	if a.closed.Load() {
+		return
+	}
+	payload := WebhookPayload{Version: WebhookPayloadVersion, ID: uuid.New().String(), Event: event}
+	for i, endpoint := range d.config.Endpoints {
+		if !endpoint.subscribed(event.Type) {
+			continue
+		}
+
+		d.mutex.Lock()
+		d.pending++
+		d.mutex.Unlock()
+
+		select {
+		case d.queues[i] <- payload:
+		default:
+			d.done()
+			a.webhookError(endpoint, event, ErrWebhookQueueFull)
+		}
+	}
+}
+
+// subscribed reports whether the endpoint receives events of the type
+func (e WebhookEndpoint) subscribed(eventType AuditEventType) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhook posts the payload, retrying with exponential backoff. It
+// gives up early when Close is called.
+func (a *AuthKit) deliverWebhook(d *webhookDispatcher, endpoint WebhookEndpoint, payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		a.webhookError(endpoint, payload.Event, err)
+		return
+	}
+
+	backoff := d.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postWebhook(d.config.HTTPClient, endpoint, payload, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= d.config.MaxAttempts {
+			a.webhookError(endpoint, payload.Event, err)
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-a.done:
+			timer.Stop()
+			return
+		}
+		if backoff *= 2; backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+	}
+}
+
+// postWebhook makes one delivery attempt, reporting whether a failure is worth retrying
+func postWebhook(client *http.Client, endpoint WebhookEndpoint, payload WebhookPayload, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, body))
+	req.Header.Set(WebhookEventHeader, string(payload.Event.Type))
+	req.Header.Set(WebhookDeliveryHeader, payload.ID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook endpoint responded %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// webhookError passes a failed or dropped delivery to WebhookConfig.OnError
+func (a *AuthKit) webhookError(endpoint WebhookEndpoint, event AuditEvent, err error) {
+	a.config.Logger.Warn("webhook delivery failed", "endpoint", endpoint.URL, "event", string(event.Type), "error", err)
+	if a.webhooks.config.OnError != nil {
+		a.webhooks.config.OnError(endpoint.URL, event, err)
+	}
+}
+
+// done marks a queued delivery as finished
+func (d *webhookDispatcher) done() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.pending--
+	if d.pending == 0 {
+		for _, idle := range d.idle {
+			close(idle)
+		}
+		d.idle = nil
+	}
+}
+
+// FlushWebhooks waits until every queued webhook has been delivered or has
+// failed for good, or until ctx is done. Call it before Close on shutdown:
+// Close stops delivery and drops whatever is still queued.
+func (a *AuthKit) FlushWebhooks(ctx context.Context) error {
+	d := a.webhooks
+	if d == nil {
+		return nil
+	}
+
+	d.mutex.Lock()
+	if d.pending == 0 {
+		d.mutex.Unlock()
+		return nil
+	}
+	idle := make(chan struct{})
+	d.idle = append(d.idle, idle)
+	d.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,225 @@
+package authkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	var mutex sync.Mutex
+	var payloads []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(got), []byte(SignWebhook("webhook-secret", body))) {
+			t.Errorf("Expected a valid signature, got %q", got)
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Expected a JSON payload, got %q", body)
+		}
+		if r.Header.Get(WebhookEventHeader) != string(payload.Event.Type) || r.Header.Get(WebhookDeliveryHeader) != payload.ID {
+			t.Errorf("Expected the event and delivery headers to match the payload, got %v", r.Header)
+		}
+		mutex.Lock()
+		payloads = append(payloads, payload)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	auth := newTestKit(t, Config{
+		Webhooks: &WebhookConfig{Endpoints: []WebhookEndpoint{
+			{URL: server.URL, Secret: "webhook-secret", Events: []AuditEventType{AuditLoginSucceeded}},
+		}},
+	})
+	defer auth.Close()
+
+	loginTestUser(t, auth, "webhook@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := auth.FlushWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(payloads) != 1 {
+		t.Fatalf("Expected only the login to be delivered, got %+v", payloads)
+	}
+	if p := payloads[0]; p.Version != WebhookPayloadVersion || p.ID == "" || p.Event.Type != AuditLoginSucceeded || p.Event.UserID == "" {
+		t.Errorf("Expected a versioned login payload, got %+v", p)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var failures atomic.Int32
+	auth := newTestKit(t, Config{
+		Webhooks: &WebhookConfig{
+			Endpoints:      []WebhookEndpoint{{URL: server.URL, Secret: "webhook-secret"}},
+			InitialBackoff: time.Millisecond,
+			OnError:        func(string, AuditEvent, error) { failures.Add(1) },
+		},
+	})
+	defer auth.Close()
+
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "retry@example.com", Password: "password123", Name: "Retry"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := auth.FlushWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected two retries after 500s, got %d attempts", got)
+	}
+	if got := failures.Load(); got != 0 {
+		t.Errorf("Expected the delivery to succeed eventually, got %d failures", got)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	var mutex sync.Mutex
+	var failed []AuditEventType
+	auth := newTestKit(t, Config{
+		Webhooks: &WebhookConfig{
+			Endpoints:      []WebhookEndpoint{{URL: server.URL, Secret: "webhook-secret"}},
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			OnError: func(endpoint string, event AuditEvent, err error) {
+				if endpoint != server.URL || err == nil {
+					t.Errorf("Expected the endpoint and error, got %q and %v", endpoint, err)
+				}
+				mutex.Lock()
+				failed = append(failed, event.Type)
+				mutex.Unlock()
+			},
+		},
+	})
+	defer auth.Close()
+
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "giveup@example.com", Password: "password123", Name: "Give Up"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := auth.FlushWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected MaxAttempts deliveries, got %d", got)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(failed) != 1 || failed[0] != AuditUserRegistered {
+		t.Errorf("Expected the failed delivery to be reported, got %v", failed)
+	}
+}
+
+func TestWebhookNoRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	auth := newTestKit(t, Config{
+		Webhooks: &WebhookConfig{
+			Endpoints:      []WebhookEndpoint{{URL: server.URL, Secret: "webhook-secret"}},
+			InitialBackoff: time.Millisecond,
+		},
+	})
+	defer auth.Close()
+
+	_, _ = auth.RegisterUser(RegisterRequest{Email: "client@example.com", Password: "password123", Name: "Client"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := auth.FlushWebhooks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Expected 4xx responses not to be retried, got %d attempts", got)
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	var dropped atomic.Int32
+	auth := newTestKit(t, Config{
+		Webhooks: &WebhookConfig{
+			Endpoints: []WebhookEndpoint{{URL: server.URL, Secret: "webhook-secret"}},
+			QueueSize: 1,
+			OnError: func(_ string, _ AuditEvent, err error) {
+				if errors.Is(err, ErrWebhookQueueFull) {
+					dropped.Add(1)
+				}
+			},
+		},
+	})
+	defer auth.Close()
+
+	// The first event is being delivered, the second waits in the queue
+	// and the rest are dropped
+	for i := 0; i < 5; i++ {
+		auth.audit(AuditEvent{Type: AuditTokenRevoked})
+		if i == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	if got := dropped.Load(); got != 3 {
+		t.Errorf("Expected 3 dropped events, got %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := auth.FlushWebhooks(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the flush to time out while deliveries are stuck, got %v", err)
+	}
+	close(release)
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint WebhookEndpoint
+	}{
+		{"relative URL", WebhookEndpoint{URL: "/hooks", Secret: "secret"}},
+		{"bad scheme", WebhookEndpoint{URL: "ftp://example.com/hooks", Secret: "secret"}},
+		{"missing secret", WebhookEndpoint{URL: "https://example.com/hooks"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{JWTSecret: "test-secret-key-for-testing-only", Webhooks: &WebhookConfig{Endpoints: []WebhookEndpoint{tt.endpoint}}}
+			if err := config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}